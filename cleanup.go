@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/owhelm/helm-kustomize/internal/extractor"
+	"github.com/owhelm/helm-kustomize/internal/options"
+)
+
+// runCleanup removes the temporary directories crashed or killed renders left behind, which pile
+// up on long-lived build agents. With --timeout, it stops at the deadline, oldest directories
+// being removed first, so it fits in the time a job can spare.
+func runCleanup(ctx context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	olderThan := fs.Duration("older-than", options.DefaultStaleTempMaxAge, "remove temporary directories last modified longer ago than this")
+	dryRun := fs.Bool("dry-run", false, "list the directories that would be removed without removing them")
+	timeout := fs.Duration("timeout", 0, "stop after this long, leaving the remaining directories (0 means no limit)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	// Running renders keep their directory fresh, so only a positive age keeps them safe
+	if *olderThan <= 0 {
+		return fmt.Errorf("--older-than must be positive, got %s", *olderThan)
+	}
+	if *timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative, got %s", *timeout)
+	}
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	stale, err := extractor.FindStale(ctx, *olderThan)
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	removed, failed := 0, 0
+	var freed int64
+	for _, dir := range stale {
+		if ctx.Err() != nil {
+			break
+		}
+		verb := "Would remove"
+		if !*dryRun {
+			if err := os.RemoveAll(dir.Path); err != nil {
+				fmt.Fprintf(stdout, "Failed to remove %s: %v\n", dir.Path, err)
+				failed++
+				continue
+			}
+			verb = "Removed"
+		}
+		fmt.Fprintf(stdout, "%s %s (%s, last modified %s)\n", verb, dir.Path, formatSize(int(dir.Size)), dir.ModTime.UTC().Format(time.RFC3339))
+		removed++
+		freed += dir.Size
+	}
+
+	if *dryRun {
+		fmt.Fprintf(stdout, "Found %d stale directories, %s in total\n", removed, formatSize(int(freed)))
+	} else {
+		fmt.Fprintf(stdout, "Removed %d stale directories, freeing %s\n", removed, formatSize(int(freed)))
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("cleanup stopped before it was done, run it again to remove the rest: %w", ctx.Err())
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d stale directories", failed)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// makeTempDirs creates directories with a 1KiB file in the temp directory, with the given
+// modification times, and points TMPDIR at it
+func makeTempDirs(t *testing.T, dirs map[string]time.Time) string {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	for name, modTime := range dirs {
+		path := filepath.Join(tmp, name)
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(path, "all.yaml"), bytes.Repeat([]byte("x"), 1024), 0o644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set times of %s: %v", name, err)
+		}
+	}
+	return tmp
+}
+
+func TestRunCleanup(t *testing.T) {
+	older := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	old := older.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		args       []string
+		want       string
+		wantExists map[string]bool
+	}{
+		{
+			name: "remove",
+			want: `Removed TMP/helm-kustomize-older (1.0KiB, last modified 2026-01-02T03:04:05Z)
+Removed TMP/helm-kustomize-old (1.0KiB, last modified 2026-01-02T04:04:05Z)
+Removed 2 stale directories, freeing 2.0KiB
+`,
+			wantExists: map[string]bool{"helm-kustomize-older": false, "helm-kustomize-old": false, "helm-kustomize-fresh": true, "other-old": true},
+		},
+		{
+			name: "dry run",
+			args: []string{"--dry-run"},
+			want: `Would remove TMP/helm-kustomize-older (1.0KiB, last modified 2026-01-02T03:04:05Z)
+Would remove TMP/helm-kustomize-old (1.0KiB, last modified 2026-01-02T04:04:05Z)
+Found 2 stale directories, 2.0KiB in total
+`,
+			wantExists: map[string]bool{"helm-kustomize-older": true, "helm-kustomize-old": true, "helm-kustomize-fresh": true},
+		},
+		{
+			name:       "older than",
+			args:       []string{"--older-than", "1000000h"},
+			want:       "Removed 0 stale directories, freeing 0B\n",
+			wantExists: map[string]bool{"helm-kustomize-older": true, "helm-kustomize-old": true, "helm-kustomize-fresh": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := makeTempDirs(t, map[string]time.Time{
+				"helm-kustomize-older": older,
+				"helm-kustomize-old":   old,
+				"helm-kustomize-fresh": time.Now(),
+				"other-old":            old,
+			})
+
+			var stdout bytes.Buffer
+			if err := runCleanup(context.Background(), tt.args, nil, &stdout); err != nil {
+				t.Fatalf("runCleanup() error = %v, want nil", err)
+			}
+			if got := strings.ReplaceAll(stdout.String(), tmp, "TMP"); got != tt.want {
+				t.Errorf("runCleanup() output = %q, want %q", got, tt.want)
+			}
+			for name, wantExists := range tt.wantExists {
+				_, err := os.Stat(filepath.Join(tmp, name))
+				if exists := err == nil; exists != wantExists {
+					t.Errorf("%s exists = %v, want %v", name, exists, wantExists)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCleanup_Interrupted(t *testing.T) {
+	tmp := makeTempDirs(t, map[string]time.Time{"helm-kustomize-old": time.Now().Add(-48 * time.Hour)})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var stdout bytes.Buffer
+	err := runCleanup(ctx, nil, nil, &stdout)
+	if err == nil || !strings.Contains(err.Error(), "cleanup stopped before it was done") {
+		t.Errorf("runCleanup() error = %v, want error containing %q", err, "cleanup stopped before it was done")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "helm-kustomize-old")); err != nil {
+		t.Errorf("Stat() error = %v, want the directory left alone", err)
+	}
+}
+
+func TestRunCleanup_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		wantErrSubstr string
+	}{
+		{name: "zero age", args: []string{"--older-than", "0"}, wantErrSubstr: "--older-than must be positive"},
+		{name: "negative timeout", args: []string{"--timeout", "-1s"}, wantErrSubstr: "--timeout must not be negative"},
+		{name: "argument", args: []string{"extra"}, wantErrSubstr: `unexpected argument "extra"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runCleanup(context.Background(), tt.args, nil, &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runCleanup() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/internal/argocd"
+	"github.com/owhelm/helm-kustomize/internal/cluster"
+	"github.com/owhelm/helm-kustomize/internal/diff"
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
+	"github.com/owhelm/helm-kustomize/internal/flux"
+	"github.com/owhelm/helm-kustomize/internal/helm"
+	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/internal/policy"
+	"github.com/owhelm/helm-kustomize/internal/transform"
+	"github.com/owhelm/helm-kustomize/internal/version"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// command is a helm-kustomize subcommand. It receives the arguments following
+// the subcommand name, reads manifests from stdin if needed and writes its results to stdout.
+// ctx is cancelled when the process is interrupted.
+type command func(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error
+
+// commands maps subcommand names to their implementations.
+// Invocations without a known subcommand run the post-renderer.
+var commands = map[string]command{
+	"version":       runVersion,
+	"diff":          runDiff,
+	"test":          runTest,
+	"template":      runTemplate,
+	"flux":          runFlux,
+	"import-argocd": runImportArgoCD,
+	"verify-parity": runVerifyParity,
+	"explain":       runExplain,
+	"match":         runMatch,
+	"record":        runRecord,
+	"stats":         runStats,
+	"cleanup":       runCleanup,
+	"impact":        runImpact,
+}
+
+// runVersion prints the plugin version, the kustomize version used for builds and Go build info
+func runVersion(_ context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("version does not accept arguments")
+	}
+
+	kustomizeVersion := "unknown"
+	if info, err := kustomize.Version(); err == nil {
+		kustomizeVersion = fmt.Sprintf("%s (kubectl %s)", info.Kustomize, info.Kubectl)
+	}
+
+	fmt.Fprintf(stdout, "helm-kustomize: %s\n", version.Version)
+	fmt.Fprintf(stdout, "kustomize: %s\n", kustomizeVersion)
+	fmt.Fprintf(stdout, "go: %s\n", version.ReadBuildInfo())
+	return nil
+}
+
+// runDiff renders the manifests read from stdin like the post-renderer does and prints the
+// field-level drift between the result and the live cluster, using a server-side dry-run
+func runDiff(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	var cfg cluster.Config
+	opts, err := options.LoadWithFlags(args, func(fs *flag.FlagSet) {
+		fs.StringVar(&cfg.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file")
+		fs.StringVar(&cfg.Context, "context", "", "kubeconfig context to use")
+		fs.StringVar(&cfg.Namespace, "namespace", "", "namespace for resources without one")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load options: %w", err)
+	}
+	// The cluster diff replaces the local overlay diff and dry-run, and kubectl reads the rendered YAML
+	opts.Diff = false
+	opts.DryRunServer = false
+	opts.Output = options.OutputYAML
+
+	input := &bytes.Buffer{}
+	if _, err := io.Copy(input, stdin); err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	renderer := &KustomizePostRenderer{Options: opts}
+	output, err := renderer.RunContext(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	text, _, err := cluster.Diff(ctx, output.Bytes(), cfg)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(stdout, text)
+	return err
+}
+
+// runTest renders a chart, given with its helm template arguments after --, or the manifests read
+// from stdin, applies the post-render and evaluates the Rego policies of --policy-dir against the
+// result with conftest, printing the results per policy. --output selects a text (default) or
+// JSON report.
+func runTest(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	var chartArgs []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, chartArgs = args[:i], args[i+1:]
+		if len(chartArgs) == 0 {
+			return fmt.Errorf("test requires a chart after --, e.g. helm-kustomize test --policy-dir policies -- my-release ./chart")
+		}
+		for _, arg := range chartArgs {
+			if strings.HasPrefix(arg, "--post-renderer") {
+				return fmt.Errorf("test applies the post-render itself, pass its options before --")
+			}
+		}
+	}
+
+	var policyDir string
+	opts, err := options.LoadWithFlags(args, func(fs *flag.FlagSet) {
+		fs.StringVar(&policyDir, "policy-dir", "", "directory of Rego policies to evaluate")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load options: %w", err)
+	}
+	if policyDir == "" {
+		return fmt.Errorf("--policy-dir is required")
+	}
+	// --output applies to the report, conftest reads the rendered YAML
+	report := opts.Output
+	opts.Diff = false
+	opts.Output = options.OutputYAML
+
+	input := &bytes.Buffer{}
+	if chartArgs != nil {
+		if err := helmTemplate(ctx, chartArgs, input); err != nil {
+			return err
+		}
+	} else if _, err := io.Copy(input, stdin); err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	renderer := &KustomizePostRenderer{Options: opts}
+	output, err := renderer.RunContext(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	results, err := policy.Conftest(ctx, output.Bytes(), policyDir)
+	if err != nil {
+		return err
+	}
+
+	if err := writeTestReport(stdout, results, report); err != nil {
+		return fmt.Errorf("failed to write test results: %w", err)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Passed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errdefs.Wrap(errdefs.ErrPolicy, fmt.Errorf("%d of %d policies failed", failed, len(results)))
+	}
+	return nil
+}
+
+// writeTestReport writes the policy results in the given format
+func writeTestReport(w io.Writer, results []policy.Result, format options.OutputFormat) error {
+	switch format {
+	case options.OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	case options.OutputNDJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+		}
+		if _, err := fmt.Fprintf(w, "%s %s (%d passed, %d failed, %d warnings)\n", status, result.Policy,
+			result.Successes, len(result.Failures), len(result.Warnings)); err != nil {
+			return err
+		}
+		for _, failure := range result.Failures {
+			if _, err := fmt.Fprintf(w, "  - %s\n", failure); err != nil {
+				return err
+			}
+		}
+		for _, warning := range result.Warnings {
+			if _, err := fmt.Fprintf(w, "  ~ %s\n", warning); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runTemplate runs `helm template` with the given chart and Helm arguments, registering
+// helm-kustomize as the post-renderer, and streams the rendered manifests to stdout.
+// Post-renderer arguments are passed with --post-renderer-args as usual.
+func runTemplate(ctx context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("template requires a chart, e.g. helm-kustomize template ./chart")
+	}
+	for _, arg := range args {
+		if arg == "--post-renderer" || strings.HasPrefix(arg, "--post-renderer=") {
+			return fmt.Errorf("template sets --post-renderer itself, use --post-renderer-args to pass options")
+		}
+	}
+
+	helmVersion, err := helm.DetectVersion()
+	if err != nil {
+		return fmt.Errorf("failed to detect Helm version, set %s to skip detection: %w", helm.VersionEnvVar, err)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate helm-kustomize executable: %w", err)
+	}
+
+	return helmTemplate(ctx, append(slices.Clone(args), helm.PostRendererFlags(helmVersion, executable)...), stdout)
+}
+
+// helmTemplate runs `helm template` with args and writes the rendered manifests to stdout
+func helmTemplate(ctx context.Context, args []string, stdout io.Writer) error {
+	cmd := exec.CommandContext(ctx, helm.Binary(), append([]string{"template"}, args...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("helm template failed: %w", err)
+	}
+	return nil
+}
+
+// runFlux converts between Flux HelmRelease kustomize post-renderers and KustomizePluginData.
+// It reads either HelmReleases, which are converted to KustomizePluginData documents, or a
+// KustomizePluginData document, which is converted to the spec.postRenderers of a HelmRelease.
+func runFlux(_ context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("flux", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	name := fs.String("name", "", "name of the generated document (default: <release>-kustomize, required for a HelmRelease)")
+	namespace := fs.String("namespace", "", "namespace of the generated HelmRelease")
+	overlay := fs.String("overlay", ".", "directory of the files map holding the kustomization to convert")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	result, err := parser.ParseManifests(input)
+	if err != nil {
+		return fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	if result.KustomizePluginData != nil {
+		if len(result.Pipelines) > 1 {
+			return fmt.Errorf("input has %d KustomizePluginData pipelines, a HelmRelease holds the patches of one", len(result.Pipelines))
+		}
+		if *name == "" {
+			return fmt.Errorf("--name of the HelmRelease is required")
+		}
+		release, err := flux.FromPluginData(result.KustomizePluginData, result.KustomizePluginData.OverlayDir(*overlay), *name, *namespace)
+		if err != nil {
+			return fmt.Errorf("failed to convert KustomizePluginData: %w", err)
+		}
+		_, err = stdout.Write(release)
+		return err
+	}
+
+	var docs [][]byte
+	for _, resource := range result.OtherResources {
+		if !flux.IsHelmRelease(resource) {
+			continue
+		}
+		docName := *name
+		if docName == "" {
+			docName = manifest.IDOf(resource).Name + "-kustomize"
+		}
+		data, err := flux.ToPluginData(resource, docName)
+		if err != nil {
+			return fmt.Errorf("failed to convert HelmRelease: %w", err)
+		}
+		docs = append(docs, data)
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("input contains neither a HelmRelease nor KustomizePluginData")
+	}
+
+	return parser.WriteDocuments(stdout, docs)
+}
+
+// runImportArgoCD converts the kustomize options of the ArgoCD Applications in a file to
+// KustomizePluginData documents, to be added to the chart's templates when migrating off
+// ArgoCD-native kustomize options. The file "-" reads stdin.
+func runImportArgoCD(_ context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import-argocd", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	name := fs.String("name", "", "name of the generated document (default: <application>-kustomize)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("import-argocd requires an Application file, e.g. helm-kustomize import-argocd app.yaml")
+	}
+
+	var input []byte
+	var err error
+	if file := fs.Arg(0); file == "-" {
+		input, err = io.ReadAll(stdin)
+	} else {
+		input, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read Application: %w", err)
+	}
+	result, err := parser.ParseManifests(input)
+	if err != nil {
+		return fmt.Errorf("failed to parse Application: %w", err)
+	}
+
+	var docs [][]byte
+	for _, resource := range result.OtherResources {
+		if !argocd.IsApplication(resource) {
+			continue
+		}
+		docName := *name
+		if docName == "" {
+			docName = manifest.IDOf(resource).Name + "-kustomize"
+		}
+		data, err := argocd.ImportApplication(resource, docName)
+		if err != nil {
+			return fmt.Errorf("failed to import Application: %w", err)
+		}
+		docs = append(docs, data)
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("%s contains no ArgoCD Application", fs.Arg(0))
+	}
+
+	return parser.WriteDocuments(stdout, docs)
+}
+
+// runVerifyParity builds a kustomization directory with kubectl kustomize, as the post-renderer
+// does, and with the standalone binary of --binary, and prints a diff of the resources whose
+// output differs. It fails if the outputs differ, so parity can be checked in CI.
+func runVerifyParity(ctx context.Context, args []string, _ io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify-parity", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	binary := fs.String("binary", "kustomize", "kustomize or kubectl binary to compare against")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("verify-parity requires a kustomization directory, e.g. helm-kustomize verify-parity overlays/prod")
+	}
+	dir := fs.Arg(0)
+
+	plugin, _, _, err := kustomize.BuildWithWarnings(ctx, dir)
+	if err != nil {
+		return err
+	}
+	external, err := kustomize.BuildExternal(ctx, *binary, dir)
+	if err != nil {
+		return err
+	}
+
+	before, err := manifest.ToJSON(plugin)
+	if err != nil {
+		return fmt.Errorf("failed to parse kubectl kustomize output: %w", err)
+	}
+	after, err := manifest.ToJSON(external)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s output: %w", *binary, err)
+	}
+
+	text, err := diff.Resources(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to diff outputs: %w", err)
+	}
+	if text == "" {
+		_, err := fmt.Fprintf(stdout, "%s builds identically with kubectl kustomize and %s (%d resources)\n", dir, *binary, len(before))
+		return err
+	}
+	if _, err := io.WriteString(stdout, text); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s builds differently with kubectl kustomize and %s", dir, *binary)
+}
+
+// runExplain reads rendered manifests with KustomizePluginData from stdin and prints, without
+// building, what each transformer of the kustomization will do and which resources it selects,
+// so reviewers can assess the blast radius of plugin data from the chart alone
+func runExplain(_ context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	overlay := fs.String("overlay", ".", "directory of the files map holding the kustomization to explain")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	result, err := parser.ParseManifests(input)
+	if err != nil {
+		return fmt.Errorf("failed to parse input: %w", err)
+	}
+	if result.KustomizePluginData == nil {
+		return fmt.Errorf("input contains no KustomizePluginData")
+	}
+
+	for i, data := range result.Pipelines {
+		// The explanation of charts with a single pipeline has no heading
+		if len(result.Pipelines) > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "Pipeline %q, run %d of %d:\n", data.Name, i+1, len(result.Pipelines))
+		}
+		if err := explainPipeline(data, data.OverlayDir(*overlay), stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// explainPipeline prints what the kustomization of one pipeline will do, see runExplain
+func explainPipeline(data *parser.KustomizePluginData, overlay string, stdout io.Writer) error {
+	file, err := kustomize.FindKustomization(data.Files, overlay)
+	if err != nil {
+		return err
+	}
+	var content []byte
+	if file == "" {
+		file = "generated kustomization"
+		if content, err = kustomize.GenerateKustomization(data.Files, overlay); err != nil {
+			return fmt.Errorf("failed to generate kustomization.yaml: %w", err)
+		}
+	} else {
+		content = []byte(data.Files[file])
+	}
+	kust, err := kustomize.ParseKustomization(content)
+	if err != nil {
+		return err
+	}
+	if data.Labels != nil || data.PodClasses != nil {
+		// The labels and pod classes of the plugin data are added to the kustomization as the render does
+		if data.Labels != nil {
+			kust.AddLabels(data.Labels.Pairs, data.Labels.IncludeSelectors, data.Labels.IncludeTemplates)
+		}
+		if data.PodClasses != nil {
+			if err := kust.AddPodSpecPatches(data.PodClasses.Fields(), data.PodClasses.Target); err != nil {
+				return err
+			}
+		}
+		if content, err = kust.Marshal(); err != nil {
+			return err
+		}
+		if kust, err = kustomize.ParseKustomization(content); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(stdout, "Plugin data:")
+	for _, line := range explainPluginData(data) {
+		fmt.Fprintf(stdout, "  %s\n", line)
+	}
+	fmt.Fprintf(stdout, "Transformers of %s, in the order kustomize runs them:\n", file)
+	lines := kust.Explain(data.Files, overlay)
+	if len(lines) == 0 {
+		lines = []string{"none"}
+	}
+	for _, line := range lines {
+		fmt.Fprintf(stdout, "  %s\n", line)
+	}
+	return nil
+}
+
+// explainPluginData describes which resources the plugin data passes to kustomize and where
+// generated resources are placed
+func explainPluginData(data *parser.KustomizePluginData) []string {
+	var lines []string
+	switch {
+	case len(data.IncludeKinds) > 0:
+		lines = append(lines, fmt.Sprintf("includeKinds: transforms only the kinds %s", strings.Join(data.IncludeKinds, ", ")))
+	default:
+		lines = append(lines, "transforms all resources")
+	}
+	if len(data.ExcludeKinds) > 0 {
+		lines = append(lines, fmt.Sprintf("excludeKinds: passes the kinds %s through untouched", strings.Join(data.ExcludeKinds, ", ")))
+	}
+	if data.Exclude != nil {
+		if data.Exclude.Selector != "" {
+			lines = append(lines, fmt.Sprintf("exclude.selector: passes resources with labels %s through untouched", data.Exclude.Selector))
+		}
+		if data.Exclude.AnnotationSelector != "" {
+			lines = append(lines, fmt.Sprintf("exclude.annotationSelector: passes resources with annotations %s through untouched", data.Exclude.AnnotationSelector))
+		}
+	}
+	if data.Generated != nil && data.Generated.Placement != "" {
+		lines = append(lines, fmt.Sprintf("generated.placement: places generated resources with placement %s", data.Generated.Placement))
+	}
+	if data.Generated != nil && data.Generated.Annotate {
+		lines = append(lines, fmt.Sprintf("generated.annotate: annotates generated resources with %s", transform.GeneratedAnnotation))
+	}
+	if data.Inject != nil {
+		var names []string
+		for _, container := range slices.Concat(data.Inject.InitContainers, data.Inject.Containers) {
+			names = append(names, fmt.Sprint(container["name"]))
+		}
+		lines = append(lines, fmt.Sprintf("inject: adds the containers %s to the pod templates of %s", strings.Join(names, ", "), data.Inject.Target))
+	}
+	if defaults := data.ResourceDefaults; defaults != nil {
+		lines = append(lines, fmt.Sprintf("resourceDefaults: sets requests %s and limits %s on the containers lacking them in the pod templates of %s",
+			quantities(defaults.Requests), quantities(defaults.Limits), defaults.Target))
+	}
+	if scheduling := data.Scheduling; scheduling != nil {
+		var fields []string
+		if len(scheduling.NodeSelector) > 0 {
+			fields = append(fields, "node selector "+quantities(scheduling.NodeSelector))
+		}
+		if len(scheduling.Tolerations) > 0 {
+			fields = append(fields, fmt.Sprintf("tolerations (%d)", len(scheduling.Tolerations)))
+		}
+		if len(scheduling.TopologySpreadConstraints) > 0 {
+			fields = append(fields, fmt.Sprintf("topology spread constraints (%d)", len(scheduling.TopologySpreadConstraints)))
+		}
+		for _, name := range slices.Sorted(maps.Keys(scheduling.Affinity)) {
+			fields = append(fields, name)
+		}
+		lines = append(lines, fmt.Sprintf("scheduling: sets %s on the pod templates of %s", strings.Join(fields, ", "), scheduling.Target))
+	}
+	if hardening := data.Hardening; hardening != nil {
+		settings := "runAsNonRoot, a RuntimeDefault seccomp profile, no privilege escalation and dropped capabilities"
+		if hardening.ReadOnlyRootFilesystem {
+			settings = "runAsNonRoot, a RuntimeDefault seccomp profile, no privilege escalation, dropped capabilities and a read-only root filesystem"
+		}
+		lines = append(lines, fmt.Sprintf("hardening: enforces %s on the pod templates of %s", settings, hardening.Target))
+	}
+	if podClasses := data.PodClasses; podClasses != nil {
+		lines = append(lines, fmt.Sprintf("podClasses: patches %s into the pod templates of %s", quantities(podClasses.Fields()), podClasses.Target))
+	}
+	for _, policy := range data.KyvernoPolicies {
+		lines = append(lines, fmt.Sprintf("kyvernoPolicies: applies the Kyverno policies of %s to the built resources", policy))
+	}
+	if flags := data.BuildOptions.Flags(); len(flags) > 0 {
+		lines = append(lines, fmt.Sprintf("buildOptions: builds with kubectl kustomize %s", strings.Join(flags, " ")))
+	}
+	return lines
+}
+
+// quantities formats requests, limits or labels as sorted name=value pairs, or "none"
+func quantities(values map[string]string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	pairs := make([]string, 0, len(values))
+	for name, value := range values {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// runMatch reads a rendered stream from stdin and prints the resources a kustomize patch target
+// selects, to debug patches that apply to nothing. It fails if no resource matches, listing the
+// resources of the target kind, if any, as candidates.
+func runMatch(_ context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	targetFlag := fs.String("target", "", "patch target as field=value pairs, e.g. kind=Deployment,name=web")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *targetFlag == "" {
+		return fmt.Errorf("--target is required, e.g. helm-kustomize match --target kind=Deployment,name=web")
+	}
+	target, err := kustomize.ParseTarget(*targetFlag)
+	if err != nil {
+		return err
+	}
+
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	result, err := parser.ParseManifests(input)
+	if err != nil {
+		return fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	matched := 0
+	var candidates []string
+	for i, resource := range result.OtherResources {
+		line := describeDocument(resource, result.OtherDocuments[i])
+		switch {
+		case target.Matches(resource):
+			matched++
+			fmt.Fprintln(stdout, line)
+		case target.Kind != "" && manifest.IDOf(resource).Kind == target.Kind:
+			candidates = append(candidates, line)
+		}
+	}
+	if matched > 0 {
+		return nil
+	}
+
+	if len(candidates) > 0 {
+		fmt.Fprintf(stdout, "Resources of kind %s:\n", target.Kind)
+		for _, line := range candidates {
+			fmt.Fprintf(stdout, "  %s\n", line)
+		}
+	}
+	return fmt.Errorf("no resource matches %s", target)
+}
+
+// describeDocument formats the ID of a resource with the template it was rendered from
+func describeDocument(resource map[string]any, doc []byte) string {
+	line := manifest.IDOf(resource).String()
+	if source := parser.SourceOf(doc); source != "" {
+		line += " (" + source + ")"
+	}
+	return line
+}
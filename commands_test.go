@@ -0,0 +1,916 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+func TestRunVersion(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := runVersion(context.Background(), nil, nil, &stdout); err != nil {
+		t.Fatalf("runVersion() error = %v, want nil", err)
+	}
+
+	output := stdout.String()
+	if !strings.Contains(output, "helm-kustomize: "+version.Version+"\n") {
+		t.Errorf("Expected plugin version in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, "kustomize: ") {
+		t.Errorf("Expected kustomize version in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, "go: go") {
+		t.Errorf("Expected Go version in output, got:\n%s", output)
+	}
+}
+
+func TestRunVersion_KubectlNotFound(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	var stdout bytes.Buffer
+	if err := runVersion(context.Background(), nil, nil, &stdout); err != nil {
+		t.Fatalf("runVersion() error = %v, want nil", err)
+	}
+
+	if !strings.Contains(stdout.String(), "kustomize: unknown\n") {
+		t.Errorf("Expected unknown kustomize version, got:\n%s", stdout.String())
+	}
+}
+
+func TestRunVersion_UnexpectedArgs(t *testing.T) {
+	var stdout bytes.Buffer
+	if err := runVersion(context.Background(), []string{"extra"}, nil, &stdout); err == nil {
+		t.Fatal("runVersion() should return error for unexpected arguments")
+	}
+}
+
+// installFakeKubectlDiff puts a fake kubectl first in PATH that records its arguments and
+// stdin in dir and reports a difference
+func installFakeKubectlDiff(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+		"cat > \"" + filepath.Join(dir, "stdin") + "\"\n" +
+		"echo '+  replicas: 3'\n" +
+		"exit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestRunDiff(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+	dir := installFakeKubectlDiff(t)
+
+	input := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`
+	var stdout bytes.Buffer
+	args := []string{"--kubeconfig", "/tmp/kubeconfig", "--context", "staging"}
+	if err := runDiff(context.Background(), args, strings.NewReader(input), &stdout); err != nil {
+		t.Fatalf("runDiff() error = %v, want nil", err)
+	}
+
+	if stdout.String() != "+  replicas: 3\n" {
+		t.Errorf("runDiff() output = %q, want kubectl diff output", stdout.String())
+	}
+
+	gotArgs, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatalf("Failed to read kubectl args: %v", err)
+	}
+	wantArgs := "diff --server-side -f - --kubeconfig /tmp/kubeconfig --context staging\n"
+	if string(gotArgs) != wantArgs {
+		t.Errorf("kubectl args = %q, want %q", gotArgs, wantArgs)
+	}
+
+	gotStdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatalf("Failed to read kubectl stdin: %v", err)
+	}
+	if string(gotStdin) != input {
+		t.Errorf("kubectl stdin = %q, want rendered manifests", gotStdin)
+	}
+}
+
+func TestRunDiff_InvalidFlag(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	var stdout bytes.Buffer
+	if err := runDiff(context.Background(), []string{"--unknown"}, strings.NewReader(""), &stdout); err == nil {
+		t.Fatal("runDiff() should return error for unknown flags")
+	}
+}
+
+// installFakeConftest puts a fake conftest first in PATH that records its stdin in dir and
+// reports a failing and a passing policy
+func installFakeConftest(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"cat > \"" + filepath.Join(dir, "stdin") + "\"\n" +
+		"cat <<'EOF'\n" +
+		`[{"namespace": "security", "successes": 1, "failures": [{"msg": "ConfigMap/test is not allowed"}]},` +
+		`{"namespace": "main", "successes": 2, "warnings": [{"msg": "ConfigMap/test has no owner"}]}]` + "\n" +
+		"EOF\n" +
+		"exit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "conftest"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake conftest: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestRunTest(t *testing.T) {
+	input := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+`
+	tests := []struct {
+		name       string
+		args       []string
+		wantOutput string
+	}{
+		{
+			name: "text report",
+			args: []string{"--policy-dir", "policies"},
+			wantOutput: "PASS main (2 passed, 0 failed, 1 warnings)\n" +
+				"  ~ ConfigMap/test has no owner\n" +
+				"FAIL security (1 passed, 1 failed, 0 warnings)\n" +
+				"  - ConfigMap/test is not allowed\n",
+		},
+		{
+			name: "ndjson report",
+			args: []string{"--policy-dir", "policies", "--output", "ndjson"},
+			wantOutput: `{"policy":"main","successes":2,"failures":[],"warnings":["ConfigMap/test has no owner"]}` + "\n" +
+				`{"policy":"security","successes":1,"failures":["ConfigMap/test is not allowed"],"warnings":[]}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+			dir := installFakeConftest(t)
+
+			var stdout bytes.Buffer
+			err := runTest(context.Background(), tt.args, strings.NewReader(input), &stdout)
+			if !errors.Is(err, errdefs.ErrPolicy) {
+				t.Fatalf("runTest() error = %v, want policy violation", err)
+			}
+			if !strings.Contains(err.Error(), "1 of 2 policies failed") {
+				t.Errorf("runTest() error = %v, want failure count", err)
+			}
+			if stdout.String() != tt.wantOutput {
+				t.Errorf("runTest() output = %q, want %q", stdout.String(), tt.wantOutput)
+			}
+
+			gotStdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+			if err != nil {
+				t.Fatalf("Failed to read conftest stdin: %v", err)
+			}
+			if string(gotStdin) != input {
+				t.Errorf("conftest stdin = %q, want rendered manifests", gotStdin)
+			}
+		})
+	}
+}
+
+func TestRunTest_Chart(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+	dir := installFakeConftest(t)
+
+	// The fake helm renders a ConfigMap and records its arguments
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+		"printf 'apiVersion: v1\\nkind: ConfigMap\\nmetadata:\\n  name: test\\n'\n"
+	helmBin := filepath.Join(dir, "helm")
+	if err := os.WriteFile(helmBin, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake helm: %v", err)
+	}
+	t.Setenv("HELM_BIN", helmBin)
+
+	var stdout bytes.Buffer
+	args := []string{"--policy-dir", "policies", "--", "my-release", "./chart", "--values", "prod.yaml"}
+	err := runTest(context.Background(), args, strings.NewReader("ignored"), &stdout)
+	if !errors.Is(err, errdefs.ErrPolicy) {
+		t.Fatalf("runTest() error = %v, want policy violation", err)
+	}
+
+	gotArgs, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatalf("Failed to read helm args: %v", err)
+	}
+	if want := "template my-release ./chart --values prod.yaml\n"; string(gotArgs) != want {
+		t.Errorf("helm args = %q, want %q", gotArgs, want)
+	}
+	gotStdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatalf("Failed to read conftest stdin: %v", err)
+	}
+	if want := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n"; string(gotStdin) != want {
+		t.Errorf("conftest stdin = %q, want the rendered chart", gotStdin)
+	}
+}
+
+func TestRunTest_ChartErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantErrSubstr string
+	}{
+		{name: "no chart", args: []string{"--policy-dir", "policies", "--"}, wantErrSubstr: "test requires a chart after --"},
+		{name: "own post-renderer", args: []string{"--policy-dir", "policies", "--", "./chart", "--post-renderer=other"}, wantErrSubstr: "test applies the post-render itself"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runTest(context.Background(), tt.args, strings.NewReader(""), &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runTest() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestRunTest_PolicyDirRequired(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	var stdout bytes.Buffer
+	err := runTest(context.Background(), nil, strings.NewReader(""), &stdout)
+	if err == nil || !strings.Contains(err.Error(), "--policy-dir is required") {
+		t.Errorf("runTest() error = %v, want --policy-dir is required", err)
+	}
+}
+
+func TestRunTemplate(t *testing.T) {
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		helmVersion string
+		want        string
+	}{
+		{name: "Helm v3", helmVersion: "v3.18.0", want: "--post-renderer " + executable},
+		{name: "Helm v4", helmVersion: "v4.0.4", want: "--post-renderer helm-kustomize"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			script := "#!/bin/sh\n" +
+				"echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+				"echo 'kind: ConfigMap'\n"
+			helmBin := filepath.Join(dir, "helm")
+			if err := os.WriteFile(helmBin, []byte(script), 0755); err != nil {
+				t.Fatalf("Failed to write fake helm: %v", err)
+			}
+			t.Setenv("HELM_BIN", helmBin)
+			t.Setenv("HELM_KUSTOMIZE_HELM_VERSION", tt.helmVersion)
+
+			var stdout bytes.Buffer
+			args := []string{"my-release", "./chart", "--post-renderer-args", "--overlay=overlays/prod"}
+			if err := runTemplate(context.Background(), args, nil, &stdout); err != nil {
+				t.Fatalf("runTemplate() error = %v, want nil", err)
+			}
+			if stdout.String() != "kind: ConfigMap\n" {
+				t.Errorf("runTemplate() output = %q, want helm output", stdout.String())
+			}
+
+			gotArgs, err := os.ReadFile(filepath.Join(dir, "args"))
+			if err != nil {
+				t.Fatalf("Failed to read helm args: %v", err)
+			}
+			wantArgs := "template my-release ./chart --post-renderer-args --overlay=overlays/prod " + tt.want + "\n"
+			if string(gotArgs) != wantArgs {
+				t.Errorf("helm args = %q, want %q", gotArgs, wantArgs)
+			}
+		})
+	}
+}
+
+func TestRunTemplate_Errors(t *testing.T) {
+	helmBin := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(helmBin, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake helm: %v", err)
+	}
+	t.Setenv("HELM_BIN", helmBin)
+	t.Setenv("HELM_KUSTOMIZE_HELM_VERSION", "v4.0.0")
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantErrSubstr string
+	}{
+		{name: "no chart", wantErrSubstr: "template requires a chart"},
+		{name: "own post-renderer", args: []string{"./chart", "--post-renderer=other"}, wantErrSubstr: "template sets --post-renderer itself"},
+		{name: "helm fails", args: []string{"./chart"}, wantErrSubstr: "helm template failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runTemplate(context.Background(), tt.args, nil, &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runTemplate() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestRunFlux(t *testing.T) {
+	release := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: web
+spec:
+  postRenderers:
+  - kustomize:
+      images:
+      - name: nginx
+        newTag: "1.25"
+`
+	pluginData := `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    images:
+    - name: nginx
+      newTag: "1.25"
+`
+
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name:  "HelmRelease to KustomizePluginData",
+			input: release,
+			want: `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+metadata:
+  name: web-kustomize
+files:
+  kustomization.yaml: |
+    resources:
+    - all.yaml
+    images:
+    - name: nginx
+      newTag: "1.25"
+`,
+		},
+		{
+			name:  "KustomizePluginData to HelmRelease",
+			args:  []string{"--name", "web", "--namespace", "apps"},
+			input: pluginData,
+			want: `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: web
+  namespace: apps
+spec:
+  postRenderers:
+  - kustomize:
+      images:
+      - name: nginx
+        newTag: "1.25"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := runFlux(context.Background(), tt.args, strings.NewReader(tt.input), &stdout); err != nil {
+				t.Fatalf("runFlux() error = %v, want nil", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("runFlux() output =\n%s\nwant:\n%s", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFlux_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		input         string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no convertible document",
+			input:         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n",
+			wantErrSubstr: "neither a HelmRelease nor KustomizePluginData",
+		},
+		{
+			name:          "HelmRelease name required",
+			input:         "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n",
+			wantErrSubstr: "--name of the HelmRelease is required",
+		},
+		{
+			name:          "several pipelines",
+			args:          []string{"--name", "web"},
+			input:         "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n---\napiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nname: tenant\nfiles: {}\n",
+			wantErrSubstr: "input has 2 KustomizePluginData pipelines",
+		},
+		{
+			name:          "unexpected argument",
+			args:          []string{"extra"},
+			wantErrSubstr: `unexpected argument "extra"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runFlux(context.Background(), tt.args, strings.NewReader(tt.input), &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runFlux() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestRunImportArgoCD(t *testing.T) {
+	app := `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+spec:
+  source:
+    chart: web
+    kustomize:
+      namePrefix: prod-
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(file, []byte(app), 0644); err != nil {
+		t.Fatalf("Failed to write Application: %v", err)
+	}
+
+	want := `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+metadata:
+  name: web-kustomize
+files:
+  kustomization.yaml: |
+    resources:
+    - all.yaml
+    namePrefix: prod-
+`
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+	}{
+		{name: "file", args: []string{file}, want: want},
+		{name: "stdin", args: []string{"-"}, stdin: app, want: want},
+		{name: "name", args: []string{"--name", "overrides", file}, want: strings.Replace(want, "web-kustomize", "overrides", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := runImportArgoCD(context.Background(), tt.args, strings.NewReader(tt.stdin), &stdout); err != nil {
+				t.Fatalf("runImportArgoCD() error = %v, want nil", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("runImportArgoCD() =\n%s\nwant:\n%s", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunImportArgoCD_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		stdin         string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no file",
+			wantErrSubstr: "import-argocd requires an Application file",
+		},
+		{
+			name:          "missing file",
+			args:          []string{filepath.Join(t.TempDir(), "missing.yaml")},
+			wantErrSubstr: "failed to read Application",
+		},
+		{
+			name:          "no Application",
+			args:          []string{"-"},
+			stdin:         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n",
+			wantErrSubstr: "- contains no ArgoCD Application",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runImportArgoCD(context.Background(), tt.args, strings.NewReader(tt.stdin), &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runImportArgoCD() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestRunVerifyParity(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"kustomization.yaml": "resources:\n- configmap.yaml\nnamePrefix: prod-\n",
+		"configmap.yaml":     "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\ndata:\n  mode: prod\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	kubectl, err := exec.LookPath("kubectl")
+	if err != nil {
+		t.Skip("kubectl not found")
+	}
+	binDir := t.TempDir()
+	// The standalone kustomize builds like kubectl kustomize, the drifting one changes a value
+	scripts := map[string]string{
+		"kustomize": "#!/bin/sh\nexec \"" + kubectl + "\" kustomize \"$2\"\n",
+		"drifting":  "#!/bin/sh\n\"" + kubectl + "\" kustomize \"$2\" | sed 's/mode: prod/mode: dev/'\n",
+	}
+	for name, content := range scripts {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(content), 0755); err != nil {
+			t.Fatalf("Failed to write fake %s: %v", name, err)
+		}
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var stdout bytes.Buffer
+	if err := runVerifyParity(context.Background(), []string{dir}, nil, &stdout); err != nil {
+		t.Fatalf("runVerifyParity() error = %v, want nil", err)
+	}
+	if !strings.Contains(stdout.String(), "builds identically with kubectl kustomize and kustomize (1 resources)") {
+		t.Errorf("runVerifyParity() output = %q, want parity confirmed", stdout.String())
+	}
+
+	stdout.Reset()
+	err = runVerifyParity(context.Background(), []string{"--binary", "drifting", dir}, nil, &stdout)
+	if err == nil || !strings.Contains(err.Error(), "builds differently with kubectl kustomize and drifting") {
+		t.Errorf("runVerifyParity() error = %v, want outputs to differ", err)
+	}
+	if !strings.Contains(stdout.String(), "-  mode: prod") || !strings.Contains(stdout.String(), "+  mode: dev") {
+		t.Errorf("runVerifyParity() output = %q, want a diff of the drifting value", stdout.String())
+	}
+}
+
+func TestRunVerifyParity_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization.yaml: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no directory",
+			wantErrSubstr: "verify-parity requires a kustomization directory",
+		},
+		{
+			name:          "missing binary",
+			args:          []string{"--binary", "/nonexistent/kustomize", dir},
+			wantErrSubstr: "/nonexistent/kustomize build failed",
+		},
+		{
+			name:          "invalid kustomization",
+			args:          []string{t.TempDir()},
+			wantErrSubstr: "kubectl kustomize failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runVerifyParity(context.Background(), tt.args, nil, &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runVerifyParity() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestRunExplain(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name: "kustomization",
+			input: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+excludeKinds: [Job]
+labels:
+  pairs:
+    team: web
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namespace: prod
+    patches:
+      - path: replicas.yaml
+      - target:
+          kind: Deployment
+          labelSelector: tier=frontend
+        patch: |
+          - op: replace
+            path: /spec/replicas
+            value: 2
+    images:
+      - name: nginx
+        newTag: "1.25"
+  replicas.yaml: |
+    apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: web
+    spec:
+      replicas: 3
+`,
+			want: `Plugin data:
+  transforms all resources
+  excludeKinds: passes the kinds Job through untouched
+Transformers of kustomization.yaml, in the order kustomize runs them:
+  PatchTransformer patches[0] (replicas.yaml): strategic merge patch of Deployment.apps/web
+  PatchTransformer patches[1]: JSON 6902 patch (replace /spec/replicas) of kind Deployment, labelSelector tier=frontend
+  NamespaceTransformer namespace prod: sets namespace prod on all namespaced resources
+  LabelTransformer labels[0]: adds labels team=web to all resources
+  ImageTagTransformer images[0] (nginx): replaces image nginx with nginx:1.25 in all resources
+`,
+		},
+		{
+			name: "generated kustomization of an overlay",
+			args: []string{"--overlay", "overlays/prod"},
+			input: `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+includeKinds: [Deployment]
+inject:
+  containers:
+    - name: proxy
+      image: envoy
+  initContainers:
+    - name: wait
+      image: busybox
+  target:
+    kind: Deployment
+resourceDefaults:
+  requests:
+    memory: 128Mi
+    cpu: 100m
+scheduling:
+  nodeSelector:
+    pool: general
+  tolerations:
+    - key: dedicated
+      operator: Exists
+  affinity:
+    podAntiAffinity: {}
+hardening:
+  target:
+    kind: Deployment
+podClasses:
+  priorityClassName: high
+  target:
+    kind: Deployment
+files:
+  overlays/prod/service.yaml: |
+    kind: Service
+    metadata:
+      name: web
+`,
+			want: `Plugin data:
+  includeKinds: transforms only the kinds Deployment
+  inject: adds the containers wait, proxy to the pod templates of kind Deployment
+  resourceDefaults: sets requests cpu=100m, memory=128Mi and limits none on the containers lacking them in the pod templates of all resources
+  scheduling: sets node selector pool=general, tolerations (1), podAntiAffinity on the pod templates of all resources
+  hardening: enforces runAsNonRoot, a RuntimeDefault seccomp profile, no privilege escalation, dropped capabilities and a read-only root filesystem on the pod templates of kind Deployment
+  podClasses: patches priorityClassName=high into the pod templates of kind Deployment
+Transformers of generated kustomization, in the order kustomize runs them:
+  PatchTransformer patches[0] (service.yaml): strategic merge patch of Service/web
+  PatchTransformer patches[1]: JSON 6902 patch (add /spec/template/spec/priorityClassName) of kind Deployment
+`,
+		},
+		{
+			name: "pipelines",
+			input: `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: tenant
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namespace: tenant
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: base-
+`,
+			want: `Pipeline "", run 1 of 2:
+Plugin data:
+  transforms all resources
+Transformers of kustomization.yaml, in the order kustomize runs them:
+  PrefixTransformer namePrefix base-: adds name prefix base- to all resources and the references to them
+
+Pipeline "tenant", run 2 of 2:
+Plugin data:
+  transforms all resources
+Transformers of kustomization.yaml, in the order kustomize runs them:
+  NamespaceTransformer namespace tenant: sets namespace tenant on all namespaced resources
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := runExplain(context.Background(), tt.args, strings.NewReader(tt.input), &stdout); err != nil {
+				t.Fatalf("runExplain() error = %v, want nil", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("runExplain() output =\n%s\nwant:\n%s", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunExplain_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		input         string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no plugin data",
+			input:         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: x\n",
+			wantErrSubstr: "input contains no KustomizePluginData",
+		},
+		{
+			name:          "no kustomization or patches",
+			input:         "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles:\n  README.md: x\n",
+			wantErrSubstr: "no kustomization.yaml or patch files in .",
+		},
+		{
+			name:          "unexpected argument",
+			args:          []string{"extra"},
+			wantErrSubstr: `unexpected argument "extra"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runExplain(context.Background(), tt.args, strings.NewReader(tt.input), &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runExplain() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestRunMatch(t *testing.T) {
+	input := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    tier: frontend
+---
+# Source: web/templates/worker.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+
+	tests := []struct {
+		name          string
+		target        string
+		want          string
+		wantErrSubstr string
+	}{
+		{
+			name:   "kind and name",
+			target: "kind=Deployment,name=web",
+			want:   "Deployment.apps/web (web/templates/deployment.yaml)\n",
+		},
+		{
+			name:   "name only",
+			target: "name=web",
+			want:   "Deployment.apps/web (web/templates/deployment.yaml)\nService/web\n",
+		},
+		{
+			name:   "label selector",
+			target: "labelSelector=tier in (frontend,backend)",
+			want:   "Deployment.apps/web (web/templates/deployment.yaml)\n",
+		},
+		{
+			name:          "no match lists candidates",
+			target:        "kind=Deployment,name=api",
+			want:          "Resources of kind Deployment:\n  Deployment.apps/web (web/templates/deployment.yaml)\n  Deployment.apps/worker (web/templates/worker.yaml)\n",
+			wantErrSubstr: "no resource matches kind Deployment, name api",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runMatch(context.Background(), []string{"--target", tt.target}, strings.NewReader(input), &stdout)
+			if tt.wantErrSubstr == "" && err != nil {
+				t.Fatalf("runMatch() error = %v, want nil", err)
+			}
+			if tt.wantErrSubstr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr)) {
+				t.Fatalf("runMatch() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("runMatch() output =\n%s\nwant:\n%s", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunMatch_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		wantErrSubstr string
+	}{
+		{name: "missing target", args: nil, wantErrSubstr: "--target is required"},
+		{name: "invalid target", args: []string{"--target", "type=Deployment"}, wantErrSubstr: "unknown field"},
+		{name: "unexpected argument", args: []string{"--target", "kind=Job", "extra"}, wantErrSubstr: `unexpected argument "extra"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runMatch(context.Background(), tt.args, strings.NewReader(""), &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runMatch() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/internal/parser"
+)
+
+// Environment variables describing the helmfile release being rendered, read in --helmfile mode
+const (
+	envHelmfileRelease     = "HELMFILE_RELEASE_NAME"
+	envHelmfileNamespace   = "HELMFILE_RELEASE_NAMESPACE"
+	envHelmfileEnvironment = "HELMFILE_ENVIRONMENT"
+)
+
+// helmfileRelease is the release information helmfile passes to the post-renderer
+type helmfileRelease struct {
+	Name        string
+	Namespace   string
+	Environment string
+}
+
+// helmfileReleaseFromEnv reads the release from the environment. The namespace falls back to
+// the one Helm passes to plugins.
+func helmfileReleaseFromEnv() helmfileRelease {
+	release := helmfileRelease{
+		Name:        os.Getenv(envHelmfileRelease),
+		Namespace:   os.Getenv(envHelmfileNamespace),
+		Environment: os.Getenv(envHelmfileEnvironment),
+	}
+	if release.Namespace == "" {
+		release.Namespace = os.Getenv("HELM_NAMESPACE")
+	}
+	return release
+}
+
+// overlay returns the overlay directory of the helmfile environment: the one the overlays of the
+// plugin data name after it, or overlays/<environment> if the files map has a kustomization there
+func (r helmfileRelease) overlay(files, overlays map[string]string) string {
+	if r.Environment == "" {
+		return ""
+	}
+	if dir, ok := overlays[r.Environment]; ok {
+		return dir
+	}
+	dir := path.Join("overlays", r.Environment)
+	if _, ok := files[path.Join(dir, "kustomization.yaml")]; !ok {
+		return ""
+	}
+	return dir
+}
+
+// substitute replaces the ${HELMFILE_RELEASE_NAME}, ${HELMFILE_RELEASE_NAMESPACE} and
+// ${HELMFILE_ENVIRONMENT} placeholders in the files. Placeholders of unset values are kept, so
+// that kustomize reports them instead of building with empty values. Files entries given as
+// base64 are binary and left alone.
+func (r helmfileRelease) substitute(files map[string]string, entries map[string]parser.File) map[string]string {
+	var pairs []string
+	for name, value := range map[string]string{
+		envHelmfileRelease:     r.Name,
+		envHelmfileNamespace:   r.Namespace,
+		envHelmfileEnvironment: r.Environment,
+	} {
+		if value != "" {
+			pairs = append(pairs, "${"+name+"}", value)
+		}
+	}
+	if len(pairs) == 0 {
+		return files
+	}
+
+	replacer := strings.NewReplacer(pairs...)
+	substituted := make(map[string]string, len(files))
+	for name, content := range files {
+		// Binary files are written as they are
+		if entries[name].Encoding != "" {
+			substituted[name] = content
+			continue
+		}
+		substituted[name] = replacer.Replace(content)
+	}
+	return substituted
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+)
+
+func TestHelmfileReleaseFromEnv(t *testing.T) {
+	t.Setenv(envHelmfileRelease, "web")
+	t.Setenv(envHelmfileNamespace, "")
+	t.Setenv(envHelmfileEnvironment, "prod")
+	t.Setenv("HELM_NAMESPACE", "apps")
+
+	want := helmfileRelease{Name: "web", Namespace: "apps", Environment: "prod"}
+	if got := helmfileReleaseFromEnv(); got != want {
+		t.Errorf("helmfileReleaseFromEnv() = %+v, want %+v", got, want)
+	}
+
+	t.Setenv(envHelmfileNamespace, "web-prod")
+	if got := helmfileReleaseFromEnv(); got.Namespace != "web-prod" {
+		t.Errorf("helmfileReleaseFromEnv() namespace = %q, want %q", got.Namespace, "web-prod")
+	}
+}
+
+func TestHelmfileRelease_Overlay(t *testing.T) {
+	files := map[string]string{
+		"kustomization.yaml":               "",
+		"overlays/prod/kustomization.yaml": "",
+		"overlays/dev/patch.yaml":          "",
+		"envs/stage/kustomization.yaml":    "",
+	}
+	overlays := map[string]string{"staging": "envs/stage"}
+
+	tests := []struct {
+		environment string
+		want        string
+	}{
+		{environment: "prod", want: "overlays/prod"},
+		{environment: "dev", want: ""},
+		{environment: "staging", want: "envs/stage"},
+		{environment: "qa", want: ""},
+		{environment: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment, func(t *testing.T) {
+			if got := (helmfileRelease{Environment: tt.environment}).overlay(files, overlays); got != tt.want {
+				t.Errorf("overlay() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHelmfileRelease_Substitute(t *testing.T) {
+	files := map[string]string{
+		"kustomization.yaml": "namespace: ${HELMFILE_RELEASE_NAMESPACE}\nnamePrefix: ${HELMFILE_RELEASE_NAME}-\n",
+		"patch.yaml":         "env: ${HELMFILE_ENVIRONMENT}\nother: ${HOME}\n",
+		"function.tar":       "\xff${HELMFILE_RELEASE_NAME}",
+		// A tar is ASCII headers and NUL padding, valid UTF-8 but binary
+		"header.tar": "${HELMFILE_RELEASE_NAME}\x00\x00",
+	}
+	entries := map[string]parser.File{
+		"function.tar": {Content: files["function.tar"], Encoding: "base64"},
+		"header.tar":   {Content: files["header.tar"], Encoding: "base64"},
+	}
+
+	got := (helmfileRelease{Name: "web", Namespace: "apps"}).substitute(files, entries)
+	want := map[string]string{
+		"kustomization.yaml": "namespace: apps\nnamePrefix: web-\n",
+		"patch.yaml":         "env: ${HELMFILE_ENVIRONMENT}\nother: ${HOME}\n",
+		"function.tar":       "\xff${HELMFILE_RELEASE_NAME}",
+		"header.tar":         "${HELMFILE_RELEASE_NAME}\x00\x00",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("substitute() = %q, want %q", got, want)
+	}
+
+	if got := (helmfileRelease{}).substitute(files, entries); !reflect.DeepEqual(got, files) {
+		t.Errorf("substitute() without release = %q, want files unchanged", got)
+	}
+}
+
+func TestKustomizePostRenderer_Run_Helmfile(t *testing.T) {
+	t.Setenv(envHelmfileRelease, "web")
+	t.Setenv(envHelmfileNamespace, "apps")
+	t.Setenv(envHelmfileEnvironment, "prod")
+
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+  overlays/prod/kustomization.yaml: |
+    resources:
+      - all.yaml
+    namespace: ${HELMFILE_RELEASE_NAMESPACE}
+    namePrefix: ${HELMFILE_RELEASE_NAME}-${HELMFILE_ENVIRONMENT}-
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Helmfile: true}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	for _, want := range []string{"name: web-prod-config", "namespace: apps"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, output.String())
+		}
+	}
+
+	// An explicit overlay wins over the environment
+	renderer = &KustomizePostRenderer{Options: options.Options{Helmfile: true, Overlay: "."}}
+	output, err = renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if !strings.Contains(output.String(), "name: config") {
+		t.Errorf("Expected the root kustomization to be built, got:\n%s", output.String())
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/owhelm/helm-kustomize/internal/diff"
+	"github.com/owhelm/helm-kustomize/internal/helm"
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+)
+
+// impactChange is a resource of the impact report in JSON
+type impactChange struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+// impactReport is the impact report in JSON
+type impactReport struct {
+	Previous  string         `json:"previous"`
+	Changes   []impactChange `json:"changes"`
+	Unchanged int            `json:"unchanged"`
+}
+
+// runImpact renders the manifests read from stdin like the post-renderer does and reports which
+// resources the new release adds, removes or changes compared to the previous one, whose
+// manifest is fetched with `helm get manifest` or read from --previous. Helm stores the
+// post-rendered manifest, so the report shows the drift after the post-render, for change
+// reviews. --output selects a text (default) or JSON report, and --diff adds the unified diff of
+// the changes to the text report.
+func runImpact(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	var release, namespace, previousFile string
+	opts, err := options.LoadWithFlags(args, func(fs *flag.FlagSet) {
+		fs.StringVar(&release, "release", "", "name of the deployed release to compare with")
+		fs.StringVar(&namespace, "namespace", "", "namespace of the release")
+		fs.StringVar(&previousFile, "previous", "", "manifest of the previous release, instead of fetching it with helm get manifest")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load options: %w", err)
+	}
+	if (release == "") == (previousFile == "") {
+		return fmt.Errorf("impact requires either --release or --previous")
+	}
+	// --diff and --output apply to the report, the comparison needs the rendered YAML
+	report, showDiff := opts.Output, opts.Diff
+	opts.Diff = false
+	opts.ChangedOnly = false
+	opts.Output = options.OutputYAML
+
+	var previous []byte
+	previousName := previousFile
+	if previousFile != "" {
+		if previous, err = os.ReadFile(previousFile); err != nil {
+			return fmt.Errorf("failed to read previous manifest: %w", err)
+		}
+	} else {
+		if previous, err = helm.GetManifest(ctx, release, namespace); err != nil {
+			return err
+		}
+		previousName = "release " + release
+	}
+	before, err := parser.ParseManifests(previous)
+	if err != nil {
+		return fmt.Errorf("failed to parse previous manifest: %w", err)
+	}
+
+	input := &bytes.Buffer{}
+	if _, err := io.Copy(input, stdin); err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	renderer := &KustomizePostRenderer{Options: opts}
+	output, err := renderer.RunContext(ctx, input)
+	if err != nil {
+		return err
+	}
+	after, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+
+	changes, err := diff.Changes(before.OtherResources, after.OtherResources)
+	if err != nil {
+		return err
+	}
+	result := impactReport{Previous: previousName, Changes: []impactChange{}, Unchanged: len(after.OtherResources)}
+	for _, change := range changes {
+		result.Changes = append(result.Changes, impactChange{Resource: change.ID.String(), Action: change.Action})
+		if change.Action != "removed" {
+			result.Unchanged--
+		}
+	}
+	var text string
+	if showDiff {
+		if text, err = diff.Resources(before.OtherResources, after.OtherResources); err != nil {
+			return err
+		}
+	}
+
+	if err := writeImpactReport(stdout, result, text, report); err != nil {
+		return fmt.Errorf("failed to write impact report: %w", err)
+	}
+	return nil
+}
+
+// writeImpactReport writes the impact report in the given format, followed by the unified diff
+// of the changes in text reports
+func writeImpactReport(w io.Writer, report impactReport, diffText string, format options.OutputFormat) error {
+	if format == options.OutputJSON || format == options.OutputNDJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		if format == options.OutputJSON {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(report)
+	}
+
+	if len(report.Changes) == 0 {
+		_, err := fmt.Fprintf(w, "No changes compared to %s (%d resources unchanged)\n", report.Previous, report.Unchanged)
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "%d resources change compared to %s (%d unchanged):\n", len(report.Changes), report.Previous, report.Unchanged); err != nil {
+		return err
+	}
+	symbols := map[string]string{"added": "+", "removed": "-", "changed": "~"}
+	for _, change := range report.Changes {
+		if _, err := fmt.Fprintf(w, "  %s %s (%s)\n", symbols[change.Action], change.Resource, change.Action); err != nil {
+			return err
+		}
+	}
+	if diffText != "" {
+		if _, err := fmt.Fprintf(w, "\n%s", diffText); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// impactInput is a chart adding a name prefix to two ConfigMaps
+const impactInput = `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  level: debug
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+`
+
+// impactPrevious is the manifest of the previous release, as Helm stores it after the post-render
+const impactPrevious = `---
+# Source: chart/templates/settings.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: prod-settings
+data:
+  level: info
+---
+# Source: chart/templates/legacy.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: prod-legacy
+`
+
+func TestRunImpact(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+	previous := filepath.Join(t.TempDir(), "previous.yaml")
+	if err := os.WriteFile(previous, []byte(impactPrevious), 0644); err != nil {
+		t.Fatalf("Failed to write previous manifest: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "text",
+			args: []string{"--previous", previous},
+			want: "3 resources change compared to " + previous + ` (0 unchanged):
+  ~ ConfigMap/prod-settings (changed)
+  - ConfigMap/prod-legacy (removed)
+  + ConfigMap/prod-extra (added)
+`,
+		},
+		{
+			name: "json",
+			args: []string{"--previous", previous, "--output", "json"},
+			want: `{
+  "previous": "` + previous + `",
+  "changes": [
+    {
+      "resource": "ConfigMap/prod-settings",
+      "action": "changed"
+    },
+    {
+      "resource": "ConfigMap/prod-legacy",
+      "action": "removed"
+    },
+    {
+      "resource": "ConfigMap/prod-extra",
+      "action": "added"
+    }
+  ],
+  "unchanged": 0
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := runImpact(context.Background(), tt.args, strings.NewReader(impactInput), &stdout); err != nil {
+				t.Fatalf("runImpact() error = %v, want nil", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("runImpact() output = %q, want %q", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunImpact_Diff(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+	previous := filepath.Join(t.TempDir(), "previous.yaml")
+	if err := os.WriteFile(previous, []byte(impactPrevious), 0644); err != nil {
+		t.Fatalf("Failed to write previous manifest: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runImpact(context.Background(), []string{"--previous", previous, "--diff"}, strings.NewReader(impactInput), &stdout); err != nil {
+		t.Fatalf("runImpact() error = %v, want nil", err)
+	}
+	for _, want := range []string{"--- a/ConfigMap/prod-settings", "-  level: info", "+  level: debug"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestRunImpact_Release(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	// The fake helm records its arguments and prints the manifest of the previous release
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "manifest.yaml"), []byte(impactPrevious), 0644); err != nil {
+		t.Fatalf("Failed to write previous manifest: %v", err)
+	}
+	helmBin := filepath.Join(dir, "helm")
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat " + filepath.Join(dir, "manifest.yaml") + "\n"
+	if err := os.WriteFile(helmBin, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake helm: %v", err)
+	}
+	t.Setenv("HELM_BIN", helmBin)
+
+	var stdout bytes.Buffer
+	args := []string{"--release", "web", "--namespace", "prod"}
+	if err := runImpact(context.Background(), args, strings.NewReader(impactInput), &stdout); err != nil {
+		t.Fatalf("runImpact() error = %v, want nil", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "3 resources change compared to release web (0 unchanged):\n") {
+		t.Errorf("runImpact() output = %q, want the changes compared to release web", stdout.String())
+	}
+	gotArgs, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatalf("Failed to read helm args: %v", err)
+	}
+	if string(gotArgs) != "get manifest web --namespace prod\n" {
+		t.Errorf("helm args = %q, want get manifest web --namespace prod", gotArgs)
+	}
+}
+
+func TestRunImpact_NoChanges(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+	input := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n"
+	previous := filepath.Join(t.TempDir(), "previous.yaml")
+	if err := os.WriteFile(previous, []byte("# Source: chart/templates/settings.yaml\n"+input), 0644); err != nil {
+		t.Fatalf("Failed to write previous manifest: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	if err := runImpact(context.Background(), []string{"--previous", previous}, strings.NewReader(input), &stdout); err != nil {
+		t.Fatalf("runImpact() error = %v, want nil", err)
+	}
+	want := "No changes compared to " + previous + " (1 resources unchanged)\n"
+	if stdout.String() != want {
+		t.Errorf("runImpact() output = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestRunImpact_Errors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantErrSubstr string
+	}{
+		{name: "no previous release", args: nil, wantErrSubstr: "impact requires either --release or --previous"},
+		{name: "both previous releases", args: []string{"--release", "web", "--previous", "old.yaml"}, wantErrSubstr: "impact requires either --release or --previous"},
+		{name: "missing previous manifest", args: []string{"--previous", "missing.yaml"}, wantErrSubstr: "failed to read previous manifest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := runImpact(context.Background(), tt.args, strings.NewReader(impactInput), &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runImpact() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
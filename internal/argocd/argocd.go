@@ -0,0 +1,255 @@
+package argocd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// Application API of ArgoCD
+const (
+	ApplicationGroup = "argoproj.io"
+	ApplicationKind  = "Application"
+)
+
+// IsApplication reports whether a resource is an ArgoCD Application
+func IsApplication(resource map[string]any) bool {
+	apiVersion, _ := resource["apiVersion"].(string)
+	return resource["kind"] == ApplicationKind && strings.HasPrefix(apiVersion, ApplicationGroup+"/")
+}
+
+// kustomization holds the kustomization fields ArgoCD kustomize options map to, in the order
+// kustomize documents them
+type kustomization struct {
+	Resources         []string          `yaml:"resources"`
+	Namespace         string            `yaml:"namespace,omitempty"`
+	NamePrefix        string            `yaml:"namePrefix,omitempty"`
+	NameSuffix        string            `yaml:"nameSuffix,omitempty"`
+	Labels            []labels          `yaml:"labels,omitempty"`
+	CommonAnnotations map[string]string `yaml:"commonAnnotations,omitempty"`
+	Images            []image           `yaml:"images,omitempty"`
+	Replicas          []replica         `yaml:"replicas,omitempty"`
+	Patches           []any             `yaml:"patches,omitempty"`
+}
+
+type labels struct {
+	Pairs            map[string]string `yaml:"pairs"`
+	IncludeSelectors bool              `yaml:"includeSelectors"`
+	IncludeTemplates bool              `yaml:"includeTemplates,omitempty"`
+}
+
+type image struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+	Digest  string `yaml:"digest,omitempty"`
+}
+
+type replica struct {
+	Name  string `yaml:"name"`
+	Count int    `yaml:"count"`
+}
+
+// ImportApplication converts the spec.source.kustomize options of an ArgoCD Application to a
+// KustomizePluginData document named name. Applications with multiple sources must have
+// exactly one source with kustomize options. Options without a kustomization equivalent, such
+// as components, are reported as errors rather than dropped.
+func ImportApplication(app map[string]any, name string) ([]byte, error) {
+	meta, _ := app["metadata"].(map[string]any)
+	appName, _ := meta["name"].(string)
+	options, err := kustomizeOptions(app)
+	if err != nil {
+		return nil, fmt.Errorf("Application %s: %w", appName, err)
+	}
+
+	kust := kustomization{Resources: []string{"all.yaml"}}
+	var commonLabels map[string]string
+	labelsWithoutSelector, labelsIncludeTemplates := false, false
+	var unsupported []string
+	for _, key := range slices.Sorted(maps.Keys(options)) {
+		value := options[key]
+		var err error
+		switch key {
+		// version selects the kustomize binary of the ArgoCD repo server, helm-kustomize uses kubectl
+		case "version":
+		// force only matters when ArgoCD edits labels already set in a kustomization.yaml
+		case "forceCommonLabels", "forceCommonAnnotations":
+		case "namespace":
+			kust.Namespace, err = stringField(value, key)
+		case "namePrefix":
+			kust.NamePrefix, err = stringField(value, key)
+		case "nameSuffix":
+			kust.NameSuffix, err = stringField(value, key)
+		case "commonLabels":
+			commonLabels, err = stringMap(value, key)
+		case "labelWithoutSelector":
+			labelsWithoutSelector, err = boolField(value, key)
+		case "labelIncludeTemplates":
+			labelsIncludeTemplates, err = boolField(value, key)
+		case "commonAnnotations":
+			kust.CommonAnnotations, err = stringMap(value, key)
+		case "images":
+			kust.Images, err = images(value)
+		case "replicas":
+			kust.Replicas, err = replicas(value)
+		case "patches":
+			var ok bool
+			if kust.Patches, ok = value.([]any); !ok {
+				err = fmt.Errorf("patches must be a list")
+			}
+		default:
+			unsupported = append(unsupported, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Application %s: %w", appName, err)
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("Application %s uses kustomize options without a kustomization equivalent: %s", appName, strings.Join(unsupported, ", "))
+	}
+	if len(commonLabels) > 0 {
+		kust.Labels = []labels{{
+			Pairs:            commonLabels,
+			IncludeSelectors: !labelsWithoutSelector,
+			IncludeTemplates: labelsWithoutSelector && labelsIncludeTemplates,
+		}}
+	}
+
+	content, err := manifest.Marshal(kust)
+	if err != nil {
+		return nil, err
+	}
+	return parser.EncodePluginData(name, "", map[string]string{"kustomization.yaml": string(content)})
+}
+
+// kustomizeOptions returns the kustomize options of the single Application source that has them
+func kustomizeOptions(app map[string]any) (map[string]any, error) {
+	spec, _ := app["spec"].(map[string]any)
+	sources, _ := spec["sources"].([]any)
+	if source, ok := spec["source"]; ok {
+		sources = append([]any{source}, sources...)
+	}
+
+	var found []map[string]any
+	for _, raw := range sources {
+		source, _ := raw.(map[string]any)
+		if options, ok := source["kustomize"].(map[string]any); ok {
+			found = append(found, options)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no source has kustomize options")
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("%d sources have kustomize options, want one", len(found))
+}
+
+// images converts ArgoCD image overrides, which use the `kustomize edit set image` syntax
+// [name=]newName[:newTag][@digest], to kustomization images
+func images(value any) ([]image, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("images must be a list")
+	}
+	converted := make([]image, 0, len(list))
+	for i, raw := range list {
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Errorf("images[%d] must be a string", i)
+		}
+		override := s
+		if !strings.Contains(s, "=") {
+			override = imageName(s) + "=" + s
+		}
+		img, err := kustomize.ParseImage(override)
+		if err != nil {
+			return nil, fmt.Errorf("images[%d]: %w", i, err)
+		}
+		if img.NewName == img.Name {
+			img.NewName = ""
+		}
+		converted = append(converted, image{Name: img.Name, NewName: img.NewName, NewTag: img.NewTag, Digest: img.Digest})
+	}
+	return converted, nil
+}
+
+// imageName strips the tag and digest of an image reference
+func imageName(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+// replicas converts ArgoCD replica overrides, whose count may be a string
+func replicas(value any) ([]replica, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("replicas must be a list")
+	}
+	converted := make([]replica, 0, len(list))
+	for i, raw := range list {
+		entry, _ := raw.(map[string]any)
+		name, _ := entry["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("replicas[%d] must have a name", i)
+		}
+		var count int
+		switch c := entry["count"].(type) {
+		case int:
+			count = c
+		case string:
+			n, err := strconv.Atoi(c)
+			if err != nil {
+				return nil, fmt.Errorf("replicas[%d]: invalid count %q", i, c)
+			}
+			count = n
+		default:
+			return nil, fmt.Errorf("replicas[%d] must have an integer count", i)
+		}
+		converted = append(converted, replica{Name: name, Count: count})
+	}
+	return converted, nil
+}
+
+func stringField(value any, field string) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string", field)
+	}
+	return s, nil
+}
+
+func boolField(value any, field string) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s must be a boolean", field)
+	}
+	return b, nil
+}
+
+// stringMap converts a map of strings, such as commonLabels
+func stringMap(value any, field string) (map[string]string, error) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map", field)
+	}
+	converted := make(map[string]string, len(m))
+	for key, v := range m {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s.%s must be a string", field, key)
+		}
+		converted[key] = s
+	}
+	return converted, nil
+}
@@ -0,0 +1,235 @@
+package argocd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+
+	"github.com/owhelm/helm-kustomize/internal/parser"
+)
+
+func decode(t *testing.T, doc string) map[string]any {
+	t.Helper()
+	var resource map[string]any
+	if err := yaml.Unmarshal([]byte(doc), &resource); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	return resource
+}
+
+func TestImportApplication(t *testing.T) {
+	app := decode(t, `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+  namespace: argocd
+spec:
+  source:
+    repoURL: https://charts.example.com
+    chart: web
+    kustomize:
+      namePrefix: prod-
+      commonLabels:
+        team: web
+      commonAnnotations:
+        owner: platform
+      images:
+      - nginx:1.25
+      - busybox=registry.internal/busybox@sha256:abc
+      replicas:
+      - name: web
+        count: "3"
+      forceCommonLabels: true
+`)
+
+	got, err := ImportApplication(app, "web-kustomize")
+	if err != nil {
+		t.Fatalf("ImportApplication() error = %v, want nil", err)
+	}
+
+	want := `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+metadata:
+  name: web-kustomize
+files:
+  kustomization.yaml: |
+    resources:
+    - all.yaml
+    namePrefix: prod-
+    labels:
+    - pairs:
+        team: web
+      includeSelectors: true
+    commonAnnotations:
+      owner: platform
+    images:
+    - name: nginx
+      newTag: "1.25"
+    - name: busybox
+      newName: registry.internal/busybox
+      digest: sha256:abc
+    replicas:
+    - name: web
+      count: 3
+`
+	if string(got) != want {
+		t.Errorf("ImportApplication() =\n%s\nwant:\n%s", got, want)
+	}
+
+	// The result is a valid KustomizePluginData document
+	result, err := parser.ParseManifests(got)
+	if err != nil || result.KustomizePluginData == nil {
+		t.Fatalf("ParseManifests() = %v, %v, want KustomizePluginData", result, err)
+	}
+}
+
+func TestImportApplication_Sources(t *testing.T) {
+	app := decode(t, `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+spec:
+  sources:
+  - repoURL: https://git.example.com/values
+    ref: values
+  - chart: web
+    kustomize:
+      nameSuffix: -v2
+      commonLabels:
+        team: web
+      labelWithoutSelector: true
+      labelIncludeTemplates: true
+`)
+
+	got, err := ImportApplication(app, "web-kustomize")
+	if err != nil {
+		t.Fatalf("ImportApplication() error = %v, want nil", err)
+	}
+	for _, want := range []string{"nameSuffix: -v2", "includeSelectors: false", "includeTemplates: true"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("ImportApplication() =\n%s\nwant it to contain %q", got, want)
+		}
+	}
+}
+
+func TestImportApplication_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no kustomize options",
+			spec:          "source:\n  chart: web\n",
+			wantErrSubstr: "Application web: no source has kustomize options",
+		},
+		{
+			name:          "several sources with kustomize options",
+			spec:          "sources:\n- kustomize: {}\n- kustomize: {}\n",
+			wantErrSubstr: "2 sources have kustomize options, want one",
+		},
+		{
+			name:          "unsupported options",
+			spec:          "source:\n  kustomize:\n    components: [../c]\n    kubeVersion: \"1.30\"\n",
+			wantErrSubstr: "without a kustomization equivalent: components, kubeVersion",
+		},
+		{
+			name:          "invalid image",
+			spec:          "source:\n  kustomize:\n    images: [\"nginx=\"]\n",
+			wantErrSubstr: "images[0]: invalid image override",
+		},
+		{
+			name:          "invalid replica count",
+			spec:          "source:\n  kustomize:\n    replicas:\n    - name: web\n      count: three\n",
+			wantErrSubstr: `replicas[0]: invalid count "three"`,
+		},
+		{
+			name:          "labels not a map",
+			spec:          "source:\n  kustomize:\n    commonLabels: [team]\n",
+			wantErrSubstr: "commonLabels must be a map",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := decode(t, "apiVersion: argoproj.io/v1alpha1\nkind: Application\nmetadata:\n  name: web\n")
+			app["spec"] = decode(t, tt.spec)
+			_, err := ImportApplication(app, "web")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("ImportApplication() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestImportApplication_Builds(t *testing.T) {
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		t.Skip("kubectl not found")
+	}
+
+	app := decode(t, `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: web
+spec:
+  source:
+    kustomize:
+      namePrefix: prod-
+      commonLabels:
+        team: web
+      images:
+      - nginx:1.25
+      replicas:
+      - name: web
+        count: 3
+`)
+	got, err := ImportApplication(app, "web-kustomize")
+	if err != nil {
+		t.Fatalf("ImportApplication() error = %v, want nil", err)
+	}
+	result, err := parser.ParseManifests(got)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"kustomization.yaml": result.KustomizePluginData.Files["kustomization.yaml"],
+		"all.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	output, err := exec.Command("kubectl", "kustomize", dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("kubectl kustomize error = %v\n%s", err, output)
+	}
+	for _, want := range []string{"name: prod-web", "team: web", "image: nginx:1.25", "replicas: 3"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("kubectl kustomize output =\n%s\nwant it to contain %q", output, want)
+		}
+	}
+}
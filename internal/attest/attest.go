@@ -0,0 +1,190 @@
+// Package attest records the inputs of a render, so that a later render can be checked to have
+// had the same inputs and therefore to produce the same output
+package attest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Annotation holds the digest of the inputs manifest on the output resources
+const Annotation = "helm.plugin.kustomize/inputs-digest"
+
+// Manifest lists the inputs that influenced a render
+type Manifest struct {
+	PluginVersion string     `json:"pluginVersion"`
+	Kubectl       string     `json:"kubectl"`
+	Kustomize     string     `json:"kustomize"`
+	Pipelines     []Pipeline `json:"pipelines"`
+}
+
+// Pipeline lists the inputs of a kustomize build
+type Pipeline struct {
+	Name      string `json:"name,omitempty"`
+	BuildRoot string `json:"buildRoot"`
+	// BuildFlags are the kubectl kustomize flags of the build
+	BuildFlags []string `json:"buildFlags,omitempty"`
+	// Files are the sha256 digests of the files kustomize built, by slash-separated path: those
+	// of the files map, the Helm manifests and the composed kustomization
+	Files       map[string]string `json:"files"`
+	RemoteBases []RemoteBase      `json:"remoteBases,omitempty"`
+}
+
+// RemoteBase is a remote base of the kustomization and the commit its ref pointed to
+type RemoteBase struct {
+	URL string `json:"url"`
+	// Commit is empty if the ref could not be resolved, e.g. for plain HTTP resources
+	Commit string `json:"commit,omitempty"`
+}
+
+// HashFiles returns the sha256 digests of the regular files of the tree of dir
+func HashFiles(dir string) (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		files[filepath.ToSlash(rel)] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash build inputs: %w", err)
+	}
+	return files, nil
+}
+
+// Digest returns the sha256 digest of the JSON encoding of the manifest, e.g. "sha256:4c0f...".
+// Maps are encoded with sorted keys, so equal manifests have equal digests.
+func (m *Manifest) Digest() (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode inputs manifest: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Write writes the manifest to path as indented JSON
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode inputs manifest: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write inputs manifest: %w", err)
+	}
+	return nil
+}
+
+// Annotate sets Annotation to digest on the resources
+func Annotate(resources []map[string]any, digest string) {
+	for _, resource := range resources {
+		metadata, ok := resource["metadata"].(map[string]any)
+		if !ok {
+			metadata = map[string]any{}
+			resource["metadata"] = metadata
+		}
+		annotations, ok := metadata["annotations"].(map[string]any)
+		if !ok {
+			annotations = map[string]any{}
+			metadata["annotations"] = annotations
+		}
+		annotations[Annotation] = digest
+	}
+}
+
+// commitPattern matches full git commit IDs
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ResolveRemote returns the commit the ref of a remote base points to, looked up with
+// `git ls-remote`. Refs that are commits already are returned as they are.
+func ResolveRemote(ctx context.Context, base string) (string, error) {
+	repo, ref := splitRemote(base)
+	if commitPattern.MatchString(ref) {
+		return ref, nil
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	// Annotated tags are listed twice; the peeled ref^{} names the commit instead of the tag
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", repo, ref, ref+"^{}")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to resolve remote base %s: %w\nOutput: %s", base, err, stderr.String())
+	}
+
+	var commit string
+	for line := range strings.Lines(stdout.String()) {
+		id, name, _ := strings.Cut(strings.TrimSpace(line), "\t")
+		if commit == "" || strings.HasSuffix(name, "^{}") {
+			commit = id
+		}
+	}
+	if commit == "" {
+		return "", fmt.Errorf("failed to resolve remote base %s: ref %s not found in %s", base, ref, repo)
+	}
+	return commit, nil
+}
+
+// splitRemote splits a kustomize remote base, e.g. github.com/org/repo//deploy?ref=v1, into the
+// repository URL git can clone and the ref, which is empty for the default branch
+func splitRemote(base string) (repo, ref string) {
+	repo, query, _ := strings.Cut(base, "?")
+	if values, err := url.ParseQuery(query); err == nil {
+		ref = values.Get("ref")
+		if ref == "" {
+			ref = values.Get("version")
+		}
+	}
+
+	// A double slash separates the repository from the path inside it
+	scheme, rest, hasScheme := strings.Cut(repo, "://")
+	if !hasScheme {
+		scheme, rest = "", repo
+	}
+	if before, _, ok := strings.Cut(rest, "//"); ok {
+		rest = before
+	} else {
+		// Without one, hosted repositories are the first two path segments
+		for _, host := range []string{"github.com/", "gitlab.com/", "bitbucket.org/"} {
+			if strings.HasPrefix(rest, host) {
+				if parts := strings.SplitN(rest, "/", 4); len(parts) == 4 {
+					rest = strings.Join(parts[:3], "/")
+				}
+			}
+		}
+	}
+
+	switch {
+	case hasScheme:
+		repo = scheme + "://" + rest
+	case strings.HasPrefix(rest, "git@"):
+		repo = rest
+	default:
+		repo = "https://" + rest
+	}
+	return repo, ref
+}
@@ -0,0 +1,184 @@
+package attest
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitRemote(t *testing.T) {
+	tests := []struct {
+		base     string
+		wantRepo string
+		wantRef  string
+	}{
+		{"github.com/org/repo//deploy/base?ref=v1.2.0", "https://github.com/org/repo", "v1.2.0"},
+		{"github.com/org/repo/deploy/base?ref=main", "https://github.com/org/repo", "main"},
+		{"https://github.com/org/repo//deploy?ref=v1", "https://github.com/org/repo", "v1"},
+		{"https://gitlab.com/group/repo.git//base?version=v2", "https://gitlab.com/group/repo.git", "v2"},
+		{"git@github.com:org/repo.git//base?ref=release", "git@github.com:org/repo.git", "release"},
+		{"ssh://git@git.internal/platform/bases.git//web", "ssh://git@git.internal/platform/bases.git", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			repo, ref := splitRemote(tt.base)
+			if repo != tt.wantRepo || ref != tt.wantRef {
+				t.Errorf("splitRemote() = %q, %q, want %q, %q", repo, ref, tt.wantRepo, tt.wantRef)
+			}
+		})
+	}
+}
+
+// gitRepo creates a repository with a commit tagged v1 with an annotated tag, and returns its
+// path and the commit
+func gitRepo(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-C", dir}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization: %v", err)
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "base")
+	git("tag", "-a", "v1", "-m", "v1")
+	return dir, git("rev-parse", "HEAD")
+}
+
+func TestResolveRemote(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, commit := gitRepo(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		base    string
+		want    string
+		wantErr string
+	}{
+		{name: "annotated tag", base: "file://" + dir + "//?ref=v1", want: commit},
+		{name: "branch", base: "file://" + dir + "//?ref=main", want: commit},
+		{name: "default branch", base: "file://" + dir, want: commit},
+		{name: "commit", base: "github.com/org/repo//base?ref=0123456789abcdef0123456789abcdef01234567", want: "0123456789abcdef0123456789abcdef01234567"},
+		{name: "missing ref", base: "file://" + dir + "//?ref=v2", wantErr: "ref v2 not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveRemote(ctx, tt.base)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveRemote() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveRemote() error = %v, want nil", err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRemote() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "overlays", "prod"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "overlays", "prod", "kustomization.yaml"), []byte("namePrefix: prod-\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	got, err := HashFiles(dir)
+	if err != nil {
+		t.Fatalf("HashFiles() error = %v, want nil", err)
+	}
+	want := map[string]string{"overlays/prod/kustomization.yaml": "44940ac20726cf53c97871265dc1a48d461eaeb873a77b9a0648ee6a6b903513"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HashFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	manifest := func() *Manifest {
+		return &Manifest{
+			PluginVersion: "1.0.0",
+			Kubectl:       "v1.31.0",
+			Kustomize:     "v5.4.2",
+			Pipelines: []Pipeline{{
+				BuildRoot:   ".",
+				Files:       map[string]string{"kustomization.yaml": "aa", "all.yaml": "bb"},
+				RemoteBases: []RemoteBase{{URL: "github.com/org/repo//base?ref=v1", Commit: "cc"}},
+			}},
+		}
+	}
+
+	digest, err := manifest().Digest()
+	if err != nil {
+		t.Fatalf("Digest() error = %v, want nil", err)
+	}
+	if !strings.HasPrefix(digest, "sha256:") || len(digest) != len("sha256:")+64 {
+		t.Errorf("Digest() = %q, want a sha256 digest", digest)
+	}
+	if again, _ := manifest().Digest(); again != digest {
+		t.Errorf("Digest() of an equal manifest = %q, want %q", again, digest)
+	}
+	changed := manifest()
+	changed.Pipelines[0].RemoteBases[0].Commit = "dd"
+	if other, _ := changed.Digest(); other == digest {
+		t.Error("Digest() should differ when a remote base moved")
+	}
+
+	path := filepath.Join(t.TempDir(), "inputs.json")
+	if err := manifest().Write(path); err != nil {
+		t.Fatalf("Write() error = %v, want nil", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	var read Manifest
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if !reflect.DeepEqual(&read, manifest()) {
+		t.Errorf("written manifest = %+v, want %+v", read, manifest())
+	}
+	if readDigest, _ := read.Digest(); readDigest != digest {
+		t.Errorf("Digest() of the written manifest = %q, want %q", readDigest, digest)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	resources := []map[string]any{
+		{"kind": "ConfigMap", "metadata": map[string]any{"name": "a", "annotations": map[string]any{"owner": "web"}}},
+		{"kind": "Secret"},
+	}
+	Annotate(resources, "sha256:abc")
+
+	want := []map[string]any{
+		{"kind": "ConfigMap", "metadata": map[string]any{"name": "a", "annotations": map[string]any{"owner": "web", Annotation: "sha256:abc"}}},
+		{"kind": "Secret", "metadata": map[string]any{"annotations": map[string]any{Annotation: "sha256:abc"}}},
+	}
+	if !reflect.DeepEqual(resources, want) {
+		t.Errorf("Annotate() = %v, want %v", resources, want)
+	}
+}
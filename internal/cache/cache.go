@@ -0,0 +1,149 @@
+// Package cache stores the output of kustomize builds, so that renders can skip builds that they
+// or other CI runners already did, such as those of kustomizations with slow remote bases
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backend stores values by key
+type Backend interface {
+	// Get returns the value stored under key; ok is false if there is none
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Put stores value under key
+	Put(ctx context.Context, key string, value []byte) error
+}
+
+// Open returns the backend of location: redis://[:password@]host[:port][/db] for a Redis server,
+// rediss:// for one over TLS, s3://bucket[/prefix] for an S3 bucket, or else a local directory.
+// Redis expires the values after ttl itself; Load skips older entries of every backend.
+func Open(location string, ttl time.Duration) (Backend, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" || u.Opaque != "" {
+		return &Dir{Path: location}, nil
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return newRedis(u, ttl)
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid build cache %q, expected s3://bucket[/prefix]", location)
+		}
+		return &S3{Bucket: u.Host, Prefix: u.Path}, nil
+	case "file":
+		return &Dir{Path: u.Path}, nil
+	}
+	return nil, fmt.Errorf("unsupported build cache %q, expected a directory, redis://, rediss:// or s3://", location)
+}
+
+// Entry is a cached build
+type Entry struct {
+	// Created is when the build ran, for Load to expire entries
+	Created  time.Time `json:"created"`
+	Output   []byte    `json:"output"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+// Key identifies a build by the files of the build directory tree, the build root inside it and
+// the kustomize version. Paths are relative to dir, which differs between renders.
+func Key(dir, buildRoot, version string) (string, error) {
+	h := sha256.New()
+	// Lengths keep the boundaries between fields unambiguous
+	fmt.Fprintf(h, "%d:%s%d:%s", len(version), version, len(buildRoot), filepath.ToSlash(buildRoot))
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%d:%s%d:", len(rel), filepath.ToSlash(rel), len(content))
+		h.Write(content)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash build directory: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Load returns the entry stored under key, or nil if there is none, it is older than ttl (if ttl
+// is positive) or it cannot be decoded, e.g. because it was written by another version
+func Load(ctx context.Context, backend Backend, key string, ttl time.Duration) (*Entry, error) {
+	value, ok, err := backend.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return nil, nil
+	}
+	if ttl > 0 && time.Since(entry.Created) > ttl {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// Store stores entry under key
+func Store(ctx context.Context, backend Backend, key string, entry *Entry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode build cache entry: %w", err)
+	}
+	return backend.Put(ctx, key, value)
+}
+
+// Dir is a backend keeping each value in a file of a local directory
+type Dir struct {
+	Path string
+}
+
+// Get implements Backend
+func (d *Dir) Get(_ context.Context, key string) ([]byte, bool, error) {
+	value, err := os.ReadFile(filepath.Join(d.Path, key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read build cache: %w", err)
+	}
+	return value, true, nil
+}
+
+// Put implements Backend. The value is written under a temporary name and renamed, so that
+// concurrent renders never read a partial entry.
+func (d *Dir) Put(_ context.Context, key string, value []byte) error {
+	if err := os.MkdirAll(d.Path, 0o755); err != nil {
+		return fmt.Errorf("failed to create build cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(d.Path, key+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write build cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write build cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write build cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.Path, key)); err != nil {
+		return fmt.Errorf("failed to write build cache: %w", err)
+	}
+	return nil
+}
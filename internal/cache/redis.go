@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisKeyPrefix namespaces the keys of the cache in a Redis database shared with other uses
+const redisKeyPrefix = "helm-kustomize:build:"
+
+// redisTimeout bounds each Redis operation when ctx has no deadline
+const redisTimeout = 10 * time.Second
+
+// maxRedisReply bounds the size of a reply, so that a broken or hostile server cannot make the
+// render allocate any amount of memory. It is the largest string Redis stores by default.
+const maxRedisReply = 512 << 20
+
+// Redis is a backend keeping values in a Redis server. It speaks the few commands it needs of
+// the Redis protocol (RESP) itself, over a connection per operation.
+type Redis struct {
+	// Addr is the host:port of the server
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	// TLS connects with TLS, as for rediss:// URLs; nil connects in plain text
+	TLS *tls.Config
+	// TTL lets the server expire the values it stores after this long; zero keeps them
+	TTL time.Duration
+}
+
+// newRedis returns the backend of a redis:// or rediss:// (TLS) URL as
+// [[user]:password@]host[:port][/db], whose values expire after ttl
+func newRedis(u *url.URL, ttl time.Duration) (*Redis, error) {
+	r := &Redis{Addr: u.Host, TTL: ttl}
+	if u.Port() == "" {
+		r.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.Scheme == "rediss" {
+		r.TLS = &tls.Config{ServerName: u.Hostname()}
+	}
+	if u.User != nil {
+		r.Username = u.User.Username()
+		r.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid Redis database %q in build cache %s", db, u.Redacted())
+		}
+		r.DB = n
+	}
+	return r, nil
+}
+
+// Get implements Backend
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var value []byte
+	var ok bool
+	err := r.do(ctx, func(conn *redisConn) error {
+		var err error
+		value, ok, err = conn.command("GET", redisKeyPrefix+key)
+		return err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read build cache: %w", err)
+	}
+	return value, ok, nil
+}
+
+// Put implements Backend
+func (r *Redis) Put(ctx context.Context, key string, value []byte) error {
+	args := []string{"SET", redisKeyPrefix + key, string(value)}
+	if r.TTL > 0 {
+		// EX takes whole seconds, so the value lives at least as long as the TTL
+		args = append(args, "EX", strconv.FormatInt(int64((r.TTL+time.Second-1)/time.Second), 10))
+	}
+	err := r.do(ctx, func(conn *redisConn) error {
+		_, _, err := conn.command(args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write build cache: %w", err)
+	}
+	return nil
+}
+
+// do connects to the server, authenticates, selects the database and runs fn
+func (r *Redis) do(ctx context.Context, fn func(conn *redisConn) error) error {
+	var c net.Conn
+	var err error
+	if r.TLS != nil {
+		dialer := tls.Dialer{Config: r.TLS}
+		c, err = dialer.DialContext(ctx, "tcp", r.Addr)
+	} else {
+		var dialer net.Dialer
+		c, err = dialer.DialContext(ctx, "tcp", r.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	conn := &redisConn{w: c, r: bufio.NewReader(c)}
+	if r.Password != "" {
+		args := []string{"AUTH", r.Password}
+		if r.Username != "" {
+			args = []string{"AUTH", r.Username, r.Password}
+		}
+		if _, _, err := conn.command(args...); err != nil {
+			return err
+		}
+	}
+	if r.DB != 0 {
+		if _, _, err := conn.command("SELECT", strconv.Itoa(r.DB)); err != nil {
+			return err
+		}
+	}
+	return fn(conn)
+}
+
+// redisConn sends commands and reads their replies
+type redisConn struct {
+	w io.Writer
+	r *bufio.Reader
+}
+
+// command sends a command as an array of bulk strings and reads its reply. ok is false for a nil
+// reply, e.g. the GET of a missing key.
+func (c *redisConn) command(args ...string) (reply []byte, ok bool, err error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.w, b.String()); err != nil {
+		return nil, false, err
+	}
+	return c.reply()
+}
+
+// reply reads a simple string, error, integer or bulk string reply
+func (c *redisConn) reply() ([]byte, bool, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, false, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, false, errors.New("empty Redis reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), true, nil
+	case '-':
+		return nil, false, fmt.Errorf("redis: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid Redis reply %q", line)
+		}
+		if n < 0 {
+			return nil, false, nil
+		}
+		if n > maxRedisReply {
+			return nil, false, fmt.Errorf("redis reply of %d bytes exceeds the limit of %d bytes", n, maxRedisReply)
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, false, err
+		}
+		return data[:n], true, nil
+	}
+	return nil, false, fmt.Errorf("unexpected Redis reply %q", line)
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves GET, SET, AUTH and SELECT from memory, keeping a map of values per database
+type fakeRedis struct {
+	password string
+
+	mu       sync.Mutex
+	values   map[int]map[string]string
+	expiries map[string]string
+	commands []string
+}
+
+// startFakeRedis listens on a local port and returns the server and its address
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	return serveFakeRedis(t, listener, password), listener.Addr().String()
+}
+
+// serveFakeRedis accepts the connections of listener until the test ends
+func serveFakeRedis(t *testing.T, listener net.Listener, password string) *fakeRedis {
+	t.Helper()
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeRedis{password: password, values: map[int]map[string]string{}, expiries: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+// serve answers the commands of a connection
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	db := 0
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, args[0])
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			if args[len(args)-1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			db, _ = strconv.Atoi(args[1])
+			reply = "+OK\r\n"
+		case args[0] == "SET":
+			if s.values[db] == nil {
+				s.values[db] = map[string]string{}
+			}
+			s.values[db][args[1]] = args[2]
+			if len(args) == 5 && args[3] == "EX" {
+				s.expiries[args[1]] = args[4]
+			}
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			if value, ok := s.values[db][args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	server, addr := startFakeRedis(t, "secret")
+	r := &Redis{Addr: addr, Password: "secret", DB: 3}
+
+	if _, ok, err := r.Get(ctx, "abc"); err != nil || ok {
+		t.Fatalf("Get() of a missing key = %v, %v, want a miss", ok, err)
+	}
+	// Values are binary-safe, including the line endings of the protocol
+	value := "kind: ConfigMap\r\n$5\r\n"
+	if err := r.Put(ctx, "abc", []byte(value)); err != nil {
+		t.Fatalf("Put() error = %v, want nil", err)
+	}
+	got, ok, err := r.Get(ctx, "abc")
+	if err != nil || !ok || string(got) != value {
+		t.Errorf("Get() = %q, %v, %v, want %q", got, ok, err, value)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, ok := server.values[3][redisKeyPrefix+"abc"]; !ok {
+		t.Errorf("fake Redis values = %v, want the key in database 3", server.values)
+	}
+	if !strings.HasPrefix(strings.Join(server.commands, " "), "AUTH SELECT GET") {
+		t.Errorf("commands = %v, want AUTH and SELECT before GET", server.commands)
+	}
+}
+
+func TestRedis_TTL(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want string
+	}{
+		{name: "no TTL", ttl: 0, want: ""},
+		{name: "whole seconds", ttl: 24 * time.Hour, want: "86400"},
+		{name: "rounded up", ttl: 1500 * time.Millisecond, want: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, addr := startFakeRedis(t, "")
+			r := &Redis{Addr: addr, TTL: tt.ttl}
+			if err := r.Put(ctx, "abc", []byte("value")); err != nil {
+				t.Fatalf("Put() error = %v, want nil", err)
+			}
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			if got := server.expiries[redisKeyPrefix+"abc"]; got != tt.want {
+				t.Errorf("SET EX = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedis_TLS(t *testing.T) {
+	ctx := context.Background()
+	// httptest provides a certificate for example.com, trusted by the client config below
+	https := httptest.NewTLSServer(nil)
+	defer https.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(https.Certificate())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	tlsListener := tls.NewListener(listener, &tls.Config{Certificates: https.TLS.Certificates})
+	serveFakeRedis(t, tlsListener, "")
+
+	r := &Redis{Addr: listener.Addr().String(), TLS: &tls.Config{ServerName: "example.com", RootCAs: roots}}
+	if err := r.Put(ctx, "abc", []byte("value")); err != nil {
+		t.Fatalf("Put() error = %v, want nil", err)
+	}
+	if got, ok, err := r.Get(ctx, "abc"); err != nil || !ok || string(got) != "value" {
+		t.Errorf("Get() = %q, %v, %v, want %q", got, ok, err, "value")
+	}
+
+	// A server without TLS fails the handshake rather than being spoken to in plain text
+	_, addr := startFakeRedis(t, "")
+	r = &Redis{Addr: addr, TLS: &tls.Config{ServerName: "example.com", RootCAs: roots}}
+	if _, _, err := r.Get(ctx, "abc"); err == nil {
+		t.Error("Get() error = nil, want a TLS handshake error")
+	}
+}
+
+func TestRedis_Errors(t *testing.T) {
+	ctx := context.Background()
+	_, addr := startFakeRedis(t, "secret")
+
+	r := &Redis{Addr: addr, Password: "wrong"}
+	if _, _, err := r.Get(ctx, "abc"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Get() error = %v, want error containing %q", err, "WRONGPASS")
+	}
+
+	r = &Redis{Addr: addr}
+	if err := r.Put(ctx, "abc", []byte("value")); err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Errorf("Put() error = %v, want error containing %q", err, "NOAUTH")
+	}
+
+	// A length beyond the limit fails before anything is allocated for it
+	huge, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer huge.Close()
+	go func() {
+		conn, err := huge.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := readCommand(bufio.NewReader(conn)); err == nil {
+			io.WriteString(conn, "$999999999999\r\n")
+		}
+	}()
+	r = &Redis{Addr: huge.Addr().String()}
+	if _, _, err := r.Get(ctx, "abc"); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("Get() error = %v, want error containing %q", err, "exceeds the limit")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+	r = &Redis{Addr: closed}
+	if _, _, err := r.Get(ctx, "abc"); err == nil || !strings.Contains(err.Error(), "failed to read build cache") {
+		t.Errorf("Get() error = %v, want error containing %q", err, "failed to read build cache")
+	}
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// S3 is a backend keeping values as objects of an S3 bucket, copied with the AWS CLI. Credentials
+// and the region are those the AWS CLI reads, e.g. AWS_PROFILE or an instance role.
+type S3 struct {
+	Bucket string
+	// Prefix is prepended to the object keys
+	Prefix string
+}
+
+// url returns the S3 URL of the object of key
+func (s *S3) url(key string) string {
+	return "s3://" + s.Bucket + "/" + strings.TrimPrefix(path.Join(s.Prefix, key), "/")
+}
+
+// Get implements Backend
+func (s *S3) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "aws", "s3", "cp", "--only-show-errors", s.url(key), "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// The CLI reports missing objects as a failed HeadObject
+		if strings.Contains(stderr.String(), "(404)") || strings.Contains(stderr.String(), "Not Found") {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read build cache: %w\nOutput: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), true, nil
+}
+
+// Put implements Backend
+func (s *S3) Put(ctx context.Context, key string, value []byte) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "aws", "s3", "cp", "--only-show-errors", "-", s.url(key))
+	cmd.Stdin = bytes.NewReader(value)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write build cache: %w\nOutput: %s", err, stderr.String())
+	}
+	return nil
+}
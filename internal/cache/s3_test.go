@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installFakeAWS puts a fake aws first in PATH whose `s3 cp` copies objects to and from the
+// returned directory, with the object keys as file names, and fails like the AWS CLI for missing
+// objects
+func installFakeAWS(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	bucket := filepath.Join(dir, "bucket")
+	if err := os.Mkdir(bucket, 0755); err != nil {
+		t.Fatalf("Failed to create bucket directory: %v", err)
+	}
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" >> \"" + filepath.Join(dir, "args") + "\"\n" +
+		"src=$4 dst=$5\n" +
+		"if [ \"$src\" = - ]; then\n" +
+		"  cat > \"" + bucket + "/$(echo \"$dst\" | tr / _)\"\n" +
+		"  exit 0\n" +
+		"fi\n" +
+		"object=\"" + bucket + "/$(echo \"$src\" | tr / _)\"\n" +
+		"if [ ! -f \"$object\" ]; then\n" +
+		"  echo 'fatal error: An error occurred (404) when calling the HeadObject operation: Not Found' >&2\n" +
+		"  exit 1\n" +
+		"fi\n" +
+		"cat \"$object\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "aws"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake aws: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	dir := installFakeAWS(t)
+	s := &S3{Bucket: "ci-cache", Prefix: "/helm/builds"}
+
+	if _, ok, err := s.Get(ctx, "abc"); err != nil || ok {
+		t.Fatalf("Get() of a missing key = %v, %v, want a miss", ok, err)
+	}
+	if err := s.Put(ctx, "abc", []byte("kind: ConfigMap\n")); err != nil {
+		t.Fatalf("Put() error = %v, want nil", err)
+	}
+	value, ok, err := s.Get(ctx, "abc")
+	if err != nil || !ok || string(value) != "kind: ConfigMap\n" {
+		t.Errorf("Get() = %q, %v, %v, want the stored value", value, ok, err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatalf("Failed to read aws arguments: %v", err)
+	}
+	if !strings.Contains(string(args), "s3 cp --only-show-errors - s3://ci-cache/helm/builds/abc") {
+		t.Errorf("aws arguments = %q, want a copy to s3://ci-cache/helm/builds/abc", args)
+	}
+}
+
+func TestS3_Error(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Unable to locate credentials' >&2\nexit 255\n"
+	if err := os.WriteFile(filepath.Join(dir, "aws"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake aws: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	s := &S3{Bucket: "ci-cache"}
+	if _, _, err := s.Get(context.Background(), "abc"); err == nil || !strings.Contains(err.Error(), "Unable to locate credentials") {
+		t.Errorf("Get() error = %v, want error containing %q", err, "Unable to locate credentials")
+	}
+}
@@ -0,0 +1,75 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// Config selects the cluster kubectl talks to. Empty fields fall back to kubectl's defaults
+// (KUBECONFIG, current context and its namespace).
+type Config struct {
+	Kubeconfig string
+	Context    string
+	Namespace  string
+}
+
+// args returns the kubectl flags for the config
+func (c Config) args() []string {
+	var args []string
+	if c.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", c.Kubeconfig)
+	}
+	if c.Context != "" {
+		args = append(args, "--context", c.Context)
+	}
+	if c.Namespace != "" {
+		args = append(args, "--namespace", c.Namespace)
+	}
+	return args
+}
+
+// Diff sends manifests through a server-side dry-run and returns the field-level diff against the
+// live objects, along with whether any differences were found
+func Diff(ctx context.Context, manifests []byte, cfg Config) (string, bool, error) {
+	args := append([]string{"diff", "--server-side", "-f", "-"}, cfg.args()...)
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	cmd.Stdin = bytes.NewReader(manifests)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return stdout.String(), false, nil
+	}
+
+	// kubectl diff exits with 1 when differences were found and above 1 on errors
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return stdout.String(), true, nil
+	}
+
+	return "", false, fmt.Errorf("kubectl diff failed: %w\nOutput: %s", err, stderr.String())
+}
+
+// DryRun submits manifests to the cluster with a server-side dry-run apply, which runs them
+// through admission and validation without persisting them. It returns the kubectl output
+// naming the checked objects.
+func DryRun(ctx context.Context, manifests []byte, cfg Config) (string, error) {
+	args := append([]string{"apply", "--dry-run=server", "-o", "name", "-f", "-"}, cfg.args()...)
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	cmd.Stdin = bytes.NewReader(manifests)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("server-side dry-run failed: %w\nOutput: %s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installFakeKubectl puts a fake kubectl first in PATH. It records its arguments and stdin
+// next to itself, prints stdout and exits with the given code.
+func installFakeKubectl(t *testing.T, stdout string, exitCode int) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+		"cat > \"" + filepath.Join(dir, "stdin") + "\"\n" +
+		"printf '%s' '" + stdout + "'\n" +
+		"echo 'fake stderr' >&2\n" +
+		"exit " + string(rune('0'+exitCode)) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		exitCode    int
+		wantChanged bool
+		wantErr     bool
+	}{
+		{name: "no differences", exitCode: 0, wantChanged: false},
+		{name: "differences", exitCode: 1, wantChanged: true},
+		{name: "error", exitCode: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := installFakeKubectl(t, "diff output", tt.exitCode)
+
+			cfg := Config{Kubeconfig: "/tmp/kubeconfig", Context: "staging", Namespace: "apps"}
+			text, changed, err := Diff(context.Background(), []byte("kind: ConfigMap\n"), cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Diff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "fake stderr") {
+					t.Errorf("Error should include kubectl stderr, got: %v", err)
+				}
+				return
+			}
+
+			if changed != tt.wantChanged {
+				t.Errorf("Diff() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if text != "diff output" {
+				t.Errorf("Diff() text = %q, want %q", text, "diff output")
+			}
+
+			wantArgs := "diff --server-side -f - --kubeconfig /tmp/kubeconfig --context staging --namespace apps\n"
+			if got := readFile(t, filepath.Join(dir, "args")); got != wantArgs {
+				t.Errorf("kubectl args = %q, want %q", got, wantArgs)
+			}
+			if got := readFile(t, filepath.Join(dir, "stdin")); got != "kind: ConfigMap\n" {
+				t.Errorf("kubectl stdin = %q, want manifests", got)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir := installFakeKubectl(t, "configmap/test (server dry run)", 0)
+
+	out, err := DryRun(context.Background(), []byte("kind: ConfigMap\n"), Config{Context: "staging"})
+	if err != nil {
+		t.Fatalf("DryRun() error = %v, want nil", err)
+	}
+	if out != "configmap/test (server dry run)" {
+		t.Errorf("DryRun() = %q, want kubectl output", out)
+	}
+
+	wantArgs := "apply --dry-run=server -o name -f - --context staging\n"
+	if got := readFile(t, filepath.Join(dir, "args")); got != wantArgs {
+		t.Errorf("kubectl args = %q, want %q", got, wantArgs)
+	}
+	if got := readFile(t, filepath.Join(dir, "stdin")); got != "kind: ConfigMap\n" {
+		t.Errorf("kubectl stdin = %q, want manifests", got)
+	}
+}
+
+func TestDryRun_Rejected(t *testing.T) {
+	installFakeKubectl(t, "", 1)
+
+	_, err := DryRun(context.Background(), []byte("kind: ConfigMap\n"), Config{})
+	if err == nil {
+		t.Fatal("DryRun() error = nil, want error")
+	}
+	if !strings.Contains(err.Error(), "server-side dry-run failed") || !strings.Contains(err.Error(), "fake stderr") {
+		t.Errorf("DryRun() error = %v, want error with kubectl stderr", err)
+	}
+}
+
+func TestConfig_Args_Empty(t *testing.T) {
+	if args := (Config{}).args(); len(args) != 0 {
+		t.Errorf("args() = %v, want none", args)
+	}
+}
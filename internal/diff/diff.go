@@ -0,0 +1,195 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// Resources returns a unified diff between two sets of resources, matched by ID.
+// Resources are listed in the order of before, followed by resources only present in after.
+// Unchanged resources produce no output.
+func Resources(before, after []map[string]any) (string, error) {
+	beforeByID := make(map[manifest.ID]map[string]any, len(before))
+	afterByID := make(map[manifest.ID]map[string]any, len(after))
+	var order []manifest.ID
+
+	for _, resource := range before {
+		id := manifest.IDOf(resource)
+		if _, seen := beforeByID[id]; !seen {
+			order = append(order, id)
+		}
+		beforeByID[id] = resource
+	}
+	for _, resource := range after {
+		id := manifest.IDOf(resource)
+		if _, seen := beforeByID[id]; !seen {
+			if _, seen := afterByID[id]; !seen {
+				order = append(order, id)
+			}
+		}
+		afterByID[id] = resource
+	}
+
+	var b strings.Builder
+	for _, id := range order {
+		fromText, err := encode(beforeByID[id])
+		if err != nil {
+			return "", err
+		}
+		toText, err := encode(afterByID[id])
+		if err != nil {
+			return "", err
+		}
+
+		text, err := Unified(id.String(), fromText, toText)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(text)
+	}
+
+	return b.String(), nil
+}
+
+// Changed returns the resources of after whose content differs from the resource with the same
+// ID in before, including resources only present in after, in the order of after. The IDs of the
+// remaining, unchanged resources are returned separately.
+func Changed(before, after []map[string]any) ([]map[string]any, []manifest.ID, error) {
+	changedSet, err := manifest.ChangedSet(before, after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changed []map[string]any
+	var unchanged []manifest.ID
+	for _, resource := range after {
+		if id := manifest.IDOf(resource); changedSet[id] {
+			changed = append(changed, resource)
+		} else {
+			unchanged = append(unchanged, id)
+		}
+	}
+
+	return changed, unchanged, nil
+}
+
+// Change is a resource that differs between two sets of resources
+type Change struct {
+	ID manifest.ID
+	// Action is "added", "removed" or "changed"
+	Action string
+}
+
+// Changes lists the resources added, removed or changed between before and after, matched by ID
+// and compared by content hash, in the order of before followed by the resources only present in
+// after
+func Changes(before, after []map[string]any) ([]Change, error) {
+	afterHashes := make(map[manifest.ID]string, len(after))
+	for _, resource := range after {
+		hash, err := manifest.HashOf(resource)
+		if err != nil {
+			return nil, err
+		}
+		afterHashes[manifest.IDOf(resource)] = hash
+	}
+
+	var changes []Change
+	seen := make(map[manifest.ID]bool, len(before))
+	for _, resource := range before {
+		id := manifest.IDOf(resource)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		hash, err := manifest.HashOf(resource)
+		if err != nil {
+			return nil, err
+		}
+		switch afterHash, ok := afterHashes[id]; {
+		case !ok:
+			changes = append(changes, Change{ID: id, Action: "removed"})
+		case afterHash != hash:
+			changes = append(changes, Change{ID: id, Action: "changed"})
+		}
+	}
+	for _, resource := range after {
+		if id := manifest.IDOf(resource); !seen[id] {
+			seen[id] = true
+			changes = append(changes, Change{ID: id, Action: "added"})
+		}
+	}
+	return changes, nil
+}
+
+// Unified returns a unified diff between two texts describing the same named object
+func Unified(name, from, to string) (string, error) {
+	return unified(name, "a", "b", from, to)
+}
+
+// ThreeWay returns the unified diffs of two diverging versions of a named object against the
+// base they both derive from, labelled first and second. Without a base, it diffs the versions
+// against each other.
+func ThreeWay(name, base, first, second string) (string, error) {
+	if base == "" {
+		return unified(name, "first", "second", first, second)
+	}
+	fromFirst, err := unified(name, "base", "first", base, first)
+	if err != nil {
+		return "", err
+	}
+	fromSecond, err := unified(name, "base", "second", base, second)
+	if err != nil {
+		return "", err
+	}
+	return fromFirst + fromSecond, nil
+}
+
+// unified returns a unified diff between two texts describing a named object, labelling them
+// with the name under the from and to prefixes
+func unified(name, fromPrefix, toPrefix, from, to string) (string, error) {
+	if from == to {
+		return "", nil
+	}
+
+	text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: fromPrefix + "/" + name,
+		ToFile:   toPrefix + "/" + name,
+		Context:  contextLines,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s: %w", name, err)
+	}
+	return text, nil
+}
+
+// encode renders a resource as YAML, or an empty string if it is absent
+func encode(resource map[string]any) (string, error) {
+	if resource == nil {
+		return "", nil
+	}
+	data, err := manifest.Encode(resource)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// splitLines splits text into newline-terminated lines, treating an empty text as having no lines
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	lines := strings.SplitAfter(text, "\n")
+	return lines[:len(lines)-1]
+}
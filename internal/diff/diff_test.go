@@ -0,0 +1,186 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func configMap(name string, data map[string]any) map[string]any {
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": name},
+		"data":       data,
+	}
+}
+
+func TestResources(t *testing.T) {
+	before := []map[string]any{
+		configMap("unchanged", map[string]any{"key": "value"}),
+		configMap("changed", map[string]any{"key": "old"}),
+		configMap("removed", map[string]any{"key": "value"}),
+	}
+	after := []map[string]any{
+		configMap("added", map[string]any{"key": "value"}),
+		configMap("changed", map[string]any{"key": "new"}),
+		configMap("unchanged", map[string]any{"key": "value"}),
+	}
+
+	got, err := Resources(before, after)
+	if err != nil {
+		t.Fatalf("Resources() error = %v, want nil", err)
+	}
+
+	want := `--- a/ConfigMap/changed
++++ b/ConfigMap/changed
+@@ -1,6 +1,6 @@
+ apiVersion: v1
+ data:
+-  key: old
++  key: new
+ kind: ConfigMap
+ metadata:
+   name: changed
+--- a/ConfigMap/removed
++++ b/ConfigMap/removed
+@@ -1,6 +0,0 @@
+-apiVersion: v1
+-data:
+-  key: value
+-kind: ConfigMap
+-metadata:
+-  name: removed
+--- a/ConfigMap/added
++++ b/ConfigMap/added
+@@ -0,0 +1,6 @@
++apiVersion: v1
++data:
++  key: value
++kind: ConfigMap
++metadata:
++  name: added
+`
+	if got != want {
+		t.Errorf("Resources() =\n%s\nwant =\n%s", got, want)
+	}
+}
+
+func TestResources_NoChanges(t *testing.T) {
+	resources := []map[string]any{configMap("same", map[string]any{"key": "value"})}
+
+	got, err := Resources(resources, resources)
+	if err != nil {
+		t.Fatalf("Resources() error = %v, want nil", err)
+	}
+	if got != "" {
+		t.Errorf("Resources() = %q, want empty diff", got)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	got, err := Unified("file", "a\nb\n", "a\nc\n")
+	if err != nil {
+		t.Fatalf("Unified() error = %v, want nil", err)
+	}
+	if !strings.Contains(got, "-b\n+c\n") || !strings.HasPrefix(got, "--- a/file\n+++ b/file\n") {
+		t.Errorf("Unified() = %q", got)
+	}
+}
+
+func TestThreeWay(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		first  string
+		second string
+		want   []string
+	}{
+		{
+			name:   "against the base",
+			base:   "a\nb\n",
+			first:  "a\nc\n",
+			second: "a\nd\n",
+			want:   []string{"--- base/file\n+++ first/file\n", "-b\n+c\n", "--- base/file\n+++ second/file\n", "-b\n+d\n"},
+		},
+		{
+			name:   "without a base",
+			first:  "a\nc\n",
+			second: "a\nd\n",
+			want:   []string{"--- first/file\n+++ second/file\n", "-c\n+d\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ThreeWay("file", tt.base, tt.first, tt.second)
+			if err != nil {
+				t.Fatalf("ThreeWay() error = %v, want nil", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("ThreeWay() = %q, want it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChanged(t *testing.T) {
+	before := []map[string]any{
+		configMap("unchanged", map[string]any{"key": "value"}),
+		configMap("changed", map[string]any{"key": "old"}),
+		configMap("removed", map[string]any{"key": "value"}),
+	}
+	after := []map[string]any{
+		configMap("added", map[string]any{"key": "value"}),
+		configMap("changed", map[string]any{"key": "new"}),
+		configMap("unchanged", map[string]any{"key": "value"}),
+	}
+
+	changed, unchanged, err := Changed(before, after)
+	if err != nil {
+		t.Fatalf("Changed() error = %v, want nil", err)
+	}
+
+	var names []string
+	for _, resource := range changed {
+		names = append(names, resource["metadata"].(map[string]any)["name"].(string))
+	}
+	if strings.Join(names, ",") != "added,changed" {
+		t.Errorf("Changed() changed = %v, want [added changed]", names)
+	}
+
+	if len(unchanged) != 1 || unchanged[0].String() != "ConfigMap/unchanged" {
+		t.Errorf("Changed() unchanged = %v, want [ConfigMap/unchanged]", unchanged)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	before := []map[string]any{
+		configMap("unchanged", map[string]any{"key": "value"}),
+		configMap("changed", map[string]any{"key": "old"}),
+		configMap("removed", map[string]any{"key": "value"}),
+	}
+	after := []map[string]any{
+		configMap("added", map[string]any{"key": "value"}),
+		configMap("changed", map[string]any{"key": "new"}),
+		configMap("unchanged", map[string]any{"key": "value"}),
+	}
+
+	changes, err := Changes(before, after)
+	if err != nil {
+		t.Fatalf("Changes() error = %v, want nil", err)
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.Action+" "+change.ID.String())
+	}
+	want := "changed ConfigMap/changed,removed ConfigMap/removed,added ConfigMap/added"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Changes() = %v, want %s", got, want)
+	}
+
+	if changes, _ := Changes(after, after); len(changes) != 0 {
+		t.Errorf("Changes() of equal resources = %v, want none", changes)
+	}
+}
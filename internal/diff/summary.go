@@ -0,0 +1,315 @@
+package diff
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// Summary returns a human-readable summary of the transformations that turned before into
+// after, e.g. "added label app=web to 14 resources" or "patched spec.replicas on
+// Deployment.apps/web". Resources renamed by a name prefix or suffix, or moved to a namespace,
+// are matched with their original. Label, annotation and image changes are counted across
+// resources; other changes are listed per resource.
+func Summary(before, after []map[string]any) []string {
+	var s summary
+	pairs, generated, removed := match(before, after)
+	for _, p := range pairs {
+		s.add(p)
+	}
+
+	lines := s.lines()
+	for _, i := range generated {
+		lines = append(lines, fmt.Sprintf("generated %s", manifest.IDOf(after[i])))
+	}
+	for _, resource := range removed {
+		lines = append(lines, fmt.Sprintf("removed %s", manifest.IDOf(resource)))
+	}
+	return lines
+}
+
+// Generated returns the indexes of the resources of after that have no original in before, such
+// as the ConfigMaps of a configMapGenerator. Resources are matched like in Summary.
+func Generated(before, after []map[string]any) []int {
+	_, generated, _ := match(before, after)
+	return generated
+}
+
+// Removed returns the IDs of the resources of before that have no counterpart in after.
+// Resources are matched like in Summary.
+func Removed(before, after []map[string]any) []manifest.ID {
+	_, _, removed := match(before, after)
+	ids := make([]manifest.ID, 0, len(removed))
+	for _, resource := range removed {
+		ids = append(ids, manifest.IDOf(resource))
+	}
+	return ids
+}
+
+// Originals returns, for each resource of after, the resource of before it was rendered from, or
+// nil if it was generated. Resources are matched like in Summary.
+func Originals(before, after []map[string]any) []map[string]any {
+	pairs, _, _ := match(before, after)
+	originals := make([]map[string]any, len(after))
+	for _, p := range pairs {
+		originals[p.index] = p.before
+	}
+	return originals
+}
+
+// pair is a resource of the input and the rendered resource it became
+type pair struct {
+	before, after map[string]any
+	// index is the index of after in the rendered resources
+	index int
+	// prefix and suffix are the parts added to the name
+	prefix, suffix string
+}
+
+// match pairs the resources of before and after by ID, falling back to resources of the same
+// kind whose rendered name contains the original name. The longest original name wins, so that
+// web-config is not matched with web. Generated resources are returned as indexes of after.
+func match(before, after []map[string]any) (pairs []pair, generated []int, removed []map[string]any) {
+	beforeByID := make(map[manifest.ID]map[string]any, len(before))
+	for _, resource := range before {
+		beforeByID[manifest.IDOf(resource)] = resource
+	}
+	matched := make(map[manifest.ID]bool, len(before))
+
+	var unmatched []int
+	for i, resource := range after {
+		id := manifest.IDOf(resource)
+		if original, ok := beforeByID[id]; ok && !matched[id] {
+			matched[id] = true
+			pairs = append(pairs, pair{before: original, after: resource, index: i})
+			continue
+		}
+		unmatched = append(unmatched, i)
+	}
+
+	for _, index := range unmatched {
+		resource := after[index]
+		id := manifest.IDOf(resource)
+		var best *manifest.ID
+		for _, original := range before {
+			candidate := manifest.IDOf(original)
+			if matched[candidate] || candidate.Group != id.Group || candidate.Kind != id.Kind || candidate.Name == "" {
+				continue
+			}
+			if strings.Contains(id.Name, candidate.Name) && (best == nil || len(candidate.Name) > len(best.Name)) {
+				best = &candidate
+			}
+		}
+		if best == nil {
+			generated = append(generated, index)
+			continue
+		}
+
+		matched[*best] = true
+		i := strings.Index(id.Name, best.Name)
+		pairs = append(pairs, pair{
+			before: beforeByID[*best],
+			after:  resource,
+			index:  index,
+			prefix: id.Name[:i],
+			suffix: id.Name[i+len(best.Name):],
+		})
+	}
+
+	for _, resource := range before {
+		if !matched[manifest.IDOf(resource)] {
+			removed = append(removed, resource)
+		}
+	}
+	return pairs, generated, removed
+}
+
+// tally counts resources per change, keeping the order in which changes were first seen
+type tally struct {
+	order  []string
+	counts map[string]int
+}
+
+func (t *tally) add(change string) {
+	if t.counts == nil {
+		t.counts = map[string]int{}
+	}
+	if t.counts[change] == 0 {
+		t.order = append(t.order, change)
+	}
+	t.counts[change]++
+}
+
+// summary collects the changes of all pairs
+type summary struct {
+	prefixes, suffixes, namespaces, labels, annotations, images tally
+	patched                                                     []string
+}
+
+// add records the changes between a pair
+func (s *summary) add(p pair) {
+	if p.prefix != "" {
+		s.prefixes.add(p.prefix)
+	}
+	if p.suffix != "" {
+		s.suffixes.add(p.suffix)
+	}
+
+	beforeMeta, _ := p.before["metadata"].(map[string]any)
+	afterMeta, _ := p.after["metadata"].(map[string]any)
+	if namespace, _ := afterMeta["namespace"].(string); namespace != "" && namespace != beforeMeta["namespace"] {
+		s.namespaces.add(namespace)
+	}
+
+	// Labels and annotations are propagated to selectors and pod templates, which are not
+	// reported as patches
+	propagated := map[string]bool{}
+	for _, field := range []struct {
+		name  string
+		tally *tally
+	}{{"labels", &s.labels}, {"annotations", &s.annotations}} {
+		from, _ := beforeMeta[field.name].(map[string]any)
+		to, _ := afterMeta[field.name].(map[string]any)
+		for _, key := range slices.Sorted(maps.Keys(to)) {
+			value := fmt.Sprint(to[key])
+			old, existed := from[key]
+			switch {
+			case !existed:
+				field.tally.add(fmt.Sprintf("added %s %s=%s to", strings.TrimSuffix(field.name, "s"), key, value))
+			case !reflect.DeepEqual(old, to[key]):
+				field.tally.add(fmt.Sprintf("set %s %s=%s on", strings.TrimSuffix(field.name, "s"), key, value))
+			default:
+				continue
+			}
+			propagated[key+"="+value] = true
+		}
+		for _, key := range slices.Sorted(maps.Keys(from)) {
+			if _, ok := to[key]; !ok {
+				field.tally.add(fmt.Sprintf("removed %s %s from", strings.TrimSuffix(field.name, "s"), key))
+			}
+		}
+	}
+
+	w := walker{pair: p, propagated: propagated, images: &s.images, seenImages: map[string]bool{}}
+	for _, key := range slices.Sorted(maps.Keys(p.after)) {
+		if key == "metadata" {
+			from, _ := p.before[key].(map[string]any)
+			to, _ := p.after[key].(map[string]any)
+			w.maps("metadata", withoutKeys(from), withoutKeys(to))
+			continue
+		}
+		w.walk(key, p.before[key], p.after[key])
+	}
+	for _, key := range slices.Sorted(maps.Keys(p.before)) {
+		if _, ok := p.after[key]; !ok {
+			w.paths = append(w.paths, "removed "+key)
+		}
+	}
+	if len(w.paths) > 0 {
+		s.patched = append(s.patched, fmt.Sprintf("patched %s on %s", strings.Join(w.paths, ", "), manifest.IDOf(p.after)))
+	}
+}
+
+// lines formats the counted changes followed by the patched resources
+func (s *summary) lines() []string {
+	var lines []string
+	for _, c := range []struct {
+		tally  *tally
+		format string
+	}{
+		{&s.prefixes, "added name prefix %s to %s"},
+		{&s.suffixes, "added name suffix %s to %s"},
+		{&s.namespaces, "set namespace %s on %s"},
+		{&s.labels, "%s %s"},
+		{&s.annotations, "%s %s"},
+		{&s.images, "set image %s on %s"},
+	} {
+		for _, change := range c.tally.order {
+			lines = append(lines, fmt.Sprintf(c.format, change, resources(c.tally.counts[change])))
+		}
+	}
+	return append(lines, s.patched...)
+}
+
+// walker finds the changed fields of a pair that no counted change explains
+type walker struct {
+	pair
+	propagated map[string]bool
+	images     *tally
+	seenImages map[string]bool
+	paths      []string
+}
+
+func (w *walker) walk(path string, from, to any) {
+	if reflect.DeepEqual(from, to) {
+		return
+	}
+	switch to := to.(type) {
+	case map[string]any:
+		if from, ok := from.(map[string]any); ok {
+			w.maps(path, from, to)
+			return
+		}
+	case []any:
+		if from, ok := from.([]any); ok && len(from) == len(to) {
+			for i := range to {
+				w.walk(fmt.Sprintf("%s[%d]", path, i), from[i], to[i])
+			}
+			return
+		}
+	case string:
+		// References to renamed resources get the same prefix and suffix
+		if from, ok := from.(string); ok && (w.prefix != "" || w.suffix != "") && to == w.prefix+from+w.suffix {
+			return
+		}
+		if strings.HasSuffix(path, ".image") {
+			// Each image is counted once per resource, whatever the number of containers
+			if !w.seenImages[to] {
+				w.seenImages[to] = true
+				w.images.add(to)
+			}
+			return
+		}
+	}
+	w.paths = append(w.paths, path)
+}
+
+func (w *walker) maps(path string, from, to map[string]any) {
+	propagating := strings.HasSuffix(path, "labels") || strings.HasSuffix(path, "Labels") || strings.HasSuffix(path, "annotations")
+	for _, key := range slices.Sorted(maps.Keys(to)) {
+		if propagating && w.propagated[key+"="+fmt.Sprint(to[key])] {
+			continue
+		}
+		w.walk(path+"."+key, from[key], to[key])
+	}
+	for _, key := range slices.Sorted(maps.Keys(from)) {
+		if _, ok := to[key]; !ok {
+			w.paths = append(w.paths, "removed "+path+"."+key)
+		}
+	}
+}
+
+// withoutKeys returns the metadata fields other than those counted separately
+func withoutKeys(metadata map[string]any) map[string]any {
+	rest := make(map[string]any, len(metadata))
+	for key, value := range metadata {
+		switch key {
+		case "name", "namespace", "labels", "annotations":
+		default:
+			rest[key] = value
+		}
+	}
+	return rest
+}
+
+// resources formats a resource count
+func resources(n int) string {
+	if n == 1 {
+		return "1 resource"
+	}
+	return fmt.Sprintf("%d resources", n)
+}
@@ -0,0 +1,199 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+	"go.yaml.in/yaml/v4"
+)
+
+func decodeAll(t *testing.T, docs ...string) []map[string]any {
+	t.Helper()
+	resources := make([]map[string]any, 0, len(docs))
+	for _, doc := range docs {
+		var resource map[string]any
+		if err := yaml.Unmarshal([]byte(doc), &resource); err != nil {
+			t.Fatalf("Failed to decode resource: %v", err)
+		}
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        envFrom:
+        - configMapRef:
+            name: web-config
+      - name: sidecar
+        image: nginx
+`
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name   string
+		before []string
+		after  []string
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			before: []string{deployment},
+			after:  []string{deployment},
+		},
+		{
+			name: "labels, namespace, name prefix and images",
+			before: []string{
+				deployment,
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web-config\n",
+			},
+			after: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: prod-web-config\n  namespace: prod\n  labels:\n    team: web\n",
+				`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: prod-web
+  namespace: prod
+  labels:
+    team: web
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: web
+      team: web
+  template:
+    metadata:
+      labels:
+        app: web
+        team: web
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.25
+        envFrom:
+        - configMapRef:
+            name: prod-web-config
+      - name: sidecar
+        image: nginx:1.25
+`,
+			},
+			want: []string{
+				"added name prefix prod- to 2 resources",
+				"set namespace prod on 2 resources",
+				"added label team=web to 2 resources",
+				"set image nginx:1.25 on 1 resource",
+			},
+		},
+		{
+			name:   "patched, generated and removed",
+			before: []string{deployment, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: old\n"},
+			after: []string{
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings-8g2h5\ndata:\n  mode: prod\n",
+				`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  annotations:
+    owner: platform
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        envFrom:
+        - configMapRef:
+            name: web-config
+      - name: sidecar
+        image: nginx
+`,
+			},
+			want: []string{
+				"added annotation owner=platform to 1 resource",
+				"patched spec.replicas on Deployment.apps/web",
+				"generated ConfigMap/settings-8g2h5",
+				"removed Secret/old",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Summary(decodeAll(t, tt.before...), decodeAll(t, tt.after...))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	before := decodeAll(t, deployment)
+	after := decodeAll(t,
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings-8g2h5\n",
+		deployment,
+		"apiVersion: v1\nkind: Secret\nmetadata:\n  name: tls-b2c4\n",
+	)
+
+	if got := Generated(before, after); !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("Generated() = %v, want [0 2]", got)
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	before := decodeAll(t,
+		deployment,
+		"apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+	)
+	after := decodeAll(t,
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: prod-settings\n",
+		deployment,
+	)
+
+	want := []manifest.ID{{Kind: "Service", Name: "web"}}
+	if got := Removed(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Removed() = %v, want %v", got, want)
+	}
+}
+
+func TestOriginals(t *testing.T) {
+	before := decodeAll(t,
+		deployment,
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+	)
+	after := decodeAll(t,
+		"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: prod-settings\n",
+		"apiVersion: v1\nkind: Secret\nmetadata:\n  name: tls-b2c4\n",
+		deployment,
+	)
+
+	want := []map[string]any{before[1], nil, before[0]}
+	if got := Originals(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("Originals() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CacheFileName is the name of the digest cache inside the Helm cache directory
+const CacheFileName = "helm-kustomize-digests.json"
+
+// Resolve looks up the digest of an image reference in its registry with `crane digest`,
+// e.g. "sha256:4c0f...". Registry credentials are those of the docker config crane reads.
+func Resolve(ctx context.Context, image string) (string, error) {
+	cmd := exec.CommandContext(ctx, "crane", "digest", image)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to resolve the digest of %s: %w\nOutput: %s", image, err, stderr.String())
+	}
+	digest := strings.TrimSpace(stdout.String())
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("failed to resolve the digest of %s: unexpected crane output %q", image, digest)
+	}
+	return digest, nil
+}
+
+// Resolver resolves image digests through a cache file, so that each image is looked up once
+// and renders can be repeated without registry access
+type Resolver struct {
+	// Path is the cache file, a JSON object of digests by image reference
+	Path string
+	// Offline only resolves images from the cache and fails for the others
+	Offline bool
+	// resolve looks up digests missing from the cache, Resolve if nil
+	resolve func(ctx context.Context, image string) (string, error)
+
+	digests map[string]string
+	dirty   bool
+}
+
+// NewResolver reads the cache file at path. A missing file is an empty cache.
+func NewResolver(path string, offline bool) (*Resolver, error) {
+	r := &Resolver{Path: path, Offline: offline, resolve: Resolve, digests: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read digest cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.digests); err != nil {
+		return nil, fmt.Errorf("failed to parse digest cache %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Digest returns the digest of an image reference, from the cache if it has it
+func (r *Resolver) Digest(ctx context.Context, image string) (string, error) {
+	if digest, ok := r.digests[image]; ok {
+		return digest, nil
+	}
+	if r.Offline {
+		return "", fmt.Errorf("image %s is not in the digest cache %s, which offline mode requires", image, r.Path)
+	}
+	digest, err := r.resolve(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	r.digests[image] = digest
+	r.dirty = true
+	return digest, nil
+}
+
+// Save writes the cache file if digests were added to it
+func (r *Resolver) Save() error {
+	if !r.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.digests, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode digest cache: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create digest cache directory: %w", err)
+	}
+
+	// Write through a temporary file, so that concurrent renders never read a partial cache
+	tmp, err := os.CreateTemp(filepath.Dir(r.Path), ".digests-*")
+	if err != nil {
+		return fmt.Errorf("failed to write digest cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write digest cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write digest cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.Path); err != nil {
+		return fmt.Errorf("failed to write digest cache: %w", err)
+	}
+	r.dirty = false
+	return nil
+}
+
+// DefaultCachePath returns the digest cache file in the Helm cache directory, following Helm's
+// lookup of HELM_CACHE_HOME
+func DefaultCachePath() string {
+	home := os.Getenv("HELM_CACHE_HOME")
+	if home == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return CacheFileName
+		}
+		home = filepath.Join(dir, "helm")
+	}
+	return filepath.Join(home, CacheFileName)
+}
@@ -0,0 +1,121 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installFakeCrane puts a fake crane first in PATH that prints output and exits with exitCode
+func installFakeCrane(t *testing.T, output string, exitCode int) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '" + output + "'\nexit " + string(rune('0'+exitCode)) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "crane"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake crane: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		exitCode      int
+		want          string
+		wantErrSubstr string
+	}{
+		{name: "digest", output: "sha256:abc", want: "sha256:abc"},
+		{name: "crane fails", output: "MANIFEST_UNKNOWN", exitCode: 1, wantErrSubstr: "failed to resolve the digest of nginx:1.25"},
+		{name: "unexpected output", output: "latest", wantErrSubstr: `unexpected crane output "latest"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeCrane(t, tt.output, tt.exitCode)
+			got, err := Resolve(context.Background(), "nginx:1.25")
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("Resolve() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v, want nil", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", CacheFileName)
+	resolved := 0
+	resolve := func(_ context.Context, image string) (string, error) {
+		resolved++
+		if image == "missing:1" {
+			return "", errors.New("not found")
+		}
+		return "sha256:" + image, nil
+	}
+
+	r, err := NewResolver(path, false)
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v, want nil", err)
+	}
+	r.resolve = resolve
+	for range 2 {
+		if got, err := r.Digest(context.Background(), "nginx"); err != nil || got != "sha256:nginx" {
+			t.Errorf("Digest() = %q, %v, want sha256:nginx", got, err)
+		}
+	}
+	if resolved != 1 {
+		t.Errorf("Resolved %d times, want the second lookup from the cache", resolved)
+	}
+	if _, err := r.Digest(context.Background(), "missing:1"); err == nil {
+		t.Errorf("Digest() error = nil, want the resolution error")
+	}
+	if err := r.Save(); err != nil {
+		t.Fatalf("Save() error = %v, want nil", err)
+	}
+
+	// A new resolver reads the cache, and offline mode only uses it
+	offline, err := NewResolver(path, true)
+	if err != nil {
+		t.Fatalf("NewResolver() error = %v, want nil", err)
+	}
+	offline.resolve = resolve
+	if got, err := offline.Digest(context.Background(), "nginx"); err != nil || got != "sha256:nginx" {
+		t.Errorf("Digest() from cache = %q, %v, want sha256:nginx", got, err)
+	}
+	_, err = offline.Digest(context.Background(), "redis")
+	if err == nil || !strings.Contains(err.Error(), "image redis is not in the digest cache") {
+		t.Errorf("Digest() error = %v, want error containing %q", err, "image redis is not in the digest cache")
+	}
+	if resolved != 2 {
+		t.Errorf("Resolved %d times, want no lookup in offline mode", resolved)
+	}
+}
+
+func TestNewResolver_InvalidCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CacheFileName)
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Failed to write cache: %v", err)
+	}
+	_, err := NewResolver(path, false)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse digest cache") {
+		t.Errorf("NewResolver() error = %v, want error containing %q", err, "failed to parse digest cache")
+	}
+}
+
+func TestDefaultCachePath(t *testing.T) {
+	t.Setenv("HELM_CACHE_HOME", "/tmp/helm-cache")
+	if got, want := DefaultCachePath(), filepath.Join("/tmp/helm-cache", CacheFileName); got != want {
+		t.Errorf("DefaultCachePath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package errdefs
+
+import "errors"
+
+// Error categories, matched with errors.Is. Each category has its own exit code so that wrapper
+// scripts and CI gates can react without parsing stderr.
+var (
+	// ErrPluginData marks invalid KustomizePluginData content
+	ErrPluginData = errors.New("invalid plugin data")
+	// ErrBuild marks a failed kustomize build
+	ErrBuild = errors.New("kustomize build failed")
+	// ErrValidation marks rendered output failing validation
+	ErrValidation = errors.New("validation failed")
+	// ErrPolicy marks rendered output violating a policy
+	ErrPolicy = errors.New("policy violation")
+	// ErrInterrupted marks a render stopped by SIGINT or SIGTERM
+	ErrInterrupted = errors.New("interrupted")
+)
+
+// Exit codes returned by the CLI
+const (
+	ExitGeneric    = 1
+	ExitPluginData = 2
+	ExitBuild      = 3
+	ExitValidation = 4
+	ExitPolicy     = 5
+	// ExitInterrupted follows the shell convention of 128 + SIGINT
+	ExitInterrupted = 130
+)
+
+// categorized attaches a category to an error without changing its message
+type categorized struct {
+	category error
+	err      error
+}
+
+func (e *categorized) Error() string {
+	return e.err.Error()
+}
+
+func (e *categorized) Unwrap() []error {
+	return []error{e.err, e.category}
+}
+
+// Wrap marks err as belonging to category. It returns nil if err is nil.
+func Wrap(category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorized{category: category, err: err}
+}
+
+// ExitCode returns the exit code for err based on its category
+func ExitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrInterrupted):
+		return ExitInterrupted
+	case errors.Is(err, ErrPluginData):
+		return ExitPluginData
+	case errors.Is(err, ErrBuild):
+		return ExitBuild
+	case errors.Is(err, ErrValidation):
+		return ExitValidation
+	case errors.Is(err, ErrPolicy):
+		return ExitPolicy
+	default:
+		return ExitGeneric
+	}
+}
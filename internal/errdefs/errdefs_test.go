@@ -0,0 +1,48 @@
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	cause := errors.New("boom")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "uncategorized", err: cause, want: ExitGeneric},
+		{name: "plugin data", err: Wrap(ErrPluginData, cause), want: ExitPluginData},
+		{name: "build", err: Wrap(ErrBuild, cause), want: ExitBuild},
+		{name: "validation", err: Wrap(ErrValidation, cause), want: ExitValidation},
+		{name: "policy", err: Wrap(ErrPolicy, cause), want: ExitPolicy},
+		{name: "interrupted", err: Wrap(ErrInterrupted, Wrap(ErrBuild, cause)), want: ExitInterrupted},
+		{name: "wrapped further", err: fmt.Errorf("render: %w", Wrap(ErrBuild, cause)), want: ExitBuild},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	cause := errors.New("boom")
+	err := Wrap(ErrBuild, cause)
+
+	if err.Error() != "boom" {
+		t.Errorf("Error() = %q, want the message of the wrapped error", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Error("Wrapped error should match its cause")
+	}
+	if Wrap(ErrBuild, nil) != nil {
+		t.Error("Wrap(nil) should return nil")
+	}
+}
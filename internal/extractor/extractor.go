@@ -1,20 +1,34 @@
 package extractor
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 )
 
+// tempDirPrefix is the name prefix of the temporary directories created by NewTempDir
+const tempDirPrefix = "helm-kustomize-"
+
 // TempDir represents a temporary directory for kustomize files
 type TempDir struct {
 	Path string
 	root *os.Root
+	// linked are the files restored from a snapshot as hard links
+	linked map[string]bool
 }
 
 // NewTempDir creates a new temporary directory
 func NewTempDir() (*TempDir, error) {
-	path, err := os.MkdirTemp("", "helm-kustomize-*")
+	path, err := os.MkdirTemp("", tempDirPrefix+"*")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
@@ -44,9 +58,27 @@ func (t *TempDir) Cleanup() {
 	}
 }
 
-// ExtractFiles writes files from the files map to the temporary directory
+// ExtractFiles writes files from the files map to the temporary directory. Keys that name the
+// same file once cleaned, such as foo//bar.yaml and foo/bar.yaml, are refused rather than
+// letting one overwrite the other.
 func (t *TempDir) ExtractFiles(files map[string]string) error {
-	for filePath, content := range files {
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	cleaned := make(map[string]string, len(files))
+	for _, filePath := range paths {
+		clean := filepath.Clean(filePath)
+		if other, exists := cleaned[clean]; exists {
+			return fmt.Errorf("files %q and %q are the same file %s", other, filePath, clean)
+		}
+		cleaned[clean] = filePath
+	}
+
+	for _, filePath := range paths {
+		content := files[filePath]
 		if err := t.WriteFile(filePath, []byte(content)); err != nil {
 			return err
 		}
@@ -62,6 +94,9 @@ func (t *TempDir) WriteFile(filePath string, content []byte) error {
 	if err := t.root.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
+	if err := t.unlink(filePath); err != nil {
+		return err
+	}
 
 	// Write file content using root-constrained write
 	if err := t.root.WriteFile(filePath, content, 0644); err != nil {
@@ -71,6 +106,71 @@ func (t *TempDir) WriteFile(filePath string, content []byte) error {
 	return nil
 }
 
+// StreamFile creates a file in the temporary directory and lets write fill it through a buffered
+// writer, so large content does not need to be held in memory first
+func (t *TempDir) StreamFile(filePath string, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(filePath)
+	if err := t.root.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	if err := t.unlink(filePath); err != nil {
+		return err
+	}
+
+	file, err := t.root.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", filePath, err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to close file %s: %w", filePath, closeErr))
+		}
+	}()
+
+	w := bufio.NewWriter(file)
+	if err := write(w); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filePath, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// Chmod sets the permission bits of a file in the temporary directory. A file restored from a
+// snapshot is copied first, so that the snapshot keeps its mode.
+func (t *TempDir) Chmod(filePath string, mode fs.FileMode) error {
+	if t.linked[filepath.Clean(filePath)] {
+		content, err := t.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if err := t.WriteFile(filePath, content); err != nil {
+			return err
+		}
+	}
+	if err := t.root.Chmod(filePath, mode.Perm()); err != nil {
+		return fmt.Errorf("failed to set the mode of %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// unlink removes filePath before it is written if it was restored from a snapshot, as it is then
+// a hard link to the snapshot that must not be written through
+func (t *TempDir) unlink(filePath string) error {
+	clean := filepath.Clean(filePath)
+	if !t.linked[clean] {
+		return nil
+	}
+	if err := t.root.Remove(clean); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to replace file %s: %w", filePath, err)
+	}
+	delete(t.linked, clean)
+	return nil
+}
+
 // ReadFile reads a file from the temporary directory
 func (t *TempDir) ReadFile(filePath string) ([]byte, error) {
 	// Read file content using root-constrained read
@@ -81,3 +181,75 @@ func (t *TempDir) ReadFile(filePath string) ([]byte, error) {
 
 	return content, nil
 }
+
+// StaleDir is a temporary directory left behind by an earlier run
+type StaleDir struct {
+	Path    string
+	ModTime time.Time
+	// Size is the total size of the files in the directory
+	Size int64
+}
+
+// FindStale lists the temporary directories of earlier runs, e.g. killed processes, that were last
+// modified more than maxAge ago, oldest first. Directories that cannot be read are skipped. When ctx
+// is done, it returns the directories found so far with the error of ctx.
+func FindStale(ctx context.Context, maxAge time.Duration) ([]StaleDir, error) {
+	entries, err := os.ReadDir(os.TempDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temp directory: %w", err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	var stale []StaleDir
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return stale, err
+		}
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempDirPrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		dir := StaleDir{Path: filepath.Join(os.TempDir(), entry.Name()), ModTime: info.ModTime()}
+		// Unreadable parts only make the size an underestimate
+		_ = filepath.WalkDir(dir.Path, func(_ string, d fs.DirEntry, err error) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err == nil && d.Type().IsRegular() {
+				if info, err := d.Info(); err == nil {
+					dir.Size += info.Size()
+				}
+			}
+			return nil
+		})
+		stale = append(stale, dir)
+	}
+
+	slices.SortFunc(stale, func(a, b StaleDir) int {
+		return a.ModTime.Compare(b.ModTime)
+	})
+	return stale, ctx.Err()
+}
+
+// RemoveStale removes temporary directories left behind by earlier runs that were last modified
+// more than maxAge ago. It is best-effort: directories that cannot be removed are skipped. It
+// returns the number of directories removed.
+func RemoveStale(maxAge time.Duration) int {
+	stale, err := FindStale(context.Background(), maxAge)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, dir := range stale {
+		if err := os.RemoveAll(dir.Path); err == nil {
+			removed++
+		}
+	}
+	return removed
+}
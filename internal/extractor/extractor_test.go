@@ -1,9 +1,14 @@
 package extractor
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewTempDir(t *testing.T) {
@@ -56,6 +61,8 @@ func TestTempDir_ExtractFiles(t *testing.T) {
 		"kustomization.yaml":       "resources:\n- all.yaml\n",
 		"patches/deployment.yaml":  "apiVersion: apps/v1\nkind: Deployment\n",
 		"overlays/prod/patch.yaml": "spec:\n  replicas: 3\n",
+		// Binary content is written byte for byte
+		"functions/krm.tar": "\x00\x01\xff\r\n",
 	}
 
 	err = tempDir.ExtractFiles(files)
@@ -103,6 +110,50 @@ func TestTempDir_ExtractFiles_InvalidPath(t *testing.T) {
 	}
 }
 
+func TestTempDir_ExtractFiles_DuplicatePaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		wantErrSubstr string
+	}{
+		{
+			name:          "double slash",
+			files:         map[string]string{"foo//bar.yaml": "a", "foo/bar.yaml": "b"},
+			wantErrSubstr: `files "foo//bar.yaml" and "foo/bar.yaml" are the same file foo/bar.yaml`,
+		},
+		{
+			name:          "dot segment",
+			files:         map[string]string{"./kustomization.yaml": "a", "kustomization.yaml": "b"},
+			wantErrSubstr: `files "./kustomization.yaml" and "kustomization.yaml" are the same file kustomization.yaml`,
+		},
+		{
+			name:          "parent segment",
+			files:         map[string]string{"patches/../patch.yaml": "a", "patch.yaml": "b"},
+			wantErrSubstr: `files "patch.yaml" and "patches/../patch.yaml" are the same file patch.yaml`,
+		},
+		{
+			name:          "trailing slash",
+			files:         map[string]string{"foo/bar.yaml/": "a", "foo/bar.yaml": "b"},
+			wantErrSubstr: `files "foo/bar.yaml" and "foo/bar.yaml/" are the same file foo/bar.yaml`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, err := NewTempDir()
+			if err != nil {
+				t.Fatalf("NewTempDir() error = %v", err)
+			}
+			defer tempDir.Cleanup()
+
+			err = tempDir.ExtractFiles(tt.files)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("ExtractFiles() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
 func TestTempDir_WriteFile(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -191,6 +242,93 @@ func TestTempDir_WriteFile(t *testing.T) {
 	}
 }
 
+func TestTempDir_StreamFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		write         func(w io.Writer) error
+		want          string
+		wantErrSubstr string
+	}{
+		{
+			name: "nested path",
+			path: "overlays/prod/all.yaml",
+			write: func(w io.Writer) error {
+				_, err := io.WriteString(w, "a: 1\n")
+				return err
+			},
+			want: "a: 1\n",
+		},
+		{
+			name:          "parent directory traversal",
+			path:          "../all.yaml",
+			write:         func(w io.Writer) error { return nil },
+			wantErrSubstr: "failed to create",
+		},
+		{
+			name:          "write error",
+			path:          "all.yaml",
+			write:         func(w io.Writer) error { return errors.New("boom") },
+			wantErrSubstr: "failed to write file all.yaml: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir, err := NewTempDir()
+			if err != nil {
+				t.Fatalf("NewTempDir() error = %v", err)
+			}
+			defer tempDir.Cleanup()
+
+			err = tempDir.StreamFile(tt.path, tt.write)
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("StreamFile() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StreamFile() error = %v, want nil", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(tempDir.Path, tt.path))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("File content = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestTempDir_Chmod(t *testing.T) {
+	tempDir, err := NewTempDir()
+	if err != nil {
+		t.Fatalf("NewTempDir() error = %v, want nil", err)
+	}
+	defer tempDir.Cleanup()
+	if err := tempDir.WriteFile("bin/generate.sh", []byte("#!/bin/sh\n")); err != nil {
+		t.Fatalf("WriteFile() error = %v, want nil", err)
+	}
+
+	if err := tempDir.Chmod("bin/generate.sh", 0755); err != nil {
+		t.Fatalf("Chmod() error = %v, want nil", err)
+	}
+	info, err := os.Stat(filepath.Join(tempDir.Path, "bin", "generate.sh"))
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("file mode = %v, want %v", info.Mode().Perm(), os.FileMode(0755))
+	}
+
+	if err := tempDir.Chmod("missing.sh", 0755); err == nil {
+		t.Error("Chmod() of a missing file should fail")
+	}
+}
+
 func TestTempDir_ReadFile(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -425,3 +563,96 @@ func TestNewTempDir_MkdirTempFailure(t *testing.T) {
 		t.Error("NewTempDir() should fail when TMPDIR is read-only")
 	}
 }
+
+func TestRemoveStale(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	old := time.Now().Add(-48 * time.Hour)
+	dirs := map[string]time.Time{
+		"helm-kustomize-stale": old,
+		"helm-kustomize-fresh": time.Now(),
+		"other-stale":          old,
+	}
+	for name, modTime := range dirs {
+		path := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Join(path, "nested"), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set times of %s: %v", name, err)
+		}
+	}
+
+	if removed := RemoveStale(24 * time.Hour); removed != 1 {
+		t.Errorf("RemoveStale() = %d, want 1", removed)
+	}
+
+	for name, wantExists := range map[string]bool{
+		"helm-kustomize-stale": false,
+		"helm-kustomize-fresh": true,
+		"other-stale":          true,
+	} {
+		_, err := os.Stat(filepath.Join(tmp, name))
+		if exists := err == nil; exists != wantExists {
+			t.Errorf("%s exists = %v, want %v", name, exists, wantExists)
+		}
+	}
+}
+
+func BenchmarkTempDir_ExtractFiles(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		files := make(map[string]string, n)
+		for i := range n {
+			files[fmt.Sprintf("patches/dir-%d/patch-%d.yaml", i%10, i)] = strings.Repeat("# patch content\n", 64)
+		}
+
+		b.Run(fmt.Sprintf("files=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				tempDir, err := NewTempDir()
+				if err != nil {
+					b.Fatalf("NewTempDir() error = %v", err)
+				}
+				if err := tempDir.ExtractFiles(files); err != nil {
+					b.Fatalf("ExtractFiles() error = %v", err)
+				}
+				tempDir.Cleanup()
+			}
+		})
+	}
+}
+
+func FuzzTempDir_ExtractFiles(f *testing.F) {
+	f.Add("kustomization.yaml", "resources: [all.yaml]\n")
+	f.Add("patches/../patch.yaml", "")
+	f.Add("../escape.yaml", "")
+	f.Add("/etc/passwd", "")
+	f.Add("a//b/./c.yaml", "x")
+	f.Add(".", "")
+
+	// File names come from third-party charts: they may be refused, but never written outside
+	// the temporary directory
+	f.Fuzz(func(t *testing.T, name, content string) {
+		tempDir, err := NewTempDir()
+		if err != nil {
+			t.Fatalf("NewTempDir() error = %v", err)
+		}
+		defer tempDir.Cleanup()
+
+		if err := tempDir.ExtractFiles(map[string]string{name: content}); err != nil {
+			return
+		}
+		target := filepath.Join(tempDir.Path, name)
+		if !strings.HasPrefix(target, tempDir.Path+string(filepath.Separator)) {
+			t.Fatalf("ExtractFiles() wrote %q outside of %s", name, tempDir.Path)
+		}
+		got, err := tempDir.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile(%q) error = %v, want nil", name, err)
+		}
+		if string(got) != content {
+			t.Errorf("ReadFile(%q) = %q, want %q", name, got, content)
+		}
+	})
+}
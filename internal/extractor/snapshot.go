@@ -0,0 +1,135 @@
+package extractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// SnapshotKey identifies the content of a files map, so that a snapshot of its extraction is only
+// restored for the same files
+func SnapshotKey(files map[string]string) string {
+	h := sha256.New()
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		// Lengths keep the boundaries between paths and contents unambiguous
+		fmt.Fprintf(h, "%d:%s%d:", len(path), path, len(files[path]))
+		io.WriteString(h, files[path])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Snapshot saves the files of the temporary directory to dir, so that later renders of the same
+// files map can restore them with RestoreFrom instead of extracting every file again. Files are
+// hard linked where possible and copied otherwise. The snapshot is assembled under a temporary
+// name and renamed into place, so it is either complete or missing; an existing one is kept.
+func (t *TempDir) Snapshot(dir string) error {
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory %s: %w", parent, err)
+	}
+	tmp, err := os.MkdirTemp(parent, filepath.Base(dir)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	linked, err := linkTree(t.Path, tmp)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot %s: %w", t.Path, err)
+	}
+	t.markLinked(linked)
+
+	if err := os.Rename(tmp, dir); err != nil {
+		// Another render saved the same files first
+		if _, statErr := os.Stat(dir); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("failed to save snapshot %s: %w", dir, err)
+	}
+	return nil
+}
+
+// RestoreFrom fills the temporary directory with the files of a snapshot made by Snapshot. It
+// returns an error wrapping fs.ErrNotExist if there is no snapshot in dir.
+func (t *TempDir) RestoreFrom(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+	linked, err := linkTree(dir, t.Path)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot %s: %w", dir, err)
+	}
+	t.markLinked(linked)
+	return nil
+}
+
+// markLinked records files that are hard links shared with a snapshot
+func (t *TempDir) markLinked(paths []string) {
+	if t.linked == nil {
+		t.linked = make(map[string]bool, len(paths))
+	}
+	for _, path := range paths {
+		t.linked[path] = true
+	}
+}
+
+// linkTree recreates the directories and regular files of from in to, hard linking the files or
+// copying them where links are not possible, e.g. across file systems. Other entries, such as
+// symbolic links, are skipped. It returns the paths of the linked files, relative to to.
+func linkTree(from, to string) ([]string, error) {
+	var linked []string
+	err := filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case !d.Type().IsRegular():
+			return nil
+		}
+
+		if err := os.Link(path, target); err == nil {
+			linked = append(linked, rel)
+			return nil
+		} else if errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		return copyFile(path, target)
+	})
+	return linked, err
+}
+
+// copyFile copies the regular file from to the new file to
+func copyFile(from, to string) (err error) {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := dst.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
@@ -0,0 +1,158 @@
+package extractor
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotKey(t *testing.T) {
+	files := map[string]string{"kustomization.yaml": "resources:\n- all.yaml\n", "patches/web.yaml": "kind: Deployment\n"}
+
+	tests := []struct {
+		name  string
+		other map[string]string
+		same  bool
+	}{
+		{
+			name:  "same files",
+			other: map[string]string{"patches/web.yaml": "kind: Deployment\n", "kustomization.yaml": "resources:\n- all.yaml\n"},
+			same:  true,
+		},
+		{
+			name:  "different content",
+			other: map[string]string{"kustomization.yaml": "resources:\n- all.yaml\n", "patches/web.yaml": "kind: StatefulSet\n"},
+		},
+		{
+			name:  "renamed file",
+			other: map[string]string{"kustomization.yaml": "resources:\n- all.yaml\n", "patches/api.yaml": "kind: Deployment\n"},
+		},
+		{
+			name:  "file left out",
+			other: map[string]string{"kustomization.yaml": "resources:\n- all.yaml\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SnapshotKey(tt.other) == SnapshotKey(files); got != tt.same {
+				t.Errorf("SnapshotKey() equal = %v, want %v", got, tt.same)
+			}
+		})
+	}
+
+	// Moving content between a path and its file does not collide
+	if SnapshotKey(map[string]string{"a": "bc"}) == SnapshotKey(map[string]string{"ab": "c"}) {
+		t.Error("SnapshotKey() is the same for different splits of path and content")
+	}
+}
+
+func TestTempDir_SnapshotAndRestore(t *testing.T) {
+	files := map[string]string{
+		"kustomization.yaml":  "resources:\n- all.yaml\n",
+		"overlays/prod/a.yml": "kind: ConfigMap\n",
+	}
+	snapshot := filepath.Join(t.TempDir(), "snapshots", SnapshotKey(files))
+
+	original, err := NewTempDir()
+	if err != nil {
+		t.Fatalf("NewTempDir() error = %v, want nil", err)
+	}
+	defer original.Cleanup()
+	if err := original.ExtractFiles(files); err != nil {
+		t.Fatalf("ExtractFiles() error = %v, want nil", err)
+	}
+	if err := original.Snapshot(snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v, want nil", err)
+	}
+	// Writing the workspace after the snapshot leaves the snapshot alone
+	if err := original.WriteFile("kustomization.yaml", []byte("changed by the first render\n")); err != nil {
+		t.Fatalf("WriteFile() error = %v, want nil", err)
+	}
+
+	restored, err := NewTempDir()
+	if err != nil {
+		t.Fatalf("NewTempDir() error = %v, want nil", err)
+	}
+	defer restored.Cleanup()
+	if err := restored.RestoreFrom(snapshot); err != nil {
+		t.Fatalf("RestoreFrom() error = %v, want nil", err)
+	}
+	for path, content := range files {
+		got, err := restored.ReadFile(path)
+		if err != nil {
+			t.Errorf("ReadFile(%q) error = %v, want nil", path, err)
+		} else if string(got) != content {
+			t.Errorf("ReadFile(%q) = %q, want %q", path, got, content)
+		}
+	}
+
+	// Changing the mode of a restored file leaves the snapshot alone
+	if err := restored.Chmod("kustomization.yaml", 0600); err != nil {
+		t.Fatalf("Chmod() error = %v, want nil", err)
+	}
+	if info, err := os.Stat(filepath.Join(snapshot, "kustomization.yaml")); err != nil {
+		t.Errorf("Failed to stat snapshot file: %v", err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Errorf("snapshot file mode = %v, want %v", info.Mode().Perm(), fs.FileMode(0644))
+	}
+
+	if err := restored.StreamFile("overlays/prod/a.yml", func(w io.Writer) error {
+		_, err := io.WriteString(w, "changed by the second render\n")
+		return err
+	}); err != nil {
+		t.Fatalf("StreamFile() error = %v, want nil", err)
+	}
+	for path, content := range files {
+		got, err := os.ReadFile(filepath.Join(snapshot, path))
+		if err != nil {
+			t.Errorf("Failed to read snapshot file %s: %v", path, err)
+		} else if string(got) != content {
+			t.Errorf("snapshot file %s = %q, want %q", path, got, content)
+		}
+	}
+}
+
+func TestTempDir_Snapshot_Existing(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "snapshot")
+	for _, content := range []string{"first\n", "second\n"} {
+		tempDir, err := NewTempDir()
+		if err != nil {
+			t.Fatalf("NewTempDir() error = %v, want nil", err)
+		}
+		defer tempDir.Cleanup()
+		if err := tempDir.WriteFile("file.yaml", []byte(content)); err != nil {
+			t.Fatalf("WriteFile() error = %v, want nil", err)
+		}
+		if err := tempDir.Snapshot(snapshot); err != nil {
+			t.Fatalf("Snapshot() error = %v, want nil", err)
+		}
+	}
+
+	got, err := os.ReadFile(filepath.Join(snapshot, "file.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if string(got) != "first\n" {
+		t.Errorf("snapshot file = %q, want the first snapshot kept", got)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(snapshot)); len(entries) != 1 {
+		t.Errorf("snapshot directory has %d entries, want the temporary copy removed", len(entries))
+	}
+}
+
+func TestTempDir_RestoreFrom_Missing(t *testing.T) {
+	tempDir, err := NewTempDir()
+	if err != nil {
+		t.Fatalf("NewTempDir() error = %v, want nil", err)
+	}
+	defer tempDir.Cleanup()
+
+	err = tempDir.RestoreFrom(filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("RestoreFrom() error = %v, want fs.ErrNotExist", err)
+	}
+}
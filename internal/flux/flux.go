@@ -0,0 +1,310 @@
+package flux
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// HelmRelease API of Flux
+const (
+	HelmReleaseGroup = "helm.toolkit.fluxcd.io"
+	HelmReleaseKind  = "HelmRelease"
+	// HelmReleaseAPIVersion is the apiVersion of generated HelmReleases
+	HelmReleaseAPIVersion = HelmReleaseGroup + "/v2"
+)
+
+// IsHelmRelease reports whether a resource is a Flux HelmRelease
+func IsHelmRelease(resource map[string]any) bool {
+	apiVersion, _ := resource["apiVersion"].(string)
+	return resource["kind"] == HelmReleaseKind && strings.HasPrefix(apiVersion, HelmReleaseGroup+"/")
+}
+
+// helmRelease is the part of a HelmRelease holding the post-renderers
+type helmRelease struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Metadata   metadata `yaml:"metadata"`
+	Spec       struct {
+		PostRenderers []postRenderer `yaml:"postRenderers"`
+	} `yaml:"spec"`
+}
+
+type metadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type postRenderer struct {
+	Kustomize kustomization `yaml:"kustomize"`
+}
+
+// kustomization holds the kustomization fields both Flux post-renderers and kustomization.yaml support
+type kustomization struct {
+	Resources []string         `yaml:"resources,omitempty"`
+	Patches   []map[string]any `yaml:"patches,omitempty"`
+	Images    []map[string]any `yaml:"images,omitempty"`
+}
+
+// ToPluginData converts the kustomize post-renderers of a HelmRelease to a KustomizePluginData
+// document named name. Post-renderers are merged in order, so later image overrides win.
+// The deprecated patchesStrategicMerge and patchesJson6902 fields are converted to patches.
+func ToPluginData(release map[string]any, name string) ([]byte, error) {
+	meta, _ := release["metadata"].(map[string]any)
+	releaseName, _ := meta["name"].(string)
+	spec, _ := release["spec"].(map[string]any)
+	renderers, _ := spec["postRenderers"].([]any)
+
+	merged := kustomization{Resources: []string{"all.yaml"}}
+	found := false
+	for i, raw := range renderers {
+		renderer, _ := raw.(map[string]any)
+		fields, ok := renderer["kustomize"].(map[string]any)
+		if !ok {
+			continue
+		}
+		found = true
+		if err := merged.add(fields); err != nil {
+			return nil, fmt.Errorf("postRenderers[%d]: %w", i, err)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("HelmRelease %s has no kustomize post-renderers", releaseName)
+	}
+
+	content, err := manifest.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, _ := meta["namespace"].(string)
+	return parser.EncodePluginData(name, namespace, map[string]string{"kustomization.yaml": string(content)})
+}
+
+// add merges the fields of a Flux kustomize post-renderer
+func (k *kustomization) add(fields map[string]any) error {
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		value := fields[key]
+		switch key {
+		case "patches":
+			patches, err := mapList(value, key)
+			if err != nil {
+				return err
+			}
+			k.Patches = append(k.Patches, patches...)
+		case "patchesStrategicMerge":
+			list, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("patchesStrategicMerge must be a list")
+			}
+			for _, patch := range list {
+				content, err := manifest.Marshal(patch)
+				if err != nil {
+					return err
+				}
+				k.Patches = append(k.Patches, map[string]any{"patch": string(content)})
+			}
+		case "patchesJson6902":
+			patches, err := mapList(value, key)
+			if err != nil {
+				return err
+			}
+			for _, patch := range patches {
+				content, err := manifest.Marshal(patch["patch"])
+				if err != nil {
+					return err
+				}
+				k.Patches = append(k.Patches, map[string]any{"target": patch["target"], "patch": string(content)})
+			}
+		case "images":
+			images, err := mapList(value, key)
+			if err != nil {
+				return err
+			}
+			for _, image := range images {
+				k.setImage(image)
+			}
+		default:
+			return fmt.Errorf("unsupported kustomize field %q", key)
+		}
+	}
+	return nil
+}
+
+// setImage adds an image override, replacing an earlier one for the same image
+func (k *kustomization) setImage(image map[string]any) {
+	for i, existing := range k.Images {
+		if existing["name"] == image["name"] {
+			k.Images[i] = image
+			return
+		}
+	}
+	k.Images = append(k.Images, image)
+}
+
+// FromPluginData converts the kustomization in dir of a KustomizePluginData document to the
+// spec.postRenderers of a HelmRelease named name. Patch files are inlined. Fields that Flux
+// post-renderers cannot express, such as namePrefix or additional resources, are reported as
+// errors rather than dropped.
+func FromPluginData(data *parser.KustomizePluginData, dir, name, namespace string) ([]byte, error) {
+	if data.Labels != nil {
+		return nil, fmt.Errorf("labels cannot be expressed in a Flux post-renderer")
+	}
+	if len(data.KyvernoPolicies) > 0 {
+		return nil, fmt.Errorf("kyvernoPolicies cannot be expressed in a Flux post-renderer")
+	}
+	if len(data.IncludeKinds) > 0 || len(data.ExcludeKinds) > 0 || data.Exclude != nil {
+		return nil, fmt.Errorf("includeKinds, excludeKinds and exclude cannot be expressed in a Flux post-renderer")
+	}
+	if data.Generated != nil {
+		return nil, fmt.Errorf("generated cannot be expressed in a Flux post-renderer")
+	}
+	if data.Inject != nil {
+		return nil, fmt.Errorf("inject cannot be expressed in a Flux post-renderer")
+	}
+	if data.ResourceDefaults != nil {
+		return nil, fmt.Errorf("resourceDefaults cannot be expressed in a Flux post-renderer")
+	}
+	if data.Scheduling != nil {
+		return nil, fmt.Errorf("scheduling cannot be expressed in a Flux post-renderer")
+	}
+	if data.Hardening != nil {
+		return nil, fmt.Errorf("hardening cannot be expressed in a Flux post-renderer")
+	}
+	if data.PodClasses != nil {
+		return nil, fmt.Errorf("podClasses cannot be expressed in a Flux post-renderer")
+	}
+	if len(data.Hooks) > 0 {
+		return nil, fmt.Errorf("hooks cannot be expressed in a Flux post-renderer")
+	}
+
+	kustomizationPath := path.Join(dir, "kustomization.yaml")
+	content, ok := data.Files[kustomizationPath]
+	if !ok {
+		return nil, fmt.Errorf("files do not contain %s", kustomizationPath)
+	}
+	kust, err := kustomize.ParseKustomization([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var converted kustomization
+	var unsupported []string
+	for _, key := range slices.Sorted(maps.Keys(kust.RawContent)) {
+		value := kust.RawContent[key]
+		switch key {
+		case "apiVersion", "kind":
+		case "resources":
+			for _, resource := range kust.Resources {
+				if resource != "all.yaml" {
+					unsupported = append(unsupported, fmt.Sprintf("resources (%s)", resource))
+				}
+			}
+		case "patches":
+			patches, err := mapList(value, key)
+			if err != nil {
+				return nil, err
+			}
+			for i, patch := range patches {
+				if err := inlinePatch(patch, data.Files, dir); err != nil {
+					return nil, fmt.Errorf("patches[%d]: %w", i, err)
+				}
+				converted.Patches = append(converted.Patches, patch)
+			}
+		case "patchesStrategicMerge":
+			list, ok := value.([]any)
+			if !ok {
+				return nil, fmt.Errorf("patchesStrategicMerge must be a list")
+			}
+			for i, raw := range list {
+				patch := map[string]any{"path": raw}
+				if s, _ := raw.(string); strings.Contains(s, "\n") {
+					patch = map[string]any{"patch": s}
+				}
+				if err := inlinePatch(patch, data.Files, dir); err != nil {
+					return nil, fmt.Errorf("patchesStrategicMerge[%d]: %w", i, err)
+				}
+				converted.Patches = append(converted.Patches, patch)
+			}
+		case "patchesJson6902":
+			patches, err := mapList(value, key)
+			if err != nil {
+				return nil, err
+			}
+			for i, patch := range patches {
+				if err := inlinePatch(patch, data.Files, dir); err != nil {
+					return nil, fmt.Errorf("patchesJson6902[%d]: %w", i, err)
+				}
+				converted.Patches = append(converted.Patches, patch)
+			}
+		case "images":
+			images, err := mapList(value, key)
+			if err != nil {
+				return nil, err
+			}
+			converted.Images = images
+		default:
+			unsupported = append(unsupported, key)
+		}
+	}
+	if len(unsupported) > 0 {
+		return nil, fmt.Errorf("%s uses fields Flux post-renderers do not support: %s", kustomizationPath, strings.Join(unsupported, ", "))
+	}
+
+	var release helmRelease
+	release.APIVersion = HelmReleaseAPIVersion
+	release.Kind = HelmReleaseKind
+	release.Metadata = metadata{Name: name, Namespace: namespace}
+	release.Spec.PostRenderers = []postRenderer{{Kustomize: converted}}
+	return manifest.Marshal(release)
+}
+
+// inlinePatch replaces the path of a patch with the content of the file from the files map
+func inlinePatch(patch map[string]any, files map[string]string, dir string) error {
+	for key := range patch {
+		switch key {
+		case "patch", "path", "target":
+		default:
+			return fmt.Errorf("unsupported patch field %q", key)
+		}
+	}
+
+	raw, ok := patch["path"]
+	if !ok {
+		return nil
+	}
+	file, ok := raw.(string)
+	if !ok {
+		return fmt.Errorf("path must be a string")
+	}
+	content, ok := files[path.Join(dir, file)]
+	if !ok {
+		return fmt.Errorf("patch file %s is not in the files map", path.Join(dir, file))
+	}
+	delete(patch, "path")
+	patch["patch"] = content
+	return nil
+}
+
+// mapList converts a list of maps
+func mapList(value any, field string) ([]map[string]any, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list", field)
+	}
+	maps := make([]map[string]any, 0, len(list))
+	for i, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s[%d] must be a map", field, i)
+		}
+		maps = append(maps, m)
+	}
+	return maps, nil
+}
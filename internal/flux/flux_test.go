@@ -0,0 +1,315 @@
+package flux
+
+import (
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+
+	"github.com/owhelm/helm-kustomize/internal/hooks"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+)
+
+func decode(t *testing.T, doc string) map[string]any {
+	t.Helper()
+	var resource map[string]any
+	if err := yaml.Unmarshal([]byte(doc), &resource); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	return resource
+}
+
+func TestToPluginData(t *testing.T) {
+	release := decode(t, `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: web
+  namespace: apps
+spec:
+  postRenderers:
+  - kustomize:
+      patches:
+      - target:
+          kind: Deployment
+        patch: |
+          - op: add
+            path: /spec/replicas
+            value: 3
+      images:
+      - name: nginx
+        newTag: "1.25"
+  - kustomize:
+      patchesStrategicMerge:
+      - apiVersion: v1
+        kind: ConfigMap
+        metadata:
+          name: settings
+        data:
+          mode: prod
+      images:
+      - name: nginx
+        newTag: "1.26"
+`)
+
+	got, err := ToPluginData(release, "web-kustomize")
+	if err != nil {
+		t.Fatalf("ToPluginData() error = %v, want nil", err)
+	}
+
+	want := `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+metadata:
+  name: web-kustomize
+  namespace: apps
+files:
+  kustomization.yaml: |
+    resources:
+    - all.yaml
+    patches:
+    - patch: |
+        - op: add
+          path: /spec/replicas
+          value: 3
+      target:
+        kind: Deployment
+    - patch: |
+        apiVersion: v1
+        data:
+          mode: prod
+        kind: ConfigMap
+        metadata:
+          name: settings
+    images:
+    - name: nginx
+      newTag: "1.26"
+`
+	if string(got) != want {
+		t.Errorf("ToPluginData() =\n%s\nwant:\n%s", got, want)
+	}
+
+	// The result is a valid KustomizePluginData document
+	result, err := parser.ParseManifests(got)
+	if err != nil || result.KustomizePluginData == nil {
+		t.Fatalf("ParseManifests() = %v, %v, want KustomizePluginData", result, err)
+	}
+}
+
+func TestToPluginData_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no kustomize post-renderers",
+			spec:          "chart: {}\n",
+			wantErrSubstr: "HelmRelease web has no kustomize post-renderers",
+		},
+		{
+			name:          "unsupported field",
+			spec:          "postRenderers:\n- kustomize:\n    namePrefix: x-\n",
+			wantErrSubstr: `postRenderers[0]: unsupported kustomize field "namePrefix"`,
+		},
+		{
+			name:          "patches not a list",
+			spec:          "postRenderers:\n- kustomize:\n    patches: {}\n",
+			wantErrSubstr: "patches must be a list",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := decode(t, "apiVersion: helm.toolkit.fluxcd.io/v2\nkind: HelmRelease\nmetadata:\n  name: web\n")
+			release["spec"] = decode(t, tt.spec)
+			_, err := ToPluginData(release, "web")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("ToPluginData() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestFromPluginData(t *testing.T) {
+	data := &parser.KustomizePluginData{
+		Files: map[string]string{
+			"kustomization.yaml": `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- all.yaml
+patches:
+- path: patches/replicas.yaml
+  target:
+    kind: Deployment
+- patch: |
+    - op: remove
+      path: /spec/template/spec/securityContext
+patchesStrategicMerge:
+- settings.yaml
+images:
+- name: nginx
+  newTag: "1.25"
+`,
+			"patches/replicas.yaml": "- op: add\n  path: /spec/replicas\n  value: 3\n",
+			"settings.yaml":         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+		},
+	}
+
+	got, err := FromPluginData(data, ".", "web", "apps")
+	if err != nil {
+		t.Fatalf("FromPluginData() error = %v, want nil", err)
+	}
+
+	want := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: web
+  namespace: apps
+spec:
+  postRenderers:
+  - kustomize:
+      patches:
+      - patch: |
+          - op: add
+            path: /spec/replicas
+            value: 3
+        target:
+          kind: Deployment
+      - patch: |
+          - op: remove
+            path: /spec/template/spec/securityContext
+      - patch: |
+          apiVersion: v1
+          kind: ConfigMap
+          metadata:
+            name: settings
+      images:
+      - name: nginx
+        newTag: "1.25"
+`
+	if string(got) != want {
+		t.Errorf("FromPluginData() =\n%s\nwant:\n%s", got, want)
+	}
+
+	// Converting back yields the same patches and images
+	back, err := ToPluginData(decode(t, string(got)), "web")
+	if err != nil {
+		t.Fatalf("ToPluginData() error = %v, want nil", err)
+	}
+	if !strings.Contains(string(back), "path: /spec/template/spec/securityContext") || !strings.Contains(string(back), "newTag: \"1.25\"") {
+		t.Errorf("ToPluginData() round trip lost patches or images:\n%s", back)
+	}
+}
+
+func TestFromPluginData_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          parser.KustomizePluginData
+		dir           string
+		wantErrSubstr string
+	}{
+		{
+			name:          "missing kustomization",
+			data:          parser.KustomizePluginData{Files: map[string]string{}},
+			dir:           "overlays/prod",
+			wantErrSubstr: "files do not contain overlays/prod/kustomization.yaml",
+		},
+		{
+			name: "unsupported fields",
+			data: parser.KustomizePluginData{Files: map[string]string{
+				"kustomization.yaml": "resources:\n- all.yaml\n- extra.yaml\nnamePrefix: x-\n",
+			}},
+			wantErrSubstr: "fields Flux post-renderers do not support: namePrefix, resources (extra.yaml)",
+		},
+		{
+			name: "missing patch file",
+			data: parser.KustomizePluginData{Files: map[string]string{
+				"kustomization.yaml": "patches:\n- path: missing.yaml\n",
+			}},
+			wantErrSubstr: "patches[0]: patch file missing.yaml is not in the files map",
+		},
+		{
+			name: "patch options",
+			data: parser.KustomizePluginData{Files: map[string]string{
+				"kustomization.yaml": "patches:\n- patch: x\n  options:\n    allowNameChange: true\n",
+			}},
+			wantErrSubstr: `unsupported patch field "options"`,
+		},
+		{
+			name: "labels",
+			data: parser.KustomizePluginData{
+				Files:  map[string]string{"kustomization.yaml": ""},
+				Labels: &parser.Labels{Pairs: map[string]string{"team": "web"}},
+			},
+			wantErrSubstr: "labels cannot be expressed",
+		},
+		{
+			name: "kind filters",
+			data: parser.KustomizePluginData{
+				Files:        map[string]string{"kustomization.yaml": ""},
+				ExcludeKinds: []string{"Job"},
+			},
+			wantErrSubstr: "includeKinds, excludeKinds and exclude cannot be expressed",
+		},
+		{
+			name: "hooks",
+			data: parser.KustomizePluginData{
+				Files: map[string]string{"kustomization.yaml": ""},
+				Hooks: []hooks.Hook{{Command: "cost-annotator"}},
+			},
+			wantErrSubstr: "hooks cannot be expressed",
+		},
+		{
+			name: "inject",
+			data: parser.KustomizePluginData{
+				Files:  map[string]string{"kustomization.yaml": ""},
+				Inject: &parser.Inject{Containers: []map[string]any{{"name": "proxy"}}},
+			},
+			wantErrSubstr: "inject cannot be expressed",
+		},
+		{
+			name: "resource defaults",
+			data: parser.KustomizePluginData{
+				Files:            map[string]string{"kustomization.yaml": ""},
+				ResourceDefaults: &parser.ResourceDefaults{Requests: map[string]string{"cpu": "100m"}},
+			},
+			wantErrSubstr: "resourceDefaults cannot be expressed",
+		},
+		{
+			name: "scheduling",
+			data: parser.KustomizePluginData{
+				Files:      map[string]string{"kustomization.yaml": ""},
+				Scheduling: &parser.Scheduling{},
+			},
+			wantErrSubstr: "scheduling cannot be expressed",
+		},
+		{
+			name: "hardening",
+			data: parser.KustomizePluginData{
+				Files:     map[string]string{"kustomization.yaml": ""},
+				Hardening: &parser.Hardening{ReadOnlyRootFilesystem: true},
+			},
+			wantErrSubstr: "hardening cannot be expressed",
+		},
+		{
+			name: "pod classes",
+			data: parser.KustomizePluginData{
+				Files:      map[string]string{"kustomization.yaml": ""},
+				PodClasses: &parser.PodClasses{PriorityClassName: "high"},
+			},
+			wantErrSubstr: "podClasses cannot be expressed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tt.dir
+			if dir == "" {
+				dir = "."
+			}
+			_, err := FromPluginData(&tt.data, dir, "web", "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("FromPluginData() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
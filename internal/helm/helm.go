@@ -0,0 +1,152 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+// VersionEnvVar overrides Helm version detection, e.g. in environments where running helm is undesirable
+const VersionEnvVar = "HELM_KUSTOMIZE_HELM_VERSION"
+
+// PluginName is the name of the plugin in plugin.yaml, which Helm v4 expects as --post-renderer
+const PluginName = "helm-kustomize"
+
+// probeTimeout bounds how long we wait for `helm version` before giving up on detection
+const probeTimeout = 5 * time.Second
+
+// VersionCacheFileName is the file in the Helm cache directory keeping the version found by CachedVersion
+const VersionCacheFileName = "helm-kustomize-helm-version"
+
+// Binary returns the Helm binary to invoke. Helm sets HELM_BIN for plugins; otherwise helm from PATH is used.
+func Binary() string {
+	if bin := os.Getenv("HELM_BIN"); bin != "" {
+		return bin
+	}
+	return "helm"
+}
+
+// DetectVersion returns the version of the invoking Helm, taken from HELM_KUSTOMIZE_HELM_VERSION
+// if set or from running `helm version` otherwise
+func DetectVersion() (version.Semver, error) {
+	raw := os.Getenv(VersionEnvVar)
+	if raw == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, Binary(), "version", "--template", "{{.Version}}")
+		output, err := cmd.Output()
+		if err != nil {
+			return version.Semver{}, fmt.Errorf("helm version failed: %w", err)
+		}
+		raw = strings.TrimSpace(string(output))
+	}
+
+	v, err := version.Parse(raw)
+	if err != nil {
+		return version.Semver{}, fmt.Errorf("failed to parse Helm version: %w", err)
+	}
+	return v, nil
+}
+
+// CachedVersion returns the version of the invoking Helm like DetectVersion, but only runs
+// `helm version` when the Helm binary changed since the version was last cached, so that each
+// render does not pay for the probe
+func CachedVersion() (version.Semver, error) {
+	if os.Getenv(VersionEnvVar) != "" {
+		return DetectVersion()
+	}
+	path, err := exec.LookPath(Binary())
+	if err != nil {
+		return version.Semver{}, fmt.Errorf("helm version failed: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return version.Semver{}, fmt.Errorf("helm version failed: %w", err)
+	}
+	stamp := fmt.Sprintf("%s %d %d", path, info.Size(), info.ModTime().UnixNano())
+
+	cachePath := versionCachePath()
+	if data, err := os.ReadFile(cachePath); err == nil {
+		if cached, raw, ok := strings.Cut(strings.TrimSpace(string(data)), "\n"); ok && cached == stamp {
+			if v, err := version.Parse(raw); err == nil {
+				return v, nil
+			}
+		}
+	}
+
+	v, err := DetectVersion()
+	if err != nil {
+		return version.Semver{}, err
+	}
+	// Failing to write the cache only costs the probe on the next run
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		_ = os.WriteFile(cachePath, []byte(stamp+"\n"+v.String()+"\n"), 0644)
+	}
+	return v, nil
+}
+
+// versionCachePath returns the version cache file in the Helm cache directory, following Helm's
+// lookup of HELM_CACHE_HOME
+func versionCachePath() string {
+	home := os.Getenv("HELM_CACHE_HOME")
+	if home == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return filepath.Join(os.TempDir(), VersionCacheFileName)
+		}
+		home = filepath.Join(dir, "helm")
+	}
+	return filepath.Join(home, VersionCacheFileName)
+}
+
+// CompatibilityWarnings returns warnings about known problems when running under the given Helm version
+func CompatibilityWarnings(v version.Semver) []string {
+	var warnings []string
+
+	switch {
+	case v.Major < 3 || (v.Major == 3 && v.Minor < 1):
+		warnings = append(warnings, fmt.Sprintf("Helm %s does not support post-renderers (requires >= 3.1.0)", v))
+	case v.Major == 3 && v.Minor < 10:
+		warnings = append(warnings, fmt.Sprintf("Helm %s does not support --post-renderer-args (requires >= 3.10.0); helm-kustomize options can only be set through environment variables", v))
+	case v.Major > 4:
+		warnings = append(warnings, fmt.Sprintf("Helm %s has not been tested with helm-kustomize; supported versions are 3.x and 4.x", v))
+	}
+
+	return warnings
+}
+
+// PostRendererFlags returns the Helm flags registering helm-kustomize as the post-renderer.
+// Helm v4 only runs post-renderers installed as plugins, while Helm v3 runs the executable at
+// executable directly.
+func PostRendererFlags(v version.Semver, executable string) []string {
+	if v.Major >= 4 {
+		return []string{"--post-renderer", PluginName}
+	}
+	return []string{"--post-renderer", executable}
+}
+
+// GetManifest returns the manifest of the deployed release with `helm get manifest`, as it was
+// post-rendered when it was installed or upgraded. An empty namespace uses the one of the current
+// kubeconfig context.
+func GetManifest(ctx context.Context, release, namespace string) ([]byte, error) {
+	args := []string{"get", "manifest", release}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	cmd := exec.CommandContext(ctx, Binary(), args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the manifest of release %s: %w\nOutput: %s", release, err, stderr.String())
+	}
+	return output, nil
+}
@@ -0,0 +1,239 @@
+package helm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+// writeFakeHelm creates a fake helm executable printing the given version and returns its path
+func writeFakeHelm(t *testing.T, output string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "helm")
+	script := "#!/bin/sh\nprintf '%s' '" + output + "'\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake helm: %v", err)
+	}
+	return path
+}
+
+func TestBinary(t *testing.T) {
+	t.Setenv("HELM_BIN", "")
+	if got := Binary(); got != "helm" {
+		t.Errorf("Binary() = %q, want %q", got, "helm")
+	}
+
+	t.Setenv("HELM_BIN", "/opt/helm/bin/helm")
+	if got := Binary(); got != "/opt/helm/bin/helm" {
+		t.Errorf("Binary() = %q, want %q", got, "/opt/helm/bin/helm")
+	}
+}
+
+func TestDetectVersion_EnvOverride(t *testing.T) {
+	t.Setenv(VersionEnvVar, "v3.9.2")
+
+	got, err := DetectVersion()
+	if err != nil {
+		t.Fatalf("DetectVersion() error = %v, want nil", err)
+	}
+	if want := (version.Semver{Major: 3, Minor: 9, Patch: 2}); got != want {
+		t.Errorf("DetectVersion() = %v, want %v", got, want)
+	}
+}
+
+func TestDetectVersion_HelmBin(t *testing.T) {
+	t.Setenv(VersionEnvVar, "")
+	t.Setenv("HELM_BIN", writeFakeHelm(t, "v4.0.4"))
+
+	got, err := DetectVersion()
+	if err != nil {
+		t.Fatalf("DetectVersion() error = %v, want nil", err)
+	}
+	if want := (version.Semver{Major: 4, Minor: 0, Patch: 4}); got != want {
+		t.Errorf("DetectVersion() = %v, want %v", got, want)
+	}
+}
+
+func TestDetectVersion_Errors(t *testing.T) {
+	t.Run("helm not found", func(t *testing.T) {
+		t.Setenv(VersionEnvVar, "")
+		t.Setenv("HELM_BIN", filepath.Join(t.TempDir(), "missing"))
+
+		_, err := DetectVersion()
+		if err == nil || !strings.Contains(err.Error(), "helm version failed") {
+			t.Errorf("Expected helm version failure, got: %v", err)
+		}
+	})
+
+	t.Run("unparsable version", func(t *testing.T) {
+		t.Setenv(VersionEnvVar, "")
+		t.Setenv("HELM_BIN", writeFakeHelm(t, "canary"))
+
+		_, err := DetectVersion()
+		if err == nil || !strings.Contains(err.Error(), "failed to parse Helm version") {
+			t.Errorf("Expected parse failure, got: %v", err)
+		}
+	})
+}
+
+func TestCachedVersion(t *testing.T) {
+	t.Setenv(VersionEnvVar, "")
+	t.Setenv("HELM_CACHE_HOME", t.TempDir())
+	// The fake helm counts its runs in a file next to it
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "helm")
+	writeHelm := func(output string) {
+		t.Helper()
+		script := "#!/bin/sh\necho run >> '" + filepath.Join(dir, "runs") + "'\nprintf '%s' '" + output + "'\n"
+		if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write fake helm: %v", err)
+		}
+	}
+	runs := func() int {
+		t.Helper()
+		data, _ := os.ReadFile(filepath.Join(dir, "runs"))
+		return strings.Count(string(data), "run")
+	}
+	t.Setenv("HELM_BIN", bin)
+
+	writeHelm("v3.9.4")
+	for range 2 {
+		got, err := CachedVersion()
+		if err != nil {
+			t.Fatalf("CachedVersion() error = %v, want nil", err)
+		}
+		if want := (version.Semver{Major: 3, Minor: 9, Patch: 4}); got != want {
+			t.Errorf("CachedVersion() = %v, want %v", got, want)
+		}
+	}
+	if got := runs(); got != 1 {
+		t.Errorf("helm ran %d times, want once", got)
+	}
+
+	// Upgrading Helm changes the binary, so its version is probed again
+	writeHelm("v4.0.4")
+	got, err := CachedVersion()
+	if err != nil {
+		t.Fatalf("CachedVersion() error = %v, want nil", err)
+	}
+	if want := (version.Semver{Major: 4, Minor: 0, Patch: 4}); got != want {
+		t.Errorf("CachedVersion() after upgrade = %v, want %v", got, want)
+	}
+	if got := runs(); got != 2 {
+		t.Errorf("helm ran %d times, want twice", got)
+	}
+
+	// The override wins over the cache
+	t.Setenv(VersionEnvVar, "v3.19.0")
+	if got, err := CachedVersion(); err != nil || got != (version.Semver{Major: 3, Minor: 19}) {
+		t.Errorf("CachedVersion() = %v, %v, want 3.19.0", got, err)
+	}
+}
+
+func TestCachedVersion_HelmNotFound(t *testing.T) {
+	t.Setenv(VersionEnvVar, "")
+	t.Setenv("HELM_CACHE_HOME", t.TempDir())
+	t.Setenv("HELM_BIN", filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := CachedVersion(); err == nil || !strings.Contains(err.Error(), "helm version failed") {
+		t.Errorf("Expected helm version failure, got: %v", err)
+	}
+}
+
+func TestCompatibilityWarnings(t *testing.T) {
+	tests := []struct {
+		version     string
+		wantWarning string
+	}{
+		{version: "v3.0.3", wantWarning: "does not support post-renderers"},
+		{version: "v3.9.4", wantWarning: "does not support --post-renderer-args"},
+		{version: "v3.10.0", wantWarning: ""},
+		{version: "v3.19.4", wantWarning: ""},
+		{version: "v4.0.4", wantWarning: ""},
+		{version: "v5.0.0", wantWarning: "has not been tested"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			v, err := version.Parse(tt.version)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			warnings := CompatibilityWarnings(v)
+			if tt.wantWarning == "" {
+				if len(warnings) != 0 {
+					t.Errorf("Expected no warnings, got %v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.wantWarning) {
+				t.Errorf("Expected warning containing %q, got %v", tt.wantWarning, warnings)
+			}
+		})
+	}
+}
+
+func TestPostRendererFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		version version.Semver
+		want    []string
+	}{
+		{name: "Helm v3", version: version.Semver{Major: 3, Minor: 18}, want: []string{"--post-renderer", "/usr/local/bin/helm-kustomize"}},
+		{name: "Helm v4", version: version.Semver{Major: 4}, want: []string{"--post-renderer", "helm-kustomize"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PostRendererFlags(tt.version, "/usr/local/bin/helm-kustomize")
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("PostRendererFlags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetManifest(t *testing.T) {
+	// The fake helm prints its arguments, or fails for an unknown release
+	path := filepath.Join(t.TempDir(), "helm")
+	script := "#!/bin/sh\nif [ \"$3\" = missing ]; then echo 'Error: release: not found' >&2; exit 1; fi\necho \"$@\"\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake helm: %v", err)
+	}
+	t.Setenv("HELM_BIN", path)
+
+	tests := []struct {
+		name      string
+		release   string
+		namespace string
+		want      string
+		wantErr   string
+	}{
+		{name: "current namespace", release: "web", want: "get manifest web\n"},
+		{name: "namespace", release: "web", namespace: "prod", want: "get manifest web --namespace prod\n"},
+		{name: "missing release", release: "missing", wantErr: "Error: release: not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetManifest(context.Background(), tt.release, tt.namespace)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetManifest() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetManifest() error = %v, want nil", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("GetManifest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
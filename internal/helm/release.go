@@ -0,0 +1,55 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// DriverEnvVar selects the storage driver Helm keeps releases in
+const DriverEnvVar = "HELM_DRIVER"
+
+// ReleaseSizeLimit is the largest release Kubernetes stores in a Secret or ConfigMap, whose data
+// is limited to 1MiB
+const ReleaseSizeLimit = 1 << 20
+
+// StoresReleasesInObjects reports whether Helm keeps releases in Secrets or ConfigMaps, and is
+// therefore bound by ReleaseSizeLimit, rather than in memory or an SQL database
+func StoresReleasesInObjects() bool {
+	switch os.Getenv(DriverEnvVar) {
+	case "", "secret", "secrets", "configmap", "configmaps":
+		return true
+	}
+	return false
+}
+
+// EstimateReleaseSize estimates the size of the release Helm stores for a chart whose templates
+// render to input and whose post-rendered manifest is output. Helm encodes the release as JSON,
+// with the chart templates as base64 and the manifest as a string, compresses it with gzip and
+// encodes it as base64 again. Values, the chart metadata and other files are not counted.
+func EstimateReleaseSize(input, output []byte) (int, error) {
+	release, err := json.Marshal(struct {
+		Templates []byte `json:"templates"`
+		Manifest  string `json:"manifest"`
+	}{input, string(output)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode release: %w", err)
+	}
+
+	var buf bytes.Buffer
+	// Helm compresses releases with the best compression too
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compress release: %w", err)
+	}
+	if _, err := w.Write(release); err != nil {
+		return 0, fmt.Errorf("failed to compress release: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("failed to compress release: %w", err)
+	}
+	return base64.StdEncoding.EncodedLen(buf.Len()), nil
+}
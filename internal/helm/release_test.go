@@ -0,0 +1,70 @@
+package helm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func TestStoresReleasesInObjects(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   bool
+	}{
+		{driver: "", want: true},
+		{driver: "secret", want: true},
+		{driver: "configmaps", want: true},
+		{driver: "sql", want: false},
+		{driver: "memory", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			t.Setenv(DriverEnvVar, tt.driver)
+			if got := StoresReleasesInObjects(); got != tt.want {
+				t.Errorf("StoresReleasesInObjects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEstimateReleaseSize(t *testing.T) {
+	random := make([]byte, 640<<10)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatalf("Failed to generate random data: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		input     []byte
+		output    []byte
+		wantAbove int
+		wantBelow int
+	}{
+		{
+			name:      "repetitive manifests compress well",
+			input:     bytes.Repeat([]byte("apiVersion: v1\nkind: ConfigMap\n"), 32<<10),
+			output:    bytes.Repeat([]byte("apiVersion: v1\nkind: ConfigMap\n"), 32<<10),
+			wantBelow: 64 << 10,
+		},
+		{
+			name:      "random payload",
+			input:     []byte(hex.EncodeToString(random)),
+			output:    []byte("apiVersion: v1\nkind: ConfigMap\n"),
+			wantAbove: ReleaseSizeLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EstimateReleaseSize(tt.input, tt.output)
+			if err != nil {
+				t.Fatalf("EstimateReleaseSize() error = %v, want nil", err)
+			}
+			if got <= tt.wantAbove || (tt.wantBelow > 0 && got >= tt.wantBelow) {
+				t.Errorf("EstimateReleaseSize() = %d, want above %d and below %d", got, tt.wantAbove, tt.wantBelow)
+			}
+		})
+	}
+}
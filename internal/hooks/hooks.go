@@ -0,0 +1,45 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Hook is an external command run after the build. It receives the rendered resources on stdin
+// and prints the resources to use instead on stdout.
+type Hook struct {
+	// Command is the executable, looked up in PATH unless it contains a slash
+	Command string `yaml:"command"`
+	// Args are passed to the command as-is
+	Args []string `yaml:"args"`
+}
+
+// String formats the hook as a command line, e.g. "cost-annotator --currency EUR"
+func (h Hook) String() string {
+	return strings.Join(append([]string{h.Command}, h.Args...), " ")
+}
+
+// Allowed reports whether the command of the hook is in the allowlist. Commands are compared
+// as written, so a command allowed by name is not allowed by path and vice versa.
+func (h Hook) Allowed(allowlist []string) bool {
+	return slices.Contains(allowlist, h.Command)
+}
+
+// Run runs the hook with input on stdin and returns its output
+func Run(ctx context.Context, h Hook, input []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("hook %s failed: %w\nOutput: %s", h, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
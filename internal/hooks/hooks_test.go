@@ -0,0 +1,80 @@
+package hooks
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		hook          Hook
+		input         string
+		want          string
+		wantErrSubstr string
+	}{
+		{
+			name:  "passes input through",
+			hook:  Hook{Command: "cat"},
+			input: "kind: ConfigMap\n",
+			want:  "kind: ConfigMap\n",
+		},
+		{
+			name:  "modifies input",
+			hook:  Hook{Command: "sed", Args: []string{"s/ConfigMap/Secret/"}},
+			input: "kind: ConfigMap\n",
+			want:  "kind: Secret\n",
+		},
+		{
+			name:          "command fails",
+			hook:          Hook{Command: "sh", Args: []string{"-c", "echo broken >&2; exit 3"}},
+			wantErrSubstr: "hook sh -c echo broken >&2; exit 3 failed: exit status 3\nOutput: broken",
+		},
+		{
+			name:          "command not found",
+			hook:          Hook{Command: "helm-kustomize-no-such-hook"},
+			wantErrSubstr: "hook helm-kustomize-no-such-hook failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Run(context.Background(), tt.hook, []byte(tt.input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("Run() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Run() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHook_Allowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		hook      Hook
+		allowlist []string
+		want      bool
+	}{
+		{name: "allowed", hook: Hook{Command: "cost-annotator"}, allowlist: []string{"sidecar-injector", "cost-annotator"}, want: true},
+		{name: "not allowed", hook: Hook{Command: "curl"}, allowlist: []string{"cost-annotator"}, want: false},
+		{name: "empty allowlist", hook: Hook{Command: "cost-annotator"}, want: false},
+		{name: "path of an allowed name", hook: Hook{Command: "/tmp/cost-annotator"}, allowlist: []string{"cost-annotator"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hook.Allowed(tt.allowlist); got != tt.want {
+				t.Errorf("Allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
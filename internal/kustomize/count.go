@@ -0,0 +1,56 @@
+package kustomize
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// CountChange is how a kustomization declares it changes the number of resources of its input
+type CountChange struct {
+	// Generated is the number of resources the configMapGenerator and secretGenerator add
+	Generated int
+	// Deleted are the input resources the strategic merge patches with "$patch: delete" remove
+	Deleted []manifest.ID
+	// Unknown lists the fields that add or remove resources in ways only a build tells, such as
+	// bases, components and custom generators; the count cannot be predicted if it is not empty
+	Unknown []string
+}
+
+// CountChange returns the resources the kustomization declares it adds to and removes from the
+// input resources. Files and dir are as for Trace.
+func (k *Kustomization) CountChange(resources []map[string]any, files map[string]string, dir string) CountChange {
+	var change CountChange
+	for _, field := range []string{"configMapGenerator", "secretGenerator"} {
+		change.Generated += len(listOf(k.RawContent[field]))
+	}
+
+	for _, resource := range listOf(k.RawContent["resources"]) {
+		// The release info is local configuration, which kustomize does not output
+		if resource != AllYaml && resource != ReleaseInfoYaml {
+			change.Unknown = append(change.Unknown, fmt.Sprintf("resources %v", resource))
+		}
+	}
+	for _, field := range []string{"bases", "components", "generators", "transformers", "helmCharts", "crds"} {
+		for _, entry := range listOf(k.RawContent[field]) {
+			if s, ok := entry.(string); ok {
+				change.Unknown = append(change.Unknown, fmt.Sprintf("%s %s", field, s))
+			} else {
+				change.Unknown = append(change.Unknown, field)
+			}
+		}
+	}
+
+	for _, s := range k.steps(files, dir) {
+		if s.removes != "deletes" {
+			continue
+		}
+		for _, resource := range resources {
+			if id := manifest.IDOf(resource); s.matches(resource) && !slices.Contains(change.Deleted, id) {
+				change.Deleted = append(change.Deleted, id)
+			}
+		}
+	}
+	return change
+}
@@ -0,0 +1,74 @@
+package kustomize
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestKustomization_CountChange(t *testing.T) {
+	resources := []map[string]any{
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}},
+		{"apiVersion": "v1", "kind": "Service", "metadata": map[string]any{"name": "web"}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "debug"}},
+	}
+	files := map[string]string{
+		"overlays/prod/delete.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: debug\n$patch: delete\n",
+	}
+
+	tests := []struct {
+		name          string
+		kustomization string
+		want          CountChange
+	}{
+		{
+			name: "generators and deletions",
+			kustomization: `resources:
+- all.yaml
+configMapGenerator:
+- name: settings
+- name: flags
+secretGenerator:
+- name: credentials
+patches:
+- path: delete.yaml
+- path: delete.yaml
+- patch: |
+    kind: Service
+    metadata:
+      name: any
+    $patch: delete
+  target:
+    kind: Service
+`,
+			want: CountChange{
+				Generated: 3,
+				Deleted:   []manifest.ID{{Kind: "ConfigMap", Name: "debug"}, {Kind: "Service", Name: "web"}},
+			},
+		},
+		{
+			name:          "bases and custom generators",
+			kustomization: "resources:\n- all.yaml\n- ../base\ncomponents:\n- ../components/ha\ngenerators:\n- generator.yaml\nhelmCharts:\n- name: redis\n",
+			want: CountChange{
+				Unknown: []string{"resources ../base", "components ../components/ha", "generators generator.yaml", "helmCharts"},
+			},
+		},
+		{
+			name:          "nothing declared",
+			kustomization: "resources:\n- all.yaml\nnamePrefix: prod-\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomization([]byte(tt.kustomization))
+			if err != nil {
+				t.Fatalf("ParseKustomization() error = %v, want nil", err)
+			}
+			if got := k.CountChange(resources, files, "overlays/prod"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CountChange() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package kustomize
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// kustomizationFileNames are the file names kustomize recognizes as a kustomization
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// FindKustomization returns the path of the kustomization file in dir among files, keyed by
+// slash-separated paths, whichever of the names kustomize accepts it has. It returns "" if dir has
+// no kustomization file, and an error if it has more than one.
+func FindKustomization(files map[string]string, dir string) (string, error) {
+	var found []string
+	for _, name := range kustomizationFileNames {
+		if file := path.Join(dir, name); hasFile(files, file) {
+			found = append(found, file)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("found multiple kustomization files in %s: %s", dir, strings.Join(found, ", "))
+}
+
+// GenerateKustomization returns a kustomization for dir that builds all.yaml with the patch files
+// in dir and its subdirectories, for plugin data that supplies patches without a
+// kustomization.yaml. Files ending in .yaml, .yml or .json are strategic merge patches, which
+// target the resource they name. JSON 6902 patches are recognized by their list of operations,
+// and are rejected as they need an explicit target.
+func GenerateKustomization(files map[string]string, dir string) ([]byte, error) {
+	var names []string
+	for name := range files {
+		rel, ok := relativeTo(name, dir)
+		if !ok {
+			continue
+		}
+		switch path.Ext(rel) {
+		case ".yaml", ".yml", ".json":
+			names = append(names, rel)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no kustomization.yaml or patch files in %s", dir)
+	}
+	sort.Strings(names)
+
+	patches := make([]any, 0, len(names))
+	for _, name := range names {
+		var patch any
+		if err := yaml.Unmarshal([]byte(files[path.Join(dir, name)]), &patch); err != nil {
+			return nil, fmt.Errorf("failed to parse patch %s: %w", name, err)
+		}
+		switch patch.(type) {
+		case map[string]any:
+			patches = append(patches, map[string]any{"path": name})
+		case []any:
+			return nil, fmt.Errorf("%s is a JSON 6902 patch, which needs a target: add a kustomization.yaml listing it under patches with a target", name)
+		default:
+			return nil, fmt.Errorf("%s is not a strategic merge or JSON 6902 patch", name)
+		}
+	}
+
+	k := &Kustomization{RawContent: map[string]any{"patches": patches}}
+	k.EnsureAllYaml()
+	return k.Marshal()
+}
+
+// relativeTo returns name relative to dir, if it is inside dir
+func relativeTo(name, dir string) (string, bool) {
+	if dir == "." || dir == "" {
+		return name, true
+	}
+	return strings.CutPrefix(name, strings.TrimSuffix(dir, "/")+"/")
+}
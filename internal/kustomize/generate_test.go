@@ -0,0 +1,143 @@
+package kustomize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindKustomization(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         []string
+		dir           string
+		want          string
+		wantErrSubstr string
+	}{
+		{name: "kustomization.yaml", files: []string{"kustomization.yaml"}, dir: ".", want: "kustomization.yaml"},
+		{name: "kustomization.yml", files: []string{"kustomization.yml"}, dir: ".", want: "kustomization.yml"},
+		{name: "Kustomization", files: []string{"Kustomization"}, dir: ".", want: "Kustomization"},
+		{name: "unclean path", files: []string{"./kustomization.yml"}, dir: ".", want: "kustomization.yml"},
+		{name: "overlay", files: []string{"kustomization.yaml", "overlays/prod/Kustomization"}, dir: "overlays/prod", want: "overlays/prod/Kustomization"},
+		{name: "other directory", files: []string{"overlays/prod/kustomization.yaml"}, dir: ".", want: ""},
+		{name: "patches only", files: []string{"patch.yaml"}, dir: ".", want: ""},
+		{
+			name:          "multiple",
+			files:         []string{"kustomization.yaml", "Kustomization"},
+			dir:           ".",
+			wantErrSubstr: "found multiple kustomization files in .: kustomization.yaml, Kustomization",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string, len(tt.files))
+			for _, name := range tt.files {
+				files[name] = ""
+			}
+
+			got, err := FindKustomization(files, tt.dir)
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("FindKustomization() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindKustomization() error = %v, want nil", err)
+			}
+			if got != tt.want {
+				t.Errorf("FindKustomization() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateKustomization(t *testing.T) {
+	files := map[string]string{
+		"patches/service.yaml":       "kind: Service\nmetadata:\n  name: web\n",
+		"deployment.json":            `{"kind": "Deployment", "metadata": {"name": "web"}}`,
+		"README.md":                  "Not a patch\n",
+		"overlays/prod/replicas.yml": "kind: Deployment\nmetadata:\n  name: web\n",
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{
+			name: "root",
+			dir:  ".",
+			want: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+patches:
+  - path: deployment.json
+  - path: overlays/prod/replicas.yml
+  - path: patches/service.yaml
+resources:
+  - all.yaml
+`,
+		},
+		{
+			name: "overlay",
+			dir:  "overlays/prod",
+			want: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+patches:
+  - path: replicas.yml
+resources:
+  - all.yaml
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateKustomization(files, tt.dir)
+			if err != nil {
+				t.Fatalf("GenerateKustomization() error = %v, want nil", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("GenerateKustomization() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateKustomization_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no patches",
+			files:         map[string]string{"README.md": "Not a patch\n"},
+			wantErrSubstr: "no kustomization.yaml or patch files in .",
+		},
+		{
+			name:          "JSON 6902 patch",
+			files:         map[string]string{"ops.yaml": "- op: remove\n  path: /spec/replicas\n"},
+			wantErrSubstr: "ops.yaml is a JSON 6902 patch, which needs a target",
+		},
+		{
+			name:          "not a patch",
+			files:         map[string]string{"values.yaml": "just a string\n"},
+			wantErrSubstr: "values.yaml is not a strategic merge or JSON 6902 patch",
+		},
+		{
+			name:          "invalid YAML",
+			files:         map[string]string{"broken.yaml": "kind: [\n"},
+			wantErrSubstr: "failed to parse patch broken.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateKustomization(tt.files, ".")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("GenerateKustomization() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
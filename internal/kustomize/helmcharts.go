@@ -0,0 +1,123 @@
+package kustomize
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// HelmChart is an entry of the helmCharts field of a kustomization, which kustomize inflates
+// with helm when built with --enable-helm
+type HelmChart struct {
+	// File is the kustomization file of the entry
+	File string
+	Name string
+	// Repo is the repository the chart is pulled from, empty for charts in the chart home
+	Repo    string
+	Version string
+	// Home is the chart home of the kustomization, the helmGlobals.chartHome directory relative
+	// to the kustomization file or charts next to it, as a slash-separated path in files
+	Home string
+}
+
+// Dir returns the directory of a local chart in the files map, under the chart home
+func (c HelmChart) Dir() string {
+	return path.Join(c.Home, c.Name)
+}
+
+// String describes the chart for messages, e.g. "chart datadog 3.1.0 from https://helm.datadoghq.com"
+func (c HelmChart) String() string {
+	s := "chart " + c.Name
+	if c.Version != "" {
+		s += " " + c.Version
+	}
+	if c.Repo != "" {
+		s += " from " + c.Repo
+	}
+	return s
+}
+
+// HelmCharts returns the helmCharts entries of the kustomization files of files, in the order
+// of the file paths. Files that do not parse are skipped, as the build reports them.
+func HelmCharts(files map[string]string) []HelmChart {
+	var charts []HelmChart
+	for _, file := range slices.Sorted(maps.Keys(files)) {
+		if !isKustomizationFile(file) {
+			continue
+		}
+		kust, err := ParseKustomization([]byte(files[file]))
+		if err != nil {
+			continue
+		}
+		home := "charts"
+		if globals, ok := kust.RawContent["helmGlobals"].(map[string]any); ok {
+			if chartHome, ok := globals["chartHome"].(string); ok && chartHome != "" {
+				home = chartHome
+			}
+		}
+		entries, _ := kust.RawContent["helmCharts"].([]any)
+		for _, entry := range entries {
+			fields, _ := entry.(map[string]any)
+			name, _ := fields["name"].(string)
+			repo, _ := fields["repo"].(string)
+			version, _ := fields["version"].(string)
+			charts = append(charts, HelmChart{File: file, Name: name, Repo: repo, Version: version, Home: path.Join(path.Dir(path.Clean(file)), home)})
+		}
+	}
+	return charts
+}
+
+// LocalCharts returns files with what kustomize needs to inflate the local charts of charts, those
+// without a repository, from the files map: helm reads them from the chart home, and kustomize
+// requires a values.yaml, which is added empty when a chart has none. Local charts missing from
+// files fail, rather than with the cryptic error of kustomize. files is returned as is when it
+// has everything.
+func LocalCharts(files map[string]string, charts []HelmChart) (map[string]string, error) {
+	result, cloned := files, false
+	for _, chart := range charts {
+		if chart.Repo != "" {
+			continue
+		}
+		dir := chart.Dir()
+		if chart.Name == "" || !hasFile(files, path.Join(dir, "Chart.yaml")) {
+			return nil, fmt.Errorf("%s of %s has no repo and is not in the files at %s/Chart.yaml", chart, chart.File, dir)
+		}
+		if values := path.Join(dir, "values.yaml"); !hasFile(result, values) {
+			if !cloned {
+				result, cloned = maps.Clone(files), true
+			}
+			result[values] = ""
+		}
+	}
+	return result, nil
+}
+
+// ChartRepoAllowed reports whether repo is one of the allowed repositories or under one of them,
+// e.g. "oci://registry.internal/charts/agents" under "oci://registry.internal/charts"
+func ChartRepoAllowed(repo string, allowed []string) bool {
+	for _, prefix := range allowed {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if repo == prefix || strings.HasPrefix(repo, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHelmCharts fails for helmCharts entries pulling a chart from a repository that is not
+// allowed, so that a chart cannot reach out to arbitrary registries during the post-render.
+// Charts without a repository come from the files of the plugin data and are always allowed.
+func CheckHelmCharts(charts []HelmChart, allowed []string) error {
+	var denied []string
+	for _, chart := range charts {
+		if chart.Repo != "" && !ChartRepoAllowed(chart.Repo, allowed) {
+			denied = append(denied, fmt.Sprintf("%s (%s)", chart, chart.File))
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("helmCharts pull from repositories that are not allowed, add them to allowedChartRepos:\n  %s", strings.Join(denied, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package kustomize
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHelmCharts(t *testing.T) {
+	files := map[string]string{
+		"kustomization.yaml":              "resources:\n- all.yaml\nhelmCharts:\n- name: datadog\n  repo: https://helm.datadoghq.com\n  version: 3.1.0\n",
+		"overlays/prod/kustomization.yml": "helmGlobals:\n  chartHome: ../../vendor\nhelmCharts:\n- name: local-agent\n",
+		"values.yaml":                     "helmCharts:\n- name: ignored\n",
+		"broken/kustomization.yaml":       "helmCharts: [",
+	}
+
+	want := []HelmChart{
+		{File: "kustomization.yaml", Name: "datadog", Repo: "https://helm.datadoghq.com", Version: "3.1.0", Home: "charts"},
+		{File: "overlays/prod/kustomization.yml", Name: "local-agent", Home: "vendor"},
+	}
+	if got := HelmCharts(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("HelmCharts() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLocalCharts(t *testing.T) {
+	remote := HelmChart{File: "kustomization.yaml", Name: "datadog", Repo: "https://helm.datadoghq.com", Home: "charts"}
+	local := HelmChart{File: "kustomization.yaml", Name: "agent", Home: "charts"}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		charts  []HelmChart
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:   "remote chart",
+			files:  map[string]string{"kustomization.yaml": ""},
+			charts: []HelmChart{remote},
+			want:   map[string]string{"kustomization.yaml": ""},
+		},
+		{
+			name:   "local chart with values",
+			files:  map[string]string{"charts/agent/Chart.yaml": "name: agent", "charts/agent/values.yaml": "replicas: 1"},
+			charts: []HelmChart{local},
+			want:   map[string]string{"charts/agent/Chart.yaml": "name: agent", "charts/agent/values.yaml": "replicas: 1"},
+		},
+		{
+			name:   "local chart without values",
+			files:  map[string]string{"charts/agent/Chart.yaml": "name: agent"},
+			charts: []HelmChart{local},
+			want:   map[string]string{"charts/agent/Chart.yaml": "name: agent", "charts/agent/values.yaml": ""},
+		},
+		{
+			name:    "local chart missing from the files",
+			files:   map[string]string{"kustomization.yaml": ""},
+			charts:  []HelmChart{local},
+			wantErr: "chart agent of kustomization.yaml has no repo and is not in the files at charts/agent/Chart.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LocalCharts(tt.files, tt.charts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LocalCharts() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LocalCharts() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LocalCharts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHelmCharts(t *testing.T) {
+	charts := []HelmChart{
+		{File: "kustomization.yaml", Name: "agent", Repo: "oci://registry.internal/charts/agents", Version: "1.0.0"},
+		{File: "kustomization.yaml", Name: "local"},
+	}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		wantErr string
+	}{
+		{name: "allowed prefix", allowed: []string{"oci://registry.internal/charts/"}},
+		{name: "allowed repository", allowed: []string{"oci://registry.internal/charts/agents"}},
+		{name: "nothing allowed", wantErr: "chart agent 1.0.0 from oci://registry.internal/charts/agents (kustomization.yaml)"},
+		{name: "sibling path", allowed: []string{"oci://registry.internal/chart"}, wantErr: "not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckHelmCharts(charts, tt.allowed)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckHelmCharts() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckHelmCharts() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
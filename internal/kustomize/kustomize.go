@@ -2,10 +2,16 @@ package kustomize
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"os/exec"
+	"path/filepath"
 	"slices"
+	"strings"
 
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
 	"go.yaml.in/yaml/v4"
 )
 
@@ -24,6 +30,11 @@ func ParseKustomization(data []byte) (*Kustomization, error) {
 		return nil, fmt.Errorf("failed to parse kustomization.yaml: %w", err)
 	}
 
+	// An empty file decodes to a nil map
+	if raw == nil {
+		raw = map[string]any{}
+	}
+
 	k := &Kustomization{
 		RawContent: raw,
 	}
@@ -44,6 +55,21 @@ func ParseKustomization(data []byte) (*Kustomization, error) {
 		}
 	}
 
+	// Validate images, labels and patches if present, so that SetImage, AddLabels and
+	// AddPodSpecPatches can safely extend them
+	for _, field := range []string{"images", "labels", "patches"} {
+		if fieldRaw, ok := raw[field]; ok {
+			if _, ok := fieldRaw.([]any); !ok {
+				return nil, fmt.Errorf("%s field must be an array", field)
+			}
+		}
+	}
+	if optionsRaw, ok := raw["generatorOptions"]; ok {
+		if _, ok := optionsRaw.(map[string]any); !ok {
+			return nil, fmt.Errorf("generatorOptions field must be a map")
+		}
+	}
+
 	return k, nil
 }
 
@@ -75,15 +101,224 @@ func (k *Kustomization) Marshal() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// EnsureAllYamlInKustomization reads kustomization.yaml, ensures all.yaml is in resources,
-// and returns the updated content if changes were made
+// Image is an entry of the kustomization images field
+type Image struct {
+	Name    string
+	NewName string
+	NewTag  string
+	Digest  string
+}
+
+// ParseImage parses an image override of the form name=[newName][:newTag][@digest],
+// e.g. "nginx=registry.internal/nginx:1.25" or "nginx=:1.25"
+func ParseImage(s string) (Image, error) {
+	name, ref, ok := strings.Cut(s, "=")
+	if !ok || name == "" || ref == "" {
+		return Image{}, fmt.Errorf("invalid image override %q, expected name=[newName][:newTag][@digest]", s)
+	}
+
+	img := Image{Name: name}
+
+	if before, digest, found := strings.Cut(ref, "@"); found {
+		if digest == "" {
+			return Image{}, fmt.Errorf("invalid image override %q: empty digest", s)
+		}
+		img.Digest = digest
+		ref = before
+	}
+
+	// A colon after the last slash separates the tag; earlier colons belong to a registry port
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		img.NewTag = ref[i+1:]
+		ref = ref[:i]
+		if img.NewTag == "" {
+			return Image{}, fmt.Errorf("invalid image override %q: empty tag", s)
+		}
+	}
+	img.NewName = ref
+
+	return img, nil
+}
+
+// SetImage sets an image override, replacing any existing entry for the same image name
+func (k *Kustomization) SetImage(img Image) {
+	entry := map[string]any{"name": img.Name}
+	if img.NewName != "" {
+		entry["newName"] = img.NewName
+	}
+	if img.NewTag != "" {
+		entry["newTag"] = img.NewTag
+	}
+	if img.Digest != "" {
+		entry["digest"] = img.Digest
+	}
+
+	images, _ := k.RawContent["images"].([]any)
+	for i, existing := range images {
+		if m, ok := existing.(map[string]any); ok && m["name"] == img.Name {
+			images[i] = entry
+			return
+		}
+	}
+	k.RawContent["images"] = append(images, entry)
+}
+
+// AddLabels appends an entry to the labels field
+func (k *Kustomization) AddLabels(pairs map[string]string, includeSelectors, includeTemplates bool) {
+	entry := map[string]any{
+		"pairs":            pairs,
+		"includeSelectors": includeSelectors,
+	}
+	if includeTemplates {
+		entry["includeTemplates"] = true
+	}
+
+	labels, _ := k.RawContent["labels"].([]any)
+	k.RawContent["labels"] = append(labels, entry)
+}
+
+// TenantLabel is the label SetTenant adds to every resource and pod template, with the tenant
+// name as value
+const TenantLabel = "helm.plugin.kustomize/tenant"
+
+// TenantName returns the tenant of a tenant prefix, the prefix without its trailing dash, e.g.
+// "team-a" for "team-a-"
+func TenantName(prefix string) string {
+	return strings.TrimSuffix(prefix, "-")
+}
+
+// SetTenant puts the resources of the kustomization in the tenant of a prefix such as "team-a-":
+// their names get the prefix, in front of any namePrefix of the kustomization, they move to the
+// namespace named after the tenant, and they and their pod templates get TenantLabel. Kustomize
+// rewrites the references between the resources to the prefixed names.
+func (k *Kustomization) SetTenant(prefix string) {
+	namePrefix, _ := k.RawContent["namePrefix"].(string)
+	k.RawContent["namePrefix"] = prefix + namePrefix
+	k.RawContent["namespace"] = TenantName(prefix)
+	k.AddLabels(map[string]string{TenantLabel: TenantName(prefix)}, false, true)
+}
+
+// AddPodSpecPatches appends a JSON 6902 patch per kind with a pod spec to the patches field,
+// setting fields of the pod specs of the resources the target selects, e.g.
+// {"priorityClassName": "high"}. If the target has a kind, only that kind is patched.
+func (k *Kustomization) AddPodSpecPatches(fields map[string]string, target Target) error {
+	kinds := manifest.PodSpecKinds()
+	if target.Kind != "" {
+		kinds = []string{target.Kind}
+	}
+
+	patches, _ := k.RawContent["patches"].([]any)
+	for _, kind := range kinds {
+		path, ok := manifest.PodSpecPath(kind)
+		if !ok {
+			return fmt.Errorf("kind %s has no pod template", kind)
+		}
+
+		ops := make([]map[string]any, 0, len(fields))
+		for _, name := range slices.Sorted(maps.Keys(fields)) {
+			ops = append(ops, map[string]any{"op": "add", "path": "/" + strings.Join(append(path, name), "/"), "value": fields[name]})
+		}
+		patch, err := yaml.Marshal(ops)
+		if err != nil {
+			return fmt.Errorf("failed to marshal patch: %w", err)
+		}
+
+		kindTarget := target
+		kindTarget.Kind = kind
+		patches = append(patches, map[string]any{"target": kindTarget.toMap(), "patch": string(patch)})
+	}
+	k.RawContent["patches"] = patches
+	return nil
+}
+
+// GeneratorOptions is the generatorOptions field, which applies to all generators of the kustomization
+type GeneratorOptions struct {
+	// Labels and Annotations are added to the generated resources
+	Labels      map[string]string
+	Annotations map[string]string
+	// DisableNameSuffixHash keeps the generator names instead of appending a content hash
+	DisableNameSuffixHash bool
+	// Immutable marks generated ConfigMaps and Secrets as immutable
+	Immutable bool
+}
+
+// SetGeneratorOptions merges opts into the generatorOptions field. Labels and annotations are
+// added to the existing ones, and flags are only ever turned on, so options set in the
+// kustomization.yaml are kept.
+func (k *Kustomization) SetGeneratorOptions(opts GeneratorOptions) {
+	existing, _ := k.RawContent["generatorOptions"].(map[string]any)
+	if existing == nil {
+		existing = map[string]any{}
+	}
+
+	for field, pairs := range map[string]map[string]string{"labels": opts.Labels, "annotations": opts.Annotations} {
+		if len(pairs) == 0 {
+			continue
+		}
+		merged, _ := existing[field].(map[string]any)
+		if merged == nil {
+			merged = map[string]any{}
+		}
+		for key, value := range pairs {
+			merged[key] = value
+		}
+		existing[field] = merged
+	}
+	if opts.DisableNameSuffixHash {
+		existing["disableNameSuffixHash"] = true
+	}
+	if opts.Immutable {
+		existing["immutable"] = true
+	}
+
+	if len(existing) > 0 {
+		k.RawContent["generatorOptions"] = existing
+	}
+}
+
+// Namespace returns the namespace field of the kustomization, or "" if it is not set
+func (k *Kustomization) Namespace() string {
+	namespace, _ := k.RawContent["namespace"].(string)
+	return namespace
+}
+
+// EnsureAllYaml adds all.yaml to the resources if not already present, fills in a missing
+// apiVersion and kind, and reports whether it changed
+func (k *Kustomization) EnsureAllYaml() bool {
+	typeMetaChanged := k.EnsureTypeMeta()
+	return k.AddResource(AllYaml) || typeMetaChanged
+}
+
+// EnsureTypeMeta sets the apiVersion and kind of a kustomization that omits them, as
+// quick-start examples often do, and reports whether it changed. A Component only gets the
+// Component apiVersion.
+func (k *Kustomization) EnsureTypeMeta() bool {
+	changed := false
+	kind, ok := k.RawContent["kind"]
+	if !ok {
+		kind = "Kustomization"
+		k.RawContent["kind"] = kind
+		changed = true
+	}
+	if _, ok := k.RawContent["apiVersion"]; !ok {
+		k.RawContent["apiVersion"] = "kustomize.config.k8s.io/v1beta1"
+		if kind == "Component" {
+			k.RawContent["apiVersion"] = "kustomize.config.k8s.io/v1alpha1"
+		}
+		changed = true
+	}
+	return changed
+}
+
+// EnsureAllYamlInKustomization reads kustomization.yaml, ensures all.yaml is in resources and
+// the apiVersion and kind are set, and returns the updated content if changes were made
 func EnsureAllYamlInKustomization(kustomizationContent []byte) (updated []byte, changed bool, err error) {
 	k, err := ParseKustomization(kustomizationContent)
 	if err != nil {
 		return nil, false, err
 	}
 
-	changed = k.AddResource("all.yaml")
+	changed = k.EnsureAllYaml()
 
 	updated, err = k.Marshal()
 	if err != nil {
@@ -95,10 +330,82 @@ func EnsureAllYamlInKustomization(kustomizationContent []byte) (updated []byte,
 
 // Build runs kubectl kustomize on the given directory and returns the output
 func Build(dir string) ([]byte, error) {
-	cmd := exec.Command("kubectl", "kustomize", dir)
-	output, err := cmd.CombinedOutput()
+	output, _, _, err := BuildWithWarnings(context.Background(), dir)
+	return output, err
+}
+
+// BuildWithWarnings runs kubectl kustomize with flags, such as --enable-helm, on the given
+// directory and returns the output along with the warnings kustomize printed on stderr, such as
+// the use of deprecated fields, and the other lines of stderr, such as kubectl log lines, for
+// debug output. kubectl is killed if ctx is cancelled.
+func BuildWithWarnings(ctx context.Context, dir string, flags ...string) (output []byte, warnings, other []string, err error) {
+	cmd := exec.CommandContext(ctx, "kubectl", slices.Concat([]string{"kustomize"}, flags, []string{dir})...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err = cmd.Output()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("kubectl kustomize failed: %w\nOutput: %s", err, stderr.String())
+	}
+
+	// kustomize prints warnings as YAML comments, e.g. "# Warning: 'vars' is deprecated."
+	for line := range strings.Lines(stderr.String()) {
+		line = strings.TrimSpace(line)
+		if warning, ok := strings.CutPrefix(line, "# Warning:"); ok {
+			warnings = append(warnings, strings.TrimSpace(warning))
+		} else if line != "" {
+			other = append(other, line)
+		}
+	}
+
+	return output, warnings, other, nil
+}
+
+// BuildExternal builds the given directory with a standalone kustomize binary, or with
+// `kubectl kustomize` if binary is a kubectl binary, to compare with the output of Build
+func BuildExternal(ctx context.Context, binary, dir string) ([]byte, error) {
+	args := []string{"build", dir}
+	if strings.HasPrefix(filepath.Base(binary), "kubectl") {
+		args = []string{"kustomize", dir}
+	}
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("kubectl kustomize failed: %w\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("%s %s failed: %w\nOutput: %s", binary, args[0], err, stderr.String())
 	}
 	return output, nil
 }
+
+// VersionInfo describes the kubectl binary used for builds and the kustomize version bundled with it
+type VersionInfo struct {
+	Kubectl   string
+	Kustomize string
+}
+
+// Version runs kubectl version and returns the kubectl and bundled kustomize versions
+func Version() (*VersionInfo, error) {
+	cmd := exec.Command("kubectl", "version", "--client", "-o", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl version failed: %w", err)
+	}
+
+	var raw struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+		KustomizeVersion string `json:"kustomizeVersion"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse kubectl version output: %w", err)
+	}
+
+	return &VersionInfo{
+		Kubectl:   raw.ClientVersion.GitVersion,
+		Kustomize: raw.KustomizeVersion,
+	}, nil
+}
@@ -1,11 +1,17 @@
 package kustomize
 
 import (
+	"context"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"reflect"
 	"slices"
 	"strings"
 	"testing"
+	"testing/quick"
 
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
 	"go.yaml.in/yaml/v4"
 )
 
@@ -230,7 +236,9 @@ func TestEnsureAllYamlInKustomization(t *testing.T) {
 		},
 		{
 			name: "all.yaml already present",
-			input: `resources:
+			input: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
 - all.yaml
 - base.yaml
 `,
@@ -275,6 +283,63 @@ func TestEnsureAllYamlInKustomization(t *testing.T) {
 	}
 }
 
+func TestKustomization_EnsureTypeMeta(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          string
+		wantAPIVersion string
+		wantKind       string
+		wantChanged    bool
+	}{
+		{
+			name:           "missing apiVersion and kind",
+			input:          "resources:\n- all.yaml\n",
+			wantAPIVersion: "kustomize.config.k8s.io/v1beta1",
+			wantKind:       "Kustomization",
+			wantChanged:    true,
+		},
+		{
+			name:           "missing apiVersion",
+			input:          "kind: Kustomization\n",
+			wantAPIVersion: "kustomize.config.k8s.io/v1beta1",
+			wantKind:       "Kustomization",
+			wantChanged:    true,
+		},
+		{
+			name:           "component without apiVersion",
+			input:          "kind: Component\n",
+			wantAPIVersion: "kustomize.config.k8s.io/v1alpha1",
+			wantKind:       "Component",
+			wantChanged:    true,
+		},
+		{
+			name:           "already set",
+			input:          "apiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\n",
+			wantAPIVersion: "kustomize.config.k8s.io/v1beta1",
+			wantKind:       "Kustomization",
+			wantChanged:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomization([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("ParseKustomization() error = %v, want nil", err)
+			}
+			if changed := k.EnsureTypeMeta(); changed != tt.wantChanged {
+				t.Errorf("EnsureTypeMeta() = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := k.RawContent["apiVersion"]; got != tt.wantAPIVersion {
+				t.Errorf("apiVersion = %v, want %v", got, tt.wantAPIVersion)
+			}
+			if got := k.RawContent["kind"]; got != tt.wantKind {
+				t.Errorf("kind = %v, want %v", got, tt.wantKind)
+			}
+		})
+	}
+}
+
 func TestEnsureAllYamlInKustomization_PreservesOtherFields(t *testing.T) {
 	input := `apiVersion: kustomize.config.k8s.io/v1beta1
 kind: Kustomization
@@ -374,3 +439,712 @@ resources:
 		t.Errorf("Error should mention kubectl kustomize failed, got: %v", err)
 	}
 }
+
+func TestVersion(t *testing.T) {
+	info, err := Version()
+	if err != nil {
+		t.Fatalf("Version() error = %v, want nil", err)
+	}
+
+	if info.Kubectl == "" {
+		t.Error("Expected kubectl version to be set")
+	}
+	if info.Kustomize == "" {
+		t.Error("Expected kustomize version to be set")
+	}
+}
+
+func TestVersion_KubectlNotFound(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := Version()
+	if err == nil {
+		t.Fatal("Version() should return error when kubectl is not in PATH")
+	}
+	if !strings.Contains(err.Error(), "kubectl version failed") {
+		t.Errorf("Error should mention kubectl version failed, got: %v", err)
+	}
+}
+
+func TestParseKustomization_EmptyFile(t *testing.T) {
+	k, err := ParseKustomization([]byte(""))
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v, want nil", err)
+	}
+
+	if !k.EnsureAllYaml() {
+		t.Error("EnsureAllYaml() should report a change for an empty kustomization")
+	}
+}
+
+func TestParseKustomization_ImagesNotArray(t *testing.T) {
+	_, err := ParseKustomization([]byte(`images: nginx`))
+	if err == nil {
+		t.Fatal("ParseKustomization() should return error when images is not an array")
+	}
+	if !strings.Contains(err.Error(), "images field must be an array") {
+		t.Errorf("Error should mention images field must be an array, got: %v", err)
+	}
+}
+
+func TestParseImage(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Image
+		wantErr bool
+	}{
+		{input: "nginx=registry.internal/nginx:1.25", want: Image{Name: "nginx", NewName: "registry.internal/nginx", NewTag: "1.25"}},
+		{input: "nginx=:1.25", want: Image{Name: "nginx", NewTag: "1.25"}},
+		{input: "nginx=mirror/nginx", want: Image{Name: "nginx", NewName: "mirror/nginx"}},
+		{input: "nginx=registry:5000/nginx", want: Image{Name: "nginx", NewName: "registry:5000/nginx"}},
+		{input: "nginx=registry:5000/nginx:1.25", want: Image{Name: "nginx", NewName: "registry:5000/nginx", NewTag: "1.25"}},
+		{input: "nginx=nginx@sha256:abc", want: Image{Name: "nginx", NewName: "nginx", Digest: "sha256:abc"}},
+		{input: "nginx=@sha256:abc", want: Image{Name: "nginx", Digest: "sha256:abc"}},
+		{input: "nginx", wantErr: true},
+		{input: "=nginx:1.25", wantErr: true},
+		{input: "nginx=", wantErr: true},
+		{input: "nginx=nginx:", wantErr: true},
+		{input: "nginx=nginx@", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseImage(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseImage(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseImage(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKustomization_SetImage(t *testing.T) {
+	k, err := ParseKustomization([]byte(`images:
+- name: nginx
+  newTag: "1.0"
+- name: redis
+  newTag: "7.0"
+`))
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v", err)
+	}
+
+	k.SetImage(Image{Name: "nginx", NewName: "registry.internal/nginx", NewTag: "1.25"})
+	k.SetImage(Image{Name: "busybox", Digest: "sha256:abc"})
+
+	data, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `images:
+  - name: nginx
+    newName: registry.internal/nginx
+    newTag: "1.25"
+  - name: redis
+    newTag: "7.0"
+  - digest: sha256:abc
+    name: busybox
+`
+	if string(data) != want {
+		t.Errorf("Marshal() output =\n%s\nwant =\n%s", string(data), want)
+	}
+}
+
+func TestKustomization_SetImage_Aliases(t *testing.T) {
+	k, err := ParseKustomization([]byte(`images:
+- &nginx
+  name: nginx
+  newTag: "1.0"
+- <<: *nginx
+  name: redis
+`))
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v", err)
+	}
+
+	// Replacing the anchored entry must not affect the entry merging it
+	k.SetImage(Image{Name: "nginx", NewTag: "1.25"})
+
+	data, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `images:
+  - name: nginx
+    newTag: "1.25"
+  - name: redis
+    newTag: "1.0"
+`
+	if string(data) != want {
+		t.Errorf("Marshal() output =\n%s\nwant =\n%s", string(data), want)
+	}
+}
+
+func TestKustomization_Namespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "set", content: "namespace: prod\n", want: "prod"},
+		{name: "unset", content: "resources:\n- all.yaml\n", want: ""},
+		{name: "not a string", content: "namespace: 42\n", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomization([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("ParseKustomization() error = %v, want nil", err)
+			}
+			if got := k.Namespace(); got != tt.want {
+				t.Errorf("Namespace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKustomization_AddLabels(t *testing.T) {
+	k, err := ParseKustomization([]byte(`labels:
+- pairs:
+    app: web
+`))
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v", err)
+	}
+
+	k.AddLabels(map[string]string{"team": "platform"}, false, true)
+
+	data, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `labels:
+  - pairs:
+      app: web
+  - includeSelectors: false
+    includeTemplates: true
+    pairs:
+      team: platform
+`
+	if string(data) != want {
+		t.Errorf("Marshal() output =\n%s\nwant =\n%s", string(data), want)
+	}
+}
+
+func TestKustomization_SetTenant(t *testing.T) {
+	k, err := ParseKustomization([]byte(`namePrefix: web-
+namespace: apps
+`))
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v", err)
+	}
+
+	k.SetTenant("team-a-")
+
+	data, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `labels:
+  - includeSelectors: false
+    includeTemplates: true
+    pairs:
+      helm.plugin.kustomize/tenant: team-a
+namePrefix: team-a-web-
+namespace: team-a
+`
+	if string(data) != want {
+		t.Errorf("Marshal() output =\n%s\nwant =\n%s", string(data), want)
+	}
+}
+
+func TestParseKustomization_LabelsNotArray(t *testing.T) {
+	_, err := ParseKustomization([]byte("labels:\n  app: web\n"))
+	if err == nil || !strings.Contains(err.Error(), "labels field must be an array") {
+		t.Errorf("Expected labels error, got: %v", err)
+	}
+}
+
+func TestKustomization_AddPodSpecPatches(t *testing.T) {
+	k, err := ParseKustomization([]byte(`patches:
+- path: replicas.yaml
+`))
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v", err)
+	}
+
+	fields := map[string]string{"runtimeClassName": "gvisor", "priorityClassName": "high"}
+	if err := k.AddPodSpecPatches(fields, Target{Kind: "CronJob", LabelSelector: "tier=batch"}); err != nil {
+		t.Fatalf("AddPodSpecPatches() error = %v, want nil", err)
+	}
+
+	data, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	want := `patches:
+  - path: replicas.yaml
+  - patch: |
+      - op: add
+        path: /spec/jobTemplate/spec/template/spec/priorityClassName
+        value: high
+      - op: add
+        path: /spec/jobTemplate/spec/template/spec/runtimeClassName
+        value: gvisor
+    target:
+      kind: CronJob
+      labelSelector: tier=batch
+`
+	if string(data) != want {
+		t.Errorf("Marshal() output =\n%s\nwant =\n%s", string(data), want)
+	}
+}
+
+func TestKustomization_AddPodSpecPatches_AllKinds(t *testing.T) {
+	k, err := ParseKustomization(nil)
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v", err)
+	}
+
+	if err := k.AddPodSpecPatches(map[string]string{"priorityClassName": "high"}, Target{Namespace: "prod"}); err != nil {
+		t.Fatalf("AddPodSpecPatches() error = %v, want nil", err)
+	}
+
+	patches := k.RawContent["patches"].([]any)
+	if len(patches) != len(manifest.PodSpecKinds()) {
+		t.Fatalf("AddPodSpecPatches() added %d patches, want one per kind %v", len(patches), manifest.PodSpecKinds())
+	}
+	pod := patches[4].(map[string]any)
+	wantTarget := map[string]any{"kind": "Pod", "namespace": "prod"}
+	if !reflect.DeepEqual(pod["target"], wantTarget) {
+		t.Errorf("Pod patch target = %v, want %v", pod["target"], wantTarget)
+	}
+	if want := "- op: add\n  path: /spec/priorityClassName\n  value: high\n"; pod["patch"] != want {
+		t.Errorf("Pod patch = %q, want %q", pod["patch"], want)
+	}
+}
+
+func TestKustomization_AddPodSpecPatches_KindWithoutPodTemplate(t *testing.T) {
+	k, err := ParseKustomization(nil)
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v", err)
+	}
+
+	err = k.AddPodSpecPatches(map[string]string{"priorityClassName": "high"}, Target{Kind: "Service"})
+	if err == nil || !strings.Contains(err.Error(), "kind Service has no pod template") {
+		t.Errorf("AddPodSpecPatches() error = %v, want error containing %q", err, "kind Service has no pod template")
+	}
+}
+
+func TestKustomization_SetGeneratorOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		kustomization string
+		opts          GeneratorOptions
+		want          string
+	}{
+		{
+			name:          "no existing options",
+			kustomization: "resources:\n- all.yaml\n",
+			opts:          GeneratorOptions{DisableNameSuffixHash: true, Labels: map[string]string{"team": "web"}},
+			want: `generatorOptions:
+  disableNameSuffixHash: true
+  labels:
+    team: web
+resources:
+  - all.yaml
+`,
+		},
+		{
+			name: "merged with existing options",
+			kustomization: `generatorOptions:
+  annotations:
+    owner: platform
+  disableNameSuffixHash: true
+`,
+			opts: GeneratorOptions{Immutable: true, Annotations: map[string]string{"note": "immutable"}},
+			want: `generatorOptions:
+  annotations:
+    note: immutable
+    owner: platform
+  disableNameSuffixHash: true
+  immutable: true
+`,
+		},
+		{
+			name:          "empty options leave the kustomization alone",
+			kustomization: "resources:\n- all.yaml\n",
+			want:          "resources:\n  - all.yaml\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomization([]byte(tt.kustomization))
+			if err != nil {
+				t.Fatalf("ParseKustomization() error = %v", err)
+			}
+
+			k.SetGeneratorOptions(tt.opts)
+
+			data, err := k.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() output =\n%s\nwant =\n%s", string(data), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKustomization_GeneratorOptionsNotMap(t *testing.T) {
+	_, err := ParseKustomization([]byte("generatorOptions: [disableNameSuffixHash]\n"))
+	if err == nil || !strings.Contains(err.Error(), "generatorOptions field must be a map") {
+		t.Errorf("Expected generatorOptions error, got: %v", err)
+	}
+}
+
+func TestBuildWithWarnings(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n",
+		// commonLabels is deprecated, so kustomize prints a warning on stderr
+		"kustomization.yaml": "resources:\n- configmap.yaml\ncommonLabels:\n  app: test\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(tempDir+"/"+name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	output, warnings, _, err := BuildWithWarnings(context.Background(), tempDir)
+	if err != nil {
+		t.Fatalf("BuildWithWarnings() error = %v, want nil", err)
+	}
+
+	if strings.Contains(string(output), "Warning") {
+		t.Errorf("Warnings should not end up in the output, got:\n%s", output)
+	}
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "'commonLabels' is deprecated") {
+		t.Errorf("BuildWithWarnings() warnings = %q, want the commonLabels deprecation", warnings)
+	}
+}
+
+func TestBuildWithWarnings_OtherStderr(t *testing.T) {
+	// The fake kubectl prints a klog line and a warning around the output
+	bin := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"echo 'I1015 12:00:00.000000    4242 request.go:697] Waited for 1.1s due to client-side throttling' >&2\n" +
+		"echo \"# Warning: 'vars' is deprecated.\" >&2\n" +
+		"echo 'apiVersion: v1'\n"
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, warnings, other, err := BuildWithWarnings(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("BuildWithWarnings() error = %v, want nil", err)
+	}
+	if want := []string{"'vars' is deprecated."}; !slices.Equal(warnings, want) {
+		t.Errorf("BuildWithWarnings() warnings = %q, want %q", warnings, want)
+	}
+	if len(other) != 1 || !strings.Contains(other[0], "client-side throttling") {
+		t.Errorf("BuildWithWarnings() other = %q, want the klog line", other)
+	}
+}
+
+func TestBuildWithWarnings_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, _, err := BuildWithWarnings(ctx, t.TempDir())
+	if err == nil {
+		t.Fatal("BuildWithWarnings() should fail when the context is cancelled")
+	}
+}
+
+func TestBuildExternal(t *testing.T) {
+	binDir := t.TempDir()
+	// The fake kustomize echoes its arguments as a ConfigMap name
+	script := "#!/bin/sh\nprintf 'apiVersion: v1\\nkind: ConfigMap\\nmetadata:\\n  name: %s-%s\\n' \"$1\" \"$(basename \"$2\")\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "kustomize"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kustomize: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(binDir, "kubectl-1.30"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	failing := filepath.Join(binDir, "failing")
+	if err := os.WriteFile(failing, []byte("#!/bin/sh\necho broken >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write failing kustomize: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		binary        string
+		wantName      string
+		wantErrSubstr string
+	}{
+		{name: "kustomize", binary: filepath.Join(binDir, "kustomize"), wantName: "build-overlay"},
+		{name: "kubectl", binary: filepath.Join(binDir, "kubectl-1.30"), wantName: "kustomize-overlay"},
+		{name: "failure", binary: failing, wantErrSubstr: "build failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := BuildExternal(context.Background(), tt.binary, "/charts/overlay")
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) || !strings.Contains(err.Error(), "broken") {
+					t.Errorf("BuildExternal() error = %v, want error containing %q and stderr", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildExternal() error = %v, want nil", err)
+			}
+			if !strings.Contains(string(output), "name: "+tt.wantName) {
+				t.Errorf("BuildExternal() = %s, want name %s", output, tt.wantName)
+			}
+		})
+	}
+}
+
+func FuzzParseKustomization(f *testing.F) {
+	f.Add("resources:\n- all.yaml\n")
+	f.Add("resources: all.yaml\n")
+	f.Add("images:\n- name: nginx\n  newTag: '1.25'\nlabels: [{pairs: {a: b}}]\npatches: [{path: p.yaml}]\n")
+	f.Add("")
+	f.Add("- a\n")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		k, err := ParseKustomization([]byte(input))
+		if err != nil {
+			return
+		}
+		data, err := k.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal() error = %v, want nil", err)
+		}
+		again, err := ParseKustomization(data)
+		if err != nil {
+			t.Fatalf("ParseKustomization() of the marshalled kustomization error = %v, want nil\n%s", err, data)
+		}
+		if !slices.Equal(again.Resources, k.Resources) {
+			t.Errorf("Resources after a round trip = %q, want %q", again.Resources, k.Resources)
+		}
+	})
+}
+
+// trickyStrings are scalars that YAML would read as other types, or that need quoting or a
+// block style to survive encoding
+var trickyStrings = []string{
+	"", "all.yaml", "yes", "no", "on", "off", "null", "~", "true", "1", "1.0", "010", "0x1F", "1e3", ".inf",
+	"2024-01-01", "-", "- item", "a: b", "#comment", "*alias", "&anchor", "!tag", "<<", "'quoted'", `"double"`,
+	" leading space", "trailing space ", "tab\tinside", "multi\nline\n", "trailing newlines\n\n", "\nleading newline",
+	"ünïcode ✓", "key=value", "{flow: map}", "[flow, list]", "%directive", "@at", "`backtick`",
+}
+
+// randomScalar returns a random string, integer or boolean
+func randomScalar(r *rand.Rand) any {
+	switch r.Intn(4) {
+	case 0:
+		return r.Intn(2000) - 1000
+	case 1:
+		return r.Intn(2) == 0
+	}
+	return trickyStrings[r.Intn(len(trickyStrings))]
+}
+
+// randomValue returns a random scalar, list or map nested at most depth levels
+func randomValue(r *rand.Rand, depth int) any {
+	if depth == 0 || r.Intn(3) == 0 {
+		return randomScalar(r)
+	}
+	n := r.Intn(4)
+	if r.Intn(2) == 0 {
+		list := make([]any, n)
+		for i := range list {
+			list[i] = randomValue(r, depth-1)
+		}
+		return list
+	}
+	m := make(map[string]any, n)
+	for range n {
+		m[randomKey(r)] = randomValue(r, depth-1)
+	}
+	return m
+}
+
+// randomKey returns a random map key; "<<" is left out as YAML reads it as a merge key
+func randomKey(r *rand.Rand) string {
+	for {
+		if key := trickyStrings[r.Intn(len(trickyStrings))]; key != "<<" {
+			return key
+		}
+	}
+}
+
+// randomStrings returns a list of up to n random strings
+func randomStrings(r *rand.Rand, n int) []any {
+	list := make([]any, r.Intn(n+1))
+	for i := range list {
+		list[i] = trickyStrings[r.Intn(len(trickyStrings))]
+	}
+	return list
+}
+
+// kustomizationInput is an arbitrary valid kustomization.yaml, with the typed fields in the
+// shapes ParseKustomization accepts and unknown fields of any shape
+type kustomizationInput string
+
+// Generate implements quick.Generator
+func (kustomizationInput) Generate(r *rand.Rand, _ int) reflect.Value {
+	raw := map[string]any{}
+	fields := map[string]func() any{
+		"apiVersion": func() any { return "kustomize.config.k8s.io/v1beta1" },
+		"kind":       func() any { return []string{"Kustomization", "Component"}[r.Intn(2)] },
+		"resources":  func() any { return randomStrings(r, 4) },
+		"namespace":  func() any { return trickyStrings[r.Intn(len(trickyStrings))] },
+		"images": func() any {
+			return []any{map[string]any{"name": "nginx", "newTag": randomScalar(r)}, randomValue(r, 2)}
+		},
+		"labels":           func() any { return []any{map[string]any{"pairs": randomValue(r, 1)}} },
+		"patches":          func() any { return []any{map[string]any{"path": "patch.yaml"}, randomValue(r, 2)} },
+		"generatorOptions": func() any { return map[string]any{"labels": randomValue(r, 1), "immutable": r.Intn(2) == 0} },
+	}
+	for name, value := range fields {
+		if r.Intn(2) == 0 {
+			raw[name] = value()
+		}
+	}
+	for range r.Intn(4) {
+		raw["x-"+randomKey(r)] = randomValue(r, 3)
+	}
+
+	// Encoded like Marshal: with the default indentation of 4, the encoder writes block scalars
+	// starting with a newline at an indentation it cannot read back
+	data, err := (&Kustomization{RawContent: raw}).Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return reflect.ValueOf(kustomizationInput(data))
+}
+
+// mutations are calls of the Kustomization helpers, applied in order
+type mutations []func(k *Kustomization) error
+
+// Generate implements quick.Generator
+func (mutations) Generate(r *rand.Rand, _ int) reflect.Value {
+	text := func() string { return trickyStrings[r.Intn(len(trickyStrings))] }
+	pairs := func() map[string]string {
+		m := map[string]string{}
+		for range r.Intn(3) {
+			m[text()] = text()
+		}
+		return m
+	}
+	all := []func() func(k *Kustomization) error{
+		func() func(k *Kustomization) error {
+			resource := text()
+			return func(k *Kustomization) error { k.AddResource(resource); return nil }
+		},
+		func() func(k *Kustomization) error {
+			img := Image{Name: text(), NewName: text(), NewTag: text(), Digest: text()}
+			return func(k *Kustomization) error { k.SetImage(img); return nil }
+		},
+		func() func(k *Kustomization) error {
+			p, selectors, templates := pairs(), r.Intn(2) == 0, r.Intn(2) == 0
+			return func(k *Kustomization) error { k.AddLabels(p, selectors, templates); return nil }
+		},
+		func() func(k *Kustomization) error {
+			fields := map[string]string{"priorityClassName": text()}
+			target := Target{Kind: []string{"", "Deployment", "CronJob"}[r.Intn(3)], Name: "web-.*"}
+			return func(k *Kustomization) error { return k.AddPodSpecPatches(fields, target) }
+		},
+		func() func(k *Kustomization) error {
+			opts := GeneratorOptions{Labels: pairs(), Annotations: pairs(), DisableNameSuffixHash: r.Intn(2) == 0, Immutable: r.Intn(2) == 0}
+			return func(k *Kustomization) error { k.SetGeneratorOptions(opts); return nil }
+		},
+		func() func(k *Kustomization) error {
+			return func(k *Kustomization) error { k.EnsureAllYaml(); return nil }
+		},
+	}
+
+	m := make(mutations, r.Intn(6))
+	for i := range m {
+		m[i] = all[r.Intn(len(all))]()
+	}
+	return reflect.ValueOf(m)
+}
+
+// decodedForm converts the typed values the Kustomization helpers store, such as []string or
+// map[string]string, to the generic form the YAML decoder produces
+func decodedForm(value any) any {
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Slice:
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = decodedForm(v.Index(i).Interface())
+		}
+		return list
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			m[iter.Key().String()] = decodedForm(iter.Value().Interface())
+		}
+		return m
+	}
+	return value
+}
+
+func TestKustomization_MarshalRoundTrip(t *testing.T) {
+	property := func(input kustomizationInput, mutate mutations) bool {
+		k, err := ParseKustomization([]byte(input))
+		if err != nil {
+			t.Logf("ParseKustomization() error = %v, want nil\n%s", err, input)
+			return false
+		}
+		for _, m := range mutate {
+			if err := m(k); err != nil {
+				t.Logf("mutation error = %v, want nil", err)
+				return false
+			}
+		}
+
+		data, err := k.Marshal()
+		if err != nil {
+			t.Logf("Marshal() error = %v, want nil", err)
+			return false
+		}
+		again, err := ParseKustomization(data)
+		if err != nil {
+			t.Logf("ParseKustomization() of the marshalled kustomization error = %v, want nil\n%s", err, data)
+			return false
+		}
+
+		want := decodedForm(k.RawContent)
+		if !reflect.DeepEqual(again.RawContent, want) {
+			t.Logf("Round trip lost data.\nInput:\n%s\nMarshalled:\n%s\nGot:  %#v\nWant: %#v", input, data, again.RawContent, want)
+			return false
+		}
+		if !slices.Equal(again.Resources, k.Resources) {
+			t.Logf("Resources after a round trip = %q, want %q", again.Resources, k.Resources)
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,156 @@
+package kustomize
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// fileListFields are the kustomization fields listing local files
+var fileListFields = []string{"crds", "transformers", "generators", "validators", "patchesStrategicMerge"}
+
+// MissingReferences returns the local files and directories referenced by the kustomization in
+// dir of fsys, and those of the bases and components it includes, that do not exist, as
+// "kustomization: reference" lines. Remote bases and inline patches are not checked.
+func MissingReferences(fsys fs.FS, dir string) ([]string, error) {
+	r := referenceResolver{fsys: fsys, visited: map[string]bool{}}
+	if err := r.resolve(path.Clean(dir)); err != nil {
+		return nil, err
+	}
+	return r.missing, nil
+}
+
+// RemoteReferences returns the remote bases referenced by the kustomization in dir of fsys and
+// by the local bases and components it includes, in the order they are found, without duplicates
+func RemoteReferences(fsys fs.FS, dir string) ([]string, error) {
+	r := referenceResolver{fsys: fsys, visited: map[string]bool{}}
+	if err := r.resolve(path.Clean(dir)); err != nil {
+		return nil, err
+	}
+	return r.remote, nil
+}
+
+// referenceResolver walks the kustomizations reachable from a build root
+type referenceResolver struct {
+	fsys    fs.FS
+	visited map[string]bool
+	missing []string
+	remote  []string
+}
+
+// resolve checks the references of the kustomization in dir and follows its directories
+func (r *referenceResolver) resolve(dir string) error {
+	if r.visited[dir] {
+		return nil
+	}
+	r.visited[dir] = true
+
+	var file string
+	for _, name := range kustomizationFileNames {
+		if info, err := fs.Stat(r.fsys, path.Join(dir, name)); err == nil && !info.IsDir() {
+			file = path.Join(dir, name)
+			break
+		}
+	}
+	if file == "" {
+		return nil
+	}
+	data, err := fs.ReadFile(r.fsys, file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	k, err := ParseKustomization(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	for _, ref := range references(k.RawContent) {
+		if isRemote(ref) {
+			if !slices.Contains(r.remote, ref) {
+				r.remote = append(r.remote, ref)
+			}
+			continue
+		}
+		target := path.Join(dir, ref)
+		info, err := fs.Stat(r.fsys, target)
+		if err != nil {
+			r.missing = append(r.missing, file+": "+ref)
+			continue
+		}
+		if info.IsDir() {
+			if err := r.resolve(target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// references returns the local paths a kustomization refers to, in the order of its fields
+func references(raw map[string]any) []string {
+	var refs []string
+	for _, field := range []string{"resources", "components", "bases"} {
+		refs = append(refs, stringsOf(raw[field])...)
+	}
+	for _, field := range fileListFields {
+		for _, ref := range stringsOf(raw[field]) {
+			// Strategic merge patches may be given inline
+			if !strings.Contains(ref, "\n") {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	for _, field := range []string{"patches", "patchesJson6902"} {
+		list, _ := raw[field].([]any)
+		for _, entry := range list {
+			if patch, ok := entry.(map[string]any); ok {
+				if p, ok := patch["path"].(string); ok && p != "" {
+					refs = append(refs, p)
+				}
+			}
+		}
+	}
+	for _, field := range []string{"configMapGenerator", "secretGenerator"} {
+		list, _ := raw[field].([]any)
+		for _, entry := range list {
+			generator, ok := entry.(map[string]any)
+			if !ok {
+				continue
+			}
+			for _, source := range stringsOf(generator["files"]) {
+				// Files may be given a key as key=path
+				if _, p, found := strings.Cut(source, "="); found {
+					source = p
+				}
+				refs = append(refs, source)
+			}
+			refs = append(refs, stringsOf(generator["envs"])...)
+			if env, ok := generator["env"].(string); ok && env != "" {
+				refs = append(refs, env)
+			}
+		}
+	}
+	return refs
+}
+
+// stringsOf returns the strings of a parsed list, skipping other entries
+func stringsOf(value any) []string {
+	list, _ := value.([]any)
+	var s []string
+	for _, entry := range list {
+		if str, ok := entry.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
+
+// isRemote reports whether a reference is a remote base, which kustomize fetches at build time
+func isRemote(ref string) bool {
+	return strings.Contains(ref, "://") || strings.Contains(ref, "?ref=") ||
+		slices.ContainsFunc([]string{"github.com/", "gitlab.com/", "bitbucket.org/", "git@"}, func(prefix string) bool {
+			return strings.HasPrefix(ref, prefix)
+		})
+}
@@ -0,0 +1,131 @@
+package kustomize
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMissingReferences(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		dir           string
+		want          []string
+		wantErrSubstr string
+	}{
+		{
+			name: "all present",
+			files: map[string]string{
+				"kustomization.yaml": `resources: [all.yaml, base]
+patches:
+- path: patch.yaml
+configMapGenerator:
+- name: config
+  files: [app.conf, key=data/other.conf]
+  envs: [config.env]
+`,
+				"all.yaml":               "",
+				"patch.yaml":             "",
+				"app.conf":               "",
+				"data/other.conf":        "",
+				"config.env":             "",
+				"base/kustomization.yml": "resources: [service.yaml]\n",
+				"base/service.yaml":      "",
+			},
+			dir: ".",
+		},
+		{
+			name: "missing files",
+			files: map[string]string{
+				"kustomization.yaml": `resources: [all.yaml, missing.yaml]
+patchesStrategicMerge:
+- gone.yaml
+- |
+  kind: Deployment
+patchesJson6902:
+- path: ops.yaml
+secretGenerator:
+- name: creds
+  env: creds.env
+`,
+				"all.yaml": "",
+			},
+			dir:  ".",
+			want: []string{"kustomization.yaml: missing.yaml", "kustomization.yaml: gone.yaml", "kustomization.yaml: ops.yaml", "kustomization.yaml: creds.env"},
+		},
+		{
+			name: "missing in base",
+			files: map[string]string{
+				"overlays/prod/Kustomization":      "resources: [all.yaml, ../../base]\ncomponents: [../../components/ha]\n",
+				"overlays/prod/all.yaml":           "",
+				"base/kustomization.yaml":          "resources: [deployment.yaml]\n",
+				"components/ha/kustomization.yaml": "patches:\n- path: replicas.yaml\n",
+				"components/ha/replicas.yaml":      "",
+			},
+			dir:  "overlays/prod",
+			want: []string{"base/kustomization.yaml: deployment.yaml"},
+		},
+		{
+			name: "remote bases",
+			files: map[string]string{
+				"kustomization.yaml": "resources:\n- all.yaml\n- https://example.com/base.yaml\n- github.com/org/repo//base?ref=v1\n",
+				"all.yaml":           "",
+			},
+			dir: ".",
+		},
+		{
+			name:  "no kustomization",
+			files: map[string]string{"all.yaml": ""},
+			dir:   ".",
+		},
+		{
+			name:          "invalid kustomization",
+			files:         map[string]string{"kustomization.yaml": "resources: all.yaml\n"},
+			dir:           ".",
+			wantErrSubstr: "failed to parse kustomization.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, content := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+
+			got, err := MissingReferences(fsys, tt.dir)
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Fatalf("MissingReferences() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MissingReferences() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MissingReferences() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteReferences(t *testing.T) {
+	fsys := fstest.MapFS{
+		"overlays/prod/kustomization.yaml": &fstest.MapFile{Data: []byte("resources:\n- all.yaml\n- ../../base\n- https://example.com/base.yaml\n")},
+		"overlays/prod/all.yaml":           &fstest.MapFile{},
+		"base/kustomization.yaml":          &fstest.MapFile{Data: []byte("resources:\n- github.com/org/repo//base?ref=v1\n- https://example.com/base.yaml\n")},
+	}
+
+	got, err := RemoteReferences(fsys, "overlays/prod")
+	if err != nil {
+		t.Fatalf("RemoteReferences() error = %v, want nil", err)
+	}
+	// Bases are walked as they are found, before the references that follow them
+	want := []string{"github.com/org/repo//base?ref=v1", "https://example.com/base.yaml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemoteReferences() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+package kustomize
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// ReleaseInfoYaml is the file of the build root the release info resource is written to
+const ReleaseInfoYaml = "release-info.yaml"
+
+// ReleaseInfoName is the name of the release info ConfigMap, the source of replacements
+const ReleaseInfoName = "release-info"
+
+// LocalConfigAnnotation marks resources kustomize uses during the build, e.g. as the source of
+// replacements, but leaves out of its output
+const LocalConfigAnnotation = "config.kubernetes.io/local-config"
+
+// ReleaseInfo returns the release info resource, a ConfigMap holding data that kustomize leaves
+// out of the build output
+func ReleaseInfo(data map[string]string) ([]byte, error) {
+	resource := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"name":        ReleaseInfoName,
+			"annotations": map[string]any{LocalConfigAnnotation: "true"},
+		},
+		"data": data,
+	}
+	return manifest.Encode(resource)
+}
+
+// CheckReleaseInfo returns an error if files, keyed by slash-separated paths, contain the
+// release info file in the build root dir
+func CheckReleaseInfo(files map[string]string, dir string) error {
+	if releaseInfo := path.Join(dir, ReleaseInfoYaml); hasFile(files, releaseInfo) {
+		return fmt.Errorf("KustomizePluginData.files cannot contain '%s' - this file is reserved for the release info", releaseInfo)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package kustomize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReleaseInfo(t *testing.T) {
+	got, err := ReleaseInfo(map[string]string{"name": "web", "revision": "3"})
+	if err != nil {
+		t.Fatalf("ReleaseInfo() error = %v, want nil", err)
+	}
+	want := `apiVersion: v1
+data:
+  name: web
+  revision: "3"
+kind: ConfigMap
+metadata:
+  annotations:
+    config.kubernetes.io/local-config: "true"
+  name: release-info
+`
+	if string(got) != want {
+		t.Errorf("ReleaseInfo() =\n%s\nwant =\n%s", got, want)
+	}
+}
+
+func TestCheckReleaseInfo(t *testing.T) {
+	files := map[string]string{"overlays/prod/release-info.yaml": ""}
+	if err := CheckReleaseInfo(files, "."); err != nil {
+		t.Errorf("CheckReleaseInfo() error = %v, want nil", err)
+	}
+	err := CheckReleaseInfo(files, "overlays/prod")
+	if want := "cannot contain 'overlays/prod/release-info.yaml'"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("CheckReleaseInfo() error = %v, want error containing %q", err, want)
+	}
+}
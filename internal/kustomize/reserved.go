@@ -0,0 +1,64 @@
+package kustomize
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// AllYaml is the file of the build root the Helm manifests are written to
+const AllYaml = "all.yaml"
+
+// CheckReservedFiles returns an error if files, keyed by slash-separated paths, contain a file the
+// plugin reserves: all.yaml in the build root dir, any of the configured reserved names, or more
+// than one of the kustomization file names kustomize accepts (kustomization.yaml,
+// kustomization.yml and Kustomization) in the same directory, which kustomize refuses to build.
+func CheckReservedFiles(files map[string]string, dir string, reserved []string) error {
+	if allYaml := path.Join(dir, AllYaml); hasFile(files, allYaml) {
+		return fmt.Errorf("KustomizePluginData.files cannot contain '%s' - this file is reserved for Helm manifests", allYaml)
+	}
+	for _, name := range reserved {
+		if hasFile(files, name) {
+			return fmt.Errorf("KustomizePluginData.files cannot contain '%s' - this file is reserved by configuration", name)
+		}
+	}
+
+	kustomizations := map[string][]string{}
+	for name := range files {
+		if isKustomizationFile(name) {
+			dir := path.Dir(path.Clean(name))
+			kustomizations[dir] = append(kustomizations[dir], name)
+		}
+	}
+	dirs := make([]string, 0, len(kustomizations))
+	for dir := range kustomizations {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if names := kustomizations[dir]; len(names) > 1 {
+			sort.Strings(names)
+			return fmt.Errorf("KustomizePluginData.files cannot contain '%s' - kustomize accepts a single kustomization file per directory", strings.Join(names, "' and '"))
+		}
+	}
+	return nil
+}
+
+// hasFile reports whether files contain name, whatever the form of its path
+func hasFile(files map[string]string, name string) bool {
+	name = path.Clean(name)
+	for file := range files {
+		if path.Clean(file) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isKustomizationFile reports whether a file has one of the names kustomize accepts for a
+// kustomization
+func isKustomizationFile(name string) bool {
+	return slices.Contains(kustomizationFileNames, path.Base(name))
+}
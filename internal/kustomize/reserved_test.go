@@ -0,0 +1,101 @@
+package kustomize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckReservedFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         []string
+		dir           string
+		reserved      []string
+		wantErrSubstr string
+	}{
+		{
+			name:  "no reserved files",
+			files: []string{"kustomization.yaml", "patches/deployment.yaml"},
+			dir:   ".",
+		},
+		{
+			name:          "all.yaml",
+			files:         []string{"kustomization.yaml", "all.yaml"},
+			dir:           ".",
+			wantErrSubstr: "cannot contain 'all.yaml' - this file is reserved for Helm manifests",
+		},
+		{
+			name:          "all.yaml with an unclean path",
+			files:         []string{"./all.yaml"},
+			dir:           ".",
+			wantErrSubstr: "cannot contain 'all.yaml'",
+		},
+		{
+			name:          "all.yaml in the overlay",
+			files:         []string{"overlays/prod/all.yaml"},
+			dir:           "overlays/prod",
+			wantErrSubstr: "cannot contain 'overlays/prod/all.yaml'",
+		},
+		{
+			name:  "all.yaml outside the build root",
+			files: []string{"base/all.yaml", "overlays/prod/kustomization.yaml"},
+			dir:   "overlays/prod",
+		},
+		{
+			name:          "configured name",
+			files:         []string{"kustomization.yaml", "secrets.yaml"},
+			dir:           ".",
+			reserved:      []string{"values.yaml", "secrets.yaml"},
+			wantErrSubstr: "cannot contain 'secrets.yaml' - this file is reserved by configuration",
+		},
+		{
+			name:     "configured name absent",
+			files:    []string{"kustomization.yaml"},
+			dir:      ".",
+			reserved: []string{"secrets.yaml"},
+		},
+		{
+			name:          "kustomization.yaml and kustomization.yml",
+			files:         []string{"kustomization.yaml", "kustomization.yml"},
+			dir:           ".",
+			wantErrSubstr: "cannot contain 'kustomization.yaml' and 'kustomization.yml' - kustomize accepts a single kustomization file per directory",
+		},
+		{
+			name:          "kustomization.yaml and Kustomization",
+			files:         []string{"overlays/prod/Kustomization", "overlays/prod/kustomization.yaml"},
+			dir:           ".",
+			wantErrSubstr: "cannot contain 'overlays/prod/Kustomization' and 'overlays/prod/kustomization.yaml'",
+		},
+		{
+			name:          "all variants",
+			files:         []string{"Kustomization", "kustomization.yml", "kustomization.yaml"},
+			dir:           ".",
+			wantErrSubstr: "cannot contain 'Kustomization' and 'kustomization.yaml' and 'kustomization.yml'",
+		},
+		{
+			name:  "kustomizations in different directories",
+			files: []string{"kustomization.yaml", "base/kustomization.yml", "components/Kustomization"},
+			dir:   ".",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string]string, len(tt.files))
+			for _, name := range tt.files {
+				files[name] = ""
+			}
+
+			err := CheckReservedFiles(files, tt.dir, tt.reserved)
+			if tt.wantErrSubstr == "" {
+				if err != nil {
+					t.Errorf("CheckReservedFiles() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("CheckReservedFiles() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
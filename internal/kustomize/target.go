@@ -0,0 +1,198 @@
+package kustomize
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// Target is the target selector of a kustomize patch. Empty fields match everything. The plugin
+// data fields that change pod templates, such as inject and podClasses, select with it among the
+// resources with a pod template, so that an empty target selects all of them.
+type Target struct {
+	Group   string
+	Version string
+	Kind    string
+	// Name and Namespace are regular expressions that must match the whole value
+	Name               string
+	Namespace          string
+	LabelSelector      string
+	AnnotationSelector string
+}
+
+// fields returns the fields of the target with their names in the kustomization, in the order
+// they are described
+func (t *Target) fields() []struct {
+	name  string
+	value *string
+} {
+	return []struct {
+		name  string
+		value *string
+	}{
+		{"group", &t.Group},
+		{"version", &t.Version},
+		{"kind", &t.Kind},
+		{"name", &t.Name},
+		{"namespace", &t.Namespace},
+		{"labelSelector", &t.LabelSelector},
+		{"annotationSelector", &t.AnnotationSelector},
+	}
+}
+
+// TargetOf returns the target of a parsed patch target field
+func TargetOf(target map[string]any) Target {
+	var t Target
+	for _, field := range t.fields() {
+		*field.value, _ = target[field.name].(string)
+	}
+	return t
+}
+
+// toMap returns the target as the target field of a kustomization patch
+func (t *Target) toMap() map[string]any {
+	target := map[string]any{}
+	for _, field := range t.fields() {
+		if *field.value != "" {
+			target[field.name] = *field.value
+		}
+	}
+	return target
+}
+
+// ParseTarget parses a target written as comma-separated field=value pairs with the field names
+// of the kustomization, e.g. "kind=Deployment,name=web" or "labelSelector=app=web,tier in (a,b)".
+// Commas that are not followed by a field name belong to the previous value.
+func ParseTarget(s string) (Target, error) {
+	var t Target
+	fields := t.fields()
+	var current *string
+	for part := range strings.SplitSeq(s, ",") {
+		name, value, _ := strings.Cut(part, "=")
+		var field *string
+		for _, f := range fields {
+			if f.name == strings.TrimSpace(name) {
+				field = f.value
+			}
+		}
+		switch {
+		case field != nil:
+			current = field
+			*current = strings.TrimSpace(value)
+		case current != nil:
+			*current += "," + part
+		default:
+			return Target{}, fmt.Errorf("invalid target %q: unknown field in %q, expected one of group, version, kind, name, namespace, labelSelector, annotationSelector", s, part)
+		}
+	}
+
+	if err := t.Validate(); err != nil {
+		return Target{}, fmt.Errorf("invalid target %q: %w", s, err)
+	}
+	return t, nil
+}
+
+// Validate checks that the name and namespace patterns and the selectors of the target parse
+func (t Target) Validate() error {
+	for _, pattern := range []string{t.Name, t.Namespace} {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	for _, selector := range []string{t.LabelSelector, t.AnnotationSelector} {
+		if _, err := manifest.ParseSelector(selector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String describes the target, e.g. "kind Deployment, name web", or "all resources"
+func (t Target) String() string {
+	var parts []string
+	for _, field := range t.fields() {
+		if *field.value != "" {
+			parts = append(parts, field.name+" "+*field.value)
+		}
+	}
+	if len(parts) == 0 {
+		return "all resources"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Matches reports whether the target selects a resource. Invalid selectors match nothing.
+func (t Target) Matches(resource map[string]any) bool {
+	labels, err := manifest.ParseSelector(t.LabelSelector)
+	if err != nil {
+		return false
+	}
+	annotations, err := manifest.ParseSelector(t.AnnotationSelector)
+	if err != nil {
+		return false
+	}
+
+	id := manifest.IDOf(resource)
+	apiVersion, _ := resource["apiVersion"].(string)
+	version := apiVersion[strings.Index(apiVersion, "/")+1:]
+	metadata, _ := resource["metadata"].(map[string]any)
+	resourceLabels, _ := metadata["labels"].(map[string]any)
+	resourceAnnotations, _ := metadata["annotations"].(map[string]any)
+
+	return (t.Group == "" || t.Group == id.Group) &&
+		(t.Version == "" || t.Version == version) &&
+		(t.Kind == "" || t.Kind == id.Kind) &&
+		matchesPattern(t.Name, id.Name) &&
+		matchesPattern(t.Namespace, id.Namespace) &&
+		labels.Matches(resourceLabels) &&
+		annotations.Matches(resourceAnnotations)
+}
+
+// matchesPattern reports whether value fully matches the regular expression pattern, which
+// matches everything if it is empty
+func matchesPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	return err == nil && re.MatchString(value)
+}
+
+// UnmatchedTargets returns the patches of the kustomization whose target selects none of the
+// resources nor of the resources of its ConfigMap and Secret generators, e.g. "patches[1]
+// (web.yaml): target kind Deployment, name wbe matches no resource", as kustomize skips them
+// silently. Resources are matched by their input names, which is what patches see as they run
+// first.
+func (k *Kustomization) UnmatchedTargets(resources []map[string]any) []string {
+	candidates := slices.Clone(resources)
+	for _, field := range []string{"configMapGenerator", "secretGenerator"} {
+		kind := strings.TrimSuffix(strings.ToUpper(field[:1])+field[1:], "Generator")
+		for _, entry := range listOf(k.RawContent[field]) {
+			generator, _ := entry.(map[string]any)
+			metadata := map[string]any{"name": generator["name"]}
+			if namespace, ok := generator["namespace"]; ok {
+				metadata["namespace"] = namespace
+			}
+			candidates = append(candidates, map[string]any{"apiVersion": "v1", "kind": kind, "metadata": metadata})
+		}
+	}
+
+	var unmatched []string
+	for i, entry := range listOf(k.RawContent["patches"]) {
+		patch, _ := entry.(map[string]any)
+		fields, ok := patch["target"].(map[string]any)
+		if !ok {
+			continue
+		}
+		target := TargetOf(fields)
+		if slices.ContainsFunc(candidates, target.Matches) {
+			continue
+		}
+		file, _ := patch["path"].(string)
+		unmatched = append(unmatched, fmt.Sprintf("patches[%d]%s: target %s matches no resource", i, source(file), target))
+	}
+	return unmatched
+}
@@ -0,0 +1,188 @@
+package kustomize
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		want   Target
+	}{
+		{target: "kind=Deployment,name=web", want: Target{Kind: "Deployment", Name: "web"}},
+		{target: "group=apps, version=v1, kind=Deployment", want: Target{Group: "apps", Version: "v1", Kind: "Deployment"}},
+		{target: "name=web-.*,namespace=prod|staging", want: Target{Name: "web-.*", Namespace: "prod|staging"}},
+		{target: "labelSelector=app=web,tier in (a,b)", want: Target{LabelSelector: "app=web,tier in (a,b)"}},
+		{target: "annotationSelector=helm.sh/hook,kind=Job", want: Target{AnnotationSelector: "helm.sh/hook", Kind: "Job"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := ParseTarget(tt.target)
+			if err != nil {
+				t.Fatalf("ParseTarget() error = %v, want nil", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTarget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTarget_Errors(t *testing.T) {
+	tests := []struct {
+		target        string
+		wantErrSubstr string
+	}{
+		{target: "type=Deployment", wantErrSubstr: `unknown field in "type=Deployment"`},
+		{target: "name=web(", wantErrSubstr: "missing closing )"},
+		{target: "labelSelector=tier in a", wantErrSubstr: "must be in parentheses"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			_, err := ParseTarget(tt.target)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("ParseTarget() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestTarget_Matches(t *testing.T) {
+	resource := map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":        "web-frontend",
+			"namespace":   "prod",
+			"labels":      map[string]any{"tier": "frontend"},
+			"annotations": map[string]any{"owner": "team-web"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		target Target
+		want   bool
+	}{
+		{name: "empty", target: Target{}, want: true},
+		{name: "group version kind", target: Target{Group: "apps", Version: "v1", Kind: "Deployment"}, want: true},
+		{name: "other group", target: Target{Group: "extensions"}, want: false},
+		{name: "other version", target: Target{Version: "v1beta1"}, want: false},
+		{name: "other kind", target: Target{Kind: "StatefulSet"}, want: false},
+		{name: "name pattern", target: Target{Name: "web-.*"}, want: true},
+		{name: "partial name", target: Target{Name: "web"}, want: false},
+		{name: "namespace pattern", target: Target{Namespace: "prod|staging"}, want: true},
+		{name: "label selector", target: Target{LabelSelector: "tier in (frontend,backend)"}, want: true},
+		{name: "other label", target: Target{LabelSelector: "tier=backend"}, want: false},
+		{name: "annotation selector", target: Target{AnnotationSelector: "owner=team-web"}, want: true},
+		{name: "invalid selector", target: Target{LabelSelector: "tier in backend"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.Matches(resource); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTarget_String(t *testing.T) {
+	tests := []struct {
+		target Target
+		want   string
+	}{
+		{target: Target{}, want: "all resources"},
+		{target: Target{Kind: "Deployment", Name: "web"}, want: "kind Deployment, name web"},
+		{target: Target{Group: "apps", LabelSelector: "app=web"}, want: "group apps, labelSelector app=web"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.target.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKustomization_UnmatchedTargets(t *testing.T) {
+	resources := []map[string]any{
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web", "labels": map[string]any{"app": "web"}}},
+		{"apiVersion": "v1", "kind": "Service", "metadata": map[string]any{"name": "web"}},
+	}
+
+	tests := []struct {
+		name          string
+		kustomization string
+		want          []string
+	}{
+		{
+			name: "all matched",
+			kustomization: `patches:
+- path: web.yaml
+  target:
+    kind: Deployment
+    name: web
+- patch: "[]"
+  target:
+    labelSelector: app=web
+`,
+		},
+		{
+			name: "misspelt name",
+			kustomization: `patches:
+- path: web.yaml
+  target:
+    kind: Deployment
+    name: wbe
+- patch: "[]"
+  target:
+    kind: Service
+    namespace: prod
+`,
+			want: []string{
+				"patches[0] (web.yaml): target kind Deployment, name wbe matches no resource",
+				"patches[1]: target kind Service, namespace prod matches no resource",
+			},
+		},
+		{
+			name: "patch without target",
+			kustomization: `patches:
+- path: other.yaml
+`,
+		},
+		{
+			name: "generated resource",
+			kustomization: `configMapGenerator:
+- name: settings
+patches:
+- path: settings.yaml
+  target:
+    kind: ConfigMap
+    name: settings
+- path: secret.yaml
+  target:
+    kind: Secret
+    name: settings
+`,
+			want: []string{"patches[1] (secret.yaml): target kind Secret, name settings matches no resource"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomization([]byte(tt.kustomization))
+			if err != nil {
+				t.Fatalf("ParseKustomization() error = %v, want nil", err)
+			}
+			if got := k.UnmatchedTargets(resources); !slices.Equal(got, tt.want) {
+				t.Errorf("UnmatchedTargets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package kustomize
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+	"go.yaml.in/yaml/v4"
+)
+
+// replicaKinds are the kinds whose replicas the replicas field sets
+var replicaKinds = []string{"Deployment", "ReplicaSet", "ReplicationController", "StatefulSet"}
+
+// step is a transformer of a kustomization
+type step struct {
+	// label names the transformer and the field configuring it, e.g. "PatchTransformer patches[0] (web.yaml)"
+	label string
+	// description says what the transformer does to which resources
+	description string
+	// matches reports whether the transformer targets a resource; nil for transformers that
+	// apply to every resource
+	matches func(map[string]any) bool
+	// untraced is set for transformers whose targets are only known by running them
+	untraced bool
+	// removes says how the transformer may remove resources, e.g. "deletes"; empty if it cannot
+	removes string
+}
+
+// Trace returns the transformers of the kustomization in the order kustomize runs them, each with
+// the resources it targets among the input resources, e.g.
+// "PatchTransformer patches[0] (patches/web.yaml): Deployment.apps/web". Targets that match
+// nothing are reported as such, as kustomize skips them silently. Patch files are read from files,
+// keyed by slash-separated paths, relative to the directory dir of the kustomization. Resources
+// are matched by their input names, which is what patches see as they run first; the
+// transformers of bases and components are not traced.
+func (k *Kustomization) Trace(resources []map[string]any, files map[string]string, dir string) []string {
+	var lines []string
+	for _, s := range k.steps(files, dir) {
+		switch {
+		case s.untraced:
+			lines = append(lines, s.label+": not traced")
+		case s.matches == nil:
+			lines = append(lines, fmt.Sprintf("%s: all resources (%d)", s.label, len(resources)))
+		default:
+			var ids []string
+			for _, resource := range resources {
+				if s.matches(resource) {
+					ids = append(ids, manifest.IDOf(resource).String())
+				}
+			}
+			if len(ids) == 0 {
+				lines = append(lines, s.label+": matched nothing")
+				continue
+			}
+			lines = append(lines, s.label+": "+strings.Join(ids, ", "))
+		}
+	}
+	return lines
+}
+
+// Removals returns the transformers of the kustomization that may remove resources, with the
+// input resources they target, e.g. "PatchTransformer patches[0] (delete.yaml): deletes
+// Deployment.apps/web", to explain an empty build. Strategic merge patches with "$patch: delete"
+// remove their targets; custom transformers and components may remove anything. Files and dir
+// are as for Trace.
+func (k *Kustomization) Removals(resources []map[string]any, files map[string]string, dir string) []string {
+	var lines []string
+	for _, component := range listOf(k.RawContent["components"]) {
+		lines = append(lines, fmt.Sprintf("components %v: may remove resources with its patches", component))
+	}
+	for _, s := range k.steps(files, dir) {
+		switch {
+		case s.removes == "":
+		case s.matches == nil:
+			lines = append(lines, s.label+": "+s.removes)
+		default:
+			var ids []string
+			for _, resource := range resources {
+				if s.matches(resource) {
+					ids = append(ids, manifest.IDOf(resource).String())
+				}
+			}
+			if len(ids) == 0 {
+				ids = []string{"nothing"}
+			}
+			lines = append(lines, s.label+": "+s.removes+" "+strings.Join(ids, ", "))
+		}
+	}
+	return lines
+}
+
+// Explain returns a description of each transformer of the kustomization, in the order kustomize
+// runs them, and of the resources it selects, without building it or looking at the resources,
+// e.g. "PatchTransformer patches[1]: JSON 6902 patch (replace /spec/replicas) of kind Deployment,
+// name web". Files and dir are as for Trace.
+func (k *Kustomization) Explain(files map[string]string, dir string) []string {
+	var lines []string
+	for _, resource := range listOf(k.RawContent["resources"]) {
+		if resource != AllYaml {
+			lines = append(lines, fmt.Sprintf("resources %v: adds the resources of %v", resource, resource))
+		}
+	}
+	for _, component := range listOf(k.RawContent["components"]) {
+		lines = append(lines, fmt.Sprintf("components %v: applies the transformers of the component %v", component, component))
+	}
+	for _, field := range []string{"configMapGenerator", "secretGenerator"} {
+		kind := strings.TrimSuffix(strings.ToUpper(field[:1])+field[1:], "Generator")
+		for i, entry := range listOf(k.RawContent[field]) {
+			generator, _ := entry.(map[string]any)
+			lines = append(lines, fmt.Sprintf("%s[%d]: generates the %s %v", field, i, kind, generator["name"]))
+		}
+	}
+	for _, s := range k.steps(files, dir) {
+		lines = append(lines, s.label+": "+s.description)
+	}
+	return lines
+}
+
+// steps returns the transformers of the kustomization in the order kustomize runs them
+func (k *Kustomization) steps(files map[string]string, dir string) []step {
+	read := func(file string) (string, bool) {
+		content, ok := files[path.Join(dir, file)]
+		return content, ok
+	}
+	var steps []step
+
+	for i, entry := range listOf(k.RawContent["patchesStrategicMerge"]) {
+		file, _ := entry.(string)
+		content, ok := read(file)
+		s := patchStep(fmt.Sprintf("PatchStrategicMergeTransformer patchesStrategicMerge[%d]%s", i, source(file)), content, nil)
+		if !ok {
+			s.description = "patch file not in the plugin data"
+		}
+		steps = append(steps, s)
+	}
+	for i, entry := range listOf(k.RawContent["patches"]) {
+		patch, _ := entry.(map[string]any)
+		file, _ := patch["path"].(string)
+		content, _ := patch["patch"].(string)
+		ok := true
+		if file != "" {
+			content, ok = read(file)
+		}
+		target, _ := patch["target"].(map[string]any)
+		s := patchStep(fmt.Sprintf("PatchTransformer patches[%d]%s", i, source(file)), content, target)
+		if !ok {
+			s.description = "patch file not in the plugin data"
+		}
+		steps = append(steps, s)
+	}
+
+	if namespace, ok := k.RawContent["namespace"].(string); ok {
+		steps = append(steps, step{
+			label:       "NamespaceTransformer namespace " + namespace,
+			description: fmt.Sprintf("sets namespace %s on all namespaced resources", namespace),
+		})
+	}
+	if prefix, ok := k.RawContent["namePrefix"].(string); ok {
+		steps = append(steps, step{
+			label:       "PrefixTransformer namePrefix " + prefix,
+			description: fmt.Sprintf("adds name prefix %s to all resources and the references to them", prefix),
+		})
+	}
+	if suffix, ok := k.RawContent["nameSuffix"].(string); ok {
+		steps = append(steps, step{
+			label:       "SuffixTransformer nameSuffix " + suffix,
+			description: fmt.Sprintf("adds name suffix %s to all resources and the references to them", suffix),
+		})
+	}
+	if labels, ok := k.RawContent["commonLabels"].(map[string]any); ok {
+		steps = append(steps, step{
+			label:       "LabelTransformer commonLabels",
+			description: fmt.Sprintf("adds labels %s to all resources, their selectors and pod templates", pairs(labels)),
+		})
+	}
+	for i, entry := range listOf(k.RawContent["labels"]) {
+		label, _ := entry.(map[string]any)
+		labels, _ := label["pairs"].(map[string]any)
+		description := fmt.Sprintf("adds labels %s to all resources", pairs(labels))
+		if includeSelectors, _ := label["includeSelectors"].(bool); includeSelectors {
+			description += ", their selectors and pod templates"
+		} else if includeTemplates, _ := label["includeTemplates"].(bool); includeTemplates {
+			description += " and their pod templates"
+		}
+		steps = append(steps, step{label: fmt.Sprintf("LabelTransformer labels[%d]", i), description: description})
+	}
+	if annotations, ok := k.RawContent["commonAnnotations"].(map[string]any); ok {
+		steps = append(steps, step{
+			label:       "AnnotationsTransformer commonAnnotations",
+			description: fmt.Sprintf("adds annotations %s to all resources and their pod templates", pairs(annotations)),
+		})
+	}
+
+	for i, entry := range listOf(k.RawContent["patchesJson6902"]) {
+		patch, _ := entry.(map[string]any)
+		file, _ := patch["path"].(string)
+		content, _ := patch["patch"].(string)
+		if file != "" {
+			content, _ = read(file)
+		}
+		target, _ := patch["target"].(map[string]any)
+		if target == nil {
+			target = map[string]any{}
+		}
+		steps = append(steps, patchStep(fmt.Sprintf("PatchJson6902Transformer patchesJson6902[%d]%s", i, source(file)), content, target))
+	}
+	for i, entry := range listOf(k.RawContent["replicas"]) {
+		replica, _ := entry.(map[string]any)
+		name, _ := replica["name"].(string)
+		steps = append(steps, step{
+			label:       fmt.Sprintf("ReplicaCountTransformer replicas[%d] (%s)", i, name),
+			description: fmt.Sprintf("sets replicas to %v on the %s named %s", replica["count"], strings.Join(replicaKinds, ", "), name),
+			matches: func(resource map[string]any) bool {
+				id := manifest.IDOf(resource)
+				return id.Name == name && slices.Contains(replicaKinds, id.Kind)
+			},
+		})
+	}
+	for i, entry := range listOf(k.RawContent["images"]) {
+		image, _ := entry.(map[string]any)
+		name, _ := image["name"].(string)
+		steps = append(steps, step{
+			label:       fmt.Sprintf("ImageTagTransformer images[%d] (%s)", i, name),
+			description: fmt.Sprintf("replaces image %s with %s in all resources", name, imageReference(image)),
+			matches: func(resource map[string]any) bool {
+				return usesImage(resource, name)
+			},
+		})
+	}
+	for i := range listOf(k.RawContent["replacements"]) {
+		steps = append(steps, step{
+			label:       fmt.Sprintf("ReplacementTransformer replacements[%d]", i),
+			description: "copies a field of a source resource to the fields of its targets",
+			untraced:    true,
+		})
+	}
+	for _, transformer := range listOf(k.RawContent["transformers"]) {
+		steps = append(steps, step{
+			label:       fmt.Sprintf("transformers %v", transformer),
+			description: "runs a custom transformer",
+			untraced:    true,
+			removes:     "runs a custom transformer, which may remove resources",
+		})
+	}
+
+	return steps
+}
+
+// patchStep describes a patch. Strategic merge patches without a target select the resource
+// they name; JSON 6902 patches are recognized by their list of operations.
+func patchStep(label, content string, target map[string]any) step {
+	var patch any
+	_ = yaml.Unmarshal([]byte(content), &patch)
+
+	kind := "strategic merge patch"
+	if ops, ok := patch.([]any); ok {
+		kind = "JSON 6902 patch"
+		if len(ops) > 0 {
+			kind += " (" + operations(ops) + ")"
+		}
+	}
+
+	var removes string
+	if deletes(content) {
+		removes = "deletes"
+	}
+
+	if target != nil {
+		selector := TargetOf(target)
+		return step{label: label, description: kind + " of " + selector.String(), matches: selector.Matches, removes: removes}
+	}
+	object, ok := patch.(map[string]any)
+	if !ok {
+		return step{label: label, description: kind + " without a target", matches: func(map[string]any) bool { return false }}
+	}
+	want := manifest.IDOf(object)
+	return step{
+		label:       label,
+		description: kind + " of " + want.String(),
+		matches: func(resource map[string]any) bool {
+			id := manifest.IDOf(resource)
+			return id.Kind == want.Kind && id.Name == want.Name &&
+				(want.Group == "" || id.Group == want.Group) &&
+				(want.Namespace == "" || id.Namespace == want.Namespace)
+		},
+		removes: removes,
+	}
+}
+
+// deletes reports whether a strategic merge patch deletes the resources it targets, with a
+// "$patch: delete" directive at the top level of one of its documents
+func deletes(content string) bool {
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var doc map[string]any
+		if err := decoder.Decode(&doc); err != nil {
+			return false
+		}
+		if doc["$patch"] == "delete" {
+			return true
+		}
+	}
+}
+
+// operations formats the operations of a JSON 6902 patch, e.g. "replace /spec/replicas"
+func operations(ops []any) string {
+	parts := make([]string, 0, len(ops))
+	for _, entry := range ops {
+		op, _ := entry.(map[string]any)
+		parts = append(parts, fmt.Sprintf("%v %v", op["op"], op["path"]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pairs formats labels or annotations as sorted key=value pairs
+func pairs(m map[string]any) string {
+	parts := make([]string, 0, len(m))
+	for key, value := range m {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// imageReference formats the replacement of an images entry, e.g. "nginx:1.25"
+func imageReference(image map[string]any) string {
+	name, _ := image["name"].(string)
+	if newName, ok := image["newName"].(string); ok && newName != "" {
+		name = newName
+	}
+	if tag, ok := image["newTag"].(string); ok && tag != "" {
+		name += ":" + tag
+	}
+	if digest, ok := image["digest"].(string); ok && digest != "" {
+		name += "@" + digest
+	}
+	return name
+}
+
+// source formats the file a patch is read from, if any
+func source(file string) string {
+	if file == "" {
+		return ""
+	}
+	return " (" + file + ")"
+}
+
+// usesImage reports whether a resource has an image field referencing the image name
+func usesImage(value any, name string) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if image, ok := field.(string); ok && key == "image" && imageName(image) == name {
+				return true
+			}
+			if usesImage(field, name) {
+				return true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if usesImage(item, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// imageName strips the tag and digest of an image reference
+func imageName(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// listOf returns a field that holds a list, or nil
+func listOf(value any) []any {
+	list, _ := value.([]any)
+	return list
+}
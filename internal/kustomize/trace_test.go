@@ -0,0 +1,304 @@
+package kustomize
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKustomization_Trace(t *testing.T) {
+	resources := []map[string]any{
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "web", "labels": map[string]any{"tier": "frontend"}},
+			"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+				"containers": []any{map[string]any{"name": "web", "image": "nginx:1.24"}},
+			}}},
+		},
+		{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]any{"name": "worker"},
+		},
+		{
+			"apiVersion": "v1",
+			"kind":       "Service",
+			"metadata":   map[string]any{"name": "web"},
+		},
+	}
+	files := map[string]string{
+		"overlays/prod/kustomization.yaml": "",
+		"overlays/prod/web.yaml":           "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n",
+		"overlays/prod/typo.yaml":          "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: webb\n",
+	}
+
+	tests := []struct {
+		name          string
+		kustomization string
+		want          []string
+	}{
+		{
+			name: "patches",
+			kustomization: `patches:
+- path: web.yaml
+- path: typo.yaml
+- patch: |
+    kind: Service
+    metadata:
+      name: web
+- path: ops.yaml
+  target:
+    kind: Deployment
+    name: w.*
+- patch: "[]"
+  target:
+    labelSelector: tier=frontend
+patchesStrategicMerge:
+- web.yaml
+patchesJson6902:
+- path: ops.yaml
+  target:
+    group: apps
+    version: v1
+    kind: Deployment
+    name: web
+`,
+			want: []string{
+				"PatchStrategicMergeTransformer patchesStrategicMerge[0] (web.yaml): Deployment.apps/web",
+				"PatchTransformer patches[0] (web.yaml): Deployment.apps/web",
+				"PatchTransformer patches[1] (typo.yaml): matched nothing",
+				"PatchTransformer patches[2]: Service/web",
+				"PatchTransformer patches[3] (ops.yaml): Deployment.apps/web, Deployment.apps/worker",
+				"PatchTransformer patches[4]: Deployment.apps/web",
+				"PatchJson6902Transformer patchesJson6902[0] (ops.yaml): Deployment.apps/web",
+			},
+		},
+		{
+			name: "global transformers",
+			kustomization: `namespace: prod
+namePrefix: prod-
+commonLabels:
+  app: web
+labels:
+- pairs:
+    team: web
+commonAnnotations:
+  owner: team
+`,
+			want: []string{
+				"NamespaceTransformer namespace prod: all resources (3)",
+				"PrefixTransformer namePrefix prod-: all resources (3)",
+				"LabelTransformer commonLabels: all resources (3)",
+				"LabelTransformer labels[0]: all resources (3)",
+				"AnnotationsTransformer commonAnnotations: all resources (3)",
+			},
+		},
+		{
+			name: "replicas and images",
+			kustomization: `replicas:
+- name: web
+  count: 3
+- name: api
+  count: 2
+images:
+- name: nginx
+  newTag: "1.25"
+- name: redis
+  newTag: "7"
+replacements:
+- path: replacement.yaml
+transformers:
+- transformer.yaml
+`,
+			want: []string{
+				"ReplicaCountTransformer replicas[0] (web): Deployment.apps/web",
+				"ReplicaCountTransformer replicas[1] (api): matched nothing",
+				"ImageTagTransformer images[0] (nginx): Deployment.apps/web",
+				"ImageTagTransformer images[1] (redis): matched nothing",
+				"ReplacementTransformer replacements[0]: not traced",
+				"transformers transformer.yaml: not traced",
+			},
+		},
+		{
+			name:          "no transformers",
+			kustomization: "resources:\n- all.yaml\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomization([]byte(tt.kustomization))
+			if err != nil {
+				t.Fatalf("ParseKustomization() error = %v, want nil", err)
+			}
+			if got := k.Trace(resources, files, "overlays/prod"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Trace() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageName(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "nginx", want: "nginx"},
+		{image: "nginx:1.25", want: "nginx"},
+		{image: "nginx@sha256:abc", want: "nginx"},
+		{image: "registry:5000/team/nginx:1.25@sha256:abc", want: "registry:5000/team/nginx"},
+		{image: "registry:5000/team/nginx", want: "registry:5000/team/nginx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := imageName(tt.image); got != tt.want {
+				t.Errorf("imageName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKustomization_Explain(t *testing.T) {
+	files := map[string]string{
+		"web.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n",
+	}
+	kustomization := `resources:
+- all.yaml
+- ../base
+components:
+- ../components/monitoring
+configMapGenerator:
+- name: settings
+secretGenerator:
+- name: credentials
+patchesStrategicMerge:
+- missing.yaml
+patches:
+- path: web.yaml
+- patch: "[]"
+  target:
+    name: w.*
+    namespace: prod
+nameSuffix: -v2
+commonLabels:
+  app: web
+  tier: frontend
+labels:
+- pairs:
+    team: web
+  includeTemplates: true
+commonAnnotations:
+  owner: team
+patchesJson6902:
+- target:
+    kind: Service
+  patch: |
+    - op: add
+      path: /metadata/labels/x
+      value: y
+    - op: remove
+      path: /spec/type
+replicas:
+- name: web
+  count: 3
+images:
+- name: nginx
+  newName: registry.internal/nginx
+  digest: sha256:abc
+replacements:
+- path: replacement.yaml
+transformers:
+- transformer.yaml
+`
+	want := []string{
+		"resources ../base: adds the resources of ../base",
+		"components ../components/monitoring: applies the transformers of the component ../components/monitoring",
+		"configMapGenerator[0]: generates the ConfigMap settings",
+		"secretGenerator[0]: generates the Secret credentials",
+		"PatchStrategicMergeTransformer patchesStrategicMerge[0] (missing.yaml): patch file not in the plugin data",
+		"PatchTransformer patches[0] (web.yaml): strategic merge patch of Deployment.apps/web",
+		"PatchTransformer patches[1]: JSON 6902 patch of name w.*, namespace prod",
+		"SuffixTransformer nameSuffix -v2: adds name suffix -v2 to all resources and the references to them",
+		"LabelTransformer commonLabels: adds labels app=web, tier=frontend to all resources, their selectors and pod templates",
+		"LabelTransformer labels[0]: adds labels team=web to all resources and their pod templates",
+		"AnnotationsTransformer commonAnnotations: adds annotations owner=team to all resources and their pod templates",
+		"PatchJson6902Transformer patchesJson6902[0]: JSON 6902 patch (add /metadata/labels/x, remove /spec/type) of kind Service",
+		"ReplicaCountTransformer replicas[0] (web): sets replicas to 3 on the Deployment, ReplicaSet, ReplicationController, StatefulSet named web",
+		"ImageTagTransformer images[0] (nginx): replaces image nginx with registry.internal/nginx@sha256:abc in all resources",
+		"ReplacementTransformer replacements[0]: copies a field of a source resource to the fields of its targets",
+		"transformers transformer.yaml: runs a custom transformer",
+	}
+
+	k, err := ParseKustomization([]byte(kustomization))
+	if err != nil {
+		t.Fatalf("ParseKustomization() error = %v, want nil", err)
+	}
+	if got := k.Explain(files, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Explain() =\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestKustomization_Removals(t *testing.T) {
+	resources := []map[string]any{
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}},
+		{"apiVersion": "v1", "kind": "Service", "metadata": map[string]any{"name": "web", "labels": map[string]any{"tier": "frontend"}}},
+	}
+	files := map[string]string{
+		"delete.yaml":   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n$patch: delete\n",
+		"replicas.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  replicas: 3\n",
+		"multi.yaml":    "kind: ConfigMap\nmetadata:\n  name: a\n---\nkind: ConfigMap\nmetadata:\n  name: b\n$patch: delete\n",
+	}
+
+	tests := []struct {
+		name          string
+		kustomization string
+		want          []string
+	}{
+		{
+			name: "deleting patches",
+			kustomization: `patches:
+- path: delete.yaml
+- path: replicas.yaml
+- patch: |
+    kind: Service
+    metadata:
+      name: any
+    $patch: delete
+  target:
+    labelSelector: tier=frontend
+patchesStrategicMerge:
+- multi.yaml
+`,
+			want: []string{
+				"PatchStrategicMergeTransformer patchesStrategicMerge[0] (multi.yaml): deletes nothing",
+				"PatchTransformer patches[0] (delete.yaml): deletes Deployment.apps/web",
+				"PatchTransformer patches[2]: deletes Service/web",
+			},
+		},
+		{
+			name:          "components and custom transformers",
+			kustomization: "components:\n- ../components/cleanup\ntransformers:\n- filter.yaml\n",
+			want: []string{
+				"components ../components/cleanup: may remove resources with its patches",
+				"transformers filter.yaml: runs a custom transformer, which may remove resources",
+			},
+		},
+		{
+			name:          "nothing removes resources",
+			kustomization: "resources:\n- all.yaml\npatches:\n- path: replicas.yaml\nnamespace: prod\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseKustomization([]byte(tt.kustomization))
+			if err != nil {
+				t.Fatalf("ParseKustomization() error = %v, want nil", err)
+			}
+			if got := k.Removals(resources, files, "."); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Removals() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,495 @@
+package options
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const (
+	// ConfigFileName is the name of the user-wide config file inside $HELM_CONFIG_HOME
+	ConfigFileName = "helm-kustomize.yaml"
+	// LocalConfigFileName is the name of the repo-local config file in the working directory
+	LocalConfigFileName = ".helm-kustomize.yaml"
+)
+
+// userOnlyFields are the config fields that run commands, let charts run them, pull charts
+// over the network, send the output to a build cache or name files the render writes. Any
+// checked-out repository can ship a repo-local config file, so only the user config file may
+// set them.
+var userOnlyFields = []string{
+	"hooks", "allowedHooks", "enableHelm", "allowedChartRepos", "buildCache",
+	"sarif", "signature", "attestation", "digestCache", "workspaceCache",
+}
+
+// Environment variables overriding config file values
+const (
+	EnvOverlay            = "HELM_KUSTOMIZE_OVERLAY"
+	EnvValidate           = "HELM_KUSTOMIZE_VALIDATE"
+	EnvDebug              = "HELM_KUSTOMIZE_DEBUG"
+	EnvStrict             = "HELM_KUSTOMIZE_STRICT"
+	EnvReservedFilenames  = "HELM_KUSTOMIZE_RESERVED_FILENAMES"
+	EnvImages             = "HELM_KUSTOMIZE_SET_IMAGES"
+	EnvTenantPrefix       = "HELM_KUSTOMIZE_TENANT_PREFIX"
+	EnvTargetKubernetes   = "HELM_KUSTOMIZE_TARGET_K8S"
+	EnvMigrateAPIs        = "HELM_KUSTOMIZE_MIGRATE_APIS"
+	EnvCreateNamespace    = "HELM_KUSTOMIZE_CREATE_NAMESPACE"
+	EnvFailOnNoop         = "HELM_KUSTOMIZE_FAIL_ON_NOOP"
+	EnvAllowEmptyOutput   = "HELM_KUSTOMIZE_ALLOW_EMPTY_OUTPUT"
+	EnvCheckCount         = "HELM_KUSTOMIZE_CHECK_COUNT"
+	EnvPreserveUntouched  = "HELM_KUSTOMIZE_PRESERVE_UNTOUCHED"
+	EnvFileConflicts      = "HELM_KUSTOMIZE_FILE_CONFLICTS"
+	EnvStaleTempMaxAge    = "HELM_KUSTOMIZE_STALE_TEMP_MAX_AGE"
+	EnvSpillThreshold     = "HELM_KUSTOMIZE_SPILL_THRESHOLD"
+	EnvMaxProcs           = "HELM_KUSTOMIZE_MAX_PROCS"
+	EnvMemoryLimit        = "HELM_KUSTOMIZE_MEMORY_LIMIT"
+	EnvIndent             = "HELM_KUSTOMIZE_INDENT"
+	EnvSARIF              = "HELM_KUSTOMIZE_SARIF"
+	EnvIndentSequences    = "HELM_KUSTOMIZE_INDENT_SEQUENCES"
+	EnvKyvernoPolicies    = "HELM_KUSTOMIZE_KYVERNO_POLICIES"
+	EnvCRDSchemas         = "HELM_KUSTOMIZE_CRD_SCHEMAS"
+	EnvDryRunServer       = "HELM_KUSTOMIZE_DRY_RUN_SERVER"
+	EnvHelmfile           = "HELM_KUSTOMIZE_HELMFILE"
+	EnvSummary            = "HELM_KUSTOMIZE_SUMMARY"
+	EnvTrace              = "HELM_KUSTOMIZE_TRACE"
+	EnvAllowedHooks       = "HELM_KUSTOMIZE_ALLOWED_HOOKS"
+	EnvRegistryMirrors    = "HELM_KUSTOMIZE_REGISTRY_MIRRORS"
+	EnvAllowedNamespaces  = "HELM_KUSTOMIZE_ALLOWED_NAMESPACES"
+	EnvEnableHelm         = "HELM_KUSTOMIZE_ENABLE_HELM"
+	EnvAllowedChartRepos  = "HELM_KUSTOMIZE_ALLOWED_CHART_REPOS"
+	EnvGuardClusterScoped = "HELM_KUSTOMIZE_GUARD_CLUSTER_SCOPED"
+	EnvCheckImmutable     = "HELM_KUSTOMIZE_CHECK_IMMUTABLE"
+	EnvCheckRollback      = "HELM_KUSTOMIZE_CHECK_ROLLBACK"
+	EnvPinDigests         = "HELM_KUSTOMIZE_PIN_DIGESTS"
+	EnvDigestCache        = "HELM_KUSTOMIZE_DIGEST_CACHE"
+	EnvOffline            = "HELM_KUSTOMIZE_OFFLINE"
+	EnvWorkspaceCache     = "HELM_KUSTOMIZE_WORKSPACE_CACHE"
+	EnvBuildCache         = "HELM_KUSTOMIZE_BUILD_CACHE"
+	EnvBuildCacheTTL      = "HELM_KUSTOMIZE_BUILD_CACHE_TTL"
+	EnvSignature          = "HELM_KUSTOMIZE_SIGNATURE"
+	EnvSignKey            = "HELM_KUSTOMIZE_SIGN_KEY"
+	EnvAttestation        = "HELM_KUSTOMIZE_ATTESTATION"
+)
+
+// Load builds the options for an invocation: defaults, then the user config file, then the
+// repo-local config file, then environment variables and finally the given arguments.
+// With --terraform, config files and environment variables are ignored.
+func Load(args []string) (Options, error) {
+	return LoadWithFlags(args, nil)
+}
+
+// LoadWithFlags is like Load, but lets subcommands register additional flags parsed together
+// with the post-renderer arguments
+func LoadWithFlags(args []string, extraFlags func(fs *flag.FlagSet)) (Options, error) {
+	o := Default()
+
+	if !terraformMode(args) {
+		for _, path := range ConfigPaths() {
+			if err := o.loadFile(path, path == LocalConfigFileName); err != nil {
+				return Options{}, err
+			}
+		}
+
+		if err := o.ApplyEnv(); err != nil {
+			return Options{}, err
+		}
+	}
+
+	if err := o.parseArgs(args, extraFlags); err != nil {
+		return Options{}, err
+	}
+
+	return o, nil
+}
+
+// terraformMode reports whether args enable --terraform. It runs before the arguments are
+// parsed, since the mode decides whether config files and environment variables are read.
+func terraformMode(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "terraform" {
+			continue
+		}
+		if !hasValue {
+			return true
+		}
+		enabled, err := strconv.ParseBool(value)
+		return err == nil && enabled
+	}
+	return false
+}
+
+// ConfigPaths returns the config files in the order they are applied
+func ConfigPaths() []string {
+	var paths []string
+	if home := helmConfigHome(); home != "" {
+		paths = append(paths, filepath.Join(home, ConfigFileName))
+	}
+	return append(paths, LocalConfigFileName)
+}
+
+// helmConfigHome mirrors Helm's lookup of its configuration directory
+func helmConfigHome() string {
+	if home := os.Getenv("HELM_CONFIG_HOME"); home != "" {
+		return home
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "helm")
+	}
+	return ""
+}
+
+// LoadFile applies the settings from a YAML config file on top of o. A missing file is not an error.
+func (o *Options) LoadFile(path string) error {
+	return o.loadFile(path, false)
+}
+
+// loadFile is LoadFile for the user config file, or for the repo-local one if local is set,
+// which cannot set the userOnlyFields
+func (o *Options) loadFile(path string, local bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	if local {
+		var fields map[string]any
+		// Syntax errors are reported by the decoding below
+		_ = yaml.Unmarshal(data, &fields)
+		for _, field := range userOnlyFields {
+			if _, ok := fields[field]; ok {
+				return fmt.Errorf("invalid config file %s: %s can only be set in the user config file %s", path, field, filepath.Join("$HELM_CONFIG_HOME", ConfigFileName))
+			}
+		}
+	}
+
+	// Decoding into the existing struct only overwrites the fields present in the file
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(o); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// ApplyEnv applies HELM_KUSTOMIZE_* environment variables on top of o
+func (o *Options) ApplyEnv() error {
+	if overlay, ok := os.LookupEnv(EnvOverlay); ok {
+		o.Overlay = overlay
+	}
+
+	if level, ok := os.LookupEnv(EnvValidate); ok {
+		if err := o.Validate.Set(level); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvValidate, err)
+		}
+	}
+
+	if level, ok := os.LookupEnv(EnvGuardClusterScoped); ok {
+		if err := o.GuardClusterScoped.Set(level); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvGuardClusterScoped, err)
+		}
+	}
+
+	if level, ok := os.LookupEnv(EnvCheckImmutable); ok {
+		if err := o.CheckImmutable.Set(level); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvCheckImmutable, err)
+		}
+	}
+
+	if check, ok := os.LookupEnv(EnvCheckRollback); ok {
+		enabled, err := strconv.ParseBool(check)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvCheckRollback, err)
+		}
+		o.CheckRollback = enabled
+	}
+
+	if debug, ok := os.LookupEnv(EnvDebug); ok {
+		enabled, err := strconv.ParseBool(debug)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvDebug, err)
+		}
+		o.Debug = enabled
+	}
+
+	if strict, ok := os.LookupEnv(EnvStrict); ok {
+		enabled, err := strconv.ParseBool(strict)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvStrict, err)
+		}
+		o.Strict = enabled
+	}
+
+	if names, ok := os.LookupEnv(EnvReservedFilenames); ok {
+		o.ReservedFilenames = splitList(names)
+	}
+
+	if commands, ok := os.LookupEnv(EnvAllowedHooks); ok {
+		o.AllowedHooks = splitList(commands)
+	}
+
+	if namespaces, ok := os.LookupEnv(EnvAllowedNamespaces); ok {
+		o.AllowedNamespaces = splitList(namespaces)
+	}
+
+	if enable, ok := os.LookupEnv(EnvEnableHelm); ok {
+		enabled, err := strconv.ParseBool(enable)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvEnableHelm, err)
+		}
+		o.EnableHelm = enabled
+	}
+
+	if repos, ok := os.LookupEnv(EnvAllowedChartRepos); ok {
+		o.AllowedChartRepos = splitList(repos)
+	}
+
+	if images, ok := os.LookupEnv(EnvImages); ok {
+		o.Images = splitList(images)
+	}
+
+	if mirrors, ok := os.LookupEnv(EnvRegistryMirrors); ok {
+		o.RegistryMirrors = nil
+		for _, pair := range splitList(mirrors) {
+			if err := (*stringMap)(&o.RegistryMirrors).Set(pair); err != nil {
+				return fmt.Errorf("invalid %s: %w", EnvRegistryMirrors, err)
+			}
+		}
+	}
+
+	if prefix, ok := os.LookupEnv(EnvTenantPrefix); ok {
+		o.TenantPrefix = prefix
+	}
+
+	if target, ok := os.LookupEnv(EnvTargetKubernetes); ok {
+		o.TargetKubernetes = target
+	}
+
+	if migrate, ok := os.LookupEnv(EnvMigrateAPIs); ok {
+		enabled, err := strconv.ParseBool(migrate)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvMigrateAPIs, err)
+		}
+		o.MigrateAPIs = enabled
+	}
+
+	if create, ok := os.LookupEnv(EnvCreateNamespace); ok {
+		enabled, err := strconv.ParseBool(create)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvCreateNamespace, err)
+		}
+		o.CreateNamespace = enabled
+	}
+
+	if failOnNoop, ok := os.LookupEnv(EnvFailOnNoop); ok {
+		enabled, err := strconv.ParseBool(failOnNoop)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvFailOnNoop, err)
+		}
+		o.FailOnNoop = enabled
+	}
+
+	if allowEmpty, ok := os.LookupEnv(EnvAllowEmptyOutput); ok {
+		enabled, err := strconv.ParseBool(allowEmpty)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvAllowEmptyOutput, err)
+		}
+		o.AllowEmptyOutput = enabled
+	}
+
+	if checkCount, ok := os.LookupEnv(EnvCheckCount); ok {
+		enabled, err := strconv.ParseBool(checkCount)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvCheckCount, err)
+		}
+		o.CheckCount = enabled
+	}
+
+	if preserve, ok := os.LookupEnv(EnvPreserveUntouched); ok {
+		enabled, err := strconv.ParseBool(preserve)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvPreserveUntouched, err)
+		}
+		o.PreserveUntouched = enabled
+	}
+
+	if conflicts, ok := os.LookupEnv(EnvFileConflicts); ok {
+		if err := o.FileConflicts.Set(conflicts); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvFileConflicts, err)
+		}
+	}
+
+	if helmfile, ok := os.LookupEnv(EnvHelmfile); ok {
+		enabled, err := strconv.ParseBool(helmfile)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvHelmfile, err)
+		}
+		o.Helmfile = enabled
+	}
+
+	if dryRun, ok := os.LookupEnv(EnvDryRunServer); ok {
+		enabled, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvDryRunServer, err)
+		}
+		o.DryRunServer = enabled
+	}
+
+	if summary, ok := os.LookupEnv(EnvSummary); ok {
+		enabled, err := strconv.ParseBool(summary)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvSummary, err)
+		}
+		o.Summary = enabled
+	}
+
+	if trace, ok := os.LookupEnv(EnvTrace); ok {
+		enabled, err := strconv.ParseBool(trace)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvTrace, err)
+		}
+		o.Trace = enabled
+	}
+
+	if pin, ok := os.LookupEnv(EnvPinDigests); ok {
+		enabled, err := strconv.ParseBool(pin)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvPinDigests, err)
+		}
+		o.PinDigests = enabled
+	}
+
+	if path, ok := os.LookupEnv(EnvDigestCache); ok {
+		o.DigestCache = path
+	}
+
+	if path, ok := os.LookupEnv(EnvWorkspaceCache); ok {
+		o.WorkspaceCache = path
+	}
+
+	if location, ok := os.LookupEnv(EnvBuildCache); ok {
+		o.BuildCache = location
+	}
+
+	if ttl, ok := os.LookupEnv(EnvBuildCacheTTL); ok {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvBuildCacheTTL, err)
+		}
+		o.BuildCacheTTL = duration
+	}
+
+	if offline, ok := os.LookupEnv(EnvOffline); ok {
+		enabled, err := strconv.ParseBool(offline)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvOffline, err)
+		}
+		o.Offline = enabled
+	}
+
+	if maxAge, ok := os.LookupEnv(EnvStaleTempMaxAge); ok {
+		duration, err := time.ParseDuration(maxAge)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvStaleTempMaxAge, err)
+		}
+		o.StaleTempMaxAge = duration
+	}
+
+	if threshold, ok := os.LookupEnv(EnvSpillThreshold); ok {
+		size, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvSpillThreshold, err)
+		}
+		o.SpillThreshold = size
+	}
+
+	if procs, ok := os.LookupEnv(EnvMaxProcs); ok {
+		n, err := strconv.Atoi(procs)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvMaxProcs, err)
+		}
+		o.MaxProcs = n
+	}
+
+	if limit, ok := os.LookupEnv(EnvMemoryLimit); ok {
+		size, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvMemoryLimit, err)
+		}
+		o.MemoryLimit = size
+	}
+
+	if path, ok := os.LookupEnv(EnvSARIF); ok {
+		o.SARIF = path
+	}
+
+	if path, ok := os.LookupEnv(EnvSignature); ok {
+		o.Signature = path
+	}
+
+	if key, ok := os.LookupEnv(EnvSignKey); ok {
+		o.SignKey = key
+	}
+
+	if path, ok := os.LookupEnv(EnvAttestation); ok {
+		o.Attestation = path
+	}
+
+	if dir, ok := os.LookupEnv(EnvCRDSchemas); ok {
+		o.CRDSchemas = dir
+	}
+
+	if dir, ok := os.LookupEnv(EnvKyvernoPolicies); ok {
+		o.KyvernoPolicies = dir
+	}
+
+	if indent, ok := os.LookupEnv(EnvIndent); ok {
+		spaces, err := strconv.Atoi(indent)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvIndent, err)
+		}
+		o.Indent = spaces
+	}
+
+	if indentSequences, ok := os.LookupEnv(EnvIndentSequences); ok {
+		enabled, err := strconv.ParseBool(indentSequences)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvIndentSequences, err)
+		}
+		o.IndentSequences = enabled
+	}
+
+	return o.validate()
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
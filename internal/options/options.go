@@ -0,0 +1,550 @@
+package options
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/owhelm/helm-kustomize/internal/hooks"
+	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+// ValidationLevel controls what happens when the rendered output fails validation
+type ValidationLevel string
+
+const (
+	// ValidationNone skips validation
+	ValidationNone ValidationLevel = "none"
+	// ValidationWarn reports findings on stderr but keeps the output
+	ValidationWarn ValidationLevel = "warn"
+	// ValidationError fails the render when there are findings
+	ValidationError ValidationLevel = "error"
+)
+
+// Set implements flag.Value. A bare --validate is equivalent to --validate=error.
+func (v *ValidationLevel) Set(s string) error {
+	switch s {
+	case "true":
+		*v = ValidationError
+	case "false":
+		*v = ValidationNone
+	case string(ValidationNone), string(ValidationWarn), string(ValidationError):
+		*v = ValidationLevel(s)
+	default:
+		return fmt.Errorf("invalid validation level %q, must be one of none, warn, error", s)
+	}
+	return nil
+}
+
+// String implements flag.Value
+func (v *ValidationLevel) String() string {
+	if v == nil || *v == "" {
+		return string(ValidationNone)
+	}
+	return string(*v)
+}
+
+// IsBoolFlag allows --validate to be passed without a value
+func (v *ValidationLevel) IsBoolFlag() bool {
+	return true
+}
+
+// OutputFormat is the encoding of the rendered resources
+type OutputFormat string
+
+const (
+	// OutputYAML emits a multi-document YAML stream, as Helm expects
+	OutputYAML OutputFormat = "yaml"
+	// OutputJSON emits a JSON array of resources
+	OutputJSON OutputFormat = "json"
+	// OutputNDJSON emits one JSON resource per line
+	OutputNDJSON OutputFormat = "ndjson"
+)
+
+// Set implements flag.Value
+func (f *OutputFormat) Set(s string) error {
+	switch OutputFormat(s) {
+	case OutputYAML, OutputJSON, OutputNDJSON:
+		*f = OutputFormat(s)
+	default:
+		return fmt.Errorf("invalid output format %q, must be one of yaml, json, ndjson", s)
+	}
+	return nil
+}
+
+// String implements flag.Value
+func (f *OutputFormat) String() string {
+	if f == nil || *f == "" {
+		return string(OutputYAML)
+	}
+	return string(*f)
+}
+
+// FileConflicts controls which content a file gets when several KustomizePluginData documents of
+// a pipeline set it
+type FileConflicts string
+
+const (
+	// FileConflictsError fails the render
+	FileConflictsError FileConflicts = "error"
+	// FileConflictsFirstWins keeps the content of the first document
+	FileConflictsFirstWins FileConflicts = "first-wins"
+	// FileConflictsLastWins keeps the content of the last document
+	FileConflictsLastWins FileConflicts = "last-wins"
+)
+
+// Set implements flag.Value
+func (c *FileConflicts) Set(s string) error {
+	switch FileConflicts(s) {
+	case FileConflictsError, FileConflictsFirstWins, FileConflictsLastWins:
+		*c = FileConflicts(s)
+	default:
+		return fmt.Errorf("invalid file conflict policy %q, must be one of error, first-wins, last-wins", s)
+	}
+	return nil
+}
+
+// String implements flag.Value
+func (c *FileConflicts) String() string {
+	if c == nil || *c == "" {
+		return string(FileConflictsError)
+	}
+	return string(*c)
+}
+
+// Options configures a single post-render invocation.
+// Values are layered: defaults, config files, environment variables and finally arguments.
+type Options struct {
+	// Overlay is a directory inside the files map whose kustomization is built instead of the root one
+	Overlay string `yaml:"overlay"`
+	// Validate controls validation of the rendered output
+	Validate ValidationLevel `yaml:"validate"`
+	// Debug prints diagnostic information to stderr
+	Debug bool `yaml:"debug"`
+	// Strict turns warnings into errors
+	Strict bool `yaml:"strict"`
+	// ReservedFilenames are refused in KustomizePluginData.files in addition to all.yaml
+	ReservedFilenames []string `yaml:"reservedFilenames"`
+	// Diff replaces the output with a unified diff between the input and the rendered resources.
+	// It is meant for standalone use and cannot be set in config files.
+	Diff bool `yaml:"-"`
+	// ChangedOnly limits the output to resources that differ from the input or were generated.
+	// Like Diff, it cannot be set in config files.
+	ChangedOnly bool `yaml:"-"`
+	// Output is the encoding of the output; the zero value means YAML. Helm only accepts YAML,
+	// so like Diff, it is meant for standalone use and cannot be set in config files.
+	Output OutputFormat `yaml:"-"`
+	// Check validates the plugin data and resolves the references of the kustomization without
+	// running the build, and emits nothing. Like Diff, it cannot be set in config files.
+	Check bool `yaml:"-"`
+	// InputDir reads the manifests from a `helm template --output-dir` directory instead of stdin
+	// and writes the output back to the files of the templates it was rendered from. Like Diff,
+	// it cannot be set in config files.
+	InputDir string `yaml:"-"`
+	// OutputDir writes the output to one file per template in this directory, at the path Helm
+	// gives the template in `helm template --output-dir`, instead of stdout or back to InputDir.
+	// Like Diff, it cannot be set in config files.
+	OutputDir string `yaml:"-"`
+	// TenantPrefix deploys the chart for the tenant of the prefix, e.g. "team-a-": the names of the
+	// resources get the prefix, and they move to the tenant namespace with a tenant label
+	TenantPrefix string `yaml:"tenantPrefix"`
+	// Images are image overrides (name=[newName][:newTag][@digest]) added to the kustomization images field
+	Images []string `yaml:"images"`
+	// CheckImmutable controls what happens when the kustomization changes immutable fields, such as
+	// the selector of a Deployment; the zero value skips the check
+	CheckImmutable ValidationLevel `yaml:"checkImmutable"`
+	// CheckRollback warns about changes of the kustomization that are unsafe to roll back, such as
+	// changed selectors or generated ConfigMaps consumed by workloads
+	CheckRollback bool `yaml:"checkRollback"`
+	// GuardClusterScoped controls what happens when the kustomization adds or changes resources of
+	// cluster-scoped kinds; the zero value allows them
+	GuardClusterScoped ValidationLevel `yaml:"guardClusterScoped"`
+	// EnableHelm lets kustomize inflate the helmCharts of the kustomizations with Helm; charts
+	// using helmCharts fail without it
+	EnableHelm bool `yaml:"enableHelm"`
+	// AllowedChartRepos are the repositories, or prefixes of them, helmCharts may pull charts from
+	AllowedChartRepos []string `yaml:"allowedChartRepos"`
+	// AllowedNamespaces are the namespaces, or glob patterns of them, the output may target; all if empty
+	AllowedNamespaces []string `yaml:"allowedNamespaces"`
+	// RegistryMirrors are the registries, e.g. "docker.io", whose images are pulled from a mirror
+	// instead, e.g. "mirror.internal"
+	RegistryMirrors map[string]string `yaml:"registryMirrors"`
+	// PinDigests adds the digest of their tag to the container images of the output
+	PinDigests bool `yaml:"pinDigests"`
+	// DigestCache is the file caching the digests of PinDigests, in the Helm cache directory if empty
+	DigestCache string `yaml:"digestCache"`
+	// WorkspaceCache is a directory keeping the extracted files of earlier renders, restored by
+	// renders of the same files map instead of extracting them again; disabled if empty
+	WorkspaceCache string `yaml:"workspaceCache"`
+	// BuildCache keeps the output of kustomize builds, keyed by their files and the kustomize
+	// version, in a directory, a redis:// server or an s3:// bucket; disabled if empty. It can
+	// only be set in the user config file.
+	BuildCache string `yaml:"buildCache"`
+	// BuildCacheTTL is the age after which cached builds are built again; zero keeps them forever
+	BuildCacheTTL time.Duration `yaml:"buildCacheTTL"`
+	// Offline resolves the digests of PinDigests from the cache only, without registry access
+	Offline bool `yaml:"offline"`
+	// TargetKubernetes is the Kubernetes version (e.g. "1.31") the output is checked against for removed APIs
+	TargetKubernetes string `yaml:"targetKubernetes"`
+	// MigrateAPIs rewrites apiVersions removed in TargetKubernetes to their replacements
+	MigrateAPIs bool `yaml:"migrateAPIs"`
+	// CreateNamespace adds a Namespace object for the kustomization namespace if the output lacks one
+	CreateNamespace bool `yaml:"createNamespace"`
+	// FailOnNoop fails the render when kustomize did not change any resource
+	FailOnNoop bool `yaml:"failOnNoop"`
+	// AllowEmptyOutput accepts a build without resources from input that had some, which fails
+	// the render otherwise
+	AllowEmptyOutput bool `yaml:"allowEmptyOutput"`
+	// PreserveUntouched emits the original documents, with their comments and formatting, for the
+	// resources the build left unchanged
+	PreserveUntouched bool `yaml:"preserveUntouched"`
+	// FileConflicts controls what happens when the KustomizePluginData documents of a pipeline set
+	// the same file; the zero value fails the render
+	FileConflicts FileConflicts `yaml:"fileConflicts"`
+	// CheckCount fails the render when the build does not output the input resources plus those
+	// the generators declare, minus those the patches delete
+	CheckCount bool `yaml:"checkCount"`
+	// Terraform makes the arguments the only source of options, for the Terraform helm provider,
+	// which runs post-renderers with a restricted environment. It cannot be set in config files.
+	Terraform bool `yaml:"-"`
+	// Helmfile reads the helmfile release from the environment to select the overlay of its
+	// environment and fill in release placeholders in the plugin files
+	Helmfile bool `yaml:"helmfile"`
+	// DryRunServer submits the output to the cluster of the ambient kubeconfig with a server-side
+	// dry-run and fails the render if it is rejected
+	DryRunServer bool `yaml:"dryRunServer"`
+	// Summary prints a summary of the changes kustomize made, such as added labels or patched
+	// fields, to stderr after a render
+	Summary bool `yaml:"summary"`
+	// Trace prints the transformers of the kustomization in the order kustomize runs them, with
+	// the resources each of them targets, to stderr
+	Trace bool `yaml:"trace"`
+	// StaleTempMaxAge is the age after which temporary directories left behind by earlier runs
+	// are removed on startup; zero disables the cleanup
+	StaleTempMaxAge time.Duration `yaml:"staleTempMaxAge"`
+	// SpillThreshold is the size in bytes above which the Helm manifests are streamed to disk
+	// instead of being assembled in memory first; zero disables spilling
+	SpillThreshold int64 `yaml:"spillThreshold"`
+	// MaxProcs is the most CPUs the render, and the kubectl processes it starts, use at once,
+	// such as to decode documents concurrently; zero uses every CPU
+	MaxProcs int `yaml:"maxProcs"`
+	// MemoryLimit is the soft memory limit in bytes of the render and of the kubectl processes it
+	// starts, above which they collect garbage more aggressively; zero disables the limit
+	MemoryLimit int64 `yaml:"memoryLimit"`
+	// SARIF is a file the validation findings are written to in SARIF format
+	SARIF string `yaml:"sarif"`
+	// Signature is a file a cosign signature of the final output is written to
+	Signature string `yaml:"signature"`
+	// SignKey is the cosign key reference Signature is made with: a key file, env://VAR or a KMS URI
+	SignKey string `yaml:"signKey"`
+	// Attestation is a file the manifest of the inputs of the render is written to, whose digest
+	// annotates the output resources
+	Attestation string `yaml:"attestation"`
+	// CRDSchemas is a directory of CRDs or OpenAPI schemas that custom resources in the output are
+	// validated against
+	CRDSchemas string `yaml:"crdSchemas"`
+	// KyvernoPolicies is a directory of Kyverno policies applied to the output with the kyverno CLI
+	KyvernoPolicies string `yaml:"kyvernoPolicies"`
+	// Indent reformats the output with this many spaces per level; zero keeps the kustomize formatting
+	Indent int `yaml:"indent"`
+	// IndentSequences reformats the output with list items indented by a full level instead of
+	// counting the "- " towards the indentation
+	IndentSequences bool `yaml:"indentSequences"`
+	// Hooks are commands the output is piped through after the build, in order. They can only
+	// be set in the user config file, and only run if AllowedHooks has their command.
+	Hooks []hooks.Hook `yaml:"hooks"`
+	// AllowedHooks are the commands the hooks of the options and of the plugin data may run
+	AllowedHooks []string `yaml:"allowedHooks"`
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+// Set implements flag.Value
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// String implements flag.Value
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+// stringMap is a flag.Value collecting key=value pairs of a repeatable flag
+type stringMap map[string]string
+
+// Set implements flag.Value
+func (m *stringMap) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	(*m)[key] = value
+	return nil
+}
+
+// String implements flag.Value
+func (m *stringMap) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*m))
+	for key, value := range *m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+const (
+	// DefaultStaleTempMaxAge is the default for Options.StaleTempMaxAge
+	DefaultStaleTempMaxAge = 24 * time.Hour
+	// DefaultSpillThreshold is the default for Options.SpillThreshold
+	DefaultSpillThreshold = 64 << 20
+)
+
+// Default returns the options used when nothing is configured
+func Default() Options {
+	return Options{
+		Validate:        ValidationNone,
+		StaleTempMaxAge: DefaultStaleTempMaxAge,
+		SpillThreshold:  DefaultSpillThreshold,
+	}
+}
+
+// newFlagSet creates the post-renderer flag set, using the current values of o as defaults
+func newFlagSet(o *Options) *flag.FlagSet {
+	fs := flag.NewFlagSet("helm-kustomize", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&o.Overlay, "overlay", o.Overlay, "build the kustomization in this directory of the files map instead of the root one")
+	fs.Var(&o.Validate, "validate", "validate the rendered output: none, warn or error (a bare --validate means error)")
+	fs.StringVar(&o.CRDSchemas, "crd-schemas", o.CRDSchemas, "validate custom resources against the CRDs or schemas in this directory")
+	fs.StringVar(&o.SARIF, "sarif", o.SARIF, "write validation findings to this file in SARIF format")
+	fs.StringVar(&o.Signature, "signature", o.Signature, "write a cosign signature of the output to this file")
+	fs.StringVar(&o.Attestation, "attestation", o.Attestation, "write a manifest of the inputs of the render to this file and annotate the output with its digest")
+	fs.StringVar(&o.SignKey, "sign-key", o.SignKey, "cosign key reference the --signature is made with: a key file, env://VAR or a KMS URI")
+	fs.StringVar(&o.KyvernoPolicies, "kyverno-policies", o.KyvernoPolicies, "apply the Kyverno policies in this directory to the output")
+	fs.BoolVar(&o.Debug, "debug", o.Debug, "print diagnostic information to stderr")
+	fs.BoolVar(&o.Strict, "strict", o.Strict, "fail the render if any warning is reported")
+	fs.DurationVar(&o.StaleTempMaxAge, "stale-temp-max-age", o.StaleTempMaxAge, "remove temporary directories of earlier runs older than this on startup (0 disables)")
+	fs.Int64Var(&o.SpillThreshold, "spill-threshold", o.SpillThreshold, "stream Helm manifests larger than this many bytes to disk instead of buffering them (0 disables)")
+	fs.IntVar(&o.MaxProcs, "max-procs", o.MaxProcs, "use at most this many CPUs at once for the render and kubectl (0 uses every CPU)")
+	fs.Int64Var(&o.MemoryLimit, "memory-limit", o.MemoryLimit, "soft memory limit in bytes of the render and kubectl (0 disables)")
+	fs.IntVar(&o.Indent, "indent", o.Indent, "reformat the output with this many spaces per indentation level (2-9, 0 keeps the kustomize formatting)")
+	fs.BoolVar(&o.IndentSequences, "indent-sequences", o.IndentSequences, "reformat the output with list items indented by a full level instead of counting the dash as indentation")
+	fs.BoolVar(&o.Diff, "diff", o.Diff, "print a unified diff between the input and the rendered resources instead of the output")
+	fs.BoolVar(&o.Check, "check", o.Check, "validate the plugin data and the references of the kustomization without building, and print nothing")
+	fs.StringVar(&o.InputDir, "input-dir", o.InputDir, "read the manifests from a helm template --output-dir directory and write the output back to its files")
+	fs.StringVar(&o.OutputDir, "output-dir", o.OutputDir, "write the output to one file per template in this directory, at the paths of helm template --output-dir")
+	fs.Var(&o.Output, "output", "encode the output as yaml, json (an array of resources) or ndjson (one resource per line)")
+	fs.BoolVar(&o.FailOnNoop, "fail-on-noop", o.FailOnNoop, "fail if the kustomize build did not change any resource")
+	fs.BoolVar(&o.PreserveUntouched, "preserve-untouched", o.PreserveUntouched, "emit the original documents, with comments and formatting, for resources the build did not change")
+	fs.BoolVar(&o.CheckCount, "check-count", o.CheckCount, "fail if the build output is not the input resources plus generated minus deleted ones")
+	fs.BoolVar(&o.AllowEmptyOutput, "allow-empty-output", o.AllowEmptyOutput, "accept a build that removed every input resource instead of failing")
+	fs.Var(&o.FileConflicts, "file-conflicts", "resolve files set by several KustomizePluginData documents of a pipeline: error, first-wins or last-wins")
+	fs.BoolVar(&o.Terraform, "terraform", o.Terraform, "Terraform helm provider mode: ignore config files and environment variables")
+	fs.BoolVar(&o.Helmfile, "helmfile", o.Helmfile, "select the overlay and fill in placeholders from the helmfile release")
+	fs.BoolVar(&o.DryRunServer, "dry-run-server", o.DryRunServer, "verify the output with a server-side dry-run against the cluster")
+	fs.BoolVar(&o.Summary, "summary", o.Summary, "print a summary of the applied transformations to stderr")
+	fs.BoolVar(&o.Trace, "trace", o.Trace, "print the transformers of the kustomization and the resources they target to stderr")
+	fs.BoolVar(&o.ChangedOnly, "changed-only", o.ChangedOnly, "only output resources that differ from the input or were generated")
+	fs.Var((*stringList)(&o.AllowedHooks), "allow-hook", "allow the plugin data to run this command as a post-build hook (repeatable)")
+	fs.StringVar(&o.TenantPrefix, "tenant-prefix", o.TenantPrefix, "deploy for the tenant of this name prefix (e.g. team-a-), in its namespace and with a tenant label")
+	fs.Var((*stringList)(&o.Images), "set-image", "override an image as name=[newName][:newTag][@digest] (repeatable)")
+	fs.Var(&o.CheckImmutable, "check-immutable", "report immutable fields changed by the kustomization: none, warn or error (a bare --check-immutable means error)")
+	fs.BoolVar(&o.CheckRollback, "check-rollback", o.CheckRollback, "warn about changes of the kustomization that are unsafe to roll back")
+	fs.Var(&o.GuardClusterScoped, "guard-cluster-scoped", "report cluster-scoped resources added or changed by the kustomization: none, warn or error (a bare --guard-cluster-scoped means error)")
+	fs.BoolVar(&o.EnableHelm, "enable-helm", o.EnableHelm, "let the helmCharts of kustomizations inflate charts with helm")
+	fs.Var((*stringList)(&o.AllowedChartRepos), "allow-chart-repo", "let helmCharts pull charts from this repository or the ones under it (repeatable)")
+	fs.Var((*stringList)(&o.AllowedNamespaces), "allow-namespace", "fail if the output targets a namespace other than this one or glob pattern (repeatable)")
+	fs.Var((*stringMap)(&o.RegistryMirrors), "registry-mirror", "pull the images of a registry from a mirror, as registry=mirror, e.g. docker.io=mirror.internal (repeatable)")
+	fs.BoolVar(&o.PinDigests, "pin-digests", o.PinDigests, "add the digest of their tag to the container images of the output, resolved with crane")
+	fs.StringVar(&o.DigestCache, "digest-cache", o.DigestCache, "cache the digests of --pin-digests in this file (defaults to the Helm cache directory)")
+	fs.StringVar(&o.WorkspaceCache, "workspace-cache", o.WorkspaceCache, "reuse the extracted files of earlier renders of the same plugin data, kept in this directory")
+	fs.StringVar(&o.BuildCache, "build-cache", o.BuildCache, "reuse the kustomize builds of earlier renders, kept in this directory, redis:// server or s3:// bucket")
+	fs.DurationVar(&o.BuildCacheTTL, "build-cache-ttl", o.BuildCacheTTL, "build again the cached builds older than this (0 keeps them forever)")
+	fs.BoolVar(&o.Offline, "offline", o.Offline, "resolve the digests of --pin-digests from the cache only, failing for images missing from it")
+	fs.StringVar(&o.TargetKubernetes, "target-k8s", o.TargetKubernetes, "report API versions removed in this Kubernetes version (e.g. 1.31)")
+	fs.BoolVar(&o.CreateNamespace, "create-namespace", o.CreateNamespace, "add a Namespace object for the kustomization namespace if the output has none")
+	fs.BoolVar(&o.MigrateAPIs, "migrate-apis", o.MigrateAPIs, "rewrite API versions removed in the --target-k8s version to their replacements")
+	return fs
+}
+
+// ParseArgs applies post-renderer arguments (passed by Helm via --post-renderer-args) on top of o
+func (o *Options) ParseArgs(args []string) error {
+	return o.parseArgs(args, nil)
+}
+
+// parseArgs parses args, letting extraFlags register additional flags (e.g. for subcommands)
+func (o *Options) parseArgs(args []string, extraFlags func(fs *flag.FlagSet)) error {
+	fs := newFlagSet(o)
+	if extraFlags != nil {
+		extraFlags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	return o.validate()
+}
+
+// tenantPrefix matches tenant prefixes, a namespace name (DNS label) followed by a dash
+var tenantPrefix = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?-$`)
+
+// validate checks option values that cannot be checked while parsing
+func (o *Options) validate() error {
+	switch o.Validate {
+	case ValidationNone, ValidationWarn, ValidationError:
+	default:
+		return fmt.Errorf("invalid validation level %q, must be one of none, warn, error", o.Validate)
+	}
+
+	switch o.CheckImmutable {
+	case "", ValidationNone, ValidationWarn, ValidationError:
+	default:
+		return fmt.Errorf("invalid immutable field check level %q, must be one of none, warn, error", o.CheckImmutable)
+	}
+
+	switch o.GuardClusterScoped {
+	case "", ValidationNone, ValidationWarn, ValidationError:
+	default:
+		return fmt.Errorf("invalid cluster-scoped guard level %q, must be one of none, warn, error", o.GuardClusterScoped)
+	}
+
+	switch o.FileConflicts {
+	case "", FileConflictsError, FileConflictsFirstWins, FileConflictsLastWins:
+	default:
+		return fmt.Errorf("invalid file conflict policy %q, must be one of error, first-wins, last-wins", o.FileConflicts)
+	}
+
+	if o.SARIF != "" && o.Validate == ValidationNone && o.TargetKubernetes == "" && o.CRDSchemas == "" {
+		return fmt.Errorf("SARIF output requires validation, a target Kubernetes version or CRD schemas")
+	}
+
+	if (o.Signature == "") != (o.SignKey == "") {
+		return fmt.Errorf("signing the output requires both a signature file and a signing key")
+	}
+
+	if o.StaleTempMaxAge < 0 {
+		return fmt.Errorf("stale temp max age must not be negative, got %s", o.StaleTempMaxAge)
+	}
+
+	if o.BuildCacheTTL < 0 {
+		return fmt.Errorf("build cache TTL must not be negative, got %s", o.BuildCacheTTL)
+	}
+
+	if o.SpillThreshold < 0 {
+		return fmt.Errorf("spill threshold must not be negative, got %d", o.SpillThreshold)
+	}
+
+	if o.MaxProcs < 0 {
+		return fmt.Errorf("max procs must not be negative, got %d", o.MaxProcs)
+	}
+
+	if o.MemoryLimit < 0 {
+		return fmt.Errorf("memory limit must not be negative, got %d", o.MemoryLimit)
+	}
+
+	if o.Indent != 0 && (o.Indent < 2 || o.Indent > 9) {
+		return fmt.Errorf("indent must be between 2 and 9, got %d", o.Indent)
+	}
+
+	if o.Diff && o.ChangedOnly {
+		return fmt.Errorf("diff and changed-only output modes cannot be combined")
+	}
+
+	if o.Check && (o.Diff || o.ChangedOnly) {
+		return fmt.Errorf("check mode prints nothing and cannot be combined with diff or changed-only output")
+	}
+
+	if o.Check && o.Signature != "" {
+		return fmt.Errorf("check mode prints nothing, so there is no output to sign")
+	}
+
+	// Check, diff and changed-only output is not the render, and every resource changes with the
+	// annotation, so none would be left untouched
+	if o.Attestation != "" && (o.Check || o.Diff || o.ChangedOnly || o.PreserveUntouched) {
+		return fmt.Errorf("an attestation cannot be combined with check, diff, changed-only or preserve-untouched")
+	}
+
+	if (o.InputDir != "" || o.OutputDir != "") && (o.Diff || o.ChangedOnly || o.Signature != "" || (o.Output != "" && o.Output != OutputYAML)) {
+		return fmt.Errorf("writing the output to files cannot be combined with diff, changed-only, JSON output or a signature")
+	}
+
+	if o.Diff && o.Output != "" && o.Output != OutputYAML {
+		return fmt.Errorf("diff output cannot be encoded as %s", o.Output)
+	}
+
+	if o.Overlay != "" && !filepath.IsLocal(o.Overlay) {
+		return fmt.Errorf("overlay %q must be a relative path inside the files map", o.Overlay)
+	}
+
+	if o.TenantPrefix != "" && !tenantPrefix.MatchString(o.TenantPrefix) {
+		return fmt.Errorf("invalid tenant prefix %q, must be a lowercase namespace name followed by a dash, e.g. team-a-", o.TenantPrefix)
+	}
+
+	for _, image := range o.Images {
+		if _, err := kustomize.ParseImage(image); err != nil {
+			return err
+		}
+	}
+
+	for _, namespace := range o.AllowedNamespaces {
+		if _, err := path.Match(namespace, ""); err != nil {
+			return fmt.Errorf("invalid allowed namespace %q: %w", namespace, err)
+		}
+	}
+
+	for registry, mirror := range o.RegistryMirrors {
+		if registry == "" || strings.Contains(registry, "/") || mirror == "" {
+			return fmt.Errorf("invalid registry mirror %q=%q, expected a registry host and a mirror, e.g. docker.io=mirror.internal", registry, mirror)
+		}
+	}
+
+	for i, hook := range o.Hooks {
+		if hook.Command == "" {
+			return fmt.Errorf("hooks[%d] must have a command", i)
+		}
+	}
+
+	if o.Offline && !o.PinDigests {
+		return fmt.Errorf("offline mode requires pinning digests")
+	}
+
+	if o.TargetKubernetes != "" {
+		if _, err := version.Parse(o.TargetKubernetes); err != nil {
+			return fmt.Errorf("invalid target Kubernetes version: %w", err)
+		}
+	} else if o.MigrateAPIs {
+		return fmt.Errorf("migrating APIs requires a target Kubernetes version")
+	}
+	return nil
+}
+
+// PrintUsage writes the list of supported post-renderer arguments to w
+func PrintUsage(w io.Writer) {
+	defaults := Default()
+	fs := newFlagSet(&defaults)
+	fs.SetOutput(w)
+	fmt.Fprintln(w, "Usage: helm-kustomize [flags]")
+	fmt.Fprintln(w, "\nFlags:")
+	fs.PrintDefaults()
+}
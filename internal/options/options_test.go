@@ -0,0 +1,487 @@
+package options
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want Options
+	}{
+		{
+			name: "no arguments",
+			args: nil,
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold},
+		},
+		{
+			name: "overlay with separate value",
+			args: []string{"--overlay", "overlays/prod"},
+			want: Options{Overlay: "overlays/prod", Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold},
+		},
+		{
+			name: "overlay with equals",
+			args: []string{"--overlay=overlays/prod"},
+			want: Options{Overlay: "overlays/prod", Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold},
+		},
+		{
+			name: "bare validate",
+			args: []string{"--validate"},
+			want: Options{Validate: ValidationError, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold},
+		},
+		{
+			name: "validate with level",
+			args: []string{"--validate=warn"},
+			want: Options{Validate: ValidationWarn, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold},
+		},
+		{
+			name: "debug",
+			args: []string{"-debug"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Debug: true},
+		},
+		{
+			name: "stale temp max age",
+			args: []string{"--stale-temp-max-age=1h"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: time.Hour, SpillThreshold: DefaultSpillThreshold},
+		},
+		{
+			name: "spill threshold",
+			args: []string{"--spill-threshold=0"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge},
+		},
+		{
+			name: "resource limits",
+			args: []string{"--max-procs=2", "--memory-limit=536870912"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, MaxProcs: 2, MemoryLimit: 512 << 20},
+		},
+		{
+			name: "output style",
+			args: []string{"--indent=4", "--indent-sequences"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Indent: 4, IndentSequences: true},
+		},
+		{
+			name: "output format",
+			args: []string{"--output", "ndjson"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Output: OutputNDJSON},
+		},
+		{
+			name: "sarif",
+			args: []string{"--validate=warn", "--sarif", "results.sarif"},
+			want: Options{Validate: ValidationWarn, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, SARIF: "results.sarif"},
+		},
+		{
+			name: "CRD schemas with SARIF",
+			args: []string{"--crd-schemas", "schemas", "--sarif", "results.sarif"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, CRDSchemas: "schemas", SARIF: "results.sarif"},
+		},
+		{
+			name: "server-side dry-run",
+			args: []string{"--dry-run-server"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, DryRunServer: true},
+		},
+		{
+			name: "summary",
+			args: []string{"--summary"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Summary: true},
+		},
+		{
+			name: "trace",
+			args: []string{"--trace"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Trace: true},
+		},
+		{
+			name: "allowed hooks",
+			args: []string{"--allow-hook", "cost-annotator", "--allow-hook", "sidecar-injector"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, AllowedHooks: []string{"cost-annotator", "sidecar-injector"}},
+		},
+		{
+			name: "helmfile",
+			args: []string{"--helmfile"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Helmfile: true},
+		},
+		{
+			name: "kyverno policies",
+			args: []string{"--kyverno-policies", "policies/kyverno"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, KyvernoPolicies: "policies/kyverno"},
+		},
+		{
+			name: "strict",
+			args: []string{"--strict"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Strict: true},
+		},
+		{
+			name: "diff",
+			args: []string{"--diff"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Diff: true},
+		},
+		{
+			name: "allow empty output",
+			args: []string{"--allow-empty-output"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, AllowEmptyOutput: true},
+		},
+		{
+			name: "file conflicts",
+			args: []string{"--file-conflicts", "first-wins"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, FileConflicts: FileConflictsFirstWins},
+		},
+		{
+			name: "preserve untouched",
+			args: []string{"--preserve-untouched"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, PreserveUntouched: true},
+		},
+		{
+			name: "check count",
+			args: []string{"--check-count"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, CheckCount: true},
+		},
+		{
+			name: "check",
+			args: []string{"--check"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Check: true},
+		},
+		{
+			name: "repeated set-image",
+			args: []string{"--set-image", "nginx=registry.internal/nginx:1.25", "--set-image=redis=:7.2"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Images: []string{"nginx=registry.internal/nginx:1.25", "redis=:7.2"}},
+		},
+		{
+			name: "repeated registry-mirror",
+			args: []string{"--registry-mirror", "docker.io=mirror.internal", "--registry-mirror=quay.io=mirror.internal/quay"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, RegistryMirrors: map[string]string{"docker.io": "mirror.internal", "quay.io": "mirror.internal/quay"}},
+		},
+		{
+			name: "pin digests offline",
+			args: []string{"--pin-digests", "--offline", "--digest-cache", "digests.json"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, PinDigests: true, Offline: true, DigestCache: "digests.json"},
+		},
+		{
+			name: "workspace cache",
+			args: []string{"--workspace-cache", "/var/cache/workspaces"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, WorkspaceCache: "/var/cache/workspaces"},
+		},
+		{
+			name: "build cache",
+			args: []string{"--build-cache", "s3://ci-cache/builds", "--build-cache-ttl", "168h"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, BuildCache: "s3://ci-cache/builds", BuildCacheTTL: 168 * time.Hour},
+		},
+		{
+			name: "attestation",
+			args: []string{"--attestation", "inputs.json"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Attestation: "inputs.json"},
+		},
+		{
+			name: "signature",
+			args: []string{"--signature", "output.sig", "--sign-key", "awskms:///alias/render"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, Signature: "output.sig", SignKey: "awskms:///alias/render"},
+		},
+		{
+			name: "repeated allow-namespace",
+			args: []string{"--allow-namespace", "team-a", "--allow-namespace", "team-b-*"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, AllowedNamespaces: []string{"team-a", "team-b-*"}},
+		},
+		{
+			name: "bare guard-cluster-scoped",
+			args: []string{"--guard-cluster-scoped"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, GuardClusterScoped: ValidationError},
+		},
+		{
+			name: "guard-cluster-scoped warn",
+			args: []string{"--guard-cluster-scoped=warn"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, GuardClusterScoped: ValidationWarn},
+		},
+		{
+			name: "bare check-immutable",
+			args: []string{"--check-immutable"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, CheckImmutable: ValidationError},
+		},
+		{
+			name: "enable helm",
+			args: []string{"--enable-helm", "--allow-chart-repo", "https://helm.datadoghq.com", "--allow-chart-repo", "oci://registry.internal/charts"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, EnableHelm: true, AllowedChartRepos: []string{"https://helm.datadoghq.com", "oci://registry.internal/charts"}},
+		},
+		{
+			name: "tenant prefix",
+			args: []string{"--tenant-prefix", "team-a-"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, TenantPrefix: "team-a-"},
+		},
+		{
+			name: "check-rollback",
+			args: []string{"--check-rollback"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, CheckRollback: true},
+		},
+		{
+			name: "target kubernetes",
+			args: []string{"--target-k8s", "1.31"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, TargetKubernetes: "1.31"},
+		},
+		{
+			name: "changed only",
+			args: []string{"--changed-only"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, ChangedOnly: true},
+		},
+		{
+			name: "input dir",
+			args: []string{"--input-dir", "manifests"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, InputDir: "manifests"},
+		},
+		{
+			name: "output dir",
+			args: []string{"--output-dir", "rendered"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, OutputDir: "rendered"},
+		},
+		{
+			name: "fail on noop",
+			args: []string{"--fail-on-noop"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, FailOnNoop: true},
+		},
+		{
+			name: "create namespace",
+			args: []string{"--create-namespace"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, CreateNamespace: true},
+		},
+		{
+			name: "migrate apis",
+			args: []string{"--target-k8s=1.25", "--migrate-apis"},
+			want: Options{Validate: ValidationNone, StaleTempMaxAge: DefaultStaleTempMaxAge, SpillThreshold: DefaultSpillThreshold, TargetKubernetes: "1.25", MigrateAPIs: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Default()
+			if err := opts.ParseArgs(tt.args); err != nil {
+				t.Fatalf("ParseArgs() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(opts, tt.want) {
+				t.Errorf("ParseArgs() = %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseArgs_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		wantErrSubstr string
+	}{
+		{
+			name:          "unknown flag",
+			args:          []string{"--unknown"},
+			wantErrSubstr: "flag provided but not defined",
+		},
+		{
+			name:          "invalid validation level",
+			args:          []string{"--validate=sometimes"},
+			wantErrSubstr: "invalid validation level",
+		},
+		{
+			name:          "invalid file conflict policy",
+			args:          []string{"--file-conflicts=merge"},
+			wantErrSubstr: "invalid file conflict policy",
+		},
+		{
+			name:          "positional argument",
+			args:          []string{"extra"},
+			wantErrSubstr: "unexpected argument",
+		},
+		{
+			name:          "overlay outside files map",
+			args:          []string{"--overlay", "../prod"},
+			wantErrSubstr: "must be a relative path",
+		},
+		{
+			name:          "invalid image override",
+			args:          []string{"--set-image", "nginx"},
+			wantErrSubstr: "invalid image override",
+		},
+		{
+			name:          "registry mirror without mirror",
+			args:          []string{"--registry-mirror", "docker.io"},
+			wantErrSubstr: `expected key=value, got "docker.io"`,
+		},
+		{
+			name:          "registry mirror with a path",
+			args:          []string{"--registry-mirror", "docker.io/library=mirror.internal"},
+			wantErrSubstr: "invalid registry mirror",
+		},
+		{
+			name:          "offline without pinning digests",
+			args:          []string{"--offline"},
+			wantErrSubstr: "offline mode requires pinning digests",
+		},
+		{
+			name:          "signature without key",
+			args:          []string{"--signature", "output.sig"},
+			wantErrSubstr: "requires both a signature file and a signing key",
+		},
+		{
+			name:          "invalid allowed namespace pattern",
+			args:          []string{"--allow-namespace", "team-["},
+			wantErrSubstr: `invalid allowed namespace "team-["`,
+		},
+		{
+			name:          "tenant prefix without dash",
+			args:          []string{"--tenant-prefix", "team-a"},
+			wantErrSubstr: `invalid tenant prefix "team-a"`,
+		},
+		{
+			name:          "invalid target kubernetes",
+			args:          []string{"--target-k8s", "latest"},
+			wantErrSubstr: "invalid target Kubernetes version",
+		},
+		{
+			name:          "negative stale temp max age",
+			args:          []string{"--stale-temp-max-age=-1h"},
+			wantErrSubstr: "must not be negative",
+		},
+		{
+			name:          "attestation with diff",
+			args:          []string{"--attestation", "inputs.json", "--diff"},
+			wantErrSubstr: "an attestation cannot be combined",
+		},
+		{
+			name:          "attestation with preserve untouched",
+			args:          []string{"--attestation", "inputs.json", "--preserve-untouched"},
+			wantErrSubstr: "an attestation cannot be combined",
+		},
+		{
+			name:          "negative build cache TTL",
+			args:          []string{"--build-cache-ttl=-1h"},
+			wantErrSubstr: "build cache TTL must not be negative",
+		},
+		{
+			name:          "negative spill threshold",
+			args:          []string{"--spill-threshold=-1"},
+			wantErrSubstr: "must not be negative",
+		},
+		{
+			name:          "negative max procs",
+			args:          []string{"--max-procs=-1"},
+			wantErrSubstr: "max procs must not be negative",
+		},
+		{
+			name:          "negative memory limit",
+			args:          []string{"--memory-limit=-1"},
+			wantErrSubstr: "memory limit must not be negative",
+		},
+		{
+			name:          "indent too small",
+			args:          []string{"--indent=1"},
+			wantErrSubstr: "indent must be between 2 and 9",
+		},
+		{
+			name:          "invalid output format",
+			args:          []string{"--output", "toml"},
+			wantErrSubstr: "invalid output format",
+		},
+		{
+			name:          "diff as json",
+			args:          []string{"--diff", "--output", "json"},
+			wantErrSubstr: "diff output cannot be encoded as json",
+		},
+		{
+			name:          "input dir and diff",
+			args:          []string{"--input-dir", "manifests", "--diff"},
+			wantErrSubstr: "writing the output to files cannot be combined",
+		},
+		{
+			name:          "output dir and changed-only",
+			args:          []string{"--output-dir", "rendered", "--changed-only"},
+			wantErrSubstr: "writing the output to files cannot be combined",
+		},
+		{
+			name:          "input dir as json",
+			args:          []string{"--input-dir", "manifests", "--output", "json"},
+			wantErrSubstr: "writing the output to files cannot be combined",
+		},
+		{
+			name:          "sarif without validation",
+			args:          []string{"--sarif", "results.sarif"},
+			wantErrSubstr: "SARIF output requires validation",
+		},
+		{
+			name:          "diff and changed-only",
+			args:          []string{"--diff", "--changed-only"},
+			wantErrSubstr: "cannot be combined",
+		},
+		{
+			name:          "check and diff",
+			args:          []string{"--check", "--diff"},
+			wantErrSubstr: "check mode prints nothing",
+		},
+		{
+			name:          "migrate apis without target",
+			args:          []string{"--migrate-apis"},
+			wantErrSubstr: "requires a target Kubernetes version",
+		},
+		{
+			name:          "absolute overlay",
+			args:          []string{"--overlay", "/prod"},
+			wantErrSubstr: "must be a relative path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Default()
+			err := opts.ParseArgs(tt.args)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErrSubstr, err)
+			}
+		})
+	}
+}
+
+func TestParseArgs_Help(t *testing.T) {
+	opts := Default()
+	err := opts.ParseArgs([]string{"--help"})
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("ParseArgs() error = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestValidationLevel_String(t *testing.T) {
+	var unset ValidationLevel
+	if got := unset.String(); got != "none" {
+		t.Errorf("String() = %q, want %q", got, "none")
+	}
+
+	level := ValidationWarn
+	if got := level.String(); got != "warn" {
+		t.Errorf("String() = %q, want %q", got, "warn")
+	}
+}
+
+func TestPrintUsage(t *testing.T) {
+	var buf bytes.Buffer
+	PrintUsage(&buf)
+
+	for _, flag := range []string{"-overlay", "-validate", "-debug", "-diff", "-set-image", "-tenant-prefix", "-target-k8s", "-migrate-apis", "-create-namespace", "-fail-on-noop", "-changed-only", "-strict", "-stale-temp-max-age", "-spill-threshold", "-max-procs", "-memory-limit", "-indent", "-indent-sequences", "-output", "-sarif", "-kyverno-policies", "-crd-schemas", "-dry-run-server", "-helmfile", "-terraform", "-summary", "-trace", "-allow-hook", "-registry-mirror", "-pin-digests", "-digest-cache", "-offline", "-signature", "-sign-key", "-enable-helm", "-allow-chart-repo", "-allow-namespace", "-guard-cluster-scoped", "-check-immutable", "-check-rollback", "-check", "-allow-empty-output", "-check-count", "-preserve-untouched", "-file-conflicts", "-input-dir", "-output-dir", "-workspace-cache", "-build-cache", "-build-cache-ttl", "-attestation"} {
+		if !strings.Contains(buf.String(), flag) {
+			t.Errorf("Usage should mention %s, got:\n%s", flag, buf.String())
+		}
+	}
+}
+
+func TestOutputFormat_String(t *testing.T) {
+	var unset OutputFormat
+	if got := unset.String(); got != "yaml" {
+		t.Errorf("String() = %q, want %q", got, "yaml")
+	}
+
+	format := OutputJSON
+	if got := format.String(); got != "json" {
+		t.Errorf("String() = %q, want %q", got, "json")
+	}
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// DuplicateKey is a mapping key defined more than once in a document
+type DuplicateKey struct {
+	// Path is the dotted path of the key, e.g. "spec.template.metadata.labels.app"
+	Path string
+	// Line is the line of the duplicate and FirstLine the line of the first definition,
+	// both counted from the start of the document
+	Line      int
+	FirstLine int
+}
+
+// DuplicateKeyError reports the duplicate keys of a document. Helm templates easily produce them,
+// e.g. by rendering a label both from a helper and inline.
+type DuplicateKeyError struct {
+	// Document is the 1-based index of the document in the stream
+	Document int
+	// Resource is the Kind/name of the document, if known
+	Resource string
+	Keys     []DuplicateKey
+}
+
+// Error implements error
+func (e *DuplicateKeyError) Error() string {
+	keys := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		keys[i] = fmt.Sprintf("%q at line %d, first defined at line %d", key.Path, key.Line, key.FirstLine)
+	}
+
+	document := fmt.Sprintf("document %d", e.Document)
+	if e.Resource != "" {
+		document += " (" + e.Resource + ")"
+	}
+	return fmt.Sprintf("%s has duplicate keys: %s", document, strings.Join(keys, "; "))
+}
+
+// findDuplicateKeys returns the duplicate mapping keys of a document, in document order
+func findDuplicateKeys(doc []byte) (string, []DuplicateKey) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil || len(root.Content) == 0 {
+		return "", nil
+	}
+
+	var duplicates []DuplicateKey
+	walkDuplicateKeys(root.Content[0], "", &duplicates)
+	return resourceName(root.Content[0]), duplicates
+}
+
+// walkDuplicateKeys collects the duplicate keys of node and its children
+func walkDuplicateKeys(node *yaml.Node, path string, duplicates *[]DuplicateKey) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		firstLines := make(map[string]int)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+
+			// Merge keys may be repeated to merge several maps
+			if key.Value != "<<" {
+				if first, ok := firstLines[key.Value]; ok {
+					*duplicates = append(*duplicates, DuplicateKey{Path: keyPath, Line: key.Line, FirstLine: first})
+				} else {
+					firstLines[key.Value] = key.Line
+				}
+			}
+			walkDuplicateKeys(value, keyPath, duplicates)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			walkDuplicateKeys(item, fmt.Sprintf("%s[%d]", path, i), duplicates)
+		}
+	}
+}
+
+// resourceName returns Kind/name for a resource node, or an empty string if it lacks either
+func resourceName(node *yaml.Node) string {
+	kind := mappingValue(node, "kind")
+	name := mappingValue(mappingNode(node, "metadata"), "name")
+	if kind == "" || name == "" {
+		return ""
+	}
+	return kind + "/" + name
+}
+
+// mappingNode returns the value node of key in a mapping node
+func mappingNode(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the scalar value of key in a mapping node
+func mappingValue(node *yaml.Node, key string) string {
+	value := mappingNode(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return value.Value
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		name         string
+		doc          string
+		wantResource string
+		want         []DuplicateKey
+	}{
+		{
+			name: "no duplicates",
+			doc:  "kind: ConfigMap\nmetadata:\n  name: cm\ndata:\n  a: \"1\"\n",
+		},
+		{
+			name:         "nested duplicate",
+			doc:          "kind: ConfigMap\nmetadata:\n  name: cm\ndata:\n  a: \"1\"\n  a: \"2\"\n",
+			wantResource: "ConfigMap/cm",
+			want:         []DuplicateKey{{Path: "data.a", Line: 6, FirstLine: 5}},
+		},
+		{
+			name: "duplicates in sequence items",
+			doc: `kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: x
+    app: y
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: nginx
+        image: nginx:1.25
+`,
+			wantResource: "Deployment/app",
+			want: []DuplicateKey{
+				{Path: "metadata.labels.app", Line: 6, FirstLine: 5},
+				{Path: "spec.template.spec.containers[0].image", Line: 13, FirstLine: 12},
+			},
+		},
+		{
+			name: "top-level duplicate without name",
+			doc:  "kind: ConfigMap\nkind: Secret\n",
+			want: []DuplicateKey{{Path: "kind", Line: 2, FirstLine: 1}},
+		},
+		{
+			name: "repeated merge keys",
+			doc:  "base: &base\n  a: 1\nother: &other\n  b: 2\nmerged:\n  <<: *base\n  <<: *other\n",
+		},
+		{
+			name: "invalid YAML",
+			doc:  "a: [\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, got := findDuplicateKeys([]byte(tt.doc))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findDuplicateKeys() = %+v, want %+v", got, tt.want)
+			}
+			if tt.want != nil && resource != tt.wantResource {
+				t.Errorf("findDuplicateKeys() resource = %q, want %q", resource, tt.wantResource)
+			}
+		})
+	}
+}
+
+func TestParseManifests_DuplicateKeys(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+data:
+  key: a
+  key: b
+`
+
+	_, err := ParseManifests([]byte(input))
+	var dupErr *DuplicateKeyError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("ParseManifests() error = %v, want DuplicateKeyError", err)
+	}
+	if dupErr.Document != 2 {
+		t.Errorf("Document = %d, want 2", dupErr.Document)
+	}
+
+	want := `document 2 (ConfigMap/second) has duplicate keys: "data.key" at line 7, first defined at line 6`
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("ParseManifests() error = %v, want error containing %q", err, want)
+	}
+}
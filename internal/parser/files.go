@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// File is an entry of the files map
+type File struct {
+	// Content is the bytes to write, decoded if the entry was encoded
+	Content string
+	// Encoding is how the content was given in the document, "base64" for content tagged !!binary
+	// or with encoding: base64, empty for plain text
+	Encoding string
+	// Mode are the permission bits of the extracted file, 0 for the default 0644
+	Mode fs.FileMode
+	// GeneratedBy names the tool or template that generated the file, for provenance
+	GeneratedBy string
+}
+
+// binaryContent is the decoded content of a files entry tagged !!binary
+type binaryContent string
+
+// markBinaryFiles replaces the content of the files entries of doc that raw tags !!binary by
+// binaryContent, as decoding the document into a map drops the tag
+func markBinaryFiles(doc map[string]any, raw []byte) {
+	files, ok := doc["files"].(map[string]any)
+	if !ok || !bytes.Contains(raw, []byte("!!binary")) {
+		return
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil || len(root.Content) == 0 {
+		return
+	}
+	node := mappingNode(root.Content[0], "files")
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i+1].Tag != "!!binary" {
+			continue
+		}
+		if content, ok := files[node.Content[i].Value].(string); ok {
+			files[node.Content[i].Value] = binaryContent(content)
+		}
+	}
+}
+
+// parseFile parses a value of the 'files' field: a string, binaryContent for strings tagged
+// !!binary, or a map with the content and its metadata. With apiVersion helm.plugin.kustomize/v1
+// the map only holds base64 content and "encoding: base64"; v2 adds the mode and generated-by
+// fields and accepts plain text content without an encoding.
+func parseFile(path string, value any, apiVersion string) (File, error) {
+	switch v := value.(type) {
+	case string:
+		return File{Content: v}, nil
+	case binaryContent:
+		return File{Content: string(v), Encoding: "base64"}, nil
+	case map[string]any:
+		for key := range v {
+			switch key {
+			case "content", "encoding":
+			case "mode", "generated-by":
+				if apiVersion != APIVersionV2 {
+					return File{}, fmt.Errorf("KustomizePluginData 'files.%s.%s' requires apiVersion %s", path, key, APIVersionV2)
+				}
+			default:
+				return File{}, fmt.Errorf("KustomizePluginData 'files.%s' has unknown field %q", path, key)
+			}
+		}
+
+		content, ok := v["content"].(string)
+		if !ok {
+			return File{}, fmt.Errorf("KustomizePluginData 'files.%s.content' must be a string", path)
+		}
+		file := File{Content: content}
+		encoding, _ := v["encoding"].(string)
+		switch {
+		case encoding == "base64":
+			// Long base64 content is commonly wrapped over several lines
+			decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(content), ""))
+			if err != nil {
+				return File{}, fmt.Errorf("KustomizePluginData 'files.%s.content' is not valid base64: %w", path, err)
+			}
+			file.Content = string(decoded)
+			file.Encoding = encoding
+		case v["encoding"] == nil && apiVersion == APIVersionV2:
+		default:
+			return File{}, fmt.Errorf("KustomizePluginData 'files.%s.encoding' must be base64, got %v", path, v["encoding"])
+		}
+
+		if raw, ok := v["mode"]; ok {
+			mode, err := parseMode(raw)
+			if err != nil {
+				return File{}, fmt.Errorf("KustomizePluginData 'files.%s.mode' %w", path, err)
+			}
+			file.Mode = mode
+		}
+		if raw, ok := v["generated-by"]; ok {
+			generatedBy, ok := raw.(string)
+			if !ok {
+				return File{}, fmt.Errorf("KustomizePluginData 'files.%s.generated-by' must be a string", path)
+			}
+			file.GeneratedBy = generatedBy
+		}
+		return file, nil
+	}
+	return File{}, fmt.Errorf("KustomizePluginData 'files' values must be strings, got non-string value for key %q", path)
+}
+
+// parseMode parses the mode of a files entry: an integer, which YAML reads as octal when written
+// as 0755 or 0o755, or a string of octal digits such as "755"
+func parseMode(raw any) (fs.FileMode, error) {
+	var mode uint64
+	switch v := raw.(type) {
+	case int:
+		if v < 0 {
+			return 0, fmt.Errorf("must be permission bits, got %d", v)
+		}
+		mode = uint64(v)
+	case string:
+		parsed, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(v, "0o"), "0"), 8, 32)
+		if err != nil {
+			return 0, fmt.Errorf("must be an octal mode such as \"0755\", got %q", v)
+		}
+		mode = parsed
+	default:
+		return 0, fmt.Errorf("must be an octal mode such as 0755, got %v", raw)
+	}
+	if mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("must be permission bits between 0001 and 0777, got %v", raw)
+	}
+	return fs.FileMode(mode), nil
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiVersion string
+		value      string
+		want       File
+		wantErr    string
+	}{
+		{
+			name:       "string",
+			apiVersion: APIVersion,
+			value:      "|\n  resources:\n  - all.yaml\n",
+			want:       File{Content: "resources:\n- all.yaml\n"},
+		},
+		{
+			name:       "v1 base64 entry",
+			apiVersion: APIVersion,
+			value:      "content: aGVsbG8=\nencoding: base64\n",
+			want:       File{Content: "hello", Encoding: "base64"},
+		},
+		{
+			name:       "v1 entry without encoding",
+			apiVersion: APIVersion,
+			value:      "content: hello\n",
+			wantErr:    "'files.run.sh.encoding' must be base64",
+		},
+		{
+			name:       "v1 entry with mode",
+			apiVersion: APIVersion,
+			value:      "content: aGVsbG8=\nencoding: base64\nmode: 0755\n",
+			wantErr:    "'files.run.sh.mode' requires apiVersion helm.plugin.kustomize/v2",
+		},
+		{
+			name:       "v2 plain text entry",
+			apiVersion: APIVersionV2,
+			value:      "content: \"#!/bin/sh\\n\"\nmode: 0755\ngenerated-by: templates/scripts.yaml\n",
+			want:       File{Content: "#!/bin/sh\n", Mode: 0755, GeneratedBy: "templates/scripts.yaml"},
+		},
+		{
+			name:       "v2 base64 entry",
+			apiVersion: APIVersionV2,
+			value:      "content: aGVsbG8=\nencoding: base64\nmode: \"0600\"\n",
+			want:       File{Content: "hello", Encoding: "base64", Mode: 0600},
+		},
+		{
+			name:       "v2 mode in 0o notation",
+			apiVersion: APIVersionV2,
+			value:      "content: hello\nmode: 0o700\n",
+			want:       File{Content: "hello", Mode: 0700},
+		},
+		{
+			name:       "v2 unknown encoding",
+			apiVersion: APIVersionV2,
+			value:      "content: 00ff\nencoding: hex\n",
+			wantErr:    "'files.run.sh.encoding' must be base64, got hex",
+		},
+		{
+			name:       "v2 decimal mode",
+			apiVersion: APIVersionV2,
+			value:      "content: hello\nmode: 755\n",
+			wantErr:    "'files.run.sh.mode' must be permission bits between 0001 and 0777, got 755",
+		},
+		{
+			name:       "v2 mode that is not octal",
+			apiVersion: APIVersionV2,
+			value:      "content: hello\nmode: rwxr-xr-x\n",
+			wantErr:    `'files.run.sh.mode' must be an octal mode such as "0755", got "rwxr-xr-x"`,
+		},
+		{
+			name:       "v2 generated-by not a string",
+			apiVersion: APIVersionV2,
+			value:      "content: hello\ngenerated-by: [helm]\n",
+			wantErr:    "'files.run.sh.generated-by' must be a string",
+		},
+		{
+			name:       "v2 unknown field",
+			apiVersion: APIVersionV2,
+			value:      "content: hello\nowner: root\n",
+			wantErr:    `'files.run.sh' has unknown field "owner"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			if err := yaml.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("Failed to parse value: %v", err)
+			}
+			got, err := parseFile("run.sh", value, tt.apiVersion)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseFile() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFile() error = %v, want nil", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_V2Files(t *testing.T) {
+	// A v2 document of a pipeline lets the entries of its v1 documents use the v2 fields too
+	input := []byte(`---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+---
+apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files:
+  plugins/render.sh:
+    content: |
+      #!/bin/sh
+    mode: 0755
+    generated-by: templates/plugins.yaml
+`)
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	data := result.KustomizePluginData
+	if data.APIVersion != APIVersionV2 {
+		t.Errorf("APIVersion = %q, want %q", data.APIVersion, APIVersionV2)
+	}
+	if got := data.Files["plugins/render.sh"]; got != "#!/bin/sh\n" {
+		t.Errorf("Files[plugins/render.sh] = %q, want the entry content", got)
+	}
+	entry := data.Entries["plugins/render.sh"]
+	if entry.Mode != fs.FileMode(0755) || entry.GeneratedBy != "templates/plugins.yaml" {
+		t.Errorf("Entries[plugins/render.sh] = %+v, want mode 0755 generated by templates/plugins.yaml", entry)
+	}
+	if entry := data.Entries["kustomization.yaml"]; entry.Mode != 0 || entry.Content != data.Files["kustomization.yaml"] {
+		t.Errorf("Entries[kustomization.yaml] = %+v, want the plain content without a mode", entry)
+	}
+}
@@ -4,26 +4,220 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"slices"
 
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
+	"github.com/owhelm/helm-kustomize/internal/hooks"
+	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/transform"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
 	"go.yaml.in/yaml/v4"
 )
 
 const (
 	APIVersion = "helm.plugin.kustomize/v1"
-	Kind       = "KustomizePluginData"
+	// APIVersionV2 adds the mode and generated-by metadata to the entries of the files map
+	APIVersionV2 = "helm.plugin.kustomize/v2"
+	Kind         = "KustomizePluginData"
 )
 
 // KustomizePluginData represents the special resource containing kustomize files
 type KustomizePluginData struct {
-	APIVersion string            `yaml:"apiVersion"`
-	Kind       string            `yaml:"kind"`
-	Files      map[string]string `yaml:"files"`
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	// Name is the pipeline of the document, empty for the unnamed pipeline
+	Name  string            `yaml:"name"`
+	Files map[string]string `yaml:"files"`
+	// Entries are the entries of the files map with their metadata, by path. Files holds their
+	// content.
+	Entries map[string]File `yaml:"-"`
+	// Labels are added to the kustomization labels field, nil if not set
+	Labels *Labels `yaml:"labels"`
+	// KyvernoPolicies are paths in Files of Kyverno policies applied to the built output
+	KyvernoPolicies []string `yaml:"kyvernoPolicies"`
+	// IncludeKinds limits the resources written to all.yaml to these kinds, all kinds if empty
+	IncludeKinds []string `yaml:"includeKinds"`
+	// ExcludeKinds are kinds passed through untouched instead of being written to all.yaml
+	ExcludeKinds []string `yaml:"excludeKinds"`
+	// Exclude passes resources matching selectors through untouched, nil if not set
+	Exclude *Exclude `yaml:"exclude"`
+	// Generated controls the placement of resources created by kustomize generators, nil if not set
+	Generated *Generated `yaml:"generated"`
+	// Hooks are commands the output is piped through after the build. They only run if the
+	// options allow their command.
+	Hooks []hooks.Hook `yaml:"hooks"`
+	// Inject adds containers to the pod templates of the built resources, nil if not set
+	Inject *Inject `yaml:"inject"`
+	// ResourceDefaults sets requests and limits on the containers lacking them, nil if not set
+	ResourceDefaults *ResourceDefaults `yaml:"resourceDefaults"`
+	// Scheduling stamps scheduling constraints onto pod templates, nil if not set
+	Scheduling *Scheduling `yaml:"scheduling"`
+	// Hardening enforces a restricted securityContext baseline on pod templates, nil if not set
+	Hardening *Hardening `yaml:"hardening"`
+	// PodClasses sets the priority and runtime classes of pod templates, nil if not set
+	PodClasses *PodClasses `yaml:"podClasses"`
+	// Overlays name directories of Files, so that the overlay option can select one by name, nil
+	// if not set (v2)
+	Overlays map[string]string `yaml:"overlays"`
+	// BuildOptions are flags of the kustomize build, nil if not set (v2)
+	BuildOptions *BuildOptions `yaml:"buildOptions"`
+	// Release describes the Helm release for the replacements of the kustomization, nil if not
+	// set (v2)
+	Release *ReleaseInfo `yaml:"release"`
+}
+
+// OverlayDir returns the directory of Files an overlay option selects: the directory Overlays
+// names it, or the option itself
+func (d *KustomizePluginData) OverlayDir(overlay string) string {
+	if dir, ok := d.Overlays[overlay]; ok {
+		return dir
+	}
+	return overlay
+}
+
+// PodClasses are the priority and runtime class names set on the pod templates of the resources
+// it targets, through patches added to the kustomization
+type PodClasses struct {
+	// PriorityClassName and RuntimeClassName are left alone if empty
+	PriorityClassName string `yaml:"priorityClassName"`
+	RuntimeClassName  string `yaml:"runtimeClassName"`
+	// Target selects the pod templates to change, see kustomize.Target
+	Target kustomize.Target `yaml:"target"`
+}
+
+// Fields returns the pod spec fields to set, keyed by their name in the pod spec
+func (p *PodClasses) Fields() map[string]string {
+	fields := map[string]string{}
+	if p.PriorityClassName != "" {
+		fields["priorityClassName"] = p.PriorityClassName
+	}
+	if p.RuntimeClassName != "" {
+		fields["runtimeClassName"] = p.RuntimeClassName
+	}
+	return fields
+}
+
+// Hardening enforces the securityContext settings of the restricted Pod Security Standard on
+// the pod templates of the resources it targets
+type Hardening struct {
+	// ReadOnlyRootFilesystem also makes the root filesystem of containers read-only, true if not set
+	ReadOnlyRootFilesystem bool `yaml:"readOnlyRootFilesystem"`
+	// Target selects the pod templates to change, see kustomize.Target
+	Target kustomize.Target `yaml:"target"`
+}
+
+// Scheduling are node selectors, tolerations, topology spread constraints and affinities set
+// on the pod templates of the resources it targets
+type Scheduling struct {
+	transform.Scheduling `yaml:",inline"`
+	// Target selects the pod templates to change, see kustomize.Target
+	Target kustomize.Target `yaml:"target"`
+}
+
+// ResourceDefaults are the requests and limits set on containers that lack them
+type ResourceDefaults struct {
+	// Requests are quantities by resource name, e.g. "cpu": "100m"
+	Requests map[string]string `yaml:"requests"`
+	// Limits are quantities by resource name, e.g. "memory": "256Mi"
+	Limits map[string]string `yaml:"limits"`
+	// Target selects the pod templates to change, see kustomize.Target
+	Target kustomize.Target `yaml:"target"`
+}
+
+// Inject appends containers, such as sidecars, to the pod templates of the resources it targets
+type Inject struct {
+	// Containers are appended to the containers of the pod templates
+	Containers []map[string]any `yaml:"containers"`
+	// InitContainers are appended to the init containers of the pod templates
+	InitContainers []map[string]any `yaml:"initContainers"`
+	// Target selects the pod templates to change, see kustomize.Target
+	Target kustomize.Target `yaml:"target"`
+}
+
+// Generated controls the resources kustomize generators create in addition to the Helm manifests
+type Generated struct {
+	// Placement is "prepend", "append" or "adjacent" (before their first consumer); empty keeps the kustomize order
+	Placement string `yaml:"placement"`
+	// Annotate marks generated resources with the helm.plugin.kustomize/generated annotation
+	Annotate bool `yaml:"annotate"`
+}
+
+// Exclude selects resources that are passed through untouched instead of being written to all.yaml
+type Exclude struct {
+	// Selector is a label selector, e.g. "app.kubernetes.io/component=migration"
+	Selector string `yaml:"selector"`
+	// AnnotationSelector is a selector in the same syntax matched against annotations, e.g. "helm.sh/hook"
+	AnnotationSelector string `yaml:"annotationSelector"`
+
+	selector, annotationSelector manifest.Selector
+}
+
+// Matches reports whether a resource matches any of the selectors
+func (e *Exclude) Matches(resource map[string]any) bool {
+	metadata, _ := resource["metadata"].(map[string]any)
+	labels, _ := metadata["labels"].(map[string]any)
+	annotations, _ := metadata["annotations"].(map[string]any)
+	return (e.Selector != "" && e.selector.Matches(labels)) ||
+		(e.AnnotationSelector != "" && e.annotationSelector.Matches(annotations))
+}
+
+// Transforms reports whether a resource is written to all.yaml for kustomize to transform,
+// according to IncludeKinds, ExcludeKinds and Exclude. Other resources are passed through untouched.
+func (d *KustomizePluginData) Transforms(resource map[string]any) bool {
+	kind, _ := resource["kind"].(string)
+	if len(d.IncludeKinds) > 0 && !slices.Contains(d.IncludeKinds, kind) {
+		return false
+	}
+	if d.Exclude != nil && d.Exclude.Matches(resource) {
+		return false
+	}
+	return !slices.Contains(d.ExcludeKinds, kind)
+}
+
+// pluginDataDocument is the layout of generated KustomizePluginData documents
+type pluginDataDocument struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace,omitempty"`
+	} `yaml:"metadata"`
+	Files map[string]string `yaml:"files"`
+}
+
+// EncodePluginData encodes a KustomizePluginData document holding files, e.g. for converters
+// generating one from another tool's kustomize options
+func EncodePluginData(name, namespace string, files map[string]string) ([]byte, error) {
+	doc := pluginDataDocument{APIVersion: APIVersion, Kind: Kind, Files: files}
+	doc.Metadata.Name = name
+	doc.Metadata.Namespace = namespace
+	return manifest.Marshal(doc)
+}
+
+// Labels is a convenience for the kustomization labels field. Unlike the examples commonly
+// copied around, selectors are left alone unless explicitly requested, because Deployment
+// selectors are immutable and changing them breaks upgrades of existing releases.
+type Labels struct {
+	Pairs map[string]string `yaml:"pairs"`
+	// IncludeSelectors also adds the labels to selectors; defaults to false
+	IncludeSelectors bool `yaml:"includeSelectors"`
+	// IncludeTemplates also adds the labels to pod templates without touching selectors; defaults to false
+	IncludeTemplates bool `yaml:"includeTemplates"`
 }
 
 // ParseResult contains the parsed manifests separated by type
 type ParseResult struct {
+	// KustomizePluginData is the first of Pipelines, nil if the input has no KustomizePluginData
 	KustomizePluginData *KustomizePluginData
-	OtherResources      []map[string]any
+	// Pipelines holds the KustomizePluginData of each pipeline in the order they run. The
+	// documents with the same name are merged into one pipeline.
+	Pipelines      []*KustomizePluginData
+	OtherResources []map[string]any
+	// OtherDocuments holds the original bytes of each of OtherResources, in the same order
+	OtherDocuments [][]byte
+	// NonResourceDocuments holds the original bytes of documents that are not resources, such as
+	// comment-only documents or NOTES-like text, in input order. Blank documents are dropped.
+	NonResourceDocuments [][]byte
 }
 
 // tryParseKustomizePluginDataResource attempts to parse a document as KustomizePluginData.
@@ -31,16 +225,14 @@ type ParseResult struct {
 // Returns nil and nil if the document is not a KustomizePluginData resource.
 // Returns nil and error if the document is a KustomizePluginData resource but has invalid structure.
 func tryParseKustomizePluginDataResource(doc map[string]any) (*KustomizePluginData, error) {
-	// Check apiVersion
-	apiVersion, ok := doc["apiVersion"].(string)
-	if !ok || apiVersion != APIVersion {
+	if !IsPluginData(doc) {
 		return nil, nil
 	}
+	apiVersion, _ := doc["apiVersion"].(string)
 
-	// Check kind
-	kind, ok := doc["kind"].(string)
-	if !ok || kind != Kind {
-		return nil, nil
+	name, err := pipelineName(doc)
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse files - this is required and must be map[string]string
@@ -50,63 +242,804 @@ func tryParseKustomizePluginDataResource(doc map[string]any) (*KustomizePluginDa
 	}
 
 	files := make(map[string]string, len(filesRaw))
+	entries := make(map[string]File, len(filesRaw))
 	for k, v := range filesRaw {
-		strVal, ok := v.(string)
-		if !ok {
-			return nil, fmt.Errorf("KustomizePluginData 'files' values must be strings, got non-string value for key %q", k)
+		file, err := parseFile(k, v, apiVersion)
+		if err != nil {
+			return nil, err
 		}
-		files[k] = strVal
+		files[k] = file.Content
+		entries[k] = file
+	}
+
+	labels, err := parseLabels(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// v2 spells kyvernoPolicies and hooks as policies and stages
+	policiesField, err := spelling(doc, "kyvernoPolicies", "policies")
+	if err != nil {
+		return nil, err
+	}
+	policies, err := parseKyvernoPolicies(doc, files, policiesField)
+	if err != nil {
+		return nil, err
+	}
+
+	includeKinds, err := parseKinds(doc, "includeKinds")
+	if err != nil {
+		return nil, err
+	}
+	excludeKinds, err := parseKinds(doc, "excludeKinds")
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := parseExclude(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	generated, err := parseGenerated(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	hooksField, err := spelling(doc, "hooks", "stages")
+	if err != nil {
+		return nil, err
+	}
+	postBuildHooks, err := parseHooks(doc, hooksField)
+	if err != nil {
+		return nil, err
+	}
+
+	inject, err := parseInject(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceDefaults, err := parseResourceDefaults(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduling, err := parseScheduling(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	hardening, err := parseHardening(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	podClasses, err := parsePodClasses(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	overlays, err := parseOverlays(doc, files)
+	if err != nil {
+		return nil, err
+	}
+
+	buildOptions, err := parseBuildOptions(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := parseRelease(doc)
+	if err != nil {
+		return nil, err
 	}
 
 	return &KustomizePluginData{
-		APIVersion: apiVersion,
-		Kind:       kind,
-		Files:      files,
+		APIVersion:       apiVersion,
+		Kind:             Kind,
+		Name:             name,
+		Files:            files,
+		Entries:          entries,
+		Labels:           labels,
+		KyvernoPolicies:  policies,
+		IncludeKinds:     includeKinds,
+		ExcludeKinds:     excludeKinds,
+		Exclude:          exclude,
+		Generated:        generated,
+		Hooks:            postBuildHooks,
+		Inject:           inject,
+		ResourceDefaults: resourceDefaults,
+		Scheduling:       scheduling,
+		Hardening:        hardening,
+		PodClasses:       podClasses,
+		Overlays:         overlays,
+		BuildOptions:     buildOptions,
+		Release:          release,
 	}, nil
 }
 
-// ParseManifests parses YAML input from bytes and separates KustomizePluginData from other resources
-func ParseManifests(data []byte) (*ParseResult, error) {
-	result := &ParseResult{
-		OtherResources: make([]map[string]any, 0),
+// parseGenerated parses the optional 'generated' field of a KustomizePluginData resource
+func parseGenerated(doc map[string]any) (*Generated, error) {
+	raw, ok := doc["generated"]
+	if !ok || raw == nil {
+		return nil, nil
 	}
 
-	// Split by YAML document separator
-	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'generated' field must be a map")
+	}
 
-	for {
-		var doc map[string]any
-		err := decoder.Decode(&doc)
-		if err == io.EOF {
-			break
+	generated := &Generated{}
+	for key, value := range fields {
+		switch key {
+		case "placement":
+			placement, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData 'generated.placement' field must be a string")
+			}
+			switch placement {
+			case "prepend", "append", "adjacent":
+			default:
+				return nil, fmt.Errorf("KustomizePluginData 'generated.placement' must be prepend, append or adjacent, got %q", placement)
+			}
+			generated.Placement = placement
+		case "annotate":
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData 'generated.annotate' field must be a boolean")
+			}
+			generated.Annotate = b
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'generated' has unknown field %q", key)
 		}
+	}
+
+	return generated, nil
+}
+
+// parseExclude parses the optional 'exclude' field of a KustomizePluginData resource
+func parseExclude(doc map[string]any) (*Exclude, error) {
+	raw, ok := doc["exclude"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'exclude' field must be a map")
+	}
+
+	exclude := &Exclude{}
+	for key, value := range fields {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("KustomizePluginData 'exclude.%s' field must be a string", key)
+		}
+		selector, err := manifest.ParseSelector(s)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode YAML document: %w", err)
+			return nil, fmt.Errorf("KustomizePluginData 'exclude.%s': %w", key, err)
+		}
+		switch key {
+		case "selector":
+			exclude.Selector, exclude.selector = s, selector
+		case "annotationSelector":
+			exclude.AnnotationSelector, exclude.annotationSelector = s, selector
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'exclude' has unknown field %q", key)
 		}
+	}
 
-		// Skip empty documents
-		if len(doc) == 0 {
-			continue
+	if exclude.Selector == "" && exclude.AnnotationSelector == "" {
+		return nil, fmt.Errorf("KustomizePluginData 'exclude' must have a selector or annotationSelector")
+	}
+
+	return exclude, nil
+}
+
+// parseKinds parses an optional list of kinds of a KustomizePluginData resource, such as
+// 'includeKinds'
+func parseKinds(doc map[string]any, field string) ([]string, error) {
+	raw, ok := doc[field]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData '%s' field must be a list", field)
+	}
+
+	kinds := make([]string, 0, len(items))
+	for _, item := range items {
+		kind, ok := item.(string)
+		if !ok || kind == "" {
+			return nil, fmt.Errorf("KustomizePluginData '%s' values must be non-empty strings, got %v", field, item)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// parseKyvernoPolicies parses the optional 'kyvernoPolicies' field of a KustomizePluginData
+// resource, or the field of that name, a list of paths that must be present in files
+func parseKyvernoPolicies(doc map[string]any, files map[string]string, field string) ([]string, error) {
+	raw, ok := doc[field]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData '%s' field must be a list", field)
+	}
+
+	policies := make([]string, 0, len(items))
+	for _, item := range items {
+		path, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("KustomizePluginData '%s' values must be strings, got %v", field, item)
+		}
+		if _, exists := files[path]; !exists {
+			return nil, fmt.Errorf("KustomizePluginData '%s' references %q, which is not in 'files'", field, path)
+		}
+		policies = append(policies, path)
+	}
+	return policies, nil
+}
+
+// parseHooks parses the optional 'hooks' field of a KustomizePluginData resource, or the field of
+// that name, a list of commands with optional arguments
+func parseHooks(doc map[string]any, field string) ([]hooks.Hook, error) {
+	raw, ok := doc[field]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData '%s' field must be a list", field)
+	}
+
+	parsed := make([]hooks.Hook, 0, len(items))
+	for i, item := range items {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("KustomizePluginData '%s' entries must be maps, got %v", field, item)
 		}
+		for key := range entry {
+			if key != "command" && key != "args" {
+				return nil, fmt.Errorf("KustomizePluginData '%s[%d]' has unknown field %q", field, i, key)
+			}
+		}
+
+		command, ok := entry["command"].(string)
+		if !ok || command == "" {
+			return nil, fmt.Errorf("KustomizePluginData '%s[%d].command' must be a non-empty string", field, i)
+		}
+		hook := hooks.Hook{Command: command}
+
+		if rawArgs, ok := entry["args"]; ok && rawArgs != nil {
+			args, ok := rawArgs.([]any)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData '%s[%d].args' must be a list", field, i)
+			}
+			for _, arg := range args {
+				value, ok := arg.(string)
+				if !ok {
+					return nil, fmt.Errorf("KustomizePluginData '%s[%d].args' values must be strings, got %v", field, i, arg)
+				}
+				hook.Args = append(hook.Args, value)
+			}
+		}
+		parsed = append(parsed, hook)
+	}
+	return parsed, nil
+}
 
-		kpd, err := tryParseKustomizePluginDataResource(doc)
+// parseInject parses the optional 'inject' field of a KustomizePluginData resource
+func parseInject(doc map[string]any) (*Inject, error) {
+	raw, ok := doc["inject"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'inject' field must be a map")
+	}
+
+	inject := &Inject{}
+	for key, value := range fields {
+		switch key {
+		case "containers", "initContainers":
+			containers, err := parseContainers(value, "inject."+key)
+			if err != nil {
+				return nil, err
+			}
+			if key == "containers" {
+				inject.Containers = containers
+			} else {
+				inject.InitContainers = containers
+			}
+		case "target":
+			target, err := parseTarget(value, "inject.target")
+			if err != nil {
+				return nil, err
+			}
+			inject.Target = target
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'inject' has unknown field %q", key)
+		}
+	}
+
+	if len(inject.Containers) == 0 && len(inject.InitContainers) == 0 {
+		return nil, fmt.Errorf("KustomizePluginData 'inject' must have containers or initContainers")
+	}
+	return inject, nil
+}
+
+// parseResourceDefaults parses the optional 'resourceDefaults' field of a KustomizePluginData
+// resource
+func parseResourceDefaults(doc map[string]any) (*ResourceDefaults, error) {
+	raw, ok := doc["resourceDefaults"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'resourceDefaults' field must be a map")
+	}
+
+	defaults := &ResourceDefaults{}
+	for key, value := range fields {
+		switch key {
+		case "requests", "limits":
+			quantities, err := parseQuantities(value, "resourceDefaults."+key)
+			if err != nil {
+				return nil, err
+			}
+			if key == "requests" {
+				defaults.Requests = quantities
+			} else {
+				defaults.Limits = quantities
+			}
+		case "target":
+			target, err := parseTarget(value, "resourceDefaults.target")
+			if err != nil {
+				return nil, err
+			}
+			defaults.Target = target
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'resourceDefaults' has unknown field %q", key)
+		}
+	}
+
+	if len(defaults.Requests) == 0 && len(defaults.Limits) == 0 {
+		return nil, fmt.Errorf("KustomizePluginData 'resourceDefaults' must have requests or limits")
+	}
+	return defaults, nil
+}
+
+// parseScheduling parses the optional 'scheduling' field of a KustomizePluginData resource
+func parseScheduling(doc map[string]any) (*Scheduling, error) {
+	raw, ok := doc["scheduling"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'scheduling' field must be a map")
+	}
+
+	scheduling := &Scheduling{}
+	for key, value := range fields {
+		var err error
+		switch key {
+		case "nodeSelector":
+			scheduling.NodeSelector, err = parseStringMap(value, "scheduling.nodeSelector")
+		case "tolerations":
+			scheduling.Tolerations, err = parseMaps(value, "scheduling.tolerations")
+		case "topologySpreadConstraints":
+			scheduling.TopologySpreadConstraints, err = parseMaps(value, "scheduling.topologySpreadConstraints")
+			for i, constraint := range scheduling.TopologySpreadConstraints {
+				// The topology key identifies constraints the pod template already has
+				if topologyKey, _ := constraint["topologyKey"].(string); topologyKey == "" {
+					return nil, fmt.Errorf("KustomizePluginData 'scheduling.topologySpreadConstraints[%d].topologyKey' must be a non-empty string", i)
+				}
+			}
+		case "affinity":
+			affinity, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData 'scheduling.affinity' field must be a map")
+			}
+			for name := range affinity {
+				switch name {
+				case "nodeAffinity", "podAffinity", "podAntiAffinity":
+				default:
+					return nil, fmt.Errorf("KustomizePluginData 'scheduling.affinity' has unknown field %q", name)
+				}
+			}
+			scheduling.Affinity = affinity
+		case "target":
+			scheduling.Target, err = parseTarget(value, "scheduling.target")
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'scheduling' has unknown field %q", key)
+		}
 		if err != nil {
 			return nil, err
 		}
-		if kpd != nil {
-			if result.KustomizePluginData != nil {
-				return nil, fmt.Errorf("multiple KustomizePluginData resources found, only one is supported")
+	}
+
+	if len(scheduling.NodeSelector) == 0 && len(scheduling.Tolerations) == 0 &&
+		len(scheduling.TopologySpreadConstraints) == 0 && len(scheduling.Affinity) == 0 {
+		return nil, fmt.Errorf("KustomizePluginData 'scheduling' must have nodeSelector, tolerations, topologySpreadConstraints or affinity")
+	}
+	return scheduling, nil
+}
+
+// parseHardening parses the optional 'hardening' field of a KustomizePluginData resource.
+// An empty map enables hardening with the defaults.
+func parseHardening(doc map[string]any) (*Hardening, error) {
+	raw, ok := doc["hardening"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'hardening' field must be a map")
+	}
+
+	hardening := &Hardening{ReadOnlyRootFilesystem: true}
+	for key, value := range fields {
+		switch key {
+		case "readOnlyRootFilesystem":
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData 'hardening.readOnlyRootFilesystem' field must be a boolean")
+			}
+			hardening.ReadOnlyRootFilesystem = b
+		case "target":
+			target, err := parseTarget(value, "hardening.target")
+			if err != nil {
+				return nil, err
+			}
+			hardening.Target = target
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'hardening' has unknown field %q", key)
+		}
+	}
+	return hardening, nil
+}
+
+// parsePodClasses parses the optional 'podClasses' field of a KustomizePluginData resource
+func parsePodClasses(doc map[string]any) (*PodClasses, error) {
+	raw, ok := doc["podClasses"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'podClasses' field must be a map")
+	}
+
+	podClasses := &PodClasses{}
+	for key, value := range fields {
+		switch key {
+		case "priorityClassName", "runtimeClassName":
+			name, ok := value.(string)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("KustomizePluginData 'podClasses.%s' must be a non-empty string", key)
+			}
+			if key == "priorityClassName" {
+				podClasses.PriorityClassName = name
+			} else {
+				podClasses.RuntimeClassName = name
+			}
+		case "target":
+			target, err := parseTarget(value, "podClasses.target")
+			if err != nil {
+				return nil, err
+			}
+			podClasses.Target = target
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'podClasses' has unknown field %q", key)
+		}
+	}
+
+	if podClasses.PriorityClassName == "" && podClasses.RuntimeClassName == "" {
+		return nil, fmt.Errorf("KustomizePluginData 'podClasses' must have priorityClassName or runtimeClassName")
+	}
+	// A patch is generated for the kind of the target, which must therefore have a pod template
+	if kind := podClasses.Target.Kind; kind != "" {
+		if _, ok := manifest.PodSpecPath(kind); !ok {
+			return nil, fmt.Errorf("KustomizePluginData 'podClasses.target.kind' %s has no pod template", kind)
+		}
+	}
+	return podClasses, nil
+}
+
+// parseStringMap parses a map with string values
+func parseStringMap(raw any, field string) (map[string]string, error) {
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData '%s' field must be a map", field)
+	}
+
+	values := make(map[string]string, len(fields))
+	for key, value := range fields {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("KustomizePluginData '%s.%s' must be a string, got %v", field, key, value)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
+
+// parseMaps parses a list of maps
+func parseMaps(raw any, field string) ([]map[string]any, error) {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData '%s' field must be a list", field)
+	}
+
+	maps := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("KustomizePluginData '%s' entries must be maps, got %v", field, item)
+		}
+		maps = append(maps, m)
+	}
+	return maps, nil
+}
+
+// parseQuantities parses a map of resource names to quantities, which may be written as numbers
+func parseQuantities(raw any, field string) (map[string]string, error) {
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData '%s' field must be a map", field)
+	}
+
+	quantities := make(map[string]string, len(fields))
+	for name, value := range fields {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				return nil, fmt.Errorf("KustomizePluginData '%s.%s' must not be empty", field, name)
+			}
+			quantities[name] = v
+		case int, float64:
+			quantities[name] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("KustomizePluginData '%s.%s' must be a quantity, got %v", field, name, value)
+		}
+	}
+	return quantities, nil
+}
+
+// parseContainers parses a list of containers, which must have unique names
+func parseContainers(raw any, field string) ([]map[string]any, error) {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData '%s' field must be a list", field)
+	}
+
+	containers := make([]map[string]any, 0, len(items))
+	names := map[string]bool{}
+	for i, item := range items {
+		container, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("KustomizePluginData '%s' entries must be maps, got %v", field, item)
+		}
+		name, ok := container["name"].(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("KustomizePluginData '%s[%d].name' must be a non-empty string", field, i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("KustomizePluginData '%s' has more than one container named %q", field, name)
+		}
+		names[name] = true
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// parseTarget parses a patch target map with string fields
+func parseTarget(raw any, field string) (kustomize.Target, error) {
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return kustomize.Target{}, fmt.Errorf("KustomizePluginData '%s' field must be a map", field)
+	}
+	for key, value := range fields {
+		if _, ok := value.(string); !ok {
+			return kustomize.Target{}, fmt.Errorf("KustomizePluginData '%s.%s' field must be a string", field, key)
+		}
+		switch key {
+		case "group", "version", "kind", "name", "namespace", "labelSelector", "annotationSelector":
+		default:
+			return kustomize.Target{}, fmt.Errorf("KustomizePluginData '%s' has unknown field %q", field, key)
+		}
+	}
+
+	target := kustomize.TargetOf(fields)
+	if err := target.Validate(); err != nil {
+		return kustomize.Target{}, fmt.Errorf("KustomizePluginData '%s' is invalid: %w", field, err)
+	}
+	return target, nil
+}
+
+// parseLabels parses the optional 'labels' field of a KustomizePluginData resource
+func parseLabels(doc map[string]any) (*Labels, error) {
+	raw, ok := doc["labels"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'labels' field must be a map")
+	}
+
+	labels := &Labels{Pairs: map[string]string{}}
+	for key, value := range fields {
+		switch key {
+		case "pairs":
+			pairs, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData 'labels.pairs' field must be a map")
+			}
+			for name, v := range pairs {
+				strVal, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("KustomizePluginData 'labels.pairs' values must be strings, got non-string value for key %q", name)
+				}
+				labels.Pairs[name] = strVal
+			}
+		case "includeSelectors", "includeTemplates":
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData 'labels.%s' field must be a boolean", key)
+			}
+			if key == "includeSelectors" {
+				labels.IncludeSelectors = b
+			} else {
+				labels.IncludeTemplates = b
+			}
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'labels' has unknown field %q", key)
+		}
+	}
+
+	if len(labels.Pairs) == 0 {
+		return nil, fmt.Errorf("KustomizePluginData 'labels.pairs' must not be empty")
+	}
+
+	return labels, nil
+}
+
+// ParseManifests parses YAML input from bytes and separates KustomizePluginData from other resources
+func ParseManifests(data []byte) (*ParseResult, error) {
+	return ParseManifestsWith(data, ParseOptions{})
+}
+
+// ParseManifestsWith is ParseManifests with options
+func ParseManifestsWith(data []byte, opts ParseOptions) (*ParseResult, error) {
+	result := &ParseResult{
+		OtherResources: make([]map[string]any, 0),
+	}
+
+	// Split by YAML document separator and decode the documents, concurrently for large streams
+	raw := SplitDocuments(data)
+	docs, err := decodeDocuments(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode YAML document: %w", err)
+	}
+
+	var pluginData []pipelineDocument
+	for i, doc := range docs {
+		// Documents without content are kept aside so they can be re-emitted
+		if len(doc) == 0 {
+			if len(bytes.TrimSpace(raw[i])) > 0 {
+				result.NonResourceDocuments = append(result.NonResourceDocuments, raw[i])
 			}
-			result.KustomizePluginData = kpd
+			continue
+		}
+
+		if err := checkPluginVersion(doc, originOf(raw[i], i)); err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+		}
+		if err := checkAPIVersion(doc, originOf(raw[i], i)); err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+		}
+		if IsPluginData(doc) {
+			markBinaryFiles(doc, raw[i])
+			pluginData = append(pluginData, pipelineDocument{fields: doc, origin: originOf(raw[i], i)})
 		} else {
 			// Keep as generic resource
 			result.OtherResources = append(result.OtherResources, doc)
+			result.OtherDocuments = append(result.OtherDocuments, raw[i])
+		}
+	}
+
+	if len(pluginData) > 0 {
+		if result.Pipelines, err = parsePipelines(pluginData, opts.FileConflicts); err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
 		}
+		result.KustomizePluginData = result.Pipelines[0]
 	}
 
 	return result, nil
 }
 
+// JoinDocuments concatenates documents into a multi-document YAML stream
+func JoinDocuments(docs [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(DocumentsSize(docs))
+	// Writing to a bytes.Buffer cannot fail
+	_ = WriteDocuments(&buf, docs)
+	return buf.Bytes()
+}
+
+// WriteDocuments writes documents to w as a multi-document YAML stream, like JoinDocuments
+// but without holding the whole stream in memory
+func WriteDocuments(w io.Writer, docs [][]byte) error {
+	for i, doc := range docs {
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(doc); err != nil {
+			return err
+		}
+		if len(doc) > 0 && doc[len(doc)-1] != '\n' {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SourceOf returns the template path Helm records in the "# Source:" comment heading a document,
+// or an empty string if there is none
+func SourceOf(doc []byte) string {
+	for len(doc) > 0 {
+		line := doc
+		if i := bytes.IndexByte(doc, '\n'); i >= 0 {
+			line, doc = doc[:i], doc[i+1:]
+		} else {
+			doc = nil
+		}
+
+		line = bytes.TrimSpace(line)
+		if source, ok := bytes.CutPrefix(line, []byte("# Source:")); ok {
+			return string(bytes.TrimSpace(source))
+		}
+		// Only the comments heading the document are considered
+		if len(line) > 0 && line[0] != '#' {
+			return ""
+		}
+	}
+	return ""
+}
+
+// DocumentsSize returns the size of the documents' bytes without separators
+func DocumentsSize(docs [][]byte) int {
+	size := 0
+	for _, doc := range docs {
+		size += len(doc)
+	}
+	return size
+}
+
 // MarshalResources converts resources back to YAML format
 func MarshalResources(resources []map[string]any) ([]byte, error) {
 	if len(resources) == 0 {
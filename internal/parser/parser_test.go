@@ -1,9 +1,17 @@
 package parser
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
+	"github.com/owhelm/helm-kustomize/internal/hooks"
+	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/transform"
 )
 
 func TestParseManifests_KustomizePluginDataDetection(t *testing.T) {
@@ -97,6 +105,48 @@ metadata:
 	}
 }
 
+func TestParseManifests_NonResourceDocuments(t *testing.T) {
+	input := `---
+# Source: chart/templates/disabled.yaml
+---
+
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+---
+Thank you for installing the chart.
+Your release is named test.
+---
+- a
+- b
+`
+
+	result, err := ParseManifests([]byte(input))
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	if len(result.OtherResources) != 1 {
+		t.Errorf("OtherResources count = %d, want 1", len(result.OtherResources))
+	}
+
+	want := []string{
+		"# Source: chart/templates/disabled.yaml\n",
+		"Thank you for installing the chart.\nYour release is named test.\n",
+		"- a\n- b\n",
+	}
+	if len(result.NonResourceDocuments) != len(want) {
+		t.Fatalf("NonResourceDocuments = %q, want %q", result.NonResourceDocuments, want)
+	}
+	for i, doc := range result.NonResourceDocuments {
+		if string(doc) != want[i] {
+			t.Errorf("NonResourceDocuments[%d] = %q, want %q", i, doc, want[i])
+		}
+	}
+}
+
 func TestParseManifests_EmptyInput(t *testing.T) {
 	input := []byte("")
 	result, err := ParseManifests(input)
@@ -201,30 +251,170 @@ metadata:
 	}
 }
 
-func TestParseManifests_MultipleKustomizePluginData(t *testing.T) {
+func TestParseManifests_Pipelines(t *testing.T) {
 	input := []byte(`---
 apiVersion: helm.plugin.kustomize/v1
 kind: KustomizePluginData
 metadata:
   name: first
 files:
-  file1.yaml: content1
+  kustomization.yaml: content1
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: zones
+files:
+  kustomization.yaml: content3
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
 ---
 apiVersion: helm.plugin.kustomize/v1
 kind: KustomizePluginData
 metadata:
   name: second
 files:
-  file2.yaml: content2
+  patch.yaml: content2
+labels:
+  pairs:
+    team: platform
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: labels
+files:
+  kustomization.yaml: content4
 `)
 
-	_, err := ParseManifests(input)
-	if err == nil {
-		t.Fatal("Expected error for multiple KustomizePluginData, got nil")
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	var names []string
+	for _, data := range result.Pipelines {
+		names = append(names, data.Name)
+	}
+	if want := []string{"", "labels", "zones"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Pipelines names = %q, want %q", names, want)
+	}
+	if result.KustomizePluginData != result.Pipelines[0] {
+		t.Errorf("KustomizePluginData is not the first pipeline")
+	}
+
+	unnamed := result.Pipelines[0]
+	if want := map[string]string{"kustomization.yaml": "content1", "patch.yaml": "content2"}; !reflect.DeepEqual(unnamed.Files, want) {
+		t.Errorf("Files of the unnamed pipeline = %v, want %v", unnamed.Files, want)
+	}
+	if unnamed.Labels == nil || unnamed.Labels.Pairs["team"] != "platform" {
+		t.Errorf("Labels of the unnamed pipeline = %+v, want the labels of the second document", unnamed.Labels)
+	}
+	if len(result.OtherResources) != 1 {
+		t.Errorf("Expected 1 OtherResources, got %d", len(result.OtherResources))
+	}
+}
+
+func TestParseManifests_PipelineErrors(t *testing.T) {
+	document := func(fields string) string {
+		return "---\napiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\n" + fields
+	}
+
+	tests := []struct {
+		name          string
+		input         string
+		wantErrSubstr string
+	}{
+		{
+			name:          "duplicate file",
+			input:         document("files:\n  kustomization.yaml: a\n") + document("files:\n  kustomization.yaml: b\n"),
+			wantErrSubstr: `KustomizePluginData file "kustomization.yaml" of the unnamed pipeline is set by both document 1 and document 2`,
+		},
+		{
+			name: "duplicate file from templates",
+			input: `# Source: web/templates/base.yaml
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: a
+---
+# Source: web/charts/db/templates/kustomize.yaml
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: b
+`,
+			wantErrSubstr: `KustomizePluginData file "kustomization.yaml" of the unnamed pipeline is set by both web/templates/base.yaml and web/charts/db/templates/kustomize.yaml`,
+		},
+		{
+			name:          "duplicate field",
+			input:         document("name: prod\nfiles:\n  a.yaml: a\nincludeKinds: [Service]\n") + document("name: prod\nfiles:\n  b.yaml: b\nincludeKinds: [Deployment]\n"),
+			wantErrSubstr: `KustomizePluginData 'includeKinds' field of pipeline "prod" is set by both document 1 and document 2`,
+		},
+		{
+			name:          "invalid name",
+			input:         document("name: [prod]\nfiles: {}\n"),
+			wantErrSubstr: "KustomizePluginData 'name' field must be a string",
+		},
+		{
+			name:          "invalid merged files",
+			input:         document("files: []\n") + document("files:\n  a.yaml: a\n"),
+			wantErrSubstr: "KustomizePluginData 'files' field must be a map",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifests([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Fatalf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+			if !errors.Is(err, errdefs.ErrPluginData) {
+				t.Errorf("Expected a plugin data error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseManifestsWith_FileConflicts(t *testing.T) {
+	input := []byte(`apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: first
+  a.yaml: a
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: second
+  b.yaml: b
+`)
+
+	tests := []struct {
+		name      string
+		conflicts ConflictPolicy
+		want      string
+	}{
+		{name: "first wins", conflicts: ConflictFirstWins, want: "first"},
+		{name: "last wins", conflicts: ConflictLastWins, want: "second"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseManifestsWith(input, ParseOptions{FileConflicts: tt.conflicts})
+			if err != nil {
+				t.Fatalf("ParseManifestsWith() error = %v, want nil", err)
+			}
+			want := map[string]string{"kustomization.yaml": tt.want, "a.yaml": "a", "b.yaml": "b"}
+			if !reflect.DeepEqual(result.KustomizePluginData.Files, want) {
+				t.Errorf("Files = %v, want %v", result.KustomizePluginData.Files, want)
+			}
+		})
 	}
 
-	if !strings.Contains(err.Error(), "multiple KustomizePluginData") {
-		t.Errorf("Expected error about multiple KustomizePluginData, got: %v", err)
+	if _, err := ParseManifestsWith(input, ParseOptions{FileConflicts: ConflictError}); err == nil {
+		t.Errorf("ParseManifestsWith() error = nil, want a conflict error")
 	}
 }
 
@@ -354,7 +544,7 @@ files:
 			wantErrSubstr: "files' values must be strings",
 		},
 		{
-			name: "files value is a map instead of string",
+			name: "files value is a map without content",
 			input: `---
 apiVersion: helm.plugin.kustomize/v1
 kind: KustomizePluginData
@@ -362,7 +552,42 @@ files:
   test.yaml:
     nested: value
 `,
-			wantErrSubstr: "files' values must be strings",
+			wantErrSubstr: `'files.test.yaml' has unknown field "nested"`,
+		},
+		{
+			name: "unsupported encoding",
+			input: `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  image.png:
+    encoding: hex
+    content: 00ff
+`,
+			wantErrSubstr: "'files.image.png.encoding' must be base64, got hex",
+		},
+		{
+			name: "missing content",
+			input: `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  image.png:
+    encoding: base64
+`,
+			wantErrSubstr: "'files.image.png.content' must be a string",
+		},
+		{
+			name: "invalid base64",
+			input: `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  image.png:
+    encoding: base64
+    content: not*base64
+`,
+			wantErrSubstr: "'files.image.png.content' is not valid base64",
 		},
 	}
 
@@ -378,3 +603,1030 @@ files:
 		})
 	}
 }
+
+func TestParseManifests_KustomizePluginData_BinaryFiles(t *testing.T) {
+	input := []byte(`---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+  function.tar: !!binary AAEC/w==
+  header.tar: !!binary dGFyAAAA
+  logo.png:
+    encoding: base64
+    content: |
+      iVBORw0K
+      GgoAAAAN
+`)
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	files := result.KustomizePluginData.Files
+	if got := files["function.tar"]; got != "\x00\x01\x02\xff" {
+		t.Errorf("function.tar = %q, want the decoded !!binary bytes", got)
+	}
+	if got := files["logo.png"]; got != "\x89PNG\r\n\x1a\n\x00\x00\x00\r" {
+		t.Errorf("logo.png = %q, want the decoded base64 content", got)
+	}
+
+	// Binary content is recorded as such even when it is valid UTF-8
+	for path, want := range map[string]string{"kustomization.yaml": "", "function.tar": "base64", "header.tar": "base64", "logo.png": "base64"} {
+		if got := result.KustomizePluginData.Entries[path].Encoding; got != want {
+			t.Errorf("%s encoding = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Labels(t *testing.T) {
+	input := []byte(`---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: ""
+labels:
+  pairs:
+    team: platform
+  includeTemplates: true
+`)
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	labels := result.KustomizePluginData.Labels
+	if labels == nil {
+		t.Fatal("Expected labels, got nil")
+	}
+	if labels.Pairs["team"] != "platform" {
+		t.Errorf("Expected team=platform pair, got %v", labels.Pairs)
+	}
+	if labels.IncludeSelectors {
+		t.Error("IncludeSelectors should default to false")
+	}
+	if !labels.IncludeTemplates {
+		t.Error("Expected IncludeTemplates to be true")
+	}
+}
+
+func TestParseManifests_KustomizePluginData_InvalidLabels(t *testing.T) {
+	tests := []struct {
+		name          string
+		labels        string
+		wantErrSubstr string
+	}{
+		{
+			name:          "labels not a map",
+			labels:        `labels: "team=platform"`,
+			wantErrSubstr: "'labels' field must be a map",
+		},
+		{
+			name:          "pairs not a map",
+			labels:        "labels:\n  pairs: team",
+			wantErrSubstr: "'labels.pairs' field must be a map",
+		},
+		{
+			name:          "pair value not a string",
+			labels:        "labels:\n  pairs:\n    replicas: 3",
+			wantErrSubstr: "'labels.pairs' values must be strings",
+		},
+		{
+			name:          "empty pairs",
+			labels:        "labels:\n  includeSelectors: false",
+			wantErrSubstr: "'labels.pairs' must not be empty",
+		},
+		{
+			name:          "includeSelectors not a boolean",
+			labels:        "labels:\n  pairs:\n    team: platform\n  includeSelectors: \"no\"",
+			wantErrSubstr: "'labels.includeSelectors' field must be a boolean",
+		},
+		{
+			name:          "unknown field",
+			labels:        "labels:\n  pairs:\n    team: platform\n  fieldSpecs: []",
+			wantErrSubstr: "unknown field \"fieldSpecs\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.labels + "\n"
+			_, err := ParseManifests([]byte(input))
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErrSubstr, err)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_KyvernoPolicies(t *testing.T) {
+	tests := []struct {
+		name          string
+		policies      string
+		want          []string
+		wantErrSubstr string
+	}{
+		{
+			name:     "policies in files",
+			policies: "kyvernoPolicies:\n- policies/require-labels.yaml",
+			want:     []string{"policies/require-labels.yaml"},
+		},
+		{
+			name:          "not a list",
+			policies:      "kyvernoPolicies: policies/require-labels.yaml",
+			wantErrSubstr: "'kyvernoPolicies' field must be a list",
+		},
+		{
+			name:          "not a string",
+			policies:      "kyvernoPolicies:\n- 3",
+			wantErrSubstr: "'kyvernoPolicies' values must be strings",
+		},
+		{
+			name:          "missing file",
+			policies:      "kyvernoPolicies:\n- policies/missing.yaml",
+			wantErrSubstr: `references "policies/missing.yaml", which is not in 'files'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles:\n  policies/require-labels.yaml: \"\"\n" + tt.policies + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.KyvernoPolicies, tt.want) {
+				t.Errorf("KyvernoPolicies = %v, want %v", result.KustomizePluginData.KyvernoPolicies, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Kinds(t *testing.T) {
+	tests := []struct {
+		name          string
+		kinds         string
+		wantInclude   []string
+		wantExclude   []string
+		wantErrSubstr string
+	}{
+		{
+			name:        "include and exclude",
+			kinds:       "includeKinds: [Deployment, Job]\nexcludeKinds: [Job]",
+			wantInclude: []string{"Deployment", "Job"},
+			wantExclude: []string{"Job"},
+		},
+		{
+			name:          "not a list",
+			kinds:         "excludeKinds: Job",
+			wantErrSubstr: "'excludeKinds' field must be a list",
+		},
+		{
+			name:          "empty kind",
+			kinds:         "includeKinds: [\"\"]",
+			wantErrSubstr: "'includeKinds' values must be non-empty strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.kinds + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			data := result.KustomizePluginData
+			if !reflect.DeepEqual(data.IncludeKinds, tt.wantInclude) || !reflect.DeepEqual(data.ExcludeKinds, tt.wantExclude) {
+				t.Errorf("IncludeKinds, ExcludeKinds = %v, %v, want %v, %v", data.IncludeKinds, data.ExcludeKinds, tt.wantInclude, tt.wantExclude)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Exclude(t *testing.T) {
+	tests := []struct {
+		name          string
+		exclude       string
+		resource      map[string]any
+		want          bool
+		wantErrSubstr string
+	}{
+		{
+			name:     "label selector matches",
+			exclude:  "exclude:\n  selector: app.kubernetes.io/component in (crds, hooks)",
+			resource: map[string]any{"metadata": map[string]any{"labels": map[string]any{"app.kubernetes.io/component": "crds"}}},
+			want:     true,
+		},
+		{
+			name:     "label selector does not match",
+			exclude:  "exclude:\n  selector: app.kubernetes.io/component=crds",
+			resource: map[string]any{"metadata": map[string]any{"name": "web"}},
+		},
+		{
+			name:     "annotation selector matches",
+			exclude:  "exclude:\n  annotationSelector: helm.sh/hook",
+			resource: map[string]any{"metadata": map[string]any{"annotations": map[string]any{"helm.sh/hook": "pre-install"}}},
+			want:     true,
+		},
+		{
+			name:          "not a map",
+			exclude:       "exclude: helm.sh/hook",
+			wantErrSubstr: "'exclude' field must be a map",
+		},
+		{
+			name:          "invalid selector",
+			exclude:       "exclude:\n  selector: tier in frontend",
+			wantErrSubstr: "'exclude.selector': invalid selector",
+		},
+		{
+			name:          "unknown field",
+			exclude:       "exclude:\n  kinds: Job",
+			wantErrSubstr: `'exclude' has unknown field "kinds"`,
+		},
+		{
+			name:          "no selector",
+			exclude:       "exclude: {}",
+			wantErrSubstr: "must have a selector or annotationSelector",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.exclude + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if got := result.KustomizePluginData.Exclude.Matches(tt.resource); got != tt.want {
+				t.Errorf("Exclude.Matches() = %v, want %v", got, tt.want)
+			}
+			if got := result.KustomizePluginData.Transforms(tt.resource); got == tt.want {
+				t.Errorf("Transforms() = %v, want %v", got, !tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Generated(t *testing.T) {
+	tests := []struct {
+		name          string
+		generated     string
+		want          *Generated
+		wantErrSubstr string
+	}{
+		{
+			name:      "placement and annotation",
+			generated: "generated:\n  placement: adjacent\n  annotate: true",
+			want:      &Generated{Placement: "adjacent", Annotate: true},
+		},
+		{
+			name:      "annotation only",
+			generated: "generated:\n  annotate: true",
+			want:      &Generated{Annotate: true},
+		},
+		{
+			name:          "unknown placement",
+			generated:     "generated:\n  placement: middle",
+			wantErrSubstr: `must be prepend, append or adjacent, got "middle"`,
+		},
+		{
+			name:          "annotate not a boolean",
+			generated:     "generated:\n  annotate: yes please",
+			wantErrSubstr: "'generated.annotate' field must be a boolean",
+		},
+		{
+			name:          "unknown field",
+			generated:     "generated:\n  order: first",
+			wantErrSubstr: `'generated' has unknown field "order"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.generated + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.Generated, tt.want) {
+				t.Errorf("Generated = %+v, want %+v", result.KustomizePluginData.Generated, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Hooks(t *testing.T) {
+	tests := []struct {
+		name          string
+		hooks         string
+		want          []hooks.Hook
+		wantErrSubstr string
+	}{
+		{
+			name:  "command and args",
+			hooks: "hooks:\n- command: cost-annotator\n  args: [--currency, EUR]\n- command: sidecar-injector",
+			want: []hooks.Hook{
+				{Command: "cost-annotator", Args: []string{"--currency", "EUR"}},
+				{Command: "sidecar-injector"},
+			},
+		},
+		{
+			name:          "not a list",
+			hooks:         "hooks: cost-annotator",
+			wantErrSubstr: "'hooks' field must be a list",
+		},
+		{
+			name:          "entry not a map",
+			hooks:         "hooks:\n- cost-annotator",
+			wantErrSubstr: "'hooks' entries must be maps",
+		},
+		{
+			name:          "missing command",
+			hooks:         "hooks:\n- args: [--currency, EUR]",
+			wantErrSubstr: "'hooks[0].command' must be a non-empty string",
+		},
+		{
+			name:          "args not a list",
+			hooks:         "hooks:\n- command: cost-annotator\n  args: --currency EUR",
+			wantErrSubstr: "'hooks[0].args' must be a list",
+		},
+		{
+			name:          "arg not a string",
+			hooks:         "hooks:\n- command: cost-annotator\n  args: [{currency: EUR}]",
+			wantErrSubstr: "'hooks[0].args' values must be strings",
+		},
+		{
+			name:          "unknown field",
+			hooks:         "hooks:\n- command: cost-annotator\n  env: {CURRENCY: EUR}",
+			wantErrSubstr: `'hooks[0]' has unknown field "env"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.hooks + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.Hooks, tt.want) {
+				t.Errorf("Hooks = %+v, want %+v", result.KustomizePluginData.Hooks, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Inject(t *testing.T) {
+	tests := []struct {
+		name          string
+		inject        string
+		want          *Inject
+		wantErrSubstr string
+	}{
+		{
+			name:   "containers with target",
+			inject: "inject:\n  containers:\n  - name: proxy\n    image: envoy\n  target:\n    kind: Deployment\n    labelSelector: mesh=enabled",
+			want: &Inject{
+				Containers: []map[string]any{{"name": "proxy", "image": "envoy"}},
+				Target:     kustomize.Target{Kind: "Deployment", LabelSelector: "mesh=enabled"},
+			},
+		},
+		{
+			name:   "init containers only",
+			inject: "inject:\n  initContainers:\n  - name: wait\n    image: busybox",
+			want:   &Inject{InitContainers: []map[string]any{{"name": "wait", "image": "busybox"}}},
+		},
+		{
+			name:          "not a map",
+			inject:        "inject: [proxy]",
+			wantErrSubstr: "'inject' field must be a map",
+		},
+		{
+			name:          "no containers",
+			inject:        "inject:\n  target:\n    kind: Deployment",
+			wantErrSubstr: "'inject' must have containers or initContainers",
+		},
+		{
+			name:          "containers not a list",
+			inject:        "inject:\n  containers: proxy",
+			wantErrSubstr: "'inject.containers' field must be a list",
+		},
+		{
+			name:          "container without name",
+			inject:        "inject:\n  initContainers:\n  - image: busybox",
+			wantErrSubstr: "'inject.initContainers[0].name' must be a non-empty string",
+		},
+		{
+			name:          "duplicate container",
+			inject:        "inject:\n  containers:\n  - name: proxy\n  - name: proxy",
+			wantErrSubstr: `'inject.containers' has more than one container named "proxy"`,
+		},
+		{
+			name:          "unknown target field",
+			inject:        "inject:\n  containers:\n  - name: proxy\n  target:\n    selector: app=web",
+			wantErrSubstr: `'inject.target' has unknown field "selector"`,
+		},
+		{
+			name:          "invalid target name",
+			inject:        "inject:\n  containers:\n  - name: proxy\n  target:\n    name: web-(",
+			wantErrSubstr: "'inject.target' is invalid",
+		},
+		{
+			name:          "unknown field",
+			inject:        "inject:\n  sidecars:\n  - name: proxy",
+			wantErrSubstr: `'inject' has unknown field "sidecars"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.inject + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.Inject, tt.want) {
+				t.Errorf("Inject = %+v, want %+v", result.KustomizePluginData.Inject, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_ResourceDefaults(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaults      string
+		want          *ResourceDefaults
+		wantErrSubstr string
+	}{
+		{
+			name:     "requests, limits and target",
+			defaults: "resourceDefaults:\n  requests:\n    cpu: 100m\n    memory: 128Mi\n  limits:\n    cpu: 1\n    memory: 256Mi\n  target:\n    kind: Deployment",
+			want: &ResourceDefaults{
+				Requests: map[string]string{"cpu": "100m", "memory": "128Mi"},
+				Limits:   map[string]string{"cpu": "1", "memory": "256Mi"},
+				Target:   kustomize.Target{Kind: "Deployment"},
+			},
+		},
+		{
+			name:     "fractional number",
+			defaults: "resourceDefaults:\n  requests:\n    cpu: 0.5",
+			want:     &ResourceDefaults{Requests: map[string]string{"cpu": "0.5"}},
+		},
+		{
+			name:          "not a map",
+			defaults:      "resourceDefaults: 100m",
+			wantErrSubstr: "'resourceDefaults' field must be a map",
+		},
+		{
+			name:          "no requests or limits",
+			defaults:      "resourceDefaults:\n  target:\n    kind: Deployment",
+			wantErrSubstr: "'resourceDefaults' must have requests or limits",
+		},
+		{
+			name:          "requests not a map",
+			defaults:      "resourceDefaults:\n  requests: [cpu]",
+			wantErrSubstr: "'resourceDefaults.requests' field must be a map",
+		},
+		{
+			name:          "invalid quantity",
+			defaults:      "resourceDefaults:\n  limits:\n    memory: [256Mi]",
+			wantErrSubstr: "'resourceDefaults.limits.memory' must be a quantity",
+		},
+		{
+			name:          "empty quantity",
+			defaults:      "resourceDefaults:\n  limits:\n    memory: \"\"",
+			wantErrSubstr: "'resourceDefaults.limits.memory' must not be empty",
+		},
+		{
+			name:          "unknown field",
+			defaults:      "resourceDefaults:\n  defaults:\n    cpu: 100m",
+			wantErrSubstr: `'resourceDefaults' has unknown field "defaults"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.defaults + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.ResourceDefaults, tt.want) {
+				t.Errorf("ResourceDefaults = %+v, want %+v", result.KustomizePluginData.ResourceDefaults, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Scheduling(t *testing.T) {
+	tests := []struct {
+		name          string
+		scheduling    string
+		want          *Scheduling
+		wantErrSubstr string
+	}{
+		{
+			name: "all fields",
+			scheduling: `scheduling:
+  nodeSelector:
+    pool: general
+  tolerations:
+  - key: dedicated
+    operator: Exists
+  topologySpreadConstraints:
+  - maxSkew: 1
+    topologyKey: topology.kubernetes.io/zone
+    whenUnsatisfiable: ScheduleAnyway
+  affinity:
+    podAntiAffinity: {}
+  target:
+    kind: Deployment`,
+			want: &Scheduling{
+				Scheduling: transform.Scheduling{
+					NodeSelector: map[string]string{"pool": "general"},
+					Tolerations:  []map[string]any{{"key": "dedicated", "operator": "Exists"}},
+					TopologySpreadConstraints: []map[string]any{
+						{"maxSkew": 1, "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable": "ScheduleAnyway"},
+					},
+					Affinity: map[string]any{"podAntiAffinity": map[string]any{}},
+				},
+				Target: kustomize.Target{Kind: "Deployment"},
+			},
+		},
+		{
+			name:          "not a map",
+			scheduling:    "scheduling: [general]",
+			wantErrSubstr: "'scheduling' field must be a map",
+		},
+		{
+			name:          "target only",
+			scheduling:    "scheduling:\n  target:\n    kind: Deployment",
+			wantErrSubstr: "'scheduling' must have nodeSelector, tolerations, topologySpreadConstraints or affinity",
+		},
+		{
+			name:          "node selector value not a string",
+			scheduling:    "scheduling:\n  nodeSelector:\n    gpu: true",
+			wantErrSubstr: "'scheduling.nodeSelector.gpu' must be a string",
+		},
+		{
+			name:          "toleration not a map",
+			scheduling:    "scheduling:\n  tolerations:\n  - dedicated",
+			wantErrSubstr: "'scheduling.tolerations' entries must be maps",
+		},
+		{
+			name:          "constraint without topology key",
+			scheduling:    "scheduling:\n  topologySpreadConstraints:\n  - maxSkew: 1",
+			wantErrSubstr: "'scheduling.topologySpreadConstraints[0].topologyKey' must be a non-empty string",
+		},
+		{
+			name:          "unknown affinity",
+			scheduling:    "scheduling:\n  affinity:\n    nodeAntiAffinity: {}",
+			wantErrSubstr: `'scheduling.affinity' has unknown field "nodeAntiAffinity"`,
+		},
+		{
+			name:          "unknown field",
+			scheduling:    "scheduling:\n  priorityClassName: high",
+			wantErrSubstr: `'scheduling' has unknown field "priorityClassName"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.scheduling + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.Scheduling, tt.want) {
+				t.Errorf("Scheduling = %+v, want %+v", result.KustomizePluginData.Scheduling, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Hardening(t *testing.T) {
+	tests := []struct {
+		name          string
+		hardening     string
+		want          *Hardening
+		wantErrSubstr string
+	}{
+		{
+			name:      "defaults",
+			hardening: "hardening: {}",
+			want:      &Hardening{ReadOnlyRootFilesystem: true},
+		},
+		{
+			name:      "writable root filesystem with target",
+			hardening: "hardening:\n  readOnlyRootFilesystem: false\n  target:\n    namespace: prod",
+			want:      &Hardening{Target: kustomize.Target{Namespace: "prod"}},
+		},
+		{
+			name:      "null",
+			hardening: "hardening:",
+		},
+		{
+			name:          "not a map",
+			hardening:     "hardening: true",
+			wantErrSubstr: "'hardening' field must be a map",
+		},
+		{
+			name:          "readOnlyRootFilesystem not a boolean",
+			hardening:     "hardening:\n  readOnlyRootFilesystem: sometimes",
+			wantErrSubstr: "'hardening.readOnlyRootFilesystem' field must be a boolean",
+		},
+		{
+			name:          "unknown field",
+			hardening:     "hardening:\n  level: restricted",
+			wantErrSubstr: `'hardening' has unknown field "level"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.hardening + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.Hardening, tt.want) {
+				t.Errorf("Hardening = %+v, want %+v", result.KustomizePluginData.Hardening, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_KustomizePluginData_PodClasses(t *testing.T) {
+	tests := []struct {
+		name          string
+		podClasses    string
+		want          *PodClasses
+		wantErrSubstr string
+	}{
+		{
+			name:       "priority class",
+			podClasses: "podClasses:\n  priorityClassName: high",
+			want:       &PodClasses{PriorityClassName: "high"},
+		},
+		{
+			name:       "both classes with target",
+			podClasses: "podClasses:\n  priorityClassName: high\n  runtimeClassName: gvisor\n  target:\n    kind: Deployment",
+			want:       &PodClasses{PriorityClassName: "high", RuntimeClassName: "gvisor", Target: kustomize.Target{Kind: "Deployment"}},
+		},
+		{
+			name:       "null",
+			podClasses: "podClasses:",
+		},
+		{
+			name:          "not a map",
+			podClasses:    "podClasses: high",
+			wantErrSubstr: "'podClasses' field must be a map",
+		},
+		{
+			name:          "no class",
+			podClasses:    "podClasses:\n  target:\n    kind: Deployment",
+			wantErrSubstr: "'podClasses' must have priorityClassName or runtimeClassName",
+		},
+		{
+			name:          "empty class name",
+			podClasses:    "podClasses:\n  runtimeClassName: \"\"",
+			wantErrSubstr: "'podClasses.runtimeClassName' must be a non-empty string",
+		},
+		{
+			name:          "target kind without pod template",
+			podClasses:    "podClasses:\n  priorityClassName: high\n  target:\n    kind: Service",
+			wantErrSubstr: "'podClasses.target.kind' Service has no pod template",
+		},
+		{
+			name:          "unknown field",
+			podClasses:    "podClasses:\n  schedulerName: custom",
+			wantErrSubstr: `'podClasses' has unknown field "schedulerName"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: {}\n" + tt.podClasses + "\n"
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Errorf("ParseManifests() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(result.KustomizePluginData.PodClasses, tt.want) {
+				t.Errorf("PodClasses = %+v, want %+v", result.KustomizePluginData.PodClasses, tt.want)
+			}
+		})
+	}
+}
+
+func TestKustomizePluginData_Transforms(t *testing.T) {
+	tests := []struct {
+		name string
+		data KustomizePluginData
+		kind string
+		want bool
+	}{
+		{name: "no filters", kind: "Job", want: true},
+		{name: "excluded", data: KustomizePluginData{ExcludeKinds: []string{"Job"}}, kind: "Job", want: false},
+		{name: "not excluded", data: KustomizePluginData{ExcludeKinds: []string{"Job"}}, kind: "Deployment", want: true},
+		{name: "included", data: KustomizePluginData{IncludeKinds: []string{"Deployment"}}, kind: "Deployment", want: true},
+		{name: "not included", data: KustomizePluginData{IncludeKinds: []string{"Deployment"}}, kind: "Job", want: false},
+		{name: "included and excluded", data: KustomizePluginData{IncludeKinds: []string{"Job"}, ExcludeKinds: []string{"Job"}}, kind: "Job", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.data.Transforms(map[string]any{"kind": tt.kind}); got != tt.want {
+				t.Errorf("Transforms() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_OtherDocuments(t *testing.T) {
+	input := []byte(`---
+# Source: chart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+    name: test-service
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files: {}
+--- {apiVersion: v1, kind: ConfigMap, metadata: {name: inline}}
+`)
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	want := []string{
+		"# Source: chart/templates/service.yaml\napiVersion: v1\nkind: Service\nmetadata:\n    name: test-service\n",
+		"{apiVersion: v1, kind: ConfigMap, metadata: {name: inline}}\n",
+	}
+	if len(result.OtherDocuments) != len(want) {
+		t.Fatalf("Expected %d OtherDocuments, got %d", len(want), len(result.OtherDocuments))
+	}
+	for i, doc := range result.OtherDocuments {
+		if string(doc) != want[i] {
+			t.Errorf("OtherDocuments[%d] = %q, want %q", i, doc, want[i])
+		}
+	}
+}
+
+func TestParseManifests_KustomizePluginData_Aliases(t *testing.T) {
+	input := []byte(`---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+shared: &shared
+  kustomization.yaml: |
+    resources:
+    - all.yaml
+files:
+  <<: *shared
+  patches/a.yaml: &patch |
+    metadata:
+      labels: &labels
+        app: web
+      annotations: *labels
+  patches/b.yaml: *patch
+labels:
+  pairs: &pairs
+    team: platform
+`)
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	patch := "metadata:\n  labels: &labels\n    app: web\n  annotations: *labels\n"
+	want := map[string]string{
+		"kustomization.yaml": "resources:\n- all.yaml\n",
+		"patches/a.yaml":     patch,
+		"patches/b.yaml":     patch,
+	}
+	if !reflect.DeepEqual(result.KustomizePluginData.Files, want) {
+		t.Errorf("Files = %q, want %q", result.KustomizePluginData.Files, want)
+	}
+	if got := result.KustomizePluginData.Labels.Pairs["team"]; got != "platform" {
+		t.Errorf("Labels.Pairs[team] = %q, want %q", got, "platform")
+	}
+}
+
+func TestParseManifests_AliasesAreCopies(t *testing.T) {
+	input := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test
+  labels: &labels
+    app: web
+  annotations: *labels
+`)
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	// Transforms modify resources in place, so an alias must not share its anchor's map
+	metadata := result.OtherResources[0]["metadata"].(map[string]any)
+	metadata["labels"].(map[string]any)["app"] = "changed"
+	if got := metadata["annotations"].(map[string]any)["app"]; got != "web" {
+		t.Errorf("annotations.app = %v, want %q", got, "web")
+	}
+
+	// The original document keeps its anchors for all.yaml
+	if string(result.OtherDocuments[0]) != string(input) {
+		t.Errorf("OtherDocuments[0] = %q, want %q", result.OtherDocuments[0], input)
+	}
+}
+
+func TestJoinDocuments(t *testing.T) {
+	got := JoinDocuments([][]byte{[]byte("a: 1\n"), []byte("b: 2"), []byte("c: 3\n")})
+
+	want := "a: 1\n---\nb: 2\n---\nc: 3\n"
+	if string(got) != want {
+		t.Errorf("JoinDocuments() = %q, want %q", got, want)
+	}
+}
+
+// failingWriter fails once more than limit bytes were written
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return 0, errors.New("disk full")
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestWriteDocuments(t *testing.T) {
+	docs := [][]byte{[]byte("a: 1\n"), []byte("b: 2"), []byte("c: 3\n")}
+
+	var buf bytes.Buffer
+	if err := WriteDocuments(&buf, docs); err != nil {
+		t.Fatalf("WriteDocuments() error = %v, want nil", err)
+	}
+	if buf.String() != string(JoinDocuments(docs)) {
+		t.Errorf("WriteDocuments() = %q, want %q", buf.String(), JoinDocuments(docs))
+	}
+
+	for limit := range buf.Len() {
+		if err := WriteDocuments(&failingWriter{limit: limit}, docs); err == nil {
+			t.Errorf("WriteDocuments() with limit %d error = nil, want error", limit)
+		}
+	}
+}
+
+func TestDocumentsSize(t *testing.T) {
+	if got := DocumentsSize([][]byte{[]byte("a: 1\n"), []byte("b: 2")}); got != 9 {
+		t.Errorf("DocumentsSize() = %d, want 9", got)
+	}
+	if got := DocumentsSize(nil); got != 0 {
+		t.Errorf("DocumentsSize(nil) = %d, want 0", got)
+	}
+}
+
+// benchmarkManifests returns a Helm-like stream of n Deployments
+func benchmarkManifests(n int) []byte {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, `---
+# Source: chart/templates/deployment-%[1]d.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app-%[1]d
+  labels:
+    app.kubernetes.io/name: app-%[1]d
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: app-%[1]d
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: app-%[1]d
+    spec:
+      containers:
+      - name: app
+        image: registry.example.com/app:1.0.%[1]d
+        ports:
+        - containerPort: 8080
+        resources:
+          limits:
+            memory: 128Mi
+`, i)
+	}
+	return []byte(b.String())
+}
+
+func BenchmarkParseManifests(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		data := benchmarkManifests(n)
+		b.Run(fmt.Sprintf("docs=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				if _, err := ParseManifests(data); err != nil {
+					b.Fatalf("ParseManifests() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceOf(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{name: "helm source comment", doc: "# Source: chart/templates/service.yaml\napiVersion: v1\n", want: "chart/templates/service.yaml"},
+		{name: "after other comments", doc: "\n# Generated\n# Source: chart/templates/a.yaml\r\nkind: A\n", want: "chart/templates/a.yaml"},
+		{name: "no comment", doc: "apiVersion: v1\n", want: ""},
+		{name: "comment inside the document", doc: "apiVersion: v1\n# Source: chart/templates/a.yaml\n", want: ""},
+		{name: "empty", doc: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SourceOf([]byte(tt.doc)); got != tt.want {
+				t.Errorf("SourceOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// IsPluginData reports whether a document is a KustomizePluginData resource of either apiVersion
+func IsPluginData(doc map[string]any) bool {
+	return (doc["apiVersion"] == APIVersion || doc["apiVersion"] == APIVersionV2) && doc["kind"] == Kind
+}
+
+// pipelineName returns the value of the 'name' field of a KustomizePluginData document, empty if
+// not set
+func pipelineName(doc map[string]any) (string, error) {
+	raw, ok := doc["name"]
+	if !ok || raw == nil {
+		return "", nil
+	}
+	name, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("KustomizePluginData 'name' field must be a string")
+	}
+	return name, nil
+}
+
+// describePipeline names a pipeline in messages
+func describePipeline(name string) string {
+	if name == "" {
+		return "the unnamed pipeline"
+	}
+	return fmt.Sprintf("pipeline %q", name)
+}
+
+// ConflictPolicy controls which content a file gets when documents of a pipeline set it more
+// than once
+type ConflictPolicy string
+
+const (
+	// ConflictError fails the parse, as does the zero value
+	ConflictError ConflictPolicy = "error"
+	// ConflictFirstWins keeps the content of the first document in the stream
+	ConflictFirstWins ConflictPolicy = "first-wins"
+	// ConflictLastWins keeps the content of the last document in the stream
+	ConflictLastWins ConflictPolicy = "last-wins"
+)
+
+// ParseOptions configures ParseManifestsWith
+type ParseOptions struct {
+	// FileConflicts is how files set by more than one document of a pipeline are resolved
+	FileConflicts ConflictPolicy
+}
+
+// pipelineDocument is a KustomizePluginData document and where it comes from
+type pipelineDocument struct {
+	fields map[string]any
+	// origin is the chart template of the document, or its position in the stream if unknown
+	origin string
+}
+
+// originOf names the source of the document at index i of the stream in messages
+func originOf(raw []byte, i int) string {
+	if source := SourceOf(raw); source != "" {
+		return source
+	}
+	return fmt.Sprintf("document %d", i+1)
+}
+
+// mergePluginData merges the KustomizePluginData documents of a pipeline into one. Their files
+// maps are merged, resolving files set more than once by conflicts; any other field may only be
+// set by one of the documents.
+func mergePluginData(name string, docs []pipelineDocument, conflicts ConflictPolicy) (map[string]any, error) {
+	if len(docs) == 1 {
+		return docs[0].fields, nil
+	}
+
+	merged := map[string]any{}
+	origins := map[string]string{}
+	files := map[string]any{}
+	fileOrigins := map[string]string{}
+	for _, doc := range docs {
+		for key, value := range doc.fields {
+			switch key {
+			case "apiVersion":
+				// A v2 document lets the whole pipeline use the v2 entries, v1 being a subset
+				if merged[key] != APIVersionV2 {
+					merged[key] = value
+				}
+			case "kind", "metadata", "name":
+				merged[key] = value
+			case "files":
+				docFiles, ok := value.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("KustomizePluginData 'files' field must be a map")
+				}
+				for path, content := range docFiles {
+					if origin, ok := fileOrigins[path]; ok {
+						switch conflicts {
+						case ConflictFirstWins:
+							continue
+						case ConflictLastWins:
+							// Overwritten below
+						default:
+							return nil, fmt.Errorf("KustomizePluginData file %q of %s is set by both %s and %s", path, describePipeline(name), origin, doc.origin)
+						}
+					}
+					files[path] = content
+					fileOrigins[path] = doc.origin
+				}
+			default:
+				if origin, ok := origins[key]; ok {
+					return nil, fmt.Errorf("KustomizePluginData '%s' field of %s is set by both %s and %s", key, describePipeline(name), origin, doc.origin)
+				}
+				merged[key] = value
+				origins[key] = doc.origin
+			}
+		}
+	}
+	merged["files"] = files
+	return merged, nil
+}
+
+// parsePipelines merges the KustomizePluginData documents by name and parses them, returning the
+// pipelines in the order they run: the unnamed pipeline first, then by name
+func parsePipelines(docs []pipelineDocument, conflicts ConflictPolicy) ([]*KustomizePluginData, error) {
+	byName := map[string][]pipelineDocument{}
+	for _, doc := range docs {
+		if err := checkCapabilities(doc); err != nil {
+			return nil, err
+		}
+		name, err := pipelineName(doc.fields)
+		if err != nil {
+			return nil, err
+		}
+		byName[name] = append(byName[name], doc)
+	}
+
+	pipelines := make([]*KustomizePluginData, 0, len(byName))
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		doc, err := mergePluginData(name, byName[name], conflicts)
+		if err != nil {
+			return nil, err
+		}
+		data, err := tryParseKustomizePluginDataResource(doc)
+		if err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, data)
+	}
+	return pipelines, nil
+}
@@ -0,0 +1,64 @@
+package parser
+
+import "fmt"
+
+// ReleaseInfo is the Helm release the chart templates into the plugin data, e.g.
+// `revision: {{ .Release.Revision }}`, as Helm does not pass it to post-renderers
+type ReleaseInfo struct {
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace"`
+	Revision   string `yaml:"revision"`
+	AppVersion string `yaml:"appVersion"`
+}
+
+// Data returns the fields of the release that are set, keyed by their field name
+func (r *ReleaseInfo) Data() map[string]string {
+	data := map[string]string{}
+	for key, value := range map[string]string{"name": r.Name, "namespace": r.Namespace, "revision": r.Revision, "appVersion": r.AppVersion} {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// parseRelease parses the optional 'release' field of a KustomizePluginData resource. The
+// revision may be a number; the other fields must be strings, as YAML would turn an unquoted
+// app version such as 1.10 into the number 1.1.
+func parseRelease(doc map[string]any) (*ReleaseInfo, error) {
+	raw, ok := doc["release"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'release' field must be a map")
+	}
+
+	release := &ReleaseInfo{}
+	for key, value := range fields {
+		var target *string
+		switch key {
+		case "name":
+			target = &release.Name
+		case "namespace":
+			target = &release.Namespace
+		case "appVersion":
+			target = &release.AppVersion
+		case "revision":
+			if revision, ok := value.(int); ok {
+				release.Revision = fmt.Sprint(revision)
+				continue
+			}
+			target = &release.Revision
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'release' has unknown field %q", key)
+		}
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("KustomizePluginData 'release.%s' must be a string, got %v; quote the value", key, value)
+		}
+		*target = s
+	}
+	return release, nil
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
+)
+
+func TestParseManifests_Release(t *testing.T) {
+	tests := []struct {
+		name    string
+		release string
+		want    *ReleaseInfo
+		wantErr string
+	}{
+		{
+			name:    "all fields",
+			release: "  name: web\n  namespace: prod\n  revision: 3\n  appVersion: \"1.10\"\n",
+			want:    &ReleaseInfo{Name: "web", Namespace: "prod", Revision: "3", AppVersion: "1.10"},
+		},
+		{
+			name:    "quoted revision",
+			release: "  name: web\n  revision: \"3\"\n",
+			want:    &ReleaseInfo{Name: "web", Revision: "3"},
+		},
+		{
+			name:    "unquoted app version",
+			release: "  appVersion: 1.10\n",
+			wantErr: "'release.appVersion' must be a string, got 1.1; quote the value",
+		},
+		{
+			name:    "unknown field",
+			release: "  chart: web-1.0.0\n",
+			wantErr: `'release' has unknown field "chart"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "apiVersion: helm.plugin.kustomize/v2\nkind: KustomizePluginData\nfiles: {}\nrelease:\n" + tt.release
+			result, err := ParseManifests([]byte(input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseManifests() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				if !errors.Is(err, errdefs.ErrPluginData) {
+					t.Errorf("ParseManifests() error = %v, want a plugin data error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifests() error = %v, want nil", err)
+			}
+			if got := result.KustomizePluginData.Release; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Release = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseInfo_Data(t *testing.T) {
+	release := &ReleaseInfo{Name: "web", Revision: "3"}
+	if want := map[string]string{"name": "web", "revision": "3"}; !reflect.DeepEqual(release.Data(), want) {
+		t.Errorf("Data() = %v, want %v", release.Data(), want)
+	}
+}
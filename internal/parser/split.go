@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// parallelThreshold is the number of documents from which they are decoded concurrently.
+// Below it, the cost of starting workers outweighs the gain.
+const parallelThreshold = 64
+
+// byteOrderMark is the UTF-8 byte order mark Windows editors put at the start of files
+var byteOrderMark = []byte("\uFEFF")
+
+// SplitDocuments splits a multi-document YAML stream into its documents. A line starting with
+// the "---" directives end marker or the "..." document end marker separates documents; YAML
+// forbids such lines inside scalars, so no parsing is needed. Content following "---" on the
+// same line belongs to the next document. Empty documents are dropped.
+//
+// Streams templated on Windows are normalized: CRLF line endings become LF and byte order marks
+// at the start of a line, as left by concatenating files, are dropped.
+func SplitDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	var current []byte
+	started := false
+
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+		line = normalizeLine(line)
+
+		marker, rest := documentMarker(line)
+		if !marker {
+			current = append(current, line...)
+			started = true
+			continue
+		}
+
+		if started {
+			docs = append(docs, current)
+		}
+		current = append([]byte(nil), rest...)
+		started = len(rest) > 0
+	}
+
+	if started {
+		docs = append(docs, current)
+	}
+	return docs
+}
+
+// normalizeLine strips a leading byte order mark and turns a CRLF line ending into LF. The line is
+// copied if it changes, as the input must not be modified.
+func normalizeLine(line []byte) []byte {
+	line = bytes.TrimPrefix(line, byteOrderMark)
+	if crlf, ok := bytes.CutSuffix(line, []byte("\r\n")); ok {
+		return append(crlf[:len(crlf):len(crlf)], '\n')
+	}
+	return line
+}
+
+// documentMarker reports whether line is a document marker and returns the content that
+// follows a "---" marker on the same line
+func documentMarker(line []byte) (bool, []byte) {
+	trimmed := bytes.TrimRight(line, "\r\n")
+	for _, marker := range [][]byte{[]byte("---"), []byte("...")} {
+		if !bytes.HasPrefix(trimmed, marker) {
+			continue
+		}
+		rest := trimmed[len(marker):]
+		if len(rest) == 0 {
+			return true, nil
+		}
+		if rest[0] == ' ' || rest[0] == '\t' {
+			if marker[0] == '.' {
+				return true, nil
+			}
+			return true, append(bytes.TrimLeft(rest, " \t"), '\n')
+		}
+	}
+	return false, nil
+}
+
+// decodeDocuments decodes each document into a map, concurrently for large streams. The
+// results keep the order of docs; on failure, the error of the first failing document is
+// returned.
+func decodeDocuments(docs [][]byte) ([]map[string]any, error) {
+	results := make([]map[string]any, len(docs))
+	errs := make([]error, len(docs))
+
+	decode := func(i int) {
+		if err := yaml.Unmarshal(docs[i], &results[i]); err != nil {
+			// Text or lists are not resources; they are reported as documents without content
+			if holdsNonMapping(docs[i]) {
+				results[i] = nil
+				return
+			}
+			errs[i] = decodeError(i, docs[i], err)
+		}
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), len(docs))
+	if len(docs) < parallelThreshold || workers < 2 {
+		for i := range docs {
+			decode(i)
+		}
+	} else {
+		indices := make(chan int)
+		var wg sync.WaitGroup
+		for range workers {
+			wg.Go(func() {
+				for i := range indices {
+					decode(i)
+				}
+			})
+		}
+		for i := range docs {
+			indices <- i
+		}
+		close(indices)
+		wg.Wait()
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// holdsNonMapping reports whether doc is valid YAML whose content is a scalar or a sequence, like
+// the NOTES text some pipelines mix into the stream
+func holdsNonMapping(doc []byte) bool {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil || len(root.Content) == 0 {
+		return false
+	}
+	kind := root.Content[0].Kind
+	return kind == yaml.ScalarNode || kind == yaml.SequenceNode
+}
+
+// excerptLines and excerptWidth bound the lines of a document DocumentError shows
+const (
+	excerptLines = 5
+	excerptWidth = 120
+)
+
+// DocumentError reports a document of the stream that is not valid YAML, with enough context to
+// find it in a stream of hundreds of documents
+type DocumentError struct {
+	// Index is the zero-based index of the document in the stream
+	Index int
+	// Source is the chart template of the document, from its "# Source:" comment, if any
+	Source string
+	// Excerpt holds the first lines of the document
+	Excerpt []string
+	Err     error
+}
+
+// Error implements error
+func (e *DocumentError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "document %d (index %d", e.Index+1, e.Index)
+	if e.Source != "" {
+		fmt.Fprintf(&b, ", from %s", e.Source)
+	}
+	fmt.Fprintf(&b, "): %v", e.Err)
+	for _, line := range e.Excerpt {
+		fmt.Fprintf(&b, "\n  | %s", line)
+	}
+	return b.String()
+}
+
+// Unwrap returns the decoder error
+func (e *DocumentError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError describes why the document at index i failed to decode. Duplicate keys are reported
+// with their path, as the decoder only reports their line.
+func decodeError(i int, doc []byte, err error) error {
+	if resource, duplicates := findDuplicateKeys(doc); len(duplicates) > 0 {
+		return &DuplicateKeyError{Document: i + 1, Resource: resource, Keys: duplicates}
+	}
+
+	var excerpt []string
+	for line := range strings.Lines(string(doc)) {
+		if len(excerpt) == excerptLines {
+			excerpt = append(excerpt, "...")
+			break
+		}
+		line = strings.TrimRight(line, "\n")
+		if len(line) > excerptWidth {
+			line = line[:excerptWidth] + "..."
+		}
+		excerpt = append(excerpt, line)
+	}
+	return &DocumentError{Index: i, Source: SourceOf(doc), Excerpt: excerpt, Err: err}
+}
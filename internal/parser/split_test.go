@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitDocuments(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "empty input",
+			input: "",
+			want:  nil,
+		},
+		{
+			name:  "single document without marker",
+			input: "a: 1\n",
+			want:  []string{"a: 1\n"},
+		},
+		{
+			name:  "leading marker",
+			input: "---\na: 1\n---\nb: 2\n",
+			want:  []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "empty documents are dropped",
+			input: "a: 1\n---\n---\nb: 2\n",
+			want:  []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "content after marker",
+			input: "--- {a: 1}\n--- !!map\nb: 2\n",
+			want:  []string{"{a: 1}\n", "!!map\nb: 2\n"},
+		},
+		{
+			name:  "document end marker",
+			input: "a: 1\n...\n---\nb: 2\n",
+			want:  []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "a: 1\r\n---\r\nb: 2\r\n",
+			want:  []string{"a: 1\n", "b: 2\n"},
+		},
+		{
+			name:  "mixed line endings",
+			input: "a: 1\r\nc: |\n  x\r\n  y\n--- {b: 2}\r\n...\r\nd: 4",
+			want:  []string{"a: 1\nc: |\n  x\n  y\n", "{b: 2}\n", "d: 4"},
+		},
+		{
+			name:  "byte order mark before the first marker",
+			input: "\uFEFF---\r\na: 1\r\n",
+			want:  []string{"a: 1\n"},
+		},
+		{
+			name:  "byte order marks of concatenated files",
+			input: "\uFEFFa: 1\n---\n\uFEFFb: 2\n\uFEFF---\nc: 3\n",
+			want:  []string{"a: 1\n", "b: 2\n", "c: 3\n"},
+		},
+		{
+			name:  "dashes that are not markers",
+			input: "a: |\n  ---\n----\nb: ---x\n",
+			want:  []string{"a: |\n  ---\n----\nb: ---x\n"},
+		},
+		{
+			name:  "no trailing newline",
+			input: "a: 1\n---\nb: 2",
+			want:  []string{"a: 1\n", "b: 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, doc := range SplitDocuments([]byte(tt.input)) {
+				got = append(got, string(doc))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitDocuments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseManifests_DocumentError(t *testing.T) {
+	input := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels: {app: web
+spec:
+  replicas: 1
+  template: {}
+  selector: {}
+  strategy: ` + strings.Repeat("x", 200) + `
+`
+
+	_, err := ParseManifests([]byte(input))
+	var docErr *DocumentError
+	if !errors.As(err, &docErr) {
+		t.Fatalf("ParseManifests() error = %v, want a DocumentError", err)
+	}
+	if docErr.Index != 1 || docErr.Source != "web/templates/deployment.yaml" {
+		t.Errorf("DocumentError = index %d, source %q, want index 1, source %q", docErr.Index, docErr.Source, "web/templates/deployment.yaml")
+	}
+
+	want := "document 2 (index 1, from web/templates/deployment.yaml): yaml: "
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("ParseManifests() error = %v, want error containing %q", err, want)
+	}
+	wantExcerpt := "\n  | # Source: web/templates/deployment.yaml\n  | apiVersion: apps/v1\n  | kind: Deployment\n  | metadata:\n  |   name: web\n  | ..."
+	if !strings.HasSuffix(err.Error(), wantExcerpt) {
+		t.Errorf("ParseManifests() error = %v, want it to end with the excerpt %q", err, wantExcerpt)
+	}
+}
+
+func TestDocumentError_LongLines(t *testing.T) {
+	err := decodeError(0, []byte("data: "+strings.Repeat("x", 200)+"\n"), errors.New("broken"))
+	want := "document 1 (index 0): broken\n  | data: " + strings.Repeat("x", excerptWidth-len("data: ")) + "..."
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestParseManifests_WindowsInput(t *testing.T) {
+	input := []byte("\uFEFF---\r\napiVersion: v1\r\nkind: ConfigMap\r\nmetadata:\r\n  name: a\r\ndata:\r\n  script: |\r\n    echo a\r\n    echo b\r\n---\napiVersion: helm.plugin.kustomize/v1\r\nkind: KustomizePluginData\r\nfiles:\r\n  kustomization.yaml: |\r\n    resources:\r\n    - all.yaml\r\n")
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	if len(result.OtherResources) != 1 || result.KustomizePluginData == nil {
+		t.Fatalf("Expected 1 resource and plugin data, got %d resources and plugin data %v", len(result.OtherResources), result.KustomizePluginData)
+	}
+	data := result.OtherResources[0]["data"].(map[string]any)
+	if data["script"] != "echo a\necho b\n" {
+		t.Errorf("script = %q, want %q", data["script"], "echo a\necho b\n")
+	}
+	if got := result.KustomizePluginData.Files["kustomization.yaml"]; got != "resources:\n- all.yaml\n" {
+		t.Errorf("kustomization.yaml = %q, want LF line endings", got)
+	}
+	if strings.ContainsAny(string(result.OtherDocuments[0]), "\r\uFEFF") {
+		t.Errorf("OtherDocuments[0] = %q, want it normalized", result.OtherDocuments[0])
+	}
+}
+
+func TestParseManifests_ManyDocumentsKeepOrder(t *testing.T) {
+	var b strings.Builder
+	count := parallelThreshold * 4
+	for i := range count {
+		fmt.Fprintf(&b, "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm-%d\n", i)
+	}
+
+	result, err := ParseManifests([]byte(b.String()))
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	if len(result.OtherResources) != count {
+		t.Fatalf("Expected %d OtherResources, got %d", count, len(result.OtherResources))
+	}
+	for i, resource := range result.OtherResources {
+		name := resource["metadata"].(map[string]any)["name"]
+		if want := fmt.Sprintf("cm-%d", i); name != want {
+			t.Fatalf("OtherResources[%d] name = %v, want %s", i, name, want)
+		}
+	}
+}
+
+func TestParseManifests_ManyDocumentsFirstError(t *testing.T) {
+	var b strings.Builder
+	for i := range parallelThreshold * 2 {
+		if i == 10 || i == 100 {
+			fmt.Fprintf(&b, "---\nbroken-%d: [\n", i)
+			continue
+		}
+		fmt.Fprintf(&b, "---\nkind: ConfigMap\nmetadata:\n  name: cm-%d\n", i)
+	}
+
+	_, err := ParseManifests([]byte(b.String()))
+	if err == nil {
+		t.Fatal("Expected error for invalid YAML, got nil")
+	}
+	if !strings.Contains(err.Error(), "failed to decode YAML document") {
+		t.Errorf("Expected decode error, got: %v", err)
+	}
+	// The first failing document is reported
+	if !strings.Contains(err.Error(), "document 11 (index 10):") {
+		t.Errorf("Expected error for document 11, got: %v", err)
+	}
+}
+
+func FuzzSplitDocuments(f *testing.F) {
+	f.Add("apiVersion: v1\nkind: ConfigMap\n")
+	f.Add("---\na: 1\n---\nb: 2\n...\n")
+	f.Add("--- a: 1\n---\t\n...x\n---x\n")
+	f.Add("a: |\n  ---\n  text\r\n---\r\nb: 2")
+
+	// Splitting only drops markers and blank documents; it may only add the newline ending
+	// content that follows a "---" marker on the same line
+	f.Fuzz(func(t *testing.T, input string) {
+		docs := SplitDocuments([]byte(input))
+		size := 0
+		for i, doc := range docs {
+			if len(doc) == 0 {
+				t.Fatalf("SplitDocuments() document %d is empty", i)
+			}
+			size += len(doc)
+		}
+		if size > len(input)+len(docs) {
+			t.Fatalf("SplitDocuments() returned %d bytes for %d bytes of input", size, len(input))
+		}
+	})
+}
+
+func FuzzParseManifests(f *testing.F) {
+	f.Add("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n")
+	f.Add("---\napiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles:\n  kustomization.yaml: |\n    resources: [all.yaml]\n")
+	f.Add("---\napiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles: [a]\nhooks: 1\n")
+	f.Add("# NOTES\n---\n- a\n---\na: &x [*x]\n")
+	f.Add("a: 1\na: 2\n")
+
+	// Charts are third-party input: parsing may fail, but must never panic
+	f.Fuzz(func(t *testing.T, input string) {
+		_, _ = ParseManifests([]byte(input))
+	})
+}
@@ -0,0 +1,201 @@
+package parser
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+// apiGroup is the group of the KustomizePluginData apiVersions
+const apiGroup = "helm.plugin.kustomize/"
+
+// MinPluginVersionAnnotation declares the oldest plugin release that renders the chart, like the
+// minPluginVersion field, on KustomizePluginData documents of any apiVersion
+const MinPluginVersionAnnotation = "helm.plugin.kustomize/min-plugin-version"
+
+// v1Fields are the top-level fields of a helm.plugin.kustomize/v1 document. Others are ignored,
+// as they always were, unless v2 gives them a meaning.
+var v1Fields = []string{
+	"apiVersion", "kind", "metadata", "name", "files", "labels", "kyvernoPolicies", "includeKinds",
+	"excludeKinds", "exclude", "generated", "hooks", "inject", "resourceDefaults", "scheduling",
+	"hardening", "podClasses", "minPluginVersion",
+}
+
+// v2Fields are the top-level fields helm.plugin.kustomize/v2 adds
+var v2Fields = []string{"overlays", "stages", "buildOptions", "policies", "release"}
+
+// checkPluginVersion fails for KustomizePluginData documents, of any apiVersion of the group,
+// declaring a minPluginVersion field or MinPluginVersionAnnotation later than the running plugin.
+// It runs before any other check, so that charts written for a newer plugin ask for an upgrade
+// rather than failing on the fields this plugin does not know.
+func checkPluginVersion(doc map[string]any, origin string) error {
+	apiVersion, _ := doc["apiVersion"].(string)
+	if doc["kind"] != Kind || !strings.HasPrefix(apiVersion, apiGroup) {
+		return nil
+	}
+
+	declared := map[string]any{}
+	if raw, ok := doc["minPluginVersion"]; ok && raw != nil {
+		declared["'minPluginVersion' field"] = raw
+	}
+	if metadata, ok := doc["metadata"].(map[string]any); ok {
+		if annotations, ok := metadata["annotations"].(map[string]any); ok {
+			if raw, ok := annotations[MinPluginVersionAnnotation]; ok {
+				declared[MinPluginVersionAnnotation+" annotation"] = raw
+			}
+		}
+	}
+
+	// Development builds with an unparsable version are assumed to be recent
+	installed, installedErr := version.Parse(version.Version)
+	for _, field := range slices.Sorted(maps.Keys(declared)) {
+		minimum, ok := declared[field].(string)
+		if !ok {
+			return fmt.Errorf("KustomizePluginData %s of %s must be a string", field, origin)
+		}
+		required, err := version.Parse(minimum)
+		if err != nil {
+			return fmt.Errorf("KustomizePluginData %s of %s: %w", field, origin, err)
+		}
+		if installedErr == nil && installed.Compare(required) < 0 {
+			return fmt.Errorf("KustomizePluginData of %s requires helm-kustomize >= %s, but %s is installed; please upgrade helm-kustomize to >= %s", origin, minimum, version.Version, minimum)
+		}
+	}
+	return nil
+}
+
+// checkAPIVersion fails for KustomizePluginData documents of an apiVersion of the group this
+// plugin does not know, written for a newer plugin, rather than passing them to kustomize as a
+// resource
+func checkAPIVersion(doc map[string]any, origin string) error {
+	apiVersion, _ := doc["apiVersion"].(string)
+	if doc["kind"] != Kind || !strings.HasPrefix(apiVersion, apiGroup) || IsPluginData(doc) {
+		return nil
+	}
+	return fmt.Errorf("KustomizePluginData of %s has apiVersion %s, which helm-kustomize %s does not support (it supports %s and %s); upgrade the plugin to render this chart", origin, apiVersion, version.Version, APIVersion, APIVersionV2)
+}
+
+// checkCapabilities fails for a v2 KustomizePluginData document with fields this plugin does not
+// know, which may need a newer plugin. v1 documents using the v2 fields are refused too, as older
+// plugins would silently ignore them.
+func checkCapabilities(doc pipelineDocument) error {
+	v2 := doc.fields["apiVersion"] == APIVersionV2
+	for _, key := range slices.Sorted(maps.Keys(doc.fields)) {
+		switch {
+		case slices.Contains(v1Fields, key):
+		case slices.Contains(v2Fields, key):
+			if !v2 {
+				return fmt.Errorf("KustomizePluginData field '%s' of %s requires apiVersion %s", key, doc.origin, APIVersionV2)
+			}
+		case v2:
+			return fmt.Errorf("KustomizePluginData field '%s' of %s is not supported by helm-kustomize %s; the chart may need a newer version of the plugin", key, doc.origin, version.Version)
+		}
+	}
+	return nil
+}
+
+// spelling returns which of a v1 field and its v2 spelling a document sets, failing if it sets both
+func spelling(doc map[string]any, v1, v2 string) (string, error) {
+	if _, ok := doc[v2]; !ok {
+		return v1, nil
+	}
+	if _, ok := doc[v1]; ok {
+		return "", fmt.Errorf("KustomizePluginData sets both '%s' and '%s', which are the same field", v1, v2)
+	}
+	return v2, nil
+}
+
+// BuildOptions are flags of the kustomize build
+type BuildOptions struct {
+	// LoadRestrictor is LoadRestrictionsRootOnly, kustomize's default, or LoadRestrictionsNone to
+	// let kustomizations load files outside of their directory
+	LoadRestrictor string `yaml:"loadRestrictor"`
+	// EnableHelm lets kustomize inflate the helmCharts of kustomizations with the helm binary
+	EnableHelm bool `yaml:"enableHelm"`
+}
+
+// Flags returns the kubectl kustomize flags of the options, nil for nil options
+func (o *BuildOptions) Flags() []string {
+	if o == nil {
+		return nil
+	}
+	var flags []string
+	if o.LoadRestrictor != "" {
+		flags = append(flags, "--load-restrictor", o.LoadRestrictor)
+	}
+	if o.EnableHelm {
+		flags = append(flags, "--enable-helm")
+	}
+	return flags
+}
+
+// parseBuildOptions parses the optional 'buildOptions' field of a KustomizePluginData resource
+func parseBuildOptions(doc map[string]any) (*BuildOptions, error) {
+	raw, ok := doc["buildOptions"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("KustomizePluginData 'buildOptions' field must be a map")
+	}
+
+	options := &BuildOptions{}
+	for key, value := range fields {
+		switch key {
+		case "loadRestrictor":
+			restrictor, _ := value.(string)
+			if restrictor != "LoadRestrictionsRootOnly" && restrictor != "LoadRestrictionsNone" {
+				return nil, fmt.Errorf("KustomizePluginData 'buildOptions.loadRestrictor' must be LoadRestrictionsRootOnly or LoadRestrictionsNone, got %v", value)
+			}
+			options.LoadRestrictor = restrictor
+		case "enableHelm":
+			enable, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("KustomizePluginData 'buildOptions.enableHelm' must be a boolean")
+			}
+			options.EnableHelm = enable
+		default:
+			return nil, fmt.Errorf("KustomizePluginData 'buildOptions' has unknown field %q", key)
+		}
+	}
+	return options, nil
+}
+
+// parseOverlays parses the optional 'overlays' field of a KustomizePluginData resource, a map of
+// overlay names to directories of files
+func parseOverlays(doc map[string]any, files map[string]string) (map[string]string, error) {
+	raw, ok := doc["overlays"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	overlays, err := parseStringMap(raw, "overlays")
+	if err != nil {
+		return nil, err
+	}
+	for name, dir := range overlays {
+		if !filepath.IsLocal(dir) || !isDirectory(files, dir) {
+			return nil, fmt.Errorf("KustomizePluginData 'overlays.%s' references %q, which is not a directory of 'files'", name, dir)
+		}
+	}
+	return overlays, nil
+}
+
+// isDirectory reports whether dir holds any of files
+func isDirectory(files map[string]string, dir string) bool {
+	dir = path.Clean(dir)
+	if dir == "." {
+		return true
+	}
+	for file := range files {
+		if strings.HasPrefix(path.Clean(file), dir+"/") {
+			return true
+		}
+	}
+	return false
+}
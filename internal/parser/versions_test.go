@@ -0,0 +1,248 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+func TestParseManifests_V2Fields(t *testing.T) {
+	input := []byte(`---
+apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+minPluginVersion: "0.1.0"
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+  overlays/production/kustomization.yaml: |
+    resources:
+      - ../..
+  policies/require-labels.yaml: |
+    kind: ClusterPolicy
+overlays:
+  prod: overlays/production
+stages:
+  - command: cost-annotator
+    args: [--currency, EUR]
+policies:
+  - policies/require-labels.yaml
+buildOptions:
+  loadRestrictor: LoadRestrictionsNone
+  enableHelm: true
+`)
+
+	result, err := ParseManifests(input)
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	data := result.KustomizePluginData
+	if want := map[string]string{"prod": "overlays/production"}; !reflect.DeepEqual(data.Overlays, want) {
+		t.Errorf("Overlays = %v, want %v", data.Overlays, want)
+	}
+	if got := data.OverlayDir("prod"); got != "overlays/production" {
+		t.Errorf("OverlayDir(prod) = %q, want overlays/production", got)
+	}
+	if got := data.OverlayDir("overlays/dev"); got != "overlays/dev" {
+		t.Errorf("OverlayDir(overlays/dev) = %q, want the directory itself", got)
+	}
+	if len(data.Hooks) != 1 || data.Hooks[0].String() != "cost-annotator --currency EUR" {
+		t.Errorf("Hooks = %v, want the stages", data.Hooks)
+	}
+	if want := []string{"policies/require-labels.yaml"}; !reflect.DeepEqual(data.KyvernoPolicies, want) {
+		t.Errorf("KyvernoPolicies = %v, want %v", data.KyvernoPolicies, want)
+	}
+	if want := []string{"--load-restrictor", "LoadRestrictionsNone", "--enable-helm"}; !reflect.DeepEqual(data.BuildOptions.Flags(), want) {
+		t.Errorf("BuildOptions.Flags() = %v, want %v", data.BuildOptions.Flags(), want)
+	}
+}
+
+func TestParseManifests_Capabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name: "newer apiVersion",
+			input: `apiVersion: helm.plugin.kustomize/v3
+kind: KustomizePluginData
+files: {}
+`,
+			wantErr: "has apiVersion helm.plugin.kustomize/v3, which helm-kustomize " + version.Version + " does not support",
+		},
+		{
+			name: "v2 field in a v1 document",
+			input: `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files: {}
+overlays:
+  prod: overlays/prod
+`,
+			wantErr: "field 'overlays' of document 1 requires apiVersion helm.plugin.kustomize/v2",
+		},
+		{
+			name: "unknown field in a v2 document",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files: {}
+rollout: canary
+`,
+			wantErr: "field 'rollout' of document 1 is not supported by helm-kustomize " + version.Version,
+		},
+		{
+			name: "newer minPluginVersion",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+minPluginVersion: "99.0.0"
+files: {}
+`,
+			wantErr: "requires helm-kustomize >= 99.0.0, but " + version.Version + " is installed; please upgrade helm-kustomize to >= 99.0.0",
+		},
+		{
+			name: "newer minPluginVersion in a v1 document",
+			input: `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+minPluginVersion: "99.0.0"
+files: {}
+`,
+			wantErr: "please upgrade helm-kustomize to >= 99.0.0",
+		},
+		{
+			name: "newer version annotation",
+			input: `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+metadata:
+  annotations:
+    helm.plugin.kustomize/min-plugin-version: "99.1.0"
+files: {}
+`,
+			wantErr: "please upgrade helm-kustomize to >= 99.1.0",
+		},
+		{
+			name: "newer minPluginVersion before unknown fields",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+minPluginVersion: "99.0.0"
+files:
+  kustomization.yaml:
+    content: ""
+    checksum: abc
+rollout: canary
+`,
+			wantErr: "please upgrade helm-kustomize to >= 99.0.0",
+		},
+		{
+			name: "newer minPluginVersion before a newer apiVersion",
+			input: `apiVersion: helm.plugin.kustomize/v3
+kind: KustomizePluginData
+minPluginVersion: "99.0.0"
+`,
+			wantErr: "please upgrade helm-kustomize to >= 99.0.0",
+		},
+		{
+			name: "version annotation not a string",
+			input: `apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+metadata:
+  annotations:
+    helm.plugin.kustomize/min-plugin-version: 2
+files: {}
+`,
+			wantErr: "helm.plugin.kustomize/min-plugin-version annotation of document 1 must be a string",
+		},
+		{
+			name: "invalid minPluginVersion",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+minPluginVersion: latest
+files: {}
+`,
+			wantErr: `invalid version "latest"`,
+		},
+		{
+			name: "both spellings of a field",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files: {}
+hooks:
+  - command: a
+stages:
+  - command: b
+`,
+			wantErr: "sets both 'hooks' and 'stages'",
+		},
+		{
+			name: "overlay outside the files",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files:
+  kustomization.yaml: ""
+overlays:
+  prod: overlays/prod
+`,
+			wantErr: `'overlays.prod' references "overlays/prod", which is not a directory of 'files'`,
+		},
+		{
+			name: "unknown load restrictor",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files: {}
+buildOptions:
+  loadRestrictor: none
+`,
+			wantErr: "'buildOptions.loadRestrictor' must be LoadRestrictionsRootOnly or LoadRestrictionsNone, got none",
+		},
+		{
+			name: "unknown build option",
+			input: `apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files: {}
+buildOptions:
+  enableExec: true
+`,
+			wantErr: `'buildOptions' has unknown field "enableExec"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifests([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseManifests() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if !errors.Is(err, errdefs.ErrPluginData) {
+				t.Errorf("ParseManifests() error = %v, want a plugin data error", err)
+			}
+		})
+	}
+}
+
+func TestParseManifests_MinPluginVersion(t *testing.T) {
+	input := []byte(`apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+minPluginVersion: "` + version.Version + `"
+metadata:
+  annotations:
+    helm.plugin.kustomize/min-plugin-version: "0.0.1"
+files: {}
+`)
+	if _, err := ParseManifests(input); err != nil {
+		t.Errorf("ParseManifests() error = %v, want nil", err)
+	}
+}
+
+func TestParseManifests_V1IgnoresUnknownFields(t *testing.T) {
+	input := []byte(`apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files: {}
+notes: ignored as before
+`)
+	if _, err := ParseManifests(input); err != nil {
+		t.Errorf("ParseManifests() error = %v, want nil", err)
+	}
+}
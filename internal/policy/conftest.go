@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+)
+
+// Result is the outcome of the policies of one Rego package (conftest namespace)
+type Result struct {
+	Policy    string   `json:"policy"`
+	Successes int      `json:"successes"`
+	Failures  []string `json:"failures"`
+	Warnings  []string `json:"warnings"`
+}
+
+// Passed reports whether none of the policy's rules failed
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// conftestResult is an entry of the JSON output of conftest test
+type conftestResult struct {
+	Namespace string            `json:"namespace"`
+	Successes int               `json:"successes"`
+	Failures  []conftestMessage `json:"failures"`
+	Warnings  []conftestMessage `json:"warnings"`
+}
+
+// conftestMessage is a failure or warning reported by a rule
+type conftestMessage struct {
+	Msg string `json:"msg"`
+}
+
+// Conftest evaluates the Rego policies in dir against manifests with conftest and returns the
+// results per policy, sorted by name. Failing policies are not an error.
+func Conftest(ctx context.Context, manifests []byte, dir string) ([]Result, error) {
+	cmd := exec.CommandContext(ctx, "conftest", "test", "--policy", dir, "--all-namespaces", "--parser", "yaml", "--output", "json", "-")
+	cmd.Stdin = bytes.NewReader(manifests)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// conftest exits with 1 when a policy failed and still reports the results
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return nil, fmt.Errorf("conftest failed: %w\nOutput: %s", err, stderr.String())
+		}
+	}
+
+	var raw []conftestResult
+	if err := json.Unmarshal(stdout.Bytes(), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse conftest output: %w\nOutput: %s", err, stderr.String())
+	}
+	return aggregate(raw), nil
+}
+
+// aggregate merges the per-document results of conftest into one result per policy
+func aggregate(raw []conftestResult) []Result {
+	byPolicy := map[string]*Result{}
+	for _, entry := range raw {
+		result, ok := byPolicy[entry.Namespace]
+		if !ok {
+			result = &Result{Policy: entry.Namespace, Failures: []string{}, Warnings: []string{}}
+			byPolicy[entry.Namespace] = result
+		}
+		result.Successes += entry.Successes
+		for _, failure := range entry.Failures {
+			result.Failures = append(result.Failures, failure.Msg)
+		}
+		for _, warning := range entry.Warnings {
+			result.Warnings = append(result.Warnings, warning.Msg)
+		}
+	}
+
+	results := make([]Result, 0, len(byPolicy))
+	for _, result := range byPolicy {
+		results = append(results, *result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Policy < results[j].Policy })
+	return results
+}
@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// installFakeConftest puts a fake conftest first in PATH that records its arguments and stdin
+// in the returned directory, prints output and exits with exitCode
+func installFakeConftest(t *testing.T, output string, exitCode int) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "output"), []byte(output), 0644); err != nil {
+		t.Fatalf("Failed to write fake conftest output: %v", err)
+	}
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+		"cat > \"" + filepath.Join(dir, "stdin") + "\"\n" +
+		"cat \"" + filepath.Join(dir, "output") + "\"\n" +
+		"echo 'conftest stderr' >&2\n" +
+		"exit " + string(rune('0'+exitCode)) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "conftest"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake conftest: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestConftest(t *testing.T) {
+	output := `[
+  {"filename": "", "namespace": "security", "successes": 1, "failures": [{"msg": "Deployment/web runs as root"}]},
+  {"filename": "", "namespace": "main", "successes": 2, "warnings": [{"msg": "ConfigMap/a has no owner label"}]},
+  {"filename": "", "namespace": "security", "successes": 1, "failures": [{"msg": "Deployment/api runs as root"}]}
+]`
+	dir := installFakeConftest(t, output, 1)
+
+	results, err := Conftest(context.Background(), []byte("kind: ConfigMap\n"), "policies")
+	if err != nil {
+		t.Fatalf("Conftest() error = %v, want nil", err)
+	}
+
+	want := []Result{
+		{Policy: "main", Successes: 2, Failures: []string{}, Warnings: []string{"ConfigMap/a has no owner label"}},
+		{Policy: "security", Successes: 2, Failures: []string{"Deployment/web runs as root", "Deployment/api runs as root"}, Warnings: []string{}},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Conftest() = %+v, want %+v", results, want)
+	}
+	if !results[0].Passed() || results[1].Passed() {
+		t.Errorf("Passed() = %v, %v, want true, false", results[0].Passed(), results[1].Passed())
+	}
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatalf("Failed to read conftest args: %v", err)
+	}
+	if want := "test --policy policies --all-namespaces --parser yaml --output json -\n"; string(args) != want {
+		t.Errorf("conftest args = %q, want %q", args, want)
+	}
+	stdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	if err != nil {
+		t.Fatalf("Failed to read conftest stdin: %v", err)
+	}
+	if string(stdin) != "kind: ConfigMap\n" {
+		t.Errorf("conftest stdin = %q, want manifests", stdin)
+	}
+}
+
+func TestConftest_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		exitCode      int
+		wantErrSubstr string
+	}{
+		{
+			name:          "conftest error",
+			exitCode:      2,
+			wantErrSubstr: "conftest failed",
+		},
+		{
+			name:          "invalid output",
+			output:        "not json",
+			wantErrSubstr: "failed to parse conftest output",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeConftest(t, tt.output, tt.exitCode)
+
+			_, err := Conftest(context.Background(), nil, "policies")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("Conftest() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestConftest_NotInstalled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := Conftest(context.Background(), nil, "policies")
+	if err == nil || !strings.Contains(err.Error(), "conftest failed") {
+		t.Errorf("Conftest() error = %v, want conftest failed error", err)
+	}
+}
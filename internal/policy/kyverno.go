@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// ViolationError reports failed policy rules. Output is the report of the policy engine.
+type ViolationError struct {
+	Output string
+}
+
+// Error implements error
+func (e *ViolationError) Error() string {
+	return "policy rules failed:\n" + e.Output
+}
+
+// Kyverno applies the Kyverno policies at paths (files or directories) to the resources in
+// manifests with the kyverno CLI. Resources mutated by the policies replace the original ones,
+// keeping their order; other resources returned by kyverno are appended. Failed validation
+// rules return a *ViolationError.
+func Kyverno(ctx context.Context, manifests []byte, paths []string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "helm-kustomize-kyverno-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	resourcesPath := filepath.Join(dir, "resources.yaml")
+	if err := os.WriteFile(resourcesPath, manifests, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write resources: %w", err)
+	}
+	mutatedPath := filepath.Join(dir, "mutated.yaml")
+
+	args := append([]string{"apply"}, paths...)
+	args = append(args, "--resource", resourcesPath, "--output", mutatedPath)
+	cmd := exec.CommandContext(ctx, "kyverno", args...)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	// kyverno apply exits with 1 when a validation rule failed
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, &ViolationError{Output: out.String()}
+		}
+		return nil, fmt.Errorf("kyverno failed: %w\nOutput: %s", err, out.String())
+	}
+
+	mutated, err := os.ReadFile(mutatedPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifests, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mutated resources: %w", err)
+	}
+	return mergeMutated(manifests, mutated)
+}
+
+// mergeMutated replaces the resources of manifests with the mutated resources of the same ID
+func mergeMutated(manifests, mutated []byte) ([]byte, error) {
+	changed, err := parser.ParseManifests(mutated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mutated resources: %w", err)
+	}
+	if len(changed.OtherResources) == 0 {
+		return manifests, nil
+	}
+
+	original, err := parser.ParseManifests(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse resources: %w", err)
+	}
+
+	byID := make(map[manifest.ID]map[string]any, len(changed.OtherResources))
+	for _, resource := range changed.OtherResources {
+		byID[manifest.IDOf(resource)] = resource
+	}
+
+	resources := make([]map[string]any, 0, len(original.OtherResources))
+	for _, resource := range original.OtherResources {
+		id := manifest.IDOf(resource)
+		if replacement, ok := byID[id]; ok {
+			resource = replacement
+			delete(byID, id)
+		}
+		resources = append(resources, resource)
+	}
+	for _, resource := range changed.OtherResources {
+		if _, ok := byID[manifest.IDOf(resource)]; ok {
+			resources = append(resources, resource)
+		}
+	}
+
+	encoded, err := manifest.EncodeAll(resources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode mutated resources: %w", err)
+	}
+	return encoded, nil
+}
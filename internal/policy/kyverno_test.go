@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installFakeKyverno puts a fake kyverno first in PATH that records its arguments in the
+// returned directory, writes mutated to the --output file if set, prints output and exits
+// with exitCode
+func installFakeKyverno(t *testing.T, mutated, output string, exitCode int) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mutated"), []byte(mutated), 0644); err != nil {
+		t.Fatalf("Failed to write fake kyverno mutations: %v", err)
+	}
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"  if [ \"$1\" = --output ] && [ -s \"" + filepath.Join(dir, "mutated") + "\" ]; then cp \"" + filepath.Join(dir, "mutated") + "\" \"$2\"; fi\n" +
+		"  shift\n" +
+		"done\n" +
+		"echo '" + output + "'\n" +
+		"exit " + string(rune('0'+exitCode)) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "kyverno"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake kyverno: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+const kyvernoInput = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+`
+
+func TestKyverno(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutated string
+		want    string
+	}{
+		{
+			name: "nothing mutated",
+			want: kyvernoInput,
+		},
+		{
+			name: "mutated resource replaced in place",
+			mutated: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  labels:
+    team: platform
+`,
+			want: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  labels:
+    team: platform
+  name: a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+`,
+		},
+		{
+			name: "unknown resource appended",
+			mutated: `apiVersion: v1
+kind: Secret
+metadata:
+  name: c
+`,
+			want: kyvernoInput + `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: c
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := installFakeKyverno(t, tt.mutated, "pass: 1, fail: 0", 0)
+
+			got, err := Kyverno(context.Background(), []byte(kyvernoInput), []string{"a.yaml", "policies"})
+			if err != nil {
+				t.Fatalf("Kyverno() error = %v, want nil", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Kyverno() = %q, want %q", got, tt.want)
+			}
+
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			if err != nil {
+				t.Fatalf("Failed to read kyverno args: %v", err)
+			}
+			if !strings.HasPrefix(string(args), "apply a.yaml policies --resource ") || !strings.Contains(string(args), " --output ") {
+				t.Errorf("kyverno args = %q, want apply with policies, resource and output", args)
+			}
+		})
+	}
+}
+
+func TestKyverno_Errors(t *testing.T) {
+	t.Run("failed rules", func(t *testing.T) {
+		installFakeKyverno(t, "", "policy require-labels -> resource default/ConfigMap/a failed", 1)
+
+		_, err := Kyverno(context.Background(), []byte(kyvernoInput), []string{"policies"})
+		var violation *ViolationError
+		if !errors.As(err, &violation) {
+			t.Fatalf("Kyverno() error = %v, want ViolationError", err)
+		}
+		if !strings.Contains(violation.Output, "require-labels") {
+			t.Errorf("ViolationError.Output = %q, want kyverno report", violation.Output)
+		}
+	})
+
+	t.Run("kyverno error", func(t *testing.T) {
+		installFakeKyverno(t, "", "invalid policy", 2)
+
+		_, err := Kyverno(context.Background(), []byte(kyvernoInput), []string{"policies"})
+		if err == nil || !strings.Contains(err.Error(), "kyverno failed") {
+			t.Errorf("Kyverno() error = %v, want kyverno failed error", err)
+		}
+	})
+
+	t.Run("not installed", func(t *testing.T) {
+		t.Setenv("PATH", t.TempDir())
+
+		_, err := Kyverno(context.Background(), []byte(kyvernoInput), []string{"policies"})
+		if err == nil || !strings.Contains(err.Error(), "kyverno failed") {
+			t.Errorf("Kyverno() error = %v, want kyverno failed error", err)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package sarif
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	// Version is the SARIF version written by WriteFile
+	Version = "2.1.0"
+	// Schema is the JSON schema of SARIF 2.1.0
+	Schema = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Log is a SARIF log with the subset of fields code scanning integrations read
+type Log struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is a single run of an analysis tool
+type Run struct {
+	Tool    Tool     `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+// Tool describes the analysis tool
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver describes the tool component that produced the results
+type Driver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules,omitempty"`
+}
+
+// Rule describes a check results can refer to
+type Rule struct {
+	ID               string  `json:"id"`
+	ShortDescription Message `json:"shortDescription"`
+}
+
+// Message is a plain text message
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Result is a single finding
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+}
+
+// Location is where a result was found
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a location in a file
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation identifies a file, relative to the repository root for code scanning
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region is a part of a file
+type Region struct {
+	StartLine int `json:"startLine"`
+}
+
+// FileLocation returns the location of the start of a file
+func FileLocation(uri string) Location {
+	return Location{PhysicalLocation: PhysicalLocation{
+		ArtifactLocation: ArtifactLocation{URI: uri},
+		Region:           &Region{StartLine: 1},
+	}}
+}
+
+// NewLog returns a log with a single run of driver reporting results
+func NewLog(driver Driver, results []Result) Log {
+	// Code scanning expects an empty array rather than null when there are no results
+	if results == nil {
+		results = []Result{}
+	}
+	return Log{
+		Version: Version,
+		Schema:  Schema,
+		Runs:    []Run{{Tool: Tool{Driver: driver}, Results: results}},
+	}
+}
+
+// WriteFile writes the log to path as indented JSON
+func WriteFile(path string, log Log) error {
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode SARIF log: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write SARIF log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package sarif
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.sarif")
+	driver := Driver{Name: "helm-kustomize", Version: "1.0.0", Rules: []Rule{{ID: "removed-api", ShortDescription: Message{Text: "Removed API"}}}}
+	results := []Result{{
+		RuleID:    "removed-api",
+		Level:     "error",
+		Message:   Message{Text: "Ingress/web: networking.k8s.io/v1beta1 Ingress was removed in Kubernetes 1.22"},
+		Locations: []Location{FileLocation("chart/templates/ingress.yaml")},
+	}}
+
+	if err := WriteFile(path, NewLog(driver, results)); err != nil {
+		t.Fatalf("WriteFile() error = %v, want nil", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read SARIF file: %v", err)
+	}
+
+	var log Log
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("Failed to decode SARIF file: %v", err)
+	}
+	if log.Version != Version || len(log.Runs) != 1 {
+		t.Fatalf("WriteFile() wrote %+v, want version %s and one run", log, Version)
+	}
+	if got := log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI; got != "chart/templates/ingress.yaml" {
+		t.Errorf("Location URI = %q, want %q", got, "chart/templates/ingress.yaml")
+	}
+	if !strings.Contains(string(data), `"$schema": "`+Schema+`"`) {
+		t.Errorf("Expected $schema in SARIF file, got:\n%s", data)
+	}
+}
+
+func TestNewLog_NoResults(t *testing.T) {
+	data, err := json.Marshal(NewLog(Driver{Name: "helm-kustomize"}, nil))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"results":[]`) {
+		t.Errorf("Expected empty results array, got %s", data)
+	}
+}
+
+func TestWriteFile_Unwritable(t *testing.T) {
+	err := WriteFile(filepath.Join(t.TempDir(), "missing", "results.sarif"), NewLog(Driver{Name: "helm-kustomize"}, nil))
+	if err == nil || !strings.Contains(err.Error(), "failed to write SARIF log") {
+		t.Errorf("WriteFile() error = %v, want write error", err)
+	}
+}
@@ -0,0 +1,38 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Blob signs data with `cosign sign-blob` and writes the base64 signature to signaturePath.
+// Key is a cosign key reference: a key file, env://VAR for a key in an environment variable,
+// or a KMS URI such as awskms://, gcpkms://, azurekms:// or hashivault://. The signature is not
+// uploaded to a transparency log, so verifiers pass --insecure-ignore-tlog to cosign verify-blob.
+func Blob(ctx context.Context, data []byte, key, signaturePath string) error {
+	dir, err := os.MkdirTemp("", "helm-kustomize-sign-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	blobPath := filepath.Join(dir, "output")
+	if err := os.WriteFile(blobPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write output to sign: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "cosign", "sign-blob", "--yes", "--tlog-upload=false",
+		"--key", key, "--output-signature", signaturePath, blobPath)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to sign output: %w\nOutput: %s", err, out.String())
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package sign
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// installFakeCosign puts a fake cosign first in PATH that records its arguments and the signed
+// blob in the returned directory, writes a signature to the --output-signature file and exits
+// with exitCode
+func installFakeCosign(t *testing.T, exitCode int) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+		"while [ $# -gt 1 ]; do\n" +
+		"  if [ \"$1\" = --output-signature ]; then echo c2lnbmF0dXJl > \"$2\"; fi\n" +
+		"  shift\n" +
+		"done\n" +
+		"cp \"$1\" \"" + filepath.Join(dir, "blob") + "\"\n" +
+		"echo 'signing failed' >&2\n" +
+		"exit " + string(rune('0'+exitCode)) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "cosign"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake cosign: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestBlob(t *testing.T) {
+	dir := installFakeCosign(t, 0)
+	signature := filepath.Join(t.TempDir(), "output.sig")
+
+	if err := Blob(context.Background(), []byte("kind: ConfigMap\n"), "env://SIGNING_KEY", signature); err != nil {
+		t.Fatalf("Blob() error = %v, want nil", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if want := "sign-blob --yes --tlog-upload=false --key env://SIGNING_KEY --output-signature " + signature; !strings.HasPrefix(string(args), want) {
+		t.Errorf("cosign args = %q, want prefix %q", args, want)
+	}
+	if blob, _ := os.ReadFile(filepath.Join(dir, "blob")); string(blob) != "kind: ConfigMap\n" {
+		t.Errorf("Signed blob = %q, want the output", blob)
+	}
+	if got, _ := os.ReadFile(signature); string(got) != "c2lnbmF0dXJl\n" {
+		t.Errorf("Signature = %q, want the cosign signature", got)
+	}
+}
+
+func TestBlob_Error(t *testing.T) {
+	installFakeCosign(t, 1)
+	err := Blob(context.Background(), []byte("kind: ConfigMap\n"), "cosign.key", filepath.Join(t.TempDir(), "output.sig"))
+	if err == nil || !strings.Contains(err.Error(), "failed to sign output") || !strings.Contains(err.Error(), "signing failed") {
+		t.Errorf("Blob() error = %v, want error containing the cosign output", err)
+	}
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// exportRequest is the subset of the OTLP/JSON trace export request the tracer fills in. IDs are
+// hex-encoded and 64-bit integers are strings, as the OTLP JSON encoding requires.
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+// resourceSpans holds the spans of a resource, here the plugin process
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+// resource describes the process, e.g. with service.name
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+// scopeSpans holds the spans of an instrumentation scope
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+// scope names the instrumentation
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// otlpSpan is a span as OTLP encodes it
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+// keyValue is an attribute
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// anyValue is an attribute value, of which one field is set
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+// status is the outcome of a span
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Span kind and status codes of OTLP
+const (
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+// request builds the export request of spans
+func (t *Tracer) request(spans []*Span) exportRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(t.traceID[:]),
+			SpanID:            hex.EncodeToString(s.id[:]),
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            status{Code: statusCodeOK},
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, attr := range s.attributes {
+			span.Attributes = append(span.Attributes, keyValue{attr.key, valueOf(attr.value)})
+		}
+		if s.err != nil {
+			span.Status = status{Code: statusCodeError, Message: s.err.Error()}
+		}
+		converted = append(converted, span)
+	}
+
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{{"service.name", valueOf(t.service)}}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: DefaultServiceName, Version: t.version}, Spans: converted}},
+	}}}
+}
+
+// valueOf converts an attribute value; other types than strings, integers and booleans are
+// formatted as strings
+func valueOf(value any) anyValue {
+	switch v := value.(type) {
+	case string:
+		return anyValue{StringValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return anyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return anyValue{IntValue: &s}
+	case bool:
+		return anyValue{BoolValue: &v}
+	}
+	s := fmt.Sprint(value)
+	return anyValue{StringValue: &s}
+}
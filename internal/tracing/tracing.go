@@ -0,0 +1,233 @@
+// Package tracing records the spans of a render and exports them to an OpenTelemetry collector
+// with OTLP over HTTP, encoded as JSON. It is configured with the standard OpenTelemetry
+// environment variables and only implements what the post-renderer needs, which spares the
+// plugin the OpenTelemetry SDK.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables configuring the exporter, as defined by the OpenTelemetry specification
+const (
+	EnvEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	EnvTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	EnvHeaders        = "OTEL_EXPORTER_OTLP_HEADERS"
+	EnvTracesHeaders  = "OTEL_EXPORTER_OTLP_TRACES_HEADERS"
+	EnvServiceName    = "OTEL_SERVICE_NAME"
+	EnvSDKDisabled    = "OTEL_SDK_DISABLED"
+	// EnvTraceParent holds the W3C traceparent of the caller, e.g. a CI job or ArgoCD, whose trace
+	// the spans join
+	EnvTraceParent = "TRACEPARENT"
+)
+
+// DefaultServiceName is the service the spans are reported under unless OTEL_SERVICE_NAME is set
+const DefaultServiceName = "helm-kustomize"
+
+// Tracer records spans and exports them. A nil Tracer records nothing, so that instrumented code
+// does not need to check whether tracing is configured.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	version  string
+	client   *http.Client
+
+	traceID  [16]byte
+	parentID [8]byte
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// FromEnv returns a tracer exporting to the OTLP endpoint of the environment, or nil if none is
+// configured. version is reported as the version of the instrumentation scope.
+func FromEnv(version string) (*Tracer, error) {
+	if disabled, _ := strconv.ParseBool(os.Getenv(EnvSDKDisabled)); disabled {
+		return nil, nil
+	}
+	endpoint := os.Getenv(EnvTracesEndpoint)
+	if endpoint == "" {
+		base := os.Getenv(EnvEndpoint)
+		if base == "" {
+			return nil, nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	headers := os.Getenv(EnvTracesHeaders)
+	if headers == "" {
+		headers = os.Getenv(EnvHeaders)
+	}
+	parsedHeaders, err := parseHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tracer{
+		endpoint: endpoint,
+		headers:  parsedHeaders,
+		service:  DefaultServiceName,
+		version:  version,
+		client:   &http.Client{},
+	}
+	if service := os.Getenv(EnvServiceName); service != "" {
+		t.service = service
+	}
+
+	if parent := os.Getenv(EnvTraceParent); parent != "" {
+		if t.traceID, t.parentID, err = parseTraceParent(parent); err != nil {
+			return nil, err
+		}
+	} else {
+		_, _ = rand.Read(t.traceID[:])
+	}
+	return t, nil
+}
+
+// TraceID returns the ID of the trace the spans belong to, in hex
+func (t *Tracer) TraceID() string {
+	if t == nil {
+		return ""
+	}
+	return hex.EncodeToString(t.traceID[:])
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// Start starts a span named name, as a child of the span of ctx if any, and returns a context
+// carrying it. The span is recorded when it ends.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, parentID: t.parentID, start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		span.parentID = parent.id
+	}
+	_, _ = rand.Read(span.id[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Span is an operation of a render
+type Span struct {
+	tracer     *Tracer
+	name       string
+	id         [8]byte
+	parentID   [8]byte
+	start, end time.Time
+	attributes []attribute
+	err        error
+}
+
+// attribute is a key-value pair describing a span
+type attribute struct {
+	key   string
+	value any
+}
+
+// SetAttribute describes the span with a string, integer or boolean value
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attributes = append(s.attributes, attribute{key, value})
+}
+
+// End ends the span, marking it as failed if err is not nil
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s)
+}
+
+// Export sends the spans ended since the last export to the collector
+func (t *Tracer) Export(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to export spans: %s returned %s", t.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// parseHeaders parses the comma-separated key=value list of OTEL_EXPORTER_OTLP_HEADERS, whose
+// values are URL-encoded
+func parseHeaders(list string) (map[string]string, error) {
+	headers := map[string]string{}
+	for pair := range strings.SplitSeq(list, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q, expected key=value", pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP header %q: %w", pair, err)
+		}
+		headers[strings.TrimSpace(key)] = decoded
+	}
+	return headers, nil
+}
+
+// parseTraceParent parses a W3C traceparent, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceParent(value string) (traceID [16]byte, parentID [8]byte, err error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, parentID, fmt.Errorf("invalid %s %q", EnvTraceParent, value)
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, fmt.Errorf("invalid %s %q: %w", EnvTraceParent, value, err)
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, fmt.Errorf("invalid %s %q: %w", EnvTraceParent, value, err)
+	}
+	return traceID, parentID, nil
+}
@@ -0,0 +1,229 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets the variables configuring the tracer for the duration of the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range []string{EnvEndpoint, EnvTracesEndpoint, EnvHeaders, EnvTracesHeaders, EnvServiceName, EnvSDKDisabled, EnvTraceParent} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantNil      bool
+		wantEndpoint string
+		wantHeaders  map[string]string
+		wantService  string
+		wantErr      string
+	}{
+		{
+			name:    "not configured",
+			wantNil: true,
+		},
+		{
+			name:         "endpoint",
+			env:          map[string]string{EnvEndpoint: "http://collector:4318/"},
+			wantEndpoint: "http://collector:4318/v1/traces",
+			wantService:  DefaultServiceName,
+		},
+		{
+			name:         "traces endpoint",
+			env:          map[string]string{EnvEndpoint: "http://collector:4318", EnvTracesEndpoint: "https://traces.example.com/otlp"},
+			wantEndpoint: "https://traces.example.com/otlp",
+			wantService:  DefaultServiceName,
+		},
+		{
+			name:         "headers and service name",
+			env:          map[string]string{EnvEndpoint: "http://collector:4318", EnvHeaders: "x-team=platform, authorization=Bearer%20token", EnvServiceName: "argocd-cmp"},
+			wantEndpoint: "http://collector:4318/v1/traces",
+			wantHeaders:  map[string]string{"x-team": "platform", "authorization": "Bearer token"},
+			wantService:  "argocd-cmp",
+		},
+		{
+			name:    "disabled",
+			env:     map[string]string{EnvEndpoint: "http://collector:4318", EnvSDKDisabled: "true"},
+			wantNil: true,
+		},
+		{
+			name:    "invalid header",
+			env:     map[string]string{EnvEndpoint: "http://collector:4318", EnvHeaders: "token"},
+			wantErr: `invalid OTLP header "token"`,
+		},
+		{
+			name:    "invalid traceparent",
+			env:     map[string]string{EnvEndpoint: "http://collector:4318", EnvTraceParent: "00-abc-01"},
+			wantErr: "invalid TRACEPARENT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			tracer, err := FromEnv("1.0.0")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FromEnv() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromEnv() error = %v, want nil", err)
+			}
+			if tt.wantNil {
+				if tracer != nil {
+					t.Errorf("FromEnv() = %+v, want nil", tracer)
+				}
+				return
+			}
+			if tracer.endpoint != tt.wantEndpoint {
+				t.Errorf("FromEnv() endpoint = %q, want %q", tracer.endpoint, tt.wantEndpoint)
+			}
+			if tracer.service != tt.wantService {
+				t.Errorf("FromEnv() service = %q, want %q", tracer.service, tt.wantService)
+			}
+			for key, value := range tt.wantHeaders {
+				if tracer.headers[key] != value {
+					t.Errorf("FromEnv() header %s = %q, want %q", key, tracer.headers[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "render")
+	span.SetAttribute("files", 3)
+	span.End(errors.New("failed"))
+	if ctx != context.Background() {
+		t.Error("Start() on a nil tracer should return the context unchanged")
+	}
+	if err := tracer.Export(ctx); err != nil {
+		t.Errorf("Export() error = %v, want nil", err)
+	}
+}
+
+func TestTracer_Export(t *testing.T) {
+	var body exportRequest
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("Failed to decode export request: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	clearEnv(t)
+	t.Setenv(EnvTracesEndpoint, server.URL)
+	t.Setenv(EnvHeaders, "x-team=platform")
+	t.Setenv(EnvTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tracer, err := FromEnv("1.0.0")
+	if err != nil {
+		t.Fatalf("FromEnv() error = %v, want nil", err)
+	}
+
+	ctx, render := tracer.Start(context.Background(), "render")
+	_, build := tracer.Start(ctx, "build")
+	build.SetAttribute("pipeline", "tenant")
+	build.SetAttribute("files", 3)
+	build.SetAttribute("cached", true)
+	build.End(errors.New("kustomize failed"))
+	render.End(nil)
+
+	if err := tracer.Export(context.Background()); err != nil {
+		t.Fatalf("Export() error = %v, want nil", err)
+	}
+	if got := headers.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := headers.Get("x-team"); got != "platform" {
+		t.Errorf("x-team header = %q, want platform", got)
+	}
+
+	if len(body.ResourceSpans) != 1 || len(body.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("export request = %+v, want one resource and scope", body)
+	}
+	if got := *body.ResourceSpans[0].Resource.Attributes[0].Value.StringValue; got != DefaultServiceName {
+		t.Errorf("service.name = %q, want %q", got, DefaultServiceName)
+	}
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	buildSpan, renderSpan := spans[0], spans[1]
+	if buildSpan.Name != "build" || renderSpan.Name != "render" {
+		t.Fatalf("exported spans %q and %q, want build and render", buildSpan.Name, renderSpan.Name)
+	}
+	for _, span := range spans {
+		if span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("span %s traceId = %q, want the one of TRACEPARENT", span.Name, span.TraceID)
+		}
+	}
+	if renderSpan.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("render parentSpanId = %q, want the one of TRACEPARENT", renderSpan.ParentSpanID)
+	}
+	if buildSpan.ParentSpanID != renderSpan.SpanID {
+		t.Errorf("build parentSpanId = %q, want the render span %q", buildSpan.ParentSpanID, renderSpan.SpanID)
+	}
+	if buildSpan.Status.Code != statusCodeError || buildSpan.Status.Message != "kustomize failed" {
+		t.Errorf("build status = %+v, want an error", buildSpan.Status)
+	}
+	if renderSpan.Status.Code != statusCodeOK {
+		t.Errorf("render status = %+v, want ok", renderSpan.Status)
+	}
+
+	attributes, err := json.Marshal(buildSpan.Attributes)
+	if err != nil {
+		t.Fatalf("Failed to encode attributes: %v", err)
+	}
+	want := `[{"key":"pipeline","value":{"stringValue":"tenant"}},{"key":"files","value":{"intValue":"3"}},{"key":"cached","value":{"boolValue":true}}]`
+	if string(attributes) != want {
+		t.Errorf("build attributes = %s, want %s", attributes, want)
+	}
+
+	// Exported spans are not sent again
+	body = exportRequest{}
+	if err := tracer.Export(context.Background()); err != nil || body.ResourceSpans != nil {
+		t.Errorf("second Export() = %v, %+v, want nothing sent", err, body)
+	}
+}
+
+func TestTracer_Export_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	clearEnv(t)
+	t.Setenv(EnvTracesEndpoint, server.URL)
+	tracer, err := FromEnv("1.0.0")
+	if err != nil {
+		t.Fatalf("FromEnv() error = %v, want nil", err)
+	}
+	_, span := tracer.Start(context.Background(), "render")
+	span.End(nil)
+
+	err = tracer.Export(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "503 Service Unavailable") {
+		t.Errorf("Export() error = %v, want error containing %q", err, "503 Service Unavailable")
+	}
+}
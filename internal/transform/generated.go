@@ -0,0 +1,129 @@
+package transform
+
+import (
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// Placements of generated resources in the output
+const (
+	PlacementPrepend  = "prepend"
+	PlacementAppend   = "append"
+	PlacementAdjacent = "adjacent"
+)
+
+// GeneratedAnnotation marks resources that a kustomize generator created rather than Helm
+const GeneratedAnnotation = "helm.plugin.kustomize/generated"
+
+// PlaceGenerated moves the generated resources, given as indexes of resources, according to
+// placement and returns the reordered resources. Prepend and append keep the order of the
+// generated resources. Adjacent puts each generated resource right before the first resource
+// referencing its name, so that it is applied before its consumer; unreferenced resources stay
+// where kustomize put them. If annotate is set, generated resources get GeneratedAnnotation.
+func PlaceGenerated(resources []map[string]any, generated []int, placement string, annotate bool) []map[string]any {
+	isGenerated := make(map[int]bool, len(generated))
+	for _, i := range generated {
+		isGenerated[i] = true
+		if annotate {
+			annotateGenerated(resources[i])
+		}
+	}
+
+	var placed, rest []map[string]any
+	for i, resource := range resources {
+		if isGenerated[i] {
+			placed = append(placed, resource)
+		} else {
+			rest = append(rest, resource)
+		}
+	}
+
+	switch placement {
+	case PlacementPrepend:
+		return append(placed, rest...)
+	case PlacementAppend:
+		return append(rest, placed...)
+	case PlacementAdjacent:
+		return placeAdjacent(resources, isGenerated)
+	}
+	return resources
+}
+
+// placeAdjacent puts each generated resource before its first consumer
+func placeAdjacent(resources []map[string]any, isGenerated map[int]bool) []map[string]any {
+	// before maps the index of a consumer to the generated resources placed before it
+	before := map[int][]int{}
+	moved := map[int]bool{}
+	for g := range resources {
+		if !isGenerated[g] {
+			continue
+		}
+		name := manifest.IDOf(resources[g]).Name
+		for i, resource := range resources {
+			if !isGenerated[i] && references(resource, name) {
+				before[i] = append(before[i], g)
+				moved[g] = true
+				break
+			}
+		}
+	}
+
+	placed := make([]map[string]any, 0, len(resources))
+	for i, resource := range resources {
+		if moved[i] {
+			continue
+		}
+		for _, g := range before[i] {
+			placed = append(placed, resources[g])
+		}
+		placed = append(placed, resource)
+	}
+	return placed
+}
+
+// references reports whether any string value of a resource other than its own name equals name
+func references(resource map[string]any, name string) bool {
+	for key, value := range resource {
+		if key == "metadata" {
+			continue
+		}
+		if containsString(value, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(value any, s string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == s
+	case map[string]any:
+		for _, item := range v {
+			if containsString(item, s) {
+				return true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if containsString(item, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// annotateGenerated sets GeneratedAnnotation on a resource
+func annotateGenerated(resource map[string]any) {
+	metadata, ok := resource["metadata"].(map[string]any)
+	if !ok {
+		metadata = map[string]any{}
+		resource["metadata"] = metadata
+	}
+	annotations, ok := metadata["annotations"].(map[string]any)
+	if !ok {
+		annotations = map[string]any{}
+		metadata["annotations"] = annotations
+	}
+	annotations[GeneratedAnnotation] = "true"
+}
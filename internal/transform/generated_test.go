@@ -0,0 +1,62 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestPlaceGenerated(t *testing.T) {
+	newResources := func() []map[string]any {
+		return []map[string]any{
+			{"kind": "Service", "metadata": map[string]any{"name": "web"}},
+			{"kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+				"volumes": []any{map[string]any{"configMap": map[string]any{"name": "settings-8g2h5"}}},
+			}},
+			{"kind": "ConfigMap", "metadata": map[string]any{"name": "settings-8g2h5"}},
+			{"kind": "Secret", "metadata": map[string]any{"name": "unused-b2c4"}},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		placement string
+		want      []string
+	}{
+		{name: "kustomize order", want: []string{"Service", "Deployment", "ConfigMap", "Secret"}},
+		{name: "prepend", placement: PlacementPrepend, want: []string{"ConfigMap", "Secret", "Service", "Deployment"}},
+		{name: "append", placement: PlacementAppend, want: []string{"Service", "Deployment", "ConfigMap", "Secret"}},
+		{name: "adjacent", placement: PlacementAdjacent, want: []string{"Service", "ConfigMap", "Deployment", "Secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placed := PlaceGenerated(newResources(), []int{2, 3}, tt.placement, false)
+			var kinds []string
+			for _, resource := range placed {
+				kinds = append(kinds, manifest.IDOf(resource).Kind)
+			}
+			if !reflect.DeepEqual(kinds, tt.want) {
+				t.Errorf("PlaceGenerated() kinds = %v, want %v", kinds, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceGenerated_Annotate(t *testing.T) {
+	resources := []map[string]any{
+		{"kind": "Deployment", "metadata": map[string]any{"name": "web"}},
+		{"kind": "ConfigMap", "metadata": map[string]any{"name": "settings-8g2h5", "annotations": map[string]any{"owner": "web"}}},
+	}
+
+	placed := PlaceGenerated(resources, []int{1}, "", true)
+
+	want := map[string]any{"owner": "web", GeneratedAnnotation: "true"}
+	if got := placed[1]["metadata"].(map[string]any)["annotations"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("annotations = %v, want %v", got, want)
+	}
+	if _, ok := placed[0]["metadata"].(map[string]any)["annotations"]; ok {
+		t.Errorf("Helm resource was annotated: %v", placed[0])
+	}
+}
@@ -0,0 +1,139 @@
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// Hardening records a securityContext field changed by Harden
+type Hardening struct {
+	Resource manifest.ID
+	// Field is the path of the field in the pod spec, e.g. "containers[web].securityContext.privileged"
+	Field string
+	// From and To are the previous and the new value, nil if the field is not set
+	From any
+	To   any
+}
+
+// String formats the change for the hardening report
+func (h Hardening) String() string {
+	return fmt.Sprintf("%s: %s %s -> %s", h.Resource, h.Field, describeValue(h.From), describeValue(h.To))
+}
+
+// describeValue formats a field value, or "unset" for nil
+func describeValue(value any) string {
+	if value == nil {
+		return "unset"
+	}
+	return fmt.Sprint(value)
+}
+
+// Harden enforces, in place, the securityContext settings of the restricted Pod Security
+// Standard on the pod specs of the resources selected by matches and returns the changes:
+// runAsNonRoot, a RuntimeDefault seccomp profile unless the pod uses a Localhost one, no
+// privileged containers or privilege escalation, and all capabilities dropped except for
+// NET_BIND_SERVICE. With readOnlyRootFilesystem, containers also get a read-only root filesystem.
+// Settings already meeting the baseline are left alone.
+func Harden(resources []map[string]any, matches func(map[string]any) bool, readOnlyRootFilesystem bool) []Hardening {
+	var changes []Hardening
+	for _, resource := range resources {
+		path, ok := manifest.PodSpecPath(manifest.IDOf(resource).Kind)
+		if !ok || !matches(resource) {
+			continue
+		}
+		spec := podSpec(resource, path)
+		if spec == nil {
+			continue
+		}
+
+		h := hardener{resource: manifest.IDOf(resource)}
+		pod := child(spec, "securityContext")
+		h.set(pod, "securityContext.runAsNonRoot", "runAsNonRoot", true)
+		seccomp := child(pod, "seccompProfile")
+		if profile := seccomp["type"]; profile != "RuntimeDefault" && profile != "Localhost" {
+			h.set(seccomp, "securityContext.seccompProfile.type", "type", "RuntimeDefault")
+		}
+
+		for _, field := range []string{"initContainers", "containers"} {
+			list, _ := spec[field].([]any)
+			for _, entry := range list {
+				container, ok := entry.(map[string]any)
+				if !ok {
+					continue
+				}
+				prefix := fmt.Sprintf("%s[%v].securityContext.", field, container["name"])
+				h.hardenContainer(child(container, "securityContext"), prefix, readOnlyRootFilesystem)
+			}
+		}
+		changes = append(changes, h.changes...)
+	}
+	return changes
+}
+
+// hardener collects the changes made to the pod spec of a resource
+type hardener struct {
+	resource manifest.ID
+	changes  []Hardening
+}
+
+// hardenContainer enforces the baseline on the securityContext of a container
+func (h *hardener) hardenContainer(securityContext map[string]any, prefix string, readOnlyRootFilesystem bool) {
+	// runAsNonRoot and seccompProfile are inherited from the pod unless the container overrides them
+	if runAsNonRoot, ok := securityContext["runAsNonRoot"]; ok && runAsNonRoot != true {
+		h.set(securityContext, prefix+"runAsNonRoot", "runAsNonRoot", true)
+	}
+	if seccomp, ok := securityContext["seccompProfile"].(map[string]any); ok {
+		if profile := seccomp["type"]; profile != "RuntimeDefault" && profile != "Localhost" {
+			h.set(seccomp, prefix+"seccompProfile.type", "type", "RuntimeDefault")
+		}
+	}
+	if privileged, ok := securityContext["privileged"]; ok && privileged != false {
+		h.set(securityContext, prefix+"privileged", "privileged", false)
+	}
+	h.set(securityContext, prefix+"allowPrivilegeEscalation", "allowPrivilegeEscalation", false)
+	if readOnlyRootFilesystem {
+		h.set(securityContext, prefix+"readOnlyRootFilesystem", "readOnlyRootFilesystem", true)
+	}
+
+	capabilities := child(securityContext, "capabilities")
+	h.set(capabilities, prefix+"capabilities.drop", "drop", []any{"ALL"})
+	if add, ok := capabilities["add"].([]any); ok {
+		allowed := slices.DeleteFunc(slices.Clone(add), func(capability any) bool {
+			return strings.TrimPrefix(fmt.Sprint(capability), "CAP_") != "NET_BIND_SERVICE"
+		})
+		if len(allowed) == 0 {
+			delete(capabilities, "add")
+			h.changes = append(h.changes, Hardening{Resource: h.resource, Field: prefix + "capabilities.add", From: add})
+		} else {
+			h.set(capabilities, prefix+"capabilities.add", "add", allowed)
+		}
+	}
+}
+
+// child returns the map in field of parent, adding an empty one if it has none
+func child(parent map[string]any, field string) map[string]any {
+	child, ok := parent[field].(map[string]any)
+	if !ok {
+		child = map[string]any{}
+		parent[field] = child
+	}
+	return child
+}
+
+// set sets key of m to value and records the change, unless it already has that value. The
+// "drop ALL" capability list is considered set if it contains ALL.
+func (h *hardener) set(m map[string]any, field, key string, value any) {
+	current := m[key]
+	if reflect.DeepEqual(current, value) {
+		return
+	}
+	if list, isList := current.([]any); isList && key == "drop" && slices.Contains(list, any("ALL")) {
+		return
+	}
+	m[key] = value
+	h.changes = append(h.changes, Hardening{Resource: h.resource, Field: field, From: current, To: value})
+}
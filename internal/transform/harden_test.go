@@ -0,0 +1,115 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestHarden(t *testing.T) {
+	newResources := func() []map[string]any {
+		return []map[string]any{
+			{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+				"template": map[string]any{"spec": map[string]any{
+					"initContainers": []any{map[string]any{"name": "init", "securityContext": map[string]any{"privileged": true}}},
+					"containers": []any{map[string]any{"name": "web", "securityContext": map[string]any{
+						"runAsNonRoot": false,
+						"capabilities": map[string]any{"add": []any{"NET_ADMIN", "NET_BIND_SERVICE"}, "drop": []any{"NET_RAW"}},
+					}}},
+				}},
+			}},
+			{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "settings"}},
+		}
+	}
+	all := func(map[string]any) bool { return true }
+	web := manifest.ID{Group: "apps", Kind: "Deployment", Name: "web"}
+
+	t.Run("enforces the baseline", func(t *testing.T) {
+		resources := newResources()
+		got := Harden(resources, all, true)
+
+		var report []string
+		for _, change := range got {
+			report = append(report, change.String())
+		}
+		want := []string{
+			"Deployment.apps/web: securityContext.runAsNonRoot unset -> true",
+			"Deployment.apps/web: securityContext.seccompProfile.type unset -> RuntimeDefault",
+			"Deployment.apps/web: initContainers[init].securityContext.privileged true -> false",
+			"Deployment.apps/web: initContainers[init].securityContext.allowPrivilegeEscalation unset -> false",
+			"Deployment.apps/web: initContainers[init].securityContext.readOnlyRootFilesystem unset -> true",
+			"Deployment.apps/web: initContainers[init].securityContext.capabilities.drop unset -> [ALL]",
+			"Deployment.apps/web: containers[web].securityContext.runAsNonRoot false -> true",
+			"Deployment.apps/web: containers[web].securityContext.allowPrivilegeEscalation unset -> false",
+			"Deployment.apps/web: containers[web].securityContext.readOnlyRootFilesystem unset -> true",
+			"Deployment.apps/web: containers[web].securityContext.capabilities.drop [NET_RAW] -> [ALL]",
+			"Deployment.apps/web: containers[web].securityContext.capabilities.add [NET_ADMIN NET_BIND_SERVICE] -> [NET_BIND_SERVICE]",
+		}
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("Harden() =\n%q\nwant:\n%q", report, want)
+		}
+		for _, change := range got {
+			if change.Resource != web {
+				t.Errorf("Harden() changed %s, want only %s", change.Resource, web)
+			}
+		}
+
+		spec := resources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)
+		wantContext := map[string]any{
+			"runAsNonRoot":             true,
+			"allowPrivilegeEscalation": false,
+			"readOnlyRootFilesystem":   true,
+			"capabilities":             map[string]any{"add": []any{"NET_BIND_SERVICE"}, "drop": []any{"ALL"}},
+		}
+		if got := spec["containers"].([]any)[0].(map[string]any)["securityContext"]; !reflect.DeepEqual(got, wantContext) {
+			t.Errorf("container securityContext = %v, want %v", got, wantContext)
+		}
+	})
+
+	t.Run("writable root filesystem", func(t *testing.T) {
+		resources := newResources()
+		for _, change := range Harden(resources, all, false) {
+			if change.Field == "containers[web].securityContext.readOnlyRootFilesystem" {
+				t.Errorf("Harden() set %s without readOnlyRootFilesystem", change.Field)
+			}
+		}
+	})
+
+	t.Run("hardening twice changes nothing", func(t *testing.T) {
+		resources := newResources()
+		Harden(resources, all, true)
+		if got := Harden(resources, all, true); got != nil {
+			t.Errorf("Harden() = %v, want nil", got)
+		}
+	})
+
+	t.Run("unselected resources", func(t *testing.T) {
+		resources := newResources()
+		if got := Harden(resources, func(map[string]any) bool { return false }, true); got != nil {
+			t.Errorf("Harden() = %v, want nil", got)
+		}
+	})
+
+	t.Run("capabilities removed", func(t *testing.T) {
+		resources := []map[string]any{
+			{"apiVersion": "v1", "kind": "Pod", "metadata": map[string]any{"name": "debug"}, "spec": map[string]any{
+				"securityContext": map[string]any{"runAsNonRoot": true, "seccompProfile": map[string]any{"type": "Localhost"}},
+				"containers": []any{map[string]any{"name": "debug", "securityContext": map[string]any{
+					"allowPrivilegeEscalation": false,
+					"readOnlyRootFilesystem":   true,
+					"capabilities":             map[string]any{"add": []any{"SYS_PTRACE"}, "drop": []any{"NET_RAW", "ALL"}},
+				}}},
+			}},
+		}
+		got := Harden(resources, all, true)
+		want := []Hardening{{
+			Resource: manifest.ID{Kind: "Pod", Name: "debug"},
+			Field:    "containers[debug].securityContext.capabilities.add",
+			From:     []any{"SYS_PTRACE"},
+		}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Harden() = %v, want %v", got, want)
+		}
+	})
+}
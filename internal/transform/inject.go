@@ -0,0 +1,88 @@
+package transform
+
+import (
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// InjectContainers appends, in place, containers and init containers to the pod specs of the
+// resources selected by matches and returns the IDs of the resources it changed. Containers
+// whose name is already taken in the pod spec are skipped, so that injecting twice, or into a
+// chart that already ships the sidecar, is a no-op. Resources without a pod spec are ignored.
+func InjectContainers(resources []map[string]any, matches func(map[string]any) bool, containers, initContainers []map[string]any) []manifest.ID {
+	var injected []manifest.ID
+	for _, resource := range resources {
+		path, ok := manifest.PodSpecPath(manifest.IDOf(resource).Kind)
+		if !ok || !matches(resource) {
+			continue
+		}
+		spec := podSpec(resource, path)
+		if spec == nil {
+			continue
+		}
+		added := appendContainers(spec, "initContainers", initContainers)
+		if appendContainers(spec, "containers", containers) {
+			added = true
+		}
+		if added {
+			injected = append(injected, manifest.IDOf(resource))
+		}
+	}
+	return injected
+}
+
+// podSpec returns the map at path, or nil if the resource has none
+func podSpec(resource map[string]any, path []string) map[string]any {
+	spec := resource
+	for _, key := range path {
+		next, ok := spec[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		spec = next
+	}
+	return spec
+}
+
+// appendContainers appends copies of the containers whose name is not taken to the list field of
+// the pod spec and reports whether it added any
+func appendContainers(spec map[string]any, field string, containers []map[string]any) bool {
+	list, _ := spec[field].([]any)
+	taken := map[any]bool{}
+	for _, entry := range list {
+		if container, ok := entry.(map[string]any); ok {
+			taken[container["name"]] = true
+		}
+	}
+
+	added := false
+	for _, container := range containers {
+		if taken[container["name"]] {
+			continue
+		}
+		list = append(list, copyValue(container))
+		added = true
+	}
+	if added {
+		spec[field] = list
+	}
+	return added
+}
+
+// copyValue deep-copies a decoded YAML value, so that injected containers don't share maps
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, field := range v {
+			copied[key] = copyValue(field)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+	return value
+}
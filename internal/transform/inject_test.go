@@ -0,0 +1,101 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestInjectContainers(t *testing.T) {
+	newResources := func() []map[string]any {
+		return []map[string]any{
+			{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+				"template": map[string]any{"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "web", "image": "nginx"}},
+				}},
+			}},
+			{"apiVersion": "batch/v1", "kind": "CronJob", "metadata": map[string]any{"name": "backup"}, "spec": map[string]any{
+				"jobTemplate": map[string]any{"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "backup", "image": "busybox"}},
+				}}}},
+			}},
+			{"apiVersion": "v1", "kind": "Pod", "metadata": map[string]any{"name": "debug"}, "spec": map[string]any{
+				"containers": []any{
+					map[string]any{"name": "debug", "image": "busybox"},
+					map[string]any{"name": "proxy", "image": "envoy:1.28"},
+				},
+			}},
+			{"apiVersion": "v1", "kind": "Service", "metadata": map[string]any{"name": "web"}},
+			{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "empty"}},
+		}
+	}
+	containers := []map[string]any{{"name": "proxy", "image": "envoy:1.30", "args": []any{"--log-level", "info"}}}
+	initContainers := []map[string]any{{"name": "wait", "image": "busybox"}}
+	all := func(map[string]any) bool { return true }
+
+	t.Run("appends to all pod specs", func(t *testing.T) {
+		resources := newResources()
+		got := InjectContainers(resources, all, containers, initContainers)
+
+		want := []manifest.ID{
+			{Group: "apps", Kind: "Deployment", Name: "web"},
+			{Group: "batch", Kind: "CronJob", Name: "backup"},
+			{Kind: "Pod", Name: "debug"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("InjectContainers() = %v, want %v", got, want)
+		}
+
+		spec := resources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)
+		wantSpec := map[string]any{
+			"containers": []any{
+				map[string]any{"name": "web", "image": "nginx"},
+				map[string]any{"name": "proxy", "image": "envoy:1.30", "args": []any{"--log-level", "info"}},
+			},
+			"initContainers": []any{map[string]any{"name": "wait", "image": "busybox"}},
+		}
+		if !reflect.DeepEqual(spec, wantSpec) {
+			t.Errorf("Deployment pod spec = %v, want %v", spec, wantSpec)
+		}
+
+		// The pod already has a proxy container, which is kept
+		podContainers := resources[2]["spec"].(map[string]any)["containers"].([]any)
+		if len(podContainers) != 2 || podContainers[1].(map[string]any)["image"] != "envoy:1.28" {
+			t.Errorf("Pod containers = %v, want the existing proxy kept", podContainers)
+		}
+	})
+
+	t.Run("only matching resources", func(t *testing.T) {
+		resources := newResources()
+		got := InjectContainers(resources, func(resource map[string]any) bool {
+			return manifest.IDOf(resource).Kind == "CronJob"
+		}, containers, nil)
+
+		want := []manifest.ID{{Group: "batch", Kind: "CronJob", Name: "backup"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("InjectContainers() = %v, want %v", got, want)
+		}
+		if len(resources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)) != 1 {
+			t.Errorf("Deployment was changed: %v", resources[0])
+		}
+	})
+
+	t.Run("injecting twice is a no-op", func(t *testing.T) {
+		resources := newResources()
+		InjectContainers(resources, all, containers, initContainers)
+		if got := InjectContainers(resources, all, containers, initContainers); got != nil {
+			t.Errorf("InjectContainers() = %v, want nil", got)
+		}
+	})
+
+	t.Run("injected containers are copies", func(t *testing.T) {
+		resources := newResources()
+		InjectContainers(resources, all, containers, nil)
+		injected := resources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)[1].(map[string]any)
+		injected["image"] = "changed"
+		if containers[0]["image"] != "envoy:1.30" {
+			t.Errorf("Injected container shares its map with the input")
+		}
+	})
+}
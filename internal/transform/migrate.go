@@ -0,0 +1,43 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/owhelm/helm-kustomize/internal/validate"
+	"github.com/owhelm/helm-kustomize/internal/version"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// Migration records an apiVersion rewritten by MigrateAPIs
+type Migration struct {
+	Resource manifest.ID
+	From     string
+	To       string
+}
+
+// String formats the migration for the change report
+func (m Migration) String() string {
+	return fmt.Sprintf("%s: %s -> %s", m.Resource, m.From, m.To)
+}
+
+// MigrateAPIs rewrites, in place, the apiVersion of resources using APIs removed in the target
+// Kubernetes version when the replacement accepts the same fields. Resources whose migration
+// needs more than an apiVersion change are left alone and still reported by validation.
+func MigrateAPIs(resources []map[string]any, target version.Semver) []Migration {
+	var migrations []Migration
+
+	for _, resource := range resources {
+		apiVersion, _ := resource["apiVersion"].(string)
+		kind, _ := resource["kind"].(string)
+
+		api, ok := validate.LookupRemovedAPI(apiVersion, kind)
+		if !ok || !api.Rewritable || target.Compare(api.RemovedIn) < 0 {
+			continue
+		}
+
+		resource["apiVersion"] = api.Replacement
+		migrations = append(migrations, Migration{Resource: manifest.IDOf(resource), From: apiVersion, To: api.Replacement})
+	}
+
+	return migrations
+}
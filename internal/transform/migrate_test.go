@@ -0,0 +1,60 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+func TestMigrateAPIs(t *testing.T) {
+	pdb := map[string]any{
+		"apiVersion": "policy/v1beta1",
+		"kind":       "PodDisruptionBudget",
+		"metadata":   map[string]any{"name": "web", "namespace": "prod"},
+	}
+	ingress := map[string]any{
+		"apiVersion": "extensions/v1beta1",
+		"kind":       "Ingress",
+		"metadata":   map[string]any{"name": "web"},
+	}
+	cronJob := map[string]any{
+		"apiVersion": "batch/v1beta1",
+		"kind":       "CronJob",
+		"metadata":   map[string]any{"name": "cleanup"},
+	}
+
+	migrations := MigrateAPIs([]map[string]any{pdb, ingress, cronJob}, version.Semver{Major: 1, Minor: 25})
+
+	if len(migrations) != 2 {
+		t.Fatalf("MigrateAPIs() = %v, want 2 migrations", migrations)
+	}
+	if got := migrations[0].String(); got != "PodDisruptionBudget.policy/prod/web: policy/v1beta1 -> policy/v1" {
+		t.Errorf("migrations[0] = %q", got)
+	}
+	if got := migrations[1].String(); got != "CronJob.batch/cleanup: batch/v1beta1 -> batch/v1" {
+		t.Errorf("migrations[1] = %q", got)
+	}
+
+	if pdb["apiVersion"] != "policy/v1" {
+		t.Errorf("PodDisruptionBudget apiVersion = %v, want policy/v1", pdb["apiVersion"])
+	}
+	// The Ingress schema changed in networking.k8s.io/v1, so it cannot be rewritten
+	if ingress["apiVersion"] != "extensions/v1beta1" {
+		t.Errorf("Ingress apiVersion = %v, want it unchanged", ingress["apiVersion"])
+	}
+}
+
+func TestMigrateAPIs_BeforeRemoval(t *testing.T) {
+	cronJob := map[string]any{
+		"apiVersion": "batch/v1beta1",
+		"kind":       "CronJob",
+		"metadata":   map[string]any{"name": "cleanup"},
+	}
+
+	if migrations := MigrateAPIs([]map[string]any{cronJob}, version.Semver{Major: 1, Minor: 24}); len(migrations) != 0 {
+		t.Errorf("MigrateAPIs() = %v, want none before the removal", migrations)
+	}
+	if cronJob["apiVersion"] != "batch/v1beta1" {
+		t.Errorf("CronJob apiVersion = %v, want it unchanged", cronJob["apiVersion"])
+	}
+}
@@ -0,0 +1,104 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// DefaultRegistry is the registry of images that don't name one
+const DefaultRegistry = "docker.io"
+
+// ImageRewrite records an image changed by MirrorRegistries
+type ImageRewrite struct {
+	Resource manifest.ID
+	From     string
+	To       string
+}
+
+// String formats the rewrite for the debug output
+func (r ImageRewrite) String() string {
+	return fmt.Sprintf("%s: %s -> %s", r.Resource, r.From, r.To)
+}
+
+// MirrorRegistries rewrites, in place, the images of the containers, init containers and
+// ephemeral containers in the pod specs of the resources to pull from the mirror of their
+// registry and returns the changes. Mirrors are keyed by registry host, e.g. "docker.io", and
+// may add a path, e.g. "mirror.internal/dockerhub". Images without a registry are Docker Hub
+// images, whose official images live under library/, so with a docker.io mirror "nginx:1.25"
+// becomes "mirror.internal/library/nginx:1.25".
+func MirrorRegistries(resources []map[string]any, mirrors map[string]string) []ImageRewrite {
+	var rewrites []ImageRewrite
+	_ = eachContainer(resources, func(id manifest.ID, container map[string]any) error {
+		image, _ := container["image"].(string)
+		if mirrored, ok := mirrorImage(image, mirrors); ok {
+			container["image"] = mirrored
+			rewrites = append(rewrites, ImageRewrite{Resource: id, From: image, To: mirrored})
+		}
+		return nil
+	})
+	return rewrites
+}
+
+// eachContainer calls fn with the init containers, containers and ephemeral containers of the
+// pod specs of the resources, stopping at the first error
+func eachContainer(resources []map[string]any, fn func(id manifest.ID, container map[string]any) error) error {
+	for _, resource := range resources {
+		id := manifest.IDOf(resource)
+		path, ok := manifest.PodSpecPath(id.Kind)
+		if !ok {
+			continue
+		}
+		spec := podSpec(resource, path)
+		if spec == nil {
+			continue
+		}
+
+		for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+			list, _ := spec[field].([]any)
+			for _, entry := range list {
+				if container, ok := entry.(map[string]any); ok {
+					if err := fn(id, container); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// mirrorImage returns the image pulled from the mirror of its registry, if there is one
+func mirrorImage(image string, mirrors map[string]string) (string, bool) {
+	if image == "" {
+		return "", false
+	}
+	registry, repository := splitRegistry(image)
+	mirror, ok := mirrors[registry]
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSuffix(mirror, "/") + "/" + repository, true
+}
+
+// splitRegistry splits an image reference into its registry host and the rest, following the
+// rules of the container runtimes: the first path component is a registry if it contains a dot
+// or a port, or is localhost. Docker Hub aliases are normalized to DefaultRegistry.
+func splitRegistry(image string) (registry, repository string) {
+	first, rest, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		registry, repository = first, rest
+	} else {
+		registry, repository = DefaultRegistry, image
+	}
+
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io":
+		registry = DefaultRegistry
+	}
+	if registry == DefaultRegistry && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return registry, repository
+}
@@ -0,0 +1,82 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestMirrorRegistries(t *testing.T) {
+	resources := []map[string]any{
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+			"template": map[string]any{"spec": map[string]any{
+				"initContainers": []any{map[string]any{"name": "wait", "image": "busybox"}},
+				"containers": []any{
+					map[string]any{"name": "web", "image": "bitnami/nginx:1.25"},
+					map[string]any{"name": "proxy", "image": "quay.io/envoy/envoy:1.30"},
+					map[string]any{"name": "agent", "image": "registry.internal:5000/agent"},
+				},
+			}},
+		}},
+		{"apiVersion": "batch/v1", "kind": "CronJob", "metadata": map[string]any{"name": "backup"}, "spec": map[string]any{
+			"jobTemplate": map[string]any{"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+				"containers": []any{map[string]any{"name": "backup", "image": "docker.io/library/postgres@sha256:abc"}},
+			}}}},
+		}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "images"}, "data": map[string]any{"image": "nginx"}},
+	}
+	mirrors := map[string]string{"docker.io": "mirror.internal", "quay.io": "mirror.internal/quay/"}
+
+	got := MirrorRegistries(resources, mirrors)
+
+	web := manifest.ID{Group: "apps", Kind: "Deployment", Name: "web"}
+	backup := manifest.ID{Group: "batch", Kind: "CronJob", Name: "backup"}
+	want := []ImageRewrite{
+		{Resource: web, From: "busybox", To: "mirror.internal/library/busybox"},
+		{Resource: web, From: "bitnami/nginx:1.25", To: "mirror.internal/bitnami/nginx:1.25"},
+		{Resource: web, From: "quay.io/envoy/envoy:1.30", To: "mirror.internal/quay/envoy/envoy:1.30"},
+		{Resource: backup, From: "docker.io/library/postgres@sha256:abc", To: "mirror.internal/library/postgres@sha256:abc"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MirrorRegistries() = %v, want %v", got, want)
+	}
+
+	containers := resources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)
+	if image := containers[0].(map[string]any)["image"]; image != "mirror.internal/bitnami/nginx:1.25" {
+		t.Errorf("web image = %v, want mirror.internal/bitnami/nginx:1.25", image)
+	}
+	if image := resources[2]["data"].(map[string]any)["image"]; image != "nginx" {
+		t.Errorf("ConfigMap was changed: %v", resources[2])
+	}
+
+	// Mirrored images are not mirrored again
+	if got := MirrorRegistries(resources, mirrors); got != nil {
+		t.Errorf("MirrorRegistries() on mirrored images = %v, want nil", got)
+	}
+}
+
+func TestSplitRegistry(t *testing.T) {
+	tests := []struct {
+		image          string
+		wantRegistry   string
+		wantRepository string
+	}{
+		{image: "nginx", wantRegistry: "docker.io", wantRepository: "library/nginx"},
+		{image: "nginx:1.25", wantRegistry: "docker.io", wantRepository: "library/nginx:1.25"},
+		{image: "bitnami/redis", wantRegistry: "docker.io", wantRepository: "bitnami/redis"},
+		{image: "index.docker.io/nginx", wantRegistry: "docker.io", wantRepository: "library/nginx"},
+		{image: "ghcr.io/org/app:v1", wantRegistry: "ghcr.io", wantRepository: "org/app:v1"},
+		{image: "localhost/app", wantRegistry: "localhost", wantRepository: "app"},
+		{image: "registry:5000/app", wantRegistry: "registry:5000", wantRepository: "app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			registry, repository := splitRegistry(tt.image)
+			if registry != tt.wantRegistry || repository != tt.wantRepository {
+				t.Errorf("splitRegistry(%q) = %q, %q, want %q, %q", tt.image, registry, repository, tt.wantRegistry, tt.wantRepository)
+			}
+		})
+	}
+}
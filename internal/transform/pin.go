@@ -0,0 +1,34 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// PinDigests adds, in place, the digest returned by digest to the container images of the pod
+// specs of the resources that have none, keeping the tag for readability, e.g.
+// "nginx:1.25@sha256:4c0f...". The container runtime then pulls the digest, so the output no
+// longer changes when a tag is moved. It returns the changes, or the first error of digest.
+func PinDigests(resources []map[string]any, digest func(image string) (string, error)) ([]ImageRewrite, error) {
+	var rewrites []ImageRewrite
+	err := eachContainer(resources, func(id manifest.ID, container map[string]any) error {
+		image, _ := container["image"].(string)
+		if image == "" || strings.Contains(image, "@") {
+			return nil
+		}
+		resolved, err := digest(image)
+		if err != nil {
+			return fmt.Errorf("failed to pin the image of %s: %w", id, err)
+		}
+		pinned := image + "@" + resolved
+		container["image"] = pinned
+		rewrites = append(rewrites, ImageRewrite{Resource: id, From: image, To: pinned})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rewrites, nil
+}
@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestPinDigests(t *testing.T) {
+	newResources := func() []map[string]any {
+		return []map[string]any{
+			{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+				"template": map[string]any{"spec": map[string]any{
+					"initContainers": []any{map[string]any{"name": "wait", "image": "busybox"}},
+					"containers": []any{
+						map[string]any{"name": "web", "image": "nginx:1.25"},
+						map[string]any{"name": "proxy", "image": "envoy@sha256:abc"},
+					},
+				}},
+			}},
+		}
+	}
+	digests := map[string]string{"busybox": "sha256:111", "nginx:1.25": "sha256:222"}
+
+	t.Run("pins images without digest", func(t *testing.T) {
+		resources := newResources()
+		got, err := PinDigests(resources, func(image string) (string, error) { return digests[image], nil })
+		if err != nil {
+			t.Fatalf("PinDigests() error = %v, want nil", err)
+		}
+
+		web := manifest.ID{Group: "apps", Kind: "Deployment", Name: "web"}
+		want := []ImageRewrite{
+			{Resource: web, From: "busybox", To: "busybox@sha256:111"},
+			{Resource: web, From: "nginx:1.25", To: "nginx:1.25@sha256:222"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("PinDigests() = %v, want %v", got, want)
+		}
+		containers := resources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)
+		if image := containers[0].(map[string]any)["image"]; image != "nginx:1.25@sha256:222" {
+			t.Errorf("web image = %v, want nginx:1.25@sha256:222", image)
+		}
+	})
+
+	t.Run("resolution error", func(t *testing.T) {
+		_, err := PinDigests(newResources(), func(string) (string, error) { return "", errors.New("registry unreachable") })
+		if err == nil || !strings.Contains(err.Error(), "failed to pin the image of Deployment.apps/web: registry unreachable") {
+			t.Errorf("PinDigests() error = %v, want error containing %q", err, "registry unreachable")
+		}
+	})
+}
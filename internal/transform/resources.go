@@ -0,0 +1,89 @@
+package transform
+
+import (
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// DefaultResources sets, in place, the default requests and limits on the containers and init
+// containers of the resources selected by matches, and returns the IDs of the resources it
+// changed. Defaults are applied per resource name: a container that already sets a request or a
+// limit for, e.g., memory keeps its memory settings as they are, so that defaults never produce
+// a request above the limit of the chart. Kubernetes defaults a missing request to the limit.
+func DefaultResources(resources []map[string]any, matches func(map[string]any) bool, requests, limits map[string]string) []manifest.ID {
+	var changed []manifest.ID
+	for _, resource := range resources {
+		path, ok := manifest.PodSpecPath(manifest.IDOf(resource).Kind)
+		if !ok || !matches(resource) {
+			continue
+		}
+		spec := podSpec(resource, path)
+		if spec == nil {
+			continue
+		}
+
+		defaulted := false
+		for _, field := range []string{"initContainers", "containers"} {
+			list, _ := spec[field].([]any)
+			for _, entry := range list {
+				container, ok := entry.(map[string]any)
+				if ok && defaultContainerResources(container, requests, limits) {
+					defaulted = true
+				}
+			}
+		}
+		if defaulted {
+			changed = append(changed, manifest.IDOf(resource))
+		}
+	}
+	return changed
+}
+
+// defaultContainerResources sets the defaults for the resource names the container sets neither
+// a request nor a limit for, and reports whether it set any
+func defaultContainerResources(container map[string]any, requests, limits map[string]string) bool {
+	resources, _ := container["resources"].(map[string]any)
+	existingRequests, _ := resources["requests"].(map[string]any)
+	existingLimits, _ := resources["limits"].(map[string]any)
+	isSet := func(name string) bool {
+		_, requested := existingRequests[name]
+		_, limited := existingLimits[name]
+		return requested || limited
+	}
+
+	setRequests := missing(requests, isSet)
+	setLimits := missing(limits, isSet)
+	if len(setRequests) == 0 && len(setLimits) == 0 {
+		return false
+	}
+
+	if resources == nil {
+		resources = map[string]any{}
+		container["resources"] = resources
+	}
+	apply := func(field string, existing map[string]any, values map[string]any) {
+		if len(values) == 0 {
+			return
+		}
+		if existing == nil {
+			existing = map[string]any{}
+			resources[field] = existing
+		}
+		for name, value := range values {
+			existing[name] = value
+		}
+	}
+	apply("requests", existingRequests, setRequests)
+	apply("limits", existingLimits, setLimits)
+	return true
+}
+
+// missing returns the defaults for the resource names that are not set
+func missing(defaults map[string]string, isSet func(string) bool) map[string]any {
+	values := map[string]any{}
+	for name, value := range defaults {
+		if !isSet(name) {
+			values[name] = value
+		}
+	}
+	return values
+}
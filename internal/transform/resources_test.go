@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestDefaultResources(t *testing.T) {
+	requests := map[string]string{"cpu": "100m", "memory": "128Mi"}
+	limits := map[string]string{"memory": "256Mi"}
+	all := func(map[string]any) bool { return true }
+
+	tests := []struct {
+		name      string
+		container map[string]any
+		want      map[string]any
+	}{
+		{
+			name:      "no resources",
+			container: map[string]any{"name": "web"},
+			want: map[string]any{
+				"requests": map[string]any{"cpu": "100m", "memory": "128Mi"},
+				"limits":   map[string]any{"memory": "256Mi"},
+			},
+		},
+		{
+			name: "request set",
+			container: map[string]any{"name": "web", "resources": map[string]any{
+				"requests": map[string]any{"cpu": "2"},
+			}},
+			want: map[string]any{
+				"requests": map[string]any{"cpu": "2", "memory": "128Mi"},
+				"limits":   map[string]any{"memory": "256Mi"},
+			},
+		},
+		{
+			name: "limit set",
+			container: map[string]any{"name": "web", "resources": map[string]any{
+				"limits": map[string]any{"memory": "64Mi"},
+			}},
+			want: map[string]any{
+				"requests": map[string]any{"cpu": "100m"},
+				"limits":   map[string]any{"memory": "64Mi"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := []map[string]any{
+				{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+					"template": map[string]any{"spec": map[string]any{"containers": []any{tt.container}}},
+				}},
+			}
+
+			got := DefaultResources(resources, all, requests, limits)
+			if want := []manifest.ID{{Group: "apps", Kind: "Deployment", Name: "web"}}; !reflect.DeepEqual(got, want) {
+				t.Errorf("DefaultResources() = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(tt.container["resources"], tt.want) {
+				t.Errorf("resources = %v, want %v", tt.container["resources"], tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultResources_Unchanged(t *testing.T) {
+	complete := map[string]any{"name": "web", "resources": map[string]any{
+		"requests": map[string]any{"cpu": "1", "memory": "1Gi"},
+	}}
+	resources := []map[string]any{
+		{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+			"template": map[string]any{"spec": map[string]any{"containers": []any{complete}}},
+		}},
+		{"apiVersion": "batch/v1", "kind": "Job", "metadata": map[string]any{"name": "migrate"}, "spec": map[string]any{
+			"template": map[string]any{"spec": map[string]any{"initContainers": []any{map[string]any{"name": "wait"}}}},
+		}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "settings"}},
+	}
+	isDeployment := func(resource map[string]any) bool { return manifest.IDOf(resource).Kind == "Deployment" }
+
+	if got := DefaultResources(resources, isDeployment, map[string]string{"cpu": "100m", "memory": "128Mi"}, nil); got != nil {
+		t.Errorf("DefaultResources() = %v, want nil", got)
+	}
+	initContainer := resources[1]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)["initContainers"].([]any)[0]
+	if _, ok := initContainer.(map[string]any)["resources"]; ok {
+		t.Errorf("Job not selected by the target was changed: %v", resources[1])
+	}
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"reflect"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// Scheduling are the scheduling constraints stamped onto pod templates
+type Scheduling struct {
+	// NodeSelector labels are set on the pod, replacing the values of the same keys
+	NodeSelector map[string]string `yaml:"nodeSelector"`
+	// Tolerations are appended unless the pod has an identical toleration
+	Tolerations []map[string]any `yaml:"tolerations"`
+	// TopologySpreadConstraints are appended unless the pod has a constraint with the same
+	// topologyKey and whenUnsatisfiable, which Kubernetes rejects as a duplicate
+	TopologySpreadConstraints []map[string]any `yaml:"topologySpreadConstraints"`
+	// Affinity replaces the nodeAffinity, podAffinity and podAntiAffinity it sets
+	Affinity map[string]any `yaml:"affinity"`
+}
+
+// ApplyScheduling stamps, in place, the scheduling constraints onto the pod specs of the
+// resources selected by matches and returns the IDs of the resources it changed
+func ApplyScheduling(resources []map[string]any, matches func(map[string]any) bool, scheduling Scheduling) []manifest.ID {
+	var changed []manifest.ID
+	for _, resource := range resources {
+		path, ok := manifest.PodSpecPath(manifest.IDOf(resource).Kind)
+		if !ok || !matches(resource) {
+			continue
+		}
+		spec := podSpec(resource, path)
+		if spec == nil {
+			continue
+		}
+		before := copyValue(spec)
+
+		if len(scheduling.NodeSelector) > 0 {
+			selector, _ := spec["nodeSelector"].(map[string]any)
+			if selector == nil {
+				selector = map[string]any{}
+				spec["nodeSelector"] = selector
+			}
+			for key, value := range scheduling.NodeSelector {
+				selector[key] = value
+			}
+		}
+		appendUnless(spec, "tolerations", scheduling.Tolerations, reflect.DeepEqual)
+		appendUnless(spec, "topologySpreadConstraints", scheduling.TopologySpreadConstraints, func(existing, constraint any) bool {
+			e, _ := existing.(map[string]any)
+			c, _ := constraint.(map[string]any)
+			return e["topologyKey"] == c["topologyKey"] && e["whenUnsatisfiable"] == c["whenUnsatisfiable"]
+		})
+		if len(scheduling.Affinity) > 0 {
+			affinity, _ := spec["affinity"].(map[string]any)
+			if affinity == nil {
+				affinity = map[string]any{}
+				spec["affinity"] = affinity
+			}
+			for key, value := range scheduling.Affinity {
+				affinity[key] = copyValue(value)
+			}
+		}
+
+		if !reflect.DeepEqual(before, spec) {
+			changed = append(changed, manifest.IDOf(resource))
+		}
+	}
+	return changed
+}
+
+// appendUnless appends copies of the entries to the list field of the pod spec, except for
+// entries for which same reports a duplicate in the list
+func appendUnless(spec map[string]any, field string, entries []map[string]any, same func(existing, entry any) bool) {
+	if len(entries) == 0 {
+		return
+	}
+	list, _ := spec[field].([]any)
+	for _, entry := range entries {
+		duplicate := false
+		for _, existing := range list {
+			if same(existing, map[string]any(entry)) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			list = append(list, copyValue(entry))
+		}
+	}
+	spec[field] = list
+}
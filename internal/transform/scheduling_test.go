@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+func TestApplyScheduling(t *testing.T) {
+	scheduling := Scheduling{
+		NodeSelector: map[string]string{"pool": "general"},
+		Tolerations: []map[string]any{
+			{"key": "dedicated", "operator": "Equal", "value": "general", "effect": "NoSchedule"},
+		},
+		TopologySpreadConstraints: []map[string]any{
+			{"maxSkew": 1, "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable": "ScheduleAnyway"},
+		},
+		Affinity: map[string]any{
+			"nodeAffinity": map[string]any{"preferredDuringSchedulingIgnoredDuringExecution": []any{}},
+		},
+	}
+	all := func(map[string]any) bool { return true }
+
+	tests := []struct {
+		name string
+		spec map[string]any
+		want map[string]any
+	}{
+		{
+			name: "empty pod spec",
+			spec: map[string]any{},
+			want: map[string]any{
+				"nodeSelector": map[string]any{"pool": "general"},
+				"tolerations": []any{
+					map[string]any{"key": "dedicated", "operator": "Equal", "value": "general", "effect": "NoSchedule"},
+				},
+				"topologySpreadConstraints": []any{
+					map[string]any{"maxSkew": 1, "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable": "ScheduleAnyway"},
+				},
+				"affinity": map[string]any{
+					"nodeAffinity": map[string]any{"preferredDuringSchedulingIgnoredDuringExecution": []any{}},
+				},
+			},
+		},
+		{
+			name: "existing constraints",
+			spec: map[string]any{
+				"nodeSelector": map[string]any{"pool": "gpu", "arch": "arm64"},
+				"tolerations": []any{
+					map[string]any{"key": "dedicated", "operator": "Equal", "value": "general", "effect": "NoSchedule"},
+					map[string]any{"key": "gpu", "operator": "Exists"},
+				},
+				"topologySpreadConstraints": []any{
+					map[string]any{"maxSkew": 2, "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable": "ScheduleAnyway"},
+				},
+				"affinity": map[string]any{
+					"nodeAffinity":    map[string]any{"requiredDuringSchedulingIgnoredDuringExecution": map[string]any{}},
+					"podAntiAffinity": map[string]any{},
+				},
+			},
+			want: map[string]any{
+				"nodeSelector": map[string]any{"pool": "general", "arch": "arm64"},
+				"tolerations": []any{
+					map[string]any{"key": "dedicated", "operator": "Equal", "value": "general", "effect": "NoSchedule"},
+					map[string]any{"key": "gpu", "operator": "Exists"},
+				},
+				"topologySpreadConstraints": []any{
+					map[string]any{"maxSkew": 2, "topologyKey": "topology.kubernetes.io/zone", "whenUnsatisfiable": "ScheduleAnyway"},
+				},
+				"affinity": map[string]any{
+					"nodeAffinity":    map[string]any{"preferredDuringSchedulingIgnoredDuringExecution": []any{}},
+					"podAntiAffinity": map[string]any{},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := []map[string]any{
+				{"apiVersion": "apps/v1", "kind": "StatefulSet", "metadata": map[string]any{"name": "db"}, "spec": map[string]any{
+					"template": map[string]any{"spec": tt.spec},
+				}},
+			}
+
+			got := ApplyScheduling(resources, all, scheduling)
+			if want := []manifest.ID{{Group: "apps", Kind: "StatefulSet", Name: "db"}}; !reflect.DeepEqual(got, want) {
+				t.Errorf("ApplyScheduling() = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(tt.spec, tt.want) {
+				t.Errorf("pod spec = %v, want %v", tt.spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyScheduling_Unchanged(t *testing.T) {
+	scheduling := Scheduling{
+		NodeSelector: map[string]string{"pool": "general"},
+		Tolerations:  []map[string]any{{"key": "dedicated", "operator": "Exists"}},
+	}
+	resources := []map[string]any{
+		{"apiVersion": "v1", "kind": "Pod", "metadata": map[string]any{"name": "debug"}, "spec": map[string]any{
+			"nodeSelector": map[string]any{"pool": "general"},
+			"tolerations":  []any{map[string]any{"key": "dedicated", "operator": "Exists"}},
+		}},
+		{"apiVersion": "batch/v1", "kind": "Job", "metadata": map[string]any{"name": "migrate"}, "spec": map[string]any{
+			"template": map[string]any{"spec": map[string]any{}},
+		}},
+		{"apiVersion": "v1", "kind": "Service", "metadata": map[string]any{"name": "web"}},
+	}
+	isPodOrService := func(resource map[string]any) bool { return manifest.IDOf(resource).Kind != "Job" }
+
+	if got := ApplyScheduling(resources, isPodOrService, scheduling); got != nil {
+		t.Errorf("ApplyScheduling() = %v, want nil", got)
+	}
+	if spec := resources[1]["spec"].(map[string]any)["template"].(map[string]any)["spec"]; !reflect.DeepEqual(spec, map[string]any{}) {
+		t.Errorf("Job not selected by the target was changed: %v", spec)
+	}
+}
@@ -0,0 +1,120 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+// RemovedAPI is a served API version of a kind that was removed from Kubernetes
+type RemovedAPI struct {
+	APIVersion string
+	Kind       string
+	// RemovedIn is the first Kubernetes version that no longer serves the API
+	RemovedIn version.Semver
+	// Replacement is the apiVersion to migrate to, empty if the kind was dropped entirely
+	Replacement string
+	// Rewritable is set when the replacement accepts the same fields, so that migrating only
+	// requires changing the apiVersion
+	Rewritable bool
+}
+
+// removedAPIs lists the API removals from the Kubernetes deprecation guide
+var removedAPIs = []RemovedAPI{
+	// 1.16
+	{"extensions/v1beta1", "Deployment", v(1, 16), "apps/v1", false},
+	{"extensions/v1beta1", "DaemonSet", v(1, 16), "apps/v1", false},
+	{"extensions/v1beta1", "ReplicaSet", v(1, 16), "apps/v1", false},
+	{"extensions/v1beta1", "NetworkPolicy", v(1, 16), "networking.k8s.io/v1", true},
+	{"extensions/v1beta1", "PodSecurityPolicy", v(1, 16), "policy/v1beta1", false},
+	{"apps/v1beta1", "Deployment", v(1, 16), "apps/v1", false},
+	{"apps/v1beta1", "StatefulSet", v(1, 16), "apps/v1", false},
+	{"apps/v1beta2", "Deployment", v(1, 16), "apps/v1", true},
+	{"apps/v1beta2", "StatefulSet", v(1, 16), "apps/v1", true},
+	{"apps/v1beta2", "DaemonSet", v(1, 16), "apps/v1", true},
+	{"apps/v1beta2", "ReplicaSet", v(1, 16), "apps/v1", true},
+
+	// 1.22
+	{"extensions/v1beta1", "Ingress", v(1, 22), "networking.k8s.io/v1", false},
+	{"networking.k8s.io/v1beta1", "Ingress", v(1, 22), "networking.k8s.io/v1", false},
+	{"networking.k8s.io/v1beta1", "IngressClass", v(1, 22), "networking.k8s.io/v1", true},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", v(1, 22), "apiextensions.k8s.io/v1", false},
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", v(1, 22), "admissionregistration.k8s.io/v1", false},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", v(1, 22), "admissionregistration.k8s.io/v1", false},
+	{"apiregistration.k8s.io/v1beta1", "APIService", v(1, 22), "apiregistration.k8s.io/v1", true},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", v(1, 22), "certificates.k8s.io/v1", false},
+	{"coordination.k8s.io/v1beta1", "Lease", v(1, 22), "coordination.k8s.io/v1", true},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", v(1, 22), "rbac.authorization.k8s.io/v1", true},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", v(1, 22), "rbac.authorization.k8s.io/v1", true},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", v(1, 22), "rbac.authorization.k8s.io/v1", true},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", v(1, 22), "rbac.authorization.k8s.io/v1", true},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", v(1, 22), "scheduling.k8s.io/v1", true},
+	{"storage.k8s.io/v1beta1", "CSIDriver", v(1, 22), "storage.k8s.io/v1", true},
+	{"storage.k8s.io/v1beta1", "CSINode", v(1, 22), "storage.k8s.io/v1", true},
+	{"storage.k8s.io/v1beta1", "StorageClass", v(1, 22), "storage.k8s.io/v1", true},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", v(1, 22), "storage.k8s.io/v1", true},
+
+	// 1.25
+	{"batch/v1beta1", "CronJob", v(1, 25), "batch/v1", true},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", v(1, 25), "discovery.k8s.io/v1", false},
+	{"events.k8s.io/v1beta1", "Event", v(1, 25), "events.k8s.io/v1", false},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", v(1, 25), "autoscaling/v2", false},
+	{"policy/v1beta1", "PodDisruptionBudget", v(1, 25), "policy/v1", true},
+	{"policy/v1beta1", "PodSecurityPolicy", v(1, 25), "", false},
+	{"node.k8s.io/v1beta1", "RuntimeClass", v(1, 25), "node.k8s.io/v1", true},
+
+	// 1.26
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", v(1, 26), "autoscaling/v2", true},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", v(1, 26), "flowcontrol.apiserver.k8s.io/v1", false},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", v(1, 26), "flowcontrol.apiserver.k8s.io/v1", false},
+
+	// 1.27
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", v(1, 27), "storage.k8s.io/v1", true},
+
+	// 1.29
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", v(1, 29), "flowcontrol.apiserver.k8s.io/v1", true},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", v(1, 29), "flowcontrol.apiserver.k8s.io/v1", true},
+
+	// 1.32
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", v(1, 32), "flowcontrol.apiserver.k8s.io/v1", true},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", v(1, 32), "flowcontrol.apiserver.k8s.io/v1", true},
+}
+
+// v is shorthand for a Kubernetes minor release in the removal table
+func v(major, minor int) version.Semver {
+	return version.Semver{Major: major, Minor: minor}
+}
+
+// LookupRemovedAPI returns the removal entry for an apiVersion and kind, if there is one
+func LookupRemovedAPI(apiVersion, kind string) (RemovedAPI, bool) {
+	for _, api := range removedAPIs {
+		if api.APIVersion == apiVersion && api.Kind == kind {
+			return api, true
+		}
+	}
+	return RemovedAPI{}, false
+}
+
+// RemovedAPIs reports resources using API versions that are no longer served by the target
+// Kubernetes version
+func RemovedAPIs(resources []map[string]any, target version.Semver) []Finding {
+	var findings []Finding
+
+	for i, resource := range resources {
+		apiVersion, _ := resource["apiVersion"].(string)
+		kind, _ := resource["kind"].(string)
+
+		api, ok := LookupRemovedAPI(apiVersion, kind)
+		if !ok || target.Compare(api.RemovedIn) < 0 {
+			continue
+		}
+
+		message := fmt.Sprintf("%s %s was removed in Kubernetes %d.%d", apiVersion, kind, api.RemovedIn.Major, api.RemovedIn.Minor)
+		if api.Replacement != "" {
+			message += fmt.Sprintf(", use %s", api.Replacement)
+		}
+		findings = append(findings, Finding{Resource: describe(i, resource), Index: i, Rule: RuleRemovedAPI, Message: message})
+	}
+
+	return findings
+}
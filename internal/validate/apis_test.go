@@ -0,0 +1,86 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/version"
+)
+
+func TestRemovedAPIs(t *testing.T) {
+	ingress := map[string]any{
+		"apiVersion": "networking.k8s.io/v1beta1",
+		"kind":       "Ingress",
+		"metadata":   map[string]any{"name": "web"},
+	}
+	psp := map[string]any{
+		"apiVersion": "policy/v1beta1",
+		"kind":       "PodSecurityPolicy",
+		"metadata":   map[string]any{"name": "restricted"},
+	}
+	deployment := map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web"},
+	}
+
+	tests := []struct {
+		name         string
+		target       version.Semver
+		resources    []map[string]any
+		wantFindings []string
+	}{
+		{
+			name:      "before removal",
+			target:    version.Semver{Major: 1, Minor: 21},
+			resources: []map[string]any{ingress},
+		},
+		{
+			name:         "removed in target",
+			target:       version.Semver{Major: 1, Minor: 22},
+			resources:    []map[string]any{ingress, deployment},
+			wantFindings: []string{"Ingress/web: networking.k8s.io/v1beta1 Ingress was removed in Kubernetes 1.22, use networking.k8s.io/v1"},
+		},
+		{
+			name:         "removed without replacement",
+			target:       version.Semver{Major: 1, Minor: 31},
+			resources:    []map[string]any{psp},
+			wantFindings: []string{"PodSecurityPolicy/restricted: policy/v1beta1 PodSecurityPolicy was removed in Kubernetes 1.25"},
+		},
+		{
+			name:      "current API",
+			target:    version.Semver{Major: 1, Minor: 31},
+			resources: []map[string]any{deployment},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := RemovedAPIs(tt.resources, tt.target)
+			if len(findings) != len(tt.wantFindings) {
+				t.Fatalf("RemovedAPIs() = %v, want %v", findings, tt.wantFindings)
+			}
+			for i, finding := range findings {
+				if finding.String() != tt.wantFindings[i] {
+					t.Errorf("RemovedAPIs()[%d] = %q, want %q", i, finding.String(), tt.wantFindings[i])
+				}
+				if finding.Rule != RuleRemovedAPI {
+					t.Errorf("RemovedAPIs()[%d].Rule = %q, want %q", i, finding.Rule, RuleRemovedAPI)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupRemovedAPI(t *testing.T) {
+	api, ok := LookupRemovedAPI("batch/v1beta1", "CronJob")
+	if !ok {
+		t.Fatal("LookupRemovedAPI() should find batch/v1beta1 CronJob")
+	}
+	if api.Replacement != "batch/v1" {
+		t.Errorf("Replacement = %q, want %q", api.Replacement, "batch/v1")
+	}
+
+	if _, ok := LookupRemovedAPI("batch/v1", "CronJob"); ok {
+		t.Error("LookupRemovedAPI() should not find batch/v1 CronJob")
+	}
+}
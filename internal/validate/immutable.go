@@ -0,0 +1,101 @@
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// immutableFields are the fields of Kubernetes kinds that cannot be changed once the object
+// exists, keyed by group and kind, as dot-separated paths
+var immutableFields = map[manifest.ID][]string{
+	{Group: "apps", Kind: "Deployment"}:                              {"spec.selector"},
+	{Group: "apps", Kind: "ReplicaSet"}:                              {"spec.selector"},
+	{Group: "apps", Kind: "DaemonSet"}:                               {"spec.selector"},
+	{Group: "apps", Kind: "StatefulSet"}:                             {"spec.selector", "spec.serviceName", "spec.podManagementPolicy", "spec.volumeClaimTemplates"},
+	{Group: "batch", Kind: "Job"}:                                    {"spec.selector", "spec.template"},
+	{Kind: "Service"}:                                                {"spec.clusterIP"},
+	{Kind: "PersistentVolumeClaim"}:                                  {"spec.storageClassName", "spec.accessModes", "spec.volumeMode", "spec.volumeName", "spec.selector"},
+	{Kind: "Secret"}:                                                 {"type"},
+	{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"}:        {"roleRef"},
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}: {"roleRef"},
+}
+
+// ImmutableFields reports the resources of after whose immutable fields differ from those of
+// the resource with the same ID in before, such as the selector of a Deployment or the storage
+// class of a PersistentVolumeClaim. Applying them to installed objects fails, which otherwise
+// only shows at upgrade time. The data of immutable ConfigMaps and Secrets is checked as well.
+func ImmutableFields(before, after []map[string]any) []Finding {
+	originalOf := originals(before)
+	var findings []Finding
+	for i, resource := range after {
+		id := manifest.IDOf(resource)
+		original, ok := originalOf(id)
+		if !ok {
+			continue
+		}
+
+		fields := immutableFields[manifest.ID{Group: id.Group, Kind: id.Kind}]
+		if id.Group == "" && (id.Kind == "ConfigMap" || id.Kind == "Secret") && original["immutable"] == true {
+			fields = append(fields, "data", "binaryData", "stringData", "immutable")
+		}
+		for _, field := range fields {
+			if from, to := fieldValue(original, field), fieldValue(resource, field); !reflect.DeepEqual(from, to) {
+				findings = append(findings, Finding{
+					Resource: describe(i, resource),
+					Index:    i,
+					Rule:     RuleImmutableField,
+					Message:  fmt.Sprintf("%s is immutable, but changed from %s to %s; upgrading an installed release would fail", field, formatValue(from), formatValue(to)),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// originals returns a lookup of the resources of before by ID. Kustomize commonly sets the
+// namespace, so resources are also matched without it.
+func originals(before []map[string]any) func(id manifest.ID) (map[string]any, bool) {
+	beforeByID := make(map[manifest.ID]map[string]any, len(before))
+	beforeByName := make(map[manifest.ID]map[string]any, len(before))
+	for _, resource := range before {
+		id := manifest.IDOf(resource)
+		beforeByID[id] = resource
+		beforeByName[manifest.ID{Group: id.Group, Kind: id.Kind, Name: id.Name}] = resource
+	}
+	return func(id manifest.ID) (map[string]any, bool) {
+		if original, ok := beforeByID[id]; ok {
+			return original, true
+		}
+		original, ok := beforeByName[manifest.ID{Group: id.Group, Kind: id.Kind, Name: id.Name}]
+		return original, ok
+	}
+}
+
+// fieldValue returns the value at a dot-separated path, or nil if it is not set
+func fieldValue(resource map[string]any, path string) any {
+	var value any = resource
+	for key := range strings.SplitSeq(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// formatValue formats a field value for a finding as JSON, or "unset" for nil
+func formatValue(value any) string {
+	if value == nil {
+		return "unset"
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
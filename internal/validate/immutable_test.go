@@ -0,0 +1,99 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImmutableFields(t *testing.T) {
+	deployment := func(app string) map[string]any {
+		return map[string]any{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+			"replicas": 1,
+			"selector": map[string]any{"matchLabels": map[string]any{"app": app}},
+		}}
+	}
+	service := func(clusterIP string) map[string]any {
+		spec := map[string]any{"ports": []any{}}
+		if clusterIP != "" {
+			spec["clusterIP"] = clusterIP
+		}
+		return map[string]any{"apiVersion": "v1", "kind": "Service", "metadata": map[string]any{"name": "web"}, "spec": spec}
+	}
+	pvc := func(storageClass string) map[string]any {
+		return map[string]any{"apiVersion": "v1", "kind": "PersistentVolumeClaim", "metadata": map[string]any{"name": "data"}, "spec": map[string]any{"storageClassName": storageClass}}
+	}
+	configMap := func(immutable bool, value string) map[string]any {
+		return map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "settings"}, "immutable": immutable, "data": map[string]any{"mode": value}}
+	}
+
+	tests := []struct {
+		name   string
+		before map[string]any
+		after  map[string]any
+		want   []Finding
+	}{
+		{
+			name:   "mutable field changed",
+			before: deployment("web"),
+			after:  func() map[string]any { d := deployment("web"); d["spec"].(map[string]any)["replicas"] = 3; return d }(),
+		},
+		{
+			name:   "deployment selector changed",
+			before: deployment("web"),
+			after:  deployment("web-prod"),
+			want: []Finding{{Resource: "Deployment/web", Rule: RuleImmutableField,
+				Message: `spec.selector is immutable, but changed from {"matchLabels":{"app":"web"}} to {"matchLabels":{"app":"web-prod"}}; upgrading an installed release would fail`}},
+		},
+		{
+			name:   "service cluster IP set",
+			before: service(""),
+			after:  service("10.0.0.10"),
+			want: []Finding{{Resource: "Service/web", Rule: RuleImmutableField,
+				Message: `spec.clusterIP is immutable, but changed from unset to "10.0.0.10"; upgrading an installed release would fail`}},
+		},
+		{
+			name:   "storage class changed",
+			before: pvc("standard"),
+			after:  pvc("fast"),
+			want: []Finding{{Resource: "PersistentVolumeClaim/data", Rule: RuleImmutableField,
+				Message: `spec.storageClassName is immutable, but changed from "standard" to "fast"; upgrading an installed release would fail`}},
+		},
+		{
+			name:   "data of immutable configmap changed",
+			before: configMap(true, "dev"),
+			after:  configMap(true, "prod"),
+			want: []Finding{{Resource: "ConfigMap/settings", Rule: RuleImmutableField,
+				Message: `data is immutable, but changed from {"mode":"dev"} to {"mode":"prod"}; upgrading an installed release would fail`}},
+		},
+		{
+			name:   "data of mutable configmap changed",
+			before: configMap(false, "dev"),
+			after:  configMap(false, "prod"),
+		},
+		{
+			name:   "namespace set by the kustomization",
+			before: pvc("standard"),
+			after: func() map[string]any {
+				p := pvc("fast")
+				p["metadata"] = map[string]any{"name": "data", "namespace": "prod"}
+				return p
+			}(),
+			want: []Finding{{Resource: "PersistentVolumeClaim/data", Rule: RuleImmutableField,
+				Message: `spec.storageClassName is immutable, but changed from "standard" to "fast"; upgrading an installed release would fail`}},
+		},
+		{
+			name:   "renamed resource",
+			before: pvc("standard"),
+			after:  func() map[string]any { p := pvc("fast"); p["metadata"] = map[string]any{"name": "prod-data"}; return p }(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ImmutableFields([]map[string]any{tt.before}, []map[string]any{tt.after})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ImmutableFields() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
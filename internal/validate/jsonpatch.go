@@ -0,0 +1,153 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// jsonPatchOps are the operations of RFC 6902
+var jsonPatchOps = []string{"add", "remove", "replace", "move", "copy", "test"}
+
+// JSONPatches checks the inline JSON 6902 patches of a kustomization, the patch strings of its
+// patches and patchesJson6902 entries holding a list of operations, and returns their problems
+// with the line of the kustomization they are on, e.g. `line 12: patches[0].patch[1].op: must be
+// one of add, remove, replace, move, copy, test, got "repalce"`. Kustomize reports them with
+// offsets into a file of its own. Strategic merge patches and patch files are not checked.
+func JSONPatches(kustomization []byte) []string {
+	var root yaml.Node
+	if err := yaml.Unmarshal(kustomization, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	var problems []string
+	for _, field := range []string{"patches", "patchesJson6902"} {
+		entries := mappingNode(root.Content[0], field)
+		if entries == nil || entries.Kind != yaml.SequenceNode {
+			continue
+		}
+		for i, entry := range entries.Content {
+			patch := mappingNode(entry, "patch")
+			if patch == nil || patch.Kind != yaml.ScalarNode {
+				continue
+			}
+			problems = append(problems, checkJSONPatch(patch, fmt.Sprintf("%s[%d].patch", field, i))...)
+		}
+	}
+	return problems
+}
+
+// checkJSONPatch checks the operations of an inline patch, given as the scalar node of its
+// string. Lines of the patch are offset by the line its content starts on, the line after the
+// indicator of block scalars.
+func checkJSONPatch(patch *yaml.Node, path string) []string {
+	start := patch.Line
+	if patch.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		start++
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(patch.Value), &root); err != nil {
+		var parserErr *yaml.ParserError
+		if errors.As(err, &parserErr) && parserErr.Line > 0 {
+			return []string{fmt.Sprintf("line %d: %s: invalid YAML: %s", start+parserErr.Line-1, path, parserErr.Message)}
+		}
+		return []string{fmt.Sprintf("line %d: %s: invalid YAML: %v", start, path, err)}
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.SequenceNode {
+		// Not a list of operations, so a strategic merge patch
+		return nil
+	}
+
+	var problems []string
+	problem := func(node *yaml.Node, path, format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("line %d: %s: %s", start+node.Line-1, path, fmt.Sprintf(format, args...)))
+	}
+	for i, op := range root.Content[0].Content {
+		opPath := fmt.Sprintf("%s[%d]", path, i)
+		if op.Kind != yaml.MappingNode {
+			problem(op, opPath, "must be an operation with op and path, got %s", describeNode(op))
+			continue
+		}
+
+		name := mappingNode(op, "op")
+		switch {
+		case name == nil:
+			problem(op, opPath+".op", "is required")
+			continue
+		case name.Kind != yaml.ScalarNode || !slices.Contains(jsonPatchOps, name.Value):
+			problem(name, opPath+".op", "must be one of %s, got %s", strings.Join(jsonPatchOps, ", "), describeNode(name))
+			continue
+		}
+
+		fields := []string{"path"}
+		switch name.Value {
+		case "move", "copy":
+			fields = append(fields, "from")
+		}
+		for _, field := range fields {
+			pointer := mappingNode(op, field)
+			if pointer == nil {
+				problem(op, opPath+"."+field, "is required for op %s", name.Value)
+			} else if message := checkPointer(pointer); message != "" {
+				problem(pointer, opPath+"."+field, "%s", message)
+			}
+		}
+
+		switch name.Value {
+		case "add", "replace", "test":
+			if mappingNode(op, "value") == nil {
+				problem(op, opPath+".value", "is required for op %s", name.Value)
+			}
+		}
+	}
+	return problems
+}
+
+// checkPointer returns what is wrong with a JSON pointer node, e.g. a path without its leading
+// slash, or an empty string if it is valid
+func checkPointer(node *yaml.Node) string {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		return fmt.Sprintf("must be a JSON pointer, got %s", describeNode(node))
+	}
+	if node.Value != "" && !strings.HasPrefix(node.Value, "/") {
+		return fmt.Sprintf("must be a JSON pointer starting with /, got %q", node.Value)
+	}
+	value := node.Value
+	for i := 0; i < len(value); i++ {
+		if value[i] == '~' && (i+1 == len(value) || (value[i+1] != '0' && value[i+1] != '1')) {
+			return fmt.Sprintf("must escape ~ as ~0 and / as ~1, got %q", value)
+		}
+	}
+	return ""
+}
+
+// describeNode formats a node for a message, e.g. `"repalce"` or "a map"
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a map"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	if node.Tag == "!!null" {
+		return "null"
+	}
+	return fmt.Sprintf("%q", node.Value)
+}
+
+// mappingNode returns the value node of key in a mapping node
+func mappingNode(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
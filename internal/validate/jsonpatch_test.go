@@ -0,0 +1,100 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONPatches(t *testing.T) {
+	tests := []struct {
+		name          string
+		kustomization string
+		want          []string
+	}{
+		{
+			name: "valid",
+			kustomization: `resources:
+- all.yaml
+patches:
+- target:
+    kind: Deployment
+  patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 3
+    - op: move
+      from: /metadata/annotations/old
+      path: /metadata/annotations/new
+    - op: remove
+      path: /metadata/labels/app.kubernetes.io~1version
+- path: web.yaml
+- patch: |-
+    apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: web
+patchesJson6902:
+- target:
+    kind: Service
+  patch: '[{"op": "add", "path": "/spec/type", "value": "NodePort"}]'
+`,
+		},
+		{
+			name: "invalid operations",
+			kustomization: `resources:
+- all.yaml
+patches:
+- target:
+    kind: Deployment
+  patch: |-
+    - op: repalce
+      path: /spec/replicas
+      value: 3
+    - op: add
+      path: spec/replicas
+    - op: copy
+      path: /metadata/labels/a~2b
+    - path: /spec
+    - /spec/replicas
+`,
+			want: []string{
+				`line 7: patches[0].patch[0].op: must be one of add, remove, replace, move, copy, test, got "repalce"`,
+				`line 11: patches[0].patch[1].path: must be a JSON pointer starting with /, got "spec/replicas"`,
+				"line 10: patches[0].patch[1].value: is required for op add",
+				`line 13: patches[0].patch[2].path: must escape ~ as ~0 and / as ~1, got "/metadata/labels/a~2b"`,
+				"line 12: patches[0].patch[2].from: is required for op copy",
+				"line 14: patches[0].patch[3].op: is required",
+				`line 15: patches[0].patch[4]: must be an operation with op and path, got "/spec/replicas"`,
+			},
+		},
+		{
+			name: "flow patch",
+			kustomization: `patchesJson6902:
+- target:
+    kind: Service
+  patch: '[{"op": "add", "path": null, "value": 1}]'
+`,
+			want: []string{"line 4: patchesJson6902[0].patch[0].path: must be a JSON pointer, got null"},
+		},
+		{
+			name: "invalid YAML",
+			kustomization: `patches:
+- target:
+    kind: Deployment
+  patch: |-
+    - op: add
+      path: /spec/replicas
+     value: 3
+`,
+			want: []string{"line 6: patches[0].patch: invalid YAML: did not find expected '-' indicator"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := JSONPatches([]byte(tt.kustomization)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("JSONPatches() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package validate
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed kustomization.schema.json
+var kustomizationSchemaJSON []byte
+
+// kustomizationSchema is the embedded kustomization schema with its references resolved
+var kustomizationSchema = sync.OnceValue(func() map[string]any {
+	var schema map[string]any
+	if err := json.Unmarshal(kustomizationSchemaJSON, &schema); err != nil {
+		panic(fmt.Sprintf("invalid embedded kustomization schema: %v", err))
+	}
+	definitions, _ := schema["definitions"].(map[string]any)
+	return resolveRefs(schema, definitions).(map[string]any)
+})
+
+// Kustomization checks a parsed kustomization.yaml against the schema of the kustomize
+// Kustomization type and returns its problems. Each problem names the offending path and, if it
+// is set, its value, e.g. `images[0].newTag: must be of type string, got number (value: 1.25)`,
+// where kustomize reports a Go unmarshalling error.
+func Kustomization(kustomization map[string]any) []string {
+	problems := checkSchema(kustomization, kustomizationSchema(), "", false)
+	for i, problem := range problems {
+		path, _, _ := strings.Cut(problem, ": ")
+		value, ok := valueAt(kustomization, path)
+		if !ok {
+			continue
+		}
+		formatted, err := json.Marshal(value)
+		if err == nil && !strings.HasSuffix(problem, fmt.Sprintf("got %v", value)) {
+			problems[i] = fmt.Sprintf("%s (value: %s)", problem, formatted)
+		}
+	}
+	return problems
+}
+
+// resolveRefs replaces the "#/definitions/..." references of a schema with the definitions
+func resolveRefs(schema any, definitions map[string]any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			name := strings.TrimPrefix(ref, "#/definitions/")
+			return resolveRefs(definitions[name], definitions)
+		}
+		resolved := make(map[string]any, len(v))
+		for key, value := range v {
+			if key != "definitions" {
+				resolved[key] = resolveRefs(value, definitions)
+			}
+		}
+		return resolved
+	case []any:
+		resolved := make([]any, len(v))
+		for i, value := range v {
+			resolved[i] = resolveRefs(value, definitions)
+		}
+		return resolved
+	}
+	return schema
+}
+
+// valueAt returns the value at a dotted path like images[0].newTag, as produced by checkSchema
+func valueAt(value any, path string) (any, bool) {
+	if path == "" || path == "(root)" {
+		return nil, false
+	}
+	for field := range strings.SplitSeq(path, ".") {
+		name, indexes, _ := strings.Cut(field, "[")
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[name]; !ok {
+			return nil, false
+		}
+		if indexes == "" {
+			continue
+		}
+		for index := range strings.SplitSeq(strings.TrimSuffix(indexes, "]"), "][") {
+			i, err := strconv.Atoi(index)
+			list, ok := value.([]any)
+			if err != nil || !ok || i >= len(list) {
+				return nil, false
+			}
+			value = list[i]
+		}
+	}
+	return value, true
+}
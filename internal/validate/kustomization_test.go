@@ -0,0 +1,99 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+func TestKustomization(t *testing.T) {
+	tests := []struct {
+		name          string
+		kustomization string
+		want          []string
+	}{
+		{
+			name: "valid",
+			kustomization: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- all.yaml
+namePrefix: prod-
+commonLabels:
+  app: web
+images:
+- name: nginx
+  newTag: "1.25"
+replicas:
+- name: web
+  count: 3
+configMapGenerator:
+- name: settings
+  literals:
+  - mode=prod
+  options:
+    disableNameSuffixHash: true
+`,
+		},
+		{
+			name: "wrong types",
+			kustomization: `resources: all.yaml
+images:
+- name: nginx
+  newTag: 1.25
+commonLabels:
+  replicas: 3
+`,
+			want: []string{
+				"commonLabels.replicas: must be of type string, got integer (value: 3)",
+				"images[0].newTag: must be of type string, got number (value: 1.25)",
+				`resources: must be of type array, got string (value: "all.yaml")`,
+			},
+		},
+		{
+			name: "missing required fields",
+			kustomization: `images:
+- newTag: v2
+replicas:
+- name: web
+  count: "3"
+configMapGenerator:
+- literals: [a=b]
+`,
+			want: []string{
+				"configMapGenerator[0].name: is required",
+				"images[0].name: is required",
+				`replicas[0].count: must be of type integer, got string (value: "3")`,
+			},
+		},
+		{
+			name: "unknown field",
+			kustomization: `resources:
+- all.yaml
+patchesJson6902:
+- target:
+    kind: Deployment
+  patchFile: patch.yaml
+`,
+			want: []string{`patchesJson6902[0].patchFile: unknown field (value: "patch.yaml")`},
+		},
+		{
+			name:          "invalid enum",
+			kustomization: "kind: Kustomisation\n",
+			want:          []string{"kind: must be one of [Kustomization, Component], got Kustomisation"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var kustomization map[string]any
+			if err := yaml.Unmarshal([]byte(tt.kustomization), &kustomization); err != nil {
+				t.Fatalf("yaml.Unmarshal() error = %v, want nil", err)
+			}
+			if got := Kustomization(kustomization); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Kustomization() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package validate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Namespaces checks that the resources only target allowed namespaces: their metadata.namespace
+// and, for Namespace objects, their name. Allowed namespaces may be glob patterns, e.g. "team-*".
+// Resources without a namespace are installed in the release namespace and are not checked.
+func Namespaces(resources []map[string]any, allowed []string) []Finding {
+	var findings []Finding
+	for i, resource := range resources {
+		metadata, _ := resource["metadata"].(map[string]any)
+		namespace, _ := metadata["namespace"].(string)
+		if kind, _ := resource["kind"].(string); kind == "Namespace" {
+			namespace, _ = metadata["name"].(string)
+		}
+		if namespace == "" || namespaceAllowed(namespace, allowed) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Resource: describe(i, resource),
+			Index:    i,
+			Rule:     RuleDisallowedNamespace,
+			Message:  fmt.Sprintf("namespace %s is not allowed, allowed namespaces are %s", namespace, strings.Join(allowed, ", ")),
+		})
+	}
+	return findings
+}
+
+// namespaceAllowed reports whether namespace matches any of the allowed names or patterns
+func namespaceAllowed(namespace string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if matched, err := path.Match(pattern, namespace); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	resources := []map[string]any{
+		{"kind": "ConfigMap", "metadata": map[string]any{"name": "a", "namespace": "team-a"}},
+		{"kind": "ConfigMap", "metadata": map[string]any{"name": "b", "namespace": "kube-system"}},
+		{"kind": "ConfigMap", "metadata": map[string]any{"name": "c"}},
+		{"kind": "Namespace", "metadata": map[string]any{"name": "team-b-staging"}},
+		{"kind": "Namespace", "metadata": map[string]any{"name": "default"}},
+		{"kind": "ClusterRole", "metadata": map[string]any{"name": "reader"}},
+	}
+
+	got := Namespaces(resources, []string{"team-a", "team-b-*"})
+	want := []Finding{
+		{Resource: "ConfigMap/b", Index: 1, Rule: RuleDisallowedNamespace, Message: "namespace kube-system is not allowed, allowed namespaces are team-a, team-b-*"},
+		{Resource: "Namespace/default", Index: 4, Rule: RuleDisallowedNamespace, Message: "namespace default is not allowed, allowed namespaces are team-a, team-b-*"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Namespaces() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// KeepPolicyAnnotation is the Helm annotation that keeps a resource when a later release no
+// longer renders it, with the value "keep"
+const KeepPolicyAnnotation = "helm.sh/resource-policy"
+
+// hashSuffix matches the content hash kustomize generators append to the names of ConfigMaps
+// and Secrets
+var hashSuffix = regexp.MustCompile(`-[a-z0-9]{10}$`)
+
+// selectorKinds are the workload kinds whose selector cannot be changed, keyed by group and kind
+var selectorKinds = map[manifest.ID]bool{
+	{Group: "apps", Kind: "Deployment"}:  true,
+	{Group: "apps", Kind: "ReplicaSet"}:  true,
+	{Group: "apps", Kind: "DaemonSet"}:   true,
+	{Group: "apps", Kind: "StatefulSet"}: true,
+	{Group: "batch", Kind: "Job"}:        true,
+}
+
+// RollbackRisks reports changes of the kustomization that make upgrades hard to roll back. A
+// workload selector changed from the one of before cannot be changed back by rolling back to a
+// release rendered without the kustomization. The generated resources of after, given as indexes,
+// that are ConfigMaps or Secrets with a content hash in their name and consumed by a workload are
+// renamed whenever their content changes; Helm deletes the old ones on upgrade, so rolling the
+// workload back to a previous ReplicaSet starts pods referencing a missing object, unless they
+// are annotated with KeepPolicyAnnotation.
+func RollbackRisks(before, after []map[string]any, generated []int) []Finding {
+	originalOf := originals(before)
+	var findings []Finding
+	for i, resource := range after {
+		id := manifest.IDOf(resource)
+		if !selectorKinds[manifest.ID{Group: id.Group, Kind: id.Kind}] {
+			continue
+		}
+		original, ok := originalOf(id)
+		if !ok {
+			continue
+		}
+		if from, to := fieldValue(original, "spec.selector"), fieldValue(resource, "spec.selector"); !reflect.DeepEqual(from, to) {
+			findings = append(findings, Finding{
+				Resource: describe(i, resource),
+				Index:    i,
+				Rule:     RuleRollbackUnsafe,
+				Message:  fmt.Sprintf("spec.selector changed from %s to %s; rolling back to a release rendered without this change fails, as the selector is immutable", formatValue(from), formatValue(to)),
+			})
+		}
+	}
+
+	consumers := consumersOf(after)
+	for _, i := range generated {
+		resource := after[i]
+		id := manifest.IDOf(resource)
+		if id.Group != "" || (id.Kind != "ConfigMap" && id.Kind != "Secret") || !hashSuffix.MatchString(id.Name) {
+			continue
+		}
+		if annotations, _ := fieldValue(resource, "metadata.annotations").(map[string]any); annotations[KeepPolicyAnnotation] == "keep" {
+			continue
+		}
+		users := consumers[manifest.ID{Kind: id.Kind, Namespace: id.Namespace, Name: id.Name}]
+		if len(users) == 0 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Resource: describe(i, resource),
+			Index:    i,
+			Rule:     RuleRollbackUnsafe,
+			Message:  fmt.Sprintf("generated with a content hash in its name and consumed by %s; the next upgrade with other content deletes it, so rolling back those workloads starts pods without it (annotate it with %s: keep to retain it)", joinList(users), KeepPolicyAnnotation),
+		})
+	}
+	return findings
+}
+
+// consumersOf returns the workloads of resources, as "Kind/name", referencing each ConfigMap and
+// Secret from their pod template, keyed by the kind, namespace and name of the referenced object
+func consumersOf(resources []map[string]any) map[manifest.ID][]string {
+	consumers := map[manifest.ID][]string{}
+	for i, resource := range resources {
+		id := manifest.IDOf(resource)
+		podSpec, ok := podSpecOf(resource).(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, ref := range podReferences(podSpec) {
+			ref.Namespace = id.Namespace
+			if workload := describe(i, resource); !slices.Contains(consumers[ref], workload) {
+				consumers[ref] = append(consumers[ref], workload)
+			}
+		}
+	}
+	return consumers
+}
+
+// podSpecOf returns the pod spec of the pod template of a workload, nil for other resources
+func podSpecOf(resource map[string]any) any {
+	if resource["kind"] == "CronJob" {
+		return fieldValue(resource, "spec.jobTemplate.spec.template.spec")
+	}
+	return fieldValue(resource, "spec.template.spec")
+}
+
+// podReferences returns the objects a pod spec references, without namespace: the ConfigMaps and
+// Secrets of its volumes and the environment of its containers, its image pull Secrets, its
+// ServiceAccount and the PersistentVolumeClaims of its volumes
+func podReferences(podSpec map[string]any) []manifest.ID {
+	var refs []manifest.ID
+	add := func(kind string, name any) {
+		if name, ok := name.(string); ok && name != "" {
+			refs = append(refs, manifest.ID{Kind: kind, Name: name})
+		}
+	}
+
+	add("ServiceAccount", podSpec["serviceAccountName"])
+	pullSecrets, _ := podSpec["imagePullSecrets"].([]any)
+	for _, secret := range pullSecrets {
+		secret, _ := secret.(map[string]any)
+		add("Secret", secret["name"])
+	}
+
+	volumes, _ := podSpec["volumes"].([]any)
+	for _, volume := range volumes {
+		volume, _ := volume.(map[string]any)
+		add("ConfigMap", fieldValue(volume, "configMap.name"))
+		add("Secret", fieldValue(volume, "secret.secretName"))
+		add("PersistentVolumeClaim", fieldValue(volume, "persistentVolumeClaim.claimName"))
+		sources, _ := fieldValue(volume, "projected.sources").([]any)
+		for _, source := range sources {
+			source, _ := source.(map[string]any)
+			add("ConfigMap", fieldValue(source, "configMap.name"))
+			add("Secret", fieldValue(source, "secret.name"))
+		}
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := podSpec[field].([]any)
+		for _, container := range containers {
+			container, _ := container.(map[string]any)
+			envFrom, _ := container["envFrom"].([]any)
+			for _, source := range envFrom {
+				source, _ := source.(map[string]any)
+				add("ConfigMap", fieldValue(source, "configMapRef.name"))
+				add("Secret", fieldValue(source, "secretRef.name"))
+			}
+			env, _ := container["env"].([]any)
+			for _, variable := range env {
+				variable, _ := variable.(map[string]any)
+				add("ConfigMap", fieldValue(variable, "valueFrom.configMapKeyRef.name"))
+				add("Secret", fieldValue(variable, "valueFrom.secretKeyRef.name"))
+			}
+		}
+	}
+	return refs
+}
+
+// joinList joins workloads for a message, e.g. "Deployment/web, Job/init and CronJob/report"
+func joinList(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
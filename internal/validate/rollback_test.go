@@ -0,0 +1,88 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRollbackRisks(t *testing.T) {
+	deployment := func(app string, configMap string) map[string]any {
+		return map[string]any{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": map[string]any{"name": "web"}, "spec": map[string]any{
+			"selector": map[string]any{"matchLabels": map[string]any{"app": app}},
+			"template": map[string]any{"spec": map[string]any{
+				"volumes": []any{map[string]any{"name": "config", "configMap": map[string]any{"name": configMap}}},
+			}},
+		}}
+	}
+	cronJob := map[string]any{"apiVersion": "batch/v1", "kind": "CronJob", "metadata": map[string]any{"name": "report"}, "spec": map[string]any{
+		"jobTemplate": map[string]any{"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"containers": []any{map[string]any{"name": "report", "env": []any{map[string]any{"name": "LEVEL", "valueFrom": map[string]any{
+				"configMapKeyRef": map[string]any{"name": "settings-7fk2m9h5bt", "key": "level"},
+			}}}}},
+		}}}},
+	}}
+	configMap := func(name string, annotations map[string]any) map[string]any {
+		metadata := map[string]any{"name": name}
+		if annotations != nil {
+			metadata["annotations"] = annotations
+		}
+		return map[string]any{"apiVersion": "v1", "kind": "ConfigMap", "metadata": metadata}
+	}
+
+	tests := []struct {
+		name   string
+		before []map[string]any
+		after  []map[string]any
+		want   []Finding
+	}{
+		{
+			name:   "unchanged",
+			before: []map[string]any{deployment("web", "settings")},
+			after:  []map[string]any{deployment("web", "settings")},
+		},
+		{
+			name:   "selector changed",
+			before: []map[string]any{deployment("web", "settings")},
+			after:  []map[string]any{deployment("web-prod", "settings")},
+			want: []Finding{{Resource: "Deployment/web", Rule: RuleRollbackUnsafe,
+				Message: `spec.selector changed from {"matchLabels":{"app":"web"}} to {"matchLabels":{"app":"web-prod"}}; rolling back to a release rendered without this change fails, as the selector is immutable`}},
+		},
+		{
+			name:   "generated config map consumed by workloads",
+			before: []map[string]any{deployment("web", "settings")},
+			after:  []map[string]any{deployment("web", "settings-7fk2m9h5bt"), cronJob, configMap("settings-7fk2m9h5bt", nil)},
+			want: []Finding{{Resource: "ConfigMap/settings-7fk2m9h5bt", Index: 2, Rule: RuleRollbackUnsafe,
+				Message: "generated with a content hash in its name and consumed by Deployment/web and CronJob/report; the next upgrade with other content deletes it, so rolling back those workloads starts pods without it (annotate it with helm.sh/resource-policy: keep to retain it)"}},
+		},
+		{
+			name:   "generated config map kept by helm",
+			before: []map[string]any{deployment("web", "settings")},
+			after:  []map[string]any{deployment("web", "settings-7fk2m9h5bt"), configMap("settings-7fk2m9h5bt", map[string]any{KeepPolicyAnnotation: "keep"})},
+		},
+		{
+			name:   "generated config map without hash suffix",
+			before: []map[string]any{deployment("web", "settings")},
+			after:  []map[string]any{deployment("web", "settings"), configMap("settings", nil)},
+		},
+		{
+			name:   "generated config map not consumed",
+			before: []map[string]any{deployment("web", "settings")},
+			after:  []map[string]any{deployment("web", "settings"), configMap("extra-7fk2m9h5bt", nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var generated []int
+			for i, resource := range tt.after {
+				if resource["kind"] == "ConfigMap" {
+					generated = append(generated, i)
+				}
+			}
+			got := RollbackRisks(tt.before, tt.after, generated)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RollbackRisks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
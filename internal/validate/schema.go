@@ -0,0 +1,505 @@
+package validate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// RuleSchema reports custom resources that do not match the OpenAPI schema of their CRD
+const RuleSchema = "schema"
+
+// gvk identifies the schema of a resource. Kind is lowercased, as schema catalogs name their
+// files after the lowercase kind.
+type gvk struct {
+	group   string
+	version string
+	kind    string
+}
+
+// gvkOf returns the schema key of a resource
+func gvkOf(resource map[string]any) gvk {
+	apiVersion, _ := resource["apiVersion"].(string)
+	kind, _ := resource["kind"].(string)
+	group, version, found := strings.Cut(apiVersion, "/")
+	if !found {
+		group, version = "", apiVersion
+	}
+	return gvk{group: group, version: version, kind: strings.ToLower(kind)}
+}
+
+// Schemas are OpenAPI v3 schemas of custom resources, keyed by group, version and kind
+type Schemas struct {
+	schemas map[gvk]map[string]any
+}
+
+// LoadSchemas loads the schemas of the YAML and JSON files in dir and its subdirectories. Files
+// can contain CustomResourceDefinitions, schemas listing the kinds they apply to in
+// x-kubernetes-group-version-kind, or schemas laid out like the CRDs catalog
+// (<group>/<kind>_<version>.json). Other documents are ignored.
+func LoadSchemas(dir string) (*Schemas, error) {
+	s := &Schemas{schemas: make(map[gvk]map[string]any)}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if err := s.loadFile(path); err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.schemas) == 0 {
+		return nil, fmt.Errorf("no CRDs or schemas found in %s", dir)
+	}
+	return s, nil
+}
+
+// loadFile adds the schemas of every document in a file
+func (s *Schemas) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 1; ; i++ {
+		var doc map[string]any
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+		if doc == nil {
+			continue
+		}
+
+		if doc["kind"] == "CustomResourceDefinition" {
+			s.addCRD(doc)
+			continue
+		}
+		if kinds, ok := doc["x-kubernetes-group-version-kind"].([]any); ok {
+			for _, raw := range kinds {
+				entry, _ := raw.(map[string]any)
+				group, _ := entry["group"].(string)
+				version, _ := entry["version"].(string)
+				kind, _ := entry["kind"].(string)
+				if version != "" && kind != "" {
+					s.schemas[gvk{group: group, version: version, kind: strings.ToLower(kind)}] = doc
+				}
+			}
+			continue
+		}
+		if key, ok := catalogKey(path); ok && isSchema(doc) {
+			s.schemas[key] = doc
+		}
+	}
+}
+
+// addCRD adds the schemas of the served versions of a CustomResourceDefinition. The
+// apiextensions.k8s.io/v1beta1 form with a single top-level schema is supported as well.
+func (s *Schemas) addCRD(crd map[string]any) {
+	spec, _ := crd["spec"].(map[string]any)
+	group, _ := spec["group"].(string)
+	names, _ := spec["names"].(map[string]any)
+	kind, _ := names["kind"].(string)
+	if kind == "" {
+		return
+	}
+
+	var shared map[string]any
+	if validation, ok := spec["validation"].(map[string]any); ok {
+		shared, _ = validation["openAPIV3Schema"].(map[string]any)
+	}
+
+	versions, _ := spec["versions"].([]any)
+	if len(versions) == 0 {
+		if version, ok := spec["version"].(string); ok {
+			versions = []any{map[string]any{"name": version}}
+		}
+	}
+
+	for _, raw := range versions {
+		version, _ := raw.(map[string]any)
+		name, _ := version["name"].(string)
+		schema := shared
+		if own, ok := version["schema"].(map[string]any); ok {
+			schema, _ = own["openAPIV3Schema"].(map[string]any)
+		}
+		if name != "" && schema != nil {
+			s.schemas[gvk{group: group, version: name, kind: strings.ToLower(kind)}] = schema
+		}
+	}
+}
+
+// catalogFile matches the <kind>_<version>.json file names of the CRDs catalog
+var catalogFile = regexp.MustCompile(`^([a-z0-9]+)_([a-z0-9]+)\.json$`)
+
+// catalogKey derives the schema key from a CRDs catalog path, <group>/<kind>_<version>.json
+func catalogKey(path string) (gvk, bool) {
+	match := catalogFile.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return gvk{}, false
+	}
+	return gvk{group: filepath.Base(filepath.Dir(path)), version: match[2], kind: match[1]}, true
+}
+
+// isSchema reports whether a document looks like an object schema rather than a resource
+func isSchema(doc map[string]any) bool {
+	_, hasProperties := doc["properties"]
+	return doc["type"] == "object" || hasProperties
+}
+
+// Resources checks the resources that have a schema against it. Resources of other kinds are
+// not checked.
+func (s *Schemas) Resources(resources []map[string]any) []Finding {
+	var findings []Finding
+
+	for i, resource := range resources {
+		schema, ok := s.schemas[gvkOf(resource)]
+		if !ok {
+			continue
+		}
+		for _, message := range checkSchema(resource, schema, "", true) {
+			findings = append(findings, Finding{Resource: describe(i, resource), Index: i, Rule: RuleSchema, Message: message})
+		}
+	}
+
+	return findings
+}
+
+// checkSchema returns the problems of value against an OpenAPI v3 schema. path is the dotted
+// path of value, and root is set for the resource itself, whose apiVersion, kind and metadata
+// are validated by the API server rather than the CRD.
+func checkSchema(value any, schema map[string]any, path string, root bool) []string {
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+	}
+
+	var problems []string
+	problemf := func(format string, args ...any) {
+		problems = append(problems, fieldPath(path)+": "+fmt.Sprintf(format, args...))
+	}
+
+	if intOrString, _ := schema["x-kubernetes-int-or-string"].(bool); intOrString {
+		if !isInteger(value) && !isString(value) {
+			problemf("must be an integer or a string, got %s", typeName(value))
+			return problems
+		}
+	} else if typ, ok := schema["type"].(string); ok && !hasType(value, typ) {
+		problemf("must be of type %s, got %s", typ, typeName(value))
+		return problems
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(allowed any) bool { return equal(allowed, value) }) {
+		problemf("must be one of %s, got %v", formatEnum(enum), value)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		problems = append(problems, checkObject(v, schema, path, root)...)
+	case []any:
+		if limit, ok := number(schema["minItems"]); ok && float64(len(v)) < limit {
+			problemf("must have at least %v items", limit)
+		}
+		if limit, ok := number(schema["maxItems"]); ok && float64(len(v)) > limit {
+			problemf("must have at most %v items", limit)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				problems = append(problems, checkSchema(item, items, fmt.Sprintf("%s[%d]", path, i), false)...)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if limit, ok := number(schema["minLength"]); ok && length < limit {
+			problemf("must be at least %v characters", limit)
+		}
+		if limit, ok := number(schema["maxLength"]); ok && length > limit {
+			problemf("must be at most %v characters", limit)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				problemf("must match %q, got %q", pattern, v)
+			}
+		}
+	}
+
+	if n, ok := number(value); ok {
+		exclusive, _ := schema["exclusiveMinimum"].(bool)
+		if limit, ok := number(schema["minimum"]); ok && (n < limit || exclusive && n == limit) {
+			problemf("must be at least %v, got %v", limit, value)
+		}
+		exclusive, _ = schema["exclusiveMaximum"].(bool)
+		if limit, ok := number(schema["maximum"]); ok && (n > limit || exclusive && n == limit) {
+			problemf("must be at most %v, got %v", limit, value)
+		}
+	}
+
+	problems = append(problems, checkCombinators(value, schema, path, root)...)
+	return problems
+}
+
+// checkObject checks the properties of an object. Fields that are not in the schema are
+// reported unless the schema preserves unknown fields, as the API server rejects them with
+// strict field validation.
+func checkObject(object map[string]any, schema map[string]any, path string, root bool) []string {
+	var problems []string
+
+	required, _ := schema["required"].([]any)
+	for _, raw := range required {
+		name, _ := raw.(string)
+		if _, ok := object[name]; !ok && name != "" {
+			problems = append(problems, fieldPath(join(path, name))+": is required")
+		}
+	}
+
+	if limit, ok := number(schema["minProperties"]); ok && float64(len(object)) < limit {
+		problems = append(problems, fmt.Sprintf("%s: must have at least %v properties", fieldPath(path), limit))
+	}
+	if limit, ok := number(schema["maxProperties"]); ok && float64(len(object)) > limit {
+		problems = append(problems, fmt.Sprintf("%s: must have at most %v properties", fieldPath(path), limit))
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	preserve, _ := schema["x-kubernetes-preserve-unknown-fields"].(bool)
+	embedded, _ := schema["x-kubernetes-embedded-resource"].(bool)
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := object[key]
+		if (root || embedded) && (key == "apiVersion" || key == "kind" || key == "metadata") {
+			if property, ok := properties[key].(map[string]any); ok && key == "metadata" {
+				problems = append(problems, checkSchema(value, property, join(path, key), false)...)
+			}
+			continue
+		}
+
+		if property, ok := properties[key].(map[string]any); ok {
+			problems = append(problems, checkSchema(value, property, join(path, key), false)...)
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case map[string]any:
+			problems = append(problems, checkSchema(value, additional, join(path, key), false)...)
+		case bool:
+			if !additional {
+				problems = append(problems, fieldPath(join(path, key))+": unknown field")
+			}
+		default:
+			// Schemas without properties describe free-form objects
+			if properties != nil && !preserve {
+				problems = append(problems, fieldPath(join(path, key))+": unknown field")
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkCombinators checks the allOf, anyOf, oneOf and not keywords of a schema
+func checkCombinators(value any, schema map[string]any, path string, root bool) []string {
+	var problems []string
+
+	for _, sub := range subschemas(schema["allOf"]) {
+		problems = append(problems, checkSchema(value, sub, path, root)...)
+	}
+
+	if anyOf := subschemas(schema["anyOf"]); len(anyOf) > 0 {
+		if matching(value, anyOf, path, root) == 0 {
+			problems = append(problems, fieldPath(path)+": must match at least one of the anyOf schemas")
+		}
+	}
+
+	if oneOf := subschemas(schema["oneOf"]); len(oneOf) > 0 {
+		if count := matching(value, oneOf, path, root); count != 1 {
+			problems = append(problems, fmt.Sprintf("%s: must match exactly one of the oneOf schemas, matches %d", fieldPath(path), count))
+		}
+	}
+
+	if not, ok := schema["not"].(map[string]any); ok && len(checkSchema(value, not, path, root)) == 0 {
+		problems = append(problems, fieldPath(path)+": must not match the not schema")
+	}
+
+	return problems
+}
+
+// matching returns how many of schemas value matches. Like the API server, only the value
+// constraints of the subschemas count, so fields they don't list are not unknown.
+func matching(value any, schemas []map[string]any, path string, root bool) int {
+	count := 0
+	for _, schema := range schemas {
+		loose := make(map[string]any, len(schema)+1)
+		for key, v := range schema {
+			loose[key] = v
+		}
+		loose["x-kubernetes-preserve-unknown-fields"] = true
+		if len(checkSchema(value, loose, path, root)) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// subschemas returns the schemas of an allOf, anyOf or oneOf list
+func subschemas(raw any) []map[string]any {
+	list, _ := raw.([]any)
+	schemas := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		if schema, ok := item.(map[string]any); ok {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas
+}
+
+// hasType reports whether value is of an OpenAPI type
+func hasType(value any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		return isString(value)
+	case "integer":
+		return isInteger(value)
+	case "number":
+		_, ok := number(value)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	}
+	return true
+}
+
+// isString reports whether value is a string. Unquoted timestamps decode to time.Time but are
+// strings in JSON.
+func isString(value any) bool {
+	switch value.(type) {
+	case string, time.Time:
+		return true
+	}
+	return false
+}
+
+// isInteger reports whether value is an integer, including floats without a fraction, which
+// JSON does not tell apart
+func isInteger(value any) bool {
+	switch v := value.(type) {
+	case int, int64, uint64:
+		return true
+	case float64:
+		return v == math.Trunc(v) && !math.IsInf(v, 0)
+	}
+	return false
+}
+
+// number converts a numeric value to float64
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// equal compares an enum value with a decoded value, treating numbers of different types alike
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+// typeName names the JSON type of a decoded value for messages
+func typeName(value any) string {
+	switch {
+	case value == nil:
+		return "null"
+	case isString(value):
+		return "string"
+	case isInteger(value):
+		return "integer"
+	}
+	switch value.(type) {
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// formatEnum formats the allowed values of an enum
+func formatEnum(enum []any) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = fmt.Sprintf("%v", value)
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
+
+// join appends a field name to a dotted path
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// fieldPath returns path for messages, naming the resource itself "(root)"
+func fieldPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
@@ -0,0 +1,280 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+const certificateCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: certificates.cert-manager.io
+spec:
+  group: cert-manager.io
+  names:
+    kind: Certificate
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [secretName]
+            properties:
+              secretName:
+                type: string
+                minLength: 1
+              duration:
+                type: string
+                pattern: '^[0-9]+h$'
+              dnsNames:
+                type: array
+                maxItems: 2
+                items:
+                  type: string
+              privateKey:
+                type: object
+                properties:
+                  algorithm:
+                    type: string
+                    enum: [RSA, ECDSA]
+                  size:
+                    type: integer
+                    minimum: 256
+              port:
+                x-kubernetes-int-or-string: true
+              extra:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`
+
+func writeSchemas(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create schema directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write schema: %v", err)
+		}
+	}
+	return dir
+}
+
+func decodeResource(t *testing.T, doc string) map[string]any {
+	t.Helper()
+	var resource map[string]any
+	if err := yaml.Unmarshal([]byte(doc), &resource); err != nil {
+		t.Fatalf("Failed to decode resource: %v", err)
+	}
+	return resource
+}
+
+func TestSchemas_Resources(t *testing.T) {
+	schemas, err := LoadSchemas(writeSchemas(t, map[string]string{"crds/certificate.yaml": certificateCRD}))
+	if err != nil {
+		t.Fatalf("LoadSchemas() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		want []string
+	}{
+		{
+			name: "valid",
+			spec: "secretName: tls\nduration: 2160h\ndnsNames: [a.example.com]\nport: https\nextra:\n  anything: true\n",
+		},
+		{
+			name: "missing required field",
+			spec: "duration: 2160h\n",
+			want: []string{"spec.secretName: is required"},
+		},
+		{
+			name: "wrong types",
+			spec: "secretName: tls\ndnsNames: a.example.com\nport: true\n",
+			want: []string{
+				"spec.dnsNames: must be of type array, got string",
+				"spec.port: must be an integer or a string, got boolean",
+			},
+		},
+		{
+			name: "unknown field",
+			spec: "secretName: tls\nsecretname: tls\n",
+			want: []string{"spec.secretname: unknown field"},
+		},
+		{
+			name: "value constraints",
+			spec: "secretName: \"\"\nduration: 90d\ndnsNames: [a, b, c]\nprivateKey:\n  algorithm: DSA\n  size: 128\n",
+			want: []string{
+				"spec.dnsNames: must have at most 2 items",
+				`spec.duration: must match "^[0-9]+h$", got "90d"`,
+				"spec.privateKey.algorithm: must be one of [RSA, ECDSA], got DSA",
+				"spec.privateKey.size: must be at least 256, got 128",
+				"spec.secretName: must be at least 1 characters",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := decodeResource(t, "apiVersion: cert-manager.io/v1\nkind: Certificate\nmetadata:\n  name: web\n")
+			resource["spec"] = decodeResource(t, tt.spec)
+			other := decodeResource(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web\nspec: 3\n")
+
+			var got []string
+			for _, finding := range schemas.Resources([]map[string]any{other, resource}) {
+				if finding.Resource != "Certificate/web" || finding.Index != 1 || finding.Rule != RuleSchema {
+					t.Errorf("Finding = %+v, want schema finding for Certificate/web", finding)
+				}
+				got = append(got, finding.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resources() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSchemas(t *testing.T) {
+	schema := `{"type": "object", "properties": {"spec": {"type": "object", "properties": {"replicas": {"type": "integer"}}}}}`
+	tests := []struct {
+		name       string
+		files      map[string]string
+		apiVersion string
+		kind       string
+	}{
+		{
+			name:       "CRD",
+			files:      map[string]string{"certificate.yaml": "# CRDs\n---\n" + certificateCRD},
+			apiVersion: "cert-manager.io/v1",
+			kind:       "Certificate",
+		},
+		{
+			name: "v1beta1 CRD",
+			files: map[string]string{"widget.yml": `apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+spec:
+  group: example.com
+  version: v1alpha1
+  names:
+    kind: Widget
+  validation:
+    openAPIV3Schema:
+      type: object
+      properties:
+        spec:
+          type: object
+          properties:
+            replicas:
+              type: integer
+`},
+			apiVersion: "example.com/v1alpha1",
+			kind:       "Widget",
+		},
+		{
+			name:       "group version kind extension",
+			files:      map[string]string{"widget.json": `{"x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1", "kind": "Widget"}], "type": "object", "properties": {"spec": {"type": "object", "properties": {"replicas": {"type": "integer"}}}}}`},
+			apiVersion: "example.com/v1",
+			kind:       "Widget",
+		},
+		{
+			name:       "CRDs catalog layout",
+			files:      map[string]string{"example.com/widget_v1beta1.json": schema, "README.md": "not a schema"},
+			apiVersion: "example.com/v1beta1",
+			kind:       "Widget",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemas, err := LoadSchemas(writeSchemas(t, tt.files))
+			if err != nil {
+				t.Fatalf("LoadSchemas() error = %v, want nil", err)
+			}
+			resource := map[string]any{
+				"apiVersion": tt.apiVersion,
+				"kind":       tt.kind,
+				"metadata":   map[string]any{"name": "x"},
+				"spec":       map[string]any{"replicas": "three", "secretName": 1},
+			}
+			if findings := schemas.Resources([]map[string]any{resource}); len(findings) == 0 {
+				t.Errorf("Resources() returned no findings, want the resource checked against its schema")
+			}
+		})
+	}
+}
+
+func TestLoadSchemas_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no schemas",
+			files:         map[string]string{"kustomization.yaml": "resources: []\n"},
+			wantErrSubstr: "no CRDs or schemas found",
+		},
+		{
+			name:          "invalid YAML",
+			files:         map[string]string{"broken.yaml": "a: [\n"},
+			wantErrSubstr: "failed to load",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSchemas(writeSchemas(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("LoadSchemas() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+
+	if _, err := LoadSchemas(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadSchemas() should return error for a missing directory")
+	}
+}
+
+func TestCheckSchema_Combinators(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"a": map[string]any{"type": "string"},
+			"b": map[string]any{"type": "string"},
+		},
+		"oneOf": []any{
+			map[string]any{"required": []any{"a"}},
+			map[string]any{"required": []any{"b"}},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		value map[string]any
+		want  []string
+	}{
+		{name: "one set", value: map[string]any{"a": "x"}},
+		{name: "both set", value: map[string]any{"a": "x", "b": "y"}, want: []string{"spec: must match exactly one of the oneOf schemas, matches 2"}},
+		{name: "none set", value: map[string]any{}, want: []string{"spec: must match exactly one of the oneOf schemas, matches 0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkSchema(tt.value, schema, "spec", false)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkSchema() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// clusterScopedKinds are the cluster-scoped kinds of Kubernetes, keyed by group and kind
+var clusterScopedKinds = map[manifest.ID]bool{
+	{Kind: "Namespace"}:        true,
+	{Kind: "Node"}:             true,
+	{Kind: "PersistentVolume"}: true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:     true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:   true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"}:        true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"}: true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:                 true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                             true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:                 true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                       true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:       true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                                true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                      true,
+	{Group: "policy", Kind: "PodSecurityPolicy"}:                                      true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                         true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                  true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                               true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                      true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                        true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                   true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                               true,
+}
+
+// ClusterScoped reports the resources of cluster-scoped Kubernetes kinds. Cluster-scoped kinds
+// of custom resources are not known and not reported.
+func ClusterScoped(resources []map[string]any) []Finding {
+	var findings []Finding
+	for i, resource := range resources {
+		id := manifest.IDOf(resource)
+		if !clusterScopedKinds[manifest.ID{Group: id.Group, Kind: id.Kind}] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Resource: describe(i, resource),
+			Index:    i,
+			Rule:     RuleClusterScoped,
+			Message:  fmt.Sprintf("%s is a cluster-scoped kind", id.Kind),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,28 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClusterScoped(t *testing.T) {
+	resources := []map[string]any{
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "settings"}},
+		{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole", "metadata": map[string]any{"name": "reader"}},
+		{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "Role", "metadata": map[string]any{"name": "reader"}},
+		{"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition", "metadata": map[string]any{"name": "widgets.example.com"}},
+		{"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]any{"name": "team-a"}},
+		// Custom kinds named like built-in cluster-scoped kinds are not reported
+		{"apiVersion": "example.com/v1", "kind": "ClusterRole", "metadata": map[string]any{"name": "custom"}},
+	}
+
+	got := ClusterScoped(resources)
+	want := []Finding{
+		{Resource: "ClusterRole/reader", Index: 1, Rule: RuleClusterScoped, Message: "ClusterRole is a cluster-scoped kind"},
+		{Resource: "CustomResourceDefinition/widgets.example.com", Index: 3, Rule: RuleClusterScoped, Message: "CustomResourceDefinition is a cluster-scoped kind"},
+		{Resource: "Namespace/team-a", Index: 4, Rule: RuleClusterScoped, Message: "Namespace is a cluster-scoped kind"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ClusterScoped() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+package validate
+
+import (
+	"fmt"
+
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// TenantReferences reports the references of pod templates that kustomize did not rewrite when
+// prefixing the names of resources with prefix: references to a ConfigMap, Secret,
+// ServiceAccount or PersistentVolumeClaim that resources do not hold under that name, but under
+// the prefixed one. References to objects resources do not hold at all are left to the cluster.
+func TenantReferences(resources []map[string]any, prefix string) []Finding {
+	names := make(map[manifest.ID]bool, len(resources))
+	for _, resource := range resources {
+		id := manifest.IDOf(resource)
+		names[manifest.ID{Kind: id.Kind, Name: id.Name}] = true
+	}
+
+	var findings []Finding
+	for i, resource := range resources {
+		podSpec, ok := podSpecOf(resource).(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, ref := range podReferences(podSpec) {
+			prefixed := manifest.ID{Kind: ref.Kind, Name: prefix + ref.Name}
+			if names[ref] || !names[prefixed] {
+				continue
+			}
+			findings = append(findings, Finding{
+				Resource: describe(i, resource),
+				Index:    i,
+				Rule:     RuleTenantReference,
+				Message:  fmt.Sprintf("references %s %q, which the tenant prefix renamed to %q", ref.Kind, ref.Name, prefixed.Name),
+			})
+		}
+	}
+	return findings
+}
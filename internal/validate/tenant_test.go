@@ -0,0 +1,54 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTenantReferences(t *testing.T) {
+	workload := func(kind, configMap string) map[string]any {
+		return map[string]any{"kind": kind, "metadata": map[string]any{"name": "team-a-web"}, "spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"serviceAccountName": "team-a-web",
+			"containers": []any{map[string]any{"name": "web", "envFrom": []any{
+				map[string]any{"configMapRef": map[string]any{"name": configMap}},
+			}}},
+		}}}}
+	}
+	object := func(kind, name string) map[string]any {
+		return map[string]any{"apiVersion": "v1", "kind": kind, "metadata": map[string]any{"name": name}}
+	}
+
+	tests := []struct {
+		name      string
+		resources []map[string]any
+		want      []Finding
+	}{
+		{
+			name:      "rewritten reference",
+			resources: []map[string]any{workload("Deployment", "team-a-settings"), object("ConfigMap", "team-a-settings"), object("ServiceAccount", "team-a-web")},
+		},
+		{
+			name:      "reference to an object outside the chart",
+			resources: []map[string]any{workload("Deployment", "shared-settings"), object("ServiceAccount", "team-a-web")},
+		},
+		{
+			name:      "reference to a passed-through object",
+			resources: []map[string]any{workload("Deployment", "settings"), object("ConfigMap", "settings"), object("ConfigMap", "team-a-settings")},
+		},
+		{
+			name:      "reference left unprefixed",
+			resources: []map[string]any{workload("Rollout", "settings"), object("ConfigMap", "team-a-settings"), object("ServiceAccount", "team-a-web")},
+			want: []Finding{{Resource: "Rollout/team-a-web", Rule: RuleTenantReference,
+				Message: `references ConfigMap "settings", which the tenant prefix renamed to "team-a-settings"`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TenantReferences(tt.resources, "team-a-")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TenantReferences() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
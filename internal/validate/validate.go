@@ -0,0 +1,125 @@
+package validate
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// maxNameLength is the maximum length of a Kubernetes object name (DNS subdomain)
+const maxNameLength = 253
+
+// dnsSubdomain matches lowercase RFC 1123 subdomains as used for most Kubernetes object names
+var dnsSubdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// Rules identify the kind of a finding, e.g. for SARIF reports
+const (
+	// RuleInvalidResource reports resources that are not structurally valid Kubernetes objects
+	RuleInvalidResource = "invalid-resource"
+	// RuleRemovedAPI reports resources using an API version removed in the target Kubernetes version
+	RuleRemovedAPI = "removed-api"
+	// RuleClusterScoped reports cluster-scoped resources added or changed by the kustomization
+	RuleClusterScoped = "cluster-scoped"
+	// RuleImmutableField reports immutable fields changed by the kustomization
+	RuleImmutableField = "immutable-field"
+	// RuleDisallowedNamespace reports resources in a namespace outside the allowed namespaces
+	RuleDisallowedNamespace = "disallowed-namespace"
+	// RuleRollbackUnsafe reports changes of the kustomization that a rollback cannot undo cleanly
+	RuleRollbackUnsafe = "rollback-unsafe"
+	// RuleTenantReference reports references kustomize did not rewrite to the tenant prefix
+	RuleTenantReference = "tenant-reference"
+)
+
+// Finding describes a single validation problem in a rendered resource
+type Finding struct {
+	// Resource identifies the offending resource, e.g. "Deployment/web"
+	Resource string
+	// Index is the position of the offending resource in the checked resources
+	Index int
+	// Rule is the rule the resource violates, one of the Rule constants
+	Rule    string
+	Message string
+}
+
+// String formats the finding for display
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Resource, f.Message)
+}
+
+// Resources checks that rendered resources are structurally valid Kubernetes objects
+func Resources(resources []map[string]any) []Finding {
+	var findings []Finding
+
+	for i, resource := range resources {
+		for _, message := range checkResource(resource) {
+			findings = append(findings, Finding{Resource: describe(i, resource), Index: i, Rule: RuleInvalidResource, Message: message})
+		}
+	}
+
+	return findings
+}
+
+// checkResource returns the structural problems of a single resource
+func checkResource(resource map[string]any) []string {
+	var problems []string
+
+	if apiVersion, _ := resource["apiVersion"].(string); apiVersion == "" {
+		problems = append(problems, "apiVersion must be a non-empty string")
+	}
+	if kind, _ := resource["kind"].(string); kind == "" {
+		problems = append(problems, "kind must be a non-empty string")
+	}
+
+	metadata, ok := resource["metadata"].(map[string]any)
+	if !ok {
+		return append(problems, "metadata must be a map")
+	}
+
+	name, _ := metadata["name"].(string)
+	switch {
+	case name == "":
+		problems = append(problems, "metadata.name must be a non-empty string")
+	case len(name) > maxNameLength:
+		problems = append(problems, fmt.Sprintf("metadata.name must be at most %d characters", maxNameLength))
+	case !dnsSubdomain.MatchString(name):
+		problems = append(problems, fmt.Sprintf("metadata.name %q must be a lowercase RFC 1123 subdomain", name))
+	}
+
+	for _, field := range []string{"labels", "annotations"} {
+		problems = append(problems, checkStringMap(metadata, field)...)
+	}
+
+	return problems
+}
+
+// checkStringMap verifies that metadata[field], if present, maps strings to strings
+func checkStringMap(metadata map[string]any, field string) []string {
+	raw, ok := metadata[field]
+	if !ok || raw == nil {
+		return nil
+	}
+
+	values, ok := raw.(map[string]any)
+	if !ok {
+		return []string{fmt.Sprintf("metadata.%s must be a map", field)}
+	}
+
+	var problems []string
+	for key, value := range values {
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("metadata.%s[%q] must be a string, got %T", field, key, value))
+		}
+	}
+	return problems
+}
+
+// describe returns a human-readable identifier for a resource, falling back to its index
+func describe(index int, resource map[string]any) string {
+	kind, _ := resource["kind"].(string)
+	metadata, _ := resource["metadata"].(map[string]any)
+	name, _ := metadata["name"].(string)
+
+	if kind == "" || name == "" {
+		return fmt.Sprintf("resource[%d]", index)
+	}
+	return fmt.Sprintf("%s/%s", kind, name)
+}
@@ -0,0 +1,124 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResources(t *testing.T) {
+	tests := []struct {
+		name         string
+		resource     map[string]any
+		wantFindings []string
+	}{
+		{
+			name: "valid resource",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]any{
+					"name":   "my-config",
+					"labels": map[string]any{"app": "web"},
+				},
+			},
+			wantFindings: nil,
+		},
+		{
+			name: "missing apiVersion and kind",
+			resource: map[string]any{
+				"metadata": map[string]any{"name": "my-config"},
+			},
+			wantFindings: []string{
+				"resource[0]: apiVersion must be a non-empty string",
+				"resource[0]: kind must be a non-empty string",
+			},
+		},
+		{
+			name: "missing metadata",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+			},
+			wantFindings: []string{"resource[0]: metadata must be a map"},
+		},
+		{
+			name: "missing name",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{},
+			},
+			wantFindings: []string{"resource[0]: metadata.name must be a non-empty string"},
+		},
+		{
+			name: "invalid name",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"name": "My_Config"},
+			},
+			wantFindings: []string{`ConfigMap/My_Config: metadata.name "My_Config" must be a lowercase RFC 1123 subdomain`},
+		},
+		{
+			name: "name too long",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"name": strings.Repeat("a", 254)},
+			},
+			wantFindings: []string{"must be at most 253 characters"},
+		},
+		{
+			name: "non-string label value",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]any{
+					"name":   "my-config",
+					"labels": map[string]any{"replicas": 3},
+				},
+			},
+			wantFindings: []string{`ConfigMap/my-config: metadata.labels["replicas"] must be a string, got int`},
+		},
+		{
+			name: "annotations not a map",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]any{
+					"name":        "my-config",
+					"annotations": "oops",
+				},
+			},
+			wantFindings: []string{"ConfigMap/my-config: metadata.annotations must be a map"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := Resources([]map[string]any{tt.resource})
+			if len(findings) != len(tt.wantFindings) {
+				t.Fatalf("Resources() returned %d findings %v, want %d", len(findings), findings, len(tt.wantFindings))
+			}
+			for i, want := range tt.wantFindings {
+				if !strings.Contains(findings[i].String(), want) {
+					t.Errorf("finding[%d] = %q, want it to contain %q", i, findings[i].String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestResources_IndexAndRule(t *testing.T) {
+	findings := Resources([]map[string]any{
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "valid"}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]any{"name": "Invalid"}},
+	})
+
+	if len(findings) != 1 {
+		t.Fatalf("Resources() = %v, want 1 finding", findings)
+	}
+	if findings[0].Index != 1 || findings[0].Rule != RuleInvalidResource {
+		t.Errorf("Resources() = %+v, want Index 1 and Rule %q", findings[0], RuleInvalidResource)
+	}
+}
@@ -0,0 +1,108 @@
+package version
+
+import (
+	"cmp"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Version is the plugin version. It is kept in sync with plugin.yaml and can be
+// overridden at build time with -ldflags "-X <module>/internal/version.Version=<version>".
+var Version = "0.1.0"
+
+// BuildInfo describes how the running binary was built
+type BuildInfo struct {
+	GoVersion string
+	Revision  string
+	Time      string
+	Modified  bool
+}
+
+// ReadBuildInfo returns the Go toolchain and VCS information embedded in the binary.
+// Fields that are not available (e.g. when built outside a VCS checkout) are left empty.
+func ReadBuildInfo() BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return BuildInfo{}
+	}
+
+	bi := BuildInfo{GoVersion: info.GoVersion}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			bi.Revision = setting.Value
+		case "vcs.time":
+			bi.Time = setting.Value
+		case "vcs.modified":
+			bi.Modified = setting.Value == "true"
+		}
+	}
+
+	return bi
+}
+
+// String formats the build information as a single line
+func (b BuildInfo) String() string {
+	parts := []string{b.GoVersion}
+	if b.Revision != "" {
+		revision := b.Revision
+		if b.Modified {
+			revision += "-dirty"
+		}
+		parts = append(parts, fmt.Sprintf("revision %s", revision))
+	}
+	if b.Time != "" {
+		parts = append(parts, fmt.Sprintf("built %s", b.Time))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Semver is a parsed major.minor.patch version. Pre-release and build metadata are ignored.
+type Semver struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// Parse parses versions like "v3.19.4", "3.10" or "4.0.0-rc.1"
+func Parse(s string) (Semver, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(trimmed, "-+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return Semver{}, fmt.Errorf("invalid version %q", s)
+	}
+
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Semver{}, fmt.Errorf("invalid version %q", s)
+		}
+		nums[i] = n
+	}
+
+	return Semver{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is lower than, equal to or greater than other
+func (v Semver) Compare(other Semver) int {
+	switch {
+	case v.Major != other.Major:
+		return cmp.Compare(v.Major, other.Major)
+	case v.Minor != other.Minor:
+		return cmp.Compare(v.Minor, other.Minor)
+	default:
+		return cmp.Compare(v.Patch, other.Patch)
+	}
+}
+
+// String formats the version as major.minor.patch
+func (v Semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
@@ -0,0 +1,113 @@
+package version
+
+import (
+	"os"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+func TestVersion_MatchesPluginYaml(t *testing.T) {
+	data, err := os.ReadFile("../../plugin.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read plugin.yaml: %v", err)
+	}
+
+	var plugin struct {
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(data, &plugin); err != nil {
+		t.Fatalf("Failed to parse plugin.yaml: %v", err)
+	}
+
+	if Version != plugin.Version {
+		t.Errorf("Version = %q, want %q (from plugin.yaml)", Version, plugin.Version)
+	}
+}
+
+func TestReadBuildInfo(t *testing.T) {
+	bi := ReadBuildInfo()
+	if bi.GoVersion == "" {
+		t.Error("Expected GoVersion to be set")
+	}
+}
+
+func TestBuildInfo_String(t *testing.T) {
+	tests := []struct {
+		name string
+		info BuildInfo
+		want string
+	}{
+		{
+			name: "go version only",
+			info: BuildInfo{GoVersion: "go1.25.5"},
+			want: "go1.25.5",
+		},
+		{
+			name: "with revision",
+			info: BuildInfo{GoVersion: "go1.25.5", Revision: "abc123"},
+			want: "go1.25.5, revision abc123",
+		},
+		{
+			name: "modified with time",
+			info: BuildInfo{GoVersion: "go1.25.5", Revision: "abc123", Modified: true, Time: "2025-01-01T00:00:00Z"},
+			want: "go1.25.5, revision abc123-dirty, built 2025-01-01T00:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Semver
+		wantErr bool
+	}{
+		{input: "v3.19.4", want: Semver{3, 19, 4}},
+		{input: "4.0.0", want: Semver{4, 0, 0}},
+		{input: "3.10", want: Semver{3, 10, 0}},
+		{input: "v4.0.0-rc.1", want: Semver{4, 0, 0}},
+		{input: "v3.2.1+g123abc", want: Semver{3, 2, 1}},
+		{input: "", wantErr: true},
+		{input: "latest", wantErr: true},
+		{input: "1.2.3.4", wantErr: true},
+		{input: "1.-2.3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemver_Compare(t *testing.T) {
+	tests := []struct {
+		a, b Semver
+		want int
+	}{
+		{Semver{1, 0, 0}, Semver{1, 0, 0}, 0},
+		{Semver{1, 0, 0}, Semver{2, 0, 0}, -1},
+		{Semver{1, 2, 0}, Semver{1, 1, 9}, 1},
+		{Semver{1, 1, 1}, Semver{1, 1, 2}, -1},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package warnings
+
+import (
+	"fmt"
+	"io"
+)
+
+// Collector gathers non-fatal findings during a render so they can be reported together
+type Collector struct {
+	messages []string
+}
+
+// Addf records a warning
+func (c *Collector) Addf(format string, args ...any) {
+	c.messages = append(c.messages, fmt.Sprintf(format, args...))
+}
+
+// Messages returns the recorded warnings in the order they were added
+func (c *Collector) Messages() []string {
+	return c.messages
+}
+
+// Len returns the number of recorded warnings
+func (c *Collector) Len() int {
+	return len(c.messages)
+}
+
+// Print writes the recorded warnings to w as a single WARNING block. Nothing is written if
+// there are no warnings.
+func (c *Collector) Print(w io.Writer) {
+	if len(c.messages) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "WARNING: %d warning(s) during render:\n", len(c.messages))
+	for _, message := range c.messages {
+		fmt.Fprintf(w, "  - %s\n", message)
+	}
+}
@@ -0,0 +1,35 @@
+package warnings
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCollector(t *testing.T) {
+	var c Collector
+	c.Addf("first %s", "warning")
+	c.Addf("second")
+
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+
+	var buf bytes.Buffer
+	c.Print(&buf)
+
+	want := "WARNING: 2 warning(s) during render:\n  - first warning\n  - second\n"
+	if buf.String() != want {
+		t.Errorf("Print() output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCollector_Empty(t *testing.T) {
+	var c Collector
+
+	var buf bytes.Buffer
+	c.Print(&buf)
+
+	if buf.Len() != 0 {
+		t.Errorf("Print() should not write anything without warnings, got %q", buf.String())
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/owhelm/helm-kustomize/internal/options"
+)
+
+// applyLimits bounds the CPUs and memory of the render with the MaxProcs and MemoryLimit options,
+// so that a burst of renders, such as Argo CD refreshing many applications at once, cannot
+// exhaust the machine. kubectl is a Go program as well, so the environment passes the limits on
+// to the processes the render starts.
+func applyLimits(opts options.Options) error {
+	if opts.MaxProcs > 0 {
+		runtime.GOMAXPROCS(opts.MaxProcs)
+		if err := os.Setenv("GOMAXPROCS", strconv.Itoa(opts.MaxProcs)); err != nil {
+			return fmt.Errorf("failed to limit the CPUs of kubectl: %w", err)
+		}
+	}
+	if opts.MemoryLimit > 0 {
+		debug.SetMemoryLimit(opts.MemoryLimit)
+		if err := os.Setenv("GOMEMLIMIT", strconv.FormatInt(opts.MemoryLimit, 10)); err != nil {
+			return fmt.Errorf("failed to limit the memory of kubectl: %w", err)
+		}
+	}
+	return nil
+}
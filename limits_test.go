@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/options"
+)
+
+func TestApplyLimits(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(procs)
+		debug.SetMemoryLimit(math.MaxInt64)
+	})
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOMEMLIMIT", "")
+
+	if err := applyLimits(options.Options{MaxProcs: 1, MemoryLimit: 256 << 20}); err != nil {
+		t.Fatalf("applyLimits() error = %v, want nil", err)
+	}
+	if got := runtime.GOMAXPROCS(0); got != 1 {
+		t.Errorf("GOMAXPROCS = %d, want 1", got)
+	}
+	if got := debug.SetMemoryLimit(-1); got != 256<<20 {
+		t.Errorf("memory limit = %d, want %d", got, 256<<20)
+	}
+	// kubectl inherits the limits
+	if got := os.Getenv("GOMAXPROCS"); got != "1" {
+		t.Errorf("GOMAXPROCS env = %q, want %q", got, "1")
+	}
+	if got := os.Getenv("GOMEMLIMIT"); got != "268435456" {
+		t.Errorf("GOMEMLIMIT env = %q, want %q", got, "268435456")
+	}
+}
+
+func TestApplyLimits_Unset(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	limit := debug.SetMemoryLimit(-1)
+	if err := applyLimits(options.Options{}); err != nil {
+		t.Fatalf("applyLimits() error = %v, want nil", err)
+	}
+	if got := runtime.GOMAXPROCS(0); got != procs {
+		t.Errorf("GOMAXPROCS = %d, want %d unchanged", got, procs)
+	}
+	if got := debug.SetMemoryLimit(-1); got != limit {
+		t.Errorf("memory limit = %d, want %d unchanged", got, limit)
+	}
+}
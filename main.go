@@ -2,56 +2,595 @@ package main
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
+	"maps"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/owhelm/helm-kustomize/internal/attest"
+	"github.com/owhelm/helm-kustomize/internal/cache"
+	"github.com/owhelm/helm-kustomize/internal/cluster"
+	"github.com/owhelm/helm-kustomize/internal/diff"
+	"github.com/owhelm/helm-kustomize/internal/digest"
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
 	"github.com/owhelm/helm-kustomize/internal/extractor"
+	"github.com/owhelm/helm-kustomize/internal/helm"
+	"github.com/owhelm/helm-kustomize/internal/hooks"
 	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/options"
 	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/internal/policy"
+	"github.com/owhelm/helm-kustomize/internal/sign"
+	"github.com/owhelm/helm-kustomize/internal/tracing"
+	"github.com/owhelm/helm-kustomize/internal/transform"
+	"github.com/owhelm/helm-kustomize/internal/validate"
+	"github.com/owhelm/helm-kustomize/internal/version"
+	"github.com/owhelm/helm-kustomize/internal/warnings"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
 )
 
 // KustomizePostRenderer processes Helm manifests through kustomize transformations.
 // It implements Helm's post-renderer protocol by reading from stdin and writing to stdout.
-type KustomizePostRenderer struct{}
+type KustomizePostRenderer struct {
+	// Options configures the render; the zero value renders the root kustomization without validation
+	Options options.Options
+	// Stderr receives diagnostics; defaults to os.Stderr
+	Stderr io.Writer
+	// Tracer records the parse, extract, build and emit spans of renders; nil disables tracing
+	Tracer *tracing.Tracer
+
+	// warnings collects the non-fatal findings of the current render
+	warnings *warnings.Collector
+	// inputs records the inputs of the builds of the current render for Options.Attestation
+	inputs *attest.Manifest
+}
 
 func main() {
-	// Create the post-renderer
-	renderer := &KustomizePostRenderer{}
+	// Stop on SIGINT/SIGTERM by cancelling the context, so that running commands are killed and
+	// temporary directories are still removed. A second signal terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// Dispatch to a subcommand if one was requested
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(ctx, os.Args[2:], os.Stdin, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(errdefs.ExitCode(err))
+			}
+			return
+		}
+	}
+
+	// Load options from config files, environment and post-renderer arguments (--post-renderer-args)
+	opts, err := options.Load(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			options.PrintUsage(os.Stderr)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Error: failed to load options: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := applyLimits(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	// Read input from stdin into a buffer
-	input := &bytes.Buffer{}
-	if _, err := io.Copy(input, os.Stdin); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to read input: %v\n", err)
+	// Warn about known-incompatible Helm versions; failing to detect the version is not fatal.
+	// The Terraform helm provider embeds Helm, so a helm binary on PATH says nothing about it.
+	// The version is cached, so the probe only runs again once Helm is upgraded.
+	if !opts.Terraform {
+		if helmVersion, err := helm.CachedVersion(); err == nil {
+			for _, warning := range helm.CompatibilityWarnings(helmVersion) {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+			}
+		}
+	}
+
+	// Remove temporary directories left behind by killed runs; this is best-effort
+	if opts.StaleTempMaxAge > 0 {
+		extractor.RemoveStale(opts.StaleTempMaxAge)
+	}
+
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Process manifests using the PostRenderer interface
-	output, err := renderer.Run(input)
+	// Trace renders when an OTLP endpoint is configured; a bad configuration only disables tracing
+	tracer, err := tracing.FromEnv(version.Version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: tracing disabled: %v\n", err)
+	}
+
+	// Create the post-renderer
+	renderer := &KustomizePostRenderer{Options: opts, Tracer: tracer}
+
+	// Read input from stdin, or from the files of --input-dir
+	source := newManifestSource(opts, os.Stdin, os.Stdout)
+	input, err := source.Read()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Write output to stdout
-	if _, err := io.Copy(os.Stdout, output); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to write output: %v\n", err)
+	// Process manifests using the PostRenderer interface.
+	// The exit code tells wrapper scripts which stage failed.
+	output, err := renderer.RunContext(ctx, input)
+	exportTraces(tracer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(errdefs.ExitCode(err))
+	}
+
+	// Write output to stdout, or back to the files of --input-dir
+	if err := source.Write(output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	if err := stopProfiling(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// traceExportTimeout bounds the export of the spans of a render, so that an unreachable collector
+// does not hold up Helm
+const traceExportTimeout = 5 * time.Second
+
+// exportTraces sends the spans of the render to the OTLP collector; failing to is not fatal
+func exportTraces(tracer *tracing.Tracer) {
+	// The render context may be cancelled already, and the spans of an interrupted render matter most
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	if err := tracer.Export(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
 }
 
 // Run implements the Helm PostRenderer interface.
 // It processes rendered manifests through kustomize transformations.
 func (k *KustomizePostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	return k.RunContext(context.Background(), renderedManifests)
+}
+
+// RunContext is like Run, but stops the kustomize build when ctx is cancelled. The temporary
+// directory is removed before it returns in that case too.
+func (k *KustomizePostRenderer) RunContext(ctx context.Context, renderedManifests *bytes.Buffer) (output *bytes.Buffer, err error) {
+	ctx, span := k.Tracer.Start(ctx, "render")
+	defer func() {
+		if output != nil {
+			span.SetAttribute("output.bytes", output.Len())
+		}
+		span.End(err)
+	}()
+	if k.Tracer != nil {
+		k.debugf("tracing render in trace %s", k.Tracer.TraceID())
+	}
+
+	k.warnings = &warnings.Collector{}
+	k.inputs = nil
+	output, err = k.safeRender(ctx, renderedManifests)
+
+	// Warnings are reported even if the render failed, as they may explain the failure
+	k.warnings.Print(k.stderr())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errdefs.Wrap(errdefs.ErrInterrupted, err)
+		}
+		return nil, err
+	}
+
+	if k.Options.Strict && k.warnings.Len() > 0 {
+		return nil, errdefs.Wrap(errdefs.ErrValidation, fmt.Errorf("%d warning(s) reported in strict mode", k.warnings.Len()))
+	}
+
+	// Only the output that is returned gets signed, byte for byte as it is written
+	if k.Options.Signature != "" {
+		if err := sign.Blob(ctx, output.Bytes(), k.Options.SignKey, k.Options.Signature); err != nil {
+			return nil, err
+		}
+		k.debugf("wrote output signature to %s", k.Options.Signature)
+	}
+	return output, nil
+}
+
+// safeRender calls render, turning a panic into an error. Deferred cleanups, including the
+// removal of the temporary directory, run while the panic unwinds.
+func (k *KustomizePostRenderer) safeRender(ctx context.Context, renderedManifests *bytes.Buffer) (output *bytes.Buffer, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			k.debugf("panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("internal error: %v", r)
+		}
+	}()
+	return k.render(ctx, renderedManifests)
+}
+
+// render renders the manifests and encodes the output in the requested format
+func (k *KustomizePostRenderer) render(ctx context.Context, renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	output, err := k.renderYAML(ctx, renderedManifests)
+	if err != nil {
+		return nil, err
+	}
+	if k.Options.Check {
+		return output, nil
+	}
+
+	switch k.Options.Output {
+	case options.OutputJSON, options.OutputNDJSON:
+		return k.encodeJSON(output.Bytes())
+	}
+	return output, nil
+}
+
+// encodeJSON converts the rendered YAML to a JSON array of resources, or to one resource per
+// line for NDJSON. Documents that are not resources have no JSON form and are dropped.
+func (k *KustomizePostRenderer) encodeJSON(output []byte) (*bytes.Buffer, error) {
+	resources, err := manifest.ToJSON(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert output to JSON: %w", err)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	if k.Options.Output == options.OutputNDJSON {
+		for _, resource := range resources {
+			if err := encoder.Encode(resource); err != nil {
+				return nil, fmt.Errorf("failed to encode output: %w", err)
+			}
+		}
+		return &buf, nil
+	}
+
+	// An empty output is an empty array rather than null
+	if resources == nil {
+		resources = []map[string]any{}
+	}
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(resources); err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	return &buf, nil
+}
+
+// renderYAML parses the manifests, runs the kustomize build and applies the output options
+func (k *KustomizePostRenderer) renderYAML(ctx context.Context, renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
 	// Parse input manifests
-	result, err := parser.ParseManifests(renderedManifests.Bytes())
+	_, span := k.Tracer.Start(ctx, "parse")
+	span.SetAttribute("input.bytes", renderedManifests.Len())
+	result, err := parser.ParseManifestsWith(renderedManifests.Bytes(), parser.ParseOptions{
+		FileConflicts: parser.ConflictPolicy(k.Options.FileConflicts),
+	})
+	if err == nil {
+		span.SetAttribute("resources", len(result.OtherResources))
+		span.SetAttribute("pipelines", len(result.Pipelines))
+	}
+	span.End(err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse input: %w", err)
 	}
 
-	// If no KustomizePluginData resource found, pass through the input unchanged
+	// If no KustomizePluginData resource found, pass through the input unchanged.
+	// Nothing changes in that case, so the diff, changed-only and check modes produce no output.
 	if result.KustomizePluginData == nil {
-		return renderedManifests, nil
+		if k.Options.Diff || k.Options.ChangedOnly || k.Options.Check {
+			return &bytes.Buffer{}, nil
+		}
+		if err := k.checkNamespaces(result.OtherResources); err != nil {
+			return nil, err
+		}
+		// Registry mirrors and digests apply to every chart, as the cluster pulls all images
+		output, err := k.rewriteImages(ctx, renderedManifests.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if err := k.dryRun(ctx, output); err != nil {
+			return nil, err
+		}
+		return bytes.NewBuffer(output), nil
+	}
+
+	output, err := k.buildPipelines(ctx, result)
+	if err != nil {
+		return nil, err
+	}
+	if k.Options.Check {
+		return &bytes.Buffer{}, nil
+	}
+
+	// The rendered resources only need to be parsed for checks, API migration and diffing
+	if !k.inspectsOutput() {
+		return k.finish(ctx, renderedManifests.Bytes(), output, result)
+	}
+
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+
+	if k.Options.FailOnNoop {
+		if err := checkChanged(result.OtherResources, rendered.OtherResources); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.Options.MigrateAPIs {
+		if output, err = k.migrateAPIs(rendered.OtherResources, output); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := k.checkNamespaces(rendered.OtherResources); err != nil {
+		return nil, err
+	}
+
+	if err := k.checkTenantReferences(rendered.OtherResources); err != nil {
+		return nil, err
+	}
+
+	if err := k.checkClusterScoped(result.OtherResources, rendered.OtherResources); err != nil {
+		return nil, err
+	}
+
+	if err := k.checkImmutable(result.OtherResources, rendered.OtherResources); err != nil {
+		return nil, err
+	}
+
+	k.checkRollback(result.OtherResources, rendered.OtherResources)
+
+	if err := k.validateOutput(result, rendered.OtherResources); err != nil {
+		return nil, err
+	}
+
+	if err := k.dryRun(ctx, output); err != nil {
+		return nil, err
+	}
+
+	if k.Options.Summary {
+		k.printSummary(result.OtherResources, rendered.OtherResources)
+	}
+
+	// In diff mode, the diff between the input and the rendered resources replaces the output
+	if k.Options.Diff {
+		text, err := diff.Resources(result.OtherResources, rendered.OtherResources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff output: %w", err)
+		}
+		return bytes.NewBufferString(text), nil
+	}
+
+	if k.Options.ChangedOnly {
+		return k.changedOnly(result.OtherResources, rendered.OtherResources)
+	}
+
+	return k.finish(ctx, renderedManifests.Bytes(), output, result)
+}
+
+// finish applies the output style to the rendered resources and appends the documents of the
+// input that are not resources
+func (k *KustomizePostRenderer) finish(ctx context.Context, input, output []byte, result *parser.ParseResult) (final *bytes.Buffer, err error) {
+	_, span := k.Tracer.Start(ctx, "emit")
+	defer func() { span.End(err) }()
+
+	if k.inputs != nil {
+		if output, err = k.attest(output); err != nil {
+			return nil, err
+		}
+	}
+	output, err = k.reformat(output)
+	if err != nil {
+		return nil, err
+	}
+	if k.Options.PreserveUntouched {
+		if output, err = k.preserveUntouched(output, result); err != nil {
+			return nil, err
+		}
+	}
+	final = k.withNonResources(output, result)
+	span.SetAttribute("output.bytes", final.Len())
+	if err := k.checkReleaseSize(input, final.Bytes(), result); err != nil {
+		return nil, err
+	}
+	return final, nil
+}
+
+// checkReleaseSize warns if the plugin data makes the Helm release too large for the Secret or
+// ConfigMap Helm stores it in, which would otherwise only show when helm install fails
+func (k *KustomizePostRenderer) checkReleaseSize(input, output []byte, result *parser.ParseResult) error {
+	if !helm.StoresReleasesInObjects() {
+		return nil
+	}
+	size, err := helm.EstimateReleaseSize(input, output)
+	if err != nil {
+		return err
+	}
+	k.debugf("estimated Helm release size: %d bytes", size)
+	if size <= helm.ReleaseSizeLimit {
+		return nil
+	}
+
+	pluginData := len(input) - parser.DocumentsSize(result.OtherDocuments) - parser.DocumentsSize(result.NonResourceDocuments)
+	k.warnf("the Helm release is estimated at %dKiB, over the %dKiB a Kubernetes Secret can hold, so helm install will fail; KustomizePluginData takes %dKiB of the chart uncompressed. Move large files out of the plugin data or set %s=sql",
+		size>>10, helm.ReleaseSizeLimit>>10, pluginData>>10, helm.DriverEnvVar)
+	return nil
+}
+
+// preserveUntouched replaces the rendered documents of resources the build did not change with
+// their input documents, so that their comments and formatting survive and the render leaves
+// them alone in diffs. Resources are matched by ID and compared by content.
+func (k *KustomizePostRenderer) preserveUntouched(output []byte, result *parser.ParseResult) ([]byte, error) {
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+	// Documents that are not resources could not be put back in place, e.g. those of hooks
+	if len(rendered.NonResourceDocuments) > 0 {
+		return output, nil
+	}
+
+	changed, err := manifest.ChangedSet(result.OtherResources, rendered.OtherResources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare kustomize output: %w", err)
+	}
+	originals := make(map[manifest.ID]int, len(result.OtherResources))
+	for i, resource := range result.OtherResources {
+		originals[manifest.IDOf(resource)] = i
+	}
+
+	docs := slices.Clone(rendered.OtherDocuments)
+	preserved := 0
+	for i, resource := range rendered.OtherResources {
+		id := manifest.IDOf(resource)
+		if !changed[id] {
+			docs[i] = result.OtherDocuments[originals[id]]
+			preserved++
+		}
+	}
+	k.debugf("preserved the input documents of %d untouched resources", preserved)
+	if preserved == 0 {
+		return output, nil
+	}
+	return parser.JoinDocuments(docs), nil
+}
+
+// reformat re-encodes the rendered resources in the configured output style, if any
+func (k *KustomizePostRenderer) reformat(output []byte) ([]byte, error) {
+	if k.Options.Indent == 0 && !k.Options.IndentSequences {
+		return output, nil
+	}
+
+	style := manifest.Style{Indent: k.Options.Indent, IndentSequences: k.Options.IndentSequences}
+	if style.Indent == 0 {
+		style.Indent = manifest.DefaultStyle.Indent
+	}
+
+	reformatted, err := manifest.Reformat(output, style)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reformat output: %w", err)
+	}
+	return reformatted, nil
+}
+
+// withNonResources appends the documents of the input that are not resources, such as
+// comment-only documents or NOTES-like text, to the rendered output. kustomize cannot process
+// them, so they are kept out of the build and re-emitted in input order.
+func (k *KustomizePostRenderer) withNonResources(output []byte, result *parser.ParseResult) *bytes.Buffer {
+	buf := bytes.NewBuffer(output)
+	if len(result.NonResourceDocuments) == 0 {
+		return buf
+	}
+
+	k.debugf("re-emitting %d non-resource documents", len(result.NonResourceDocuments))
+	if buf.Len() > 0 {
+		buf.WriteString("---\n")
+	}
+	buf.Write(parser.JoinDocuments(result.NonResourceDocuments))
+	return buf
+}
+
+// changedOnly returns the rendered resources that differ from the input or were generated, and
+// lists the skipped resources on stderr
+func (k *KustomizePostRenderer) changedOnly(before, after []map[string]any) (*bytes.Buffer, error) {
+	changed, unchanged, err := diff.Changed(before, after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare output: %w", err)
+	}
+
+	if len(unchanged) > 0 {
+		fmt.Fprintf(k.stderr(), "Skipped %d unchanged resources:\n", len(unchanged))
+		for _, id := range unchanged {
+			fmt.Fprintf(k.stderr(), "  %s\n", id)
+		}
+	}
+
+	output, err := manifest.EncodeAll(changed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode changed resources: %w", err)
+	}
+	if output, err = k.reformat(output); err != nil {
+		return nil, err
+	}
+	return bytes.NewBuffer(output), nil
+}
+
+// buildPipelines runs the kustomize build of each pipeline of the plugin data in turn, over the
+// resources of the chart as the previous pipelines left them. The pipelines after a failed one still
+// run, over the resources as the last successful one left them, and the error lists every failure.
+func (k *KustomizePostRenderer) buildPipelines(ctx context.Context, result *parser.ParseResult) ([]byte, error) {
+	if len(result.Pipelines) <= 1 {
+		return k.build(ctx, result)
+	}
+
+	input := *result
+	var output []byte
+	var built bool
+	var failed []error
+	for _, data := range result.Pipelines {
+		// Check mode builds nothing, so every pipeline is checked against the chart resources
+		if built && !k.Options.Check {
+			rendered, err := parser.ParseManifests(output)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+			}
+			input.OtherResources, input.OtherDocuments = rendered.OtherResources, rendered.OtherDocuments
+		}
+		input.KustomizePluginData = data
+		k.debugf("building pipeline %q", data.Name)
+
+		// A failed pipeline is skipped, so that the next ones still report their own errors
+		pipelineOutput, err := k.build(ctx, &input)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("pipeline %q: %w", data.Name, err)
+			}
+			k.debugf("pipeline %q failed, building the next ones without it", data.Name)
+			failed = append(failed, fmt.Errorf("pipeline %q: %w", data.Name, err))
+			continue
+		}
+		output, built = pipelineOutput, true
+	}
+
+	switch len(failed) {
+	case 0:
+		return output, nil
+	case 1:
+		return nil, failed[0]
+	}
+	return nil, fmt.Errorf("%d of %d pipelines failed:\n%w", len(failed), len(result.Pipelines), errors.Join(failed...))
+}
+
+// build extracts the plugin files, composes the kustomization and runs kustomize on it
+func (k *KustomizePostRenderer) build(ctx context.Context, result *parser.ParseResult) ([]byte, error) {
+	// Neither charts nor config files can run commands the user did not allow
+	for _, hook := range slices.Concat(result.KustomizePluginData.Hooks, k.Options.Hooks) {
+		if !hook.Allowed(k.Options.AllowedHooks) {
+			return nil, errdefs.Wrap(errdefs.ErrPolicy, fmt.Errorf("hook %q is not allowed, add it to allowedHooks to run it", hook.Command))
+		}
 	}
 
 	// Create temporary directory for kustomize files
@@ -60,51 +599,1263 @@ func (k *KustomizePostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buf
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer tempDir.Cleanup()
+	files := result.KustomizePluginData.Files
+	k.debugf("extracting %d files to %s", len(files), tempDir.Path)
 
-	// Check if files contain all.yaml - we need to reserve this name
-	if _, exists := result.KustomizePluginData.Files["all.yaml"]; exists {
-		return nil, fmt.Errorf("KustomizePluginData.files cannot contain 'all.yaml' - this file is reserved for Helm manifests")
+	// The build root is the root of the files map, or the requested overlay directory.
+	// Helm manifests are written to all.yaml inside the build root.
+	buildRoot := "."
+	if k.Options.Overlay != "" {
+		buildRoot = result.KustomizePluginData.OverlayDir(k.Options.Overlay)
 	}
 
-	// Extract files from KustomizePluginData resource
-	if err := tempDir.ExtractFiles(result.KustomizePluginData.Files); err != nil {
-		return nil, fmt.Errorf("failed to extract files: %w", err)
+	// In helmfile mode, the release fills in placeholders and the environment selects the overlay
+	if k.Options.Helmfile {
+		release := helmfileReleaseFromEnv()
+		k.debugf("helmfile release %q in namespace %q, environment %q", release.Name, release.Namespace, release.Environment)
+		if overlay := release.overlay(files, result.KustomizePluginData.Overlays); k.Options.Overlay == "" && overlay != "" {
+			buildRoot = overlay
+		}
+		files = release.substitute(files, result.KustomizePluginData.Entries)
+	}
+	allYamlPath := filepath.Join(buildRoot, kustomize.AllYaml)
+
+	// all.yaml is reserved for the Helm manifests
+	if err := kustomize.CheckReservedFiles(files, filepath.ToSlash(buildRoot), k.Options.ReservedFilenames); err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+	}
+
+	// release-info.yaml is reserved for the release info of the plugin data
+	if result.KustomizePluginData.Release != nil {
+		if err := kustomize.CheckReleaseInfo(files, filepath.ToSlash(buildRoot)); err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+		}
+	}
+
+	// The local charts of helmCharts are vendored in the files; without --enable-helm, the build
+	// fails before inflating them anyway
+	if k.Options.EnableHelm {
+		if files, err = kustomize.LocalCharts(files, kustomize.HelmCharts(files)); err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+		}
 	}
 
-	// Write other resources to all.yaml
-	allYamlContent, err := parser.MarshalResources(result.OtherResources)
+	// Extract files from KustomizePluginData resource
+	_, span := k.Tracer.Start(ctx, "extract")
+	span.SetAttribute("pipeline", result.KustomizePluginData.Name)
+	span.SetAttribute("files", len(files))
+	err = k.extractFiles(tempDir, files)
+	if err == nil {
+		err = applyFileModes(tempDir, result.KustomizePluginData.Entries)
+	}
+	span.End(err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal resources for all.yaml: %w", err)
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("failed to extract files: %w", err))
 	}
 
-	if err := tempDir.WriteFile("all.yaml", allYamlContent); err != nil {
+	// Write other resources to all.yaml, except for those the plugin data passes through.
+	// The original documents are used as-is, which avoids re-serializing every resource and
+	// keeps untouched resources formatted as Helm rendered them.
+	docs, passthrough := splitPassthrough(result)
+	if len(passthrough) > 0 {
+		k.debugf("passing %d resources through untouched", len(passthrough))
+	}
+	if err := k.writeAllYaml(tempDir, allYamlPath, docs); err != nil {
 		return nil, fmt.Errorf("failed to write all.yaml: %w", err)
 	}
 
-	// Check if kustomization.yaml exists and update it if needed
-	kustomizationPath := "kustomization.yaml"
-	kustomizationContent, err := tempDir.ReadFile(kustomizationPath)
-	if err == nil {
-		// kustomization.yaml exists, ensure all.yaml is in resources
-		updated, changed, err := kustomize.EnsureAllYamlInKustomization(kustomizationContent)
+	// The release info is a resource the replacements of the kustomization can read, which
+	// kustomize drops from the output as local configuration
+	if release := result.KustomizePluginData.Release; release != nil {
+		content, err := kustomize.ReleaseInfo(release.Data())
 		if err != nil {
-			return nil, fmt.Errorf("failed to update kustomization.yaml: %w", err)
+			return nil, err
+		}
+		if err := tempDir.WriteFile(filepath.Join(buildRoot, kustomize.ReleaseInfoYaml), content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", kustomize.ReleaseInfoYaml, err)
 		}
+	}
 
-		if changed {
-			// Write updated kustomization.yaml back
-			if err := tempDir.WriteFile(kustomizationPath, updated); err != nil {
-				return nil, fmt.Errorf("failed to write updated kustomization.yaml: %w", err)
-			}
+	// Find the kustomization file of the build root, whichever name it has, and update it if needed
+	kustomizationFile, err := kustomize.FindKustomization(files, filepath.ToSlash(buildRoot))
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+	}
+	var kustomizationContent []byte
+	if kustomizationFile == "" {
+		// Plugin data with only patches gets a kustomization applying them to all.yaml
+		kustomizationFile = filepath.Join(buildRoot, "kustomization.yaml")
+		kustomizationContent, err = kustomize.GenerateKustomization(files, filepath.ToSlash(buildRoot))
+		if err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("failed to generate kustomization.yaml: %w", err))
+		}
+		k.debugf("generated %s:\n%s", kustomizationFile, kustomizationContent)
+		if err := tempDir.WriteFile(kustomizationFile, kustomizationContent); err != nil {
+			return nil, fmt.Errorf("failed to write generated kustomization.yaml: %w", err)
+		}
+	} else {
+		kustomizationFile = filepath.FromSlash(kustomizationFile)
+		if kustomizationContent, err = tempDir.ReadFile(kustomizationFile); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", kustomizationFile, err)
 		}
 	}
-	// If kustomization.yaml doesn't exist, that's fine - kustomize will handle it
 
-	// Run kubectl kustomize
-	output, err := kustomize.Build(tempDir.Path)
+	// Ensure all.yaml is in resources and apply overrides
+	kust, err := kustomize.ParseKustomization(kustomizationContent)
 	if err != nil {
-		return nil, fmt.Errorf("failed to run kustomize: %w", err)
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("failed to update kustomization.yaml: %w", err))
 	}
+	k.checkPatchTargets(kust, result, files, filepath.ToSlash(buildRoot))
 
-	return bytes.NewBuffer(output), nil
+	// Check inline JSON 6902 patches while the lines still are those of the plugin data, as
+	// kustomize reports their errors with offsets into the file it writes them to
+	if problems := validate.JSONPatches(kustomizationContent); len(problems) > 0 {
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("invalid JSON 6902 patches in %s:\n  %s", kustomizationFile, strings.Join(problems, "\n  ")))
+	}
+	updated, changed, err := k.composeKustomization(kust, kustomizationContent, result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update kustomization.yaml: %w", err)
+	}
+	namespace := kust.Namespace()
+
+	if changed {
+		k.debugf("updated %s:\n%s", kustomizationFile, updated)
+
+		// Write the updated kustomization back under its own name
+		if err := tempDir.WriteFile(kustomizationFile, updated); err != nil {
+			return nil, fmt.Errorf("failed to write updated kustomization.yaml: %w", err)
+		}
+		kustomizationContent = updated
+	}
+
+	// Validate the final kustomization, as kustomize reports invalid fields with Go
+	// unmarshalling errors that don't name the offending field
+	final, err := kustomize.ParseKustomization(kustomizationContent)
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("failed to parse updated kustomization.yaml: %w", err))
+	}
+	if problems := validate.Kustomization(final.RawContent); len(problems) > 0 {
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("invalid %s:\n  %s", kustomizationFile, strings.Join(problems, "\n  ")))
+	}
+	if k.Options.Trace {
+		k.printTrace(final, result, files, filepath.ToSlash(buildRoot))
+	}
+	flags, err := k.buildFlags(files, result.KustomizePluginData, tempDir.Path, buildRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check mode stops short of the build once every reference of the kustomization resolves
+	if k.Options.Check {
+		missing, err := kustomize.MissingReferences(os.DirFS(tempDir.Path), filepath.ToSlash(buildRoot))
+		if err != nil {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+		}
+		if len(missing) > 0 {
+			return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("unresolved references in the kustomization:\n  %s", strings.Join(missing, "\n  ")))
+		}
+		k.debugf("check passed, skipping the build")
+		return nil, nil
+	}
+
+	if k.Options.Attestation != "" {
+		if err := k.recordInputs(ctx, tempDir.Path, buildRoot, result.KustomizePluginData, flags); err != nil {
+			return nil, err
+		}
+	}
+
+	// Run kubectl kustomize on the build root
+	buildDir := filepath.Join(tempDir.Path, buildRoot)
+	k.debugf("building %s", buildDir)
+
+	buildCtx, span := k.Tracer.Start(ctx, "build")
+	span.SetAttribute("pipeline", result.KustomizePluginData.Name)
+	output, buildWarnings, cached, err := k.cachedBuild(buildCtx, tempDir.Path, buildRoot, flags, kustomize.HelmCharts(files))
+	span.SetAttribute("cached", cached)
+	span.End(err)
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrBuild, fmt.Errorf("failed to run kustomize: %w", err))
+	}
+	for _, warning := range buildWarnings {
+		k.warnf("kustomize: %s", warning)
+	}
+
+	if k.Options.CheckCount {
+		if err := k.checkCount(final, result, output, files, filepath.ToSlash(buildRoot)); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.Options.CreateNamespace && namespace != "" {
+		if output, err = k.addNamespace(output, namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	if output, err = k.transformPods(output, result.KustomizePluginData); err != nil {
+		return nil, err
+	}
+
+	if output, err = k.applyKyverno(ctx, tempDir, output, result.KustomizePluginData); err != nil {
+		return nil, err
+	}
+
+	if generated := result.KustomizePluginData.Generated; generated != nil {
+		if output, err = k.placeGenerated(output, result, generated); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(passthrough) > 0 {
+		if output, err = mergePassthrough(output, result, passthrough); err != nil {
+			return nil, err
+		}
+	}
+
+	if output, err = k.rewriteImages(ctx, output); err != nil {
+		return nil, err
+	}
+
+	if output, err = k.runHooks(ctx, output, result.KustomizePluginData); err != nil {
+		return nil, err
+	}
+
+	if output, err = k.deduplicate(output, result); err != nil {
+		return nil, err
+	}
+
+	// Helm would deploy an empty stream as a release without resources, uninstalling everything
+	if len(result.OtherResources) > 0 && !hasResources(output) && !k.Options.AllowEmptyOutput {
+		return nil, k.emptyOutputError(final, result, files, filepath.ToSlash(buildRoot))
+	}
+	return output, nil
+}
+
+// buildFlags returns the kubectl kustomize flags of the build of buildRoot in dir, extracted from
+// the files of data. Inflating the helmCharts of the kustomizations runs helm and pulls charts
+// over the network, so it requires the EnableHelm option, whatever the plugin data says, and
+// charts from repositories the options allow; helm is the binary Helm runs the plugin with.
+// Remote bases could declare helmCharts of their own, which cannot be checked, so they cannot be
+// built with helm.
+func (k *KustomizePostRenderer) buildFlags(files map[string]string, data *parser.KustomizePluginData, dir, buildRoot string) ([]string, error) {
+	flags := data.BuildOptions.Flags()
+	charts := kustomize.HelmCharts(files)
+	if len(charts) == 0 && (data.BuildOptions == nil || !data.BuildOptions.EnableHelm) {
+		return flags, nil
+	}
+	if !k.Options.EnableHelm {
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, fmt.Errorf("the kustomization inflates Helm charts with helmCharts, which requires --enable-helm"))
+	}
+	if err := kustomize.CheckHelmCharts(charts, k.Options.AllowedChartRepos); err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrPolicy, err)
+	}
+	remotes, err := kustomize.RemoteReferences(os.DirFS(dir), filepath.ToSlash(buildRoot))
+	if err != nil {
+		return nil, errdefs.Wrap(errdefs.ErrPluginData, err)
+	}
+	if len(remotes) > 0 {
+		return nil, errdefs.Wrap(errdefs.ErrPolicy, fmt.Errorf("the kustomization inflates Helm charts and has remote bases, whose helmCharts cannot be checked against allowedChartRepos:\n  %s", strings.Join(remotes, "\n  ")))
+	}
+	for _, chart := range charts {
+		k.debugf("inflating %s", chart)
+	}
+	if !slices.Contains(flags, "--enable-helm") {
+		flags = append(flags, "--enable-helm")
+	}
+	return append(flags, "--helm-command", helm.Binary()), nil
+}
+
+// deduplicate drops the resources the output holds more than once with the same content, as
+// passed-through resources, hooks or merged overlays may emit them again. Resources emitted more
+// than once with different content fail the build with the diffs of both versions against the
+// input resource; buildPipelines names the pipeline that diverged.
+func (k *KustomizePostRenderer) deduplicate(output []byte, result *parser.ParseResult) ([]byte, error) {
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+
+	seen := make(map[manifest.ID]int, len(rendered.OtherResources))
+	hashes := make([]string, len(rendered.OtherResources))
+	var duplicates []int
+	for i, resource := range rendered.OtherResources {
+		id := manifest.IDOf(resource)
+		if hashes[i], err = manifest.HashOf(resource); err != nil {
+			return nil, err
+		}
+		first, ok := seen[id]
+		if !ok {
+			seen[id] = i
+			continue
+		}
+		if hashes[first] != hashes[i] {
+			return nil, k.duplicateError(id, rendered.OtherResources[first], resource, result)
+		}
+		k.debugf("dropping duplicate %s", id)
+		duplicates = append(duplicates, i)
+	}
+	if len(duplicates) == 0 {
+		return output, nil
+	}
+
+	docs := make([][]byte, 0, len(rendered.OtherDocuments)-len(duplicates))
+	for i, doc := range rendered.OtherDocuments {
+		if !slices.Contains(duplicates, i) {
+			docs = append(docs, doc)
+		}
+	}
+	return parser.JoinDocuments(docs), nil
+}
+
+// duplicateError reports a resource the output holds twice with different content, with the
+// diffs of both versions against the input resource of the same ID, if any
+func (k *KustomizePostRenderer) duplicateError(id manifest.ID, first, second map[string]any, result *parser.ParseResult) error {
+	var base []byte
+	for _, resource := range result.OtherResources {
+		if manifest.IDOf(resource) == id {
+			var err error
+			if base, err = manifest.Encode(resource); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	firstText, err := manifest.Encode(first)
+	if err != nil {
+		return err
+	}
+	secondText, err := manifest.Encode(second)
+	if err != nil {
+		return err
+	}
+	text, err := diff.ThreeWay(id.String(), string(base), string(firstText), string(secondText))
+	if err != nil {
+		return err
+	}
+	return errdefs.Wrap(errdefs.ErrBuild, fmt.Errorf("the build outputs %s twice with different content:\n%s", id, text))
+}
+
+// checkCount fails the render if kustomize did not output the resources it was given plus those
+// the kustomization generates, minus those it deletes, listing the resources that were dropped
+// or added. Kustomize drops resources silently, e.g. when a patch renames one onto the ID of another.
+func (k *KustomizePostRenderer) checkCount(final *kustomize.Kustomization, result *parser.ParseResult, output []byte, files map[string]string, dir string) error {
+	var input []map[string]any
+	for _, resource := range result.OtherResources {
+		if result.KustomizePluginData.Transforms(resource) {
+			input = append(input, resource)
+		}
+	}
+	change := final.CountChange(input, files, dir)
+	if len(change.Unknown) > 0 {
+		k.warnf("resource count not checked, the kustomization adds or removes resources through %s", strings.Join(change.Unknown, ", "))
+		return nil
+	}
+
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+	want := len(input) + change.Generated - len(change.Deleted)
+	if len(rendered.OtherResources) == want {
+		return nil
+	}
+
+	var lines []string
+	for _, id := range diff.Removed(input, rendered.OtherResources) {
+		if !slices.Contains(change.Deleted, id) {
+			lines = append(lines, "- "+id.String())
+		}
+	}
+	for _, i := range diff.Generated(input, rendered.OtherResources) {
+		lines = append(lines, "+ "+manifest.IDOf(rendered.OtherResources[i]).String())
+	}
+	return errdefs.Wrap(errdefs.ErrValidation, fmt.Errorf("kustomize built %d resources, want %d (%d input + %d generated - %d deleted):\n  %s",
+		len(rendered.OtherResources), want, len(input), change.Generated, len(change.Deleted), strings.Join(lines, "\n  ")))
+}
+
+// hasResources reports whether a manifest stream has a document with content other than comments
+func hasResources(output []byte) bool {
+	for _, doc := range parser.SplitDocuments(output) {
+		for line := range strings.Lines(string(doc)) {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emptyOutputError explains a build that removed every input resource with the transformers of
+// the kustomization and the hooks that may have removed them
+func (k *KustomizePostRenderer) emptyOutputError(final *kustomize.Kustomization, result *parser.ParseResult, files map[string]string, dir string) error {
+	causes := final.Removals(result.OtherResources, files, dir)
+	for _, hook := range slices.Concat(result.KustomizePluginData.Hooks, k.Options.Hooks) {
+		causes = append(causes, fmt.Sprintf("hook %s: may remove resources from the output", hook))
+	}
+	if len(causes) == 0 {
+		causes = []string{"no patch or hook removes resources, check the resources and bases of the kustomization"}
+	}
+	return errdefs.Wrap(errdefs.ErrValidation, fmt.Errorf("kustomize build produced no resources from %d input resources, use --allow-empty-output to accept it:\n  %s",
+		len(result.OtherResources), strings.Join(causes, "\n  ")))
+}
+
+// rewriteImages rewrites the container images of the output to pull from the registry mirrors
+// of the options and then pins them to their digests if enabled. Pinning after mirroring
+// resolves the digests in the registry the cluster pulls from. Documents that are not resources
+// are kept after the rewritten ones, as withNonResources does. It returns output itself when no
+// image was rewritten.
+func (k *KustomizePostRenderer) rewriteImages(ctx context.Context, output []byte) ([]byte, error) {
+	if len(k.Options.RegistryMirrors) == 0 && !k.Options.PinDigests {
+		return output, nil
+	}
+
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+	rewrites := transform.MirrorRegistries(rendered.OtherResources, k.Options.RegistryMirrors)
+	if k.Options.PinDigests {
+		pinned, err := k.pinDigests(ctx, rendered.OtherResources)
+		if err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, pinned...)
+	}
+	if len(rewrites) == 0 {
+		return output, nil
+	}
+	for _, rewrite := range rewrites {
+		k.debugf("rewrote image %s", rewrite)
+	}
+
+	rewritten, err := manifest.EncodeAll(rendered.OtherResources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode rewritten images: %w", err)
+	}
+	if len(rendered.NonResourceDocuments) > 0 {
+		rewritten = append(rewritten, "---\n"...)
+		rewritten = append(rewritten, parser.JoinDocuments(rendered.NonResourceDocuments)...)
+	}
+	return rewritten, nil
+}
+
+// pinDigests pins the container images of the resources to their digests, resolved through the
+// digest cache
+func (k *KustomizePostRenderer) pinDigests(ctx context.Context, resources []map[string]any) ([]transform.ImageRewrite, error) {
+	path := k.Options.DigestCache
+	if path == "" {
+		path = digest.DefaultCachePath()
+	}
+	resolver, err := digest.NewResolver(path, k.Options.Offline)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned, err := transform.PinDigests(resources, func(image string) (string, error) {
+		return resolver.Digest(ctx, image)
+	})
+	// Keep the digests resolved before a failure, so that a retry doesn't look them up again
+	if saveErr := resolver.Save(); saveErr != nil {
+		k.warnf("%v", saveErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// runHooks pipes the output through the hooks of the plugin data and then those of the options,
+// which get the last word. build has checked that every hook is allowed.
+func (k *KustomizePostRenderer) runHooks(ctx context.Context, output []byte, data *parser.KustomizePluginData) ([]byte, error) {
+	for _, hook := range slices.Concat(data.Hooks, k.Options.Hooks) {
+		k.debugf("running hook %s", hook)
+		modified, err := hooks.Run(ctx, hook, output)
+		if err != nil {
+			return nil, err
+		}
+		// Later steps parse the output, so report a broken hook here rather than as a parse error
+		if _, err := parser.ParseManifests(modified); err != nil {
+			return nil, fmt.Errorf("hook %s returned invalid manifests: %w", hook, err)
+		}
+		output = modified
+	}
+	return output, nil
+}
+
+// placeGenerated moves and annotates the resources kustomize generators added to the transformed
+// Helm resources, as configured in the plugin data
+func (k *KustomizePostRenderer) placeGenerated(output []byte, input *parser.ParseResult, generated *parser.Generated) ([]byte, error) {
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+
+	var before []map[string]any
+	for _, resource := range input.OtherResources {
+		if input.KustomizePluginData.Transforms(resource) {
+			before = append(before, resource)
+		}
+	}
+	indexes := diff.Generated(before, rendered.OtherResources)
+	if len(indexes) == 0 {
+		return output, nil
+	}
+	k.debugf("placing %d generated resources (placement %q)", len(indexes), generated.Placement)
+
+	placed := transform.PlaceGenerated(rendered.OtherResources, indexes, generated.Placement, generated.Annotate)
+	encoded, err := manifest.EncodeAll(placed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode generated resources: %w", err)
+	}
+	return encoded, nil
+}
+
+// transformPods applies the inject, resourceDefaults, scheduling and hardening fields of the
+// plugin data to the pod templates of the built resources they target, in this order, so that
+// injected containers get default resources and are hardened. Hardening changes are reported on
+// stderr.
+func (k *KustomizePostRenderer) transformPods(output []byte, data *parser.KustomizePluginData) ([]byte, error) {
+	if data.Inject == nil && data.ResourceDefaults == nil && data.Scheduling == nil && data.Hardening == nil {
+		return output, nil
+	}
+
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+	resources := rendered.OtherResources
+
+	changed := false
+	if inject := data.Inject; inject != nil {
+		injected := transform.InjectContainers(resources, inject.Target.Matches, inject.Containers, inject.InitContainers)
+		if len(injected) == 0 {
+			k.warnf("inject: added no containers, the target (%s) selects no pod template without them", inject.Target)
+		}
+		k.debugf("injected containers into %v", injected)
+		changed = changed || len(injected) > 0
+	}
+	if defaults := data.ResourceDefaults; defaults != nil {
+		defaulted := transform.DefaultResources(resources, defaults.Target.Matches, defaults.Requests, defaults.Limits)
+		k.debugf("set default resources on %v", defaulted)
+		changed = changed || len(defaulted) > 0
+	}
+	if scheduling := data.Scheduling; scheduling != nil {
+		scheduled := transform.ApplyScheduling(resources, scheduling.Target.Matches, scheduling.Scheduling)
+		if len(scheduled) == 0 {
+			k.warnf("scheduling: changed no pod template, the target (%s) selects none without the constraints", scheduling.Target)
+		}
+		k.debugf("set scheduling constraints on %v", scheduled)
+		changed = changed || len(scheduled) > 0
+	}
+	if hardening := data.Hardening; hardening != nil {
+		hardened := transform.Harden(resources, hardening.Target.Matches, hardening.ReadOnlyRootFilesystem)
+		for _, change := range hardened {
+			fmt.Fprintf(k.stderr(), "Hardened %s\n", change)
+		}
+		changed = changed || len(hardened) > 0
+	}
+	if !changed {
+		return output, nil
+	}
+
+	encoded, err := manifest.EncodeAll(resources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transformed pod templates: %w", err)
+	}
+	return encoded, nil
+}
+
+// splitPassthrough separates the documents to transform from the documents the includeKinds,
+// excludeKinds and exclude fields of the plugin data pass through, which are keyed by their
+// position in the input
+func splitPassthrough(result *parser.ParseResult) (transform [][]byte, passthrough map[int][]byte) {
+	for i, resource := range result.OtherResources {
+		if result.KustomizePluginData.Transforms(resource) {
+			transform = append(transform, result.OtherDocuments[i])
+			continue
+		}
+		if passthrough == nil {
+			passthrough = map[int][]byte{}
+		}
+		passthrough[i] = result.OtherDocuments[i]
+	}
+	return transform, passthrough
+}
+
+// mergePassthrough puts the passed-through documents of input back between the built documents,
+// in the order of the input. kustomize sorts the resources it builds by kind, so the built
+// resources are matched with the input resources they were rendered from like in the summary;
+// generated resources go with the built resource after them, or last.
+func mergePassthrough(output []byte, input *parser.ParseResult, passthrough map[int][]byte) ([]byte, error) {
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+
+	var before []map[string]any
+	positions := map[manifest.ID]int{}
+	for i, resource := range input.OtherResources {
+		if _, ok := passthrough[i]; !ok {
+			before = append(before, resource)
+			positions[manifest.IDOf(resource)] = i
+		}
+	}
+
+	// placed is a document of the output and the input position it goes to
+	type placed struct {
+		position int
+		doc      []byte
+	}
+	docs := make([]placed, len(rendered.OtherDocuments), len(rendered.OtherDocuments)+len(passthrough))
+	originals := diff.Originals(before, rendered.OtherResources)
+	position := math.MaxInt
+	for i := len(originals) - 1; i >= 0; i-- {
+		if originals[i] != nil {
+			position = positions[manifest.IDOf(originals[i])]
+		}
+		docs[i] = placed{position: position, doc: rendered.OtherDocuments[i]}
+	}
+	for i, doc := range passthrough {
+		docs = append(docs, placed{position: i, doc: doc})
+	}
+	slices.SortStableFunc(docs, func(a, b placed) int { return cmp.Compare(a.position, b.position) })
+
+	merged := make([][]byte, len(docs))
+	for i, d := range docs {
+		merged[i] = d.doc
+	}
+	return parser.JoinDocuments(merged), nil
+}
+
+// applyKyverno applies the Kyverno policies of the options and the plugin data to the built
+// resources, returning the mutated output
+func (k *KustomizePostRenderer) applyKyverno(ctx context.Context, tempDir *extractor.TempDir, output []byte, data *parser.KustomizePluginData) ([]byte, error) {
+	var paths []string
+	if k.Options.KyvernoPolicies != "" {
+		paths = append(paths, k.Options.KyvernoPolicies)
+	}
+	for _, path := range data.KyvernoPolicies {
+		paths = append(paths, filepath.Join(tempDir.Path, path))
+	}
+	if len(paths) == 0 {
+		return output, nil
+	}
+
+	k.debugf("applying Kyverno policies %v", paths)
+	mutated, err := policy.Kyverno(ctx, output, paths)
+	var violation *policy.ViolationError
+	if errors.As(err, &violation) {
+		return nil, errdefs.Wrap(errdefs.ErrPolicy, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply Kyverno policies: %w", err)
+	}
+	return mutated, nil
+}
+
+// extractFiles extracts the files map to the temporary directory. With a workspace cache, the files
+// are restored from the snapshot of an earlier render of the same files, such as the helm diff run
+// before an upgrade, and saved for the next one otherwise. Cache failures only cost the reuse.
+func (k *KustomizePostRenderer) extractFiles(tempDir *extractor.TempDir, files map[string]string) error {
+	if k.Options.WorkspaceCache == "" {
+		return tempDir.ExtractFiles(files)
+	}
+
+	snapshot := filepath.Join(k.Options.WorkspaceCache, extractor.SnapshotKey(files))
+	err := tempDir.RestoreFrom(snapshot)
+	if err == nil {
+		k.debugf("restored %d files from %s", len(files), snapshot)
+		return nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		k.warnf("%v", err)
+	}
+
+	if err := tempDir.ExtractFiles(files); err != nil {
+		return err
+	}
+	if err := tempDir.Snapshot(snapshot); err != nil {
+		k.warnf("%v", err)
+	} else {
+		k.debugf("saved %d files to %s", len(files), snapshot)
+	}
+	return nil
+}
+
+// applyFileModes sets the permission bits of the extracted files whose entry has a mode, such as
+// exec plugins or scripts run by generators
+func applyFileModes(tempDir *extractor.TempDir, entries map[string]parser.File) error {
+	for _, path := range slices.Sorted(maps.Keys(entries)) {
+		if mode := entries[path].Mode; mode != 0 {
+			if err := tempDir.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cachedBuild runs kubectl kustomize with flags on the build root of dir. With a build cache, the
+// output and warnings of an earlier build of the same files with the same kustomize version and
+// flags are returned instead, and the build is stored for the next renders otherwise. Cache
+// failures only cost the reuse. charts are the helmCharts the build inflates.
+func (k *KustomizePostRenderer) cachedBuild(ctx context.Context, dir, buildRoot string, flags []string, charts []kustomize.HelmChart) (output []byte, warnings []string, cached bool, err error) {
+	buildDir := filepath.Join(dir, buildRoot)
+	if k.Options.BuildCache == "" {
+		output, warnings, err = k.runKustomize(ctx, buildDir, flags)
+		return output, warnings, false, err
+	}
+
+	backend, key, err := k.buildCacheKey(ctx, dir, buildRoot, flags, charts)
+	if err != nil {
+		k.warnf("build cache disabled: %v", err)
+		output, warnings, err = k.runKustomize(ctx, buildDir, flags)
+		return output, warnings, false, err
+	}
+
+	entry, err := cache.Load(ctx, backend, key, k.Options.BuildCacheTTL)
+	if err != nil {
+		k.warnf("%v", err)
+	}
+	if entry != nil {
+		k.debugf("reused the build %s from %s", key, k.Options.BuildCache)
+		return entry.Output, entry.Warnings, true, nil
+	}
+
+	output, warnings, err = k.runKustomize(ctx, buildDir, flags)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	entry = &cache.Entry{Created: time.Now().UTC(), Output: output, Warnings: warnings}
+	if err := cache.Store(ctx, backend, key, entry); err != nil {
+		k.warnf("%v", err)
+	} else {
+		k.debugf("saved the build %s to %s", key, k.Options.BuildCache)
+	}
+	return output, warnings, false, nil
+}
+
+// runKustomize runs kubectl kustomize on buildDir with flags and returns the output and the
+// warnings of kustomize. The other lines kubectl printed on stderr only go to the debug output.
+func (k *KustomizePostRenderer) runKustomize(ctx context.Context, buildDir string, flags []string) ([]byte, []string, error) {
+	output, warnings, other, err := kustomize.BuildWithWarnings(ctx, buildDir, flags...)
+	for _, line := range other {
+		k.debugf("kubectl: %s", line)
+	}
+	return output, warnings, err
+}
+
+// buildCacheKey opens the build cache and returns the key of the build of buildRoot in dir with
+// flags. The key covers the commits the remote bases of the kustomization resolve to, as a branch
+// or tag may move; builds with remote bases that cannot be resolved are not cached. Neither are
+// builds inflating charts pulled from a repository, which may serve another chart for the same
+// version, or pick another version of a range.
+func (k *KustomizePostRenderer) buildCacheKey(ctx context.Context, dir, buildRoot string, flags []string, charts []kustomize.HelmChart) (cache.Backend, string, error) {
+	for _, chart := range charts {
+		if chart.Repo != "" {
+			return nil, "", fmt.Errorf("cannot pin %s of %s", chart, chart.File)
+		}
+	}
+	backend, err := cache.Open(k.Options.BuildCache, k.Options.BuildCacheTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	// Builds of another kustomize version may differ
+	info, err := kustomize.Version()
+	if err != nil {
+		return nil, "", err
+	}
+	inputs := append([]string{info.Kubectl + "/" + info.Kustomize}, flags...)
+
+	remotes, err := kustomize.RemoteReferences(os.DirFS(dir), filepath.ToSlash(buildRoot))
+	if err != nil {
+		return nil, "", err
+	}
+	for _, remote := range remotes {
+		commit, err := attest.ResolveRemote(ctx, remote)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot pin remote base: %w", err)
+		}
+		inputs = append(inputs, remote+"@"+commit)
+	}
+
+	key, err := cache.Key(dir, buildRoot, strings.Join(inputs, " "))
+	if err != nil {
+		return nil, "", err
+	}
+	return backend, key, nil
+}
+
+// recordInputs adds the files and flags of the build of buildRoot in dir for the pipeline of data
+// and the commits of the remote bases of its kustomization to the inputs of the render. Remote
+// bases that cannot be resolved, such as plain HTTP resources, are recorded without a commit and
+// reported.
+func (k *KustomizePostRenderer) recordInputs(ctx context.Context, dir, buildRoot string, data *parser.KustomizePluginData, flags []string) error {
+	if k.inputs == nil {
+		info, err := kustomize.Version()
+		if err != nil {
+			return err
+		}
+		k.inputs = &attest.Manifest{PluginVersion: version.Version, Kubectl: info.Kubectl, Kustomize: info.Kustomize}
+	}
+
+	files, err := attest.HashFiles(dir)
+	if err != nil {
+		return err
+	}
+	pipeline := attest.Pipeline{Name: data.Name, BuildRoot: filepath.ToSlash(buildRoot), BuildFlags: flags, Files: files}
+
+	remotes, err := kustomize.RemoteReferences(os.DirFS(dir), filepath.ToSlash(buildRoot))
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrPluginData, err)
+	}
+	for _, remote := range remotes {
+		commit, err := attest.ResolveRemote(ctx, remote)
+		if err != nil {
+			k.warnf("attestation: %v", err)
+		}
+		pipeline.RemoteBases = append(pipeline.RemoteBases, attest.RemoteBase{URL: remote, Commit: commit})
+	}
+
+	k.inputs.Pipelines = append(k.inputs.Pipelines, pipeline)
+	return nil
+}
+
+// attest writes the manifest of the inputs of the render and annotates the rendered resources
+// with its digest
+func (k *KustomizePostRenderer) attest(output []byte) ([]byte, error) {
+	digest, err := k.inputs.Digest()
+	if err != nil {
+		return nil, err
+	}
+	if err := k.inputs.Write(k.Options.Attestation); err != nil {
+		return nil, err
+	}
+	k.debugf("wrote inputs manifest %s to %s", digest, k.Options.Attestation)
+
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+	attest.Annotate(rendered.OtherResources, digest)
+	annotated, err := manifest.EncodeAll(rendered.OtherResources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode annotated resources: %w", err)
+	}
+	return annotated, nil
+}
+
+// writeAllYaml writes the Helm manifests to path. Streams above the spill threshold are written
+// document by document instead of being joined in memory, which would double their footprint.
+func (k *KustomizePostRenderer) writeAllYaml(tempDir *extractor.TempDir, path string, docs [][]byte) error {
+	size := parser.DocumentsSize(docs)
+	if k.Options.SpillThreshold > 0 && int64(size) > k.Options.SpillThreshold {
+		k.debugf("streaming %d bytes of manifests to disk (spill threshold %d)", size, k.Options.SpillThreshold)
+		return tempDir.StreamFile(path, func(w io.Writer) error {
+			return parser.WriteDocuments(w, docs)
+		})
+	}
+	return tempDir.WriteFile(path, parser.JoinDocuments(docs))
+}
+
+// addNamespace prepends a Namespace object for namespace to the output unless it already contains one
+func (k *KustomizePostRenderer) addNamespace(output []byte, namespace string) ([]byte, error) {
+	rendered, err := parser.ParseManifests(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kustomize output: %w", err)
+	}
+
+	want := manifest.ID{Kind: "Namespace", Name: namespace}
+	for _, resource := range rendered.OtherResources {
+		if manifest.IDOf(resource) == want {
+			return output, nil
+		}
+	}
+
+	k.debugf("adding Namespace %s", namespace)
+	ns, err := manifest.Encode(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]any{"name": namespace},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode namespace: %w", err)
+	}
+
+	if len(output) == 0 {
+		return ns, nil
+	}
+	return append(append(ns, "---\n"...), output...), nil
+}
+
+// composeKustomization ensures all.yaml is referenced by the parsed kustomization and applies the
+// labels and pod classes from the plugin data and the overrides from the options. It returns the updated content
+// and whether anything changed.
+func (k *KustomizePostRenderer) composeKustomization(kust *kustomize.Kustomization, content []byte, result *parser.ParseResult) ([]byte, bool, error) {
+	data := result.KustomizePluginData
+	changed := kust.EnsureAllYaml()
+
+	if data.Release != nil && kust.AddResource(kustomize.ReleaseInfoYaml) {
+		changed = true
+	}
+
+	// The later pipelines build the resources the first one already moved to the tenant
+	if k.Options.TenantPrefix != "" && data == result.Pipelines[0] {
+		kust.SetTenant(k.Options.TenantPrefix)
+		changed = true
+	}
+
+	if data.Labels != nil {
+		kust.AddLabels(data.Labels.Pairs, data.Labels.IncludeSelectors, data.Labels.IncludeTemplates)
+		changed = true
+	}
+
+	if data.PodClasses != nil {
+		if err := kust.AddPodSpecPatches(data.PodClasses.Fields(), data.PodClasses.Target); err != nil {
+			return nil, false, err
+		}
+		changed = true
+	}
+
+	for _, override := range k.Options.Images {
+		image, err := kustomize.ParseImage(override)
+		if err != nil {
+			return nil, false, err
+		}
+		kust.SetImage(image)
+		changed = true
+	}
+
+	if !changed {
+		return content, false, nil
+	}
+
+	updated, err := kust.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	return updated, true, nil
+}
+
+// migrateAPIs rewrites removed apiVersions in the rendered resources and reports each change on
+// stderr. It returns the re-encoded output, or output itself when nothing was migrated.
+func (k *KustomizePostRenderer) migrateAPIs(resources []map[string]any, output []byte) ([]byte, error) {
+	target, err := k.targetKubernetes()
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := transform.MigrateAPIs(resources, target)
+	if len(migrations) == 0 {
+		return output, nil
+	}
+
+	for _, migration := range migrations {
+		fmt.Fprintf(k.stderr(), "Migrated %s\n", migration)
+	}
+
+	migrated, err := manifest.EncodeAll(resources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode migrated resources: %w", err)
+	}
+	return migrated, nil
+}
+
+// targetKubernetes parses the Kubernetes version the output is checked against
+func (k *KustomizePostRenderer) targetKubernetes() (version.Semver, error) {
+	target, err := version.Parse(k.Options.TargetKubernetes)
+	if err != nil {
+		return version.Semver{}, fmt.Errorf("invalid target Kubernetes version: %w", err)
+	}
+	return target, nil
+}
+
+// inspectsOutput reports whether any enabled option needs the rendered resources
+func (k *KustomizePostRenderer) inspectsOutput() bool {
+	return k.validating() || k.Options.TargetKubernetes != "" || k.Options.CRDSchemas != "" || k.Options.Diff || k.Options.ChangedOnly || k.Options.FailOnNoop || k.Options.DryRunServer || k.Options.Summary || len(k.Options.AllowedNamespaces) > 0 || k.guardsClusterScoped() || k.checksImmutable() || k.Options.CheckRollback || k.Options.TenantPrefix != ""
+}
+
+// printSummary prints the transformations kustomize applied to the input resources to stderr,
+// for reviewers who want to see the effect of a render at a glance
+func (k *KustomizePostRenderer) printSummary(before, after []map[string]any) {
+	lines := diff.Summary(before, after)
+	if len(lines) == 0 {
+		fmt.Fprintln(k.stderr(), "Applied transformations: none")
+		return
+	}
+	fmt.Fprintln(k.stderr(), "Applied transformations:")
+	for _, line := range lines {
+		fmt.Fprintf(k.stderr(), "  %s\n", line)
+	}
+}
+
+// printTrace prints the transformers of the kustomization and the input resources each of them
+// targets to stderr
+func (k *KustomizePostRenderer) printTrace(kust *kustomize.Kustomization, result *parser.ParseResult, files map[string]string, dir string) {
+	var resources []map[string]any
+	for _, resource := range result.OtherResources {
+		if result.KustomizePluginData.Transforms(resource) {
+			resources = append(resources, resource)
+		}
+	}
+
+	lines := kust.Trace(resources, files, dir)
+	if len(lines) == 0 {
+		fmt.Fprintln(k.stderr(), "Trace: no transformers")
+		return
+	}
+	fmt.Fprintln(k.stderr(), "Trace: transformers in the order kustomize runs them:")
+	for _, line := range lines {
+		fmt.Fprintf(k.stderr(), "  %s\n", line)
+	}
+}
+
+// checkPatchTargets warns about the patches of the kustomization whose target selects none of the
+// resources it builds, the most common reason for a patch to do nothing. It runs before the
+// plugin adds patches of its own. Kustomizations adding resources the plugin cannot see without
+// building, e.g. through other resource files or bases, are not checked.
+func (k *KustomizePostRenderer) checkPatchTargets(kust *kustomize.Kustomization, result *parser.ParseResult, files map[string]string, dir string) {
+	var input []map[string]any
+	for _, resource := range result.OtherResources {
+		if result.KustomizePluginData.Transforms(resource) {
+			input = append(input, resource)
+		}
+	}
+	if change := kust.CountChange(input, files, dir); len(change.Unknown) > 0 {
+		k.debugf("patch targets not checked, the kustomization adds resources through %s", strings.Join(change.Unknown, ", "))
+		return
+	}
+	for _, message := range kust.UnmatchedTargets(input) {
+		k.warnf("%s", message)
+	}
+}
+
+// checkChanged returns an error if the build left every resource unchanged, which usually means
+// that patch targets or paths don't match anything
+func checkChanged(before, after []map[string]any) error {
+	text, err := diff.Resources(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to compare output: %w", err)
+	}
+	if text == "" {
+		return errdefs.Wrap(errdefs.ErrValidation, fmt.Errorf("kustomize build did not change any resource, check patch targets and paths"))
+	}
+	return nil
+}
+
+// validating reports whether structural validation of the output is enabled
+func (k *KustomizePostRenderer) validating() bool {
+	return k.Options.Validate != "" && k.Options.Validate != options.ValidationNone
+}
+
+// checkNamespaces fails the render if a resource targets a namespace outside the allowed
+// namespaces of the options, if any
+func (k *KustomizePostRenderer) checkNamespaces(resources []map[string]any) error {
+	if len(k.Options.AllowedNamespaces) == 0 {
+		return nil
+	}
+	findings := validate.Namespaces(resources, k.Options.AllowedNamespaces)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	return errdefs.Wrap(errdefs.ErrPolicy, fmt.Errorf("resources outside the allowed namespaces:\n  %s", strings.Join(messages, "\n  ")))
+}
+
+// guardsClusterScoped reports whether cluster-scoped resources changed by the kustomization are reported
+func (k *KustomizePostRenderer) guardsClusterScoped() bool {
+	return k.Options.GuardClusterScoped != "" && k.Options.GuardClusterScoped != options.ValidationNone
+}
+
+// checkClusterScoped reports the resources of cluster-scoped kinds that the kustomization added
+// or changed, as warnings or as an error depending on the level of the options. Cluster-scoped
+// resources of the chart that the kustomization left alone are not reported.
+func (k *KustomizePostRenderer) checkClusterScoped(input, resources []map[string]any) error {
+	if !k.guardsClusterScoped() {
+		return nil
+	}
+	changed, _, err := diff.Changed(input, resources)
+	if err != nil {
+		return fmt.Errorf("failed to compare output: %w", err)
+	}
+	findings := validate.ClusterScoped(changed)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	if k.Options.GuardClusterScoped == options.ValidationWarn {
+		for _, message := range messages {
+			k.warnf("cluster-scoped resource added or changed: %s", message)
+		}
+		return nil
+	}
+	return errdefs.Wrap(errdefs.ErrPolicy, fmt.Errorf("cluster-scoped resources added or changed by the kustomization:\n  %s", strings.Join(messages, "\n  ")))
+}
+
+// checksImmutable reports whether immutable fields changed by the kustomization are reported
+func (k *KustomizePostRenderer) checksImmutable() bool {
+	return k.Options.CheckImmutable != "" && k.Options.CheckImmutable != options.ValidationNone
+}
+
+// checkImmutable reports the immutable fields the kustomization changed, as warnings or as an
+// error depending on the level of the options
+func (k *KustomizePostRenderer) checkImmutable(input, resources []map[string]any) error {
+	if !k.checksImmutable() {
+		return nil
+	}
+	findings := validate.ImmutableFields(input, resources)
+	if len(findings) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	if k.Options.CheckImmutable == options.ValidationWarn {
+		for _, message := range messages {
+			k.warnf("%s", message)
+		}
+		return nil
+	}
+	return errdefs.Wrap(errdefs.ErrValidation, fmt.Errorf("immutable fields changed by the kustomization:\n  %s", strings.Join(messages, "\n  ")))
+}
+
+// checkTenantReferences fails the render if the tenant prefix renamed resources that pod
+// templates still reference under their unprefixed names
+func (k *KustomizePostRenderer) checkTenantReferences(resources []map[string]any) error {
+	if k.Options.TenantPrefix == "" {
+		return nil
+	}
+	findings := validate.TenantReferences(resources, k.Options.TenantPrefix)
+	if len(findings) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	return errdefs.Wrap(errdefs.ErrValidation, fmt.Errorf("references not rewritten to the tenant prefix %s:\n  %s", k.Options.TenantPrefix, strings.Join(messages, "\n  ")))
+}
+
+// checkRollback warns about the changes of the kustomization that are unsafe to roll back, if
+// enabled by the options
+func (k *KustomizePostRenderer) checkRollback(input, resources []map[string]any) {
+	if !k.Options.CheckRollback {
+		return
+	}
+	for _, finding := range validate.RollbackRisks(input, resources, diff.Generated(input, resources)) {
+		k.warnf("unsafe to roll back: %s", finding)
+	}
+}
+
+// validateOutput validates the rendered resources according to the configured validation level
+// and checks them for APIs removed in the target Kubernetes version and against CRD schemas
+func (k *KustomizePostRenderer) validateOutput(input *parser.ParseResult, resources []map[string]any) error {
+	level := k.Options.Validate
+
+	var findings []validate.Finding
+	if k.validating() {
+		findings = validate.Resources(resources)
+	}
+
+	if k.Options.TargetKubernetes != "" {
+		target, err := k.targetKubernetes()
+		if err != nil {
+			return err
+		}
+		findings = append(findings, validate.RemovedAPIs(resources, target)...)
+
+		// Removed APIs fail the render unless validation is downgraded to warnings
+		if level != options.ValidationWarn {
+			level = options.ValidationError
+		}
+	}
+
+	if k.Options.CRDSchemas != "" {
+		schemas, err := validate.LoadSchemas(k.Options.CRDSchemas)
+		if err != nil {
+			return fmt.Errorf("failed to load CRD schemas: %w", err)
+		}
+		findings = append(findings, schemas.Resources(resources)...)
+
+		// Like removed APIs, schema violations would be rejected at admission
+		if level != options.ValidationWarn {
+			level = options.ValidationError
+		}
+	}
+
+	// The report is written even without findings, so that earlier findings are cleared
+	if k.Options.SARIF != "" {
+		if err := k.writeSARIF(input, resources, findings, level); err != nil {
+			return err
+		}
+	}
+
+	if len(findings) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	sort.Strings(messages)
+
+	if level == options.ValidationWarn {
+		for _, message := range messages {
+			k.warnf("%s", message)
+		}
+		return nil
+	}
+
+	return errdefs.Wrap(errdefs.ErrValidation, fmt.Errorf("validation failed:\n  %s", strings.Join(messages, "\n  ")))
+}
+
+// dryRun submits the output to the cluster with a server-side dry-run, if enabled. kubectl uses
+// the kubeconfig Helm passes to plugins in KUBECONFIG, along with its context and namespace.
+func (k *KustomizePostRenderer) dryRun(ctx context.Context, output []byte) error {
+	if !k.Options.DryRunServer || len(bytes.TrimSpace(output)) == 0 {
+		return nil
+	}
+
+	cfg := cluster.Config{Context: os.Getenv("HELM_KUBECONTEXT"), Namespace: os.Getenv("HELM_NAMESPACE")}
+	k.debugf("verifying output with a server-side dry-run")
+	checked, err := cluster.DryRun(ctx, output, cfg)
+	if err != nil {
+		return errdefs.Wrap(errdefs.ErrValidation, err)
+	}
+	k.debugf("server-side dry-run accepted:\n%s", checked)
+	return nil
+}
+
+// warnf records a non-fatal finding, reported on stderr once the render is done
+func (k *KustomizePostRenderer) warnf(format string, args ...any) {
+	if k.warnings == nil {
+		k.warnings = &warnings.Collector{}
+	}
+	k.warnings.Addf(format, args...)
+}
+
+// debugf prints a diagnostic message to stderr when debug output is enabled
+func (k *KustomizePostRenderer) debugf(format string, args ...any) {
+	if k.Options.Debug {
+		fmt.Fprintf(k.stderr(), "Debug: "+format+"\n", args...)
+	}
+}
+
+// stderr returns the writer for diagnostics
+func (k *KustomizePostRenderer) stderr() io.Writer {
+	if k.Stderr != nil {
+		return k.Stderr
+	}
+	return os.Stderr
 }
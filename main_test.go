@@ -2,9 +2,32 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/owhelm/helm-kustomize/internal/attest"
+	"github.com/owhelm/helm-kustomize/internal/cache"
+	"github.com/owhelm/helm-kustomize/internal/errdefs"
+	"github.com/owhelm/helm-kustomize/internal/extractor"
+	"github.com/owhelm/helm-kustomize/internal/hooks"
+	"github.com/owhelm/helm-kustomize/internal/kustomize"
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/internal/tracing"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
 )
 
 func TestKustomizePostRenderer_Run_PassThrough(t *testing.T) {
@@ -465,7 +488,7 @@ kind: KustomizePluginData
 }
 
 func TestKustomizePostRenderer_Run_NoKustomizationYaml(t *testing.T) {
-	// Test that files section without kustomization.yaml returns an error
+	// Test that a kustomization applying the patches is generated when files has no kustomization.yaml
 	input := bytes.NewBufferString(`---
 apiVersion: v1
 kind: Service
@@ -475,22 +498,96 @@ metadata:
 apiVersion: helm.plugin.kustomize/v1
 kind: KustomizePluginData
 files:
-  patch.yaml: |
+  patches/service.yaml: |
     apiVersion: v1
     kind: Service
     metadata:
       name: test-service
       labels:
         patched: "true"
+  README.md: |
+    Not a patch
 `)
 
 	renderer := &KustomizePostRenderer{}
-	_, err := renderer.Run(input)
-	if err == nil {
-		t.Fatal("Expected error for files without kustomization.yaml, got nil")
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if !strings.Contains(output.String(), `patched: "true"`) {
+		t.Errorf("Output should contain the patched label:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_KustomizationFileNames(t *testing.T) {
+	for _, name := range []string{"kustomization.yml", "Kustomization"} {
+		t.Run(name, func(t *testing.T) {
+			// all.yaml is added to the resources of the kustomization, whichever name it has
+			input := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-service
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  ` + name + `: |
+    namePrefix: prod-
+`
+
+			renderer := &KustomizePostRenderer{}
+			output, err := renderer.Run(bytes.NewBufferString(input))
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if !strings.Contains(output.String(), "name: prod-test-service") {
+				t.Errorf("Output should contain the prefixed Service:\n%s", output.String())
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_NoKustomizationYaml_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         string
+		wantErrSubstr string
+	}{
+		{
+			name:          "no patch files",
+			files:         "  README.md: |\n    Not a patch\n",
+			wantErrSubstr: "no kustomization.yaml or patch files in .",
+		},
+		{
+			name:          "JSON 6902 patch",
+			files:         "  patch.yaml: |\n    - op: add\n      path: /metadata/labels/patched\n      value: \"true\"\n",
+			wantErrSubstr: "patch.yaml is a JSON 6902 patch, which needs a target",
+		},
 	}
-	if !strings.Contains(err.Error(), "failed to run kustomize") && !strings.Contains(err.Error(), "unable to find") {
-		t.Errorf("Expected error message about missing kustomization.yaml, got: %v", err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-service
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+` + tt.files
+
+			renderer := &KustomizePostRenderer{}
+			_, err := renderer.Run(bytes.NewBufferString(input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Fatalf("Run() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+			if code := errdefs.ExitCode(err); code != errdefs.ExitPluginData {
+				t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitPluginData)
+			}
+		})
 	}
 }
 
@@ -563,3 +660,3862 @@ spec:
 		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
 	}
 }
+
+func TestKustomizePostRenderer_Run_Overlay(t *testing.T) {
+	// Test that --overlay builds the kustomization in the given directory
+	input := bytes.NewBufferString(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namePrefix: default-
+  overlays/prod/kustomization.yaml: |
+    components:
+      - ../../components/common
+    namePrefix: prod-
+  components/common/kustomization.yaml: |
+    apiVersion: kustomize.config.k8s.io/v1alpha1
+    kind: Component
+    commonAnnotations:
+      team: platform
+`)
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Overlay: "overlays/prod"}}
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  annotations:
+    team: platform
+  name: prod-test-configmap
+`
+
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_Validate(t *testing.T) {
+	// The namePrefix produces a name which is not a valid Kubernetes object name
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: Invalid_
+`
+
+	t.Run("error level fails the render", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{Validate: options.ValidationError}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if err == nil {
+			t.Fatal("Expected validation error, got nil")
+		}
+		if !strings.Contains(err.Error(), "validation failed") || !strings.Contains(err.Error(), "ConfigMap/Invalid_test-configmap") {
+			t.Errorf("Expected validation error naming the resource, got: %v", err)
+		}
+	})
+
+	t.Run("warn level keeps the output", func(t *testing.T) {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Options: options.Options{Validate: options.ValidationWarn}, Stderr: &stderr}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(output.String(), "name: Invalid_test-configmap") {
+			t.Errorf("Expected rendered output, got:\n%s", output.String())
+		}
+		if !strings.Contains(stderr.String(), "  - ConfigMap/Invalid_test-configmap") {
+			t.Errorf("Expected validation warning on stderr, got:\n%s", stderr.String())
+		}
+	})
+
+	t.Run("none level skips validation", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{Validate: options.ValidationNone}}
+		if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_CRDSchemas(t *testing.T) {
+	schemas := t.TempDir()
+	crd := `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              replicas:
+                type: integer
+`
+	if err := os.WriteFile(filepath.Join(schemas, "widget.yaml"), []byte(crd), 0644); err != nil {
+		t.Fatalf("Failed to write CRD: %v", err)
+	}
+
+	// The overlay patch sets replicas to a string, which the API server would reject
+	input := `---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: test-widget
+spec:
+  replicas: 1
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - patch: |
+          apiVersion: example.com/v1
+          kind: Widget
+          metadata:
+            name: test-widget
+          spec:
+            replicas: "two"
+`
+
+	t.Run("fails the render", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{CRDSchemas: schemas}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if code := errdefs.ExitCode(err); code != errdefs.ExitValidation {
+			t.Fatalf("ExitCode() = %d, want %d (error %v)", code, errdefs.ExitValidation, err)
+		}
+		if !strings.Contains(err.Error(), "Widget/test-widget: spec.replicas: must be of type integer, got string") {
+			t.Errorf("Expected schema violation, got: %v", err)
+		}
+	})
+
+	t.Run("warn level keeps the output", func(t *testing.T) {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Options: options.Options{CRDSchemas: schemas, Validate: options.ValidationWarn}, Stderr: &stderr}
+		if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(stderr.String(), "spec.replicas") {
+			t.Errorf("Expected schema warning on stderr, got:\n%s", stderr.String())
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{CRDSchemas: filepath.Join(schemas, "missing")}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if err == nil || !strings.Contains(err.Error(), "failed to load CRD schemas") {
+			t.Errorf("Run() error = %v, want failed to load CRD schemas", err)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_DryRunServer(t *testing.T) {
+	realKubectl, err := exec.LookPath("kubectl")
+	if err != nil {
+		t.Skip("kubectl not found")
+	}
+
+	// The fake kubectl answers the dry-run apply and forwards kustomize builds to the real one
+	newKubectl := func(t *testing.T, exitCode string) string {
+		dir := t.TempDir()
+		script := "#!/bin/sh\n" +
+			"if [ \"$1\" = apply ]; then\n" +
+			"  echo \"$@\" > \"" + filepath.Join(dir, "args") + "\"\n" +
+			"  cat > \"" + filepath.Join(dir, "stdin") + "\"\n" +
+			"  echo 'admission webhook denied the request' >&2\n" +
+			"  exit " + exitCode + "\n" +
+			"fi\n" +
+			"exec \"" + realKubectl + "\" \"$@\"\n"
+		if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write fake kubectl: %v", err)
+		}
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		t.Setenv("HELM_KUBECONTEXT", "staging")
+		t.Setenv("HELM_NAMESPACE", "apps")
+		return dir
+	}
+
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+`
+
+	t.Run("accepted", func(t *testing.T) {
+		dir := newKubectl(t, "0")
+		renderer := &KustomizePostRenderer{Options: options.Options{DryRunServer: true}}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+
+		args, err := os.ReadFile(filepath.Join(dir, "args"))
+		if err != nil {
+			t.Fatalf("Failed to read kubectl args: %v", err)
+		}
+		if want := "apply --dry-run=server -o name -f - --context staging --namespace apps\n"; string(args) != want {
+			t.Errorf("kubectl args = %q, want %q", args, want)
+		}
+		stdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+		if err != nil {
+			t.Fatalf("Failed to read kubectl stdin: %v", err)
+		}
+		if string(stdin) != output.String() {
+			t.Errorf("kubectl stdin = %q, want the rendered output %q", stdin, output.String())
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		newKubectl(t, "1")
+		renderer := &KustomizePostRenderer{Options: options.Options{DryRunServer: true}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if code := errdefs.ExitCode(err); code != errdefs.ExitValidation {
+			t.Fatalf("ExitCode() = %d, want %d (error %v)", code, errdefs.ExitValidation, err)
+		}
+		if !strings.Contains(err.Error(), "admission webhook denied the request") {
+			t.Errorf("Expected kubectl error in the render error, got: %v", err)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_Debug(t *testing.T) {
+	input := bytes.NewBufferString(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namespace: test
+`)
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Options: options.Options{Debug: true}, Stderr: &stderr}
+	if _, err := renderer.Run(input); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	for _, want := range []string{"Debug: extracting 1 files", "Debug: updated kustomization.yaml", "Debug: building "} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Expected %q on stderr, got:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestKustomizePostRenderer_Run_SpillThreshold(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namespace: test
+`
+
+	inMemory, err := (&KustomizePostRenderer{}).Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Options: options.Options{Debug: true, SpillThreshold: 1}, Stderr: &stderr}
+	spilled, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	if spilled.String() != inMemory.String() {
+		t.Errorf("Spilled output mismatch.\nExpected:\n%s\nGot:\n%s", inMemory, spilled)
+	}
+	if !strings.Contains(stderr.String(), "Debug: streaming") {
+		t.Errorf("Expected streaming debug message on stderr, got:\n%s", stderr.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_NonResourceDocuments(t *testing.T) {
+	input := bytes.NewBufferString(`---
+# Source: chart/templates/disabled.yaml
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+Thank you for installing the chart.
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namespace: test
+`)
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+  namespace: test
+---
+# Source: chart/templates/disabled.yaml
+---
+Thank you for installing the chart.
+`
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_Aliases(t *testing.T) {
+	input := bytes.NewBufferString(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+  labels: &labels
+    app: web
+  annotations:
+    <<: *labels
+    extra: "true"
+data:
+  first: &value |
+    line
+  second: *value
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    labels:
+      - pairs: &common
+          team: platform
+    commonAnnotations: *common
+`)
+
+	renderer := &KustomizePostRenderer{Stderr: io.Discard}
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `apiVersion: v1
+data:
+  first: |
+    line
+  second: |
+    line
+kind: ConfigMap
+metadata:
+  annotations:
+    app: web
+    extra: "true"
+    team: platform
+  labels:
+    app: web
+    team: platform
+  name: test-configmap
+`
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_OutputStyle(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: test
+imagePullSecrets:
+- name: registry
+---
+Thank you for installing the chart.
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namespace: test
+`
+
+	tests := []struct {
+		name     string
+		opts     options.Options
+		expected string
+	}{
+		{
+			name: "kustomize formatting",
+			expected: `apiVersion: v1
+imagePullSecrets:
+- name: registry
+kind: ServiceAccount
+metadata:
+  name: test
+  namespace: test
+---
+Thank you for installing the chart.
+`,
+		},
+		{
+			name: "indented sequences",
+			opts: options.Options{IndentSequences: true},
+			expected: `apiVersion: v1
+imagePullSecrets:
+  - name: registry
+kind: ServiceAccount
+metadata:
+  name: test
+  namespace: test
+---
+Thank you for installing the chart.
+`,
+		},
+		{
+			name: "four spaces",
+			opts: options.Options{Indent: 4},
+			expected: `apiVersion: v1
+imagePullSecrets:
+  - name: registry
+kind: ServiceAccount
+metadata:
+    name: test
+    namespace: test
+---
+Thank you for installing the chart.
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &KustomizePostRenderer{Options: tt.opts}
+			output, err := renderer.Run(bytes.NewBufferString(input))
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if output.String() != tt.expected {
+				t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", tt.expected, output.String())
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_OutputJSON(t *testing.T) {
+	withPluginData := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+---
+Thank you for installing the chart.
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namespace: test
+`
+
+	tests := []struct {
+		name     string
+		input    string
+		output   options.OutputFormat
+		expected string
+	}{
+		{
+			name:   "json",
+			input:  withPluginData,
+			output: options.OutputJSON,
+			expected: `[
+  {
+    "apiVersion": "v1",
+    "kind": "ConfigMap",
+    "metadata": {
+      "name": "first",
+      "namespace": "test"
+    }
+  },
+  {
+    "apiVersion": "v1",
+    "kind": "ConfigMap",
+    "metadata": {
+      "name": "second",
+      "namespace": "test"
+    }
+  }
+]
+`,
+		},
+		{
+			name:   "ndjson",
+			input:  withPluginData,
+			output: options.OutputNDJSON,
+			expected: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"first","namespace":"test"}}
+{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"second","namespace":"test"}}
+`,
+		},
+		{
+			name:     "json without plugin data",
+			input:    "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: a&b\n",
+			output:   options.OutputNDJSON,
+			expected: `{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"a&b"}}` + "\n",
+		},
+		{
+			name:     "empty json",
+			input:    "",
+			output:   options.OutputJSON,
+			expected: "[]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &KustomizePostRenderer{Options: options.Options{Output: tt.output}}
+			output, err := renderer.Run(bytes.NewBufferString(tt.input))
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if output.String() != tt.expected {
+				t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", tt.expected, output.String())
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_OverlayReservedAllYaml(t *testing.T) {
+	// Test that all.yaml is reserved inside the overlay directory
+	input := bytes.NewBufferString(`---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  overlays/prod/all.yaml: |
+    some content
+  overlays/prod/kustomization.yaml: |
+    resources:
+      - all.yaml
+`)
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Overlay: "overlays/prod"}}
+	_, err := renderer.Run(input)
+	if err == nil {
+		t.Fatal("Expected error for reserved 'overlays/prod/all.yaml' filename, got nil")
+	}
+	if !strings.Contains(err.Error(), "overlays/prod/all.yaml") || !strings.Contains(err.Error(), "reserved") {
+		t.Errorf("Expected error message about reserved 'overlays/prod/all.yaml', got: %v", err)
+	}
+}
+
+func TestKustomizePostRenderer_Run_ConfiguredReservedFilenames(t *testing.T) {
+	input := bytes.NewBufferString(`---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  secrets.yaml: |
+    some content
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+`)
+
+	renderer := &KustomizePostRenderer{Options: options.Options{ReservedFilenames: []string{"secrets.yaml"}}}
+	_, err := renderer.Run(input)
+	if err == nil {
+		t.Fatal("Expected error for configured reserved filename, got nil")
+	}
+	if !strings.Contains(err.Error(), "secrets.yaml") || !strings.Contains(err.Error(), "reserved by configuration") {
+		t.Errorf("Expected error message about reserved 'secrets.yaml', got: %v", err)
+	}
+}
+
+func TestKustomizePostRenderer_Run_SetImage(t *testing.T) {
+	input := bytes.NewBufferString(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:1.0
+      - name: cache
+        image: redis:6
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    images:
+      - name: redis
+        newTag: "7"
+`)
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Images: []string{
+		"nginx=registry.internal/nginx:1.25",
+		"redis=mirror.internal/redis",
+	}}}
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - image: registry.internal/nginx:1.25
+        name: web
+      - image: mirror.internal/redis:6
+        name: cache
+`
+
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_Diff(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+data:
+  key: value
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    commonAnnotations:
+      team: platform
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Diff: true}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `--- a/ConfigMap/test-configmap
++++ b/ConfigMap/test-configmap
+@@ -3,4 +3,6 @@
+   key: value
+ kind: ConfigMap
+ metadata:
++  annotations:
++    team: platform
+   name: test-configmap
+`
+
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_DiffPassThrough(t *testing.T) {
+	// Without plugin data nothing changes, so the diff is empty
+	input := bytes.NewBufferString(`---
+apiVersion: v1
+kind: Service
+metadata:
+  name: test-service
+`)
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Diff: true}}
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if output.Len() != 0 {
+		t.Errorf("Expected empty diff, got:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_Check(t *testing.T) {
+	// A kubectl that always fails shows that check mode never builds
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte("#!/bin/sh\necho 'kubectl was run' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake kubectl: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	input := func(patch string) string {
+		return `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - path: ` + patch + `
+  patch.yaml: |
+    apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: test-configmap
+`
+	}
+
+	tests := []struct {
+		name          string
+		input         string
+		wantErrSubstr string
+	}{
+		{name: "resolved", input: input("patch.yaml")},
+		{name: "missing patch", input: input("missing.yaml"), wantErrSubstr: "unresolved references in the kustomization:\n  kustomization.yaml: missing.yaml"},
+		{name: "no plugin data", input: "apiVersion: v1\nkind: Service\nmetadata:\n  name: test-service\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &KustomizePostRenderer{Options: options.Options{Check: true, Output: options.OutputJSON}}
+			output, err := renderer.Run(bytes.NewBufferString(tt.input))
+			if tt.wantErrSubstr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+					t.Fatalf("Run() error = %v, want error containing %q", err, tt.wantErrSubstr)
+				}
+				if errdefs.ExitCode(err) != errdefs.ExitPluginData {
+					t.Errorf("ExitCode() = %d, want %d", errdefs.ExitCode(err), errdefs.ExitPluginData)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if output.Len() != 0 {
+				t.Errorf("Expected no output in check mode, got:\n%s", output.String())
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_RemovedAPIs(t *testing.T) {
+	input := `---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: cleanup
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+`
+
+	t.Run("removed in target fails the render", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{TargetKubernetes: "1.31"}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if err == nil {
+			t.Fatal("Expected removed API error, got nil")
+		}
+		if !strings.Contains(err.Error(), "CronJob/cleanup: batch/v1beta1 CronJob was removed in Kubernetes 1.25, use batch/v1") {
+			t.Errorf("Expected removed API error naming the resource, got: %v", err)
+		}
+	})
+
+	t.Run("warn level keeps the output", func(t *testing.T) {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Options: options.Options{Validate: options.ValidationWarn, TargetKubernetes: "1.31"}, Stderr: &stderr}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(output.String(), "kind: CronJob") {
+			t.Errorf("Expected rendered output, got:\n%s", output.String())
+		}
+		if !strings.Contains(stderr.String(), "  - CronJob/cleanup: batch/v1beta1 CronJob was removed") {
+			t.Errorf("Expected removed API warning on stderr, got:\n%s", stderr.String())
+		}
+	})
+
+	t.Run("still served in target", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{TargetKubernetes: "1.24"}}
+		if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_MigrateAPIs(t *testing.T) {
+	input := `---
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: web
+spec:
+  minAvailable: 1
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+`
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{
+		Options: options.Options{TargetKubernetes: "1.31", MigrateAPIs: true},
+		Stderr:  &stderr,
+	}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	if !strings.Contains(output.String(), "apiVersion: policy/v1\n") {
+		t.Errorf("Expected migrated apiVersion in output, got:\n%s", output.String())
+	}
+	if !strings.Contains(output.String(), "minAvailable: 1") {
+		t.Errorf("Expected the rest of the resource to be kept, got:\n%s", output.String())
+	}
+	if !strings.Contains(stderr.String(), "Migrated PodDisruptionBudget.policy/web: policy/v1beta1 -> policy/v1") {
+		t.Errorf("Expected migration report on stderr, got:\n%s", stderr.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_CreateNamespace(t *testing.T) {
+	newInput := func(extra string) string {
+		return `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+` + extra + `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namespace: prod
+`
+	}
+
+	t.Run("adds missing namespace", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{CreateNamespace: true}}
+		output, err := renderer.Run(bytes.NewBufferString(newInput("")))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+
+		want := "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n---\n"
+		if !strings.HasPrefix(output.String(), want) {
+			t.Errorf("Expected Namespace object first, got:\n%s", output.String())
+		}
+		if !strings.Contains(output.String(), "namespace: prod") {
+			t.Errorf("Expected namespaced ConfigMap, got:\n%s", output.String())
+		}
+	})
+
+	t.Run("keeps existing namespace", func(t *testing.T) {
+		existing := "---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n  labels:\n    team: web\n"
+		renderer := &KustomizePostRenderer{Options: options.Options{CreateNamespace: true}}
+		output, err := renderer.Run(bytes.NewBufferString(newInput(existing)))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if count := strings.Count(output.String(), "kind: Namespace"); count != 1 {
+			t.Errorf("Expected exactly one Namespace object, got %d:\n%s", count, output.String())
+		}
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{}
+		output, err := renderer.Run(bytes.NewBufferString(newInput("")))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if strings.Contains(output.String(), "kind: Namespace") {
+			t.Errorf("Expected no Namespace object, got:\n%s", output.String())
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_PluginDataLabels(t *testing.T) {
+	input := bytes.NewBufferString(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - name: web
+        image: nginx
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+labels:
+  pairs:
+    team: platform
+  includeTemplates: true
+`)
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    team: platform
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+        team: platform
+    spec:
+      containers:
+      - image: nginx
+        name: web
+`
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_FailOnNoop(t *testing.T) {
+	newInput := func(kustomization string) string {
+		return `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+` + kustomization
+	}
+
+	t.Run("unchanged output fails", func(t *testing.T) {
+		// The patch targets a resource that does not exist in the chart
+		input := newInput(`    patches:
+      - target:
+          kind: Deployment
+        patch: |
+          - op: add
+            path: /metadata/labels
+            value: {team: web}
+`)
+		renderer := &KustomizePostRenderer{Options: options.Options{FailOnNoop: true}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if err == nil || !strings.Contains(err.Error(), "did not change any resource") {
+			t.Errorf("Expected no-op error, got: %v", err)
+		}
+	})
+
+	t.Run("changed output passes", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{FailOnNoop: true}}
+		if _, err := renderer.Run(bytes.NewBufferString(newInput("    namePrefix: prod-\n"))); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_EmptyOutput(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - path: delete.yaml
+  delete.yaml: |
+    apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: test-configmap
+    $patch: delete
+`
+
+	t.Run("fails by default", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		want := "kustomize build produced no resources from 1 input resources, use --allow-empty-output to accept it:\n" +
+			"  PatchTransformer patches[0] (delete.yaml): deletes ConfigMap/test-configmap"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Run() error = %v, want error containing %q", err, want)
+		}
+		if errdefs.ExitCode(err) != errdefs.ExitValidation {
+			t.Errorf("ExitCode() = %d, want %d", errdefs.ExitCode(err), errdefs.ExitValidation)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{AllowEmptyOutput: true}}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if hasResources(output.Bytes()) {
+			t.Errorf("Expected an empty output, got:\n%s", output.String())
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_PreserveUntouched(t *testing.T) {
+	input := `---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web   # the public endpoint
+spec:
+  ports:
+    - port: 80  # http
+---
+# Source: web/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: "fast"
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - patch: |
+          apiVersion: v1
+          kind: ConfigMap
+          metadata:
+            name: settings
+          data:
+            mode: safe
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{PreserveUntouched: true}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `apiVersion: v1
+data:
+  mode: safe
+kind: ConfigMap
+metadata:
+  name: settings
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web   # the public endpoint
+spec:
+  ports:
+    - port: 80  # http
+`
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_CheckCount(t *testing.T) {
+	newInput := func(annotations string) string {
+		return `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: debug
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: values
+` + annotations + `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    configMapGenerator:
+      - name: flags
+        literals: [debug=false]
+    patches:
+      - patch: |
+          apiVersion: v1
+          kind: ConfigMap
+          metadata:
+            name: debug
+          $patch: delete
+`
+	}
+
+	t.Run("generated and deleted resources are counted", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{CheckCount: true}}
+		if _, err := renderer.Run(bytes.NewBufferString(newInput(""))); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("dropped resource fails", func(t *testing.T) {
+		// kustomize silently drops resources marked as local configuration
+		input := newInput("  annotations:\n    config.kubernetes.io/local-config: \"true\"\n")
+		renderer := &KustomizePostRenderer{Options: options.Options{CheckCount: true}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		want := "kustomize built 2 resources, want 3 (3 input + 1 generated - 1 deleted):\n  - ConfigMap/values\n  + ConfigMap/flags-"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Run() error = %v, want error containing %q", err, want)
+		}
+		if errdefs.ExitCode(err) != errdefs.ExitValidation {
+			t.Errorf("ExitCode() = %d, want %d", errdefs.ExitCode(err), errdefs.ExitValidation)
+		}
+	})
+
+	t.Run("bases are not counted", func(t *testing.T) {
+		var stderr bytes.Buffer
+		input := strings.Replace(newInput(""), "      - all.yaml\n", "      - all.yaml\n      - base\n", 1) +
+			"  base/kustomization.yaml: |\n    resources: [service.yaml]\n" +
+			"  base/service.yaml: |\n    apiVersion: v1\n    kind: Service\n    metadata:\n      name: web\n"
+		renderer := &KustomizePostRenderer{Options: options.Options{CheckCount: true}, Stderr: &stderr}
+		if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(stderr.String(), "resource count not checked, the kustomization adds or removes resources through resources base") {
+			t.Errorf("Expected a warning about the base, got:\n%s", stderr.String())
+		}
+	})
+}
+
+func TestHasResources(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{name: "empty", output: "", want: false},
+		{name: "separators and comments", output: "---\n# Source: chart/templates/a.yaml\n---\n\n", want: false},
+		{name: "resource", output: "---\n# comment\napiVersion: v1\nkind: ConfigMap\n", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasResources([]byte(tt.output)); got != tt.want {
+				t.Errorf("hasResources(%q) = %v, want %v", tt.output, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_ChangedOnly(t *testing.T) {
+	input := bytes.NewBufferString(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: patched
+data:
+  key: old
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: untouched
+data:
+  key: value
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - target:
+          name: patched
+        patch: |
+          - op: replace
+            path: /data/key
+            value: new
+`)
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Options: options.Options{ChangedOnly: true}, Stderr: &stderr}
+	output, err := renderer.Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	expected := `apiVersion: v1
+data:
+  key: new
+kind: ConfigMap
+metadata:
+  name: patched
+`
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+
+	if stderr.String() != "Skipped 1 unchanged resources:\n  ConfigMap/untouched\n" {
+		t.Errorf("Unexpected summary on stderr:\n%s", stderr.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_Summary(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: dev
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namespace: prod
+    labels:
+      - pairs:
+          team: web
+    patches:
+      - target:
+          name: settings
+        patch: |
+          - op: replace
+            path: /data/mode
+            value: prod
+`
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Options: options.Options{Summary: true}, Stderr: &stderr}
+	if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	want := `Applied transformations:
+  set namespace prod on 2 resources
+  added label team=web to 2 resources
+  patched data.mode on ConfigMap/prod/settings
+`
+	if stderr.String() != want {
+		t.Errorf("Summary on stderr =\n%s\nwant:\n%s", stderr.String(), want)
+	}
+
+	// A build that changes nothing says so
+	stderr.Reset()
+	noop := strings.Replace(input, "namespace: prod", "", 1)
+	noop = noop[:strings.Index(noop, "    labels:")]
+	if _, err := renderer.Run(bytes.NewBufferString(noop)); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if stderr.String() != "Applied transformations: none\n" {
+		t.Errorf("Summary on stderr = %q, want none", stderr.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_Trace(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+    patches:
+      - path: replicas.yaml
+      - target:
+          kind: Deployment
+          name: api
+        patch: |
+          - op: add
+            path: /spec/replicas
+            value: 2
+  replicas.yaml: |
+    apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: web
+    spec:
+      replicas: 3
+`
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Options: options.Options{Trace: true}, Stderr: &stderr}
+	if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	want := `Trace: transformers in the order kustomize runs them:
+  PatchTransformer patches[0] (replicas.yaml): Deployment.apps/web
+  PatchTransformer patches[1]: matched nothing
+  PrefixTransformer namePrefix prod-: all resources (1)
+WARNING: 1 warning(s) during render:
+  - patches[1]: target kind Deployment, name api matches no resource
+`
+	if stderr.String() != want {
+		t.Errorf("Trace on stderr =\n%s\nwant:\n%s", stderr.String(), want)
+	}
+}
+
+func TestKustomizePostRenderer_Run_Hooks(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+hooks:
+  - command: sed
+    args: ["s/name: web/name: web-chart/"]
+`
+
+	t.Run("plugin data hooks run before configured hooks", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{
+			AllowedHooks: []string{"sed"},
+			Hooks:        []hooks.Hook{{Command: "sed", Args: []string{"s/name: web-chart/name: web-user/"}}},
+		}}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(output.String(), "name: web-user") {
+			t.Errorf("Expected output of both hooks in order, got:\n%s", output.String())
+		}
+	})
+
+	t.Run("plugin data hook not allowed", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{AllowedHooks: []string{"cost-annotator"}}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		wantErrSubstr := `hook "sed" is not allowed`
+		if err == nil || !strings.Contains(err.Error(), wantErrSubstr) {
+			t.Fatalf("Run() error = %v, want error containing %q", err, wantErrSubstr)
+		}
+		if code := errdefs.ExitCode(err); code != errdefs.ExitPolicy {
+			t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitPolicy)
+		}
+	})
+
+	t.Run("configured hook not allowed", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{
+			AllowedHooks: []string{"sed"},
+			Hooks:        []hooks.Hook{{Command: "sh", Args: []string{"-c", "cat"}}},
+		}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		wantErrSubstr := `hook "sh" is not allowed`
+		if err == nil || !strings.Contains(err.Error(), wantErrSubstr) {
+			t.Fatalf("Run() error = %v, want error containing %q", err, wantErrSubstr)
+		}
+		if code := errdefs.ExitCode(err); code != errdefs.ExitPolicy {
+			t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitPolicy)
+		}
+	})
+
+	t.Run("repo-local config cannot run hooks", func(t *testing.T) {
+		t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+		workDir := t.TempDir()
+		t.Chdir(workDir)
+		marker := filepath.Join(workDir, "ran")
+		config := "hooks:\n- command: touch\n  args: [" + marker + "]\nallowedHooks: [touch]\n"
+		if err := os.WriteFile(options.LocalConfigFileName, []byte(config), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		if _, err := options.Load(nil); err == nil || !strings.Contains(err.Error(), "can only be set in the user config file") {
+			t.Fatalf("Load() error = %v, want error containing %q", err, "can only be set in the user config file")
+		}
+		if _, err := os.Stat(marker); err == nil {
+			t.Errorf("the hook of the repo-local config ran")
+		}
+	})
+
+	t.Run("hook returns invalid manifests", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{
+			AllowedHooks: []string{"sed", "sh"},
+			Hooks:        []hooks.Hook{{Command: "sh", Args: []string{"-c", "echo 'kind: ['"}}},
+		}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		wantErrSubstr := "hook sh -c echo 'kind: [' returned invalid manifests"
+		if err == nil || !strings.Contains(err.Error(), wantErrSubstr) {
+			t.Fatalf("Run() error = %v, want error containing %q", err, wantErrSubstr)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_Inject(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    mesh: enabled
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  template:
+    spec:
+      containers:
+        - name: worker
+          image: busybox
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+inject:
+  containers:
+    - name: proxy
+      image: envoy:1.30
+  target:
+    labelSelector: mesh=enabled
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	result, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	containers := map[string]int{}
+	for _, resource := range result.OtherResources {
+		spec := resource["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)
+		containers[manifest.IDOf(resource).Name] = len(spec["containers"].([]any))
+	}
+	want := map[string]int{"prod-web": 2, "prod-worker": 1}
+	if !reflect.DeepEqual(containers, want) {
+		t.Errorf("containers per Deployment = %v, want %v", containers, want)
+	}
+	if !strings.Contains(output.String(), "image: envoy:1.30") {
+		t.Errorf("Expected injected sidecar in output, got:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_ResourceDefaults(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx
+          resources:
+            limits:
+              memory: 64Mi
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+resourceDefaults:
+  requests:
+    cpu: 100m
+    memory: 128Mi
+  limits:
+    memory: 256Mi
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	result, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	container := result.OtherResources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)["containers"].([]any)[0].(map[string]any)
+	// The memory limit of the chart is kept, without a default memory request above it
+	want := map[string]any{
+		"requests": map[string]any{"cpu": "100m"},
+		"limits":   map[string]any{"memory": "64Mi"},
+	}
+	if !reflect.DeepEqual(container["resources"], want) {
+		t.Errorf("resources = %v, want %v", container["resources"], want)
+	}
+}
+
+func TestKustomizePostRenderer_Run_Scheduling(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  schedule: "@daily"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          nodeSelector:
+            pool: batch
+          containers:
+            - name: backup
+              image: busybox
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+scheduling:
+  nodeSelector:
+    pool: general
+  tolerations:
+    - key: dedicated
+      operator: Equal
+      value: general
+      effect: NoSchedule
+  target:
+    kind: Deployment
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	result, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	web := result.OtherResources[0]["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)
+	if !reflect.DeepEqual(web["nodeSelector"], map[string]any{"pool": "general"}) {
+		t.Errorf("Deployment nodeSelector = %v, want pool=general", web["nodeSelector"])
+	}
+	if tolerations, _ := web["tolerations"].([]any); len(tolerations) != 1 {
+		t.Errorf("Deployment tolerations = %v, want 1", web["tolerations"])
+	}
+	// The CronJob is not targeted and keeps its node selector
+	if !strings.Contains(output.String(), "pool: batch") {
+		t.Errorf("Expected CronJob node selector to be kept, got:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_Hardening(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      securityContext:
+        runAsNonRoot: true
+        seccompProfile:
+          type: RuntimeDefault
+      containers:
+        - name: web
+          image: nginx
+          securityContext:
+            allowPrivilegeEscalation: false
+            capabilities:
+              drop: [ALL]
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+hardening: {}
+`
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Stderr: &stderr}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	want := "Hardened Deployment.apps/web: containers[web].securityContext.readOnlyRootFilesystem unset -> true\n"
+	if stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+	if !strings.Contains(output.String(), "readOnlyRootFilesystem: true") {
+		t.Errorf("Expected read-only root filesystem in output, got:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_PodClasses(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: backup
+              image: busybox
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+podClasses:
+  priorityClassName: high
+  runtimeClassName: gvisor
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	result, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	if len(result.OtherResources) != 2 {
+		t.Fatalf("Expected 2 resources, got %d", len(result.OtherResources))
+	}
+	paths := map[string][]string{
+		"Deployment": {"spec", "template", "spec"},
+		"CronJob":    {"spec", "jobTemplate", "spec", "template", "spec"},
+	}
+	for _, resource := range result.OtherResources {
+		spec := resource
+		for _, key := range paths[resource["kind"].(string)] {
+			spec = spec[key].(map[string]any)
+		}
+		if spec["priorityClassName"] != "high" || spec["runtimeClassName"] != "gvisor" {
+			t.Errorf("%s pod spec = %v, want priorityClassName high and runtimeClassName gvisor", resource["kind"], spec)
+		}
+	}
+}
+
+func TestKustomizePostRenderer_Run_RegistryMirrors(t *testing.T) {
+	resources := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+        - name: wait
+          image: busybox
+      containers:
+        - name: web
+          image: nginx:1.25
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: backup
+              image: quay.io/org/backup:v1
+`
+	pluginData := `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+excludeKinds: [CronJob]
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+`
+	mirrors := map[string]string{"docker.io": "mirror.internal", "quay.io": "mirror.internal/quay"}
+	want := []string{
+		"image: mirror.internal/library/busybox",
+		"image: mirror.internal/library/nginx:1.25",
+		"image: mirror.internal/quay/org/backup:v1",
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "with plugin data and passed-through resources", input: resources + pluginData},
+		{name: "without plugin data", input: resources},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &KustomizePostRenderer{Options: options.Options{RegistryMirrors: mirrors}}
+			output, err := renderer.Run(bytes.NewBufferString(tt.input))
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			for _, image := range want {
+				if !strings.Contains(output.String(), image) {
+					t.Errorf("Expected %q in output, got:\n%s", image, output.String())
+				}
+			}
+		})
+	}
+
+	t.Run("comment-only document without plugin data", func(t *testing.T) {
+		comment := "# Source: chart/templates/NOTES.txt\n# Visit http://web.example.com\n"
+		renderer := &KustomizePostRenderer{Options: options.Options{RegistryMirrors: mirrors}}
+		output, err := renderer.Run(bytes.NewBufferString(resources + "---\n" + comment))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(output.String(), "image: mirror.internal/library/nginx:1.25") {
+			t.Errorf("Expected the mirrored image in output, got:\n%s", output.String())
+		}
+		if !strings.Contains(output.String(), "---\n"+comment) {
+			t.Errorf("Expected the comment-only document in output, got:\n%s", output.String())
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_PinDigests(t *testing.T) {
+	// The fake crane prints a digest derived from the image reference
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho \"$2\" >> \"" + filepath.Join(dir, "resolved") + "\"\necho sha256:$(echo \"$2\" | tr -c 'a-z0-9\\n' -)\n"
+	if err := os.WriteFile(filepath.Join(dir, "crane"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake crane: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	cache := filepath.Join(t.TempDir(), "digests.json")
+
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          image: nginx:1.25
+        - name: proxy
+          image: envoy@sha256:abc
+---
+# Comment-only document kept by the rewrite
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{
+		PinDigests:      true,
+		DigestCache:     cache,
+		RegistryMirrors: map[string]string{"docker.io": "mirror.internal"},
+	}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	// Digests are resolved in the mirror, and images that have one are kept
+	for _, image := range []string{"image: mirror.internal/library/nginx:1.25@sha256:mirror-internal-library-nginx-1-25", "image: mirror.internal/library/envoy@sha256:abc"} {
+		if !strings.Contains(output.String(), image) {
+			t.Errorf("Expected %q in output, got:\n%s", image, output.String())
+		}
+	}
+	if !strings.Contains(output.String(), "---\n# Comment-only document kept by the rewrite\n") {
+		t.Errorf("Expected the comment-only document in output, got:\n%s", output.String())
+	}
+
+	// Offline renders use the cache without calling crane
+	if err := os.Remove(filepath.Join(dir, "resolved")); err != nil {
+		t.Fatalf("Failed to remove crane log: %v", err)
+	}
+	renderer = &KustomizePostRenderer{Options: options.Options{PinDigests: true, DigestCache: cache, Offline: true}}
+	if _, err := renderer.Run(bytes.NewBufferString(strings.ReplaceAll(input, "nginx:1.25", "mirror.internal/library/nginx:1.25"))); err != nil {
+		t.Fatalf("Run() offline error = %v, want nil", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "resolved")); err == nil {
+		t.Errorf("crane was called in offline mode")
+	}
+
+	_, err = renderer.Run(bytes.NewBufferString(strings.ReplaceAll(input, "nginx:1.25", "redis:7")))
+	if err == nil || !strings.Contains(err.Error(), "image redis:7 is not in the digest cache") {
+		t.Errorf("Run() offline error = %v, want error containing %q", err, "image redis:7 is not in the digest cache")
+	}
+}
+
+func TestKustomizePostRenderer_Run_Signature(t *testing.T) {
+	// The fake cosign signs the blob with its own content
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		"while [ $# -gt 1 ]; do\n" +
+		"  if [ \"$1\" = --output-signature ]; then signature=\"$2\"; fi\n" +
+		"  shift\n" +
+		"done\n" +
+		"cp \"$1\" \"$signature\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "cosign"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake cosign: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+`
+	signature := filepath.Join(t.TempDir(), "output.sig")
+	renderer := &KustomizePostRenderer{Options: options.Options{Signature: signature, SignKey: "env://SIGNING_KEY", Output: options.OutputJSON}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	signed, err := os.ReadFile(signature)
+	if err != nil {
+		t.Fatalf("Failed to read signature: %v", err)
+	}
+	if string(signed) != output.String() {
+		t.Errorf("Signed %q, want the final output %q", signed, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_AllowedNamespaces(t *testing.T) {
+	newInput := func(namespace string) string {
+		return `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namespace: ` + namespace + `
+`
+	}
+
+	tests := []struct {
+		name          string
+		input         string
+		wantErrSubstr string
+	}{
+		{name: "allowed namespace", input: newInput("team-a")},
+		{name: "allowed pattern", input: newInput("team-b-staging")},
+		{name: "namespace outside the allowlist", input: newInput("kube-system"), wantErrSubstr: "ConfigMap/settings: namespace kube-system is not allowed"},
+		{
+			name:          "without plugin data",
+			input:         "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: default\n",
+			wantErrSubstr: "ConfigMap/settings: namespace default is not allowed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &KustomizePostRenderer{Options: options.Options{AllowedNamespaces: []string{"team-a", "team-b-*"}}}
+			_, err := renderer.Run(bytes.NewBufferString(tt.input))
+			if tt.wantErrSubstr == "" {
+				if err != nil {
+					t.Errorf("Run() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Fatalf("Run() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+			if code := errdefs.ExitCode(err); code != errdefs.ExitPolicy {
+				t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitPolicy)
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_GuardClusterScoped(t *testing.T) {
+	input := `---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: chart-reader
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+      - webhook.yaml
+    patches:
+      - target:
+          kind: ConfigMap
+        patch: |
+          - op: add
+            path: /data
+            value: {mode: prod}
+  webhook.yaml: |
+    apiVersion: admissionregistration.k8s.io/v1
+    kind: MutatingWebhookConfiguration
+    metadata:
+      name: injector
+`
+
+	t.Run("error", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{GuardClusterScoped: options.ValidationError}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		want := "cluster-scoped resources added or changed by the kustomization:\n  MutatingWebhookConfiguration/injector: MutatingWebhookConfiguration is a cluster-scoped kind"
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("Run() error = %v, want error containing %q", err, want)
+		}
+		// The ClusterRole of the chart is left alone
+		if strings.Contains(err.Error(), "ClusterRole") {
+			t.Errorf("Run() error = %v, want the unchanged ClusterRole not reported", err)
+		}
+		if code := errdefs.ExitCode(err); code != errdefs.ExitPolicy {
+			t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitPolicy)
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Options: options.Options{GuardClusterScoped: options.ValidationWarn}, Stderr: &stderr}
+		if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(stderr.String(), "cluster-scoped resource added or changed: MutatingWebhookConfiguration/injector") {
+			t.Errorf("stderr = %q, want a warning about the webhook", stderr.String())
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_CheckImmutable(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: nginx
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namespace: prod
+    labels:
+      - pairs:
+          team: payments
+        includeSelectors: true
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{CheckImmutable: options.ValidationError}}
+	_, err := renderer.Run(bytes.NewBufferString(input))
+	want := `Deployment/web: spec.selector is immutable, but changed from {"matchLabels":{"app":"web"}} to {"matchLabels":{"app":"web","team":"payments"}}`
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("Run() error = %v, want error containing %q", err, want)
+	}
+	if code := errdefs.ExitCode(err); code != errdefs.ExitValidation {
+		t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitValidation)
+	}
+
+	// Labels that leave selectors alone pass
+	renderer = &KustomizePostRenderer{Options: options.Options{CheckImmutable: options.ValidationError}}
+	if _, err := renderer.Run(bytes.NewBufferString(strings.Replace(input, "includeSelectors: true", "includeSelectors: false", 1))); err != nil {
+		t.Errorf("Run() error = %v, want nil", err)
+	}
+}
+
+func TestKustomizePostRenderer_Run_CheckRollback(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: nginx
+          envFrom:
+            - configMapRef:
+                name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    labels:
+      - pairs:
+          team: payments
+        includeSelectors: true
+    configMapGenerator:
+      - name: settings
+        literals:
+          - level=info
+`
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Options: options.Options{CheckRollback: true}, Stderr: &stderr}
+	if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	for _, want := range []string{
+		`unsafe to roll back: Deployment/web: spec.selector changed from {"matchLabels":{"app":"web"}} to {"matchLabels":{"app":"web","team":"payments"}}`,
+		"consumed by Deployment/web; the next upgrade with other content deletes it",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Expected %q on stderr, got:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestKustomizePostRenderer_Run_TenantPrefix(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: nginx
+          envFrom:
+            - configMapRef:
+                name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{TenantPrefix: "team-a-"}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	rendered, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v", err)
+	}
+	for _, resource := range rendered.OtherResources {
+		metadata := resource["metadata"].(map[string]any)
+		if !strings.HasPrefix(metadata["name"].(string), "team-a-") || metadata["namespace"] != "team-a" {
+			t.Errorf("Expected %s in namespace team-a with the prefix, got %v", resource["kind"], metadata)
+		}
+		if labels, _ := metadata["labels"].(map[string]any); labels[kustomize.TenantLabel] != "team-a" {
+			t.Errorf("Expected the tenant label on %s, got %v", resource["kind"], labels)
+		}
+	}
+	if !strings.Contains(output.String(), "name: team-a-settings") || strings.Contains(output.String(), "name: settings") {
+		t.Errorf("Expected the ConfigMap reference rewritten, got:\n%s", output.String())
+	}
+
+	// Kustomize does not rewrite the references of kinds it does not know
+	rollout := strings.NewReplacer("apiVersion: apps/v1", "apiVersion: argoproj.io/v1alpha1", "kind: Deployment", "kind: Rollout").Replace(input)
+	renderer = &KustomizePostRenderer{Options: options.Options{TenantPrefix: "team-a-"}}
+	_, err = renderer.Run(bytes.NewBufferString(rollout))
+	want := `Rollout/team-a-web: references ConfigMap "settings", which the tenant prefix renamed to "team-a-settings"`
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("Run() error = %v, want error containing %q", err, want)
+	}
+	if code := errdefs.ExitCode(err); code != errdefs.ExitValidation {
+		t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitValidation)
+	}
+}
+
+func TestKustomizePostRenderer_Run_ReleaseInfo(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+release:
+  name: web
+  namespace: prod
+  revision: 3
+  appVersion: "1.10"
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+    replacements:
+      - source:
+          kind: ConfigMap
+          name: release-info
+          fieldPath: data.revision
+        targets:
+          - select:
+              kind: Deployment
+            fieldPaths:
+              - metadata.annotations.release-revision
+            options:
+              create: true
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{CheckCount: true}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	want := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    release-revision: "3"
+  name: prod-web
+`
+	if output.String() != want {
+		t.Errorf("Run() output =\n%s\nwant =\n%s", output.String(), want)
+	}
+
+	// The release info file is reserved
+	reserved := strings.Replace(input, "  kustomization.yaml: |", "  release-info.yaml: \"\"\n  kustomization.yaml: |", 1)
+	renderer = &KustomizePostRenderer{}
+	if _, err := renderer.Run(bytes.NewBufferString(reserved)); err == nil || !strings.Contains(err.Error(), "reserved for the release info") {
+		t.Errorf("Run() error = %v, want error containing %q", err, "reserved for the release info")
+	}
+}
+
+func TestKustomizePostRenderer_Run_HelmCharts(t *testing.T) {
+	// The fake helm inflates every chart to a ConfigMap named after it
+	helmBin := filepath.Join(t.TempDir(), "helm")
+	script := `#!/bin/sh
+case "$1" in
+  version) echo v3.15.0 ;;
+  template) printf 'apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: agent\n' ;;
+esac
+`
+	if err := os.WriteFile(helmBin, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake helm: %v", err)
+	}
+	t.Setenv("HELM_BIN", helmBin)
+
+	newInput := func(chart, base string) string {
+		return `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+` + base + `    helmCharts:
+` + chart + `
+  charts/agent/Chart.yaml: |
+    apiVersion: v2
+    name: agent
+    version: 1.0.0
+`
+	}
+	local := "      - name: agent"
+	remote := "      - name: agent\n        repo: https://charts.example.com\n        version: 1.0.0"
+
+	tests := []struct {
+		name  string
+		opts  options.Options
+		chart string
+		// base is an additional resources entry of the kustomization
+		base     string
+		wantErr  string
+		wantCode int
+	}{
+		{name: "local chart", opts: options.Options{EnableHelm: true}, chart: local},
+		{name: "helm not enabled", chart: local, wantErr: "requires --enable-helm", wantCode: errdefs.ExitPluginData},
+		{name: "local chart missing", opts: options.Options{EnableHelm: true}, chart: "      - name: exporter", wantErr: "chart exporter of kustomization.yaml has no repo and is not in the files at charts/exporter/Chart.yaml", wantCode: errdefs.ExitPluginData},
+		{name: "repository not allowed", opts: options.Options{EnableHelm: true}, chart: remote, wantErr: "chart agent 1.0.0 from https://charts.example.com (kustomization.yaml)", wantCode: errdefs.ExitPolicy},
+		{name: "remote base", opts: options.Options{EnableHelm: true}, chart: local, base: "      - github.com/org/charts//agent?ref=main\n", wantErr: "has remote bases, whose helmCharts cannot be checked against allowedChartRepos:\n  github.com/org/charts//agent?ref=main", wantCode: errdefs.ExitPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &KustomizePostRenderer{Options: tt.opts}
+			output, err := renderer.Run(bytes.NewBufferString(newInput(tt.chart, tt.base)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				if code := errdefs.ExitCode(err); code != tt.wantCode {
+					t.Errorf("ExitCode() = %d, want %d", code, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if !strings.Contains(output.String(), "kind: ConfigMap\nmetadata:\n  name: agent") {
+				t.Errorf("Expected the inflated chart in the output, got:\n%s", output.String())
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_Deduplicate(t *testing.T) {
+	// The ConfigMap is passed through by the second pipeline and added again by a resource of its
+	// kustomization
+	newInput := func(level string) string {
+		return `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    commonAnnotations:
+      team: payments
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  level: info
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: overlay
+excludeKinds: [ConfigMap]
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+      - settings.yaml
+  settings.yaml: |
+    apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: settings
+      annotations:
+        team: payments
+    data:
+      level: ` + level + `
+`
+	}
+
+	t.Run("identical resources", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{}
+		output, err := renderer.Run(bytes.NewBufferString(newInput("info")))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if count := strings.Count(output.String(), "name: settings"); count != 1 {
+			t.Errorf("Expected the ConfigMap once, found %d times in:\n%s", count, output.String())
+		}
+	})
+
+	t.Run("diverging resources", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{}
+		_, err := renderer.Run(bytes.NewBufferString(newInput("debug")))
+		if err == nil {
+			t.Fatal("Run() error = nil, want an error")
+		}
+		for _, want := range []string{
+			`pipeline "overlay": the build outputs ConfigMap/settings twice with different content`,
+			"--- base/ConfigMap/settings\n+++ second/ConfigMap/settings\n",
+			"-  level: info\n+  level: debug\n",
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Run() error = %v, want error containing %q", err, want)
+			}
+		}
+		if code := errdefs.ExitCode(err); code != errdefs.ExitBuild {
+			t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitBuild)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_PassThroughFilters(t *testing.T) {
+	resources := `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+  labels:
+    app.kubernetes.io/component: crds
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-upgrade
+`
+	newInput := func(filters string) string {
+		return resources + `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+` + filters + `
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+`
+	}
+
+	tests := []struct {
+		name      string
+		filters   string
+		want      []string
+		wantNames []string
+	}{
+		{
+			name:      "exclude kinds",
+			filters:   "excludeKinds: [CustomResourceDefinition, Job]",
+			wantNames: []string{"widgets.example.com", "prod-settings", "migrate"},
+		},
+		{
+			name:      "include kinds",
+			filters:   "includeKinds: [Job]",
+			wantNames: []string{"widgets.example.com", "settings", "prod-migrate"},
+		},
+		{
+			name:      "exclude selectors",
+			filters:   "exclude:\n  selector: app.kubernetes.io/component=crds\n  annotationSelector: helm.sh/hook",
+			wantNames: []string{"widgets.example.com", "prod-settings", "migrate"},
+		},
+		{
+			name:      "everything passed through",
+			filters:   "includeKinds: [Deployment]",
+			wantNames: []string{"widgets.example.com", "settings", "migrate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderer := &KustomizePostRenderer{}
+			output, err := renderer.Run(bytes.NewBufferString(newInput(tt.filters)))
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+
+			result, err := parser.ParseManifests(output.Bytes())
+			if err != nil {
+				t.Fatalf("Failed to parse output: %v", err)
+			}
+			var names []string
+			for _, resource := range result.OtherResources {
+				names = append(names, manifest.IDOf(resource).Name)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("Output names = %v, want %v\n%s", names, tt.wantNames, output.String())
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_Generated(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      volumes:
+      - name: settings
+        configMap:
+          name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+generated:
+  placement: adjacent
+  annotate: true
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    configMapGenerator:
+      - name: settings
+        literals:
+          - mode=prod
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	result, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+	var kinds []string
+	for _, resource := range result.OtherResources {
+		kinds = append(kinds, manifest.IDOf(resource).Kind)
+	}
+	// kustomize puts ConfigMaps first, adjacent placement moves it right before the Deployment
+	if want := []string{"Service", "ConfigMap", "Deployment"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("Output kinds = %v, want %v\n%s", kinds, want, output.String())
+	}
+	if !strings.Contains(output.String(), "helm.plugin.kustomize/generated: \"true\"") {
+		t.Errorf("Generated ConfigMap is not annotated:\n%s", output.String())
+	}
+	if strings.Count(output.String(), "helm.plugin.kustomize/generated") != 1 {
+		t.Errorf("Only the generated ConfigMap should be annotated:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_GeneratorOptions(t *testing.T) {
+	// The plugin labels and --set-image rewrite the kustomization, which must keep generatorOptions
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        envFrom:
+        - configMapRef:
+            name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+labels:
+  pairs:
+    team: web
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    generatorOptions:
+      disableNameSuffixHash: true
+      immutable: true
+      labels:
+        generated-by: kustomize
+    configMapGenerator:
+      - name: settings
+        literals:
+          - mode=prod
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Images: []string{"nginx=:1.25"}}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	want := `apiVersion: v1
+data:
+  mode: prod
+immutable: true
+kind: ConfigMap
+metadata:
+  labels:
+    generated-by: kustomize
+    team: web
+  name: settings
+`
+	if !strings.HasPrefix(output.String(), want) {
+		t.Errorf("Output should start with the unhashed immutable ConfigMap:\n%s\nwant:\n%s", output.String(), want)
+	}
+	if !strings.Contains(output.String(), "image: nginx:1.25") {
+		t.Errorf("Image override missing:\n%s", output.String())
+	}
+	if strings.Contains(output.String(), "settings-") {
+		t.Errorf("ConfigMap name should not have a hash suffix:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_InvalidKustomization(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    images:
+      - name: nginx
+        newTag: 1.25
+    replicas:
+      - count: 2
+`
+
+	// The plugin data overrides are merged before validation
+	renderer := &KustomizePostRenderer{Options: options.Options{Images: []string{"redis=:7"}}}
+	_, err := renderer.Run(bytes.NewBufferString(input))
+	if err == nil {
+		t.Fatal("Run() error = nil, want error")
+	}
+	if code := errdefs.ExitCode(err); code != errdefs.ExitPluginData {
+		t.Errorf("ExitCode() = %d, want %d (error %v)", code, errdefs.ExitPluginData, err)
+	}
+	for _, want := range []string{
+		"images[0].newTag: must be of type string, got number (value: 1.25)",
+		"replicas[0].name: is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() error = %v, want error containing %q", err, want)
+		}
+	}
+}
+
+func TestMergePassthrough(t *testing.T) {
+	doc := func(kind, name string) []byte {
+		return []byte("apiVersion: v1\nkind: " + kind + "\nmetadata:\n  name: " + name + "\n")
+	}
+	input, err := parser.ParseManifests(parser.JoinDocuments([][]byte{
+		doc("Deployment", "web"), doc("ConfigMap", "settings"), doc("ServiceAccount", "web"), doc("Secret", "token"),
+	}))
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name        string
+		output      [][]byte
+		passthrough map[int][]byte
+		want        [][]byte
+	}{
+		{
+			// kustomize sorts the ServiceAccount first and renames the resources
+			name:        "input order",
+			output:      [][]byte{doc("ServiceAccount", "prod-web"), doc("Deployment", "prod-web"), doc("ConfigMap", "generated")},
+			passthrough: map[int][]byte{1: doc("ConfigMap", "settings"), 3: doc("Secret", "token")},
+			want:        [][]byte{doc("Deployment", "prod-web"), doc("ConfigMap", "settings"), doc("ServiceAccount", "prod-web"), doc("Secret", "token"), doc("ConfigMap", "generated")},
+		},
+		{
+			name:        "generated before a built resource",
+			output:      [][]byte{doc("ConfigMap", "generated"), doc("ServiceAccount", "web"), doc("Deployment", "web")},
+			passthrough: map[int][]byte{1: doc("ConfigMap", "settings"), 3: doc("Secret", "token")},
+			want:        [][]byte{doc("Deployment", "web"), doc("ConfigMap", "settings"), doc("ConfigMap", "generated"), doc("ServiceAccount", "web"), doc("Secret", "token")},
+		},
+		{
+			name:        "nothing built",
+			passthrough: map[int][]byte{0: doc("Deployment", "web"), 1: doc("ConfigMap", "settings"), 2: doc("ServiceAccount", "web"), 3: doc("Secret", "token")},
+			want:        [][]byte{doc("Deployment", "web"), doc("ConfigMap", "settings"), doc("ServiceAccount", "web"), doc("Secret", "token")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergePassthrough(parser.JoinDocuments(tt.output), input, tt.passthrough)
+			if err != nil {
+				t.Fatalf("mergePassthrough() error = %v, want nil", err)
+			}
+			if want := parser.JoinDocuments(tt.want); string(got) != string(want) {
+				t.Errorf("mergePassthrough() =\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_PassThroughOrder(t *testing.T) {
+	// kustomize outputs the ServiceAccount before the Deployment
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+excludeKinds: [ConfigMap]
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+`
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	result, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		t.Fatalf("ParseManifests() error = %v, want nil", err)
+	}
+	var got []string
+	for _, resource := range result.OtherResources {
+		got = append(got, manifest.IDOf(resource).String())
+	}
+	want := []string{"Deployment.apps/prod-web", "ConfigMap/settings", "ServiceAccount/prod-web"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() resources = %v, want %v", got, want)
+	}
+}
+
+func TestKustomizePostRenderer_Run_Strict(t *testing.T) {
+	// commonLabels is deprecated, so kustomize reports a warning
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    commonLabels:
+      app: test
+`
+
+	t.Run("warnings are reported", func(t *testing.T) {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Stderr: &stderr}
+		if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(stderr.String(), "WARNING: 1 warning(s) during render:\n  - kustomize: 'commonLabels' is deprecated") {
+			t.Errorf("Expected warning block on stderr, got:\n%s", stderr.String())
+		}
+	})
+
+	t.Run("strict mode fails", func(t *testing.T) {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Options: options.Options{Strict: true}, Stderr: &stderr}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if err == nil || !strings.Contains(err.Error(), "1 warning(s) reported in strict mode") {
+			t.Errorf("Expected strict mode error, got: %v", err)
+		}
+		if !strings.Contains(stderr.String(), "'commonLabels' is deprecated") {
+			t.Errorf("Expected the warning on stderr, got:\n%s", stderr.String())
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_UnmatchedPatchTarget(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - path: replicas.yaml
+        target:
+          kind: Deployment
+          name: wbe
+  replicas.yaml: |
+    - op: add
+      path: /spec/replicas
+      value: 3
+`
+	warning := "patches[0] (replicas.yaml): target kind Deployment, name wbe matches no resource"
+
+	t.Run("warns", func(t *testing.T) {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Stderr: &stderr}
+		if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(stderr.String(), "  - "+warning) {
+			t.Errorf("stderr = %q, want warning %q", stderr.String(), warning)
+		}
+	})
+
+	t.Run("strict mode fails", func(t *testing.T) {
+		renderer := &KustomizePostRenderer{Options: options.Options{Strict: true}, Stderr: &bytes.Buffer{}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if err == nil || !strings.Contains(err.Error(), "1 warning(s) reported in strict mode") {
+			t.Errorf("Run() error = %v, want error containing %q", err, "1 warning(s) reported in strict mode")
+		}
+	})
+
+	t.Run("other resources are not checked", func(t *testing.T) {
+		extra := strings.Replace(input, "      - all.yaml\n", "      - all.yaml\n      - wbe.yaml\n", 1) + `  wbe.yaml: |
+    apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: wbe
+    spec: {}
+`
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Stderr: &stderr}
+		if _, err := renderer.Run(bytes.NewBufferString(extra)); err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if strings.Contains(stderr.String(), warning) {
+			t.Errorf("stderr = %q, want no warning about the patch target", stderr.String())
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_InvalidJSONPatch(t *testing.T) {
+	input := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - target:
+          kind: Deployment
+        patch: |-
+          - op: replace
+            path: spec/replicas
+            value: 3
+`
+
+	renderer := &KustomizePostRenderer{}
+	_, err := renderer.Run(bytes.NewBufferString(input))
+	want := "invalid JSON 6902 patches in kustomization.yaml:\n  line 8: patches[0].patch[0].path: must be a JSON pointer starting with /, got \"spec/replicas\""
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("Run() error = %v, want error containing %q", err, want)
+	}
+	if code := errdefs.ExitCode(err); code != errdefs.ExitPluginData {
+		t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitPluginData)
+	}
+}
+
+func TestKustomizePostRenderer_Run_ExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  options.Options
+		files string
+		want  int
+	}{
+		{
+			name:  "reserved file",
+			files: "  all.yaml: \"\"\n",
+			want:  errdefs.ExitPluginData,
+		},
+		{
+			name:  "invalid kustomization",
+			files: "  kustomization.yaml: |\n    resources: all.yaml\n",
+			want:  errdefs.ExitPluginData,
+		},
+		{
+			name:  "build failure",
+			files: "  kustomization.yaml: |\n    resources:\n      - missing.yaml\n",
+			want:  errdefs.ExitBuild,
+		},
+		{
+			name:  "validation failure",
+			opts:  options.Options{Validate: options.ValidationError},
+			files: "  kustomization.yaml: |\n    resources:\n      - all.yaml\n    namePrefix: Invalid_\n",
+			want:  errdefs.ExitValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+` + tt.files
+
+			renderer := &KustomizePostRenderer{Options: tt.opts}
+			_, err := renderer.Run(bytes.NewBufferString(input))
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if got := errdefs.ExitCode(err); got != tt.want {
+				t.Errorf("ExitCode() = %d, want %d (error: %v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_RunContext_Cancelled(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	input := bytes.NewBufferString(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	renderer := &KustomizePostRenderer{}
+	_, err := renderer.RunContext(ctx, input)
+	if err == nil {
+		t.Fatal("Expected error for a cancelled context, got nil")
+	}
+	if got := errdefs.ExitCode(err); got != errdefs.ExitInterrupted {
+		t.Errorf("ExitCode() = %d, want %d (error: %v)", got, errdefs.ExitInterrupted, err)
+	}
+
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatalf("Failed to read temp directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the temp directory to be removed, found %d entries", len(entries))
+	}
+}
+
+func TestKustomizePostRenderer_Run_Panic(t *testing.T) {
+	// A nil buffer makes the parser panic; Run must report it as an error instead
+	renderer := &KustomizePostRenderer{Stderr: &bytes.Buffer{}}
+	_, err := renderer.Run(nil)
+	if err == nil || !strings.Contains(err.Error(), "internal error") {
+		t.Errorf("Expected internal error, got: %v", err)
+	}
+}
+
+func BenchmarkKustomizePostRenderer_Run(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		var input strings.Builder
+		for i := range n {
+			fmt.Fprintf(&input, `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-%d
+data:
+  key: value
+`, i)
+		}
+		input.WriteString(`---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    apiVersion: kustomize.config.k8s.io/v1beta1
+    kind: Kustomization
+    resources:
+      - all.yaml
+    commonAnnotations:
+      team: platform
+`)
+		data := input.String()
+
+		b.Run(fmt.Sprintf("docs=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			renderer := &KustomizePostRenderer{Stderr: io.Discard}
+			for b.Loop() {
+				if _, err := renderer.Run(bytes.NewBufferString(data)); err != nil {
+					b.Fatalf("Run() error = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_KyvernoPolicies(t *testing.T) {
+	// The fake kyverno records the policy files it was given and adds a label to the ConfigMap,
+	// or fails like a violated validation rule
+	newKyverno := func(t *testing.T, exitCode string) string {
+		dir := t.TempDir()
+		script := "#!/bin/sh\n" +
+			"shift\n" +
+			"while [ $# -gt 0 ]; do\n" +
+			"  case \"$1\" in\n" +
+			"  --resource) shift ;;\n" +
+			"  --output) printf 'apiVersion: v1\\nkind: ConfigMap\\nmetadata:\\n  name: test-configmap\\n  labels:\\n    team: platform\\n' > \"$2\"; shift ;;\n" +
+			"  *) cat \"$1\" >> \"" + filepath.Join(dir, "policies") + "\" ;;\n" +
+			"  esac\n" +
+			"  shift\n" +
+			"done\n" +
+			"echo 'policy require-team -> resource default/ConfigMap/test-configmap failed'\n" +
+			"exit " + exitCode + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "kyverno"), []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to write fake kyverno: %v", err)
+		}
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		return dir
+	}
+
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+kyvernoPolicies:
+- policies/add-team.yaml
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+  policies/add-team.yaml: |
+    kind: ClusterPolicy
+`
+
+	t.Run("mutates output", func(t *testing.T) {
+		dir := newKyverno(t, "0")
+		renderer := &KustomizePostRenderer{Options: options.Options{}}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(output.String(), "team: platform") {
+			t.Errorf("Expected mutated ConfigMap, got:\n%s", output.String())
+		}
+
+		policies, err := os.ReadFile(filepath.Join(dir, "policies"))
+		if err != nil {
+			t.Fatalf("Failed to read policies passed to kyverno: %v", err)
+		}
+		if string(policies) != "kind: ClusterPolicy\n" {
+			t.Errorf("kyverno policies = %q, want the policy from the files map", policies)
+		}
+	})
+
+	t.Run("failed rules", func(t *testing.T) {
+		newKyverno(t, "1")
+		renderer := &KustomizePostRenderer{Options: options.Options{}}
+		_, err := renderer.Run(bytes.NewBufferString(input))
+		if err == nil {
+			t.Fatal("Run() error = nil, want policy violation")
+		}
+		if code := errdefs.ExitCode(err); code != errdefs.ExitPolicy {
+			t.Errorf("ExitCode() = %d, want %d", code, errdefs.ExitPolicy)
+		}
+		if !strings.Contains(err.Error(), "require-team") {
+			t.Errorf("Expected kyverno report in error, got: %v", err)
+		}
+	})
+}
+
+func TestKustomizePostRenderer_Run_Pipelines(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: fast
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: tenant
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - path: mode.yaml
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: base-
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: tenant
+files:
+  mode.yaml: |
+    apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: base-settings
+    data:
+      mode: safe
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	// The tenant pipeline runs after the unnamed one and patches the resource it renamed
+	expected := `apiVersion: v1
+data:
+  mode: safe
+kind: ConfigMap
+metadata:
+  name: base-settings
+`
+	if output.String() != expected {
+		t.Errorf("Output mismatch.\nExpected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_PipelineError(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: tenant
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+      - missing.yaml
+`
+
+	renderer := &KustomizePostRenderer{}
+	_, err := renderer.Run(bytes.NewBufferString(input))
+	if err == nil || !strings.Contains(err.Error(), `pipeline "tenant"`) {
+		t.Fatalf("Run() error = %v, want error containing %q", err, `pipeline "tenant"`)
+	}
+	if errdefs.ExitCode(err) != errdefs.ExitBuild {
+		t.Errorf("ExitCode() = %d, want %d", errdefs.ExitCode(err), errdefs.ExitBuild)
+	}
+}
+
+func TestKustomizePostRenderer_Run_PipelineErrors(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: a-broken
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+      - missing.yaml
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: b-working
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: tenant-
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: c-invalid
+files:
+  kustomization.yaml: |
+    resources: all.yaml
+`
+
+	var stderr bytes.Buffer
+	renderer := &KustomizePostRenderer{Options: options.Options{Debug: true}, Stderr: &stderr}
+	_, err := renderer.Run(bytes.NewBufferString(input))
+	if err == nil {
+		t.Fatal("Run() error = nil, want the errors of both failing pipelines")
+	}
+	for _, want := range []string{"2 of 3 pipelines failed", `pipeline "a-broken"`, `pipeline "c-invalid"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() error = %v, want error containing %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), `pipeline "b-working"`) {
+		t.Errorf("Run() error = %v, want no error for the working pipeline", err)
+	}
+	if !strings.Contains(stderr.String(), `building pipeline "b-working"`) {
+		t.Errorf("Expected the working pipeline to be built after the failed one, got:\n%s", stderr.String())
+	}
+	// Categories keep their precedence, and invalid plugin data comes before failed builds
+	if errdefs.ExitCode(err) != errdefs.ExitPluginData {
+		t.Errorf("ExitCode() = %d, want %d", errdefs.ExitCode(err), errdefs.ExitPluginData)
+	}
+}
+
+func TestKustomizePostRenderer_Run_FileConflicts(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+# Source: web/templates/kustomize.yaml
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: chart-
+---
+# Source: web/templates/override.yaml
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: override-
+`
+
+	renderer := &KustomizePostRenderer{}
+	_, err := renderer.Run(bytes.NewBufferString(input))
+	wantErr := "set by both web/templates/kustomize.yaml and web/templates/override.yaml"
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Fatalf("Run() error = %v, want error containing %q", err, wantErr)
+	}
+
+	renderer = &KustomizePostRenderer{Options: options.Options{FileConflicts: options.FileConflictsLastWins}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if !strings.Contains(output.String(), "name: override-settings") {
+		t.Errorf("Expected the kustomization of the last document, got:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_ReleaseSize(t *testing.T) {
+	// Random data does not compress, so the release outgrows its Secret
+	blob := make([]byte, 640<<10)
+	if _, err := rand.Read(blob); err != nil {
+		t.Fatalf("Failed to generate random data: %v", err)
+	}
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+  blob.txt: ` + hex.EncodeToString(blob) + "\n"
+
+	tests := []struct {
+		name        string
+		driver      string
+		wantWarning bool
+	}{
+		{name: "secret driver", driver: "secret", wantWarning: true},
+		{name: "sql driver", driver: "sql", wantWarning: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HELM_DRIVER", tt.driver)
+			var stderr bytes.Buffer
+			renderer := &KustomizePostRenderer{Stderr: &stderr}
+			if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if got := strings.Contains(stderr.String(), "over the 1024KiB a Kubernetes Secret can hold"); got != tt.wantWarning {
+				t.Errorf("Expected release size warning = %v, got stderr:\n%s", tt.wantWarning, stderr.String())
+			}
+		})
+	}
+}
+
+func TestKustomizePostRenderer_Run_BinaryFiles(t *testing.T) {
+	input := `---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    configMapGenerator:
+      - name: assets
+        files:
+          - logo.png
+          - icon.bin
+    generatorOptions:
+      disableNameSuffixHash: true
+  logo.png:
+    encoding: base64
+    content: iVBORw0KGgo=
+  icon.bin: !!binary AAEC/w==
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	// kustomize puts files that are not UTF-8 into binaryData, encoded as base64 again
+	for _, want := range []string{"binaryData:", "icon.bin: AAEC/w==", "logo.png: iVBORw0KGgo="} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("Expected %q in output, got:\n%s", want, output.String())
+		}
+	}
+}
+
+func TestKustomizePostRenderer_Run_V2Files(t *testing.T) {
+	input := `---
+apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files:
+  kustomization.yaml:
+    content: |
+      resources:
+        - all.yaml
+      configMapGenerator:
+        - name: scripts
+          files:
+            - migrate.sh
+      generatorOptions:
+        disableNameSuffixHash: true
+    generated-by: templates/kustomize.yaml
+  migrate.sh:
+    content: |
+      #!/bin/sh
+    mode: 0755
+`
+
+	renderer := &KustomizePostRenderer{}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if !strings.Contains(output.String(), "migrate.sh: |") {
+		t.Errorf("Expected the migrate.sh entry in output, got:\n%s", output.String())
+	}
+}
+
+func TestKustomizePostRenderer_Run_V2Overlays(t *testing.T) {
+	// The overlay is selected by name, and patches it from outside its directory, which only the
+	// LoadRestrictionsNone build option allows
+	input := `---
+apiVersion: helm.plugin.kustomize/v2
+kind: KustomizePluginData
+files:
+  shared/replicas.yaml: |
+    apiVersion: apps/v1
+    kind: Deployment
+    metadata:
+      name: web
+    spec:
+      replicas: 5
+  overlays/production/kustomization.yaml: |
+    resources:
+      - all.yaml
+    patches:
+      - path: ../../shared/replicas.yaml
+overlays:
+  prod: overlays/production
+buildOptions:
+  loadRestrictor: LoadRestrictionsNone
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+        - name: web
+          image: nginx
+`
+
+	renderer := &KustomizePostRenderer{Options: options.Options{Overlay: "prod"}}
+	output, err := renderer.Run(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if !strings.Contains(output.String(), "replicas: 5") {
+		t.Errorf("Expected the shared patch in output, got:\n%s", output.String())
+	}
+}
+
+func TestApplyFileModes(t *testing.T) {
+	tempDir, err := extractor.NewTempDir()
+	if err != nil {
+		t.Fatalf("NewTempDir() error = %v, want nil", err)
+	}
+	defer tempDir.Cleanup()
+	entries := map[string]parser.File{
+		"kustomization.yaml": {Content: "resources: []\n"},
+		"bin/render.sh":      {Content: "#!/bin/sh\n", Mode: 0750},
+	}
+	if err := tempDir.ExtractFiles(map[string]string{"kustomization.yaml": "resources: []\n", "bin/render.sh": "#!/bin/sh\n"}); err != nil {
+		t.Fatalf("ExtractFiles() error = %v, want nil", err)
+	}
+
+	if err := applyFileModes(tempDir, entries); err != nil {
+		t.Fatalf("applyFileModes() error = %v, want nil", err)
+	}
+	for path, want := range map[string]os.FileMode{"kustomization.yaml": 0644, "bin/render.sh": 0750} {
+		info, err := os.Stat(filepath.Join(tempDir.Path, path))
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", path, err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("mode of %s = %v, want %v", path, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestKustomizePostRenderer_Run_WorkspaceCache(t *testing.T) {
+	// The kustomization lacks all.yaml, so each render writes the composed one over the snapshot's
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namePrefix: prod-
+`
+	cache := t.TempDir()
+
+	var outputs []string
+	for _, want := range []string{"saved 1 files", "restored 1 files"} {
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Options: options.Options{WorkspaceCache: cache, Debug: true}, Stderr: &stderr}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Expected stderr to contain %q, got:\n%s", want, stderr.String())
+		}
+		outputs = append(outputs, output.String())
+	}
+
+	if outputs[1] != outputs[0] {
+		t.Errorf("Restored render output = %q, want %q", outputs[1], outputs[0])
+	}
+	if !strings.Contains(outputs[0], "name: prod-settings") {
+		t.Errorf("Expected the kustomization to be applied, got:\n%s", outputs[0])
+	}
+
+	entries, err := os.ReadDir(cache)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir() = %v, %v, want one snapshot", entries, err)
+	}
+	kustomization, err := os.ReadFile(filepath.Join(cache, entries[0].Name(), "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if string(kustomization) != "namePrefix: prod-\n" {
+		t.Errorf("snapshot kustomization.yaml = %q, want the plugin data file", kustomization)
+	}
+}
+
+func TestKustomizePostRenderer_Run_BuildCache(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namePrefix: prod-
+`
+	dir := t.TempDir()
+	render := func(input string) (string, string) {
+		t.Helper()
+		var stderr bytes.Buffer
+		renderer := &KustomizePostRenderer{Options: options.Options{BuildCache: dir, Debug: true}, Stderr: &stderr}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		return output.String(), stderr.String()
+	}
+
+	output, stderr := render(input)
+	if !strings.Contains(stderr, "saved the build") {
+		t.Errorf("Expected stderr to contain %q, got:\n%s", "saved the build", stderr)
+	}
+	if !strings.Contains(output, "name: prod-settings") {
+		t.Errorf("Expected the kustomization to be applied, got:\n%s", output)
+	}
+
+	// Replace the cached output, to tell a reused build from a new one
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir() = %v, %v, want one cached build", entries, err)
+	}
+	backend := &cache.Dir{Path: dir}
+	entry := &cache.Entry{Created: time.Now(), Output: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cached-settings\n")}
+	if err := cache.Store(context.Background(), backend, entries[0].Name(), entry); err != nil {
+		t.Fatalf("Store() error = %v, want nil", err)
+	}
+
+	output, stderr = render(input)
+	if !strings.Contains(stderr, "reused the build") {
+		t.Errorf("Expected stderr to contain %q, got:\n%s", "reused the build", stderr)
+	}
+	if !strings.Contains(output, "name: cached-settings") {
+		t.Errorf("Expected the cached build, got:\n%s", output)
+	}
+
+	// Other files are another build
+	output, _ = render(strings.Replace(input, "prod-", "staging-", 1))
+	if !strings.Contains(output, "name: staging-settings") {
+		t.Errorf("Expected a new build, got:\n%s", output)
+	}
+}
+
+func TestKustomizePostRenderer_BuildCacheKey_RemoteBases(t *testing.T) {
+	// The fake git lists the commit in the refs file, and fails without it
+	bin := t.TempDir()
+	refs := filepath.Join(t.TempDir(), "refs")
+	script := "#!/bin/sh\ncat \"" + refs + "\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "git"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake git: %v", err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources:\n- github.com/org/repo//deploy?ref=main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization: %v", err)
+	}
+	renderer := &KustomizePostRenderer{Options: options.Options{BuildCache: t.TempDir()}}
+	key := func(commit string) (string, error) {
+		t.Helper()
+		if err := os.WriteFile(refs, []byte(commit+"\trefs/heads/main\n"), 0644); err != nil {
+			t.Fatalf("Failed to write refs: %v", err)
+		}
+		_, key, err := renderer.buildCacheKey(context.Background(), dir, ".", nil, nil)
+		return key, err
+	}
+
+	first, err := key(strings.Repeat("a", 40))
+	if err != nil {
+		t.Fatalf("buildCacheKey() error = %v, want nil", err)
+	}
+	again, _ := key(strings.Repeat("a", 40))
+	if again != first {
+		t.Errorf("buildCacheKey() = %s, want %s for the same commit", again, first)
+	}
+	// A branch that moved is another build
+	moved, _ := key(strings.Repeat("b", 40))
+	if moved == first {
+		t.Errorf("buildCacheKey() = %s for another commit, want a new key", moved)
+	}
+
+	if err := os.Remove(refs); err != nil {
+		t.Fatalf("Failed to remove refs: %v", err)
+	}
+	if _, _, err := renderer.buildCacheKey(context.Background(), dir, ".", nil, nil); err == nil || !strings.Contains(err.Error(), "cannot pin remote base") {
+		t.Errorf("buildCacheKey() error = %v, want error containing %q", err, "cannot pin remote base")
+	}
+}
+
+func TestKustomizePostRenderer_BuildCacheKey_HelmCharts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte("resources:\n- all.yaml\n"), 0644); err != nil {
+		t.Fatalf("Failed to write kustomization: %v", err)
+	}
+	renderer := &KustomizePostRenderer{Options: options.Options{BuildCache: t.TempDir()}}
+
+	local := kustomize.HelmChart{File: "kustomization.yaml", Name: "agent", Home: "charts"}
+	if _, _, err := renderer.buildCacheKey(context.Background(), dir, ".", nil, []kustomize.HelmChart{local}); err != nil {
+		t.Errorf("buildCacheKey() error = %v, want nil for a local chart", err)
+	}
+
+	// A repository may serve another chart for the same version
+	remote := kustomize.HelmChart{File: "kustomization.yaml", Name: "agent", Repo: "https://charts.example.com", Version: "1.0.0", Home: "charts"}
+	want := "cannot pin chart agent 1.0.0 from https://charts.example.com of kustomization.yaml"
+	if _, _, err := renderer.buildCacheKey(context.Background(), dir, ".", nil, []kustomize.HelmChart{local, remote}); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("buildCacheKey() error = %v, want error containing %q", err, want)
+	}
+}
+
+func TestKustomizePostRenderer_Run_Attestation(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namePrefix: prod-
+`
+	path := filepath.Join(t.TempDir(), "inputs.json")
+	render := func(input string) (string, *attest.Manifest) {
+		t.Helper()
+		renderer := &KustomizePostRenderer{Options: options.Options{Attestation: path}, Stderr: io.Discard}
+		output, err := renderer.Run(bytes.NewBufferString(input))
+		if err != nil {
+			t.Fatalf("Run() error = %v, want nil", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read attestation: %v", err)
+		}
+		var inputs attest.Manifest
+		if err := json.Unmarshal(data, &inputs); err != nil {
+			t.Fatalf("Failed to decode attestation: %v", err)
+		}
+		return output.String(), &inputs
+	}
+
+	output, inputs := render(input)
+	digest, err := inputs.Digest()
+	if err != nil {
+		t.Fatalf("Digest() error = %v, want nil", err)
+	}
+	if !strings.Contains(output, attest.Annotation+": "+digest) {
+		t.Errorf("Expected the output to be annotated with %s, got:\n%s", digest, output)
+	}
+	if len(inputs.Pipelines) != 1 {
+		t.Fatalf("attestation has %d pipelines, want 1", len(inputs.Pipelines))
+	}
+	files := inputs.Pipelines[0].Files
+	if _, ok := files["kustomization.yaml"]; !ok {
+		t.Errorf("attestation files = %v, want the kustomization", files)
+	}
+	if _, ok := files["all.yaml"]; !ok {
+		t.Errorf("attestation files = %v, want the Helm manifests", files)
+	}
+
+	// The same inputs give the same digest, other inputs another one
+	if again, _ := render(input); again != output {
+		t.Errorf("Output of the same inputs = %q, want %q", again, output)
+	}
+	if other, _ := render(strings.Replace(input, "name: settings", "name: config", 1)); strings.Contains(other, digest) {
+		t.Errorf("Expected another digest for other Helm manifests, got:\n%s", other)
+	}
+}
+
+func TestKustomizePostRenderer_Run_Tracing(t *testing.T) {
+	var exported string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		exported = string(body)
+	}))
+	defer server.Close()
+
+	t.Setenv(tracing.EnvTracesEndpoint, server.URL)
+	t.Setenv(tracing.EnvTraceParent, "")
+	tracer, err := tracing.FromEnv("test")
+	if err != nil {
+		t.Fatalf("FromEnv() error = %v, want nil", err)
+	}
+
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+`
+	renderer := &KustomizePostRenderer{Tracer: tracer}
+	if _, err := renderer.Run(bytes.NewBufferString(input)); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if err := tracer.Export(context.Background()); err != nil {
+		t.Fatalf("Export() error = %v, want nil", err)
+	}
+
+	for _, name := range []string{"render", "parse", "extract", "build", "emit"} {
+		if !strings.Contains(exported, `"name":"`+name+`"`) {
+			t.Errorf("Expected a %s span, got:\n%s", name, exported)
+		}
+	}
+}
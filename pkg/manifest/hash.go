@@ -0,0 +1,57 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Hash returns the content hash of a YAML document, like HashOf for the resource it holds
+func Hash(doc []byte) (string, error) {
+	var resource map[string]any
+	if err := yaml.Unmarshal(doc, &resource); err != nil {
+		return "", fmt.Errorf("failed to parse document: %w", err)
+	}
+	return HashOf(resource)
+}
+
+// HashOf returns the content hash of a resource, e.g. "sha256:4c0f...". It is the SHA-256 of the
+// canonical encoding of the resource, so it ignores key order, formatting and comments, and
+// stays the same across releases for the same content.
+func HashOf(resource map[string]any) (string, error) {
+	data, err := Encode(resource)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode resource: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// ChangedSet returns the IDs of the resources of output whose content hash differs from that of
+// the resource with the same ID in input, including resources only present in output. The
+// resources of output whose ID is not in the set are unchanged.
+func ChangedSet(input, output []map[string]any) (map[ID]bool, error) {
+	hashes := make(map[ID]string, len(input))
+	for _, resource := range input {
+		hash, err := HashOf(resource)
+		if err != nil {
+			return nil, err
+		}
+		hashes[IDOf(resource)] = hash
+	}
+
+	changed := map[ID]bool{}
+	for _, resource := range output {
+		id := IDOf(resource)
+		hash, err := HashOf(resource)
+		if err != nil {
+			return nil, err
+		}
+		if original, ok := hashes[id]; !ok || original != hash {
+			changed[id] = true
+		}
+	}
+	return changed, nil
+}
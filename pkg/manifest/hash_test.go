@@ -0,0 +1,78 @@
+package manifest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	want, err := Hash([]byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  key: value\n"))
+	if err != nil {
+		t.Fatalf("Hash() error = %v, want nil", err)
+	}
+	if !strings.HasPrefix(want, "sha256:") || len(want) != len("sha256:")+64 {
+		t.Fatalf("Hash() = %q, want a sha256 hash", want)
+	}
+
+	tests := []struct {
+		name     string
+		doc      string
+		wantSame bool
+	}{
+		{
+			name:     "reordered keys, comments and formatting",
+			doc:      "# app settings\nkind: ConfigMap\napiVersion: v1\ndata: {key: value}\nmetadata:\n    name: app\n",
+			wantSame: true,
+		},
+		{
+			name:     "different value",
+			doc:      "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  key: other\n",
+			wantSame: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Hash([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Hash() error = %v, want nil", err)
+			}
+			if (got == want) != tt.wantSame {
+				t.Errorf("Hash() = %q, base hash %q, want same = %v", got, want, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestHash_Invalid(t *testing.T) {
+	if _, err := Hash([]byte("key: [")); err == nil || !strings.Contains(err.Error(), "failed to parse document") {
+		t.Errorf("Hash() error = %v, want error containing %q", err, "failed to parse document")
+	}
+}
+
+func TestChangedSet(t *testing.T) {
+	configMap := func(name, value string) map[string]any {
+		return map[string]any{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]any{"name": name},
+			"data":       map[string]any{"key": value},
+		}
+	}
+
+	input := []map[string]any{configMap("same", "a"), configMap("edited", "a"), configMap("removed", "a")}
+	output := []map[string]any{configMap("same", "a"), configMap("edited", "b"), configMap("added", "a")}
+
+	got, err := ChangedSet(input, output)
+	if err != nil {
+		t.Fatalf("ChangedSet() error = %v, want nil", err)
+	}
+	want := map[ID]bool{
+		{Kind: "ConfigMap", Name: "edited"}: true,
+		{Kind: "ConfigMap", Name: "added"}:  true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedSet() = %v, want %v", got, want)
+	}
+}
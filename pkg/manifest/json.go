@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// ToJSON converts the mapping documents of a multi-document YAML stream to values that encode
+// to JSON, e.g. with json.Marshal. Other documents, such as comment-only documents or text, are
+// skipped. Timestamps are kept as written instead of being reformatted, and non-string mapping
+// keys are converted to strings, as kubectl does.
+func ToJSON(data []byte) ([]map[string]any, error) {
+	var documents []map[string]any
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	for i := 1; ; i++ {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode document %d: %w", i, err)
+		}
+
+		if len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		value, err := jsonValue(node.Content[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert document %d: %w", i, err)
+		}
+		documents = append(documents, value.(map[string]any))
+	}
+
+	return documents, nil
+}
+
+// jsonValue converts a YAML node to a JSON-compatible value
+func jsonValue(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return jsonValue(node.Alias)
+	case yaml.MappingNode:
+		return jsonObject(node)
+	case yaml.SequenceNode:
+		items := make([]any, len(node.Content))
+		for i, item := range node.Content {
+			value, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = value
+		}
+		return items, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!str", "!!timestamp", "!!binary":
+		return node.Value, nil
+	case "!!null":
+		return nil, nil
+	}
+
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return nil, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	return value, nil
+}
+
+// jsonObject converts a YAML mapping node to a JSON object. Keys merged with "<<" are
+// overridden by the keys of the mapping itself.
+func jsonObject(node *yaml.Node) (map[string]any, error) {
+	object := make(map[string]any, len(node.Content)/2)
+	explicit := make(map[string]bool, len(node.Content)/2)
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		if key.ShortTag() == "!!merge" {
+			if err := mergeInto(object, explicit, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		converted, err := jsonValue(value)
+		if err != nil {
+			return nil, err
+		}
+		object[key.Value] = converted
+		explicit[key.Value] = true
+	}
+
+	return object, nil
+}
+
+// mergeInto adds the keys of the mapping, or sequence of mappings, merged by a "<<" key to
+// object, unless the object sets them itself
+func mergeInto(object map[string]any, explicit map[string]bool, node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	sources := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		sources = node.Content
+	}
+
+	for _, source := range sources {
+		merged, err := jsonValue(source)
+		if err != nil {
+			return err
+		}
+		mapping, ok := merged.(map[string]any)
+		if !ok {
+			return fmt.Errorf("line %d: merge key value must be a mapping", source.Line)
+		}
+		for key, value := range mapping {
+			if !explicit[key] {
+				if _, exists := object[key]; !exists {
+					object[key] = value
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package manifest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	input := `# Source: chart/templates/notes.txt
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: types
+  annotations: &annotations
+    created: 2024-01-02
+data:
+  string: "1"
+  binary: !!binary aGVsbG8=
+spec:
+  replicas: 3
+  ratio: 0.5
+  enabled: true
+  empty: null
+  ports:
+    80: web
+  copy: *annotations
+  merged:
+    <<: *annotations
+    extra: value
+---
+Thank you for installing the chart.
+---
+- a list
+`
+
+	documents, err := ToJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v, want nil", err)
+	}
+
+	got, err := json.Marshal(documents)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	want := `[{"apiVersion":"v1","data":{"binary":"aGVsbG8=","string":"1"},"kind":"ConfigMap",` +
+		`"metadata":{"annotations":{"created":"2024-01-02"},"name":"types"},` +
+		`"spec":{"copy":{"created":"2024-01-02"},"empty":null,"enabled":true,` +
+		`"merged":{"created":"2024-01-02","extra":"value"},"ports":{"80":"web"},"ratio":0.5,"replicas":3}}]`
+	if string(got) != want {
+		t.Errorf("ToJSON() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestToJSON_MergeOrder(t *testing.T) {
+	input := `base: &base
+  a: base
+  b: base
+other: &other
+  a: other
+  c: other
+merged:
+  a: explicit
+  <<: [*other, *base]
+`
+
+	documents, err := ToJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("ToJSON() error = %v, want nil", err)
+	}
+
+	merged := documents[0]["merged"].(map[string]any)
+	want := map[string]string{"a": "explicit", "b": "base", "c": "other"}
+	for key, value := range want {
+		if merged[key] != value {
+			t.Errorf("merged[%s] = %v, want %q", key, merged[key], value)
+		}
+	}
+}
+
+func TestToJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		wantErrSubstr string
+	}{
+		{
+			name:          "invalid YAML",
+			input:         "a: 1\n---\nb: [\n",
+			wantErrSubstr: "failed to decode document 2",
+		},
+		{
+			name:          "merge of a scalar",
+			input:         "a:\n  <<: text\n",
+			wantErrSubstr: "merge key value must be a mapping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ToJSON([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("ToJSON() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ID identifies a Kubernetes resource independently of its API version
+type ID struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// IDOf returns the ID of a parsed resource. Missing fields are left empty.
+func IDOf(resource map[string]any) ID {
+	apiVersion, _ := resource["apiVersion"].(string)
+	kind, _ := resource["kind"].(string)
+	metadata, _ := resource["metadata"].(map[string]any)
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+
+	group := ""
+	if before, _, found := strings.Cut(apiVersion, "/"); found {
+		group = before
+	}
+
+	return ID{Group: group, Kind: kind, Namespace: namespace, Name: name}
+}
+
+// String formats the ID as Kind[.group]/[namespace/]name, e.g. "Deployment.apps/prod/web"
+func (id ID) String() string {
+	var b strings.Builder
+	b.WriteString(id.Kind)
+	if id.Group != "" {
+		b.WriteString(".")
+		b.WriteString(id.Group)
+	}
+	b.WriteString("/")
+	if id.Namespace != "" {
+		b.WriteString(id.Namespace)
+		b.WriteString("/")
+	}
+	b.WriteString(id.Name)
+	return b.String()
+}
+
+// Encode marshals a single resource to YAML in DefaultStyle, the style kustomize emits
+func Encode(resource map[string]any) ([]byte, error) {
+	return Marshal(resource)
+}
+
+// Marshal marshals any value to YAML in DefaultStyle, e.g. a struct fixing the key order of a
+// generated document
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := DefaultStyle.newEncoder(&buf)
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, fmt.Errorf("failed to encode resource: %w", err)
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close encoder: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// EncodeAll encodes resources with Encode as a multi-document YAML stream
+func EncodeAll(resources []map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, resource := range resources {
+		data, err := Encode(resource)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,114 @@
+package manifest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIDOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource map[string]any
+		want     ID
+		wantStr  string
+	}{
+		{
+			name: "namespaced resource with group",
+			resource: map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]any{"name": "web", "namespace": "prod"},
+			},
+			want:    ID{Group: "apps", Kind: "Deployment", Namespace: "prod", Name: "web"},
+			wantStr: "Deployment.apps/prod/web",
+		},
+		{
+			name: "core resource without namespace",
+			resource: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata":   map[string]any{"name": "web"},
+			},
+			want:    ID{Kind: "Service", Name: "web"},
+			wantStr: "Service/web",
+		},
+		{
+			name:     "missing fields",
+			resource: map[string]any{},
+			want:     ID{},
+			wantStr:  "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := IDOf(tt.resource)
+			if got != tt.want {
+				t.Errorf("IDOf() = %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.wantStr {
+				t.Errorf("String() = %q, want %q", got.String(), tt.wantStr)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	data, err := Encode(map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "test"},
+		"data":       map[string]any{"key": "value"},
+	})
+	if err != nil {
+		t.Fatalf("Encode() error = %v, want nil", err)
+	}
+
+	want := `apiVersion: v1
+data:
+  key: value
+kind: ConfigMap
+metadata:
+  name: test
+`
+	if string(data) != want {
+		t.Errorf("Encode() output =\n%s\nwant =\n%s", string(data), want)
+	}
+}
+
+// failingMarshaler always fails to marshal to YAML
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalYAML() (any, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func TestEncode_Error(t *testing.T) {
+	_, err := Encode(map[string]any{"bad": failingMarshaler{}})
+	if err == nil || !strings.Contains(err.Error(), "failed to encode resource") {
+		t.Errorf("Expected encode error, got: %v", err)
+	}
+}
+
+func TestEncodeAll(t *testing.T) {
+	data, err := EncodeAll([]map[string]any{
+		{"kind": "ConfigMap", "metadata": map[string]any{"name": "a"}},
+		{"kind": "Secret", "metadata": map[string]any{"name": "b"}},
+	})
+	if err != nil {
+		t.Fatalf("EncodeAll() error = %v, want nil", err)
+	}
+
+	want := `kind: ConfigMap
+metadata:
+  name: a
+---
+kind: Secret
+metadata:
+  name: b
+`
+	if string(data) != want {
+		t.Errorf("EncodeAll() output =\n%s\nwant =\n%s", string(data), want)
+	}
+}
@@ -0,0 +1,30 @@
+package manifest
+
+import (
+	"maps"
+	"slices"
+)
+
+// podSpecPaths are the paths to the pod spec of the kinds that run containers
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// PodSpecPath returns the path to the pod spec of the resources of a kind, e.g.
+// spec.template.spec for a Deployment, and whether the kind has one
+func PodSpecPath(kind string) ([]string, bool) {
+	path, ok := podSpecPaths[kind]
+	return slices.Clone(path), ok
+}
+
+// PodSpecKinds returns the kinds with a pod spec, sorted
+func PodSpecKinds() []string {
+	return slices.Sorted(maps.Keys(podSpecPaths))
+}
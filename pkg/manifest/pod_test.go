@@ -0,0 +1,35 @@
+package manifest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPodSpecPath(t *testing.T) {
+	tests := []struct {
+		kind   string
+		want   []string
+		wantOK bool
+	}{
+		{kind: "Pod", want: []string{"spec"}, wantOK: true},
+		{kind: "Deployment", want: []string{"spec", "template", "spec"}, wantOK: true},
+		{kind: "CronJob", want: []string{"spec", "jobTemplate", "spec", "template", "spec"}, wantOK: true},
+		{kind: "Service", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			got, ok := PodSpecPath(tt.kind)
+			if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PodSpecPath() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPodSpecKinds(t *testing.T) {
+	want := []string{"CronJob", "DaemonSet", "Deployment", "Job", "Pod", "ReplicaSet", "ReplicationController", "StatefulSet"}
+	if got := PodSpecKinds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("PodSpecKinds() = %v, want %v", got, want)
+	}
+}
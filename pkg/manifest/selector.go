@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Selector is a parsed Kubernetes label selector, e.g. "app=web,tier in (frontend,backend),!canary"
+type Selector []Requirement
+
+// Requirement is a single requirement of a selector
+type Requirement struct {
+	Key string
+	// Operator is one of "=", "!=", "in", "notin", "exists" and "!"
+	Operator string
+	Values   []string
+}
+
+// ParseSelector parses a label selector in the syntax of kubectl --selector. The empty selector
+// matches everything.
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	for _, part := range splitRequirements(s) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("invalid selector %q: empty requirement", s)
+		}
+		req, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// splitRequirements splits a selector at the commas outside of value sets
+func splitRequirements(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parseRequirement(s string) (Requirement, error) {
+	if key, ok := strings.CutPrefix(s, "!"); ok {
+		return newRequirement(key, "!", nil)
+	}
+	for _, op := range []string{"!=", "==", "="} {
+		if key, value, ok := strings.Cut(s, op); ok {
+			return newRequirement(key, strings.TrimPrefix(op, "="), []string{strings.TrimSpace(value)})
+		}
+	}
+	if key, rest, ok := strings.Cut(s, " "); ok {
+		rest = strings.TrimSpace(rest)
+		for _, op := range []string{"notin", "in"} {
+			if set, ok := strings.CutPrefix(rest, op); ok {
+				set = strings.TrimSpace(set)
+				if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+					return Requirement{}, fmt.Errorf("values of %q must be in parentheses", key)
+				}
+				var values []string
+				for value := range strings.SplitSeq(set[1:len(set)-1], ",") {
+					values = append(values, strings.TrimSpace(value))
+				}
+				return newRequirement(key, op, values)
+			}
+		}
+		return Requirement{}, fmt.Errorf("unknown operator in %q", s)
+	}
+	return newRequirement(s, "exists", nil)
+}
+
+func newRequirement(key, op string, values []string) (Requirement, error) {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, " (),!=") {
+		return Requirement{}, fmt.Errorf("invalid key %q", key)
+	}
+	if op == "" {
+		op = "="
+	}
+	return Requirement{Key: key, Operator: op, Values: values}, nil
+}
+
+// Matches reports whether a map of labels, or annotations, satisfies every requirement
+func (s Selector) Matches(labels map[string]any) bool {
+	for _, req := range s {
+		raw, exists := labels[req.Key]
+		value := fmt.Sprint(raw)
+		var ok bool
+		switch req.Operator {
+		case "exists":
+			ok = exists
+		case "!":
+			ok = !exists
+		case "=":
+			ok = exists && value == req.Values[0]
+		case "!=":
+			ok = !exists || value != req.Values[0]
+		case "in":
+			ok = exists && slices.Contains(req.Values, value)
+		case "notin":
+			ok = !exists || !slices.Contains(req.Values, value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelector_Matches(t *testing.T) {
+	labels := map[string]any{"app": "web", "tier": "frontend", "helm.sh/hook": "pre-install"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{selector: "", want: true},
+		{selector: "app=web", want: true},
+		{selector: "app==web", want: true},
+		{selector: "app=api", want: false},
+		{selector: "app!=api", want: true},
+		{selector: "missing!=x", want: true},
+		{selector: "helm.sh/hook", want: true},
+		{selector: "!helm.sh/hook", want: false},
+		{selector: "!canary", want: true},
+		{selector: "tier in (frontend, backend)", want: true},
+		{selector: "tier in (backend)", want: false},
+		{selector: "tier notin (backend)", want: true},
+		{selector: "missing in (x)", want: false},
+		{selector: "app=web, tier in (frontend,backend), !canary", want: true},
+		{selector: "app=web,tier=backend", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("ParseSelector() error = %v, want nil", err)
+			}
+			if got := selector.Matches(labels); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelector_Errors(t *testing.T) {
+	tests := []struct {
+		selector      string
+		wantErrSubstr string
+	}{
+		{selector: "app=web,", wantErrSubstr: "empty requirement"},
+		{selector: "=web", wantErrSubstr: `invalid key ""`},
+		{selector: "tier in frontend", wantErrSubstr: "must be in parentheses"},
+		{selector: "tier like (x)", wantErrSubstr: "unknown operator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			_, err := ParseSelector(tt.selector)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("ParseSelector() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.yaml.in/yaml/v4"
+)
+
+// Style controls the formatting of encoded YAML
+type Style struct {
+	// Indent is the number of spaces per indentation level
+	Indent int
+	// IndentSequences indents sequence items by a full level. Otherwise the "- " counts towards
+	// the indentation, which aligns the dashes with the parent key at 2 spaces.
+	IndentSequences bool
+}
+
+// DefaultStyle is the style kustomize emits: 2-space indentation with dashes aligned with the
+// parent key
+var DefaultStyle = Style{Indent: 2}
+
+// newEncoder returns an encoder writing to w in this style
+func (s Style) newEncoder(w io.Writer) *yaml.Encoder {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(s.Indent)
+	if !s.IndentSequences {
+		encoder.CompactSeqIndent()
+	}
+	return encoder
+}
+
+// Reformat re-encodes a multi-document YAML stream in the given style. Key order, comments and
+// scalar styles are kept, so only indentation changes.
+func Reformat(data []byte, style Style) ([]byte, error) {
+	var buf bytes.Buffer
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	encoder := style.newEncoder(&buf)
+
+	documents := 0
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		documents++
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode document %d: %w", documents, err)
+		}
+		if err := encoder.Encode(&node); err != nil {
+			return nil, fmt.Errorf("failed to encode document %d: %w", documents, err)
+		}
+	}
+
+	// The encoder fails to close without documents
+	if documents == 0 {
+		return nil, nil
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close encoder: %w", err)
+	}
+	return buf.Bytes(), nil
+}
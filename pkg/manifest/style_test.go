@@ -0,0 +1,131 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReformat(t *testing.T) {
+	input := `# Source: chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        args:
+        - --port=8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  script: |
+    echo hello
+`
+
+	tests := []struct {
+		name  string
+		style Style
+		want  string
+	}{
+		{
+			name:  "default style keeps kustomize formatting",
+			style: DefaultStyle,
+			want:  input,
+		},
+		{
+			name:  "indented sequences",
+			style: Style{Indent: 2, IndentSequences: true},
+			want: `# Source: chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+        - name: web
+          args:
+            - --port=8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  script: |
+    echo hello
+`,
+		},
+		{
+			name:  "four spaces",
+			style: Style{Indent: 4},
+			want: `# Source: chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+    name: web
+spec:
+    template:
+        spec:
+            containers:
+              - name: web
+                args:
+                  - --port=8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+    name: config
+data:
+    script: |
+        echo hello
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Reformat([]byte(input), tt.style)
+			if err != nil {
+				t.Fatalf("Reformat() error = %v, want nil", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Reformat() =\n%s\nwant =\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReformat_Empty(t *testing.T) {
+	got, err := Reformat(nil, DefaultStyle)
+	if err != nil {
+		t.Fatalf("Reformat() error = %v, want nil", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Reformat() = %q, want empty", got)
+	}
+}
+
+func TestReformat_InvalidYAML(t *testing.T) {
+	_, err := Reformat([]byte("a: 1\n---\nb: [\n"), DefaultStyle)
+	if err == nil || !strings.Contains(err.Error(), "failed to decode document 2") {
+		t.Errorf("Reformat() error = %v, want decode error for document 2", err)
+	}
+}
+
+func TestEncode_CompactSequences(t *testing.T) {
+	got, err := Encode(map[string]any{"items": []any{"a", "b"}})
+	if err != nil {
+		t.Fatalf("Encode() error = %v, want nil", err)
+	}
+	if want := "items:\n- a\n- b\n"; string(got) != want {
+		t.Errorf("Encode() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+// Package plugindata helps charts that render KustomizePluginData documents from their values
+package plugindata
+
+import "reflect"
+
+// SchemaFor returns a JSON Schema for values, the chart values as found in values.yaml that feed
+// a KustomizePluginData template, for chart authors to merge into values.schema.json so that
+// helm lint rejects values the template cannot render. Each value fixes the type of its key.
+// Objects list their keys as properties and reject other keys, catching misspelt overlay values
+// that would otherwise render nothing; empty objects, empty lists and null values accept any
+// content, for values meant to be filled in. The items of lists take the schema their elements
+// share, with the properties of object elements combined.
+func SchemaFor(values map[string]any) map[string]any {
+	return schemaOf(values)
+}
+
+// schemaOf returns the schema of a value decoded from YAML or JSON
+func schemaOf(value any) map[string]any {
+	switch v := value.(type) {
+	case nil:
+		return map[string]any{}
+	case string:
+		return map[string]any{"type": "string"}
+	case bool:
+		return map[string]any{"type": "boolean"}
+	case map[string]any:
+		if len(v) == 0 {
+			return map[string]any{"type": "object"}
+		}
+		properties := make(map[string]any, len(v))
+		for key, item := range v {
+			properties[key] = schemaOf(item)
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	case []any:
+		schema := map[string]any{"type": "array"}
+		if len(v) == 0 {
+			return schema
+		}
+		items := schemaOf(v[0])
+		for _, item := range v[1:] {
+			items = merge(items, schemaOf(item))
+		}
+		if len(items) > 0 {
+			schema["items"] = items
+		}
+		return schema
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// merge returns a schema accepting the values of both schemas: integers widen to numbers, the
+// properties of objects are combined and values of different types accept anything
+func merge(a, b map[string]any) map[string]any {
+	typeA, typeB := a["type"], b["type"]
+	switch {
+	case typeA == nil || typeB == nil:
+		return map[string]any{}
+	case typeA == "integer" && typeB == "number", typeA == "number" && typeB == "integer":
+		return map[string]any{"type": "number"}
+	case typeA != typeB:
+		return map[string]any{}
+	}
+
+	switch typeA {
+	case "object":
+		propertiesA, closedA := a["properties"].(map[string]any)
+		propertiesB, closedB := b["properties"].(map[string]any)
+		// An empty object among the elements leaves the items open
+		if !closedA || !closedB {
+			return map[string]any{"type": "object"}
+		}
+		properties := make(map[string]any, len(propertiesA)+len(propertiesB))
+		for key, schema := range propertiesA {
+			properties[key] = schema
+		}
+		for key, schema := range propertiesB {
+			if existing, ok := properties[key]; ok {
+				schema = merge(existing.(map[string]any), schema.(map[string]any))
+			}
+			properties[key] = schema
+		}
+		return map[string]any{"type": "object", "properties": properties, "additionalProperties": false}
+	case "array":
+		itemsA, okA := a["items"].(map[string]any)
+		itemsB, okB := b["items"].(map[string]any)
+		if !okA || !okB {
+			return map[string]any{"type": "array"}
+		}
+		schema := map[string]any{"type": "array"}
+		if items := merge(itemsA, itemsB); len(items) > 0 {
+			schema["items"] = items
+		}
+		return schema
+	}
+	return a
+}
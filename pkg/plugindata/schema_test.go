@@ -0,0 +1,102 @@
+package plugindata
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.yaml.in/yaml/v4"
+)
+
+func TestSchemaFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		values string
+		want   string
+	}{
+		{
+			name:   "scalars",
+			values: "overlay: prod\nenabled: true\nreplicas: 3\nratio: 0.5\n",
+			want: `{"type":"object","additionalProperties":false,"properties":{
+				"overlay":{"type":"string"},"enabled":{"type":"boolean"},
+				"replicas":{"type":"integer"},"ratio":{"type":"number"}}}`,
+		},
+		{
+			name:   "nested objects are closed",
+			values: "kustomize:\n  namePrefix: prod-\n  labels:\n    team: web\n",
+			want: `{"type":"object","additionalProperties":false,"properties":{
+				"kustomize":{"type":"object","additionalProperties":false,"properties":{
+					"namePrefix":{"type":"string"},
+					"labels":{"type":"object","additionalProperties":false,"properties":{"team":{"type":"string"}}}}}}}`,
+		},
+		{
+			name:   "empty and null values are open",
+			values: "patches: {}\nimages: []\nnamespace: null\n",
+			want: `{"type":"object","additionalProperties":false,"properties":{
+				"patches":{"type":"object"},"images":{"type":"array"},"namespace":{}}}`,
+		},
+		{
+			name:   "list items combine their properties",
+			values: "images:\n- name: nginx\n  newTag: \"1.25\"\n- name: redis\n  newName: mirror/redis\n",
+			want: `{"type":"object","additionalProperties":false,"properties":{
+				"images":{"type":"array","items":{"type":"object","additionalProperties":false,"properties":{
+					"name":{"type":"string"},"newTag":{"type":"string"},"newName":{"type":"string"}}}}}}`,
+		},
+		{
+			name:   "list items widen integers to numbers",
+			values: "weights: [1, 2.5]\n",
+			want: `{"type":"object","additionalProperties":false,"properties":{
+				"weights":{"type":"array","items":{"type":"number"}}}}`,
+		},
+		{
+			name:   "list items of different types",
+			values: "resources: [all.yaml, {path: extra.yaml}]\n",
+			want: `{"type":"object","additionalProperties":false,"properties":{
+				"resources":{"type":"array"}}}`,
+		},
+		{
+			name:   "empty object among list items",
+			values: "patches:\n- {}\n- path: replicas.yaml\n",
+			want: `{"type":"object","additionalProperties":false,"properties":{
+				"patches":{"type":"array","items":{"type":"object"}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values map[string]any
+			if err := yaml.Unmarshal([]byte(tt.values), &values); err != nil {
+				t.Fatalf("Failed to parse values: %v", err)
+			}
+			var want map[string]any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("Failed to parse want: %v", err)
+			}
+
+			// Compare the JSON encoding, as values.schema.json holds it
+			encoded, err := json.Marshal(SchemaFor(values))
+			if err != nil {
+				t.Fatalf("Failed to encode schema: %v", err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(encoded, &got); err != nil {
+				t.Fatalf("Failed to decode schema: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SchemaFor() = %s, want %s", encoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaFor_JSONValues(t *testing.T) {
+	// Values decoded from JSON have float64 numbers only
+	var values map[string]any
+	if err := json.Unmarshal([]byte(`{"replicas": 3}`), &values); err != nil {
+		t.Fatalf("Failed to parse values: %v", err)
+	}
+	want := map[string]any{"type": "object", "additionalProperties": false, "properties": map[string]any{"replicas": map[string]any{"type": "number"}}}
+	if got := SchemaFor(values); !reflect.DeepEqual(got, want) {
+		t.Errorf("SchemaFor() = %v, want %v", got, want)
+	}
+}
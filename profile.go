@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// Environment variables enabling pprof profiles of a render, for performance investigations.
+// Inspect the results with `go tool pprof dist/helm-kustomize <file>`.
+const (
+	envCPUProfile = "HELM_KUSTOMIZE_CPU_PROFILE"
+	envMemProfile = "HELM_KUSTOMIZE_MEM_PROFILE"
+)
+
+// startProfiling starts the profiles requested through the environment. The returned function
+// stops CPU profiling and writes the heap profile; it must be called once the render is done.
+func startProfiling() (func() error, error) {
+	var cpuFile *os.File
+	if path := os.Getenv(envCPUProfile); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to start CPU profile: %w", err), f.Close())
+		}
+		cpuFile = f
+	}
+
+	stop := func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				return fmt.Errorf("failed to write CPU profile: %w", err)
+			}
+		}
+
+		path := os.Getenv(envMemProfile)
+		if path == "" {
+			return nil
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create memory profile: %w", err)
+		}
+
+		// Collect garbage first so that the profile shows live memory accurately
+		runtime.GC()
+		if err := errors.Join(pprof.WriteHeapProfile(f), f.Close()); err != nil {
+			return fmt.Errorf("failed to write memory profile: %w", err)
+		}
+		return nil
+	}
+
+	return stop, nil
+}
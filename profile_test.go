@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartProfiling(t *testing.T) {
+	dir := t.TempDir()
+	cpuProfile := filepath.Join(dir, "cpu.pprof")
+	memProfile := filepath.Join(dir, "mem.pprof")
+	t.Setenv(envCPUProfile, cpuProfile)
+	t.Setenv(envMemProfile, memProfile)
+
+	stop, err := startProfiling()
+	if err != nil {
+		t.Fatalf("startProfiling() error = %v, want nil", err)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("stop() error = %v, want nil", err)
+	}
+
+	for _, path := range []string{cpuProfile, memProfile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Expected profile %s: %v", path, err)
+		}
+		if info.Size() == 0 {
+			t.Errorf("Profile %s is empty", path)
+		}
+	}
+}
+
+func TestStartProfiling_Disabled(t *testing.T) {
+	t.Setenv(envCPUProfile, "")
+	t.Setenv(envMemProfile, "")
+
+	stop, err := startProfiling()
+	if err != nil {
+		t.Fatalf("startProfiling() error = %v, want nil", err)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("stop() error = %v, want nil", err)
+	}
+}
+
+func TestStartProfiling_InvalidPath(t *testing.T) {
+	t.Setenv(envCPUProfile, filepath.Join(t.TempDir(), "missing", "cpu.pprof"))
+
+	if _, err := startProfiling(); err == nil {
+		t.Error("startProfiling() should fail for an invalid path")
+	}
+}
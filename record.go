@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+	"go.yaml.in/yaml/v4"
+)
+
+// Files of a fixture directory written by record and replayed by the golden tests
+const (
+	// fixtureInput is the manifest stream the post-renderer read
+	fixtureInput = "input.yaml"
+	// fixturePluginData holds the KustomizePluginData documents of the input, for reviewers
+	fixturePluginData = "plugin-data.yaml"
+	// fixtureExpected is the output of the render
+	fixtureExpected = "expected.yaml"
+	// fixtureArgs holds the post-renderer arguments, one per line
+	fixtureArgs = "args"
+)
+
+// fixture is a recorded render
+type fixture struct {
+	Args     []string
+	Input    []byte
+	Expected []byte
+}
+
+// runRecord renders the manifests read from stdin like the post-renderer does, writes the output
+// to stdout and records the render as a fixture in the directory given as first argument. The
+// remaining arguments are post-renderer flags; config files and environment variables are
+// ignored so that the fixture replays the same way everywhere.
+func runRecord(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("record requires a fixture directory, e.g. helm template ./chart | helm-kustomize record testdata/golden/chart --debug")
+	}
+	dir, flags := args[0], args[1:]
+
+	opts := options.Default()
+	if err := opts.ParseArgs(flags); err != nil {
+		return fmt.Errorf("failed to load options: %w", err)
+	}
+
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	renderer := &KustomizePostRenderer{Options: opts}
+	output, err := renderer.RunContext(ctx, bytes.NewBuffer(bytes.Clone(input)))
+	if err != nil {
+		return err
+	}
+
+	if err := writeFixture(dir, fixture{Args: flags, Input: input, Expected: output.Bytes()}); err != nil {
+		return err
+	}
+	_, err = stdout.Write(output.Bytes())
+	return err
+}
+
+// writeFixture writes a fixture to dir, replacing the files of an earlier recording
+func writeFixture(dir string, f fixture) error {
+	pluginData, err := pluginDataDocuments(f.Input)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create fixture directory: %w", err)
+	}
+
+	var args string
+	if len(f.Args) > 0 {
+		args = strings.Join(f.Args, "\n") + "\n"
+	}
+	files := map[string][]byte{
+		fixtureInput:    f.Input,
+		fixtureExpected: f.Expected,
+		fixtureArgs:     []byte(args),
+	}
+	if pluginData != nil {
+		files[fixturePluginData] = pluginData
+	} else if err := os.Remove(filepath.Join(dir, fixturePluginData)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale %s: %w", fixturePluginData, err)
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to write fixture: %w", err)
+		}
+	}
+	return nil
+}
+
+// readFixture reads a fixture written by writeFixture
+func readFixture(dir string) (fixture, error) {
+	var f fixture
+	var err error
+	if f.Input, err = os.ReadFile(filepath.Join(dir, fixtureInput)); err != nil {
+		return fixture{}, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	if f.Expected, err = os.ReadFile(filepath.Join(dir, fixtureExpected)); err != nil {
+		return fixture{}, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	args, err := os.ReadFile(filepath.Join(dir, fixtureArgs))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fixture{}, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	for line := range strings.Lines(string(args)) {
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			f.Args = append(f.Args, line)
+		}
+	}
+	return f, nil
+}
+
+// pluginDataDocuments returns the KustomizePluginData documents of a manifest stream, one per
+// pipeline, or nil if it has none
+func pluginDataDocuments(input []byte) ([]byte, error) {
+	var docs [][]byte
+	decoder := yaml.NewDecoder(bytes.NewReader(input))
+	for {
+		var doc map[string]any
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse input: %w", err)
+		}
+		if parser.IsPluginData(doc) {
+			encoded, err := manifest.Encode(doc)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, encoded)
+		}
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	return parser.JoinDocuments(docs), nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/options"
+)
+
+// goldenDir holds the fixtures recorded with `helm-kustomize record`
+const goldenDir = "testdata/golden"
+
+func TestGolden(t *testing.T) {
+	entries, err := os.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", goldenDir, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		t.Run(entry.Name(), func(t *testing.T) {
+			f, err := readFixture(filepath.Join(goldenDir, entry.Name()))
+			if err != nil {
+				t.Fatalf("readFixture() error = %v, want nil", err)
+			}
+			opts := options.Default()
+			if err := opts.ParseArgs(f.Args); err != nil {
+				t.Fatalf("ParseArgs(%q) error = %v, want nil", f.Args, err)
+			}
+
+			renderer := &KustomizePostRenderer{Options: opts}
+			output, err := renderer.Run(bytes.NewBuffer(f.Input))
+			if err != nil {
+				t.Fatalf("Run() error = %v, want nil", err)
+			}
+			if output.String() != string(f.Expected) {
+				t.Errorf("Output mismatch, re-record the fixture if the change is intended.\nExpected:\n%s\nGot:\n%s", f.Expected, output.String())
+			}
+		})
+	}
+}
+
+func TestRunRecord(t *testing.T) {
+	input := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-configmap
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    commonAnnotations:
+      team: platform
+`
+	dir := filepath.Join(t.TempDir(), "fixture")
+
+	var stdout bytes.Buffer
+	if err := runRecord(context.Background(), []string{dir, "--indent", "4"}, strings.NewReader(input), &stdout); err != nil {
+		t.Fatalf("runRecord() error = %v, want nil", err)
+	}
+	if !strings.Contains(stdout.String(), "team: platform") {
+		t.Errorf("Expected the rendered output on stdout, got:\n%s", stdout.String())
+	}
+
+	f, err := readFixture(dir)
+	if err != nil {
+		t.Fatalf("readFixture() error = %v, want nil", err)
+	}
+	want := fixture{Args: []string{"--indent", "4"}, Input: []byte(input), Expected: stdout.Bytes()}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("readFixture() = %+v, want %+v", f, want)
+	}
+
+	pluginData, err := os.ReadFile(filepath.Join(dir, fixturePluginData))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", fixturePluginData, err)
+	}
+	if !strings.Contains(string(pluginData), "kind: KustomizePluginData") || strings.Contains(string(pluginData), "ConfigMap") {
+		t.Errorf("Expected only the plugin data document in %s, got:\n%s", fixturePluginData, pluginData)
+	}
+}
+
+func TestRunRecord_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		input         string
+		wantErrSubstr string
+	}{
+		{name: "no directory", args: nil, wantErrSubstr: "record requires a fixture directory"},
+		{name: "flag first", args: []string{"--debug"}, wantErrSubstr: "record requires a fixture directory"},
+		{name: "invalid flag", args: []string{"fixture", "--indent", "1"}, wantErrSubstr: "failed to load options"},
+		{name: "render failure", args: []string{"fixture"}, input: "key: [", wantErrSubstr: "failed to parse input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+				args = append([]string{filepath.Join(t.TempDir(), args[0])}, args[1:]...)
+			}
+			err := runRecord(context.Background(), args, strings.NewReader(tt.input), &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Fatalf("runRecord() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/internal/sarif"
+	"github.com/owhelm/helm-kustomize/internal/validate"
+	"github.com/owhelm/helm-kustomize/internal/version"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// sarifRules describes the validation rules in SARIF reports
+var sarifRules = []sarif.Rule{
+	{ID: validate.RuleInvalidResource, ShortDescription: sarif.Message{Text: "Rendered resource is not a valid Kubernetes object"}},
+	{ID: validate.RuleRemovedAPI, ShortDescription: sarif.Message{Text: "Rendered resource uses an API version removed in the target Kubernetes version"}},
+	{ID: validate.RuleSchema, ShortDescription: sarif.Message{Text: "Rendered custom resource does not match the schema of its CRD"}},
+}
+
+// templateSources maps input resources to the chart templates they were rendered from
+type templateSources struct {
+	byID   map[manifest.ID]string
+	byName map[manifest.ID]string
+}
+
+// newTemplateSources indexes the "# Source:" comments of the input documents
+func newTemplateSources(input *parser.ParseResult) templateSources {
+	sources := templateSources{byID: map[manifest.ID]string{}, byName: map[manifest.ID]string{}}
+	for i, doc := range input.OtherDocuments {
+		source := parser.SourceOf(doc)
+		if source == "" {
+			continue
+		}
+		id := manifest.IDOf(input.OtherResources[i])
+		sources.byID[id] = source
+		sources.byName[manifest.ID{Kind: id.Kind, Name: id.Name}] = source
+	}
+	return sources
+}
+
+// lookup returns the template a rendered resource was rendered from. Kustomize commonly sets
+// the namespace, so resources are also matched by kind and name alone.
+func (s templateSources) lookup(resource map[string]any) string {
+	id := manifest.IDOf(resource)
+	if source, ok := s.byID[id]; ok {
+		return source
+	}
+	return s.byName[manifest.ID{Kind: id.Kind, Name: id.Name}]
+}
+
+// writeSARIF writes the validation findings to the configured SARIF file. Findings are located
+// at the chart template of the offending resource when it can be found; resources generated by
+// the kustomization have no location.
+func (k *KustomizePostRenderer) writeSARIF(input *parser.ParseResult, resources []map[string]any, findings []validate.Finding, level options.ValidationLevel) error {
+	sources := newTemplateSources(input)
+
+	sarifLevel := "error"
+	if level == options.ValidationWarn {
+		sarifLevel = "warning"
+	}
+
+	results := make([]sarif.Result, 0, len(findings))
+	for _, finding := range findings {
+		result := sarif.Result{
+			RuleID:  finding.Rule,
+			Level:   sarifLevel,
+			Message: sarif.Message{Text: finding.String()},
+		}
+		if source := sources.lookup(resources[finding.Index]); source != "" {
+			result.Locations = []sarif.Location{sarif.FileLocation(source)}
+		}
+		results = append(results, result)
+	}
+
+	driver := sarif.Driver{
+		Name:           "helm-kustomize",
+		Version:        version.Version,
+		InformationURI: "https://github.com/owhelm/helm-kustomize",
+		Rules:          sarifRules,
+	}
+	k.debugf("writing %d findings to %s", len(results), k.Options.SARIF)
+	return sarif.WriteFile(k.Options.SARIF, sarif.NewLog(driver, results))
+}
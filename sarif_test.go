@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/sarif"
+)
+
+func TestKustomizePostRenderer_Run_SARIF(t *testing.T) {
+	input := bytes.NewBufferString(`---
+# Source: chart/templates/ingress.yaml
+apiVersion: networking.k8s.io/v1beta1
+kind: Ingress
+metadata:
+  name: web
+---
+# Source: chart/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: Invalid_Name
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namespace: test
+    resources:
+    - extra.yaml
+  extra.yaml: |
+    apiVersion: v1
+    kind: ConfigMap
+    metadata:
+      name: Generated_Name
+`)
+
+	path := filepath.Join(t.TempDir(), "results.sarif")
+	renderer := &KustomizePostRenderer{
+		Options: options.Options{Validate: options.ValidationWarn, TargetKubernetes: "1.22", SARIF: path},
+		Stderr:  io.Discard,
+	}
+	if _, err := renderer.Run(input); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read SARIF file: %v", err)
+	}
+	var log sarif.Log
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("Failed to decode SARIF file: %v", err)
+	}
+
+	locations := map[string]string{}
+	for _, result := range log.Runs[0].Results {
+		if result.Level != "warning" {
+			t.Errorf("Result level = %q, want warning", result.Level)
+		}
+		uri := ""
+		if len(result.Locations) > 0 {
+			uri = result.Locations[0].PhysicalLocation.ArtifactLocation.URI
+		}
+		locations[result.RuleID+" "+result.Message.Text] = uri
+	}
+
+	want := map[string]string{
+		`removed-api Ingress/web: networking.k8s.io/v1beta1 Ingress was removed in Kubernetes 1.22, use networking.k8s.io/v1`: "chart/templates/ingress.yaml",
+		`invalid-resource ConfigMap/Invalid_Name: metadata.name "Invalid_Name" must be a lowercase RFC 1123 subdomain`:        "chart/templates/configmap.yaml",
+		`invalid-resource ConfigMap/Generated_Name: metadata.name "Generated_Name" must be a lowercase RFC 1123 subdomain`:    "",
+	}
+	if len(locations) != len(want) {
+		t.Fatalf("SARIF results = %v, want %v", locations, want)
+	}
+	for message, uri := range want {
+		got, ok := locations[message]
+		if !ok {
+			t.Errorf("Missing SARIF result %q, got %v", message, locations)
+		} else if got != uri {
+			t.Errorf("Result %q location = %q, want %q", message, got, uri)
+		}
+	}
+}
+
+func TestKustomizePostRenderer_Run_SARIFWithoutFindings(t *testing.T) {
+	input := bytes.NewBufferString(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    namespace: test
+`)
+
+	path := filepath.Join(t.TempDir(), "results.sarif")
+	renderer := &KustomizePostRenderer{Options: options.Options{Validate: options.ValidationError, SARIF: path}}
+	if _, err := renderer.Run(input); err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read SARIF file: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"results": []`)) {
+		t.Errorf("Expected empty results, got:\n%s", data)
+	}
+}
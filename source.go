@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/owhelm/helm-kustomize/internal/diff"
+	"github.com/owhelm/helm-kustomize/internal/options"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+	"github.com/owhelm/helm-kustomize/pkg/manifest"
+)
+
+// generatedFile receives the resources of a per-file output that no template rendered, such as
+// the ones the kustomization generates
+const generatedFile = "helm-kustomize-generated.yaml"
+
+// manifestSource provides the manifests to post-render and takes the output
+type manifestSource interface {
+	// Read returns the manifest stream
+	Read() (*bytes.Buffer, error)
+	// Write delivers the output of the render
+	Write(output *bytes.Buffer) error
+}
+
+// newManifestSource returns the directory source of --input-dir, or stdin and stdout as Helm
+// uses them. With --input-dir or --output-dir, the output is written to one file per template.
+func newManifestSource(opts options.Options, stdin io.Reader, stdout io.Writer) manifestSource {
+	var files *fileOutput
+	// Check mode emits nothing, so no files are written
+	if !opts.Check && (opts.InputDir != "" || opts.OutputDir != "") {
+		files = &fileOutput{dir: cmp.Or(opts.OutputDir, opts.InputDir)}
+	}
+	if opts.InputDir != "" {
+		return &dirSource{dir: opts.InputDir, files: files}
+	}
+	return &streamSource{stdin: stdin, stdout: stdout, files: files}
+}
+
+// streamSource reads the manifests from a reader and writes the output to a writer, or to files
+// named after the "# Source:" comments of the input
+type streamSource struct {
+	stdin  io.Reader
+	stdout io.Writer
+	files  *fileOutput
+}
+
+// Read implements manifestSource
+func (s *streamSource) Read() (*bytes.Buffer, error) {
+	input := &bytes.Buffer{}
+	if _, err := io.Copy(input, s.stdin); err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	// Helm names the files of --output-dir after the templates, as in the comments
+	if s.files != nil {
+		s.files.input = bytes.Clone(input.Bytes())
+		s.files.origins = map[string]string{}
+		for _, doc := range parser.SplitDocuments(input.Bytes()) {
+			if source := parser.SourceOf(doc); source != "" && filepath.IsLocal(filepath.FromSlash(source)) {
+				s.files.origins[source] = source
+			}
+		}
+	}
+	return input, nil
+}
+
+// Write implements manifestSource
+func (s *streamSource) Write(output *bytes.Buffer) error {
+	if s.files != nil {
+		return s.files.write(output)
+	}
+	if _, err := io.Copy(s.stdout, output); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return nil
+}
+
+// dirSource reads the manifests from the tree `helm template --output-dir` writes, one file per
+// template
+type dirSource struct {
+	dir   string
+	files *fileOutput
+}
+
+// Read implements manifestSource. Documents without a "# Source:" comment get one naming their
+// file, so that their origin survives the render.
+func (s *dirSource) Read() (*bytes.Buffer, error) {
+	input := &bytes.Buffer{}
+	origins := map[string]string{}
+	var read []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		file := filepath.ToSlash(rel)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		read = append(read, file)
+		for _, doc := range parser.SplitDocuments(data) {
+			if len(bytes.TrimSpace(doc)) == 0 {
+				continue
+			}
+			source := parser.SourceOf(doc)
+			if source == "" {
+				source = file
+				doc = withSource(source, doc)
+			}
+			if _, ok := origins[source]; !ok {
+				origins[source] = file
+			}
+			writeDocument(input, doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input directory: %w", err)
+	}
+
+	if s.files != nil {
+		s.files.input = bytes.Clone(input.Bytes())
+		s.files.origins = origins
+		// Written in place, the files of templates that render nothing anymore are stale
+		if filepath.Clean(s.files.dir) == filepath.Clean(s.dir) {
+			s.files.stale = read
+		}
+	}
+	return input, nil
+}
+
+// Write implements manifestSource
+func (s *dirSource) Write(output *bytes.Buffer) error {
+	if s.files == nil {
+		return nil
+	}
+	return s.files.write(output)
+}
+
+// fileOutput writes each output resource to the file of the template it was rendered from, at
+// the same path relative to dir as in the tree of `helm template --output-dir`
+type fileOutput struct {
+	dir string
+	// input is the stream that was read
+	input []byte
+	// origins maps the "# Source:" comments of the input documents to their file
+	origins map[string]string
+	// stale are the files that are removed if no document is written to them
+	stale []string
+}
+
+// write writes the output. Output resources are traced back to their input resource by ID, or by
+// a name containing the original one like the summary does; generated resources and resources of
+// unknown origin go to generatedFile.
+func (o *fileOutput) write(output *bytes.Buffer) error {
+	input, err := parser.ParseManifests(o.input)
+	if err != nil {
+		return fmt.Errorf("failed to parse input: %w", err)
+	}
+	rendered, err := parser.ParseManifests(output.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to parse output: %w", err)
+	}
+
+	sources := make(map[manifest.ID]string, len(input.OtherResources))
+	for i, doc := range input.OtherDocuments {
+		sources[manifest.IDOf(input.OtherResources[i])] = parser.SourceOf(doc)
+	}
+
+	files := map[string]*bytes.Buffer{}
+	add := func(source string, doc []byte) {
+		file, ok := o.origins[source]
+		if !ok {
+			file = generatedFile
+		}
+		if files[file] == nil {
+			files[file] = &bytes.Buffer{}
+		}
+		writeDocument(files[file], doc)
+	}
+
+	originals := diff.Originals(input.OtherResources, rendered.OtherResources)
+	for i, doc := range rendered.OtherDocuments {
+		// Documents emitted as they were read, e.g. by --preserve-untouched, keep their comment
+		source := parser.SourceOf(doc)
+		if source == "" && originals[i] != nil && sources[manifest.IDOf(originals[i])] != "" {
+			source = sources[manifest.IDOf(originals[i])]
+			doc = withSource(source, doc)
+		}
+		add(source, doc)
+	}
+	for _, doc := range rendered.NonResourceDocuments {
+		add(parser.SourceOf(doc), doc)
+	}
+
+	for _, file := range o.stale {
+		if _, ok := files[file]; !ok {
+			if err := os.Remove(filepath.Join(o.dir, filepath.FromSlash(file))); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", file, err)
+			}
+		}
+	}
+	for _, file := range slices.Sorted(maps.Keys(files)) {
+		path := filepath.Join(o.dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", file, err)
+		}
+		if err := os.WriteFile(path, files[file].Bytes(), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// withSource prepends a "# Source:" comment to doc, like Helm does
+func withSource(source string, doc []byte) []byte {
+	return append([]byte("# Source: "+source+"\n"), doc...)
+}
+
+// writeDocument appends doc to w after a document marker, ending it with a newline
+func writeDocument(w *bytes.Buffer, doc []byte) {
+	w.WriteString("---\n")
+	w.Write(doc)
+	if !bytes.HasSuffix(doc, []byte("\n")) {
+		w.WriteByte('\n')
+	}
+}
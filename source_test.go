@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/owhelm/helm-kustomize/internal/options"
+)
+
+func TestStreamSource(t *testing.T) {
+	var stdout bytes.Buffer
+	source := newManifestSource(options.Options{}, strings.NewReader("kind: ConfigMap\n"), &stdout)
+
+	input, err := source.Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v, want nil", err)
+	}
+	if input.String() != "kind: ConfigMap\n" {
+		t.Errorf("Read() = %q, want the stdin content", input.String())
+	}
+	if err := source.Write(bytes.NewBufferString("kind: Secret\n")); err != nil {
+		t.Fatalf("Write() error = %v, want nil", err)
+	}
+	if stdout.String() != "kind: Secret\n" {
+		t.Errorf("Write() wrote %q, want the output", stdout.String())
+	}
+}
+
+// writeTree writes files relative to dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"app/templates/configmap.yaml": `---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: fast
+`,
+		"app/templates/services.yaml": `---
+# Source: app/templates/services.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+# Source: app/templates/services.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+`,
+		"app/templates/kustomize.yaml": `---
+# Source: app/templates/kustomize.yaml
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+    namePrefix: prod-
+    configMapGenerator:
+      - name: extra
+        literals:
+          - key=value
+`,
+		"app/README.md": "not a manifest\n",
+	})
+
+	source := newManifestSource(options.Options{InputDir: dir}, nil, nil)
+	input, err := source.Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v, want nil", err)
+	}
+	output, err := (&KustomizePostRenderer{}).Run(input)
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil", err)
+	}
+	if err := source.Write(output); err != nil {
+		t.Fatalf("Write() error = %v, want nil", err)
+	}
+
+	want := map[string]string{
+		"app/templates/configmap.yaml": `---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+data:
+  mode: fast
+kind: ConfigMap
+metadata:
+  name: prod-settings
+`,
+		"app/templates/services.yaml": `---
+# Source: app/templates/services.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: prod-api
+---
+# Source: app/templates/services.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: prod-web
+`,
+		generatedFile: `---
+apiVersion: v1
+data:
+  key: value
+kind: ConfigMap
+metadata:
+  name: prod-extra-t757gk2bmf
+`,
+		"app/README.md": "not a manifest\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app", "templates", "kustomize.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Stat() of the plugin data template error = %v, want it removed", err)
+	}
+}
+
+func TestDirSource_OutputDir(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "rendered")
+	configMap := `---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+`
+	pluginData := `---
+# Source: app/templates/kustomize.yaml
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+`
+	writeTree(t, inputDir, map[string]string{
+		"app/templates/configmap.yaml": configMap,
+		"app/templates/kustomize.yaml": pluginData,
+	})
+
+	source := newManifestSource(options.Options{InputDir: inputDir, OutputDir: outputDir}, nil, nil)
+	if _, err := source.Read(); err != nil {
+		t.Fatalf("Read() error = %v, want nil", err)
+	}
+	if err := source.Write(bytes.NewBufferString("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: prod-settings\n")); err != nil {
+		t.Fatalf("Write() error = %v, want nil", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outputDir, "app", "templates", "configmap.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	want := "---\n# Source: app/templates/configmap.yaml\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: prod-settings\n"
+	if string(got) != want {
+		t.Errorf("configmap.yaml = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "app", "templates", "kustomize.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Stat() of the plugin data template error = %v, want it not written", err)
+	}
+
+	// The input directory is left as it was
+	for name, content := range map[string]string{"app/templates/configmap.yaml": configMap, "app/templates/kustomize.yaml": pluginData} {
+		got, err := os.ReadFile(filepath.Join(inputDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", name, err)
+		} else if string(got) != content {
+			t.Errorf("input %s = %q, want it unchanged", name, got)
+		}
+	}
+}
+
+func TestStreamSource_OutputDir(t *testing.T) {
+	dir := t.TempDir()
+	input := `---
+# Source: app/templates/web.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+# Source: ../outside.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: escape
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: anonymous
+`
+	output := "apiVersion: v1\nkind: Service\nmetadata:\n  name: anonymous\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: escape\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n"
+
+	source := newManifestSource(options.Options{OutputDir: dir}, strings.NewReader(input), nil)
+	if _, err := source.Read(); err != nil {
+		t.Fatalf("Read() error = %v, want nil", err)
+	}
+	if err := source.Write(bytes.NewBufferString(output)); err != nil {
+		t.Fatalf("Write() error = %v, want nil", err)
+	}
+
+	want := map[string]string{
+		"app/templates/web.yaml": "---\n# Source: app/templates/web.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+		// Sources outside of the directory are not followed
+		generatedFile: "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: anonymous\n---\n# Source: ../outside.yaml\napiVersion: v1\nkind: Service\nmetadata:\n  name: escape\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", name, err)
+		} else if string(got) != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "outside.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Stat() of outside.yaml error = %v, want it not written", err)
+	}
+}
+
+func TestManifestSource_Check(t *testing.T) {
+	dir := t.TempDir()
+	source := newManifestSource(options.Options{OutputDir: dir, Check: true}, strings.NewReader("# Source: app/templates/web.yaml\nkind: Service\n"), &bytes.Buffer{})
+	if _, err := source.Read(); err != nil {
+		t.Fatalf("Read() error = %v, want nil", err)
+	}
+	if err := source.Write(&bytes.Buffer{}); err != nil {
+		t.Fatalf("Write() error = %v, want nil", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("Write() in check mode wrote %d entries, want none", len(entries))
+	}
+}
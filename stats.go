@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/owhelm/helm-kustomize/internal/helm"
+	"github.com/owhelm/helm-kustomize/internal/parser"
+)
+
+// chartFile is a file of the plugin data, for the largest files of stats
+type chartFile struct {
+	pipeline string
+	path     string
+	size     int
+}
+
+// runStats reads rendered manifests from stdin and reports their size and the size of the plugin
+// data, so chart authors can keep the release within the Helm and etcd limits and spot bloat
+func runStats(_ context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	top := fs.Int("top", 5, "number of largest plugin data files to list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *top < 0 {
+		return fmt.Errorf("--top must not be negative, got %d", *top)
+	}
+
+	input, err := io.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	result, err := parser.ParseManifests(input)
+	if err != nil {
+		return fmt.Errorf("failed to parse input: %w", err)
+	}
+
+	documents := 0
+	for _, doc := range parser.SplitDocuments(input) {
+		if len(bytes.TrimSpace(doc)) > 0 {
+			documents++
+		}
+	}
+	pluginDataDocuments := documents - len(result.OtherResources) - len(result.NonResourceDocuments)
+
+	resourcesSize := parser.DocumentsSize(result.OtherDocuments)
+	pluginDataSize := len(input) - resourcesSize - parser.DocumentsSize(result.NonResourceDocuments)
+	var files []chartFile
+	for _, data := range result.Pipelines {
+		for path, content := range data.Files {
+			files = append(files, chartFile{pipeline: data.Name, path: path, size: len(content)})
+		}
+	}
+	slices.SortFunc(files, func(a, b chartFile) int {
+		return cmp.Or(cmp.Compare(b.size, a.size), cmp.Compare(a.pipeline, b.pipeline), cmp.Compare(a.path, b.path))
+	})
+
+	// The release holds the post-rendered manifest, approximated by the resources before the build
+	releaseSize, err := helm.EstimateReleaseSize(input, parser.JoinDocuments(result.OtherDocuments))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Documents: %d (%d resources, %d KustomizePluginData, %d other)\n", documents, len(result.OtherResources), pluginDataDocuments, len(result.NonResourceDocuments))
+	fmt.Fprintf(stdout, "Total size: %s\n", formatSize(len(input)))
+	fmt.Fprintf(stdout, "Resources size: %s\n", formatSize(resourcesSize))
+	if len(result.Pipelines) == 0 {
+		fmt.Fprintln(stdout, "Plugin data: none")
+	} else {
+		fmt.Fprintf(stdout, "Plugin data: %s in %d pipeline(s), %d files\n", formatSize(pluginDataSize), len(result.Pipelines), len(files))
+	}
+	fmt.Fprintf(stdout, "Estimated Helm release size: %s of %s (%d%%)\n", formatSize(releaseSize), formatSize(helm.ReleaseSizeLimit), releaseSize*100/helm.ReleaseSizeLimit)
+
+	if len(files) > 0 && *top > 0 {
+		fmt.Fprintln(stdout, "Largest files:")
+		for _, file := range files[:min(*top, len(files))] {
+			name := file.path
+			if len(result.Pipelines) > 1 {
+				name = fmt.Sprintf("%s (pipeline %q)", file.path, file.pipeline)
+			}
+			fmt.Fprintf(stdout, "  %10s  %s\n", formatSize(file.size), name)
+		}
+	}
+
+	if releaseSize > helm.ReleaseSizeLimit {
+		return fmt.Errorf("the estimated Helm release size %s is over the %s limit of Kubernetes Secrets", formatSize(releaseSize), formatSize(helm.ReleaseSizeLimit))
+	}
+	return nil
+}
+
+// formatSize formats a size in bytes with a binary unit, e.g. 1.5KiB
+func formatSize(size int) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
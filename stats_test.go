@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestRunStats(t *testing.T) {
+	input := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+# Release notes
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+files:
+  kustomization.yaml: |
+    resources:
+      - all.yaml
+  dashboard.json: '` + strings.Repeat("x", 2048) + `'
+---
+apiVersion: helm.plugin.kustomize/v1
+kind: KustomizePluginData
+name: tenant
+files:
+  kustomization.yaml: |
+    namespace: tenant
+`
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "largest files",
+			args: []string{"--top", "2"},
+			want: `Documents: 4 (1 resources, 2 KustomizePluginData, 1 other)
+Total size: 2.4KiB
+Resources size: 58B
+Plugin data: 2.3KiB in 2 pipeline(s), 3 files
+Estimated Helm release size: 564B of 1.0MiB (0%)
+Largest files:
+      2.0KiB  dashboard.json (pipeline "")
+         24B  kustomization.yaml (pipeline "")
+`,
+		},
+		{
+			name: "no files",
+			args: []string{"--top", "0"},
+			want: `Documents: 4 (1 resources, 2 KustomizePluginData, 1 other)
+Total size: 2.4KiB
+Resources size: 58B
+Plugin data: 2.3KiB in 2 pipeline(s), 3 files
+Estimated Helm release size: 564B of 1.0MiB (0%)
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := runStats(context.Background(), tt.args, strings.NewReader(input), &stdout); err != nil {
+				t.Fatalf("runStats() error = %v, want nil", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("runStats() output =\n%s\nwant:\n%s", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRunStats_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		input         string
+		wantErrSubstr string
+	}{
+		{name: "unexpected argument", args: []string{"chart"}, wantErrSubstr: `unexpected argument "chart"`},
+		{name: "negative top", args: []string{"--top", "-1"}, wantErrSubstr: "--top must not be negative"},
+		{name: "invalid input", input: "key: [", wantErrSubstr: "failed to parse input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runStats(context.Background(), tt.args, strings.NewReader(tt.input), &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErrSubstr) {
+				t.Errorf("runStats() error = %v, want error containing %q", err, tt.wantErrSubstr)
+			}
+		})
+	}
+}
+
+func TestRunStats_OverLimit(t *testing.T) {
+	// Random data does not compress, so the release outgrows its Secret
+	blob := make([]byte, 640<<10)
+	if _, err := rand.Read(blob); err != nil {
+		t.Fatalf("Failed to generate random data: %v", err)
+	}
+	input := "apiVersion: helm.plugin.kustomize/v1\nkind: KustomizePluginData\nfiles:\n  blob.txt: " + hex.EncodeToString(blob) + "\n"
+
+	var stdout bytes.Buffer
+	err := runStats(context.Background(), nil, strings.NewReader(input), &stdout)
+	if err == nil || !strings.Contains(err.Error(), "over the 1.0MiB limit of Kubernetes Secrets") {
+		t.Errorf("runStats() error = %v, want error containing %q", err, "over the 1.0MiB limit of Kubernetes Secrets")
+	}
+	if !strings.Contains(stdout.String(), "1.2MiB  blob.txt") {
+		t.Errorf("Expected the report before the error, got:\n%s", stdout.String())
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int
+		want string
+	}{
+		{size: 0, want: "0B"},
+		{size: 1023, want: "1023B"},
+		{size: 1536, want: "1.5KiB"},
+		{size: 3 << 20, want: "3.0MiB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatSize(tt.size); got != tt.want {
+			t.Errorf("formatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}